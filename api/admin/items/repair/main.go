@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/admin"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+type repairClient struct {
+	dynamodbSvc *dynamodb.Client
+	s3Svc       *s3.Client
+}
+
+func (c *repairClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return c.dynamodbSvc.GetItem(ctx, params, optFns...)
+}
+
+func (c *repairClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return c.dynamodbSvc.UpdateItem(ctx, params, optFns...)
+}
+
+func (c *repairClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return c.s3Svc.GetObject(ctx, params, optFns...)
+}
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	if err := admin.Authorize(apiutil.Caller(req)); err != nil {
+		fmt.Printf("admin request denied for caller %q\n", apiutil.Caller(req))
+		return apiutil.NewErrorResponse(http.StatusForbidden, err.Error()), nil
+	}
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	messageID := req.PathParameters["messageID"]
+	fmt.Printf("request params: [messagesID] %s\n", messageID)
+	if messageID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
+	}
+
+	client := &repairClient{
+		dynamodbSvc: dynamodbClient.Get(cfg),
+		s3Svc:       s3Client.Get(cfg),
+	}
+	result, err := admin.Repair(ctx, client, messageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, api.ErrInvalidInput):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		case errors.Is(err, api.ErrNotFound):
+			return apiutil.NewErrorResponse(http.StatusNotFound, "item not found"), nil
+		case errors.Is(err, api.ErrTooManyRequests):
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("repair item failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/admin"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	if err := admin.Authorize(apiutil.Caller(req)); err != nil {
+		fmt.Printf("admin request denied for caller %q\n", apiutil.Caller(req))
+		return apiutil.NewErrorResponse(http.StatusForbidden, err.Error()), nil
+	}
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	bundle := admin.SettingsBundle{}
+	err = json.Unmarshal([]byte(req.Body), &bundle)
+	if err != nil {
+		fmt.Printf("failed to unmarshal: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+	}
+
+	names, err := admin.ImportSettings(ctx, dynamodbClient.Get(cfg), bundle)
+	if err != nil {
+		switch {
+		case errors.Is(err, api.ErrInvalidInput):
+			return apiutil.NewErrorResponse(http.StatusBadRequest, err.Error()), nil
+		case errors.Is(err, api.ErrTooManyRequests):
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("import settings failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	fmt.Printf("settings %q imported by %s\n", names, apiutil.Caller(req))
+
+	body, err := json.Marshal(map[string][]string{"settings": names})
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
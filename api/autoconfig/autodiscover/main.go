@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/autoconfig"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+)
+
+// handler serves the Microsoft autodiscover response, which is public since mail clients request it before logging in
+func handler(_ context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	fmt.Println("request received")
+
+	servers, err := autoconfig.ServersFromEnv()
+	if err != nil {
+		fmt.Printf("invalid autoconfig servers, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	reqBody := []byte(req.Body)
+	if req.IsBase64Encoded {
+		reqBody, err = base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid body"), nil
+		}
+	}
+
+	body, err := autoconfig.Autodiscover(reqBody, servers)
+	if err != nil {
+		switch err {
+		case api.ErrInvalidInput:
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid body"), nil
+		case api.ErrNotFound:
+			return apiutil.NewErrorResponse(http.StatusNotFound, "autodiscover not enabled"), nil
+		}
+		fmt.Printf("autodiscover failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	fmt.Println("invoke successful")
+	return apiutil.Response{
+		StatusCode: http.StatusOK,
+		Body:       string(body),
+		Headers: map[string]string{
+			"Content-Type": "application/xml; charset=utf-8",
+		},
+	}, nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
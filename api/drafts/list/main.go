@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	pageSizeStr := req.QueryStringParameters["pageSize"]
+	nextCursor := req.QueryStringParameters["nextCursor"]
+
+	pageSize := email.DefaultPageSize
+	if pageSizeStr != "" {
+		pageSize, err = strconv.Atoi(pageSizeStr)
+		if err != nil {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+	}
+
+	cursor := &email.Cursor{}
+	err = cursor.BindString(nextCursor)
+	if err != nil {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+	}
+
+	fmt.Printf("request query: pageSize: %s, nextCursor: %s\n", pageSizeStr, nextCursor)
+
+	result, err := email.ListDrafts(ctx, dynamodbClient.Get(cfg), email.ListDraftsInput{
+		PageSize:   pageSize,
+		NextCursor: cursor,
+	})
+	if err != nil {
+		if err == api.ErrInvalidInput || err == api.ErrQueryNotMatch {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("draft list failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/history"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	messageID := req.PathParameters["messageID"]
+	fmt.Printf("request params: [messagesID] %s\n", messageID)
+	if messageID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
+	}
+
+	var action string
+	switch {
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/unarchive"):
+		action = email.ActionUnarchive
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/archive"):
+		action = email.ActionArchive
+	default:
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid action"), nil
+	}
+
+	err = email.Archive(ctx, dynamodbClient.Get(cfg), messageID, action)
+	if err != nil {
+		if errors.Is(err, &api.InvalidTransitionError{}) {
+			fmt.Printf("dynamodb archive failed: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusConflict, err.Error()), nil
+		}
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+
+		fmt.Printf("dynamodb archive failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	event := history.EventArchived
+	if action == email.ActionUnarchive {
+		event = history.EventUnarchived
+	}
+	if err := history.Record(ctx, dynamodbClient.Get(cfg), messageID, history.NewEvent(event, "")); err != nil {
+		fmt.Printf("failed to record history: %v\n", err)
+	}
+
+	folder := email.StateArchived
+	if action == email.ActionUnarchive {
+		folder = email.StateInbox
+	}
+	if err := hook.SendEmailWebhook(ctx, &hook.Hook{Action: hook.ActionMoved, Email: hook.Email{ID: messageID}, Folder: folder}); err != nil {
+		fmt.Printf("failed to send webhook, %v\n", err)
+	}
+
+	return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
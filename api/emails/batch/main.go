@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/history"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+type batchClient struct {
+	cfg aws.Config
+}
+
+func (c batchClient) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	svc := dynamodbClient.Get(c.cfg)
+	return svc.BatchGetItem(ctx, params, optFns...)
+}
+
+func (c batchClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	svc := dynamodbClient.Get(c.cfg)
+	return svc.DeleteItem(ctx, params, optFns...)
+}
+
+func (c batchClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	svc := dynamodbClient.Get(c.cfg)
+	return svc.GetItem(ctx, params, optFns...)
+}
+
+func (c batchClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	svc := dynamodbClient.Get(c.cfg)
+	return svc.TransactWriteItems(ctx, params, optFns...)
+}
+
+func (c batchClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	svc := dynamodbClient.Get(c.cfg)
+	return svc.UpdateItem(ctx, params, optFns...)
+}
+
+func (c batchClient) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	svc := s3Client.Get(c.cfg)
+	return svc.DeleteObject(ctx, params, optFns...)
+}
+
+func (c batchClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	svc := s3Client.Get(c.cfg)
+	return svc.HeadObject(ctx, params, optFns...)
+}
+
+// historyEvent returns the history event recorded on the emails changed by a batch
+func historyEvent(input email.BatchInput) string {
+	switch input.Action {
+	case email.ActionRead:
+		return history.EventRead
+	case email.ActionUnread:
+		return history.EventUnread
+	case email.ActionTrash:
+		return history.EventTrashed
+	case email.ActionDelete:
+		return history.EventPurged
+	}
+	if input.Folder == email.FolderArchive {
+		return history.EventArchived
+	}
+	return history.EventUnarchived
+}
+
+// hooks returns the hooks of the emails changed by a batch, deleted emails have none
+func hooks(input email.BatchInput, messageIDs []string) []hook.Hook {
+	data := hook.Hook{Action: hook.ActionMoved}
+	switch input.Action {
+	case email.ActionRead:
+		data.Action = hook.ActionRead
+	case email.ActionUnread:
+		data.Action = hook.ActionUnread
+	case email.ActionTrash:
+		data.Folder = email.StateTrashed
+	case email.ActionDelete:
+		return nil
+	default:
+		data.Folder = email.StateInbox
+		if input.Folder == email.FolderArchive {
+			data.Folder = email.StateArchived
+		}
+	}
+
+	result := make([]hook.Hook, len(messageIDs))
+	for i, messageID := range messageIDs {
+		result[i] = data
+		result[i].Email = hook.Email{ID: messageID}
+	}
+	return result
+}
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	// a batch changes up to 100 emails, which takes longer if they are changed one by one
+	ctx, cancel := context.WithTimeout(ctx, 25*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	input := email.BatchInput{}
+	err = json.Unmarshal([]byte(req.Body), &input)
+	if err != nil {
+		fmt.Printf("failed to unmarshal: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+	}
+	fmt.Printf("request params: [action] %s, [folder] %s, [messageIDs] %d\n", input.Action, input.Folder, len(input.MessageIDs))
+
+	client := batchClient{cfg: cfg}
+	result, err := email.Batch(ctx, client, input)
+	if err != nil {
+		if err == api.ErrInvalidInput {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+
+		fmt.Printf("batch failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	event := historyEvent(input)
+	for _, messageID := range result.Succeeded {
+		if err := history.Record(ctx, client, messageID, history.NewEvent(event, "batch")); err != nil {
+			fmt.Printf("failed to record history: %v\n", err)
+		}
+	}
+	if err := hook.SendBatchWebhook(ctx, hooks(input, result.Succeeded)); err != nil {
+		fmt.Printf("failed to send webhook, %v\n", err)
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
@@ -9,46 +9,30 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/harryzcy/mailbox/internal/analytics"
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
 	"github.com/harryzcy/mailbox/internal/email"
-	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/outbound"
 	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
 )
 
-type createClient struct {
-	dynamodbSvc *dynamodb.Client
-	sesv2Svd    *sesv2.Client
-}
-
-func (c createClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
-	return c.dynamodbSvc.GetItem(ctx, params, optFns...)
-}
-
-func (c createClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
-	return c.dynamodbSvc.PutItem(ctx, params, optFns...)
-}
-
-func (c createClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
-	return c.dynamodbSvc.BatchWriteItem(ctx, params, optFns...)
-}
-
-func (c createClient) SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
-	return c.sesv2Svd.SendEmail(ctx, params, optFns...)
-}
-
-func (c createClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
-	return c.dynamodbSvc.TransactWriteItems(ctx, params, optFns...)
-}
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	sesv2Client    = awsutil.NewClient(sesv2.NewFromConfig)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
 
-func newCreateClient(cfg aws.Config) createClient {
-	return createClient{
-		dynamodbSvc: dynamodb.NewFromConfig(cfg),
-		sesv2Svd:    sesv2.NewFromConfig(cfg),
-	}
+// sendClient has the clients used to send emails
+type sendClient struct {
+	*clients.Clients
+	clients.Mailer
 }
 
 func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
@@ -57,7 +41,7 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 
 	fmt.Println("request received")
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	cfg, err := awsutil.LoadConfig(ctx)
 	if err != nil {
 		fmt.Printf("unable to load SDK config, %v\n", err)
 		return apiutil.NewErrorResponse(400, "invalid input"), nil
@@ -68,7 +52,7 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
 	}
 
-	input := email.CreateInput{}
+	input := outbound.CreateInput{}
 	err = json.Unmarshal([]byte(req.Body), &input)
 	if err != nil {
 		fmt.Printf("failed to unmarshal: %v\n", err)
@@ -83,12 +67,21 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
 	}
 
-	client := newCreateClient(cfg)
-	result, err := email.Create(ctx, client, input)
+	store, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return apiutil.NewErrorResponse(400, "invalid input"), nil
+	}
+	client := sendClient{Clients: store, Mailer: sesv2Client.Get(cfg)}
+	result, err := outbound.Create(ctx, client, input)
 	if err != nil {
 		if err == api.ErrInvalidInput {
 			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
 		}
+		if err == api.ErrUploadNotFound {
+			fmt.Println("upload not found")
+			return apiutil.NewErrorResponse(http.StatusBadRequest, api.ErrUploadNotFound.Error()), nil
+		}
 		if err == api.ErrTooManyRequests {
 			fmt.Println("too many requests")
 			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
@@ -98,6 +91,14 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
 	}
 
+	if result.Type == email.EmailTypeSent {
+		if err := analytics.RecordSent(ctx, client, cfg, result.MessageID); err != nil {
+			fmt.Printf("failed to put analytics record, %v\n", err)
+		}
+	} else if err := hook.SendDraftWebhook(ctx, hook.ActionCreated, result.MessageID); err != nil {
+		fmt.Printf("failed to send draft webhook, %v\n", err)
+	}
+
 	body, err := json.Marshal(result)
 	if err != nil {
 		fmt.Printf("marshal failed: %v\n", err)
@@ -107,5 +108,5 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(apiutil.WithAccessLog(handler))
 }
@@ -5,18 +5,26 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/harryzcy/mailbox/internal/api"
 	"github.com/harryzcy/mailbox/internal/email"
-	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/history"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
 )
 
 type deleteClient struct {
@@ -24,20 +32,40 @@ type deleteClient struct {
 }
 
 func (c deleteClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
-	svc := dynamodb.NewFromConfig(c.cfg)
+	svc := dynamodbClient.Get(c.cfg)
 	return svc.DeleteItem(ctx, params, optFns...)
 }
 
+func (c deleteClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	svc := dynamodbClient.Get(c.cfg)
+	return svc.GetItem(ctx, params, optFns...)
+}
+
+func (c deleteClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	svc := dynamodbClient.Get(c.cfg)
+	return svc.TransactWriteItems(ctx, params, optFns...)
+}
+
+func (c deleteClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	svc := dynamodbClient.Get(c.cfg)
+	return svc.UpdateItem(ctx, params, optFns...)
+}
+
 func (c deleteClient) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
-	svc := s3.NewFromConfig(c.cfg)
+	svc := s3Client.Get(c.cfg)
 	return svc.DeleteObject(ctx, params, optFns...)
 }
 
+func (c deleteClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	svc := s3Client.Get(c.cfg)
+	return svc.HeadObject(ctx, params, optFns...)
+}
+
 func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	cfg, err := awsutil.LoadConfig(ctx)
 	if err != nil {
 		fmt.Printf("unable to load SDK config, %v\n", err)
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
@@ -53,9 +81,16 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 	client := deleteClient{cfg: cfg}
 	err = email.Delete(ctx, client, messageID)
 	if err != nil {
-		if errors.Is(err, &api.NotTrashedError{Type: "email"}) {
+		if errors.Is(err, &api.InvalidTransitionError{}) {
 			fmt.Printf("dynamodb delete failed: %v\n", err)
-			return apiutil.NewErrorResponse(http.StatusBadRequest, "email not trashed"), nil
+			return apiutil.NewErrorResponse(http.StatusConflict, err.Error()), nil
+		}
+		if errors.Is(err, &api.RetentionError{}) {
+			fmt.Printf("s3 retention check failed: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusConflict, err.Error()), nil
+		}
+		if err == api.ErrPartOfThread {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "email is part of a thread"), nil
 		}
 		if err == api.ErrTooManyRequests {
 			fmt.Println("too many requests")
@@ -66,9 +101,18 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
 	}
 
+	if err := history.Record(ctx, client, messageID, history.NewEvent(history.EventPurged, "")); err != nil {
+		fmt.Printf("failed to record history: %v\n", err)
+	}
+	if strings.HasPrefix(messageID, "draft-") {
+		if err := hook.SendDraftWebhook(ctx, hook.ActionDeleted, messageID); err != nil {
+			fmt.Printf("failed to send draft webhook, %v\n", err)
+		}
+	}
+
 	return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(apiutil.WithAccessLog(handler))
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/harryzcy/mailbox/internal/analytics"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/outbound"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	sesv2Client    = awsutil.NewClient(sesv2.NewFromConfig)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+// sendClient has the clients used to send emails
+type sendClient struct {
+	*clients.Clients
+	clients.Mailer
+}
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(400, "invalid input"), nil
+	}
+
+	messageID := req.PathParameters["messageID"]
+	fmt.Printf("request params: [messagesID] %s\n", messageID)
+	if messageID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
+	}
+
+	input := outbound.ForwardInput{}
+	if req.Body != "" {
+		err = json.Unmarshal([]byte(req.Body), &input)
+		if err != nil {
+			fmt.Printf("failed to unmarshal: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+	}
+
+	store, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return apiutil.NewErrorResponse(400, "invalid input"), nil
+	}
+	client := sendClient{Clients: store, Mailer: sesv2Client.Get(cfg)}
+	result, err := outbound.Forward(ctx, client, messageID, input)
+	if err != nil {
+		if err == api.ErrInvalidInput {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+		if err == api.ErrNotFound {
+			fmt.Println("not found")
+			return apiutil.NewErrorResponse(http.StatusNotFound, "not found"), nil
+		}
+		if scanErr := new(api.ScanError); errors.As(err, &scanErr) {
+			fmt.Printf("email not forwarded: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusForbidden, err.Error()), nil
+		}
+		if err == api.ErrUploadNotFound {
+			fmt.Println("upload not found")
+			return apiutil.NewErrorResponse(http.StatusBadRequest, api.ErrUploadNotFound.Error()), nil
+		}
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+
+		fmt.Printf("email forward failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	if result.Type == email.EmailTypeSent {
+		if err := analytics.RecordSent(ctx, client, cfg, result.MessageID); err != nil {
+			fmt.Printf("failed to put analytics record, %v\n", err)
+		}
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
@@ -9,21 +9,24 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/harryzcy/mailbox/internal/api"
 	"github.com/harryzcy/mailbox/internal/email"
-	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/history"
 	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
 )
 
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
 func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	fmt.Println("request received")
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	cfg, err := awsutil.LoadConfig(ctx)
 	if err != nil {
 		fmt.Printf("unable to load SDK config, %v\n", err)
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
@@ -36,7 +39,14 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
 	}
 
-	result, err := email.GetAndRead(ctx, dynamodb.NewFromConfig(cfg), messageID)
+	view := req.QueryStringParameters["view"]
+	fmt.Printf("request params: [view] %s\n", view)
+	if !email.IsValidView(view) {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, api.ErrInvalidView.Error()), nil
+	}
+
+	client := dynamodbClient.Get(cfg)
+	result, err := email.GetAndRead(ctx, client, messageID)
 	if err != nil {
 		if err == api.ErrNotFound {
 			fmt.Println("email not found")
@@ -50,6 +60,19 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
 	}
 
+	if result.Type == email.EmailTypeInbox && result.Unread != nil && *result.Unread {
+		// the email is marked as read when it's opened
+		if err := history.Record(ctx, client, messageID, history.NewEvent(history.EventRead, "")); err != nil {
+			fmt.Printf("failed to record history: %v\n", err)
+		}
+	}
+
+	if err = email.RenderView(ctx, client, result, view); err != nil {
+		fmt.Printf("render view failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	result.DisplayAddresses()
 	body, err := json.Marshal(result)
 	if err != nil {
 		fmt.Printf("marshal failed: %v\n", err)
@@ -60,5 +83,5 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(apiutil.WithAccessLog(handler))
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	messageID := req.PathParameters["messageID"]
+	fmt.Printf("request params: [messagesID] %s\n", messageID)
+
+	if messageID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
+	}
+
+	index, err := strconv.Atoi(req.PathParameters["index"])
+	fmt.Printf("request params: [index] %s\n", req.PathParameters["index"])
+	if err != nil {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid index"), nil
+	}
+
+	client, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	result, err := email.GetAttachedEmail(ctx, client, messageID, index)
+	if err != nil {
+		if err == api.ErrNotFound {
+			fmt.Println("attachment not found")
+			return apiutil.NewErrorResponse(http.StatusNotFound, "attachment not found"), nil
+		}
+		if err == storage.ErrNotAttachedEmail {
+			fmt.Println("attachment is not an email")
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "attachment is not an email"), nil
+		}
+		fmt.Printf("get attached email failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	fmt.Println("invoke successful")
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
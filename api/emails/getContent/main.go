@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,22 +10,52 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/admin"
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/attachment"
 	"github.com/harryzcy/mailbox/internal/datasource/storage"
 	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
 )
 
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+type getContentClient struct {
+	dynamodbSvc *dynamodb.Client
+	s3Svc       *s3.Client
+}
+
+func (c getContentClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return c.dynamodbSvc.GetItem(ctx, params, optFns...)
+}
+
+func (c getContentClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return c.s3Svc.GetObject(ctx, params, optFns...)
+}
+
+func newGetContentClient(cfg aws.Config) getContentClient {
+	return getContentClient{
+		dynamodbSvc: dynamodbClient.Get(cfg),
+		s3Svc:       s3Client.Get(cfg),
+	}
+}
+
 func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	fmt.Println("request received")
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	cfg, err := awsutil.LoadConfig(ctx)
 	if err != nil {
 		fmt.Printf("unable to load SDK config, %v\n", err)
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
@@ -49,7 +80,37 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 	}
 	fmt.Printf("request params: [disposition] %s\n", disposition)
 
-	result, err := email.GetContent(ctx, s3.NewFromConfig(cfg), messageID, disposition, contentID)
+	client := newGetContentClient(cfg)
+	err = email.CheckScan(ctx, client, messageID)
+	if scanErr := new(api.ScanError); errors.As(err, &scanErr) {
+		if req.QueryStringParameters["force"] != "true" {
+			fmt.Printf("attachment not served: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusForbidden, err.Error()), nil
+		}
+		// only admins may download files that are infected or whose scan is pending
+		err = admin.OverrideScan(admin.ScanOverride{
+			Action:      admin.ActionAttachmentScanOverride,
+			Caller:      apiutil.Caller(req),
+			MessageID:   messageID,
+			Disposition: disposition,
+			ContentID:   contentID,
+			ScanState:   scanErr.State,
+		})
+		if err != nil {
+			fmt.Printf("scan override refused: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusForbidden, err.Error()), nil
+		}
+	} else if err != nil {
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("scan check failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	// the scan is checked above
+	result, err := email.GetContent(ctx, client, messageID, disposition, contentID, true)
 	if err != nil {
 		if err == api.ErrNotFound {
 			fmt.Println("not found")
@@ -63,13 +124,32 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
 	}
 
+	err = attachment.CheckServable(attachment.ParsePolicy(env.AttachmentPolicy), result.File, req.QueryStringParameters["release"] == "true")
+	if err != nil {
+		fmt.Printf("attachment not served: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusForbidden, err.Error()), nil
+	}
+
+	contentType := result.ContentType
+	if result.ContentTypeMismatch {
+		// don't let clients render content disguised as another type
+		fmt.Printf("content type mismatch: declared %s, detected %s\n", result.ContentType, result.DetectedContentType)
+		contentType = "application/octet-stream"
+	}
+
+	// inline parts are displayed by default, other files are downloaded
+	dispositionType := "attachment"
+	if disposition == storage.DispositionInlines && req.QueryStringParameters["download"] != "true" {
+		dispositionType = "inline"
+	}
+
 	fmt.Println("invoke successful")
 	return apiutil.NewBinaryResponse(
-		http.StatusOK, result.Content, result.ContentType,
-		disposition, result.Filename,
+		http.StatusOK, result.Content, contentType,
+		dispositionType, attachment.Filename(result.File),
 	), nil
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(apiutil.WithAccessLog(handler))
 }
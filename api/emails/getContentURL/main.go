@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/attachment"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+// response is a pre-signed URL that downloads a file, and the file
+type response struct {
+	*storage.Download
+	File types.File `json:"file"`
+}
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	messageID := req.PathParameters["messageID"]
+	fmt.Printf("request params: [messagesID] %s\n", messageID)
+
+	contentID := req.PathParameters["contentID"]
+	fmt.Printf("request params: [contentID] %s\n", contentID)
+	var disposition string
+	switch {
+	case strings.Contains(req.RawPath, storage.DispositionAttachments):
+		disposition = storage.DispositionAttachments
+	case strings.Contains(req.RawPath, storage.DispositionInlines):
+		disposition = storage.DispositionInlines
+	case strings.Contains(req.RawPath, storage.DispositionOthers):
+		disposition = storage.DispositionOthers
+	default:
+		fmt.Printf("invalid disposition: %s\n", req.RawPath)
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid disposition"), nil
+	}
+	fmt.Printf("request params: [disposition] %s\n", disposition)
+
+	client, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	result, err := email.GetContent(ctx, client, messageID, disposition, contentID, false)
+	if err != nil {
+		if scanErr := new(api.ScanError); errors.As(err, &scanErr) {
+			fmt.Printf("attachment not served: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusForbidden, err.Error()), nil
+		}
+		if err == api.ErrNotFound {
+			fmt.Println("not found")
+			return apiutil.NewErrorResponse(http.StatusNotFound, "not found"), nil
+		}
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("get content failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	if result == nil {
+		fmt.Println("content not found")
+		return apiutil.NewErrorResponse(http.StatusNotFound, "not found"), nil
+	}
+
+	err = attachment.CheckServable(attachment.ParsePolicy(env.AttachmentPolicy), result.File, req.QueryStringParameters["release"] == "true")
+	if err != nil {
+		fmt.Printf("attachment not served: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusForbidden, err.Error()), nil
+	}
+
+	contentType := result.ContentType
+	if result.ContentTypeMismatch {
+		// don't let clients render content disguised as another type
+		fmt.Printf("content type mismatch: declared %s, detected %s\n", result.ContentType, result.DetectedContentType)
+		contentType = "application/octet-stream"
+	}
+
+	// inline parts are displayed by default, other files are downloaded
+	dispositionType := "attachment"
+	if disposition == storage.DispositionInlines && req.QueryStringParameters["download"] != "true" {
+		dispositionType = "inline"
+	}
+
+	download, err := storage.PresignContent(ctx, client, s3.NewPresignClient(s3Client.Get(cfg)),
+		storage.ContentLocation(messageID, disposition, contentID), result.Content,
+		contentType, apiutil.ContentDisposition(dispositionType, attachment.Filename(result.File)))
+	if err != nil {
+		fmt.Printf("presign failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	body, err := json.Marshal(response{Download: download, File: result.File})
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,12 +10,20 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/admin"
 	"github.com/harryzcy/mailbox/internal/api"
-	"github.com/harryzcy/mailbox/internal/datasource/storage"
-	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
 )
 
 func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
@@ -23,7 +32,7 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 
 	fmt.Println("request received")
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	cfg, err := awsutil.LoadConfig(ctx)
 	if err != nil {
 		fmt.Printf("unable to load SDK config, %v\n", err)
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
@@ -36,7 +45,39 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
 	}
 
-	result, err := storage.S3.GetEmailRaw(ctx, s3.NewFromConfig(cfg), messageID)
+	client, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	err = email.CheckScan(ctx, client, messageID)
+	if scanErr := new(api.ScanError); errors.As(err, &scanErr) {
+		if req.QueryStringParameters["force"] != "true" {
+			fmt.Printf("raw email not served: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusForbidden, err.Error()), nil
+		}
+		// only admins may download emails that are infected or whose scan is pending
+		err = admin.OverrideScan(admin.ScanOverride{
+			Action:    admin.ActionRawScanOverride,
+			Caller:    apiutil.Caller(req),
+			MessageID: messageID,
+			ScanState: scanErr.State,
+		})
+		if err != nil {
+			fmt.Printf("scan override refused: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusForbidden, err.Error()), nil
+		}
+	} else if err != nil {
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("scan check failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	// the scan is checked above
+	result, err := email.GetRaw(ctx, client, messageID, true)
 	if err != nil {
 		if err == api.ErrNotFound {
 			fmt.Println("email not found")
@@ -64,5 +105,5 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(apiutil.WithAccessLog(handler))
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	messageID := req.PathParameters["messageID"]
+	fmt.Printf("request params: [messagesID] %s\n", messageID)
+	if messageID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
+	}
+
+	input := email.UpdateLabelsInput{}
+	err = json.Unmarshal([]byte(req.Body), &input)
+	if err != nil {
+		fmt.Printf("failed to unmarshal: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+	}
+
+	input.MessageID = messageID
+	err = email.UpdateLabels(ctx, dynamodbClient.Get(cfg), input)
+	if err != nil {
+		if err == api.ErrInvalidInput {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+		if err == api.ErrNotFound {
+			return apiutil.NewErrorResponse(http.StatusNotFound, "email not found"), nil
+		}
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+
+		fmt.Printf("dynamodb update labels failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	// the labels are valid, since they're updated
+	added, _ := email.NormalizeLabels(input.Add)
+	removed, _ := email.NormalizeLabels(input.Remove)
+	err = hook.SendEmailWebhook(ctx, &hook.Hook{
+		Action: hook.ActionLabeled,
+		Email:  hook.Email{ID: messageID},
+		Labels: &hook.Labels{Added: added, Removed: removed},
+	})
+	if err != nil {
+		fmt.Printf("failed to send webhook, %v\n", err)
+	}
+
+	return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
@@ -10,21 +10,23 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/harryzcy/mailbox/internal/api"
 	"github.com/harryzcy/mailbox/internal/email"
-	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
 )
 
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
 func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	fmt.Println("request received")
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	cfg, err := awsutil.LoadConfig(ctx)
 	if err != nil {
 		fmt.Printf("unable to load SDK config, %v\n", err)
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
@@ -35,6 +37,9 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 	month := req.QueryStringParameters["month"]
 	order := req.QueryStringParameters["order"]
 	showTrash := req.QueryStringParameters["showTrash"]
+	showArchived := req.QueryStringParameters["showArchived"]
+	label := req.QueryStringParameters["label"]
+	flaggedStr := req.QueryStringParameters["flagged"]
 	pageSizeStr := req.QueryStringParameters["pageSize"]
 	nextCursor := req.QueryStringParameters["nextCursor"]
 
@@ -46,26 +51,37 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		}
 	}
 
+	flagged := false
+	if flaggedStr != "" {
+		flagged, err = strconv.ParseBool(flaggedStr)
+		if err != nil {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+	}
+
 	cursor := &email.Cursor{}
 	err = cursor.BindString(nextCursor)
 	if err != nil {
 		return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
 	}
 
-	fmt.Printf("request query: type: %s, year: %s, month: %s, order: %s, pageSize: %s, nextCursor: %s\n",
-		emailType, year, month, order, pageSizeStr, nextCursor)
+	fmt.Printf("request query: type: %s, year: %s, month: %s, order: %s, label: %s, flagged: %s, pageSize: %s, nextCursor: %s\n",
+		emailType, year, month, order, label, flaggedStr, pageSizeStr, nextCursor)
 
-	result, err := email.List(ctx, dynamodb.NewFromConfig(cfg), email.ListInput{
-		Type:       emailType,
-		Year:       year,
-		Month:      month,
-		Order:      order,
-		ShowTrash:  showTrash,
-		PageSize:   pageSize,
-		NextCursor: cursor,
+	result, err := email.List(ctx, dynamodbClient.Get(cfg), email.ListInput{
+		Type:         emailType,
+		Year:         year,
+		Month:        month,
+		Order:        order,
+		ShowTrash:    showTrash,
+		ShowArchived: showArchived,
+		Label:        label,
+		Flagged:      flagged,
+		PageSize:     pageSize,
+		NextCursor:   cursor,
 	})
 	if err != nil {
-		if err == api.ErrInvalidInput {
+		if err == api.ErrInvalidInput || err == api.ErrQueryNotMatch {
 			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
 		}
 		if err == api.ErrTooManyRequests {
@@ -85,5 +101,5 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(apiutil.WithAccessLog(handler))
 }
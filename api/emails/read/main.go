@@ -9,21 +9,25 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/harryzcy/mailbox/internal/api"
 	"github.com/harryzcy/mailbox/internal/email"
-	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/history"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
 )
 
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
 func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	fmt.Println("request received")
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	cfg, err := awsutil.LoadConfig(ctx)
 	if err != nil {
 		fmt.Printf("unable to load SDK config, %v\n", err)
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
@@ -45,7 +49,7 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid action"), nil
 	}
 
-	err = email.Read(ctx, dynamodb.NewFromConfig(cfg), messageID, action)
+	err = email.Read(ctx, dynamodbClient.Get(cfg), messageID, action)
 	if err != nil {
 		if err == api.ErrTooManyRequests {
 			fmt.Println("too many requests")
@@ -56,9 +60,20 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
 	}
 
+	event := history.EventRead
+	if action == "unread" {
+		event = history.EventUnread
+	}
+	if err := history.Record(ctx, dynamodbClient.Get(cfg), messageID, history.NewEvent(event, "")); err != nil {
+		fmt.Printf("failed to record history: %v\n", err)
+	}
+	if err := hook.SendEmailWebhook(ctx, &hook.Hook{Action: action, Email: hook.Email{ID: messageID}}); err != nil {
+		fmt.Printf("failed to send webhook, %v\n", err)
+	}
+
 	return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(apiutil.WithAccessLog(handler))
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/search"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	input := email.SearchInput{
+		Query:      req.QueryStringParameters["q"],
+		Subject:    req.QueryStringParameters["subject"],
+		From:       req.QueryStringParameters["from"],
+		To:         req.QueryStringParameters["to"],
+		Text:       req.QueryStringParameters["text"],
+		Type:       req.QueryStringParameters["type"],
+		NextCursor: req.QueryStringParameters["nextCursor"],
+	}
+	if pageSize := req.QueryStringParameters["pageSize"]; pageSize != "" {
+		input.PageSize, err = strconv.Atoi(pageSize)
+		if err != nil {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+	}
+
+	var searcher email.Searcher
+	if search.Enabled() {
+		searcher = search.NewClient(cfg)
+	}
+	result, err := email.Search(ctx, dynamodbClient.Get(cfg), searcher, input)
+	if err != nil {
+		if err == api.ErrInvalidInput || err == api.ErrQueryNotMatch {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, err.Error()), nil
+		}
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		if errors.Is(err, search.ErrSearchFailed) {
+			fmt.Printf("search backend failed: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusBadGateway, "search failed"), nil
+		}
+		fmt.Printf("email search failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
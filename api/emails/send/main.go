@@ -3,44 +3,38 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/harryzcy/mailbox/internal/analytics"
 	"github.com/harryzcy/mailbox/internal/api"
-	"github.com/harryzcy/mailbox/internal/email"
-	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/outbound"
 	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
 )
 
-type sendClient struct {
-	dynamodbSvc *dynamodb.Client
-	sesv2Svc    *sesv2.Client
-}
-
-func (c sendClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
-	return c.dynamodbSvc.GetItem(ctx, params, optFns...)
-}
-
-func (c sendClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
-	return c.dynamodbSvc.TransactWriteItems(ctx, params, optFns...)
-}
-
-func (c sendClient) SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
-	return c.sesv2Svc.SendEmail(ctx, params, optFns...)
-}
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	sesv2Client    = awsutil.NewClient(sesv2.NewFromConfig)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+	sqsClient      = awsutil.NewClient(sqs.NewFromConfig)
+)
 
-func newSendClient(cfg aws.Config) sendClient {
-	return sendClient{
-		dynamodbSvc: dynamodb.NewFromConfig(cfg),
-		sesv2Svc:    sesv2.NewFromConfig(cfg),
-	}
+// sendClient has the clients used to send emails, and to queue them to be retried
+type sendClient struct {
+	*clients.Clients
+	clients.Mailer
+	clients.Queue
 }
 
 func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
@@ -52,15 +46,32 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 	messageID := req.PathParameters["messageID"]
 	fmt.Printf("request params: [messagesID] %s\n", messageID)
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	cfg, err := awsutil.LoadConfig(ctx)
 	if err != nil {
 		fmt.Printf("unable to load SDK config, %v\n", err)
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
 	}
 
-	client := newSendClient(cfg)
-	result, err := email.Send(ctx, client, messageID)
+	store, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
 	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	client := sendClient{Clients: store, Mailer: sesv2Client.Get(cfg), Queue: sqsClient.Get(cfg)}
+	result, err := outbound.Send(ctx, client, messageID)
+	if err != nil {
+		if errors.Is(err, &api.InvalidTransitionError{}) {
+			fmt.Printf("email send failed: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusConflict, err.Error()), nil
+		}
+		if errors.Is(err, api.ErrSendFailed) {
+			fmt.Printf("email send failed: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusBadGateway, api.ErrSendFailed.Error()), nil
+		}
+		if err == api.ErrUploadNotFound {
+			fmt.Println("upload not found")
+			return apiutil.NewErrorResponse(http.StatusBadRequest, api.ErrUploadNotFound.Error()), nil
+		}
 		if err == api.ErrTooManyRequests {
 			fmt.Println("too many requests")
 			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
@@ -70,14 +81,24 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
 	}
 
+	if !result.Retrying {
+		if err := analytics.RecordSent(ctx, client, cfg, result.MessageID); err != nil {
+			fmt.Printf("failed to put analytics record, %v\n", err)
+		}
+	}
+
 	body, err := json.Marshal(result)
 	if err != nil {
 		fmt.Printf("marshal failed: %v\n", err)
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
 	}
-	return apiutil.NewSuccessJSONResponse(string(body)), nil
+	response := apiutil.NewSuccessJSONResponse(string(body))
+	if result.Retrying {
+		response.StatusCode = http.StatusAccepted
+	}
+	return response, nil
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(apiutil.WithAccessLog(handler))
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/share"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	messageID := req.PathParameters["messageID"]
+	shareID := req.PathParameters["shareID"]
+	fmt.Printf("request params: [messagesID] %s, [shareID] %s\n", messageID, shareID)
+	if messageID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
+	}
+
+	client := dynamodbClient.Get(cfg)
+	if req.RequestContext.HTTP.Method == http.MethodDelete {
+		if shareID == "" {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid shareID"), nil
+		}
+		err = share.Revoke(ctx, client, messageID, shareID)
+		if err != nil {
+			return errorResponse(err), nil
+		}
+		return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
+	}
+
+	input := share.CreateInput{}
+	if req.Body != "" {
+		err = json.Unmarshal([]byte(req.Body), &input)
+		if err != nil {
+			fmt.Printf("failed to unmarshal: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+	}
+	input.MessageID = messageID
+	input.BaseURL = "https://" + req.RequestContext.DomainName
+
+	result, err := share.Create(ctx, client, input)
+	if err != nil {
+		return errorResponse(err), nil
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func errorResponse(err error) apiutil.Response {
+	switch err {
+	case api.ErrInvalidInput:
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input")
+	case api.ErrNotFound:
+		return apiutil.NewErrorResponse(http.StatusNotFound, "email not found")
+	case api.ErrShareNotFound:
+		return apiutil.NewErrorResponse(http.StatusNotFound, err.Error())
+	case api.ErrSharingDisabled:
+		return apiutil.NewErrorResponse(http.StatusForbidden, err.Error())
+	case api.ErrTooManyRequests:
+		fmt.Println("too many requests")
+		return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests")
+	}
+
+	fmt.Printf("share failed: %v\n", err)
+	return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error")
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
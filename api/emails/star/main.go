@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	messageID := req.PathParameters["messageID"]
+	fmt.Printf("request params: [messagesID] %s\n", messageID)
+	if messageID == "" {
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
+	}
+
+	var action string
+	switch {
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/unstar"):
+		action = email.ActionUnstar
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/star"):
+		action = email.ActionStar
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/unflag"):
+		action = email.ActionUnflag
+	case strings.HasSuffix(req.RequestContext.HTTP.Path, "/flag"):
+		action = email.ActionFlag
+	default:
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid action"), nil
+	}
+
+	err = email.Star(ctx, dynamodbClient.Get(cfg), messageID, action)
+	if err != nil {
+		if err == api.ErrNotFound {
+			return apiutil.NewErrorResponse(http.StatusNotFound, "email not found"), nil
+		}
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+
+		fmt.Printf("dynamodb star failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
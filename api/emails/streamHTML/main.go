@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+// handler streams the HTML body of an email behind a function URL in RESPONSE_STREAM mode,
+// including bodies that are too large to be returned from emails/get.
+// The context is not cancelled when the handler returns, since the body is read afterwards.
+func handler(ctx context.Context, req events.LambdaFunctionURLRequest) (*apiutil.StreamingResponse, error) {
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewStreamingErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	params, ok := apiutil.MatchPath("/emails/{messageID}/html", req.RequestContext.HTTP.Path)
+	if !ok {
+		return apiutil.NewStreamingErrorResponse(http.StatusNotFound, "not found"), nil
+	}
+
+	messageID := params["messageID"]
+	fmt.Printf("request params: [messagesID] %s\n", messageID)
+
+	client, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return apiutil.NewStreamingErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	html, err := email.OpenHTML(ctx, client, messageID)
+	if err != nil {
+		if err == api.ErrNotFound {
+			fmt.Println("email not found")
+			return apiutil.NewStreamingErrorResponse(http.StatusNotFound, "email not found"), nil
+		}
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewStreamingErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("open email html failed: %v\n", err)
+		return apiutil.NewStreamingErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	if html == nil {
+		fmt.Println("email has no html body")
+		return apiutil.NewStreamingErrorResponse(http.StatusNotFound, "email has no html body"), nil
+	}
+
+	fmt.Println("invoke successful")
+	resp := apiutil.NewStreamingResponse(
+		http.StatusOK, html.Body,
+		fmt.Sprintf("text/html; charset=%s", html.Charset), "inline",
+		fmt.Sprintf("%s.html", messageID),
+	)
+	// the HTML is untrusted, so it's rendered without scripts or access to the origin
+	resp.Headers["Content-Security-Policy"] = "sandbox"
+	resp.Headers["X-Content-Type-Options"] = "nosniff"
+	return resp, nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithStreamAccessLog(handler))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/admin"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+// handler streams the raw email behind a function URL in RESPONSE_STREAM mode,
+// so that emails larger than the 6MB response limit of API Gateway can be downloaded.
+// The context is not cancelled when the handler returns, since the body is read afterwards.
+func handler(ctx context.Context, req events.LambdaFunctionURLRequest) (*apiutil.StreamingResponse, error) {
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewStreamingErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	path := req.RequestContext.HTTP.Path
+	params, ok := apiutil.MatchPath("/emails/{messageID}/raw", path)
+	disposition := "inline"
+	if !ok {
+		params, ok = apiutil.MatchPath("/emails/{messageID}/download", path)
+		disposition = "attachment"
+	}
+	if !ok {
+		return apiutil.NewStreamingErrorResponse(http.StatusNotFound, "not found"), nil
+	}
+
+	messageID := params["messageID"]
+	fmt.Printf("request params: [messagesID] %s\n", messageID)
+
+	client, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return apiutil.NewStreamingErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	err = email.CheckScan(ctx, client, messageID)
+	if scanErr := new(api.ScanError); errors.As(err, &scanErr) {
+		if req.QueryStringParameters["force"] != "true" {
+			fmt.Printf("raw email not served: %v\n", err)
+			return apiutil.NewStreamingErrorResponse(http.StatusForbidden, err.Error()), nil
+		}
+		// only admins may download emails that are infected or whose scan is pending
+		err = admin.OverrideScan(admin.ScanOverride{
+			Action:    admin.ActionRawScanOverride,
+			Caller:    apiutil.StreamCaller(req),
+			MessageID: messageID,
+			ScanState: scanErr.State,
+		})
+		if err != nil {
+			fmt.Printf("scan override refused: %v\n", err)
+			return apiutil.NewStreamingErrorResponse(http.StatusForbidden, err.Error()), nil
+		}
+	} else if err != nil {
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewStreamingErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("scan check failed: %v\n", err)
+		return apiutil.NewStreamingErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	// the scan is checked above
+	body, err := email.OpenRaw(ctx, client, messageID, true)
+	if err != nil {
+		if err == api.ErrNotFound {
+			fmt.Println("email not found")
+			return apiutil.NewStreamingErrorResponse(http.StatusNotFound, "email not found"), nil
+		}
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewStreamingErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("open raw email failed: %v\n", err)
+		return apiutil.NewStreamingErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	fmt.Println("invoke successful")
+	return apiutil.NewStreamingResponse(
+		http.StatusOK, body,
+		"message/rfc822", disposition,
+		fmt.Sprintf("%s.eml", messageID),
+	), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithStreamAccessLog(handler))
+}
@@ -9,21 +9,25 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/harryzcy/mailbox/internal/api"
 	"github.com/harryzcy/mailbox/internal/email"
-	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/history"
+	"github.com/harryzcy/mailbox/internal/hook"
 	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
 )
 
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
 func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	fmt.Println("request received")
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	cfg, err := awsutil.LoadConfig(ctx)
 	if err != nil {
 		fmt.Printf("unable to load SDK config, %v\n", err)
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
@@ -36,11 +40,11 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusBadRequest, "bad request: invalid messageID"), nil
 	}
 
-	err = email.Trash(ctx, dynamodb.NewFromConfig(cfg), messageID)
+	err = email.Trash(ctx, dynamodbClient.Get(cfg), messageID)
 	if err != nil {
-		if errors.Is(err, &api.AlreadyTrashedError{Type: "email"}) {
+		if errors.Is(err, &api.InvalidTransitionError{}) {
 			fmt.Printf("dynamodb trash failed: %v\n", err)
-			return apiutil.NewErrorResponse(http.StatusBadRequest, "email is already trashed"), nil
+			return apiutil.NewErrorResponse(http.StatusConflict, err.Error()), nil
 		}
 		if err == api.ErrTooManyRequests {
 			fmt.Println("too many requests")
@@ -51,9 +55,16 @@ func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.R
 		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
 	}
 
+	if err := history.Record(ctx, dynamodbClient.Get(cfg), messageID, history.NewEvent(history.EventTrashed, "")); err != nil {
+		fmt.Printf("failed to record history: %v\n", err)
+	}
+	if err := hook.SendEmailWebhook(ctx, &hook.Hook{Action: hook.ActionMoved, Email: hook.Email{ID: messageID}, Folder: email.StateTrashed}); err != nil {
+		fmt.Printf("failed to send webhook, %v\n", err)
+	}
+
 	return apiutil.NewSuccessJSONResponse("{\"status\":\"success\"}"), nil
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(apiutil.WithAccessLog(handler))
 }
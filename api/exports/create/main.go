@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/export"
+	"github.com/harryzcy/mailbox/internal/jobs"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	sqsClient      = awsutil.NewClient(sqs.NewFromConfig)
+)
+
+// createClient has the clients used to create a job and queue it
+type createClient struct {
+	clients.Table
+	clients.Queue
+}
+
+// handler requests an archive of raw emails, which is packaged asynchronously by the jobs function
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	input := export.ArchiveInput{}
+	if req.Body != "" {
+		err = json.Unmarshal([]byte(req.Body), &input)
+		if err != nil {
+			fmt.Printf("failed to unmarshal: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+	}
+
+	input.Caller = apiutil.Caller(req)
+
+	archive, err := export.CreateArchive(ctx, createClient{Table: dynamodbClient.Get(cfg), Queue: sqsClient.Get(cfg)}, input)
+	if err != nil {
+		if err == jobs.ErrNotEnabled {
+			return apiutil.NewErrorResponse(http.StatusForbidden, "export is not enabled"), nil
+		}
+		if err == api.ErrForbidden {
+			return apiutil.NewErrorResponse(http.StatusForbidden, "forbidden"), nil
+		}
+		if err == api.ErrInvalidInput {
+			return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+		}
+		if err == api.ErrTooManyRequests {
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+		fmt.Printf("create archive failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	body, err := json.Marshal(archive)
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	response := apiutil.NewSuccessJSONResponse(string(body))
+	response.StatusCode = http.StatusAccepted
+	return response, nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
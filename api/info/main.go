@@ -31,5 +31,5 @@ func handler(_ context.Context, _ events.APIGatewayV2HTTPRequest) (apiutil.Respo
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(apiutil.WithAccessLog(handler))
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/share"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
+// handler serves the public view of a shared email, which is not signed by IAM
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fmt.Println("request received")
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	token := req.PathParameters["token"]
+	if token == "" {
+		return apiutil.NewErrorResponse(http.StatusNotFound, api.ErrShareNotFound.Error()), nil
+	}
+
+	result, err := share.Open(ctx, dynamodbClient.Get(cfg), token)
+	if err != nil {
+		switch err {
+		case api.ErrShareNotFound, api.ErrSharingDisabled:
+			return apiutil.NewErrorResponse(http.StatusNotFound, api.ErrShareNotFound.Error()), nil
+		case api.ErrShareExpired:
+			return apiutil.NewErrorResponse(http.StatusGone, err.Error()), nil
+		case api.ErrTooManyRequests:
+			fmt.Println("too many requests")
+			return apiutil.NewErrorResponse(http.StatusTooManyRequests, "too many requests"), nil
+		}
+
+		fmt.Printf("share open failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+
+	body, err := share.RenderView(result)
+	if err != nil {
+		fmt.Printf("render failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	return apiutil.Response{
+		StatusCode: http.StatusOK,
+		Body:       body,
+		Headers:    share.ViewHeaders,
+	}, nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler, "token"))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/harryzcy/mailbox/internal/sieve"
+	"github.com/harryzcy/mailbox/internal/util/apiutil"
+)
+
+type validateInput struct {
+	Script string `json:"script"`
+}
+
+type validateResult struct {
+	Valid   bool   `json:"valid"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func handler(_ context.Context, req events.APIGatewayV2HTTPRequest) (apiutil.Response, error) {
+	fmt.Println("request received")
+
+	input := validateInput{}
+	err := json.Unmarshal([]byte(req.Body), &input)
+	if err != nil {
+		fmt.Printf("failed to unmarshal: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusBadRequest, "invalid input"), nil
+	}
+
+	result := validateResult{Valid: true}
+	if _, err = sieve.Compile(input.Script); err != nil {
+		sieveErr := new(sieve.Error)
+		if !errors.As(err, &sieveErr) {
+			fmt.Printf("compile sieve script failed: %v\n", err)
+			return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+		}
+		result = validateResult{Line: sieveErr.Line, Message: sieveErr.Message}
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("marshal failed: %v\n", err)
+		return apiutil.NewErrorResponse(http.StatusInternalServerError, "internal error"), nil
+	}
+	return apiutil.NewSuccessJSONResponse(string(body)), nil
+}
+
+func main() {
+	lambda.Start(apiutil.WithAccessLog(handler))
+}
@@ -0,0 +1,84 @@
+// Command pop3 serves the inbox over POP3, for legacy devices and scripts that can't use the API.
+// Unlike the API, it's a long-running server, e.g. on EC2 or ECS, with the same AWS permissions as the API.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/pop3"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Printf("pop3 server failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(env.Region))
+	if err != nil {
+		return fmt.Errorf("unable to load SDK config, %w", err)
+	}
+
+	limit := 0
+	if env.POP3Limit != "" {
+		limit, err = strconv.Atoi(env.POP3Limit)
+		if err != nil || limit <= 0 {
+			return fmt.Errorf("invalid POP3_MAX_MESSAGES: %s", env.POP3Limit)
+		}
+	}
+
+	listener, err := listen()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("pop3 server listening on %s\n", listener.Addr())
+
+	server := &pop3.Server{
+		Username: env.POP3Username,
+		Password: env.POP3Password,
+		Mailbox: pop3.Inbox{
+			Client: dynamodb.NewFromConfig(cfg, retryutil.DynamoDB),
+			S3:     s3.NewFromConfig(cfg),
+			Limit:  limit,
+		},
+	}
+	return server.Serve(listener)
+}
+
+// listen listens with TLS if a certificate is configured, otherwise plaintext is only allowed explicitly
+func listen() (net.Listener, error) {
+	if env.POP3TLSCert == "" && env.POP3TLSKey == "" {
+		if env.POP3Insecure != "true" {
+			return nil, fmt.Errorf("POP3_TLS_CERT and POP3_TLS_KEY are required, unless POP3_INSECURE is true")
+		}
+		return net.Listen("tcp", address(":110"))
+	}
+
+	cert, err := tls.LoadX509KeyPair(env.POP3TLSCert, env.POP3TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load TLS certificate, %w", err)
+	}
+	return tls.Listen("tcp", address(":995"), &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+}
+
+func address(defaultAddress string) string {
+	if env.POP3Address != "" {
+		return env.POP3Address
+	}
+	return defaultAddress
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler removes the bodies of the emails kept longer than BODY_RETENTION_DAYS, it's meant to be invoked on a schedule
+func handler(ctx context.Context) (int, error) {
+	if _, ok := email.BodyRetentionDays(); !ok {
+		return 0, errors.New("bodies don't expire, BODY_RETENTION_DAYS is not set")
+	}
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return 0, err
+	}
+	cli, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return 0, err
+	}
+
+	// emails left by a failure are expired by the next run
+	expired, err := email.ExpireBodies(ctx, cli, time.Now())
+	if err != nil {
+		fmt.Printf("failed to expire bodies, %v\n", err)
+		return expired, err
+	}
+	fmt.Printf("bodies of %d emails expired\n", expired)
+	return expired, nil
+}
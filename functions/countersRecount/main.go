@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"github.com/harryzcy/mailbox/internal/counter"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler recounts the folder counters, it's meant to be invoked manually or on a schedule
+func handler(ctx context.Context) ([]counter.Counter, error) {
+	if !counter.Enabled() {
+		return nil, errors.New("counters are not enabled, DYNAMODB_COUNTERS_TABLE is not set")
+	}
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return nil, err
+	}
+
+	counters, err := counter.Recount(ctx, dynamodbClient.Get(cfg))
+	if err != nil {
+		fmt.Printf("failed to recount counters, %v\n", err)
+		return nil, err
+	}
+	return counters, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+
+	"github.com/harryzcy/mailbox/internal/digest"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	sesv2Client    = awsutil.NewClient(sesv2.NewFromConfig)
+)
+
+type client struct {
+	dynamodbSvc *dynamodb.Client
+	sesSvc      *sesv2.Client
+}
+
+func (c client) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return c.dynamodbSvc.Query(ctx, params, optFns...)
+}
+
+func (c client) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return c.dynamodbSvc.GetItem(ctx, params, optFns...)
+}
+
+func (c client) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return c.dynamodbSvc.Scan(ctx, params, optFns...)
+}
+
+func (c client) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return c.dynamodbSvc.UpdateItem(ctx, params, optFns...)
+}
+
+func (c client) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return c.dynamodbSvc.PutItem(ctx, params, optFns...)
+}
+
+func (c client) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return c.dynamodbSvc.TransactWriteItems(ctx, params, optFns...)
+}
+
+func (c client) SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	return c.sesSvc.SendEmail(ctx, params, optFns...)
+}
+
+func newClient(cfg aws.Config) client {
+	return client{
+		dynamodbSvc: dynamodbClient.Get(cfg),
+		sesSvc:      sesv2Client.Get(cfg),
+	}
+}
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler sends a digest of unread and starred emails, it's meant to be invoked on a schedule
+func handler(ctx context.Context) (*digest.Result, error) {
+	settings := digest.SettingsFromEnv()
+	if !settings.Enabled() {
+		fmt.Println("digests are not enabled, DIGEST_TO is not set")
+		return nil, nil
+	}
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return nil, err
+	}
+
+	result, err := digest.Run(ctx, newClient(cfg), settings)
+	if err != nil {
+		fmt.Printf("failed to send digest, %v\n", err)
+		return nil, err
+	}
+	fmt.Printf("digest of %d emails since %s, sent: %t\n", result.Count, result.Since, result.Sent)
+	return result, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/importer"
+	"github.com/harryzcy/mailbox/internal/receive"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler imports the mbox and .eml files in an S3 location, or resumes the import from the saved progress.
+// It's invoked repeatedly, e.g. by a schedule, until the import is completed.
+func handler(ctx context.Context, input importer.StartInput) (*importer.Progress, error) {
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config: %w", err)
+	}
+	dynamodbSvc := dynamodbClient.Get(cfg)
+	s3Svc := s3Client.Get(cfg)
+
+	input.Provider = importer.ProviderFiles
+	progress, err := importer.GetProgress(ctx, dynamodbSvc, input.ImportID)
+	if errors.Is(err, api.ErrNotFound) {
+		fmt.Printf("starting import %s from %s\n", input.ImportID, input.Location)
+		progress, err = importer.NewProgress(input)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if progress.Provider != importer.ProviderFiles {
+		return nil, fmt.Errorf("import %s is from %s, use mailImport instead", progress.ImportID, progress.Provider)
+	}
+	if input.Retry {
+		progress.Retry()
+	}
+
+	connector, err := importer.NewFiles(s3Svc, progress.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	err = importer.Run(ctx, dynamodbSvc, progress, connector, func(ctx context.Context, messageID string, message *importer.Message) error {
+		err := storage.S3.PutEmailRaw(ctx, s3Svc, messageID, message.Raw)
+		if err != nil {
+			return err
+		}
+		// the raw email is parsed by the same MIME parser as received emails, and stored in a thread
+		ses, err := receive.ImportedMail(messageID, message.Raw, message.Time)
+		if err != nil {
+			return err
+		}
+		err = receive.Email(ctx, ses, receive.Options{
+			Import: &receive.ImportOptions{},
+		})
+		if errors.Is(err, receive.ErrBlocked) {
+			return importer.ErrSkipped
+		}
+		return err
+	})
+	return progress, err
+}
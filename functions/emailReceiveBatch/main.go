@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"github.com/harryzcy/mailbox/internal/receive"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// notificationTypeReceived is the type of SES notifications of received emails
+const notificationTypeReceived = "Received"
+
+var errNotReceived = errors.New("not a notification of a received email")
+
+// snsEnvelope is an SNS notification delivered to SQS without raw message delivery
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// notification is an SES notification published by the SNS topic of the S3 action of a receipt rule
+type notification struct {
+	NotificationType string `json:"notificationType"`
+	events.SimpleEmailService
+}
+
+// parseNotification parses the body of an SQS message, which is an SES notification, possibly in an SNS envelope
+func parseNotification(body string) (events.SimpleEmailService, error) {
+	var envelope snsEnvelope
+	if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+		return events.SimpleEmailService{}, err
+	}
+	if envelope.Type == "Notification" {
+		body = envelope.Message
+	}
+
+	var n notification
+	if err := json.Unmarshal([]byte(body), &n); err != nil {
+		return events.SimpleEmailService{}, err
+	}
+	if n.NotificationType != notificationTypeReceived || n.Mail.MessageID == "" {
+		return events.SimpleEmailService{}, errNotReceived
+	}
+	return n.SimpleEmailService, nil
+}
+
+// handler receives the emails in a batch of SES notifications from SQS,
+// and reports the messages of emails that failed to be received, so that only they are retried
+func handler(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	failures := make([]events.SQSBatchItemFailure, 0)
+	for _, message := range sqsEvent.Records {
+		ses, err := parseNotification(message.Body)
+		if err != nil {
+			// e.g. the test notification when the topic is set
+			fmt.Printf("skipped message %s, %v\n", message.MessageId, err)
+			continue // retrying won't help
+		}
+
+		fmt.Printf("[%s] Mail = %+v, Receipt = %+v \n", message.MessageId, ses.Mail, ses.Receipt)
+		err = receive.Email(ctx, ses, receive.Options{})
+		if errors.Is(err, receive.ErrBlocked) {
+			fmt.Println(err)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to receive email %s, %v\n", ses.Mail.MessageID, err)
+			failures = append(failures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+
+	return events.SQSEventResponse{
+		BatchItemFailures: failures,
+	}, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testNotification = `{"notificationType":"Received","mail":{"messageId":"message-id","source":"sender@example.com","destination":["user@example.com"]},"receipt":{"action":{"type":"S3","topicArn":"arn:aws:sns:us-east-1:123456789012:mailbox","bucketName":"bucket","objectKey":"prefix/message-id"},"spamVerdict":{"status":"PASS"}}}`
+
+func TestParseNotification(t *testing.T) {
+	envelope, err := json.Marshal(snsEnvelope{Type: "Notification", Message: testNotification})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		body        string
+		expectedErr bool
+	}{
+		{body: testNotification}, // raw message delivery
+		{body: string(envelope)}, // SNS envelope
+		{body: "not json", expectedErr: true},
+		{body: `{"notificationType":"AmazonSnsSubscriptionSucceeded","message":"test"}`, expectedErr: true},
+		{body: `{"notificationType":"Received","mail":{}}`, expectedErr: true},
+	}
+
+	for _, test := range tests {
+		ses, err := parseNotification(test.body)
+		if test.expectedErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, "message-id", ses.Mail.MessageID)
+		assert.Equal(t, []string{"user@example.com"}, ses.Mail.Destination)
+		assert.Equal(t, "bucket", ses.Receipt.Action.BucketName)
+		assert.Equal(t, "prefix/message-id", ses.Receipt.Action.ObjectKey)
+		assert.Equal(t, "PASS", ses.Receipt.SpamVerdict.Status)
+	}
+}
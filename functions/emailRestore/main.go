@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"path"
 	"regexp"
 	"strings"
 	"time"
@@ -16,7 +17,6 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -24,8 +24,16 @@ import (
 	"github.com/jhillyerd/enmime"
 
 	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
 	"github.com/harryzcy/mailbox/internal/util/format"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
 )
 
 func main() {
@@ -38,20 +46,21 @@ type client struct {
 }
 
 func handler(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+	cfg, err := awsutil.LoadConfig(ctx)
 	if err != nil {
 		log.Fatalf("unable to load SDK config, %v", err)
 	}
 
 	cli := &client{
-		s3Client:       s3.NewFromConfig(cfg),
-		dynamoDBClient: dynamodb.NewFromConfig(cfg),
+		s3Client:       s3Client.Get(cfg),
+		dynamoDBClient: dynamodbClient.Get(cfg),
 	}
 
 	failures := make([]events.SQSBatchItemFailure, 0)
 	for _, message := range sqsEvent.Records {
 		fmt.Printf("The message %s for event source %s = %s \n", message.MessageId, message.EventSource, message.Body)
-		err := restoreEmail(ctx, cli, message.Body)
+		messageID, location := parseRestoreTarget(message.Body)
+		err := restoreEmail(ctx, cli, messageID, location)
 		if err != nil {
 			failures = append(failures, events.SQSBatchItemFailure{
 				ItemIdentifier: message.MessageId,
@@ -64,7 +73,20 @@ func handler(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResp
 	}, nil
 }
 
-func restoreEmail(ctx context.Context, cli *client, messageID string) error {
+// parseRestoreTarget returns the email to restore from the body of a message, which is either the message ID
+// of an email at the default location, or the S3 URI of a raw email stored elsewhere, e.g. s3://bucket/prefix/messageID
+func parseRestoreTarget(body string) (string, storage.Location) {
+	body = strings.TrimSpace(body)
+	uri, ok := strings.CutPrefix(body, "s3://")
+	if !ok {
+		return body, storage.DefaultLocation(body)
+	}
+	bucket, key, _ := strings.Cut(uri, "/")
+	messageID := path.Base(key)
+	return messageID, storage.ResolveLocation(messageID, bucket, key)
+}
+
+func restoreEmail(ctx context.Context, cli *client, messageID string, location storage.Location) error {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
@@ -85,8 +107,8 @@ func restoreEmail(ctx context.Context, cli *client, messageID string) error {
 	}
 
 	object, err := cli.s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: &env.S3Bucket,
-		Key:    &messageID,
+		Bucket: &location.Bucket,
+		Key:    &location.Key,
 	})
 	fmt.Println("got object from s3, err:", err)
 	if err != nil {
@@ -112,8 +134,9 @@ func restoreEmail(ctx context.Context, cli *client, messageID string) error {
 	}
 	item["TypeYearMonth"] = &dynamodbTypes.AttributeValueMemberS{Value: typeYearMonth}
 
-	item["DateTime"] = &dynamodbTypes.AttributeValueMemberS{Value: format.DateTime(*object.LastModified)}
+	item["DateTime"] = &dynamodbTypes.AttributeValueMemberS{Value: format.DateTime(*object.LastModified, messageID)}
 	item["MessageID"] = &dynamodbTypes.AttributeValueMemberS{Value: messageID}
+	storage.SetItemLocation(item, messageID, location)
 	item["Subject"] = &dynamodbTypes.AttributeValueMemberS{Value: envelope.GetHeader("Subject")}
 	item["Source"] = &dynamodbTypes.AttributeValueMemberS{Value: cleanAddress(envelope.GetHeader("Return-Path"), true)}
 
@@ -154,7 +177,7 @@ func restoreEmail(ctx context.Context, cli *client, messageID string) error {
 	}
 
 	fmt.Printf("DynamoDB returned metadata: %s", resp.ResultMetadata)
-	return nil
+	return email.RecordMonth(ctx, cli.dynamoDBClient, typeYearMonth)
 }
 
 var (
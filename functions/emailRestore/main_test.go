@@ -3,6 +3,8 @@ package main
 import (
 	"strconv"
 	"testing"
+
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
 )
 
 func TestCleanAddress(t *testing.T) {
@@ -72,3 +74,31 @@ func TestCleanAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRestoreTarget(t *testing.T) {
+	tests := []struct {
+		body         string
+		wantID       string
+		wantLocation storage.Location
+	}{
+		{
+			body:         "exampleMessageID\n",
+			wantID:       "exampleMessageID",
+			wantLocation: storage.DefaultLocation("exampleMessageID"),
+		},
+		{
+			body:         "s3://other-bucket/large/exampleMessageID",
+			wantID:       "exampleMessageID",
+			wantLocation: storage.Location{Bucket: "other-bucket", Key: "large/exampleMessageID"},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			messageID, location := parseRestoreTarget(test.body)
+			if messageID != test.wantID || location != test.wantLocation {
+				t.Errorf("got %q %v, want %q %v", messageID, location, test.wantID, test.wantLocation)
+			}
+		})
+	}
+}
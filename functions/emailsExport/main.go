@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/export"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler exports the emails of the days in input to EXPORT_BUCKET as JSON Lines,
+// it's meant to be invoked daily for the previous day, or manually to export a range of days
+func handler(ctx context.Context, input export.Input) (*export.Result, error) {
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return nil, err
+	}
+	cli, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return nil, err
+	}
+
+	result, err := export.Run(ctx, cli, input)
+	if err != nil {
+		fmt.Printf("failed to export emails, %v\n", err)
+		return nil, err
+	}
+	fmt.Printf("exported %d emails of %d days\n", result.Emails, result.Days)
+	return result, nil
+}
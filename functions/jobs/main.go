@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	_ "github.com/harryzcy/mailbox/internal/bulk" // registers the kinds of bulk jobs
+	"github.com/harryzcy/mailbox/internal/clients"
+	_ "github.com/harryzcy/mailbox/internal/export" // registers the kind of archives
+	"github.com/harryzcy/mailbox/internal/jobs"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+	sqsClient      = awsutil.NewClient(sqs.NewFromConfig)
+)
+
+// runClient has the clients used to run jobs, and to queue them again
+type runClient struct {
+	*clients.Clients
+	clients.Queue
+}
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler runs the jobs queued in JOBS_QUEUE, e.g. by POST /exports and POST /emails/bulk-delete,
+// which queue themselves again if they don't finish before the timeout
+func handler(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return events.SQSEventResponse{}, err
+	}
+	store, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return events.SQSEventResponse{}, err
+	}
+	cli := runClient{Clients: store, Queue: sqsClient.Get(cfg)}
+
+	failures := make([]events.SQSBatchItemFailure, 0)
+	for _, message := range sqsEvent.Records {
+		jobID, err := jobs.ParseMessage(message.Body)
+		if err != nil {
+			fmt.Printf("invalid job message %s: %s\n", message.MessageId, message.Body)
+			continue // retrying won't help
+		}
+
+		if err := jobs.Run(ctx, cli, jobID); err != nil {
+			fmt.Printf("failed to run job %s, %v\n", jobID, err)
+			failures = append(failures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+
+	return events.SQSEventResponse{
+		BatchItemFailures: failures,
+	}, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	_ "github.com/harryzcy/mailbox/internal/bulk" // registers the kinds of bulk jobs
+	"github.com/harryzcy/mailbox/internal/clients"
+	_ "github.com/harryzcy/mailbox/internal/export" // registers the kind of archives
+	"github.com/harryzcy/mailbox/internal/jobs"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler runs a state of the jobs state machine, which runs the jobs queued in JOBS_WORKFLOW_QUEUE
+// in parallel parts, see jobs.RunWorkflow. Errors are retried by the state machine.
+func handler(ctx context.Context, input jobs.WorkflowInput) (*jobs.WorkflowOutput, error) {
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return nil, err
+	}
+	cli, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return nil, err
+	}
+
+	output, err := jobs.RunWorkflow(ctx, cli, input)
+	if err != nil {
+		fmt.Printf("failed to %s job %s, %v\n", input.Action, input.JobID, err)
+		return nil, err
+	}
+	return output, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/importer"
+	"github.com/harryzcy/mailbox/internal/receive"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler starts an import, or resumes it from the saved progress if it's already started.
+// It's invoked repeatedly, e.g. by a schedule, until the import is completed.
+func handler(ctx context.Context, input importer.StartInput) (*importer.Progress, error) {
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config: %w", err)
+	}
+	dynamodbSvc := dynamodbClient.Get(cfg)
+	s3Svc := s3Client.Get(cfg)
+
+	progress, err := importer.GetProgress(ctx, dynamodbSvc, input.ImportID)
+	if errors.Is(err, api.ErrNotFound) {
+		fmt.Printf("starting import %s from %s\n", input.ImportID, input.Provider)
+		progress, err = importer.NewProgress(input)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if input.Retry {
+		progress.Retry()
+	}
+
+	connector, err := importer.NewConnector(ctx, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	err = importer.Run(ctx, dynamodbSvc, progress, connector, func(ctx context.Context, messageID string, message *importer.Message) error {
+		err := storage.S3.PutEmailRaw(ctx, s3Svc, messageID, message.Raw)
+		if err != nil {
+			return err
+		}
+		ses, err := receive.ImportedMail(messageID, message.Raw, message.Time)
+		if err != nil {
+			return err
+		}
+		err = receive.Email(ctx, ses, receive.Options{
+			Import: &receive.ImportOptions{
+				Unread:  message.Unread,
+				Flagged: message.Flagged,
+				Labels:  message.Labels,
+			},
+		})
+		if errors.Is(err, receive.ErrBlocked) {
+			return importer.ErrSkipped
+		}
+		return err
+	})
+	return progress, err
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"github.com/harryzcy/mailbox/internal/analytics"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/push"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler sends the notifications deferred by quiet hours once they are over, it's meant to be invoked on a schedule
+func handler(ctx context.Context) (int, error) {
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return 0, err
+	}
+
+	client := dynamodbClient.Get(cfg)
+	count, err := hook.Flush(ctx, client, push.NewNotifier(client), push.NewWebNotifier(client), analytics.NewNotifier(client, cfg))
+	if err != nil {
+		fmt.Printf("failed to flush deferred notifications, %v\n", err)
+		return 0, err
+	}
+	fmt.Printf("sent %d deferred notifications\n", count)
+	return count, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+
+	"github.com/harryzcy/mailbox/internal/digest"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/report"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	sesv2Client    = awsutil.NewClient(sesv2.NewFromConfig)
+)
+
+// Input is the event of the function
+type Input struct {
+	Month string `json:"month"` // YYYY-MM, the previous month if empty
+}
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler generates the report of a month and emails it if REPORT_EMAIL is set,
+// it's meant to be invoked monthly for the previous month, or manually to report a month again
+func handler(ctx context.Context, input Input) (*report.Report, error) {
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return nil, err
+	}
+	result, err := report.Generate(ctx, dynamodbClient.Get(cfg), input.Month)
+	if err != nil {
+		fmt.Printf("failed to generate report, %v\n", err)
+		return nil, err
+	}
+	fmt.Printf("report of %s: %d received, %d sent\n", result.Month, result.Received, result.Sent)
+
+	if env.ReportEmail != "true" {
+		return result, nil
+	}
+	settings := digest.SettingsFromEnv()
+	if !settings.Enabled() {
+		fmt.Println("report is not emailed, DIGEST_TO is not set")
+		return result, nil
+	}
+	subject, text, htmlBody := report.Compose(result)
+	if err := digest.Send(ctx, sesv2Client.Get(cfg), settings, subject, text, htmlBody); err != nil {
+		fmt.Printf("failed to email report, %v\n", err)
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"github.com/harryzcy/mailbox/internal/analytics"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/outbound"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	sesv2Client    = awsutil.NewClient(sesv2.NewFromConfig)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+	sqsClient      = awsutil.NewClient(sqs.NewFromConfig)
+)
+
+// sendClient has the clients used to send emails, and to queue them to be retried
+type sendClient struct {
+	*clients.Clients
+	clients.Mailer
+	clients.Queue
+}
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler retries the sends queued in SEND_RETRY_QUEUE after transient failures
+func handler(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return events.SQSEventResponse{}, err
+	}
+	store, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return events.SQSEventResponse{}, err
+	}
+	cli := sendClient{Clients: store, Mailer: sesv2Client.Get(cfg), Queue: sqsClient.Get(cfg)}
+
+	failures := make([]events.SQSBatchItemFailure, 0)
+	for _, message := range sqsEvent.Records {
+		var retry outbound.RetryMessage
+		err := json.Unmarshal([]byte(message.Body), &retry)
+		if err != nil || retry.MessageID == "" {
+			fmt.Printf("invalid retry message %s: %s\n", message.MessageId, message.Body)
+			continue // retrying won't help
+		}
+
+		result, err := outbound.RetrySend(ctx, cli, retry.MessageID)
+		if err != nil {
+			fmt.Printf("failed to retry %s, %v\n", retry.MessageID, err)
+			failures = append(failures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+			continue
+		}
+		if result != nil && !result.Retrying {
+			fmt.Printf("retry of %s sent\n", retry.MessageID)
+			if err := analytics.RecordSent(ctx, cli, cfg, result.MessageID); err != nil {
+				fmt.Printf("failed to put analytics record, %v\n", err)
+			}
+		}
+	}
+
+	return events.SQSEventResponse{
+		BatchItemFailures: failures,
+	}, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/history"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler cleans up the emails deleted by DynamoDB when their trash expiry passed,
+// it's meant to be invoked by the table stream with old images
+func handler(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return events.DynamoDBEventResponse{}, err
+	}
+	cli, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return events.DynamoDBEventResponse{}, err
+	}
+
+	for _, record := range event.Records {
+		if !expired(record) {
+			continue
+		}
+
+		item := fromImage(record.Change.OldImage)
+		messageID := record.Change.Keys["MessageID"].String()
+		if err := email.Expire(ctx, cli, item); err != nil {
+			fmt.Printf("failed to expire %s, %v\n", messageID, err)
+			// records of a shard are processed in order, so the rest are retried from this one
+			return events.DynamoDBEventResponse{
+				BatchItemFailures: []events.DynamoDBBatchItemFailure{
+					{ItemIdentifier: record.Change.SequenceNumber},
+				},
+			}, nil
+		}
+
+		if err := history.Record(ctx, cli, messageID, history.NewEvent(history.EventPurged, "expired")); err != nil {
+			fmt.Printf("failed to record history: %v\n", err)
+		}
+		fmt.Printf("expired %s\n", messageID)
+	}
+
+	return events.DynamoDBEventResponse{}, nil
+}
+
+// expired returns whether a stream record is the deletion of an item by Time to Live
+func expired(record events.DynamoDBEventRecord) bool {
+	return record.EventName == string(events.DynamoDBOperationTypeRemove) &&
+		record.UserIdentity != nil &&
+		record.UserIdentity.Type == "Service" &&
+		record.UserIdentity.PrincipalID == "dynamodb.amazonaws.com"
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpired(t *testing.T) {
+	ttl := &events.DynamoDBUserIdentity{Type: "Service", PrincipalID: "dynamodb.amazonaws.com"}
+	assert.True(t, expired(events.DynamoDBEventRecord{EventName: "REMOVE", UserIdentity: ttl}))
+	assert.False(t, expired(events.DynamoDBEventRecord{EventName: "REMOVE"}))
+	assert.False(t, expired(events.DynamoDBEventRecord{EventName: "MODIFY", UserIdentity: ttl}))
+}
+
+func TestFromImage(t *testing.T) {
+	image := map[string]events.DynamoDBAttributeValue{
+		"MessageID":   events.NewStringAttribute("exampleMessageID"),
+		"ExpiresAt":   events.NewNumberAttribute("1700000000"),
+		"Unread":      events.NewBooleanAttribute(true),
+		"Blobs":       events.NewStringSetAttribute([]string{"hash"}),
+		"Attachments": events.NewListAttribute([]events.DynamoDBAttributeValue{events.NewMapAttribute(map[string]events.DynamoDBAttributeValue{"ContentID": events.NewNullAttribute()})}),
+	}
+	assert.Equal(t, map[string]types.AttributeValue{
+		"MessageID": &types.AttributeValueMemberS{Value: "exampleMessageID"},
+		"ExpiresAt": &types.AttributeValueMemberN{Value: "1700000000"},
+		"Unread":    &types.AttributeValueMemberBOOL{Value: true},
+		"Blobs":     &types.AttributeValueMemberSS{Value: []string{"hash"}},
+		"Attachments": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{"ContentID": &types.AttributeValueMemberNULL{Value: true}}},
+		}},
+	}, fromImage(image))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/history"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// handler purges the emails trashed longer than TRASH_RETENTION_DAYS ago, it's meant to be invoked on a schedule
+func handler(ctx context.Context) (*email.EmptyTrashResult, error) {
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		fmt.Printf("unable to load SDK config, %v\n", err)
+		return nil, err
+	}
+	cli, err := clients.New(dynamodbClient.Get(cfg), s3Client.Get(cfg))
+	if err != nil {
+		fmt.Printf("unable to create clients, %v\n", err)
+		return nil, err
+	}
+
+	// emails left by the timeout or a failure are purged by the next run
+	result, err := email.PurgeTrash(ctx, cli, time.Now())
+	if result != nil {
+		for _, messageID := range result.Deleted {
+			if err := history.Record(ctx, cli, messageID, history.NewEvent(history.EventPurged, "expired")); err != nil {
+				fmt.Printf("failed to record history: %v\n", err)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Printf("failed to purge trash, %v\n", err)
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,144 @@
+// Package admin lets operators inspect and repair the raw DynamoDB items of emails
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// MaxPatchAttributes is the maximum number of attributes set or removed by a patch
+const MaxPatchAttributes = 50
+
+// Authorize returns api.ErrForbidden unless the caller is one of ADMIN_CALLERS
+func Authorize(caller string) error {
+	if caller == "" {
+		return api.ErrForbidden
+	}
+	for _, admin := range strings.Split(env.AdminCallers, ",") {
+		if strings.TrimSpace(admin) == caller {
+			return nil
+		}
+	}
+	return api.ErrForbidden
+}
+
+// GetItem returns the raw item of an email, thread or any other item by its MessageID
+func GetItem(ctx context.Context, client api.GetItemAPI, messageID string) (Item, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, api.ErrNotFound
+	}
+	return resp.Item, nil
+}
+
+// PatchInput sets and removes attributes of an item
+type PatchInput struct {
+	MessageID string                     `json:"-"`
+	Set       map[string]json.RawMessage `json:"set"`    // attribute name -> value in the DynamoDB JSON format
+	Remove    []string                   `json:"remove"` // attribute names
+}
+
+// PatchItem sets and removes attributes of an existing item, and returns the patched item.
+// Derived attributes and indexes aren't updated, see Repair.
+func PatchItem(ctx context.Context, client api.UpdateItemAPI, input PatchInput) (Item, error) {
+	if len(input.Set)+len(input.Remove) == 0 || len(input.Set)+len(input.Remove) > MaxPatchAttributes {
+		return nil, api.ErrInvalidInput
+	}
+
+	names := make(map[string]string)
+	values := make(map[string]types.AttributeValue)
+	var sets, removes []string
+	seen := make(map[string]bool)
+	addName := func(name string) (string, error) {
+		if name == "" || name == "MessageID" || seen[name] {
+			return "", fmt.Errorf("%w: attribute %q can't be patched", api.ErrInvalidInput, name)
+		}
+		seen[name] = true
+		placeholder := "#a" + strconv.Itoa(len(names))
+		names[placeholder] = name
+		return placeholder, nil
+	}
+
+	setNames := make([]string, 0, len(input.Set))
+	for name := range input.Set {
+		setNames = append(setNames, name)
+	}
+	sort.Strings(setNames) // stable expressions
+	for _, name := range setNames {
+		placeholder, err := addName(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeValue(input.Set[name])
+		if err != nil {
+			return nil, err
+		}
+		valuePlaceholder := ":v" + strconv.Itoa(len(values))
+		values[valuePlaceholder] = value
+		sets = append(sets, placeholder+" = "+valuePlaceholder)
+	}
+	for _, name := range input.Remove {
+		placeholder, err := addName(name)
+		if err != nil {
+			return nil, err
+		}
+		removes = append(removes, placeholder)
+	}
+
+	var expression []string
+	if len(sets) > 0 {
+		expression = append(expression, "SET "+strings.Join(sets, ", "))
+	}
+	if len(removes) > 0 {
+		expression = append(expression, "REMOVE "+strings.Join(removes, ", "))
+	}
+	updateInput := &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: input.MessageID},
+		},
+		UpdateExpression:         aws.String(strings.Join(expression, " ")),
+		ConditionExpression:      aws.String("attribute_exists(MessageID)"),
+		ExpressionAttributeNames: names,
+		ReturnValues:             types.ReturnValueAllNew,
+	}
+	if len(values) > 0 {
+		updateInput.ExpressionAttributeValues = values
+	}
+
+	resp, err := client.UpdateItem(ctx, updateInput)
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return nil, api.ErrNotFound
+		}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	fmt.Printf("item %s patched, set %d and removed %d attributes\n", input.MessageID, len(sets), len(removes))
+	return resp.Attributes, nil
+}
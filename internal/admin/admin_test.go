@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockAdminAPI stores items by MessageID and records the updates
+type mockAdminAPI struct {
+	items   map[string]map[string]types.AttributeValue
+	updates []*dynamodb.UpdateItemInput
+}
+
+func (m *mockAdminAPI) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	id := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: m.items[id]}, nil
+}
+
+func (m *mockAdminAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.updates = append(m.updates, params)
+	id := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+	if _, ok := m.items[id]; !ok {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	return &dynamodb.UpdateItemOutput{Attributes: m.items[id]}, nil
+}
+
+func (m *mockAdminAPI) GetObject(_ context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return nil, errors.New("no raw email")
+}
+
+func TestAuthorize(t *testing.T) {
+	defer func() { env.AdminCallers = "" }()
+
+	env.AdminCallers = ""
+	assert.Equal(t, api.ErrForbidden, Authorize("arn:aws:iam::123456789012:user/ops"))
+
+	env.AdminCallers = "arn:aws:iam::123456789012:user/ops, arn:aws:iam::123456789012:user/oncall"
+	assert.Nil(t, Authorize("arn:aws:iam::123456789012:user/ops"))
+	assert.Nil(t, Authorize("arn:aws:iam::123456789012:user/oncall"))
+	assert.Equal(t, api.ErrForbidden, Authorize("arn:aws:iam::123456789012:user/app"))
+	assert.Equal(t, api.ErrForbidden, Authorize(""))
+}
+
+func TestGetItem(t *testing.T) {
+	client := &mockAdminAPI{items: map[string]map[string]types.AttributeValue{
+		"1": {
+			"MessageID": &types.AttributeValueMemberS{Value: "1"},
+			"Labels":    &types.AttributeValueMemberSS{Value: []string{"work"}},
+			"Stats": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+				"rawSize": &types.AttributeValueMemberN{Value: "42"},
+			}},
+		},
+	}}
+
+	item, err := GetItem(context.TODO(), client, "1")
+	assert.Nil(t, err)
+	data, err := json.Marshal(item)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"MessageID":{"S":"1"},"Labels":{"SS":["work"]},"Stats":{"M":{"rawSize":{"N":"42"}}}}`, string(data))
+
+	_, err = GetItem(context.TODO(), client, "2")
+	assert.Equal(t, api.ErrNotFound, err)
+}
+
+func TestPatchItem(t *testing.T) {
+	client := &mockAdminAPI{items: map[string]map[string]types.AttributeValue{
+		"1": {"MessageID": &types.AttributeValueMemberS{Value: "1"}},
+	}}
+
+	_, err := PatchItem(context.TODO(), client, PatchInput{
+		MessageID: "1",
+		Set: map[string]json.RawMessage{
+			"Unread":  json.RawMessage(`{"BOOL":false}`),
+			"Subject": json.RawMessage(`{"S":"Hello"}`),
+		},
+		Remove: []string{"ThreadID"},
+	})
+	assert.Nil(t, err)
+	update := client.updates[0]
+	assert.Equal(t, "SET #a0 = :v0, #a1 = :v1 REMOVE #a2", *update.UpdateExpression)
+	assert.Equal(t, map[string]string{"#a0": "Subject", "#a1": "Unread", "#a2": "ThreadID"}, update.ExpressionAttributeNames)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "Hello"}, update.ExpressionAttributeValues[":v0"])
+	assert.Equal(t, &types.AttributeValueMemberBOOL{Value: false}, update.ExpressionAttributeValues[":v1"])
+
+	_, err = PatchItem(context.TODO(), client, PatchInput{MessageID: "2", Remove: []string{"ThreadID"}})
+	assert.Equal(t, api.ErrNotFound, err)
+
+	for _, input := range []PatchInput{
+		{MessageID: "1"},
+		{MessageID: "1", Remove: []string{"MessageID"}},
+		{MessageID: "1", Remove: []string{"ThreadID", "ThreadID"}},
+		{MessageID: "1", Set: map[string]json.RawMessage{"Unread": json.RawMessage(`{"BOOL":"no"}`)}},
+		{MessageID: "1", Set: map[string]json.RawMessage{"Unread": json.RawMessage(`{"X":true}`)}},
+		{MessageID: "1", Set: map[string]json.RawMessage{"Unread": json.RawMessage(`true`)}},
+	} {
+		_, err = PatchItem(context.TODO(), client, input)
+		assert.True(t, errors.Is(err, api.ErrInvalidInput), input)
+	}
+	assert.Len(t, client.updates, 2)
+}
@@ -0,0 +1,27 @@
+package admin
+
+import (
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverrideScan(t *testing.T) {
+	env.AdminCallers = "arn:aws:iam::123456789012:user/ops"
+	defer func() { env.AdminCallers = "" }()
+
+	override := ScanOverride{
+		Action:    ActionRawScanOverride,
+		Caller:    "arn:aws:iam::123456789012:user/ops",
+		MessageID: "exampleMessageID",
+		ScanState: "infected",
+	}
+	assert.Nil(t, OverrideScan(override))
+
+	override.Caller = "arn:aws:iam::123456789012:user/app"
+	assert.Equal(t, api.ErrForbidden, OverrideScan(override))
+	override.Caller = ""
+	assert.Equal(t, api.ErrForbidden, OverrideScan(override))
+}
@@ -0,0 +1,153 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+)
+
+// Item is a raw DynamoDB item, which is encoded in the DynamoDB JSON format, e.g. {"Subject": {"S": "Hello"}}
+type Item map[string]types.AttributeValue
+
+func (item Item) MarshalJSON() ([]byte, error) {
+	values := make(map[string]interface{}, len(item))
+	for name, value := range item {
+		values[name] = encodeValue(value)
+	}
+	return json.Marshal(values)
+}
+
+func (item *Item) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%w: item must be an object", api.ErrInvalidInput)
+	}
+	decoded := make(Item, len(raw))
+	for name, value := range raw {
+		v, err := decodeValue(value)
+		if err != nil {
+			return err
+		}
+		decoded[name] = v
+	}
+	*item = decoded
+	return nil
+}
+
+// encodeValue returns an attribute value as a value of the DynamoDB JSON format
+func encodeValue(value types.AttributeValue) interface{} {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]interface{}{"S": v.Value}
+	case *types.AttributeValueMemberN:
+		return map[string]interface{}{"N": v.Value}
+	case *types.AttributeValueMemberB:
+		return map[string]interface{}{"B": v.Value} // base64 encoded
+	case *types.AttributeValueMemberBOOL:
+		return map[string]interface{}{"BOOL": v.Value}
+	case *types.AttributeValueMemberNULL:
+		return map[string]interface{}{"NULL": v.Value}
+	case *types.AttributeValueMemberSS:
+		return map[string]interface{}{"SS": v.Value}
+	case *types.AttributeValueMemberNS:
+		return map[string]interface{}{"NS": v.Value}
+	case *types.AttributeValueMemberBS:
+		return map[string]interface{}{"BS": v.Value}
+	case *types.AttributeValueMemberL:
+		values := make([]interface{}, len(v.Value))
+		for i, item := range v.Value {
+			values[i] = encodeValue(item)
+		}
+		return map[string]interface{}{"L": values}
+	case *types.AttributeValueMemberM:
+		values := make(map[string]interface{}, len(v.Value))
+		for name, item := range v.Value {
+			values[name] = encodeValue(item)
+		}
+		return map[string]interface{}{"M": values}
+	}
+	return nil
+}
+
+// decodeValue parses an attribute value in the DynamoDB JSON format
+//
+//gocyclo:ignore
+func decodeValue(data json.RawMessage) (types.AttributeValue, error) {
+	var typed map[string]json.RawMessage
+	if err := json.Unmarshal(data, &typed); err != nil || len(typed) != 1 {
+		return nil, fmt.Errorf("%w: attribute value must have exactly one type", api.ErrInvalidInput)
+	}
+
+	for name, raw := range typed {
+		var err error
+		switch name {
+		case "S":
+			v := &types.AttributeValueMemberS{}
+			err = json.Unmarshal(raw, &v.Value)
+			return v, wrapDecodeError(name, err)
+		case "N":
+			v := &types.AttributeValueMemberN{}
+			err = json.Unmarshal(raw, &v.Value)
+			return v, wrapDecodeError(name, err)
+		case "B":
+			v := &types.AttributeValueMemberB{}
+			err = json.Unmarshal(raw, &v.Value)
+			return v, wrapDecodeError(name, err)
+		case "BOOL":
+			v := &types.AttributeValueMemberBOOL{}
+			err = json.Unmarshal(raw, &v.Value)
+			return v, wrapDecodeError(name, err)
+		case "NULL":
+			v := &types.AttributeValueMemberNULL{}
+			err = json.Unmarshal(raw, &v.Value)
+			return v, wrapDecodeError(name, err)
+		case "SS":
+			v := &types.AttributeValueMemberSS{}
+			err = json.Unmarshal(raw, &v.Value)
+			return v, wrapDecodeError(name, err)
+		case "NS":
+			v := &types.AttributeValueMemberNS{}
+			err = json.Unmarshal(raw, &v.Value)
+			return v, wrapDecodeError(name, err)
+		case "BS":
+			v := &types.AttributeValueMemberBS{}
+			err = json.Unmarshal(raw, &v.Value)
+			return v, wrapDecodeError(name, err)
+		case "L":
+			var items []json.RawMessage
+			if err = json.Unmarshal(raw, &items); err != nil {
+				return nil, wrapDecodeError(name, err)
+			}
+			v := &types.AttributeValueMemberL{Value: make([]types.AttributeValue, len(items))}
+			for i, item := range items {
+				if v.Value[i], err = decodeValue(item); err != nil {
+					return nil, err
+				}
+			}
+			return v, nil
+		case "M":
+			var items map[string]json.RawMessage
+			if err = json.Unmarshal(raw, &items); err != nil {
+				return nil, wrapDecodeError(name, err)
+			}
+			v := &types.AttributeValueMemberM{Value: make(map[string]types.AttributeValue, len(items))}
+			for key, item := range items {
+				if v.Value[key], err = decodeValue(item); err != nil {
+					return nil, err
+				}
+			}
+			return v, nil
+		}
+		return nil, fmt.Errorf("%w: unknown attribute type %s", api.ErrInvalidInput, name)
+	}
+	return nil, api.ErrInvalidInput // unreachable
+}
+
+func wrapDecodeError(name string, err error) error {
+	if err != nil {
+		return fmt.Errorf("%w: invalid %s value", api.ErrInvalidInput, name)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItem_RoundTrip(t *testing.T) {
+	values := []types.AttributeValue{
+		&types.AttributeValueMemberS{Value: "a, \"quoted\" string"},
+		&types.AttributeValueMemberN{Value: "1.5"},
+		&types.AttributeValueMemberB{Value: []byte{0, 1, 2}},
+		&types.AttributeValueMemberBOOL{Value: true},
+		&types.AttributeValueMemberNULL{Value: true},
+		&types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		&types.AttributeValueMemberNS{Value: []string{"1", "2"}},
+		&types.AttributeValueMemberBS{Value: [][]byte{{1}, {2}}},
+		&types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberS{Value: "a"},
+			&types.AttributeValueMemberN{Value: "1"},
+		}},
+		&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"nested": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+				"key": &types.AttributeValueMemberS{Value: "value"},
+			}},
+		}},
+	}
+
+	for _, value := range values {
+		data, err := json.Marshal(Item{"Attribute": value})
+		assert.Nil(t, err)
+
+		var raw map[string]json.RawMessage
+		assert.Nil(t, json.Unmarshal(data, &raw))
+		decoded, err := decodeValue(raw["Attribute"])
+		assert.Nil(t, err)
+		assert.Equal(t, value, decoded)
+	}
+}
+
+func TestDecodeValue_Invalid(t *testing.T) {
+	for _, data := range []string{
+		`"value"`,
+		`{}`,
+		`{"S":"a","N":"1"}`,
+		`{"S":1}`,
+		`{"L":[{"S":1}]}`,
+		`{"M":{"key":{"Y":"a"}}}`,
+	} {
+		_, err := decodeValue(json.RawMessage(data))
+		assert.True(t, errors.Is(err, api.ErrInvalidInput), data)
+	}
+}
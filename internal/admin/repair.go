@@ -0,0 +1,120 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/thread"
+)
+
+// RepairResult describes what's recomputed by Repair
+type RepairResult struct {
+	// Whether the text, HTML, parts and sizes are parsed again from the raw email, which is only done for inbox emails
+	Reparsed bool `json:"reparsed"`
+	// Changes of the thread links, e.g. "removed ThreadID", empty if they are consistent
+	ThreadLinks []string `json:"threadLinks"`
+}
+
+// Repair recomputes the derived attributes of an email: the parsed contents and sizes of inbox emails,
+// and its links to its thread, which are made consistent with the EmailIDs of the thread.
+// An email that isn't part of the thread it links to is unlinked, and IsThreadLatest is set only on the latest email.
+func Repair(ctx context.Context, client api.RepairItemAPI, messageID string) (*RepairResult, error) {
+	item, err := GetItem(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+	emailType, _, err := email.UnmarshalGSI(item)
+	if err != nil {
+		return nil, err
+	}
+	if emailType == email.EmailTypeThread {
+		return nil, api.ErrInvalidInput
+	}
+
+	result := &RepairResult{ThreadLinks: []string{}}
+	if emailType == email.EmailTypeInbox {
+		err = email.Reparse(ctx, client, messageID)
+		if err != nil {
+			return nil, err
+		}
+		result.Reparsed = true
+	}
+
+	var links struct {
+		ThreadID       string
+		IsThreadLatest bool
+	}
+	err = attributevalue.UnmarshalMap(item, &links)
+	if err != nil {
+		return nil, err
+	}
+
+	linked, latest := false, false
+	if links.ThreadID != "" {
+		t, err := thread.GetThread(ctx, client, links.ThreadID)
+		if err != nil && !errors.Is(err, api.ErrNotFound) {
+			return nil, err
+		}
+		if t != nil {
+			for i, id := range t.EmailIDs {
+				if id == messageID {
+					linked = true
+					latest = i == len(t.EmailIDs)-1
+				}
+			}
+		}
+	}
+
+	var updateExpression string
+	switch {
+	case links.ThreadID != "" && !linked:
+		updateExpression = "REMOVE ThreadID, IsThreadLatest"
+		result.ThreadLinks = append(result.ThreadLinks, "removed ThreadID")
+		if links.IsThreadLatest {
+			result.ThreadLinks = append(result.ThreadLinks, "removed IsThreadLatest")
+		}
+	case latest && !links.IsThreadLatest:
+		updateExpression = "SET IsThreadLatest = :true"
+		result.ThreadLinks = append(result.ThreadLinks, "set IsThreadLatest")
+	case !latest && links.IsThreadLatest:
+		updateExpression = "REMOVE IsThreadLatest"
+		result.ThreadLinks = append(result.ThreadLinks, "removed IsThreadLatest")
+	default:
+		return result, nil
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression:    aws.String(updateExpression),
+		ConditionExpression: aws.String("attribute_exists(MessageID)"),
+	}
+	if latest {
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":true": &types.AttributeValueMemberBOOL{Value: true},
+		}
+	}
+	_, err = client.UpdateItem(ctx, input)
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return nil, api.ErrNotFound
+		}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+
+	fmt.Printf("thread links of %s repaired: %v\n", messageID, result.ThreadLinks)
+	return result, nil
+}
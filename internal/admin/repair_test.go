@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepair(t *testing.T) {
+	sentEmail := func(id string, attributes map[string]types.AttributeValue) map[string]types.AttributeValue {
+		item := map[string]types.AttributeValue{
+			"MessageID":     &types.AttributeValueMemberS{Value: id},
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "sent#2024-05"},
+			"DateTime":      &types.AttributeValueMemberS{Value: "01-12:00:00"},
+		}
+		for name, value := range attributes {
+			item[name] = value
+		}
+		return item
+	}
+	thread := map[string]types.AttributeValue{
+		"MessageID":     &types.AttributeValueMemberS{Value: "thread"},
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: "thread#2024-05"},
+		"DateTime":      &types.AttributeValueMemberS{Value: "01-12:00:00"},
+		"EmailIDs": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberS{Value: "first"},
+			&types.AttributeValueMemberS{Value: "latest"},
+		}},
+	}
+	threadID := &types.AttributeValueMemberS{Value: "thread"}
+	isLatest := &types.AttributeValueMemberBOOL{Value: true}
+
+	tests := []struct {
+		item               map[string]types.AttributeValue
+		expectedLinks      []string
+		expectedExpression string // empty if not updated
+		expectedErr        error
+	}{
+		{
+			item:          sentEmail("first", map[string]types.AttributeValue{"ThreadID": threadID}),
+			expectedLinks: []string{},
+		},
+		{
+			item:               sentEmail("first", map[string]types.AttributeValue{"ThreadID": threadID, "IsThreadLatest": isLatest}),
+			expectedLinks:      []string{"removed IsThreadLatest"},
+			expectedExpression: "REMOVE IsThreadLatest",
+		},
+		{
+			item:               sentEmail("latest", map[string]types.AttributeValue{"ThreadID": threadID}),
+			expectedLinks:      []string{"set IsThreadLatest"},
+			expectedExpression: "SET IsThreadLatest = :true",
+		},
+		{
+			item:               sentEmail("other", map[string]types.AttributeValue{"ThreadID": threadID, "IsThreadLatest": isLatest}),
+			expectedLinks:      []string{"removed ThreadID", "removed IsThreadLatest"},
+			expectedExpression: "REMOVE ThreadID, IsThreadLatest",
+		},
+		{
+			item:               sentEmail("first", map[string]types.AttributeValue{"ThreadID": &types.AttributeValueMemberS{Value: "missing"}}),
+			expectedLinks:      []string{"removed ThreadID"},
+			expectedExpression: "REMOVE ThreadID, IsThreadLatest",
+		},
+		{
+			item:        thread,
+			expectedErr: api.ErrInvalidInput,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			id := test.item["MessageID"].(*types.AttributeValueMemberS).Value
+			client := &mockAdminAPI{items: map[string]map[string]types.AttributeValue{
+				"thread": thread,
+				id:       test.item,
+			}}
+
+			result, err := Repair(context.TODO(), client, id)
+			assert.Equal(t, test.expectedErr, err)
+			if test.expectedErr != nil {
+				return
+			}
+			assert.False(t, result.Reparsed)
+			assert.Equal(t, test.expectedLinks, result.ThreadLinks)
+			if test.expectedExpression == "" {
+				assert.Empty(t, client.updates)
+			} else {
+				assert.Len(t, client.updates, 1)
+				assert.Equal(t, test.expectedExpression, *client.updates[0].UpdateExpression)
+			}
+		})
+	}
+}
+
+func TestRepair_Inbox(t *testing.T) {
+	client := &mockAdminAPI{items: map[string]map[string]types.AttributeValue{
+		"1": {
+			"MessageID":     &types.AttributeValueMemberS{Value: "1"},
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+			"DateTime":      &types.AttributeValueMemberS{Value: "01-12:00:00"},
+		},
+	}}
+
+	// inbox emails are reparsed from the raw email, which fails without it
+	_, err := Repair(context.TODO(), client, "1")
+	assert.EqualError(t, err, "no raw email")
+
+	_, err = Repair(context.TODO(), client, "2")
+	assert.Equal(t, api.ErrNotFound, err)
+}
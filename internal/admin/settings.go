@@ -0,0 +1,103 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// SettingsVersion is the version of the format of settings bundles
+const SettingsVersion = 1
+
+// settingItems are the MessageIDs of the items storing the settings, by their names in settings bundles.
+// The items are defined by the packages managing the settings: sieve, rule, vacation, senders, label, hook and push.
+var settingItems = map[string]string{
+	"rules":                "sieve#script",
+	"filterRules":          "rule#definitions",
+	"vacation":             "vacation#settings",
+	"senders":              "sender#lists",
+	"labels":               "label#definitions",
+	"webhooks":             "hook#apps",
+	"devices":              "push#devices",
+	"webPushSubscriptions": "push#subscriptions",
+}
+
+// SettingsBundle has the configuration of a mailbox apart from its emails, e.g. to clone a deployment,
+// or to restore the settings separately from the emails. The items include the secrets of the webhooks and push subscriptions.
+type SettingsBundle struct {
+	Version      int             `json:"version"`
+	TimeExported string          `json:"timeExported,omitempty"`
+	Settings     map[string]Item `json:"settings"` // setting name -> item, settings that aren't set are omitted
+}
+
+// ExportSettings returns the items of all settings as a bundle
+func ExportSettings(ctx context.Context, client api.GetItemAPI) (*SettingsBundle, error) {
+	bundle := &SettingsBundle{
+		Version:      SettingsVersion,
+		TimeExported: time.Now().UTC().Format(time.RFC3339),
+		Settings:     make(map[string]Item),
+	}
+	for name, messageID := range settingItems {
+		item, err := GetItem(ctx, client, messageID)
+		if err != nil {
+			if err == api.ErrNotFound {
+				continue
+			}
+			return nil, err
+		}
+		bundle.Settings[name] = item
+	}
+	return bundle, nil
+}
+
+// ImportSettings replaces the settings in a bundle with its items at once, and returns their names.
+// Settings that aren't in the bundle are kept.
+func ImportSettings(ctx context.Context, client api.TransactWriteItemsAPI, bundle SettingsBundle) ([]string, error) {
+	if bundle.Version != SettingsVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", api.ErrInvalidInput, bundle.Version)
+	}
+	if len(bundle.Settings) == 0 {
+		return nil, fmt.Errorf("%w: no settings", api.ErrInvalidInput)
+	}
+
+	names := make([]string, 0, len(bundle.Settings))
+	for name := range bundle.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]types.TransactWriteItem, 0, len(names))
+	for _, name := range names {
+		messageID, ok := settingItems[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown setting %q", api.ErrInvalidInput, name)
+		}
+		item := make(map[string]types.AttributeValue, len(bundle.Settings[name])+1)
+		for attribute, value := range bundle.Settings[name] {
+			item[attribute] = value
+		}
+		// the key comes from the setting name, so that a bundle can't overwrite emails
+		item["MessageID"] = &types.AttributeValueMemberS{Value: messageID}
+		items = append(items, types.TransactWriteItem{Put: &types.Put{
+			TableName: aws.String(env.TableName),
+			Item:      item,
+		}})
+	}
+
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	return names, nil
+}
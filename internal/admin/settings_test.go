@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockTransactAPI struct {
+	transactions []*dynamodb.TransactWriteItemsInput
+}
+
+func (m *mockTransactAPI) TransactWriteItems(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	m.transactions = append(m.transactions, params)
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func TestSettings_RoundTrip(t *testing.T) {
+	labels := map[string]types.AttributeValue{
+		"MessageID": &types.AttributeValueMemberS{Value: "label#definitions"},
+		"Definitions": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"Work": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+				"Color":       &types.AttributeValueMemberS{Value: "#1a73e8"},
+				"TimeCreated": &types.AttributeValueMemberS{Value: "2024-05-01T12:00:00Z"},
+			}},
+		}},
+	}
+	rules := map[string]types.AttributeValue{
+		"MessageID": &types.AttributeValueMemberS{Value: "sieve#script"},
+		"Script":    &types.AttributeValueMemberS{Value: `require "fileinto"; fileinto "Work";`},
+	}
+	client := &mockAdminAPI{items: map[string]map[string]types.AttributeValue{
+		"label#definitions": labels,
+		"sieve#script":      rules,
+		"1":                 {"MessageID": &types.AttributeValueMemberS{Value: "1"}},
+	}}
+
+	bundle, err := ExportSettings(context.TODO(), client)
+	assert.Nil(t, err)
+	assert.Equal(t, SettingsVersion, bundle.Version)
+	assert.Equal(t, map[string]Item{"labels": labels, "rules": rules}, bundle.Settings)
+
+	data, err := json.Marshal(bundle)
+	assert.Nil(t, err)
+	var imported SettingsBundle
+	assert.Nil(t, json.Unmarshal(data, &imported))
+
+	transactAPI := &mockTransactAPI{}
+	names, err := ImportSettings(context.TODO(), transactAPI, imported)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"labels", "rules"}, names)
+	if assert.Len(t, transactAPI.transactions, 1) && assert.Len(t, transactAPI.transactions[0].TransactItems, 2) {
+		assert.Equal(t, labels, transactAPI.transactions[0].TransactItems[0].Put.Item)
+		assert.Equal(t, rules, transactAPI.transactions[0].TransactItems[1].Put.Item)
+	}
+}
+
+func TestImportSettings_Key(t *testing.T) {
+	client := &mockTransactAPI{}
+	_, err := ImportSettings(context.TODO(), client, SettingsBundle{
+		Version: SettingsVersion,
+		Settings: map[string]Item{
+			"labels": {"MessageID": &types.AttributeValueMemberS{Value: "exampleMessageID"}},
+		},
+	})
+	assert.Nil(t, err)
+	// the key of a setting can't be changed
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "label#definitions"},
+		client.transactions[0].TransactItems[0].Put.Item["MessageID"])
+}
+
+func TestImportSettings_Invalid(t *testing.T) {
+	for _, bundle := range []SettingsBundle{
+		{Version: 2, Settings: map[string]Item{"labels": {}}},
+		{Version: SettingsVersion},
+		{Version: SettingsVersion, Settings: map[string]Item{"emails": {}}},
+	} {
+		_, err := ImportSettings(context.TODO(), &mockTransactAPI{}, bundle)
+		assert.True(t, errors.Is(err, api.ErrInvalidInput), err)
+	}
+
+	var bundle SettingsBundle
+	err := json.Unmarshal([]byte(`{"version":1,"settings":{"labels":{"Definitions":{"Y":"a"}}}}`), &bundle)
+	assert.True(t, errors.Is(err, api.ErrInvalidInput), err)
+}
@@ -0,0 +1,93 @@
+// Package analytics puts a flattened metadata record of every received and sent email to a Kinesis Data Firehose
+// delivery stream, which can convert them to Parquet in S3, so that emails can be analyzed with SQL in Athena
+// without reading the table. Records are put by a hook notifier, see Notifier.
+// It also keeps the volumes and authentication results of received emails by sender domain in the table, see RecordDomain.
+package analytics
+
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Enabled returns true if ANALYTICS_STREAM is set
+func Enabled() bool {
+	return env.AnalyticsStream != ""
+}
+
+// Record is the metadata of an email, flattened so that every field is a column of the Parquet schema.
+// Fields that are only known for received emails, such as verdicts, are omitted for sent emails, i.e. null.
+type Record struct {
+	MessageID  string   `json:"messageID"`
+	Type       string   `json:"type"` // inbox or sent
+	Time       string   `json:"time"` // time received or sent, RFC3339
+	Subject    string   `json:"subject"`
+	From       string   `json:"from"`       // address of the first sender, without the display name
+	FromDomain string   `json:"fromDomain"` // lowercase domain of From
+	To         []string `json:"to"`
+	Cc         []string `json:"cc,omitempty"`
+	Recipients int      `json:"recipients"` // number of To, Cc and Bcc addresses
+	Labels     []string `json:"labels,omitempty"`
+	ThreadID   string   `json:"threadID,omitempty"`
+
+	Spam  *bool `json:"spam,omitempty"`
+	Virus *bool `json:"virus,omitempty"`
+	SPF   *bool `json:"spf,omitempty"`
+	DKIM  *bool `json:"dkim,omitempty"`
+	DMARC *bool `json:"dmarc,omitempty"`
+
+	RawSize         int64 `json:"rawSize,omitempty"`
+	AttachmentCount int   `json:"attachmentCount"`
+	AttachmentSize  int64 `json:"attachmentSize,omitempty"`
+
+	Template string `json:"template,omitempty"` // SES template of transactional emails
+	DryRun   bool   `json:"dryRun,omitempty"`   // whether the email is a simulated send
+}
+
+// NewRecord returns the record of a received or sent email
+func NewRecord(result *email.GetResult) Record {
+	record := Record{
+		MessageID:  result.MessageID,
+		Type:       result.Type,
+		Time:       result.TimeReceived,
+		Subject:    result.Subject,
+		To:         result.To,
+		Cc:         result.Cc,
+		Recipients: len(result.To) + len(result.Cc) + len(result.Bcc),
+		Labels:     result.Labels,
+		ThreadID:   result.ThreadID,
+		Template:   result.Template,
+		DryRun:     result.DryRun,
+	}
+	if result.Type == email.EmailTypeSent {
+		record.Time = result.TimeSent
+		record.AttachmentCount = len(result.Uploads)
+	}
+	if len(result.From) > 0 {
+		record.From, record.FromDomain = senderAddress(result.From[0])
+	}
+	if verdict := result.Verdict; verdict != nil {
+		record.Spam, record.Virus = &verdict.Spam, &verdict.Virus
+		record.SPF, record.DKIM, record.DMARC = &verdict.SPF, &verdict.DKIM, &verdict.DMARC
+	}
+	if stats := result.Stats; stats != nil {
+		record.RawSize = stats.RawSize
+		record.AttachmentCount = stats.AttachmentCount
+		record.AttachmentSize = stats.AttachmentSize
+	}
+	return record
+}
+
+// senderAddress returns the address of a sender without its display name, and its lowercase domain
+func senderAddress(from string) (address, domain string) {
+	address = from
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		address = parsed.Address
+	}
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		domain = strings.ToLower(address[i+1:])
+	}
+	return address, domain
+}
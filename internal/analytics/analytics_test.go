@@ -0,0 +1,87 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRecord(t *testing.T) {
+	yes, no := true, false
+
+	received := &email.GetResult{
+		MessageID:    "received",
+		Type:         email.EmailTypeInbox,
+		TimeReceived: "2024-05-01T12:00:00Z",
+		Subject:      "hello",
+		From:         []string{"Alice <alice@Example.COM>"},
+		To:           []string{"me@example.com", "team@example.com"},
+		Labels:       []string{"work"},
+		Verdict:      &email.Verdict{Spam: false, DKIM: true, DMARC: true, SPF: true, Virus: false},
+		Stats:        &types.EmailStats{RawSize: 2048, AttachmentCount: 1, AttachmentSize: 1024},
+	}
+	assert.Equal(t, Record{
+		MessageID:       "received",
+		Type:            email.EmailTypeInbox,
+		Time:            "2024-05-01T12:00:00Z",
+		Subject:         "hello",
+		From:            "alice@Example.COM",
+		FromDomain:      "example.com",
+		To:              []string{"me@example.com", "team@example.com"},
+		Recipients:      2,
+		Labels:          []string{"work"},
+		Spam:            &no,
+		Virus:           &no,
+		SPF:             &yes,
+		DKIM:            &yes,
+		DMARC:           &yes,
+		RawSize:         2048,
+		AttachmentCount: 1,
+		AttachmentSize:  1024,
+	}, NewRecord(received))
+
+	sent := &email.GetResult{
+		MessageID: "sent",
+		Type:      email.EmailTypeSent,
+		TimeSent:  "2024-05-01T13:00:00Z",
+		From:      []string{"me@example.com"},
+		To:        []string{"alice@example.com"},
+		Cc:        []string{"bob@example.com"},
+		Bcc:       []string{"archive@example.com"},
+		Uploads:   []email.UploadedFile{{UploadID: "upload", Filename: "report.pdf"}},
+		DryRun:    true,
+	}
+	assert.Equal(t, Record{
+		MessageID:       "sent",
+		Type:            email.EmailTypeSent,
+		Time:            "2024-05-01T13:00:00Z",
+		From:            "me@example.com",
+		FromDomain:      "example.com",
+		To:              []string{"alice@example.com"},
+		Cc:              []string{"bob@example.com"},
+		Recipients:      3,
+		AttachmentCount: 1,
+		DryRun:          true,
+	}, NewRecord(sent))
+}
+
+func TestSenderAddress(t *testing.T) {
+	tests := []struct {
+		from            string
+		expectedAddress string
+		expectedDomain  string
+	}{
+		{from: "alice@example.com", expectedAddress: "alice@example.com", expectedDomain: "example.com"},
+		{from: `"Alice" <alice@Mail.Example.com>`, expectedAddress: "alice@Mail.Example.com", expectedDomain: "mail.example.com"},
+		{from: "invalid", expectedAddress: "invalid"},
+	}
+	for _, test := range tests {
+		t.Run(test.from, func(t *testing.T) {
+			address, domain := senderAddress(test.from)
+			assert.Equal(t, test.expectedAddress, address)
+			assert.Equal(t, test.expectedDomain, domain)
+		})
+	}
+}
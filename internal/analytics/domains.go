@@ -0,0 +1,279 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+const (
+	// domainsID is the MessageID of the item storing the statistics of sender domains in the email table
+	domainsID = "analytics#domains"
+
+	// MaxDomains is the maximum number of sender domains tracked, so that the item stays within the item size limit
+	MaxDomains = 2000
+	// OtherDomains counts the emails from domains that aren't tracked once MaxDomains domains are
+	OtherDomains = "*"
+
+	statusPass = "PASS"
+	statusFail = "FAIL"
+)
+
+// DomainEvent is a received email, as it's counted in the statistics of its sender domain
+type DomainEvent struct {
+	Domain string
+	Time   time.Time
+	SPF    bool // whether the checks passed
+	DKIM   bool
+	DMARC  bool
+	Spam   bool // whether the checks failed, which aren't counted if they are disabled
+	Virus  bool
+}
+
+// NewDomainEvent returns the event of an email received by SES, whose domain is the domain of its first From address,
+// or of its envelope sender if From can't be parsed
+func NewDomainEvent(ses events.SimpleEmailService) DomainEvent {
+	var domain string
+	if from := ses.Mail.CommonHeaders.From; len(from) > 0 {
+		_, domain = senderAddress(from[0])
+	}
+	if domain == "" {
+		_, domain = senderAddress(ses.Mail.Source)
+	}
+	receipt := ses.Receipt
+	return DomainEvent{
+		Domain: domain,
+		Time:   ses.Mail.Timestamp,
+		SPF:    receipt.SPFVerdict.Status == statusPass,
+		DKIM:   receipt.DKIMVerdict.Status == statusPass,
+		DMARC:  receipt.DMARCVerdict.Status == statusPass,
+		Spam:   receipt.SpamVerdict.Status == statusFail,
+		Virus:  receipt.VirusVerdict.Status == statusFail,
+	}
+}
+
+// DomainStats are the statistics of the emails received from a sender domain
+type DomainStats struct {
+	Domain        string  `json:"domain"` // lowercase, or OtherDomains
+	Received      int64   `json:"received"`
+	SPFPassRate   float64 `json:"spfPassRate"` // from 0 to 1
+	DKIMPassRate  float64 `json:"dkimPassRate"`
+	DMARCPassRate float64 `json:"dmarcPassRate"`
+	Spam          int64   `json:"spam"`
+	Virus         int64   `json:"virus"`
+	FirstSeen     string  `json:"firstSeen"` // RFC3339
+	LastSeen      string  `json:"lastSeen"`
+}
+
+// domainEntry is the value of a domain in the Domains map of the item
+type domainEntry struct {
+	Received  int64
+	SPF       int64
+	DKIM      int64
+	DMARC     int64
+	Spam      int64
+	Virus     int64
+	FirstSeen string
+	LastSeen  string
+}
+
+// RecordDomain counts a received email in the statistics of its sender domain.
+// Domains are added until MaxDomains are tracked, after which emails from new domains are counted in OtherDomains.
+func RecordDomain(ctx context.Context, client api.UpdateItemAPI, event DomainEvent) error {
+	if event.Domain == "" {
+		return nil
+	}
+
+	err := incrementDomain(ctx, client, event.Domain, event)
+	if !conditionFailed(err) {
+		return err
+	}
+	err = addDomain(ctx, client, event.Domain, event, true)
+	if !conditionFailed(err) {
+		return err
+	}
+	// the domain is added concurrently, or MaxDomains domains are tracked
+	err = incrementDomain(ctx, client, event.Domain, event)
+	if !conditionFailed(err) {
+		return err
+	}
+
+	err = incrementDomain(ctx, client, OtherDomains, event)
+	if !conditionFailed(err) {
+		return err
+	}
+	err = addDomain(ctx, client, OtherDomains, event, false)
+	if !conditionFailed(err) {
+		return err
+	}
+	return incrementDomain(ctx, client, OtherDomains, event)
+}
+
+// incrementDomain counts an email in the entry of a domain, failing the condition if the domain isn't tracked
+func incrementDomain(ctx context.Context, client api.UpdateItemAPI, domain string, event DomainEvent) error {
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: domainsID},
+		},
+		UpdateExpression: aws.String("SET Domains.#d.Received = Domains.#d.Received + :one, " +
+			"Domains.#d.SPF = Domains.#d.SPF + :spf, Domains.#d.DKIM = Domains.#d.DKIM + :dkim, " +
+			"Domains.#d.DMARC = Domains.#d.DMARC + :dmarc, Domains.#d.Spam = Domains.#d.Spam + :spam, " +
+			"Domains.#d.Virus = Domains.#d.Virus + :virus, Domains.#d.LastSeen = :time"),
+		ConditionExpression: aws.String("attribute_exists(Domains.#d)"),
+		ExpressionAttributeNames: map[string]string{
+			"#d": domain,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one":   &types.AttributeValueMemberN{Value: "1"},
+			":spf":   count(event.SPF),
+			":dkim":  count(event.DKIM),
+			":dmarc": count(event.DMARC),
+			":spam":  count(event.Spam),
+			":virus": count(event.Virus),
+			":time":  &types.AttributeValueMemberS{Value: event.Time.UTC().Format(time.RFC3339)},
+		},
+	})
+	return mapDynamoDBError(err)
+}
+
+// addDomain adds the entry of a domain with an email, failing the condition if the domain is already tracked,
+// or if limited and MaxDomains domains are tracked
+func addDomain(ctx context.Context, client api.UpdateItemAPI, domain string, event DomainEvent, limited bool) error {
+	// a nested attribute can only be set in an existing map
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: domainsID},
+		},
+		UpdateExpression: aws.String("SET Domains = if_not_exists(Domains, :empty)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":empty": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}},
+		},
+	})
+	if err != nil {
+		return mapDynamoDBError(err)
+	}
+
+	seen := event.Time.UTC().Format(time.RFC3339)
+	entry, err := attributevalue.Marshal(domainEntry{
+		Received:  1,
+		SPF:       boolCount(event.SPF),
+		DKIM:      boolCount(event.DKIM),
+		DMARC:     boolCount(event.DMARC),
+		Spam:      boolCount(event.Spam),
+		Virus:     boolCount(event.Virus),
+		FirstSeen: seen,
+		LastSeen:  seen,
+	})
+	if err != nil {
+		return err
+	}
+	condition := "attribute_not_exists(Domains.#d)"
+	values := map[string]types.AttributeValue{
+		":entry": entry,
+	}
+	if limited {
+		condition += " AND size(Domains) < :max"
+		values[":max"] = &types.AttributeValueMemberN{Value: strconv.Itoa(MaxDomains)}
+	}
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: domainsID},
+		},
+		UpdateExpression:    aws.String("SET Domains.#d = :entry"),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]string{
+			"#d": domain,
+		},
+		ExpressionAttributeValues: values,
+	})
+	return mapDynamoDBError(err)
+}
+
+// Domains returns the statistics of sender domains, from the domain with the most received emails.
+// limit is the maximum number of domains returned, or 0 for all of them.
+func Domains(ctx context.Context, client api.GetItemAPI, limit int) ([]DomainStats, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: domainsID},
+		},
+	})
+	if err != nil {
+		return nil, mapDynamoDBError(err)
+	}
+
+	entries := make(map[string]domainEntry)
+	if av, ok := resp.Item["Domains"]; ok {
+		if err := attributevalue.Unmarshal(av, &entries); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := make([]DomainStats, 0, len(entries))
+	for domain, entry := range entries {
+		stats = append(stats, DomainStats{
+			Domain:        domain,
+			Received:      entry.Received,
+			SPFPassRate:   rate(entry.SPF, entry.Received),
+			DKIMPassRate:  rate(entry.DKIM, entry.Received),
+			DMARCPassRate: rate(entry.DMARC, entry.Received),
+			Spam:          entry.Spam,
+			Virus:         entry.Virus,
+			FirstSeen:     entry.FirstSeen,
+			LastSeen:      entry.LastSeen,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Received != stats[j].Received {
+			return stats[i].Received > stats[j].Received
+		}
+		return stats[i].Domain < stats[j].Domain
+	})
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+func rate(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+func boolCount(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func count(b bool) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(boolCount(b), 10)}
+}
+
+func conditionFailed(err error) bool {
+	return errors.As(err, new(*types.ConditionalCheckFailedException))
+}
+
+func mapDynamoDBError(err error) error {
+	if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+		return api.ErrTooManyRequests
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockDomainsTable keeps the Domains map of the item, and evaluates the updates of RecordDomain on it
+type mockDomainsTable struct {
+	domains map[string]domainEntry // nil if the map doesn't exist
+}
+
+func (m *mockDomainsTable) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	expression := aws.ToString(params.UpdateExpression)
+	if strings.HasPrefix(expression, "SET Domains = if_not_exists") {
+		if m.domains == nil {
+			m.domains = make(map[string]domainEntry)
+		}
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+
+	domain := params.ExpressionAttributeNames["#d"]
+	values := params.ExpressionAttributeValues
+	if entry, ok := values[":entry"]; ok {
+		if m.domains == nil {
+			return nil, errors.New("the document path provided in the update expression is invalid for update")
+		}
+		if _, exists := m.domains[domain]; exists {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		if limit, ok := values[":max"].(*types.AttributeValueMemberN); ok {
+			if max, _ := strconv.Atoi(limit.Value); len(m.domains) >= max {
+				return nil, &types.ConditionalCheckFailedException{}
+			}
+		}
+		value := domainEntry{}
+		if err := attributevalue.Unmarshal(entry, &value); err != nil {
+			return nil, err
+		}
+		m.domains[domain] = value
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+
+	value, exists := m.domains[domain]
+	if !exists {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	n := func(name string) int64 {
+		v, _ := strconv.ParseInt(values[name].(*types.AttributeValueMemberN).Value, 10, 64)
+		return v
+	}
+	value.Received += n(":one")
+	value.SPF += n(":spf")
+	value.DKIM += n(":dkim")
+	value.DMARC += n(":dmarc")
+	value.Spam += n(":spam")
+	value.Virus += n(":virus")
+	value.LastSeen = values[":time"].(*types.AttributeValueMemberS).Value
+	m.domains[domain] = value
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (m *mockDomainsTable) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.domains == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	av, err := attributevalue.Marshal(m.domains)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{"Domains": av}}, nil
+}
+
+func TestNewDomainEvent(t *testing.T) {
+	ses := events.SimpleEmailService{}
+	ses.Mail.Source = "bounce@mailer.example.net"
+	ses.Mail.Timestamp = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ses.Mail.CommonHeaders.From = []string{"News <news@Example.COM>"}
+	ses.Receipt.SPFVerdict.Status = "PASS"
+	ses.Receipt.DKIMVerdict.Status = "FAIL"
+	ses.Receipt.DMARCVerdict.Status = "GRAY"
+	ses.Receipt.SpamVerdict.Status = "FAIL"
+	ses.Receipt.VirusVerdict.Status = "DISABLED"
+
+	assert.Equal(t, DomainEvent{
+		Domain: "example.com",
+		Time:   ses.Mail.Timestamp,
+		SPF:    true,
+		Spam:   true,
+	}, NewDomainEvent(ses))
+
+	ses.Mail.CommonHeaders.From = []string{"undisclosed"}
+	assert.Equal(t, "mailer.example.net", NewDomainEvent(ses).Domain)
+}
+
+func TestRecordDomain(t *testing.T) {
+	table := &mockDomainsTable{}
+	first := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	received := []DomainEvent{
+		{Domain: "example.com", Time: first, SPF: true, DKIM: true, DMARC: true},
+		{Domain: "example.com", Time: first.Add(time.Hour), SPF: true, Spam: true},
+		{Domain: "example.net", Time: first, SPF: true, DKIM: true, DMARC: true, Virus: true},
+		{Time: first}, // unknown domains aren't counted
+	}
+	for _, event := range received {
+		assert.Nil(t, RecordDomain(context.TODO(), table, event))
+	}
+
+	stats, err := Domains(context.TODO(), table, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []DomainStats{
+		{
+			Domain:        "example.com",
+			Received:      2,
+			SPFPassRate:   1,
+			DKIMPassRate:  0.5,
+			DMARCPassRate: 0.5,
+			Spam:          1,
+			FirstSeen:     "2024-05-01T12:00:00Z",
+			LastSeen:      "2024-05-01T13:00:00Z",
+		},
+		{
+			Domain:        "example.net",
+			Received:      1,
+			SPFPassRate:   1,
+			DKIMPassRate:  1,
+			DMARCPassRate: 1,
+			Virus:         1,
+			FirstSeen:     "2024-05-01T12:00:00Z",
+			LastSeen:      "2024-05-01T12:00:00Z",
+		},
+	}, stats)
+
+	stats, err = Domains(context.TODO(), table, 1)
+	assert.Nil(t, err)
+	assert.Len(t, stats, 1)
+}
+
+func TestRecordDomain_MaxDomains(t *testing.T) {
+	table := &mockDomainsTable{domains: make(map[string]domainEntry)}
+	for i := 0; i < MaxDomains; i++ {
+		table.domains[fmt.Sprintf("domain%d.example", i)] = domainEntry{Received: 1}
+	}
+
+	event := DomainEvent{Domain: "new.example", Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	assert.Nil(t, RecordDomain(context.TODO(), table, event))
+	assert.Nil(t, RecordDomain(context.TODO(), table, event))
+	assert.NotContains(t, table.domains, "new.example")
+	assert.Equal(t, int64(2), table.domains[OtherDomains].Received)
+
+	// tracked domains are still counted
+	assert.Nil(t, RecordDomain(context.TODO(), table, DomainEvent{Domain: "domain0.example", Time: event.Time}))
+	assert.Equal(t, int64(2), table.domains["domain0.example"].Received)
+}
+
+func TestDomains_Empty(t *testing.T) {
+	stats, err := Domains(context.TODO(), &mockDomainsTable{}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []DomainStats{}, stats)
+}
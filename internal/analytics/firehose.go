@@ -0,0 +1,98 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	"github.com/aws/aws-sdk-go-v2/service/firehose/types"
+)
+
+const (
+	maxBatchRecords = 500 // maximum number of records of a PutRecordBatch request
+	maxPutAttempts  = 3   // attempts to put the records that fail, including the first one
+)
+
+// putRetryDelay is the delay before putting the failed records of a batch again, which doubles after each attempt
+var putRetryDelay = 100 * time.Millisecond
+
+// ErrPutFailed is returned when Firehose responds with an error, or fails to put some of the records
+var ErrPutFailed = errors.New("failed to put records to firehose")
+
+// PutRecordBatchAPI defines set of API required to put records to a delivery stream, which is implemented by *firehose.Client
+type PutRecordBatchAPI interface {
+	PutRecordBatch(ctx context.Context, params *firehose.PutRecordBatchInput, optFns ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error)
+}
+
+// Firehose puts records to delivery streams with the PutRecordBatch API
+type Firehose struct {
+	client PutRecordBatchAPI
+}
+
+// NewFirehose returns a client of Firehose in the region of cfg
+func NewFirehose(cfg aws.Config) *Firehose {
+	return &Firehose{client: firehose.NewFromConfig(cfg)}
+}
+
+// PutRecords puts records to a delivery stream, in batches of up to 500 records
+func (f *Firehose) PutRecords(ctx context.Context, stream string, records [][]byte) error {
+	for len(records) > 0 {
+		n := min(len(records), maxBatchRecords)
+		if err := f.putRecordBatch(ctx, stream, records[:n]); err != nil {
+			return err
+		}
+		records = records[n:]
+	}
+	return nil
+}
+
+// putRecordBatch puts a batch of records, and puts the records that fail again, up to maxPutAttempts times.
+// Records are put at least once, so a record put again after a failed response may be delivered twice.
+func (f *Firehose) putRecordBatch(ctx context.Context, stream string, records [][]byte) error {
+	delay := putRetryDelay
+	for attempt := 1; ; attempt++ {
+		input := &firehose.PutRecordBatchInput{
+			DeliveryStreamName: aws.String(stream),
+			Records:            make([]types.Record, 0, len(records)),
+		}
+		for _, record := range records {
+			input.Records = append(input.Records, types.Record{Data: record})
+		}
+		output, err := f.client.PutRecordBatch(ctx, input)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrPutFailed, err)
+		}
+		if aws.ToInt32(output.FailedPutCount) == 0 {
+			return nil
+		}
+
+		// responses are in the order of the records, failed ones have an error code
+		var failed [][]byte
+		var last types.PutRecordBatchResponseEntry
+		for i, response := range output.RequestResponses {
+			if aws.ToString(response.ErrorCode) != "" && i < len(records) {
+				failed = append(failed, records[i])
+				last = response
+			}
+		}
+		if len(failed) == 0 {
+			return fmt.Errorf("%w, %d of %d records failed", ErrPutFailed, aws.ToInt32(output.FailedPutCount), len(records))
+		}
+		if attempt == maxPutAttempts {
+			return fmt.Errorf("%w, %d of %d records failed: %s: %s",
+				ErrPutFailed, len(failed), len(records), aws.ToString(last.ErrorCode), aws.ToString(last.ErrorMessage))
+		}
+
+		fmt.Printf("%d of %d records failed to be put to firehose, putting them again\n", len(failed), len(records))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		records = failed
+	}
+}
@@ -0,0 +1,93 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	"github.com/aws/aws-sdk-go-v2/service/firehose/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPutRecordBatchAPI func(ctx context.Context, params *firehose.PutRecordBatchInput, optFns ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error)
+
+func (m mockPutRecordBatchAPI) PutRecordBatch(ctx context.Context, params *firehose.PutRecordBatchInput, optFns ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func TestFirehose(t *testing.T) {
+	defer func(delay time.Duration) { putRetryDelay = delay }(putRetryDelay)
+	putRetryDelay = 0
+
+	var batches [][]string
+	failures := 0 // number of calls in which the first record of the batch fails
+	client := &Firehose{
+		client: mockPutRecordBatchAPI(func(_ context.Context, params *firehose.PutRecordBatchInput, _ ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error) {
+			assert.Equal(t, "mailbox-analytics", aws.ToString(params.DeliveryStreamName))
+			var batch []string
+			output := &firehose.PutRecordBatchOutput{FailedPutCount: aws.Int32(0)}
+			for i, record := range params.Records {
+				batch = append(batch, string(record.Data))
+				if i == 0 && failures > 0 {
+					output.FailedPutCount = aws.Int32(1)
+					output.RequestResponses = append(output.RequestResponses, types.PutRecordBatchResponseEntry{
+						ErrorCode:    aws.String("ServiceUnavailableException"),
+						ErrorMessage: aws.String("Slow down."),
+					})
+					continue
+				}
+				output.RequestResponses = append(output.RequestResponses, types.PutRecordBatchResponseEntry{
+					RecordId: aws.String("1"),
+				})
+			}
+			batches = append(batches, batch)
+			if failures > 0 {
+				failures--
+			}
+			return output, nil
+		}),
+	}
+
+	records := make([][]byte, maxBatchRecords+1)
+	for i := range records {
+		records[i] = []byte("{}\n")
+	}
+	records[maxBatchRecords] = []byte(`{"messageID":"last"}` + "\n")
+	err := client.PutRecords(context.TODO(), "mailbox-analytics", records)
+	assert.NoError(t, err)
+	if assert.Len(t, batches, 2) {
+		assert.Len(t, batches[0], maxBatchRecords)
+		assert.Equal(t, []string{`{"messageID":"last"}` + "\n"}, batches[1])
+	}
+
+	// only the failed record is put again
+	batches = nil
+	failures = 1
+	err = client.PutRecords(context.TODO(), "mailbox-analytics", [][]byte{[]byte("a\n"), []byte("b\n")})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"a\n", "b\n"}, {"a\n"}}, batches)
+
+	// records that keep failing are put up to maxPutAttempts times
+	batches = nil
+	failures = maxPutAttempts
+	err = client.PutRecords(context.TODO(), "mailbox-analytics", [][]byte{[]byte("a\n"), []byte("b\n")})
+	assert.True(t, errors.Is(err, ErrPutFailed))
+	assert.EqualError(t, err, ErrPutFailed.Error()+", 1 of 1 records failed: ServiceUnavailableException: Slow down.")
+	assert.Equal(t, [][]string{{"a\n", "b\n"}, {"a\n"}, {"a\n"}}, batches)
+
+	client.client = mockPutRecordBatchAPI(func(_ context.Context, _ *firehose.PutRecordBatchInput, _ ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error) {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("stream not found")}
+	})
+	err = client.PutRecords(context.TODO(), "mailbox-analytics", records[:1])
+	assert.True(t, errors.Is(err, ErrPutFailed))
+	var notFound *types.ResourceNotFoundException
+	assert.True(t, errors.As(err, &notFound))
+}
+
+func TestNewFirehose(t *testing.T) {
+	client := NewFirehose(aws.Config{Region: "us-east-1"})
+	assert.NotNil(t, client.client)
+}
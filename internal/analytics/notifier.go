@@ -0,0 +1,91 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+)
+
+// putter puts records to a delivery stream, which is Firehose except in tests
+type putter interface {
+	PutRecords(ctx context.Context, stream string, records [][]byte) error
+}
+
+// Notifier puts the records of received and sent emails to ANALYTICS_STREAM, it implements hook.Notifier
+type Notifier struct {
+	client api.GetItemAPI // to get the emails
+	putter putter
+}
+
+var _ hook.Notifier = (*Notifier)(nil)
+
+// NewNotifier returns a Notifier
+func NewNotifier(client api.GetItemAPI, cfg aws.Config) *Notifier {
+	return &Notifier{client: client, putter: NewFirehose(cfg)}
+}
+
+// Enabled returns true if analytics records are enabled
+func (n *Notifier) Enabled() bool {
+	return Enabled()
+}
+
+// Notify puts the records of the emails of a hook, received or sent, individually or in a batch, others are ignored.
+// Emails deleted in the meantime are skipped.
+func (n *Notifier) Notify(ctx context.Context, data *hook.Hook) error {
+	var records [][]byte
+	for _, messageID := range messageIDs(data) {
+		result, err := email.Get(ctx, n.client, messageID)
+		if err == api.ErrNotFound {
+			fmt.Printf("email %s not found, no analytics record is put\n", messageID)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		record, err := json.Marshal(NewRecord(result))
+		if err != nil {
+			return err
+		}
+		records = append(records, append(record, '\n'))
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return n.putter.PutRecords(ctx, env.AnalyticsStream, records)
+}
+
+// messageIDs returns the IDs of the received and sent emails of a hook
+func messageIDs(data *hook.Hook) []string {
+	switch {
+	case data.Event == hook.EventEmail && (data.Action == hook.ActionReceived || data.Action == hook.ActionSent):
+		return []string{data.Email.ID}
+	case data.Event == hook.EventBatch:
+		var ids []string
+		for i := range data.Batch {
+			ids = append(ids, messageIDs(&data.Batch[i])...)
+		}
+		return ids
+	}
+	return nil
+}
+
+// RecordSent puts the record of a sent email, if analytics records are enabled.
+// Sent emails aren't notified by webhooks, so it's called by the functions that send emails.
+func RecordSent(ctx context.Context, client api.GetItemAPI, cfg aws.Config, messageID string) error {
+	if !Enabled() {
+		return nil
+	}
+	return NewNotifier(client, cfg).Notify(ctx, &hook.Hook{
+		Event:     hook.EventEmail,
+		Action:    hook.ActionSent,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Email:     hook.Email{ID: messageID},
+	})
+}
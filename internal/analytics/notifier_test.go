@@ -0,0 +1,113 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/util/mockutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPutter struct {
+	streams []string
+	records [][]string
+	err     error
+}
+
+func (m *mockPutter) PutRecords(_ context.Context, stream string, records [][]byte) error {
+	m.streams = append(m.streams, stream)
+	batch := make([]string, len(records))
+	for i, record := range records {
+		batch[i] = string(record)
+	}
+	m.records = append(m.records, batch)
+	return m.err
+}
+
+// mockEmails returns the emails by their message IDs, which are received emails from sender@example.com
+func mockEmails(messageIDs ...string) mockutil.MockGetItemAPI {
+	items := make(map[string]map[string]types.AttributeValue)
+	for _, messageID := range messageIDs {
+		items[messageID] = map[string]types.AttributeValue{
+			"MessageID":     &types.AttributeValueMemberS{Value: messageID},
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+			"DateTime":      &types.AttributeValueMemberS{Value: "01-12:00:00"},
+			"Subject":       &types.AttributeValueMemberS{Value: "hello"},
+			"From":          &types.AttributeValueMemberSS{Value: []string{"sender@example.com"}},
+			"To":            &types.AttributeValueMemberSS{Value: []string{"me@example.com"}},
+		}
+	}
+	return func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+		messageID := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+		return &dynamodb.GetItemOutput{Item: items[messageID]}, nil
+	}
+}
+
+func TestNotifier_Enabled(t *testing.T) {
+	notifier := &Notifier{}
+	assert.False(t, notifier.Enabled())
+
+	env.AnalyticsStream = "mailbox-analytics"
+	defer func() { env.AnalyticsStream = "" }()
+	assert.True(t, notifier.Enabled())
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	env.AnalyticsStream = "mailbox-analytics"
+	defer func() { env.AnalyticsStream = "" }()
+
+	putter := &mockPutter{}
+	notifier := &Notifier{client: mockEmails("first", "second"), putter: putter}
+
+	err := notifier.Notify(context.TODO(), &hook.Hook{
+		Event:  hook.EventEmail,
+		Action: hook.ActionReceived,
+		Email:  hook.Email{ID: "first"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mailbox-analytics"}, putter.streams)
+	assert.Equal(t, [][]string{{`{"messageID":"first","type":"inbox","time":"2024-05-01T12:00:00Z","subject":"hello",` +
+		`"from":"sender@example.com","fromDomain":"example.com","to":["me@example.com"],"recipients":1,"attachmentCount":0}` + "\n"}},
+		putter.records)
+
+	// deferred hooks are put in one batch, skipping other hooks and deleted emails
+	putter.records = nil
+	err = notifier.Notify(context.TODO(), &hook.Hook{
+		Event:  hook.EventBatch,
+		Action: hook.ActionDeferred,
+		Batch: []hook.Hook{
+			{Event: hook.EventEmail, Action: hook.ActionReceived, Email: hook.Email{ID: "first"}},
+			{Event: hook.EventSecurity, Action: hook.ActionAttachmentsBlocked, Email: hook.Email{ID: "second"}},
+			{Event: hook.EventEmail, Action: hook.ActionReceived, Email: hook.Email{ID: "deleted"}},
+			{Event: hook.EventEmail, Action: hook.ActionReceived, Email: hook.Email{ID: "second"}},
+		},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, putter.records, 1) && assert.Len(t, putter.records[0], 2) {
+		assert.Contains(t, putter.records[0][0], `"messageID":"first"`)
+		assert.Contains(t, putter.records[0][1], `"messageID":"second"`)
+	}
+
+	// nothing is put if there are no records
+	putter.records = nil
+	err = notifier.Notify(context.TODO(), &hook.Hook{
+		Event:  hook.EventComplaint,
+		Action: hook.ActionReceived,
+		Email:  hook.Email{ID: "first"},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, putter.records)
+
+	putter.err = errors.New("error")
+	err = notifier.Notify(context.TODO(), &hook.Hook{
+		Event:  hook.EventEmail,
+		Action: hook.ActionSent,
+		Email:  hook.Email{ID: "first"},
+	})
+	assert.EqualError(t, err, "error")
+}
@@ -5,7 +5,6 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	"github.com/harryzcy/mailbox/internal/datasource/storage"
 )
 
@@ -22,19 +21,32 @@ type GetItemAPI interface {
 type GetEmailAPI interface {
 	GetItemAPI
 	UpdateItemAPI
+	TransactWriteItemsAPI // to mark the email as read along with the counter updates
 }
 
 // GetItemContentAPI defines set of API required to get attachments or inlines of an email
 type GetItemContentAPI interface {
+	GetItemAPI // to get the location of the raw email
 	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 }
 
+// GetScannedContentAPI defines set of API required to get a file of an email after checking its virus scan
+type GetScannedContentAPI interface {
+	GetItemAPI // to get the scan state of the email
+	GetItemContentAPI
+}
+
 // DeleteItemAPI defines DynamoDB DeleteItem and S3 DeleteObject API
 type DeleteItemAPI interface {
 	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
 	storage.S3DeleteObjectAPI
 }
 
+// DeleteSieveScriptAPI defines set of API required to delete the Sieve script
+type DeleteSieveScriptAPI interface {
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
 // DeleteEmailAPI defines set of API required to delete an email
 type DeleteEmailAPI interface {
 	DeleteItemAPI
@@ -46,6 +58,37 @@ type DeleteThreadAPI interface {
 	TransactWriteItemsAPI
 	GetItemAPI // to get emails of the thread
 	storage.S3DeleteObjectAPI
+	storage.S3HeadObjectAPI // to check the retention of the emails
+}
+
+// DeleteCountedEmailAPI defines set of API required to delete an email and update the folder counters
+type DeleteCountedEmailAPI interface {
+	DeleteItemAPI
+	GetItemAPI              // to get the state of the email
+	TransactWriteItemsAPI   // to delete the email along with the counter updates
+	UpdateItemAPI           // to release the blobs of the email
+	storage.S3HeadObjectAPI // to check the retention of the email
+}
+
+// BatchEmailAPI defines set of API required to read, trash, delete or move multiple emails at once
+type BatchEmailAPI interface {
+	BatchGetItemAPI       // to get the states of the emails
+	DeleteCountedEmailAPI // to change the emails along with the counter updates, or one by one if they change concurrently
+}
+
+// EmptyTrashAPI defines set of API required to delete the trashed emails
+type EmptyTrashAPI interface {
+	ScanAPI // to find the trashed emails
+	BatchEmailAPI
+}
+
+// ExpireEmailAPI defines set of API required to clean up an email deleted by its trash expiry
+type ExpireEmailAPI interface {
+	TransactWriteItemsAPI // to remove the email from the counters
+	UpdateItemAPI         // to release the blobs of the email
+	DeleteItemAPI
+	storage.S3HeadObjectAPI // to check the retention of the email
+	storage.S3DeleteObjectAPI
 }
 
 // UpdateItemAPI defines set of API required to update an email
@@ -53,35 +96,56 @@ type UpdateItemAPI interface {
 	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
 }
 
-// PutItemAPI defines set of API required to create an new email or replaces an existing email
-type PutItemAPI interface {
-	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+// UpdateCountedEmailAPI defines set of API required to update an email and the folder counters
+type UpdateCountedEmailAPI interface {
+	UpdateItemAPI
+	GetItemAPI            // to get the state of the email
+	TransactWriteItemsAPI // to update the email along with the counter updates
 }
 
-// SendEmailAPI defines set of API required to send a email
-type SendEmailAPI interface {
-	TransactWriteItemsAPI
-	SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+// ScanAPI defines set of API required to scan the table
+type ScanAPI interface {
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
 }
 
-// CreateAndSendEmailAPI defines set of API required to create an email and send it
-type CreateAndSendEmailAPI interface {
-	GetItemAPI
+// ListEmailsAPI defines set of API required to list emails, which are listed across months down to the oldest month with emails
+type ListEmailsAPI interface {
+	QueryAPI
+	GetItemAPI    // to get the oldest month with emails
+	ScanAPI       // to find the oldest month of emails stored before it's recorded
+	UpdateItemAPI // to record the oldest month
+}
+
+// ExpireBodiesAPI defines set of API required to remove the expired bodies of emails
+type ExpireBodiesAPI interface {
+	ScanAPI
+	UpdateItemAPI
+	DeleteItemAPI           // to release the blobs of the emails
+	storage.S3HeadObjectAPI // to check the retention of the emails
+	storage.S3DeleteObjectAPI
+}
+
+// RecountCountersAPI defines set of API required to recount the folder counters
+type RecountCountersAPI interface {
+	ScanAPI
 	PutItemAPI
-	SendEmailAPI
 }
 
-// SaveAndSendEmailAPI defines set of API required to save an email and send it
-type SaveAndSendEmailAPI interface {
-	GetItemAPI
+// PutItemAPI defines set of API required to create an new email or replaces an existing email
+type PutItemAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// CreateShareAPI defines set of API required to create a share link of an email
+type CreateShareAPI interface {
+	GetItemAPI // to check the email exists
 	PutItemAPI
-	SendEmailAPI
 }
 
-// GetAndSendEmailAPI defines set of API required to get and send a email
-type GetAndSendEmailAPI interface {
-	GetItemAPI
-	SendEmailAPI
+// FilterEmailAPI defines set of API required to filter a received email with the Sieve script
+type FilterEmailAPI interface {
+	GetItemAPI    // to get the script
+	UpdateItemAPI // to count the rules that fired
 }
 
 type QueryAndGetItemAPI interface {
@@ -89,10 +153,27 @@ type QueryAndGetItemAPI interface {
 	GetItemAPI
 }
 
+// BatchGetItemAPI defines set of API required to get multiple emails
+type BatchGetItemAPI interface {
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+}
+
 // GetThreadAPI defines set of API required to get a thread and its emails
 type GetThreadWithEmailsAPI interface {
 	GetItemAPI
-	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	BatchGetItemAPI
+}
+
+// ListThreadsAPI defines set of API required to list threads
+type ListThreadsAPI interface {
+	QueryAPI
+	BatchGetItemAPI // to get the unread status of emails
+}
+
+// SearchEmailsAPI defines set of API required to search emails
+type SearchEmailsAPI interface {
+	QueryAPI
+	BatchGetItemAPI // to get the body texts of emails, or the emails found by a search backend
 }
 
 type TransactWriteItemsAPI interface {
@@ -106,7 +187,62 @@ type StoreEmailAPI interface {
 	TransactWriteItemsAPI
 }
 
+// GetHeadersAPI defines set of API required to get the headers of an email
+type GetHeadersAPI interface {
+	GetItemAPI
+	storage.S3GetObjectAPI // fallback for emails without stored headers
+}
+
 type ReparseEmailAPI interface {
+	GetItemAPI // to get the location of the raw email
 	storage.S3GetObjectAPI
 	UpdateItemAPI
 }
+
+// RepairItemAPI defines set of API required to recompute the derived attributes of an email
+type RepairItemAPI interface {
+	ReparseEmailAPI
+	GetItemAPI // to get the email and its thread
+}
+
+// CreateAppWebhookAPI defines set of API required to register a webhook of a third-party app
+type CreateAppWebhookAPI interface {
+	GetItemAPI    // to count the webhooks of the app
+	UpdateItemAPI // to store the webhook
+}
+
+// CreateLabelAPI defines set of API required to define a label
+type CreateLabelAPI interface {
+	GetItemAPI    // to check the existing labels
+	UpdateItemAPI // to store the label
+}
+
+// CreateRuleAPI defines set of API required to add a filtering rule
+type CreateRuleAPI interface {
+	GetItemAPI    // to count the rules
+	UpdateItemAPI // to store the rule
+}
+
+// UpdateRuleAPI defines set of API required to replace a filtering rule
+type UpdateRuleAPI interface {
+	GetItemAPI    // to get the rule
+	UpdateItemAPI // to store the rule
+}
+
+// ReleaseBlobsAPI defines set of API required to release blobs, which deletes the blobs no longer referenced
+type ReleaseBlobsAPI interface {
+	UpdateItemAPI
+	DeleteItemAPI
+}
+
+// StoreBlobsAPI defines set of API required to store the large parts of a raw email as blobs
+type StoreBlobsAPI interface {
+	storage.S3GetObjectAPI
+	storage.S3PutObjectAPI
+	ReleaseBlobsAPI // to release the blobs if the raw email can't be replaced
+}
+
+// DeleteVacationAPI defines set of API required to delete the settings of automatic replies
+type DeleteVacationAPI interface {
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
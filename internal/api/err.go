@@ -9,12 +9,76 @@ var (
 	ErrNotFound      = errors.New("email not found")
 	ErrInvalidInput  = errors.New("invalid input")
 	ErrQueryNotMatch = errors.New("query does not match with next cursor")
+	// ErrInvalidView is returned when getting an email with a view that's not supported
+	ErrInvalidView = errors.New("invalid view")
 
 	// ErrReadActionFailed is returned when a read action or unread action fails
 	ErrReadActionFailed = errors.New("read action failed")
 
 	// ErrEmailIsNotDraft is returned when expected draft type is not met
 	ErrEmailIsNotDraft = errors.New("email type is not draft")
+
+	// ErrPartOfThread is returned when trying to delete an email that is part of a thread
+	ErrPartOfThread = errors.New("email is part of a thread")
+
+	// ErrSharingDisabled is returned when creating or opening share links without a signing key
+	ErrSharingDisabled = errors.New("sharing is not enabled")
+	// ErrShareNotFound is returned when a share link is invalid, or its email is deleted
+	ErrShareNotFound = errors.New("share link not found")
+	// ErrShareExpired is returned when a share link is expired or revoked
+	ErrShareExpired = errors.New("share link expired")
+
+	// ErrSieveScriptNotFound is returned when simulating the stored Sieve script, but there's none
+	ErrSieveScriptNotFound = errors.New("sieve script not found")
+
+	// ErrDeviceNotFound is returned when unregistering a device for push notifications that's not registered
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrTooManyDevices is returned when registering a device while the maximum number of devices are registered
+	ErrTooManyDevices = errors.New("too many devices")
+	// ErrSubscriptionNotFound is returned when removing a Web Push subscription that's not stored
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	// ErrTooManySubscriptions is returned when adding a Web Push subscription while the maximum number are stored
+	ErrTooManySubscriptions = errors.New("too many subscriptions")
+
+	// ErrForbidden is returned when a request has no caller identity to scope its resources to,
+	// or the caller isn't allowed to use the admin API
+	ErrForbidden = errors.New("forbidden")
+	// ErrWebhookNotFound is returned when deleting a webhook that doesn't exist or belongs to another caller
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrTooManyWebhooks is returned when creating a webhook while the maximum number of webhooks are registered
+	ErrTooManyWebhooks = errors.New("too many webhooks")
+
+	// ErrLabelNotFound is returned when updating or deleting a label that isn't defined
+	ErrLabelNotFound = errors.New("label not found")
+	// ErrLabelExists is returned when creating a label that's already defined
+	ErrLabelExists = errors.New("label already exists")
+	// ErrTooManyLabels is returned when creating a label while the maximum number of labels are defined
+	ErrTooManyLabels = errors.New("too many labels")
+
+	// ErrRuleNotFound is returned when updating or deleting a filtering rule that doesn't exist
+	ErrRuleNotFound = errors.New("rule not found")
+	// ErrTooManyRules is returned when creating a filtering rule while the maximum number of rules exist
+	ErrTooManyRules = errors.New("too many rules")
+
+	// ErrSenderNotFound is returned when removing a sender that isn't in the block or allow list
+	ErrSenderNotFound = errors.New("sender not found")
+	// ErrTooManySenders is returned when adding a sender to a block or allow list that has the maximum number of senders
+	ErrTooManySenders = errors.New("too many senders")
+
+	// ErrUploadNotFound is returned when sending an email whose uploaded attachment doesn't exist, e.g. as it expired
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrTooManyUploads is returned when uploading a file to a draft that has the maximum number of uploads
+	ErrTooManyUploads = errors.New("too many uploads")
+	// ErrUploadNotAllowed is returned when uploading an executable, a script or a macro-enabled document to a draft
+	ErrUploadNotAllowed = errors.New("file type is not allowed")
+
+	// ErrSendFailed is returned when sending a draft failed and it's marked failed, after retries of transient failures
+	ErrSendFailed = errors.New("email could not be sent")
+
+	// ErrIdempotencyKeyReused is returned when sending with an idempotency key that was used by a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key is used by a different request")
+	// ErrSendInProgress is returned when sending with an idempotency key whose request is still being sent
+	ErrSendInProgress = errors.New("request with the same idempotency key is in progress")
 )
 
 // NotTrashedError is returned when trying to delete or untrash an untrashed email/thread
@@ -49,3 +113,56 @@ func (e *AlreadyTrashedError) Is(target error) bool {
 	}
 	return e.Type == t.Type
 }
+
+// InvalidTransitionError is returned when an email can't move from its current lifecycle state to another,
+// e.g. when untrashing an email that is already purged
+type InvalidTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return "email can't move from " + e.From + " to " + e.To
+}
+
+// Is reports whether target is an InvalidTransitionError, whose empty fields match any state
+func (e *InvalidTransitionError) Is(target error) bool {
+	t, ok := target.(*InvalidTransitionError)
+	if !ok {
+		return false
+	}
+	return (t.From == "" || e.From == t.From) && (t.To == "" || e.To == t.To)
+}
+
+// ScanError is returned when downloading a file of an email whose virus scan didn't pass
+type ScanError struct {
+	State string // scan state of the email, infected or pending
+}
+
+func (e *ScanError) Error() string {
+	return "attachment scan is " + e.State
+}
+
+// Is reports whether target is a ScanError, regardless of the scan state
+func (e *ScanError) Is(target error) bool {
+	_, ok := target.(*ScanError)
+	return ok
+}
+
+// RetentionError is returned when deleting an email whose raw message is protected by S3 Object Lock
+type RetentionError struct {
+	Until string // RFC 3339 time when the retention expires, empty if the email is under legal hold
+}
+
+func (e *RetentionError) Error() string {
+	if e.Until == "" {
+		return "email is under legal hold"
+	}
+	return "email is retained until " + e.Until
+}
+
+// Is reports whether target is a RetentionError, regardless of when the retention expires
+func (e *RetentionError) Is(target error) bool {
+	_, ok := target.(*RetentionError)
+	return ok
+}
@@ -0,0 +1,67 @@
+package attachment
+
+import (
+	"mime"
+	"strings"
+	"unicode"
+
+	"github.com/harryzcy/mailbox/internal/types"
+)
+
+const maxFilenameLength = 255
+
+// preferredExtensions are the extensions of common content types, where mime.ExtensionsByType returns several
+var preferredExtensions = map[string]string{
+	"application/pdf": ".pdf",
+	"application/zip": ".zip",
+	"image/gif":       ".gif",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"message/rfc822":  ".eml",
+	"text/calendar":   ".ics",
+	"text/html":       ".html",
+	"text/plain":      ".txt",
+}
+
+// Filename returns the name that a file is downloaded as, which is its decoded filename without directories
+// and control characters. Files without a usable filename are named after their content type, e.g. attachment.pdf.
+func Filename(file types.File) string {
+	name := strings.ReplaceAll(file.Filename, "\\", "/")
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name != "" {
+		return truncateFilename(name)
+	}
+	return "attachment" + extension(file.ContentType)
+}
+
+// extension returns the extension of a content type, or an empty string if it's unknown
+func extension(contentType string) string {
+	contentType = strings.ToLower(contentType)
+	if ext, ok := preferredExtensions[contentType]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// truncateFilename shortens a filename to maxFilenameLength bytes, keeping its extension
+func truncateFilename(name string) string {
+	if len(name) <= maxFilenameLength {
+		return name
+	}
+	ext := ""
+	if i := strings.LastIndex(name, "."); i > 0 && len(name)-i <= 16 {
+		ext = name[i:]
+	}
+	// a rune cut in the middle is dropped
+	return strings.ToValidUTF8(name[:maxFilenameLength-len(ext)], "") + ext
+}
@@ -0,0 +1,41 @@
+package attachment
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilename(t *testing.T) {
+	tests := []struct {
+		file     types.File
+		expected string
+	}{
+		{types.File{Filename: "report.pdf", ContentType: "application/pdf"}, "report.pdf"},
+		{types.File{Filename: "Résumé 2024.docx"}, "Résumé 2024.docx"},
+		{types.File{Filename: "../../etc/passwd"}, "passwd"},
+		{types.File{Filename: `C:\Users\alice\notes.txt`}, "notes.txt"},
+		{types.File{Filename: "in\r\nvoice.pdf"}, "invoice.pdf"},
+		{types.File{Filename: "  ..  ", ContentType: "image/png"}, "attachment.png"},
+		{types.File{ContentType: "application/pdf"}, "attachment.pdf"},
+		{types.File{ContentType: "image/jpeg"}, "attachment.jpg"},
+		{types.File{ContentType: "Text/Plain"}, "attachment.txt"},
+		{types.File{ContentType: "application/x-unknown"}, "attachment"},
+		{types.File{}, "attachment"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, Filename(test.file))
+		})
+	}
+}
+
+func TestFilename_Long(t *testing.T) {
+	name := Filename(types.File{Filename: strings.Repeat("é", 200) + ".pdf"})
+	assert.LessOrEqual(t, len(name), maxFilenameLength)
+	assert.True(t, strings.HasSuffix(name, "é.pdf"))
+}
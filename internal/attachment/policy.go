@@ -0,0 +1,170 @@
+package attachment
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/harryzcy/mailbox/internal/util/sniff"
+)
+
+// Policy is the action taken on dangerous attachments when an email is received
+type Policy string
+
+const (
+	PolicyAllow      Policy = "allow"      // keep dangerous attachments as is
+	PolicyStrip      Policy = "strip"      // keep the email, but never serve dangerous attachments
+	PolicyQuarantine Policy = "quarantine" // keep the email, but only serve dangerous attachments when explicitly released
+	PolicyBlock      Policy = "block"      // don't store emails with dangerous attachments
+)
+
+// Values of File.Policy for attachments affected by a policy
+const (
+	StateStripped    = "stripped"
+	StateQuarantined = "quarantined"
+)
+
+var (
+	ErrStripped    = errors.New("attachment removed by the attachment policy")
+	ErrQuarantined = errors.New("attachment quarantined by the attachment policy")
+)
+
+// ParsePolicy parses the configured policy. Empty or unknown values fall back to PolicyAllow.
+func ParsePolicy(s string) Policy {
+	switch policy := Policy(strings.ToLower(strings.TrimSpace(s))); policy {
+	case PolicyAllow, PolicyStrip, PolicyQuarantine, PolicyBlock:
+		return policy
+	case "":
+		return PolicyAllow
+	default:
+		fmt.Printf("unknown attachment policy %q, falling back to %s\n", s, PolicyAllow)
+		return PolicyAllow
+	}
+}
+
+// dangerousExtensions are executables, scripts and macro-enabled Office documents
+var dangerousExtensions = map[string]bool{
+	// executables and installers
+	".exe": true, ".com": true, ".scr": true, ".pif": true, ".cpl": true, ".dll": true,
+	".msi": true, ".msp": true, ".jar": true, ".apk": true, ".app": true,
+	// scripts
+	".bat": true, ".cmd": true, ".js": true, ".jse": true, ".vbs": true, ".vbe": true,
+	".wsf": true, ".wsh": true, ".hta": true, ".ps1": true, ".psm1": true, ".sh": true,
+	".lnk": true, ".reg": true, ".scf": true, ".inf": true,
+	// macro-enabled Office documents
+	".docm": true, ".dotm": true, ".xlsm": true, ".xltm": true, ".xlam": true,
+	".pptm": true, ".potm": true, ".ppsm": true, ".ppam": true, ".sldm": true,
+}
+
+// IsDangerous reports whether a file is an executable, a script or a macro-enabled Office document,
+// judging by its filename, its declared content type and the content type detected from its content
+func IsDangerous(file types.File) bool {
+	if dangerousExtensions[strings.ToLower(filepath.Ext(file.Filename))] {
+		return true
+	}
+	if mediaType, _, err := mime.ParseMediaType(file.ContentType); err == nil {
+		mediaType = strings.ToLower(mediaType)
+		if sniff.IsExecutable(mediaType) || strings.Contains(mediaType, "macroenabled") ||
+			mediaType == "application/javascript" || mediaType == "text/javascript" ||
+			mediaType == "application/x-javascript" || mediaType == "text/vbscript" ||
+			mediaType == "application/hta" || mediaType == "application/x-ms-shortcut" {
+			return true
+		}
+	}
+	return sniff.IsExecutable(file.DetectedContentType)
+}
+
+// State returns the value of File.Policy for a dangerous file under the policy,
+// or an empty string if the file is served as is
+func (p Policy) State() string {
+	switch p {
+	case PolicyStrip:
+		return StateStripped
+	case PolicyQuarantine:
+		return StateQuarantined
+	}
+	return ""
+}
+
+// Enforce marks dangerous files with the state of the policy, and returns their filenames.
+// Files are marked for PolicyBlock as well, since the caller decides whether to store the email.
+func Enforce(policy Policy, files types.Files) []string {
+	if policy == PolicyAllow {
+		return nil
+	}
+
+	var names []string
+	for i := range files {
+		if !IsDangerous(files[i]) {
+			continue
+		}
+		files[i].Policy = policy.State()
+		names = append(names, displayName(files[i]))
+	}
+	return names
+}
+
+// Note returns a placeholder note for attachments removed or quarantined by the policy
+func Note(policy Policy, names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	verb := "removed"
+	if policy == PolicyQuarantine {
+		verb = "quarantined"
+	}
+	noun := "Attachment"
+	if len(names) > 1 {
+		noun = "Attachments"
+	}
+	return fmt.Sprintf("[%s %s %s by the attachment policy]", noun, strings.Join(quoted, ", "), verb)
+}
+
+// AppendNote appends the placeholder note to the text and HTML bodies. Empty bodies are left empty,
+// except that the note is used as the text body if neither body exists.
+func AppendNote(text, htmlBody, note string) (string, string) {
+	if note == "" {
+		return text, htmlBody
+	}
+	if htmlBody != "" {
+		htmlBody += "\n<p>" + html.EscapeString(note) + "</p>"
+	}
+	if text != "" || htmlBody == "" {
+		if text != "" {
+			text += "\n\n"
+		}
+		text += note
+	}
+	return text, htmlBody
+}
+
+// CheckServable returns an error if the file must not be served under the policy.
+// Quarantined files are only served when released.
+func CheckServable(policy Policy, file types.File, release bool) error {
+	if policy == PolicyAllow || !IsDangerous(file) {
+		return nil
+	}
+	if policy == PolicyQuarantine {
+		if release {
+			return nil
+		}
+		return ErrQuarantined
+	}
+	return ErrStripped
+}
+
+func displayName(file types.File) string {
+	if file.Filename != "" {
+		return file.Filename
+	}
+	return file.ContentID
+}
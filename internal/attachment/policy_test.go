@@ -0,0 +1,152 @@
+package attachment
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Policy
+	}{
+		{"", PolicyAllow},
+		{"allow", PolicyAllow},
+		{"strip", PolicyStrip},
+		{" Quarantine ", PolicyQuarantine},
+		{"BLOCK", PolicyBlock},
+		{"reject", PolicyAllow},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, ParsePolicy(test.input))
+		})
+	}
+}
+
+func TestIsDangerous(t *testing.T) {
+	tests := []struct {
+		file     types.File
+		expected bool
+	}{
+		{types.File{Filename: "report.pdf", ContentType: "application/pdf"}, false},
+		{types.File{Filename: "photo.jpg", ContentType: "image/jpeg", DetectedContentType: "image/jpeg"}, false},
+		{types.File{Filename: "setup.EXE", ContentType: "application/octet-stream"}, true},
+		{types.File{Filename: "invoice.js", ContentType: "text/plain"}, true},
+		{types.File{Filename: "run.vbs"}, true},
+		{types.File{Filename: "budget.xlsm"}, true},
+		{types.File{Filename: "doc", ContentType: "application/vnd.ms-word.document.macroEnabled.12"}, true},
+		{types.File{Filename: "script", ContentType: "application/javascript; charset=utf-8"}, true},
+		{types.File{Filename: "invoice.pdf", ContentType: "application/pdf", DetectedContentType: "application/x-msdownload"}, true},
+		{types.File{Filename: "notes.docx", ContentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"}, false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, IsDangerous(test.file))
+		})
+	}
+}
+
+func TestEnforce(t *testing.T) {
+	newFiles := func() types.Files {
+		return types.Files{
+			{ContentID: "1", Filename: "report.pdf", ContentType: "application/pdf"},
+			{ContentID: "2", Filename: "setup.exe", ContentType: "application/octet-stream"},
+			{ContentID: "3", ContentType: "application/javascript"},
+		}
+	}
+
+	tests := []struct {
+		policy   Policy
+		names    []string
+		expected []string
+	}{
+		{PolicyAllow, nil, []string{"", "", ""}},
+		{PolicyStrip, []string{"setup.exe", "3"}, []string{"", StateStripped, StateStripped}},
+		{PolicyQuarantine, []string{"setup.exe", "3"}, []string{"", StateQuarantined, StateQuarantined}},
+		{PolicyBlock, []string{"setup.exe", "3"}, []string{"", "", ""}},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			files := newFiles()
+			names := Enforce(test.policy, files)
+			assert.Equal(t, test.names, names)
+			for j, file := range files {
+				assert.Equal(t, test.expected[j], file.Policy)
+			}
+		})
+	}
+}
+
+func TestNote(t *testing.T) {
+	assert.Equal(t, "", Note(PolicyStrip, nil))
+	assert.Equal(t, `[Attachment "a.exe" removed by the attachment policy]`, Note(PolicyStrip, []string{"a.exe"}))
+	assert.Equal(t, `[Attachments "a.exe", "b.js" quarantined by the attachment policy]`,
+		Note(PolicyQuarantine, []string{"a.exe", "b.js"}))
+}
+
+func TestAppendNote(t *testing.T) {
+	tests := []struct {
+		text, html, note           string
+		expectedText, expectedHTML string
+	}{
+		{"hello", "<p>hello</p>", "", "hello", "<p>hello</p>"},
+		{"hello", "<p>hello</p>", `[Attachment "<a>.exe"]`, "hello\n\n[Attachment \"<a>.exe\"]", "<p>hello</p>\n<p>[Attachment &#34;&lt;a&gt;.exe&#34;]</p>"},
+		{"", "<p>hello</p>", "[note]", "", "<p>hello</p>\n<p>[note]</p>"},
+		{"", "", "[note]", "[note]", ""},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			text, html := AppendNote(test.text, test.html, test.note)
+			assert.Equal(t, test.expectedText, text)
+			assert.Equal(t, test.expectedHTML, html)
+		})
+	}
+}
+
+func TestCheckServable(t *testing.T) {
+	safe := types.File{Filename: "report.pdf", ContentType: "application/pdf"}
+	dangerous := types.File{Filename: "setup.exe"}
+
+	tests := []struct {
+		policy   Policy
+		file     types.File
+		release  bool
+		expected error
+	}{
+		{PolicyAllow, dangerous, false, nil},
+		{PolicyStrip, safe, false, nil},
+		{PolicyStrip, dangerous, false, ErrStripped},
+		{PolicyStrip, dangerous, true, ErrStripped},
+		{PolicyBlock, dangerous, false, ErrStripped},
+		{PolicyQuarantine, dangerous, false, ErrQuarantined},
+		{PolicyQuarantine, dangerous, true, nil},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, CheckServable(test.policy, test.file, test.release))
+		})
+	}
+}
+
+func BenchmarkEnforce(b *testing.B) {
+	names := []string{"report.pdf", "photo.png", "invoice.pdf.exe", "macro.docm", "notes.txt", "setup.js"}
+	files := make(types.Files, 120)
+	for i := range files {
+		name := names[i%len(names)]
+		files[i] = types.File{Filename: name, ContentType: "application/octet-stream", DetectedContentType: "application/octet-stream"}
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Enforce(PolicyQuarantine, files)
+	}
+}
@@ -0,0 +1,62 @@
+package attachment
+
+import (
+	"archive/zip"
+	"bytes"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/harryzcy/mailbox/internal/types"
+)
+
+// MaxZipEntries is the maximum number of entries kept in a zip manifest, to keep items small
+const MaxZipEntries = 100
+
+var zipMediaTypes = map[string]bool{
+	"application/zip":              true,
+	"application/x-zip":            true,
+	"application/x-zip-compressed": true,
+}
+
+// IsZip reports whether a file is a zip archive.
+// Formats stored as zip archives, such as Office documents, are not considered zip archives.
+func IsZip(file types.File) bool {
+	if file.DetectedContentType != "application/zip" {
+		return false
+	}
+	if strings.EqualFold(path.Ext(file.Filename), ".zip") {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(file.ContentType)
+	return err == nil && zipMediaTypes[strings.ToLower(mediaType)]
+}
+
+// InspectZip lists the entries of a zip archive. Only the central directory is read,
+// so encrypted archives can be inspected and no file is decompressed.
+func InspectZip(content []byte) (*types.ZipManifest, error) {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &types.ZipManifest{
+		Entries:      make([]types.ZipEntry, 0, min(len(reader.File), MaxZipEntries)),
+		TotalEntries: len(reader.File),
+	}
+	for _, file := range reader.File {
+		entry := types.ZipEntry{
+			Name:           file.Name,
+			Size:           file.UncompressedSize64,
+			CompressedSize: file.CompressedSize64,
+			Encrypted:      file.Flags&0x1 != 0, // bit 0 of the general purpose flag
+			Executable:     !file.FileInfo().IsDir() && dangerousExtensions[strings.ToLower(path.Ext(file.Name))],
+		}
+		manifest.Encrypted = manifest.Encrypted || entry.Encrypted
+		manifest.NestedExecutable = manifest.NestedExecutable || entry.Executable
+		if len(manifest.Entries) < MaxZipEntries {
+			manifest.Entries = append(manifest.Entries, entry)
+		}
+	}
+	return manifest, nil
+}
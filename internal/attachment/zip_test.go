@@ -0,0 +1,116 @@
+package attachment
+
+import (
+	"archive/zip"
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsZip(t *testing.T) {
+	tests := []struct {
+		file     types.File
+		expected bool
+	}{
+		{types.File{Filename: "files.zip", ContentType: "application/octet-stream", DetectedContentType: "application/zip"}, true},
+		{types.File{Filename: "files", ContentType: "application/x-zip-compressed", DetectedContentType: "application/zip"}, true},
+		{types.File{Filename: "notes.docx", ContentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", DetectedContentType: "application/zip"}, false},
+		{types.File{Filename: "files.zip", ContentType: "application/zip", DetectedContentType: "text/plain"}, false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, IsZip(test.file))
+		})
+	}
+}
+
+type zipFile struct {
+	name      string
+	content   string
+	encrypted bool
+}
+
+func newZip(t *testing.T, files []zipFile) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, file := range files {
+		header := &zip.FileHeader{Name: file.name, Method: zip.Store}
+		if file.encrypted {
+			header.Flags |= 0x1
+		}
+		w, err := writer.CreateHeader(header)
+		assert.Nil(t, err)
+		_, err = w.Write([]byte(file.content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestInspectZip(t *testing.T) {
+	tests := []struct {
+		files    []zipFile
+		expected *types.ZipManifest
+	}{
+		{
+			files: []zipFile{
+				{name: "docs/", content: ""},
+				{name: "docs/readme.txt", content: "hello"},
+			},
+			expected: &types.ZipManifest{
+				Entries: []types.ZipEntry{
+					{Name: "docs/"},
+					{Name: "docs/readme.txt", Size: 5, CompressedSize: 5},
+				},
+				TotalEntries: 2,
+			},
+		},
+		{
+			files: []zipFile{
+				{name: "invoice.pdf.exe", content: "MZ"},
+				{name: "secret.txt", content: "data", encrypted: true},
+			},
+			expected: &types.ZipManifest{
+				Entries: []types.ZipEntry{
+					{Name: "invoice.pdf.exe", Size: 2, CompressedSize: 2, Executable: true},
+					{Name: "secret.txt", Size: 4, CompressedSize: 4, Encrypted: true},
+				},
+				TotalEntries:     2,
+				Encrypted:        true,
+				NestedExecutable: true,
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			manifest, err := InspectZip(newZip(t, test.files))
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, manifest)
+		})
+	}
+}
+
+func TestInspectZip_TooManyEntries(t *testing.T) {
+	files := make([]zipFile, MaxZipEntries+1)
+	for i := range files {
+		files[i] = zipFile{name: strconv.Itoa(i) + ".txt"}
+	}
+	files[MaxZipEntries] = zipFile{name: "last.js"}
+
+	manifest, err := InspectZip(newZip(t, files))
+	assert.Nil(t, err)
+	assert.Len(t, manifest.Entries, MaxZipEntries)
+	assert.Equal(t, MaxZipEntries+1, manifest.TotalEntries)
+	assert.True(t, manifest.NestedExecutable)
+}
+
+func TestInspectZip_Invalid(t *testing.T) {
+	manifest, err := InspectZip([]byte("not a zip"))
+	assert.Error(t, err)
+	assert.Nil(t, manifest)
+}
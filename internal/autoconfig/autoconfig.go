@@ -0,0 +1,247 @@
+// Package autoconfig generates the configuration that mail clients discover automatically,
+// in the Mozilla autoconfig and Microsoft autodiscover formats, for the servers speaking mail protocols.
+package autoconfig
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Server types
+const (
+	TypeIMAP = "imap"
+	TypePOP3 = "pop3"
+	TypeSMTP = "smtp"
+)
+
+// Socket types, which are decided by the port
+const (
+	SocketSSL      = "SSL"      // TLS from the start of the connection
+	SocketSTARTTLS = "STARTTLS" // upgraded to TLS by the STARTTLS command
+)
+
+// implicitTLSPorts are the ports of IMAPS, POP3S and SMTPS (RFC 8314)
+var implicitTLSPorts = map[int]bool{993: true, 995: true, 465: true}
+
+// Server is a server that mail clients connect to
+type Server struct {
+	Type       string
+	Hostname   string
+	Port       int
+	SocketType string
+}
+
+// ServersFromEnv returns the servers configured by AUTOCONFIG_IMAP_SERVER, AUTOCONFIG_POP3_SERVER and AUTOCONFIG_SMTP_SERVER,
+// where incoming servers are in the order of preference
+func ServersFromEnv() ([]Server, error) {
+	configs := []struct {
+		serverType string
+		address    string
+	}{
+		{TypeIMAP, env.AutoconfigIMAPServer},
+		{TypePOP3, env.AutoconfigPOP3Server},
+		{TypeSMTP, env.AutoconfigSMTPServer},
+	}
+
+	var servers []Server
+	for _, config := range configs {
+		if config.address == "" {
+			continue
+		}
+		server, err := parseServer(config.serverType, config.address)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// parseServer parses a server address in the form of host:port
+func parseServer(serverType, address string) (Server, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return Server{}, fmt.Errorf("invalid %s server %q: %w", serverType, address, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 || host == "" {
+		return Server{}, fmt.Errorf("invalid %s server %q", serverType, address)
+	}
+
+	socketType := SocketSTARTTLS
+	if implicitTLSPorts[port] {
+		socketType = SocketSSL
+	}
+	return Server{Type: serverType, Hostname: host, Port: port, SocketType: socketType}, nil
+}
+
+// parseAddress returns the email address and its domain, or api.ErrInvalidInput if it's invalid
+func parseAddress(address string) (string, string, error) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != strings.TrimSpace(address) {
+		return "", "", api.ErrInvalidInput
+	}
+	_, domain, _ := strings.Cut(parsed.Address, "@")
+	return parsed.Address, strings.ToLower(domain), nil
+}
+
+// clientConfig is the Mozilla autoconfig format,
+// see https://wiki.mozilla.org/Thunderbird:Autoconfiguration:ConfigFileFormat
+type clientConfig struct {
+	XMLName       xml.Name      `xml:"clientConfig"`
+	Version       string        `xml:"version,attr"`
+	EmailProvider emailProvider `xml:"emailProvider"`
+}
+
+type emailProvider struct {
+	ID              string         `xml:"id,attr"`
+	Domain          string         `xml:"domain"`
+	DisplayName     string         `xml:"displayName"`
+	IncomingServers []serverConfig `xml:"incomingServer"`
+	OutgoingServers []serverConfig `xml:"outgoingServer"`
+}
+
+type serverConfig struct {
+	Type           string `xml:"type,attr"`
+	Hostname       string `xml:"hostname"`
+	Port           int    `xml:"port"`
+	SocketType     string `xml:"socketType"`
+	Username       string `xml:"username"`
+	Authentication string `xml:"authentication"`
+}
+
+// Mozilla returns the autoconfig XML of an email address, or api.ErrNotFound if no server is configured
+func Mozilla(address string, servers []Server) ([]byte, error) {
+	if len(servers) == 0 {
+		return nil, api.ErrNotFound
+	}
+	_, domain, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	config := clientConfig{
+		Version: "1.1",
+		EmailProvider: emailProvider{
+			ID:          domain,
+			Domain:      domain,
+			DisplayName: domain,
+		},
+	}
+	for _, server := range servers {
+		s := serverConfig{
+			Type:           server.Type,
+			Hostname:       server.Hostname,
+			Port:           server.Port,
+			SocketType:     server.SocketType,
+			Username:       "%EMAILADDRESS%",
+			Authentication: "password-cleartext",
+		}
+		if server.Type == TypeSMTP {
+			config.EmailProvider.OutgoingServers = append(config.EmailProvider.OutgoingServers, s)
+		} else {
+			config.EmailProvider.IncomingServers = append(config.EmailProvider.IncomingServers, s)
+		}
+	}
+	return marshal(config)
+}
+
+// Namespaces of the autodiscover schema used by Outlook,
+// see https://learn.microsoft.com/en-us/exchange/client-developer/web-service-reference/pox-autodiscover-request-for-exchange
+const (
+	autodiscoverResponseSchema = "http://schemas.microsoft.com/exchange/autodiscover/outlook/responseschema/2006a"
+	autodiscoverSchema         = "http://schemas.microsoft.com/exchange/autodiscover/responseschema/2006"
+)
+
+type autodiscoverRequest struct {
+	XMLName      xml.Name `xml:"Autodiscover"`
+	EMailAddress string   `xml:"Request>EMailAddress"`
+}
+
+type autodiscoverResponse struct {
+	XMLName  xml.Name             `xml:"Autodiscover"`
+	Xmlns    string               `xml:"xmlns,attr"`
+	Response autodiscoverAccounts `xml:"Response"`
+}
+
+type autodiscoverAccounts struct {
+	Xmlns   string              `xml:"xmlns,attr"`
+	Account autodiscoverAccount `xml:"Account"`
+}
+
+type autodiscoverAccount struct {
+	AccountType string                 `xml:"AccountType"`
+	Action      string                 `xml:"Action"`
+	Protocols   []autodiscoverProtocol `xml:"Protocol"`
+}
+
+type autodiscoverProtocol struct {
+	Type           string `xml:"Type"`
+	Server         string `xml:"Server"`
+	Port           int    `xml:"Port"`
+	LoginName      string `xml:"LoginName"`
+	DomainRequired string `xml:"DomainRequired"`
+	SPA            string `xml:"SPA"`
+	SSL            string `xml:"SSL"`
+	Encryption     string `xml:"Encryption,omitempty"`
+	AuthRequired   string `xml:"AuthRequired"`
+}
+
+// Autodiscover returns the autodiscover response to a POX request body,
+// or api.ErrNotFound if no server is configured
+func Autodiscover(body []byte, servers []Server) ([]byte, error) {
+	if len(servers) == 0 {
+		return nil, api.ErrNotFound
+	}
+	var req autodiscoverRequest
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return nil, api.ErrInvalidInput
+	}
+	address, _, err := parseAddress(req.EMailAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := autodiscoverResponse{
+		Xmlns: autodiscoverSchema,
+		Response: autodiscoverAccounts{
+			Xmlns: autodiscoverResponseSchema,
+			Account: autodiscoverAccount{
+				AccountType: "email",
+				Action:      "settings",
+			},
+		},
+	}
+	for _, server := range servers {
+		protocol := autodiscoverProtocol{
+			Type:           strings.ToUpper(server.Type),
+			Server:         server.Hostname,
+			Port:           server.Port,
+			LoginName:      address,
+			DomainRequired: "off",
+			SPA:            "off",
+			SSL:            "on",
+			AuthRequired:   "on",
+		}
+		if server.SocketType == SocketSTARTTLS {
+			protocol.Encryption = "TLS"
+		}
+		resp.Response.Account.Protocols = append(resp.Response.Account.Protocols, protocol)
+	}
+	return marshal(resp)
+}
+
+func marshal(v any) ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
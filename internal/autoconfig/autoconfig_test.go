@@ -0,0 +1,132 @@
+package autoconfig
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+var testServers = []Server{
+	{Type: TypePOP3, Hostname: "mail.example.com", Port: 995, SocketType: SocketSSL},
+	{Type: TypeSMTP, Hostname: "mail.example.com", Port: 587, SocketType: SocketSTARTTLS},
+}
+
+func TestServersFromEnv(t *testing.T) {
+	tests := []struct {
+		imap, pop3, smtp string
+		expected         []Server
+		expectedErr      bool
+	}{
+		{},
+		{pop3: "mail.example.com:995", smtp: "mail.example.com:587", expected: testServers},
+		{
+			imap: "imap.example.com:993",
+			expected: []Server{
+				{Type: TypeIMAP, Hostname: "imap.example.com", Port: 993, SocketType: SocketSSL},
+			},
+		},
+		{pop3: "mail.example.com", expectedErr: true},
+		{smtp: "mail.example.com:smtp", expectedErr: true},
+		{imap: ":993", expectedErr: true},
+	}
+
+	defer func() {
+		env.AutoconfigIMAPServer, env.AutoconfigPOP3Server, env.AutoconfigSMTPServer = "", "", ""
+	}()
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.AutoconfigIMAPServer, env.AutoconfigPOP3Server, env.AutoconfigSMTPServer = test.imap, test.pop3, test.smtp
+			servers, err := ServersFromEnv()
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, servers)
+		})
+	}
+}
+
+func TestMozilla(t *testing.T) {
+	data, err := Mozilla("alice@Example.com", testServers)
+	assert.Nil(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<clientConfig version="1.1">
+  <emailProvider id="example.com">
+    <domain>example.com</domain>
+    <displayName>example.com</displayName>
+    <incomingServer type="pop3">
+      <hostname>mail.example.com</hostname>
+      <port>995</port>
+      <socketType>SSL</socketType>
+      <username>%EMAILADDRESS%</username>
+      <authentication>password-cleartext</authentication>
+    </incomingServer>
+    <outgoingServer type="smtp">
+      <hostname>mail.example.com</hostname>
+      <port>587</port>
+      <socketType>STARTTLS</socketType>
+      <username>%EMAILADDRESS%</username>
+      <authentication>password-cleartext</authentication>
+    </outgoingServer>
+  </emailProvider>
+</clientConfig>`, string(data))
+
+	_, err = Mozilla("not an address", testServers)
+	assert.Equal(t, api.ErrInvalidInput, err)
+	_, err = Mozilla("Alice <alice@example.com>", testServers)
+	assert.Equal(t, api.ErrInvalidInput, err)
+	_, err = Mozilla("alice@example.com", nil)
+	assert.Equal(t, api.ErrNotFound, err)
+}
+
+func TestAutodiscover(t *testing.T) {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<Autodiscover xmlns="http://schemas.microsoft.com/exchange/autodiscover/outlook/requestschema/2006">
+  <Request>
+    <EMailAddress>alice@example.com</EMailAddress>
+    <AcceptableResponseSchema>http://schemas.microsoft.com/exchange/autodiscover/outlook/responseschema/2006a</AcceptableResponseSchema>
+  </Request>
+</Autodiscover>`
+
+	data, err := Autodiscover([]byte(body), testServers)
+	assert.Nil(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<Autodiscover xmlns="http://schemas.microsoft.com/exchange/autodiscover/responseschema/2006">
+  <Response xmlns="http://schemas.microsoft.com/exchange/autodiscover/outlook/responseschema/2006a">
+    <Account>
+      <AccountType>email</AccountType>
+      <Action>settings</Action>
+      <Protocol>
+        <Type>POP3</Type>
+        <Server>mail.example.com</Server>
+        <Port>995</Port>
+        <LoginName>alice@example.com</LoginName>
+        <DomainRequired>off</DomainRequired>
+        <SPA>off</SPA>
+        <SSL>on</SSL>
+        <AuthRequired>on</AuthRequired>
+      </Protocol>
+      <Protocol>
+        <Type>SMTP</Type>
+        <Server>mail.example.com</Server>
+        <Port>587</Port>
+        <LoginName>alice@example.com</LoginName>
+        <DomainRequired>off</DomainRequired>
+        <SPA>off</SPA>
+        <SSL>on</SSL>
+        <Encryption>TLS</Encryption>
+        <AuthRequired>on</AuthRequired>
+      </Protocol>
+    </Account>
+  </Response>
+</Autodiscover>`, string(data))
+
+	_, err = Autodiscover([]byte("<Autodiscover>"), testServers)
+	assert.Equal(t, api.ErrInvalidInput, err)
+	_, err = Autodiscover([]byte("<Autodiscover><Request></Request></Autodiscover>"), testServers)
+	assert.Equal(t, api.ErrInvalidInput, err)
+}
@@ -0,0 +1,222 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/env"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+)
+
+// itemPrefix is the prefix of the MessageID of the items counting the references to blobs, which are stored in the email table
+const itemPrefix = "blob#"
+
+// Enabled returns whether large attachments of received emails are stored as blobs
+func Enabled() bool {
+	return env.AttachmentDedup == "true"
+}
+
+// Store moves the encoded bodies of the large parts of the raw email at location into blobs keyed by their SHA-256,
+// so that a part received in several emails is stored once. Each email holds a reference to each of its blobs.
+// The hashes of the blobs are returned, which must be released when the email is deleted.
+// Storing an email again returns its blobs without adding references.
+func Store(ctx context.Context, client api.StoreBlobsAPI, location storage.Location, files mailboxTypes.Files) ([]string, error) {
+	object, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &location.Bucket,
+		Key:    &location.Key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+
+	refs, err := storage.BlobRefs(object.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) > 0 {
+		return hashesOf(refs), nil
+	}
+	raw, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired []string
+	refs = []storage.BlobRef{}
+	for _, file := range largeParts(files, int64(len(raw))) {
+		content := raw[file.Offset : file.Offset+file.Length]
+		sum := sha256.Sum256(content)
+		ref := storage.BlobRef{Offset: file.Offset, Length: file.Length, Hash: hex.EncodeToString(sum[:])}
+
+		if !contains(acquired, ref.Hash) {
+			ok, err := acquire(ctx, client, ref.Hash, ref.Length)
+			if err != nil {
+				return nil, errors.Join(err, Release(ctx, client, acquired))
+			}
+			if !ok {
+				// the blob is being deleted, the part stays in the email
+				continue
+			}
+			acquired = append(acquired, ref.Hash)
+			if err := storage.PutBlob(ctx, client, ref.Hash, content); err != nil {
+				return nil, errors.Join(err, Release(ctx, client, acquired))
+			}
+		}
+		refs = append(refs, ref)
+	}
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	err = storage.PutEmailStub(ctx, client, location, raw, refs)
+	if err != nil {
+		return nil, errors.Join(err, Release(ctx, client, acquired))
+	}
+	return acquired, nil
+}
+
+// Release removes the references of an email to blobs, and deletes the blobs no longer referenced
+func Release(ctx context.Context, client api.ReleaseBlobsAPI, hashes []string) error {
+	var errs []error
+	for _, hash := range hashes {
+		if err := release(ctx, client, hash); err != nil {
+			errs = append(errs, fmt.Errorf("blob %s: %w", hash, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func release(ctx context.Context, client api.ReleaseBlobsAPI, hash string) error {
+	key := map[string]types.AttributeValue{
+		"MessageID": &types.AttributeValueMemberS{Value: itemPrefix + hash},
+	}
+	output, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(env.TableName),
+		Key:                 key,
+		UpdateExpression:    aws.String("ADD Refs :minus_one"),
+		ConditionExpression: aws.String("attribute_exists(Refs)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":minus_one": &types.AttributeValueMemberN{Value: "-1"},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return nil // already deleted
+		}
+		return err
+	}
+	if refs, ok := output.Attributes["Refs"].(*types.AttributeValueMemberN); ok {
+		if n, err := strconv.ParseInt(refs.Value, 10, 64); err == nil && n > 0 {
+			return nil
+		}
+	}
+
+	// stop new references before deleting the blob
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(env.TableName),
+		Key:                 key,
+		UpdateExpression:    aws.String("SET Deleting = :true"),
+		ConditionExpression: aws.String("Refs <= :zero AND attribute_not_exists(Deleting)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":true": &types.AttributeValueMemberBOOL{Value: true},
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return nil // referenced again, or being deleted by another email
+		}
+		return err
+	}
+
+	if err := storage.DeleteBlob(ctx, client, hash); err != nil {
+		return err
+	}
+	_, err = client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(env.TableName),
+		Key:       key,
+	})
+	return err
+}
+
+// acquire adds a reference to a blob. ok is false if the blob is being deleted and can't be referenced.
+func acquire(ctx context.Context, client api.UpdateItemAPI, hash string, size int64) (ok bool, err error) {
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: itemPrefix + hash},
+		},
+		UpdateExpression:    aws.String("ADD Refs :one SET #size = :size"),
+		ConditionExpression: aws.String("attribute_not_exists(Deleting)"),
+		ExpressionAttributeNames: map[string]string{
+			"#size": "Size", // reserved word
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one":  &types.AttributeValueMemberN{Value: "1"},
+			":size": &types.AttributeValueMemberN{Value: strconv.FormatInt(size, 10)},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// largeParts returns the parts whose bodies are not buffered when parsing, sorted by offset,
+// without overlapping parts and parts outside of the email of size bytes
+func largeParts(files mailboxTypes.Files, size int64) []mailboxTypes.File {
+	parts := []mailboxTypes.File{}
+	for _, file := range files {
+		if file.Length > 0 && file.Offset >= 0 && file.Offset+file.Length <= size {
+			parts = append(parts, file)
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Offset < parts[j].Offset })
+
+	result := []mailboxTypes.File{}
+	var end int64
+	for _, part := range parts {
+		if part.Offset < end || len(result) == storage.MaxBlobs {
+			continue
+		}
+		result = append(result, part)
+		end = part.Offset + part.Length
+	}
+	return result
+}
+
+func hashesOf(refs []storage.BlobRef) []string {
+	hashes := []string{}
+	for _, ref := range refs {
+		if !contains(hashes, ref.Hash) {
+			hashes = append(hashes, ref.Hash)
+		}
+	}
+	return hashes
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
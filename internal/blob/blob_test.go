@@ -0,0 +1,183 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/env"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockObject struct {
+	body     []byte
+	metadata map[string]string
+}
+
+// mockBlobsAPI stores objects like S3 and counts references like DynamoDB
+type mockBlobsAPI struct {
+	objects  map[string]mockObject
+	refs     map[string]int
+	deleting map[string]bool
+}
+
+func newMockBlobsAPI(objects map[string]string) *mockBlobsAPI {
+	m := &mockBlobsAPI{
+		objects:  make(map[string]mockObject),
+		refs:     make(map[string]int),
+		deleting: make(map[string]bool),
+	}
+	for key, body := range objects {
+		m.objects[key] = mockObject{body: []byte(body)}
+	}
+	return m
+}
+
+func (m *mockBlobsAPI) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	object := m.objects[*params.Key]
+	return &s3.GetObjectOutput{
+		Body:     io.NopCloser(bytes.NewReader(object.body)),
+		Metadata: object.metadata,
+	}, nil
+}
+
+func (m *mockBlobsAPI) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.objects[*params.Key] = mockObject{body: body, metadata: params.Metadata}
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *mockBlobsAPI) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	delete(m.objects, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (m *mockBlobsAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	id := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+	refs, exists := m.refs[id]
+	switch *params.UpdateExpression {
+	case "ADD Refs :one SET #size = :size":
+		if m.deleting[id] {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		m.refs[id] = refs + 1
+	case "ADD Refs :minus_one":
+		if !exists {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		m.refs[id] = refs - 1
+		return &dynamodb.UpdateItemOutput{Attributes: map[string]types.AttributeValue{
+			"Refs": &types.AttributeValueMemberN{Value: strconv.Itoa(refs - 1)},
+		}}, nil
+	case "SET Deleting = :true":
+		if refs > 0 || m.deleting[id] {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		m.deleting[id] = true
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (m *mockBlobsAPI) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	id := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+	delete(m.refs, id)
+	delete(m.deleting, id)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestStoreAndRelease(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.S3Prefix = ""
+	const (
+		first  = "Subject: first\r\n\r\nLARGEPART--first"
+		second = "Subject: second\r\n\r\nLARGEPART--second"
+	)
+	client := newMockBlobsAPI(map[string]string{"first": first, "second": second})
+
+	blobs, err := Store(context.TODO(), client, storage.DefaultLocation("first"), mailboxTypes.Files{
+		{Filename: "small.txt"},
+		{Filename: "large.pdf", Offset: 18, Length: 9},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, blobs, 1)
+	assert.Equal(t, "Subject: first\r\n\r\n--first", string(client.objects["first"].body))
+	assert.Equal(t, "LARGEPART", string(client.objects["blobs/"+blobs[0]].body))
+
+	// storing again doesn't add references
+	again, err := Store(context.TODO(), client, storage.DefaultLocation("first"), mailboxTypes.Files{
+		{Filename: "large.pdf", Offset: 18, Length: 9},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, blobs, again)
+	assert.Equal(t, 1, client.refs["blob#"+blobs[0]])
+
+	// the same part in another email is stored once
+	secondBlobs, err := Store(context.TODO(), client, storage.DefaultLocation("second"), mailboxTypes.Files{
+		{Filename: "large.pdf", Offset: 19, Length: 9},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, blobs, secondBlobs)
+	assert.Equal(t, 2, client.refs["blob#"+blobs[0]])
+	assert.Len(t, client.objects, 3)
+
+	raw, err := storage.S3.GetEmailRawAt(context.TODO(), client, storage.DefaultLocation("second"))
+	assert.Nil(t, err)
+	assert.Equal(t, second, string(raw))
+
+	// the blob is deleted with the last email referencing it
+	err = Release(context.TODO(), client, blobs)
+	assert.Nil(t, err)
+	assert.Contains(t, client.objects, "blobs/"+blobs[0])
+	err = Release(context.TODO(), client, secondBlobs)
+	assert.Nil(t, err)
+	assert.Len(t, client.objects, 2)
+	assert.Empty(t, client.refs)
+
+	// releasing a deleted blob does nothing
+	err = Release(context.TODO(), client, blobs)
+	assert.Nil(t, err)
+}
+
+func TestStore_Deleting(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.S3Prefix = ""
+	const raw = "Subject: x\r\n\r\nLARGEPART"
+	client := newMockBlobsAPI(map[string]string{"exampleMessageID": raw})
+	sum := sha256.Sum256([]byte("LARGEPART"))
+	client.deleting["blob#"+hex.EncodeToString(sum[:])] = true
+
+	// the part stays in the email while its blob is being deleted
+	blobs, err := Store(context.TODO(), client, storage.DefaultLocation("exampleMessageID"), mailboxTypes.Files{
+		{Filename: "large.pdf", Offset: 14, Length: 9},
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, blobs)
+	assert.Equal(t, raw, string(client.objects["exampleMessageID"].body))
+}
+
+func TestLargeParts(t *testing.T) {
+	files := mailboxTypes.Files{
+		{Filename: "c", Offset: 50, Length: 10},
+		{Filename: "small"},
+		{Filename: "a", Offset: 10, Length: 10},
+		{Filename: "overlapping", Offset: 15, Length: 10},
+		{Filename: "outside", Offset: 90, Length: 20},
+	}
+
+	parts := largeParts(files, 100)
+	assert.Len(t, parts, 2)
+	assert.Equal(t, "a", parts[0].Filename)
+	assert.Equal(t, "c", parts[1].Filename)
+}
@@ -0,0 +1,130 @@
+package bulk
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/jobs"
+)
+
+// DeleteInput is the filter of the received emails to delete
+type DeleteInput struct {
+	Filter
+	Permanent bool `json:"permanent"` // deletes the emails permanently after trashing them, including those already trashed
+}
+
+// DeleteJob is a bulk delete of the received emails matching a filter
+type DeleteJob struct {
+	Job
+	Permanent bool `json:"permanent"`
+	Deleted   int  `json:"deleted"` // trashed, or deleted if permanent
+}
+
+// CreateDelete saves a pending bulk delete of the emails matching input, and queues it in JOBS_QUEUE
+func CreateDelete(ctx context.Context, client jobs.CreateAPI, input DeleteInput) (*DeleteJob, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+
+	job := &DeleteJob{
+		Job:       newJob(input.Filter),
+		Permanent: input.Permanent,
+	}
+	if err := jobs.Create(ctx, client, KindDelete, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetDelete returns a bulk delete by its job ID
+func GetDelete(ctx context.Context, client api.GetItemAPI, jobID string) (*DeleteJob, error) {
+	job, err := jobs.Get(ctx, client, KindDelete, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return job.(*DeleteJob), nil
+}
+
+// CancelDelete cancels a pending or running bulk delete, see jobs.Cancel
+func CancelDelete(ctx context.Context, client api.UpdateItemAPI, jobID string) (*DeleteJob, error) {
+	job, err := jobs.Cancel(ctx, client, KindDelete, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return job.(*DeleteJob), nil
+}
+
+// Step changes the emails of the next page of the time index, see runPage
+func (job *DeleteJob) Step(ctx context.Context, client jobs.StepAPI) (bool, error) {
+	return runPage(ctx, client, job)
+}
+
+func (job *DeleteJob) includesTrashed() bool {
+	return job.Permanent
+}
+
+// change trashes the emails in batches of MaxBatchSize, and deletes them if the job is permanent.
+// Failures are e.g. emails under retention, or permanently deleted emails in threads.
+func (job *DeleteJob) change(ctx context.Context, client jobs.StepAPI, items []map[string]types.AttributeValue) error {
+	ids := messageIDs(items)
+	for len(ids) > 0 {
+		n := min(len(ids), email.MaxBatchSize)
+		if err := job.deleteBatch(ctx, client, ids[:n]); err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+// deleteBatch trashes up to MaxBatchSize emails, and deletes them if the job is permanent
+func (job *DeleteJob) deleteBatch(ctx context.Context, client api.BatchEmailAPI, messageIDs []string) error {
+	job.sleepUntil(ctx, len(messageIDs))
+	result, err := email.BatchTrash(ctx, client, messageIDs)
+	if err != nil {
+		return err
+	}
+	job.addFailures(result.Failed)
+	if !job.Permanent {
+		job.Deleted += len(result.Succeeded)
+		return nil
+	}
+
+	trashed := make([]string, 0, len(result.Succeeded)+len(result.Unchanged))
+	trashed = append(append(trashed, result.Succeeded...), result.Unchanged...)
+	if len(trashed) == 0 {
+		return nil
+	}
+	job.sleepUntil(ctx, len(trashed))
+	result, err = email.BatchDelete(ctx, client, trashed)
+	if err != nil {
+		return err
+	}
+	job.addFailures(result.Failed)
+	job.Deleted += len(result.Succeeded)
+	return nil
+}
+
+// Partition returns the part i of n of the job, see jobs.Partitioned
+func (job *DeleteJob) Partition(i, n int) jobs.Runner {
+	return &DeleteJob{
+		Job:       job.partition(i, n),
+		Permanent: job.Permanent,
+	}
+}
+
+// Merge adds the counts of a finished part to the job
+func (job *DeleteJob) Merge(part jobs.Runner) {
+	p := part.(*DeleteJob)
+	job.merge(&p.Job)
+	job.Deleted += p.Deleted
+}
+
+// Summary returns the counts of the emails
+func (job *DeleteJob) Summary() string {
+	return fmt.Sprintf("%d matched, %d deleted, %d failed", job.Matched, job.Deleted, job.Failed)
+}
@@ -0,0 +1,156 @@
+package bulk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/jobs"
+)
+
+func TestCreateDelete(t *testing.T) {
+	env.JobsQueue = "jobs"
+	defer func() { env.JobsQueue = "" }()
+
+	var saved map[string]types.AttributeValue
+	var body string
+	client := clients.Fake{
+		MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			saved = params.Item
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		MockGetQueueUrl: func(_ context.Context, params *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+			assert.Equal(t, "jobs", *params.QueueName)
+			return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.example.com/jobs")}, nil
+		},
+		MockSendMessage: func(_ context.Context, params *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+			body = *params.MessageBody
+			return &sqs.SendMessageOutput{}, nil
+		},
+	}
+
+	job, err := CreateDelete(context.TODO(), client, DeleteInput{Filter: Filter{Sender: " news@example.com ", Before: "2024-05-01"}})
+	assert.Nil(t, err)
+	assert.Equal(t, jobs.StatusPending, job.Status)
+	assert.Equal(t, KindDelete, job.Kind)
+	assert.Equal(t, "news@example.com", job.Sender)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "job#" + job.JobID}, saved["MessageID"])
+	jobID, err := jobs.ParseMessage(body)
+	assert.Nil(t, err)
+	assert.Equal(t, job.JobID, jobID)
+
+	for _, input := range []DeleteInput{{}, {Permanent: true}, {Filter: Filter{Before: "20240501"}}} {
+		_, err = CreateDelete(context.TODO(), client, input)
+		assert.Equal(t, api.ErrInvalidInput, err)
+	}
+
+	env.JobsQueue = ""
+	_, err = CreateDelete(context.TODO(), client, DeleteInput{Filter: Filter{Label: "news"}})
+	assert.Equal(t, jobs.ErrNotEnabled, err)
+}
+
+func TestRunDelete(t *testing.T) {
+	env.TableName = "table-for-bulk"
+	defer func(original func(context.Context, time.Duration)) { sleep = original }(sleep)
+	sleep = func(context.Context, time.Duration) {}
+
+	job, err := attributevalue.MarshalMap(DeleteJob{Job: Job{Job: jobs.Job{Kind: KindDelete, Status: jobs.StatusPending}, Sender: "@example.com", Before: "2024-05-10"}})
+	assert.Nil(t, err)
+	items := map[string]map[string]types.AttributeValue{
+		"first":  {"MessageID": &types.AttributeValueMemberS{Value: "first"}, "TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"}},
+		"second": {"MessageID": &types.AttributeValueMemberS{Value: "second"}, "TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"}},
+	}
+	var saved []DeleteJob
+	var trashed []string
+	client := clients.Fake{
+		MockGetItem: func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			assert.Equal(t, "job#exampleJobID", params.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+			return &dynamodb.GetItemOutput{Item: job}, nil
+		},
+		MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			var s DeleteJob
+			assert.Nil(t, attributevalue.UnmarshalMap(params.Item, &s))
+			saved = append(saved, s)
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		MockScan: func(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+			assert.Equal(t, "begins_with(#tym, :inbox) AND attribute_not_exists(TrashedTime)", *params.FilterExpression)
+			if params.ExclusiveStartKey == nil {
+				return &dynamodb.ScanOutput{
+					Items: []map[string]types.AttributeValue{
+						indexItem("first", "01-12:00:00.000", "News <news@EXAMPLE.com>"),
+						indexItem("other", "01-12:00:00.000", "someone@example.org"),
+					},
+					ScannedCount:     2,
+					LastEvaluatedKey: map[string]types.AttributeValue{"MessageID": &types.AttributeValueMemberS{Value: "other"}},
+				}, nil
+			}
+			assert.Equal(t, "other", params.ExclusiveStartKey["MessageID"].(*types.AttributeValueMemberS).Value)
+			return &dynamodb.ScanOutput{
+				Items: []map[string]types.AttributeValue{
+					indexItem("second", "09-23:59:59.000", "news@example.com"),
+					indexItem("later", "10-00:00:00.000", "news@example.com"),
+				},
+				ScannedCount: 2,
+			}, nil
+		},
+		MockBatchGetItem: func(_ context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+			var responses []map[string]types.AttributeValue
+			for _, key := range params.RequestItems[env.TableName].Keys {
+				responses = append(responses, items[key["MessageID"].(*types.AttributeValueMemberS).Value])
+			}
+			return &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{env.TableName: responses}}, nil
+		},
+		MockTransactWriteItems: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			for _, item := range params.TransactItems {
+				trashed = append(trashed, item.Update.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+			}
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+	}
+
+	err = jobs.Run(context.TODO(), client, "exampleJobID")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"first", "second"}, trashed)
+	if assert.Len(t, saved, 3) {
+		assert.Equal(t, jobs.StatusRunning, saved[0].Status)
+		assert.Equal(t, map[string]string{"MessageID": "other"}, saved[1].Cursor)
+		last := saved[2]
+		assert.Equal(t, jobs.StatusCompleted, last.Status)
+		assert.Equal(t, 4, last.Scanned)
+		assert.Equal(t, 2, last.Matched)
+		assert.Equal(t, 2, last.Deleted)
+		assert.Empty(t, last.Cursor)
+	}
+
+	// it's queued again if the deadline is near
+	saved = nil
+	trashed = nil
+	var queued bool
+	client.MockGetQueueUrl = func(_ context.Context, _ *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+		return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.example.com/jobs")}, nil
+	}
+	client.MockSendMessage = func(_ context.Context, _ *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+		queued = true
+		return &sqs.SendMessageOutput{}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	err = jobs.Run(ctx, client, "exampleJobID")
+	assert.Nil(t, err)
+	assert.True(t, queued)
+	assert.Empty(t, trashed)
+	if assert.Len(t, saved, 2) {
+		assert.Equal(t, jobs.StatusRunning, saved[1].Status)
+	}
+}
@@ -0,0 +1,330 @@
+// Package bulk runs changes of many emails selected by a filter as asynchronous jobs,
+// so that clients don't page through the mailbox and change the emails one by one.
+package bulk
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/jobs"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// Kinds of bulk jobs
+const (
+	KindDelete = "bulk-delete"
+	KindLabel  = "bulk-label"
+)
+
+func init() {
+	jobs.Register(KindDelete, func() jobs.Runner { return &DeleteJob{} })
+	jobs.Register(KindLabel, func() jobs.Runner { return &LabelJob{} })
+}
+
+const (
+	// pageSize is the number of index items scanned at a time, the job is saved after each page
+	pageSize = 100
+	// defaultRate is the number of emails changed per second if BULK_RATE isn't set
+	defaultRate = 25
+
+	dateLayout = "2006-01-02"
+)
+
+var (
+	// now is equal to time.Now, but will be replaced during testing
+	now = time.Now
+	// sleep waits for d or until ctx is done, and will be replaced during testing
+	sleep = func(ctx context.Context, d time.Duration) {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+	}
+)
+
+// Filter selects the received emails of a bulk job, at least one of the fields is required.
+// An email matches if it matches all the fields that are set.
+type Filter struct {
+	Sender string `json:"sender"` // address of the From header, or a domain starting with @, case-insensitive
+	Label  string `json:"label"`  // only emails with the label
+	Before string `json:"before"` // YYYY-MM-DD in TIME_ZONE, only emails received before the day
+}
+
+// validate trims the filter and checks it
+func (f *Filter) validate() error {
+	f.Sender = strings.TrimSpace(f.Sender)
+	if f.Sender == "" && f.Label == "" && f.Before == "" {
+		return api.ErrInvalidInput
+	}
+	if len(f.Label) > email.MaxLabelLength {
+		return api.ErrInvalidInput
+	}
+	if f.Before != "" {
+		if _, err := time.ParseInLocation(dateLayout, f.Before, format.BucketLocation()); err != nil {
+			fmt.Printf("invalid before %q, expected YYYY-MM-DD\n", f.Before)
+			return api.ErrInvalidInput
+		}
+	}
+	return nil
+}
+
+// Job has the filter and the progress of a bulk job, which scans the time index a page at a time.
+// The cursor is saved with the job after each page, so that it resumes where it stops.
+// A part of a job run by the jobs state machine scans a segment of the index, see Partition.
+type Job struct {
+	jobs.Job
+	Sender     string                     `json:"sender,omitempty"`
+	Label      string                     `json:"label,omitempty"`
+	Before     string                     `json:"before,omitempty"`
+	Scanned    int                        `json:"scanned"` // emails checked against the filter
+	Matched    int                        `json:"matched"` // emails matching the filter
+	Failed     int                        `json:"failed"`  // emails that can't be changed
+	Cursor     map[string]string          `json:"-"`       // key of the last scanned index item, empty before the first page
+	Segment    int                        `json:"-"`       // segment of the parallel scan of a part
+	Segments   int                        `json:"-"`       // total segments of the parallel scan of a part, 0 if the job isn't a part
+	before     time.Time                  // parsed Before
+	sleepUntil func(context.Context, int) // throttles the changes, see throttle
+}
+
+// newJob returns a job of the emails matching filter
+func newJob(filter Filter) Job {
+	return Job{
+		Sender: filter.Sender,
+		Label:  filter.Label,
+		Before: filter.Before,
+	}
+}
+
+func (j *Job) progress() *Job {
+	return j
+}
+
+// partition returns the part of the job scanning the segment i of n of the time index
+func (j *Job) partition(i, n int) Job {
+	return Job{
+		Sender:   j.Sender,
+		Label:    j.Label,
+		Before:   j.Before,
+		Segment:  i,
+		Segments: n,
+	}
+}
+
+// merge adds the counts of a finished part to the job
+func (j *Job) merge(part *Job) {
+	j.Scanned += part.Scanned
+	j.Matched += part.Matched
+	j.Failed += part.Failed
+	if part.LastError != "" {
+		j.LastError = part.LastError
+	}
+}
+
+// prepare parses the filter and starts throttling the changes, before the first page of a run
+func (j *Job) prepare() error {
+	if j.sleepUntil != nil {
+		return nil
+	}
+	if j.Before != "" {
+		before, err := time.ParseInLocation(dateLayout, j.Before, format.BucketLocation())
+		if err != nil {
+			return err
+		}
+		j.before = before
+	}
+	// the parts of a job share the rate
+	j.sleepUntil = throttle(max(rate()/max(j.Segments, 1), 1))
+	return nil
+}
+
+// runner is a bulk job of a kind, which is embedding Job
+type runner interface {
+	progress() *Job
+	// includesTrashed returns whether trashed emails are matched
+	includesTrashed() bool
+	// change changes a page of matching emails, given their items of the time index.
+	// Errors of single emails are recorded in the job, other errors fail the job.
+	change(ctx context.Context, client jobs.StepAPI, items []map[string]types.AttributeValue) error
+}
+
+// runPage changes the matching emails of the page of the time index after the cursor, and moves the cursor.
+// It returns true after the last page. Emails already changed by an interrupted run are skipped by the filter,
+// or are left unchanged, so a page can be run again.
+func runPage(ctx context.Context, client jobs.StepAPI, job runner) (bool, error) {
+	progress := job.progress()
+	if err := progress.prepare(); err != nil {
+		return false, err
+	}
+	filters := []string{"begins_with(#tym, :inbox)"}
+	values := map[string]types.AttributeValue{
+		":inbox": &types.AttributeValueMemberS{Value: email.EmailTypeInbox + "#"},
+	}
+	if !job.includesTrashed() {
+		filters = append(filters, "attribute_not_exists(TrashedTime)")
+	}
+	if progress.Label != "" {
+		filters = append(filters, "contains(Labels, :label)")
+		values[":label"] = &types.AttributeValueMemberS{Value: progress.Label}
+	}
+	input := &dynamodb.ScanInput{
+		TableName:        aws.String(env.TableName),
+		IndexName:        aws.String(env.GsiIndexName),
+		FilterExpression: aws.String(strings.Join(filters, " AND ")),
+		ExpressionAttributeNames: map[string]string{
+			"#tym":  "TypeYearMonth",
+			"#dt":   "DateTime",
+			"#from": "From",
+		},
+		ExpressionAttributeValues: values,
+		ProjectionExpression:      aws.String("MessageID, #tym, #dt, #from, Labels"),
+		Limit:                     aws.Int32(pageSize),
+	}
+	if progress.Segments > 0 {
+		input.Segment = aws.Int32(int32(progress.Segment))
+		input.TotalSegments = aws.Int32(int32(progress.Segments))
+	}
+	if len(progress.Cursor) > 0 {
+		input.ExclusiveStartKey = make(map[string]types.AttributeValue, len(progress.Cursor))
+		for name, value := range progress.Cursor {
+			input.ExclusiveStartKey[name] = &types.AttributeValueMemberS{Value: value}
+		}
+	}
+
+	output, err := client.Scan(ctx, input)
+	if err != nil {
+		return false, err
+	}
+	progress.Scanned += int(output.ScannedCount)
+
+	var matched []map[string]types.AttributeValue
+	for _, item := range output.Items {
+		ok, err := progress.matches(item)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matched = append(matched, item)
+		}
+	}
+	progress.Matched += len(matched)
+	if len(matched) > 0 {
+		if err = job.change(ctx, client, matched); err != nil {
+			return false, err
+		}
+	}
+
+	if len(output.LastEvaluatedKey) == 0 {
+		progress.Cursor = nil
+		return true, nil
+	}
+	// the keys of the table and the index are strings
+	progress.Cursor = make(map[string]string, len(output.LastEvaluatedKey))
+	for name, value := range output.LastEvaluatedKey {
+		if s, ok := value.(*types.AttributeValueMemberS); ok {
+			progress.Cursor[name] = s.Value
+		}
+	}
+	return false, nil
+}
+
+func (j *Job) addFailures(failures []email.BatchFailure) {
+	j.Failed += len(failures)
+	if len(failures) > 0 {
+		failure := failures[len(failures)-1]
+		j.LastError = failure.MessageID + ": " + failure.Error
+	}
+}
+
+// matches returns whether an item of the time index matches the sender and the date of the job,
+// the label and the trash are filtered by the scan
+func (j *Job) matches(item map[string]types.AttributeValue) (bool, error) {
+	var attributes struct {
+		TypeYearMonth string
+		DateTime      string
+		From          []string
+	}
+	if err := attributevalue.UnmarshalMap(item, &attributes); err != nil {
+		return false, err
+	}
+
+	if !j.before.IsZero() {
+		_, yearMonth, err := format.ExtractTypeYearMonth(attributes.TypeYearMonth)
+		if err != nil {
+			return false, err
+		}
+		t, err := time.Parse(time.RFC3339Nano, format.RejoinDate(yearMonth, attributes.DateTime))
+		if err != nil {
+			return false, err
+		}
+		if !t.Before(j.before) {
+			return false, nil
+		}
+	}
+
+	if j.Sender != "" {
+		for _, from := range attributes.From {
+			if senderMatches(j.Sender, from) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// messageIDs returns the MessageIDs of index items
+func messageIDs(items []map[string]types.AttributeValue) []string {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item["MessageID"].(*types.AttributeValueMemberS).Value
+	}
+	return ids
+}
+
+// senderMatches returns whether the address of a From header matches sender, which is an address or a domain starting with @
+func senderMatches(sender, from string) bool {
+	address := from
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		address = parsed.Address
+	}
+	if strings.HasPrefix(sender, "@") {
+		return len(address) > len(sender) && strings.EqualFold(address[len(address)-len(sender):], sender)
+	}
+	return strings.EqualFold(address, sender)
+}
+
+// rate returns BULK_RATE, or defaultRate if it isn't a positive number
+func rate() int {
+	rate, err := strconv.Atoi(env.BulkRate)
+	if err != nil || rate <= 0 {
+		return defaultRate
+	}
+	return rate
+}
+
+// throttle returns a function that waits before n emails are changed, so that at most rate emails are changed per second
+func throttle(rate int) func(ctx context.Context, n int) {
+	var next time.Time
+	return func(ctx context.Context, n int) {
+		current := now()
+		if wait := next.Sub(current); wait > 0 {
+			sleep(ctx, wait)
+			current = next
+		}
+		next = current.Add(time.Duration(n) * time.Second / time.Duration(rate))
+	}
+}
@@ -0,0 +1,143 @@
+package bulk
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/jobs"
+)
+
+func indexItem(messageID, dateTime, from string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"MessageID":     &types.AttributeValueMemberS{Value: messageID},
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+		"DateTime":      &types.AttributeValueMemberS{Value: dateTime},
+		"From":          &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberS{Value: from}}},
+	}
+}
+
+func TestCancelLabel(t *testing.T) {
+	env.TableName = "table-for-bulk"
+	canceled, err := attributevalue.MarshalMap(LabelJob{Job: Job{Job: jobs.Job{Kind: KindLabel, Status: jobs.StatusCanceled}}, Add: []string{"Receipts"}})
+	assert.Nil(t, err)
+	var updateErr error
+	client := clients.Fake{
+		MockUpdateItem: func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			assert.Equal(t, "job#exampleJobID", params.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+			assert.Equal(t, "#status IN (:pending, :running) AND Kind = :kind", *params.ConditionExpression)
+			assert.Equal(t, KindLabel, params.ExpressionAttributeValues[":kind"].(*types.AttributeValueMemberS).Value)
+			return &dynamodb.UpdateItemOutput{Attributes: canceled}, updateErr
+		},
+	}
+
+	job, err := CancelLabel(context.TODO(), client, "exampleJobID")
+	assert.Nil(t, err)
+	assert.Equal(t, "exampleJobID", job.JobID)
+	assert.Equal(t, jobs.StatusCanceled, job.Status)
+	assert.Equal(t, []string{"Receipts"}, job.Add)
+
+	// the job doesn't exist, is a bulk delete, or is finished
+	updateErr = &types.ConditionalCheckFailedException{}
+	_, err = CancelLabel(context.TODO(), client, "exampleJobID")
+	assert.Equal(t, api.ErrNotFound, err)
+}
+
+func TestRun_InvalidBefore(t *testing.T) {
+	env.TableName = "table-for-bulk"
+	job, err := attributevalue.MarshalMap(DeleteJob{Job: Job{Job: jobs.Job{Kind: KindDelete, Status: jobs.StatusPending}, Before: "20240510"}})
+	assert.Nil(t, err)
+	var saved DeleteJob
+	client := clients.Fake{
+		MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: job}, nil
+		},
+		MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			assert.Nil(t, attributevalue.UnmarshalMap(params.Item, &saved))
+			return &dynamodb.PutItemOutput{}, nil
+		},
+	}
+
+	// the job fails before any email is scanned
+	err = jobs.Run(context.TODO(), client, "exampleJobID")
+	assert.Nil(t, err)
+	assert.Equal(t, jobs.StatusFailed, saved.Status)
+	assert.Contains(t, saved.LastError, "20240510")
+}
+
+func TestPartition(t *testing.T) {
+	env.TableName = "table-for-bulk"
+	job := &LabelJob{Job: Job{Job: jobs.Job{JobID: "exampleJobID"}, Sender: "news@example.com", Scanned: 10}, Add: []string{"news"}}
+	part := job.Partition(1, 4).(*LabelJob)
+	assert.Empty(t, part.JobID)
+	assert.Equal(t, "news@example.com", part.Sender)
+	assert.Equal(t, []string{"news"}, part.Add)
+	assert.Equal(t, 0, part.Scanned)
+
+	// the part scans its segment of the index
+	client := clients.Fake{
+		MockScan: func(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+			assert.Equal(t, int32(1), *params.Segment)
+			assert.Equal(t, int32(4), *params.TotalSegments)
+			return &dynamodb.ScanOutput{ScannedCount: 5}, nil
+		},
+	}
+	done, err := part.Step(context.TODO(), client)
+	assert.Nil(t, err)
+	assert.True(t, done)
+
+	part.Labeled = 2
+	part.Failed = 1
+	part.LastError = "exampleMessageID: failed"
+	job.Merge(part)
+	assert.Equal(t, 15, job.Scanned)
+	assert.Equal(t, 2, job.Labeled)
+	assert.Equal(t, 1, job.Failed)
+	assert.Equal(t, "exampleMessageID: failed", job.LastError)
+}
+
+func TestSenderMatches(t *testing.T) {
+	tests := []struct {
+		sender   string
+		from     string
+		expected bool
+	}{
+		{sender: "news@example.com", from: "News <news@example.com>", expected: true},
+		{sender: "news@example.com", from: "NEWS@example.com", expected: true},
+		{sender: "news@example.com", from: "other@example.com"},
+		{sender: "@example.com", from: "news@example.com", expected: true},
+		{sender: "@example.com", from: "news@notexample.com"},
+		{sender: "@example.com", from: "@example.com"},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, senderMatches(test.sender, test.from))
+		})
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	current := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+	var waits []time.Duration
+	defer func(original func(context.Context, time.Duration)) { sleep = original }(sleep)
+	sleep = func(_ context.Context, d time.Duration) { waits = append(waits, d) }
+
+	wait := throttle(10)
+	wait(context.TODO(), 5) // the first batch isn't delayed
+	current = current.Add(100 * time.Millisecond)
+	wait(context.TODO(), 10)
+	current = current.Add(5 * time.Second)
+	wait(context.TODO(), 1) // the rate is already kept
+	assert.Equal(t, []time.Duration{400 * time.Millisecond}, waits)
+}
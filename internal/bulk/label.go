@@ -0,0 +1,152 @@
+package bulk
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/jobs"
+)
+
+// LabelInput is the filter of the received emails to label, and the labels to add and remove
+type LabelInput struct {
+	Filter
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// LabelJob is a bulk labeling of the received emails matching a filter, which aren't trashed
+type LabelJob struct {
+	Job
+	Add     []string `json:"add,omitempty"`
+	Remove  []string `json:"remove,omitempty"`
+	Labeled int      `json:"labeled"` // emails whose labels are changed, emails that already have the labels are only matched
+}
+
+// CreateLabel saves a pending bulk labeling of the emails matching input, and queues it in JOBS_QUEUE
+func CreateLabel(ctx context.Context, client jobs.CreateAPI, input LabelInput) (*LabelJob, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+	add, err := email.NormalizeLabels(input.Add)
+	if err != nil {
+		return nil, err
+	}
+	remove, err := email.NormalizeLabels(input.Remove)
+	if err != nil {
+		return nil, err
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return nil, api.ErrInvalidInput
+	}
+
+	job := &LabelJob{
+		Job:    newJob(input.Filter),
+		Add:    add,
+		Remove: remove,
+	}
+	if err := jobs.Create(ctx, client, KindLabel, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetLabel returns a bulk labeling by its job ID
+func GetLabel(ctx context.Context, client api.GetItemAPI, jobID string) (*LabelJob, error) {
+	job, err := jobs.Get(ctx, client, KindLabel, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return job.(*LabelJob), nil
+}
+
+// CancelLabel cancels a pending or running bulk labeling, see jobs.Cancel
+func CancelLabel(ctx context.Context, client api.UpdateItemAPI, jobID string) (*LabelJob, error) {
+	job, err := jobs.Cancel(ctx, client, KindLabel, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return job.(*LabelJob), nil
+}
+
+// Step changes the emails of the next page of the time index, see runPage
+func (job *LabelJob) Step(ctx context.Context, client jobs.StepAPI) (bool, error) {
+	return runPage(ctx, client, job)
+}
+
+func (job *LabelJob) includesTrashed() bool {
+	return false
+}
+
+// change updates the labels of the emails one by one, as with email.UpdateLabels,
+// skipping emails that already have the labels added and none of the labels removed
+func (job *LabelJob) change(ctx context.Context, client jobs.StepAPI, items []map[string]types.AttributeValue) error {
+	for _, item := range items {
+		if job.labeled(item) {
+			continue
+		}
+
+		messageID := item["MessageID"].(*types.AttributeValueMemberS).Value
+		job.sleepUntil(ctx, 1)
+		err := email.UpdateLabels(ctx, client, email.UpdateLabelsInput{
+			MessageID: messageID,
+			Add:       job.Add,
+			Remove:    job.Remove,
+		})
+		if err == api.ErrNotFound {
+			// the email is deleted after it's scanned
+			job.addFailures([]email.BatchFailure{{MessageID: messageID, Error: err.Error()}})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		job.Labeled++
+	}
+	return nil
+}
+
+// labeled returns whether an index item already has the labels of the job
+func (job *LabelJob) labeled(item map[string]types.AttributeValue) bool {
+	labels := make(map[string]bool)
+	if set, ok := item["Labels"].(*types.AttributeValueMemberSS); ok {
+		for _, label := range set.Value {
+			labels[label] = true
+		}
+	}
+	for _, label := range job.Add {
+		if !labels[label] {
+			return false
+		}
+	}
+	for _, label := range job.Remove {
+		if labels[label] {
+			return false
+		}
+	}
+	return true
+}
+
+// Partition returns the part i of n of the job, see jobs.Partitioned
+func (job *LabelJob) Partition(i, n int) jobs.Runner {
+	return &LabelJob{
+		Job:    job.partition(i, n),
+		Add:    job.Add,
+		Remove: job.Remove,
+	}
+}
+
+// Merge adds the counts of a finished part to the job
+func (job *LabelJob) Merge(part jobs.Runner) {
+	p := part.(*LabelJob)
+	job.merge(&p.Job)
+	job.Labeled += p.Labeled
+}
+
+// Summary returns the counts of the emails
+func (job *LabelJob) Summary() string {
+	return fmt.Sprintf("%d matched, %d labeled, %d failed", job.Matched, job.Labeled, job.Failed)
+}
@@ -0,0 +1,131 @@
+package bulk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/jobs"
+)
+
+func TestCreateLabel(t *testing.T) {
+	env.JobsQueue = "jobs"
+	defer func() { env.JobsQueue = "" }()
+
+	var body string
+	client := clients.Fake{
+		MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		MockGetQueueUrl: func(_ context.Context, _ *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+			return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.example.com/jobs")}, nil
+		},
+		MockSendMessage: func(_ context.Context, params *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+			body = *params.MessageBody
+			return &sqs.SendMessageOutput{}, nil
+		},
+	}
+
+	job, err := CreateLabel(context.TODO(), client, LabelInput{
+		Filter: Filter{Sender: "billing@stripe.com"},
+		Add:    []string{" Receipts ", "Receipts"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, jobs.StatusPending, job.Status)
+	assert.Equal(t, KindLabel, job.Kind)
+	assert.Equal(t, []string{"Receipts"}, job.Add)
+	assert.Empty(t, job.Remove)
+	jobID, err := jobs.ParseMessage(body)
+	assert.Nil(t, err)
+	assert.Equal(t, job.JobID, jobID)
+
+	for _, input := range []LabelInput{
+		{Add: []string{"Receipts"}},
+		{Filter: Filter{Sender: "billing@stripe.com"}},
+		{Filter: Filter{Sender: "billing@stripe.com"}, Remove: []string{" "}},
+	} {
+		_, err = CreateLabel(context.TODO(), client, input)
+		assert.Equal(t, api.ErrInvalidInput, err)
+	}
+}
+
+func TestRunLabel(t *testing.T) {
+	env.TableName = "table-for-bulk"
+	defer func(original func(context.Context, time.Duration)) { sleep = original }(sleep)
+	sleep = func(context.Context, time.Duration) {}
+
+	job, err := attributevalue.MarshalMap(LabelJob{
+		Job:    Job{Job: jobs.Job{Kind: KindLabel, Status: jobs.StatusPending}, Sender: "billing@stripe.com"},
+		Add:    []string{"Receipts"},
+		Remove: []string{"Inbox"},
+	})
+	assert.Nil(t, err)
+	labeled := func(messageID string, labels ...string) map[string]types.AttributeValue {
+		item := indexItem(messageID, "01-12:00:00.000", "billing@stripe.com")
+		if len(labels) > 0 {
+			item["Labels"] = &types.AttributeValueMemberSS{Value: labels}
+		}
+		return item
+	}
+	var saved []LabelJob
+	var updated []string
+	client := clients.Fake{
+		MockGetItem: func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			assert.Equal(t, "job#exampleJobID", params.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+			return &dynamodb.GetItemOutput{Item: job}, nil
+		},
+		MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			var s LabelJob
+			assert.Nil(t, attributevalue.UnmarshalMap(params.Item, &s))
+			saved = append(saved, s)
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		MockScan: func(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+			assert.Equal(t, "begins_with(#tym, :inbox) AND attribute_not_exists(TrashedTime)", *params.FilterExpression)
+			return &dynamodb.ScanOutput{
+				Items: []map[string]types.AttributeValue{
+					labeled("unlabeled"),
+					labeled("done", "Receipts", "Work"),
+					labeled("inbox", "Inbox", "Receipts"),
+					labeled("deleted"),
+					indexItem("other", "01-12:00:00.000", "someone@example.org"),
+				},
+				ScannedCount: 5,
+			}, nil
+		},
+		MockUpdateItem: func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			messageID := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+			if messageID == "deleted" {
+				return nil, &types.ConditionalCheckFailedException{}
+			}
+			updated = append(updated, messageID+" "+*params.UpdateExpression)
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+
+	err = jobs.Run(context.TODO(), client, "exampleJobID")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"unlabeled ADD Labels :labels", "unlabeled DELETE Labels :labels",
+		"inbox ADD Labels :labels", "inbox DELETE Labels :labels",
+	}, updated)
+	if assert.Len(t, saved, 2) {
+		last := saved[1]
+		assert.Equal(t, jobs.StatusCompleted, last.Status)
+		assert.Equal(t, 5, last.Scanned)
+		assert.Equal(t, 4, last.Matched)
+		assert.Equal(t, 2, last.Labeled)
+		assert.Equal(t, 1, last.Failed)
+		assert.Equal(t, "deleted: email not found", last.LastError)
+	}
+}
@@ -0,0 +1,83 @@
+// Package clients consolidates the AWS APIs used by mailbox into a few interfaces, one for each service:
+// Table for DynamoDB, Storage for S3, Mailer for SES and Queue for SQS.
+// Operations that use several services compose the interfaces of the ones they use, e.g. outbound.SendAPI,
+// which are implemented by the clients of Lambda functions and by Fake in tests,
+// so that an operation can start using another call without a new interface, or a new mock type in its tests.
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// Table defines the DynamoDB API used on the email table, which is implemented by *dynamodb.Client
+type Table interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// Storage defines the S3 API used on the buckets of raw emails and uploads, which is implemented by *s3.Client
+type Storage interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// Mailer defines the SES API used to send emails, which is implemented by *sesv2.Client
+type Mailer interface {
+	SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+	PutSuppressedDestination(ctx context.Context, params *sesv2.PutSuppressedDestinationInput, optFns ...func(*sesv2.Options)) (*sesv2.PutSuppressedDestinationOutput, error)
+}
+
+// Queue defines the SQS API used to queue messages, which is implemented by *sqs.Client
+type Queue interface {
+	//revive:disable:var-naming
+	GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error)
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// ErrNilClient is returned by New if a client is nil
+var ErrNilClient = errors.New("nil client")
+
+// Clients implements Table and Storage, which are used together by most operations.
+// Lambda functions that also send emails or queue messages embed it with a Mailer or a Queue.
+// It's never modified after New, so it's safe to share across goroutines as long as the clients are.
+type Clients struct {
+	Table
+	Storage
+}
+
+// New returns Clients with the given clients, e.g. New(dynamodbClient.Get(cfg), s3Client.Get(cfg)).
+// The clients are created by the caller, usually with awsutil.NewClient, so that a Lambda function only creates the ones it uses.
+// It returns ErrNilClient if a client is nil, so that a missing client fails when it's created rather than when it's called.
+func New(table Table, storage Storage) (*Clients, error) {
+	if table == nil {
+		return nil, fmt.Errorf("%w: Table", ErrNilClient)
+	}
+	if storage == nil {
+		return nil, fmt.Errorf("%w: Storage", ErrNilClient)
+	}
+	return &Clients{
+		Table:   table,
+		Storage: storage,
+	}, nil
+}
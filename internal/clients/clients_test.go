@@ -0,0 +1,46 @@
+package clients
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ Table   = (*dynamodb.Client)(nil)
+	_ Storage = (*s3.Client)(nil)
+	_ Mailer  = (*sesv2.Client)(nil)
+	_ Queue   = (*sqs.Client)(nil)
+	_ Table   = Fake{}
+	_ Storage = Fake{}
+	_ Mailer  = Fake{}
+	_ Queue   = Fake{}
+)
+
+func TestNew(t *testing.T) {
+	table := Fake{
+		MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{}, nil
+		},
+	}
+	c, err := New(table, Fake{})
+	assert.Nil(t, err)
+
+	_, err = c.GetItem(context.TODO(), &dynamodb.GetItemInput{})
+	assert.Nil(t, err)
+	_, err = c.PutItem(context.TODO(), &dynamodb.PutItemInput{})
+	assert.ErrorIs(t, err, ErrUnexpectedCall)
+	assert.EqualError(t, err, "unexpected call: PutItem")
+
+	_, err = New(table, nil)
+	assert.ErrorIs(t, err, ErrNilClient)
+	assert.EqualError(t, err, "nil client: Storage")
+	_, err = New(nil, Fake{})
+	assert.ErrorIs(t, err, ErrNilClient)
+	assert.EqualError(t, err, "nil client: Table")
+}
@@ -0,0 +1,198 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// ErrUnexpectedCall is returned by Fake for calls without a mock
+var ErrUnexpectedCall = errors.New("unexpected call")
+
+// Fake implements the interfaces of all services for testing, where each call is handled by the mock of the same name.
+// Calls without a mock return ErrUnexpectedCall, so a test only sets the mocks of the calls it expects.
+// Mocks with state can embed Fake and override its methods.
+type Fake struct {
+	MockGetItem                  func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	MockBatchGetItem             func(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	MockQuery                    func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	MockScan                     func(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	MockPutItem                  func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	MockUpdateItem               func(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	MockDeleteItem               func(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	MockTransactWriteItems       func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	MockGetObject                func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	MockHeadObject               func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	MockPutObject                func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	MockCopyObject               func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	MockDeleteObject             func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	MockCreateMultipartUpload    func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	MockUploadPart               func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	MockListParts                func(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error)
+	MockCompleteMultipartUpload  func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	MockAbortMultipartUpload     func(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	MockSendEmail                func(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+	MockPutSuppressedDestination func(ctx context.Context, params *sesv2.PutSuppressedDestinationInput, optFns ...func(*sesv2.Options)) (*sesv2.PutSuppressedDestinationOutput, error)
+	MockGetQueueUrl              func(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error)
+	MockSendMessage              func(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+func (f Fake) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if f.MockGetItem == nil {
+		return nil, fmt.Errorf("%w: GetItem", ErrUnexpectedCall)
+	}
+	return f.MockGetItem(ctx, params, optFns...)
+}
+
+func (f Fake) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	if f.MockBatchGetItem == nil {
+		return nil, fmt.Errorf("%w: BatchGetItem", ErrUnexpectedCall)
+	}
+	return f.MockBatchGetItem(ctx, params, optFns...)
+}
+
+func (f Fake) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if f.MockQuery == nil {
+		return nil, fmt.Errorf("%w: Query", ErrUnexpectedCall)
+	}
+	return f.MockQuery(ctx, params, optFns...)
+}
+
+func (f Fake) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if f.MockScan == nil {
+		return nil, fmt.Errorf("%w: Scan", ErrUnexpectedCall)
+	}
+	return f.MockScan(ctx, params, optFns...)
+}
+
+func (f Fake) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if f.MockPutItem == nil {
+		return nil, fmt.Errorf("%w: PutItem", ErrUnexpectedCall)
+	}
+	return f.MockPutItem(ctx, params, optFns...)
+}
+
+func (f Fake) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if f.MockUpdateItem == nil {
+		return nil, fmt.Errorf("%w: UpdateItem", ErrUnexpectedCall)
+	}
+	return f.MockUpdateItem(ctx, params, optFns...)
+}
+
+func (f Fake) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if f.MockDeleteItem == nil {
+		return nil, fmt.Errorf("%w: DeleteItem", ErrUnexpectedCall)
+	}
+	return f.MockDeleteItem(ctx, params, optFns...)
+}
+
+func (f Fake) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if f.MockTransactWriteItems == nil {
+		return nil, fmt.Errorf("%w: TransactWriteItems", ErrUnexpectedCall)
+	}
+	return f.MockTransactWriteItems(ctx, params, optFns...)
+}
+
+func (f Fake) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if f.MockGetObject == nil {
+		return nil, fmt.Errorf("%w: GetObject", ErrUnexpectedCall)
+	}
+	return f.MockGetObject(ctx, params, optFns...)
+}
+
+func (f Fake) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if f.MockHeadObject == nil {
+		return nil, fmt.Errorf("%w: HeadObject", ErrUnexpectedCall)
+	}
+	return f.MockHeadObject(ctx, params, optFns...)
+}
+
+func (f Fake) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if f.MockPutObject == nil {
+		return nil, fmt.Errorf("%w: PutObject", ErrUnexpectedCall)
+	}
+	return f.MockPutObject(ctx, params, optFns...)
+}
+
+func (f Fake) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	if f.MockCopyObject == nil {
+		return nil, fmt.Errorf("%w: CopyObject", ErrUnexpectedCall)
+	}
+	return f.MockCopyObject(ctx, params, optFns...)
+}
+
+func (f Fake) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if f.MockDeleteObject == nil {
+		return nil, fmt.Errorf("%w: DeleteObject", ErrUnexpectedCall)
+	}
+	return f.MockDeleteObject(ctx, params, optFns...)
+}
+
+func (f Fake) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if f.MockCreateMultipartUpload == nil {
+		return nil, fmt.Errorf("%w: CreateMultipartUpload", ErrUnexpectedCall)
+	}
+	return f.MockCreateMultipartUpload(ctx, params, optFns...)
+}
+
+func (f Fake) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if f.MockUploadPart == nil {
+		return nil, fmt.Errorf("%w: UploadPart", ErrUnexpectedCall)
+	}
+	return f.MockUploadPart(ctx, params, optFns...)
+}
+
+func (f Fake) ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	if f.MockListParts == nil {
+		return nil, fmt.Errorf("%w: ListParts", ErrUnexpectedCall)
+	}
+	return f.MockListParts(ctx, params, optFns...)
+}
+
+func (f Fake) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	if f.MockCompleteMultipartUpload == nil {
+		return nil, fmt.Errorf("%w: CompleteMultipartUpload", ErrUnexpectedCall)
+	}
+	return f.MockCompleteMultipartUpload(ctx, params, optFns...)
+}
+
+func (f Fake) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	if f.MockAbortMultipartUpload == nil {
+		return nil, fmt.Errorf("%w: AbortMultipartUpload", ErrUnexpectedCall)
+	}
+	return f.MockAbortMultipartUpload(ctx, params, optFns...)
+}
+
+func (f Fake) SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	if f.MockSendEmail == nil {
+		return nil, fmt.Errorf("%w: SendEmail", ErrUnexpectedCall)
+	}
+	return f.MockSendEmail(ctx, params, optFns...)
+}
+
+func (f Fake) PutSuppressedDestination(ctx context.Context, params *sesv2.PutSuppressedDestinationInput, optFns ...func(*sesv2.Options)) (*sesv2.PutSuppressedDestinationOutput, error) {
+	if f.MockPutSuppressedDestination == nil {
+		return nil, fmt.Errorf("%w: PutSuppressedDestination", ErrUnexpectedCall)
+	}
+	return f.MockPutSuppressedDestination(ctx, params, optFns...)
+}
+
+//revive:disable:var-naming
+func (f Fake) GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	if f.MockGetQueueUrl == nil {
+		return nil, fmt.Errorf("%w: GetQueueUrl", ErrUnexpectedCall)
+	}
+	return f.MockGetQueueUrl(ctx, params, optFns...)
+}
+
+func (f Fake) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	if f.MockSendMessage == nil {
+		return nil, fmt.Errorf("%w: SendMessage", ErrUnexpectedCall)
+	}
+	return f.MockSendMessage(ctx, params, optFns...)
+}
@@ -0,0 +1,351 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Folders that have counters.
+// Received emails are counted in the inbox folder, or in the trash folder once they are trashed, and drafts in the drafts folder.
+// Received emails that aren't trashed are also counted in the folder of each of their labels, see LabelFolder.
+const (
+	FolderInbox  = "inbox"
+	FolderTrash  = "trash"
+	FolderDrafts = "drafts"
+
+	// labelFolderPrefix is the prefix of the folders of labels
+	labelFolderPrefix = "label#"
+	// draftPrefix is the prefix of the TypeYearMonth of drafts
+	draftPrefix = "draft#"
+)
+
+// StateAttributes is the projection of the attributes of an email that decide which counters it's counted in
+const StateAttributes = "TypeYearMonth, Unread, TrashedTime, Labels"
+
+// Counter contains the number of emails in a folder, and how many of them are unread
+type Counter struct {
+	Folder string `json:"folder"`
+	Total  int64  `json:"total"`
+	Unread int64  `json:"unread"`
+}
+
+// Enabled returns whether folder counters are maintained, which requires the counters table
+func Enabled() bool {
+	return env.CountersTableName != ""
+}
+
+// LabelFolder returns the folder of the counter of a label
+func LabelFolder(label string) string {
+	return labelFolderPrefix + label
+}
+
+// State is the state of an email that decides which counters it's counted in
+type State struct {
+	TypeYearMonth string
+	Unread        bool
+	Trashed       bool
+	Labels        []string // sorted
+}
+
+// StateOf returns the state of an email item
+func StateOf(item map[string]types.AttributeValue) State {
+	state := State{}
+	if typeYearMonth, ok := item["TypeYearMonth"].(*types.AttributeValueMemberS); ok {
+		state.TypeYearMonth = typeYearMonth.Value
+	}
+	_, state.Unread = item["Unread"]
+	_, state.Trashed = item["TrashedTime"]
+	if labels, ok := item["Labels"].(*types.AttributeValueMemberSS); ok && len(labels.Value) > 0 {
+		state.Labels = append([]string(nil), labels.Value...)
+		sort.Strings(state.Labels)
+	}
+	return state
+}
+
+// Counted returns whether the email is counted, which is only true for received emails and drafts
+func (s State) Counted() bool {
+	return s.received() || strings.HasPrefix(s.TypeYearMonth, draftPrefix)
+}
+
+// received returns whether the email is a received email, whose labels are counted
+func (s State) received() bool {
+	return strings.HasPrefix(s.TypeYearMonth, FolderInbox+"#")
+}
+
+// Folder returns the folder the email is counted in, besides the folders of its labels
+func (s State) Folder() string {
+	switch {
+	case s.Trashed:
+		return FolderTrash
+	case strings.HasPrefix(s.TypeYearMonth, draftPrefix):
+		return FolderDrafts
+	default:
+		return FolderInbox
+	}
+}
+
+// Condition returns a condition expression that checks the email is still in the state,
+// so that counters can't drift when the email is changed concurrently, and the attribute values it uses
+func (s State) Condition() (string, map[string]types.AttributeValue) {
+	values := map[string]types.AttributeValue{
+		":c_type": &types.AttributeValueMemberS{Value: s.TypeYearMonth},
+	}
+	expression := "TypeYearMonth = :c_type"
+	if s.Unread {
+		expression += " AND attribute_exists(Unread)"
+	} else {
+		expression += " AND attribute_not_exists(Unread)"
+	}
+	if s.Trashed {
+		expression += " AND attribute_exists(TrashedTime)"
+	} else {
+		expression += " AND attribute_not_exists(TrashedTime)"
+	}
+	// the labels of drafts aren't counted
+	if s.received() {
+		if len(s.Labels) > 0 {
+			expression += " AND Labels = :c_labels"
+			values[":c_labels"] = &types.AttributeValueMemberSS{Value: s.Labels}
+		} else {
+			expression += " AND attribute_not_exists(Labels)"
+		}
+	}
+	return expression, values
+}
+
+// Delta is a change to the counter of a folder
+type Delta struct {
+	Folder string
+	Total  int64
+	Unread int64
+}
+
+// Add returns the deltas of adding an email in the state, to its folder and the folders of its labels
+func Add(s State) []Delta {
+	delta := Delta{Folder: s.Folder(), Total: 1}
+	if s.Unread {
+		delta.Unread = 1
+	}
+	deltas := []Delta{delta}
+	if s.received() && !s.Trashed {
+		for _, label := range s.Labels {
+			deltas = append(deltas, Delta{Folder: LabelFolder(label), Total: delta.Total, Unread: delta.Unread})
+		}
+	}
+	return deltas
+}
+
+// Remove returns the deltas of removing an email in the state
+func Remove(s State) []Delta {
+	deltas := Add(s)
+	for i := range deltas {
+		deltas[i].Total, deltas[i].Unread = -deltas[i].Total, -deltas[i].Unread
+	}
+	return deltas
+}
+
+// Transition returns the deltas of an email changing from one state to another
+func Transition(from, to State) []Delta {
+	return append(Remove(from), Add(to)...)
+}
+
+// merge combines deltas of the same folder, since a transaction can't update an item more than once.
+// Deltas that don't change anything are dropped.
+func merge(deltas []Delta) []Delta {
+	merged := make([]Delta, 0, len(deltas))
+	indexes := make(map[string]int)
+	for _, delta := range deltas {
+		if i, ok := indexes[delta.Folder]; ok {
+			merged[i].Total += delta.Total
+			merged[i].Unread += delta.Unread
+			continue
+		}
+		indexes[delta.Folder] = len(merged)
+		merged = append(merged, delta)
+	}
+
+	result := merged[:0]
+	for _, delta := range merged {
+		if delta.Total != 0 || delta.Unread != 0 {
+			result = append(result, delta)
+		}
+	}
+	return result
+}
+
+// Updates returns the transaction items that apply the deltas to the counters table
+func Updates(deltas ...Delta) []types.TransactWriteItem {
+	items := make([]types.TransactWriteItem, 0, len(deltas))
+	for _, delta := range merge(deltas) {
+		items = append(items, types.TransactWriteItem{
+			Update: &types.Update{
+				TableName: aws.String(env.CountersTableName),
+				Key: map[string]types.AttributeValue{
+					"Folder": &types.AttributeValueMemberS{Value: delta.Folder},
+				},
+				UpdateExpression: aws.String("ADD #total :total, #unread :unread"),
+				ExpressionAttributeNames: map[string]string{
+					"#total":  "Total",
+					"#unread": "Unread",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":total":  &types.AttributeValueMemberN{Value: strconv.FormatInt(delta.Total, 10)},
+					":unread": &types.AttributeValueMemberN{Value: strconv.FormatInt(delta.Unread, 10)},
+				},
+			},
+		})
+	}
+	return items
+}
+
+// Transact writes item and applies the deltas to the counters in a single transaction.
+// Counter updates have no conditions, so if the condition of item fails, a ConditionalCheckFailedException is returned, as if item is written alone.
+func Transact(ctx context.Context, client api.TransactWriteItemsAPI, item types.TransactWriteItem, deltas ...Delta) error {
+	items := append([]types.TransactWriteItem{item}, Updates(deltas...)...)
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if ConditionFailed(err) {
+		// the item is set if it's requested by ReturnValuesOnConditionCheckFailure
+		return &types.ConditionalCheckFailedException{
+			Message: aws.String("the conditional request failed"),
+			Item:    conditionFailedItem(err),
+		}
+	}
+	return err
+}
+
+// conditionFailedItem returns the item returned with the first condition failure of a canceled transaction
+func conditionFailedItem(err error) map[string]types.AttributeValue {
+	var canceledErr *types.TransactionCanceledException
+	if !errors.As(err, &canceledErr) {
+		return nil
+	}
+	for _, reason := range canceledErr.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+			return reason.Item
+		}
+	}
+	return nil
+}
+
+// ConditionFailed returns whether err is a canceled transaction with an item that failed its condition
+func ConditionFailed(err error) bool {
+	var canceledErr *types.TransactionCanceledException
+	if !errors.As(err, &canceledErr) {
+		return false
+	}
+	for _, reason := range canceledErr.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the counter of a folder, which is zero if nothing is counted in it yet
+func Get(ctx context.Context, client api.GetItemAPI, folder string) (Counter, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.CountersTableName),
+		Key: map[string]types.AttributeValue{
+			"Folder": &types.AttributeValueMemberS{Value: folder},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return Counter{Folder: folder}, api.ErrTooManyRequests
+		}
+		return Counter{Folder: folder}, err
+	}
+	counter := counterOf(resp.Item)
+	counter.Folder = folder
+	return counter, nil
+}
+
+// LabelCount contains the number of emails with a label that aren't trashed, and how many of them are unread
+type LabelCount struct {
+	Label  string `json:"label"`
+	Total  int64  `json:"total"`
+	Unread int64  `json:"unread"`
+}
+
+// Counts contains the counters of all folders
+type Counts struct {
+	Inbox  Counter      `json:"inbox"`
+	Drafts Counter      `json:"drafts"`
+	Trash  Counter      `json:"trash"`
+	Labels []LabelCount `json:"labels"` // labels with emails, by name
+}
+
+// GetCounts returns the counters of all folders. The counters table has an item per folder, so it's read by a scan.
+func GetCounts(ctx context.Context, client api.ScanAPI) (*Counts, error) {
+	counts := &Counts{
+		Inbox:  Counter{Folder: FolderInbox},
+		Drafts: Counter{Folder: FolderDrafts},
+		Trash:  Counter{Folder: FolderTrash},
+		Labels: []LabelCount{},
+	}
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(env.CountersTableName),
+	}
+	for {
+		output, err := client.Scan(ctx, input)
+		if err != nil {
+			if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return nil, api.ErrTooManyRequests
+			}
+			return nil, err
+		}
+		for _, item := range output.Items {
+			counter := counterOf(item)
+			switch {
+			case counter.Folder == FolderInbox:
+				counts.Inbox = counter
+			case counter.Folder == FolderDrafts:
+				counts.Drafts = counter
+			case counter.Folder == FolderTrash:
+				counts.Trash = counter
+			case strings.HasPrefix(counter.Folder, labelFolderPrefix) && counter.Total > 0:
+				counts.Labels = append(counts.Labels, LabelCount{
+					Label:  strings.TrimPrefix(counter.Folder, labelFolderPrefix),
+					Total:  counter.Total,
+					Unread: counter.Unread,
+				})
+			}
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+
+	sort.Slice(counts.Labels, func(i, j int) bool {
+		return counts.Labels[i].Label < counts.Labels[j].Label
+	})
+	return counts, nil
+}
+
+// counterOf returns the counter stored in an item of the counters table
+func counterOf(item map[string]types.AttributeValue) Counter {
+	counter := Counter{}
+	if folder, ok := item["Folder"].(*types.AttributeValueMemberS); ok {
+		counter.Folder = folder.Value
+	}
+	if total, ok := item["Total"].(*types.AttributeValueMemberN); ok {
+		counter.Total, _ = strconv.ParseInt(total.Value, 10, 64)
+	}
+	if unread, ok := item["Unread"].(*types.AttributeValueMemberN); ok {
+		counter.Unread, _ = strconv.ParseInt(unread.Value, 10, 64)
+	}
+	return counter
+}
@@ -0,0 +1,329 @@
+package counter
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateOf(t *testing.T) {
+	state := StateOf(map[string]types.AttributeValue{
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+		"Unread":        &types.AttributeValueMemberBOOL{Value: true},
+	})
+	assert.Equal(t, State{TypeYearMonth: "inbox#2023-05", Unread: true}, state)
+	assert.True(t, state.Counted())
+	assert.Equal(t, FolderInbox, state.Folder())
+
+	state = StateOf(map[string]types.AttributeValue{
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: "sent#2023-05"},
+		"TrashedTime":   &types.AttributeValueMemberS{Value: "2023-05-01T00:00:00Z"},
+	})
+	assert.False(t, state.Counted())
+	assert.Equal(t, FolderTrash, state.Folder())
+
+	state = StateOf(map[string]types.AttributeValue{
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: "draft#2023-05"},
+	})
+	assert.True(t, state.Counted())
+	assert.Equal(t, FolderDrafts, state.Folder())
+
+	state = StateOf(map[string]types.AttributeValue{
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+		"Labels":        &types.AttributeValueMemberSS{Value: []string{"Work", "Receipts"}},
+	})
+	assert.Equal(t, []string{"Receipts", "Work"}, state.Labels)
+}
+
+func TestState_Condition(t *testing.T) {
+	expression, values := State{TypeYearMonth: "inbox#2023-05", Unread: true}.Condition()
+	assert.Equal(t, "TypeYearMonth = :c_type AND attribute_exists(Unread) AND attribute_not_exists(TrashedTime) AND attribute_not_exists(Labels)", expression)
+	assert.Equal(t, map[string]types.AttributeValue{
+		":c_type": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+	}, values)
+
+	expression, _ = State{TypeYearMonth: "inbox#2023-05", Trashed: true}.Condition()
+	assert.Equal(t, "TypeYearMonth = :c_type AND attribute_not_exists(Unread) AND attribute_exists(TrashedTime) AND attribute_not_exists(Labels)", expression)
+
+	expression, values = State{TypeYearMonth: "inbox#2023-05", Labels: []string{"Work"}}.Condition()
+	assert.Equal(t, "TypeYearMonth = :c_type AND attribute_not_exists(Unread) AND attribute_not_exists(TrashedTime) AND Labels = :c_labels", expression)
+	assert.Equal(t, &types.AttributeValueMemberSS{Value: []string{"Work"}}, values[":c_labels"])
+
+	// the labels of drafts aren't counted
+	expression, _ = State{TypeYearMonth: "draft#2023-05"}.Condition()
+	assert.Equal(t, "TypeYearMonth = :c_type AND attribute_not_exists(Unread) AND attribute_not_exists(TrashedTime)", expression)
+}
+
+func TestMerge(t *testing.T) {
+	unread := State{TypeYearMonth: "inbox#2023-05", Unread: true}
+	read := State{TypeYearMonth: "inbox#2023-05"}
+	trashed := State{TypeYearMonth: "inbox#2023-05", Unread: true, Trashed: true}
+	labeled := State{TypeYearMonth: "inbox#2023-05", Unread: true, Labels: []string{"Work"}}
+	draft := State{TypeYearMonth: "draft#2023-05"}
+
+	tests := []struct {
+		deltas   []Delta
+		expected []Delta
+	}{
+		{
+			deltas:   Add(unread),
+			expected: []Delta{{Folder: FolderInbox, Total: 1, Unread: 1}},
+		},
+		{
+			deltas:   Transition(unread, read),
+			expected: []Delta{{Folder: FolderInbox, Unread: -1}},
+		},
+		{
+			deltas: Transition(unread, trashed),
+			expected: []Delta{
+				{Folder: FolderInbox, Total: -1, Unread: -1},
+				{Folder: FolderTrash, Total: 1, Unread: 1},
+			},
+		},
+		{
+			deltas:   Transition(read, read),
+			expected: []Delta{},
+		},
+		{
+			deltas:   Remove(trashed),
+			expected: []Delta{{Folder: FolderTrash, Total: -1, Unread: -1}},
+		},
+		{
+			deltas: Add(labeled),
+			expected: []Delta{
+				{Folder: FolderInbox, Total: 1, Unread: 1},
+				{Folder: "label#Work", Total: 1, Unread: 1},
+			},
+		},
+		{
+			deltas:   Transition(labeled, State{TypeYearMonth: "inbox#2023-05", Labels: []string{"Work"}}),
+			expected: []Delta{{Folder: FolderInbox, Unread: -1}, {Folder: "label#Work", Unread: -1}},
+		},
+		{
+			deltas:   Transition(unread, labeled),
+			expected: []Delta{{Folder: "label#Work", Total: 1, Unread: 1}},
+		},
+		{
+			// trashed emails are only counted in the trash
+			deltas: Transition(labeled, State{TypeYearMonth: "inbox#2023-05", Unread: true, Trashed: true, Labels: []string{"Work"}}),
+			expected: []Delta{
+				{Folder: FolderInbox, Total: -1, Unread: -1},
+				{Folder: "label#Work", Total: -1, Unread: -1},
+				{Folder: FolderTrash, Total: 1, Unread: 1},
+			},
+		},
+		{
+			deltas:   Remove(draft),
+			expected: []Delta{{Folder: FolderDrafts, Total: -1}},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, merge(test.deltas))
+		})
+	}
+}
+
+func TestUpdates(t *testing.T) {
+	env.CountersTableName = "counters"
+	defer func() { env.CountersTableName = "" }()
+
+	items := Updates(Delta{Folder: FolderInbox, Total: 1, Unread: -1})
+	assert.Len(t, items, 1)
+	update := items[0].Update
+	assert.Equal(t, "counters", *update.TableName)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: FolderInbox}, update.Key["Folder"])
+	assert.Equal(t, "ADD #total :total, #unread :unread", *update.UpdateExpression)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "1"}, update.ExpressionAttributeValues[":total"])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "-1"}, update.ExpressionAttributeValues[":unread"])
+}
+
+type mockTransactWriteItemsAPI func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+
+func (m mockTransactWriteItemsAPI) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func TestTransact(t *testing.T) {
+	item := types.TransactWriteItem{Delete: &types.Delete{}}
+	client := mockTransactWriteItemsAPI(func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+		assert.Len(t, params.TransactItems, 2)
+		assert.Equal(t, item, params.TransactItems[0])
+		return nil, &types.TransactionCanceledException{
+			CancellationReasons: []types.CancellationReason{
+				{Code: aws.String("ConditionalCheckFailed")},
+				{Code: aws.String("None")},
+			},
+		}
+	})
+
+	err := Transact(context.TODO(), client, item, Delta{Folder: FolderTrash, Total: -1})
+	assert.IsType(t, &types.ConditionalCheckFailedException{}, err)
+}
+
+type mockRecountAPI struct {
+	pages     []*dynamodb.ScanOutput
+	startKeys []map[string]types.AttributeValue
+	items     []map[string]types.AttributeValue
+	counters  []map[string]types.AttributeValue // items of the counters table
+}
+
+func (m *mockRecountAPI) Scan(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if *params.TableName == env.CountersTableName {
+		return &dynamodb.ScanOutput{Items: m.counters}, nil
+	}
+	page := m.pages[len(m.startKeys)]
+	m.startKeys = append(m.startKeys, params.ExclusiveStartKey)
+	return page, nil
+}
+
+func (m *mockRecountAPI) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.items = append(m.items, params.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func TestRecount(t *testing.T) {
+	env.TableName = "table-for-recount"
+	env.CountersTableName = "counters"
+	defer func() { env.CountersTableName = "" }()
+
+	inbox := &types.AttributeValueMemberS{Value: "inbox#2023-05"}
+	client := &mockRecountAPI{
+		pages: []*dynamodb.ScanOutput{
+			{
+				Items: []map[string]types.AttributeValue{
+					{"TypeYearMonth": inbox, "Unread": &types.AttributeValueMemberBOOL{Value: true}},
+					{"TypeYearMonth": inbox},
+				},
+				LastEvaluatedKey: map[string]types.AttributeValue{
+					"MessageID": &types.AttributeValueMemberS{Value: "id"},
+				},
+			},
+			{
+				Items: []map[string]types.AttributeValue{
+					{"TypeYearMonth": inbox, "TrashedTime": &types.AttributeValueMemberS{Value: "2023-05-01T00:00:00Z"}},
+					{"TypeYearMonth": inbox, "Labels": &types.AttributeValueMemberSS{Value: []string{"Work"}}},
+					{"TypeYearMonth": &types.AttributeValueMemberS{Value: "draft#2023-05"}},
+				},
+			},
+		},
+		counters: []map[string]types.AttributeValue{
+			{"Folder": &types.AttributeValueMemberS{Value: FolderInbox}},
+			{"Folder": &types.AttributeValueMemberS{Value: "label#Removed"}},
+		},
+	}
+
+	counters, err := Recount(context.TODO(), client)
+	assert.Nil(t, err)
+	assert.Equal(t, []Counter{
+		{Folder: FolderInbox, Total: 3, Unread: 1},
+		{Folder: FolderDrafts, Total: 1},
+		{Folder: FolderTrash, Total: 1},
+		{Folder: "label#Removed"},
+		{Folder: "label#Work", Total: 1},
+	}, counters)
+	assert.Len(t, client.startKeys, 2)
+	assert.Nil(t, client.startKeys[0])
+	assert.Equal(t, client.pages[0].LastEvaluatedKey, client.startKeys[1])
+	assert.Len(t, client.items, 5)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "3"}, client.items[0]["Total"])
+}
+
+type mockGetItemAPI func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+
+func (m mockGetItemAPI) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func TestGet(t *testing.T) {
+	env.CountersTableName = "counters"
+	defer func() { env.CountersTableName = "" }()
+
+	tests := []struct {
+		item     map[string]types.AttributeValue
+		expected Counter
+	}{
+		{
+			item: map[string]types.AttributeValue{
+				"Folder": &types.AttributeValueMemberS{Value: FolderInbox},
+				"Total":  &types.AttributeValueMemberN{Value: "12"},
+				"Unread": &types.AttributeValueMemberN{Value: "3"},
+			},
+			expected: Counter{Folder: FolderInbox, Total: 12, Unread: 3},
+		},
+		{
+			item:     nil,
+			expected: Counter{Folder: FolderInbox},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := mockGetItemAPI(func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				assert.Equal(t, "counters", *params.TableName)
+				assert.Equal(t, &types.AttributeValueMemberS{Value: FolderInbox}, params.Key["Folder"])
+				return &dynamodb.GetItemOutput{Item: test.item}, nil
+			})
+			counter, err := Get(context.TODO(), client, FolderInbox)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, counter)
+		})
+	}
+}
+
+type mockScanAPI func(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+
+func (m mockScanAPI) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func TestGetCounts(t *testing.T) {
+	env.CountersTableName = "counters"
+	defer func() { env.CountersTableName = "" }()
+
+	counterItem := func(folder string, total, unread int) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{
+			"Folder": &types.AttributeValueMemberS{Value: folder},
+			"Total":  &types.AttributeValueMemberN{Value: strconv.Itoa(total)},
+			"Unread": &types.AttributeValueMemberN{Value: strconv.Itoa(unread)},
+		}
+	}
+	client := mockScanAPI(func(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+		assert.Equal(t, "counters", *params.TableName)
+		if params.ExclusiveStartKey == nil {
+			return &dynamodb.ScanOutput{
+				Items: []map[string]types.AttributeValue{
+					counterItem(FolderInbox, 12, 3),
+					counterItem("label#Work", 4, 1),
+				},
+				LastEvaluatedKey: map[string]types.AttributeValue{"Folder": &types.AttributeValueMemberS{Value: "label#Work"}},
+			}, nil
+		}
+		return &dynamodb.ScanOutput{
+			Items: []map[string]types.AttributeValue{
+				counterItem(FolderTrash, 2, 0),
+				counterItem("label#Receipts", 5, 0),
+				counterItem("label#Removed", 0, 0),
+			},
+		}, nil
+	})
+
+	counts, err := GetCounts(context.TODO(), client)
+	assert.Nil(t, err)
+	assert.Equal(t, &Counts{
+		Inbox:  Counter{Folder: FolderInbox, Total: 12, Unread: 3},
+		Drafts: Counter{Folder: FolderDrafts},
+		Trash:  Counter{Folder: FolderTrash, Total: 2},
+		Labels: []LabelCount{
+			{Label: "Receipts", Total: 5},
+			{Label: "Work", Total: 4, Unread: 1},
+		},
+	}, counts)
+}
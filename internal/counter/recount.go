@@ -0,0 +1,126 @@
+package counter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Recount counts the emails of each folder by scanning the table, and overwrites the counters.
+// It repairs counters that were changed by hand, or creates them for existing emails when counters are enabled.
+// Counters of labels that no email has anymore are reset to zero.
+// Emails changed while the table is scanned may not be reflected, so it's best run when the mailbox is quiet.
+func Recount(ctx context.Context, client api.RecountCountersAPI) ([]Counter, error) {
+	counters := map[string]*Counter{
+		FolderInbox:  {Folder: FolderInbox},
+		FolderDrafts: {Folder: FolderDrafts},
+		FolderTrash:  {Folder: FolderTrash},
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String(env.TableName),
+		ProjectionExpression: aws.String(StateAttributes),
+		FilterExpression:     aws.String("begins_with(TypeYearMonth, :v_type) OR begins_with(TypeYearMonth, :v_draft)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":v_type":  &types.AttributeValueMemberS{Value: FolderInbox + "#"},
+			":v_draft": &types.AttributeValueMemberS{Value: draftPrefix},
+		},
+	}
+	for {
+		output, err := client.Scan(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range output.Items {
+			for _, delta := range Add(StateOf(item)) {
+				counter, ok := counters[delta.Folder]
+				if !ok {
+					counter = &Counter{Folder: delta.Folder}
+					counters[delta.Folder] = counter
+				}
+				counter.Total += delta.Total
+				counter.Unread += delta.Unread
+			}
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+
+	// labels may be removed from all emails since they are counted
+	stale, err := labelFolders(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range stale {
+		if _, ok := counters[folder]; !ok {
+			counters[folder] = &Counter{Folder: folder}
+		}
+	}
+
+	folders := make([]string, 0, len(counters))
+	for folder := range counters {
+		if folder != FolderInbox && folder != FolderDrafts && folder != FolderTrash {
+			folders = append(folders, folder)
+		}
+	}
+	sort.Strings(folders)
+	folders = append([]string{FolderInbox, FolderDrafts, FolderTrash}, folders...)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	result := make([]Counter, 0, len(counters))
+	for _, folder := range folders {
+		counter := counters[folder]
+		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(env.CountersTableName),
+			Item: map[string]types.AttributeValue{
+				"Folder":      &types.AttributeValueMemberS{Value: counter.Folder},
+				"Total":       &types.AttributeValueMemberN{Value: strconv.FormatInt(counter.Total, 10)},
+				"Unread":      &types.AttributeValueMemberN{Value: strconv.FormatInt(counter.Unread, 10)},
+				"RecountTime": &types.AttributeValueMemberS{Value: now},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("recounted %s: %d total, %d unread\n", counter.Folder, counter.Total, counter.Unread)
+		result = append(result, *counter)
+	}
+	return result, nil
+}
+
+// labelFolders returns the folders of the existing counters of labels
+func labelFolders(ctx context.Context, client api.ScanAPI) ([]string, error) {
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String(env.CountersTableName),
+		ProjectionExpression: aws.String("Folder"),
+	}
+	var folders []string
+	for {
+		output, err := client.Scan(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range output.Items {
+			if folder, ok := item["Folder"].(*types.AttributeValueMemberS); ok && strings.HasPrefix(folder.Value, labelFolderPrefix) {
+				folders = append(folders, folder.Value)
+			}
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+	return folders, nil
+}
@@ -0,0 +1,17 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+// SendEmailAPI defines set of API required to send an email
+type SendEmailAPI interface {
+	SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+}
+
+// SuppressAPI defines set of API required to add an address to the suppression list of the account
+type SuppressAPI interface {
+	PutSuppressedDestination(ctx context.Context, params *sesv2.PutSuppressedDestinationInput, optFns ...func(*sesv2.Options)) (*sesv2.PutSuppressedDestinationOutput, error)
+}
@@ -1,4 +1,4 @@
-package api
+package queue
 
 import (
 	"context"
@@ -6,8 +6,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 )
 
-// SQSSendMessageAPI defines set of API required by SendEmailReceipt and SendEmailNotification functions
-type SQSSendMessageAPI interface {
+// SendMessageAPI defines set of API required to send a message to a queue by its name
+type SendMessageAPI interface {
 	//revive:disable:var-naming
 	GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error)
 	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
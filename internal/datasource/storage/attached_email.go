@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/jhillyerd/enmime"
+)
+
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrNotAttachedEmail   = errors.New("attachment is not an email")
+)
+
+const contentTypeRFC822 = "message/rfc822"
+
+// GetAttachedEmail retrieves an email stored at location and parses its attachment at index as an email
+func (s s3Storage) GetAttachedEmail(ctx context.Context, api S3GetObjectAPI, location Location, index int) (*types.AttachedEmail, error) {
+	object, err := getRawObject(ctx, api, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	env, err := readPrunedEnvelope(object)
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 || index >= len(env.Attachments) {
+		return nil, ErrAttachmentNotFound
+	}
+	part := env.Attachments[index]
+	if !isAttachedEmail(part) {
+		return nil, ErrNotAttachedEmail
+	}
+	content, err := readPartContent(ctx, api, location, part)
+	if err != nil {
+		return nil, err
+	}
+	return parseAttachedEmail(index, content, true)
+}
+
+// ParseAttachedEmails parses message/rfc822 attachments into summaries of the attached emails.
+// Attachments that fail to parse are skipped.
+func ParseAttachedEmails(parts []*enmime.Part) types.AttachedEmails {
+	emails := types.AttachedEmails{}
+	for i, part := range parts {
+		if !isAttachedEmail(part) {
+			continue
+		}
+		if _, _, omitted := omittedPartRange(part); omitted {
+			continue // large attached emails are only parsed when requested
+		}
+		email, err := parseAttachedEmail(i, part.Content, false)
+		if err != nil {
+			fmt.Printf("failed to parse attached email at index %d, %v\n", i, err)
+			continue
+		}
+		emails = append(emails, *email)
+	}
+	return emails
+}
+
+func isAttachedEmail(part *enmime.Part) bool {
+	return strings.EqualFold(part.ContentType, contentTypeRFC822)
+}
+
+// parseAttachedEmail parses the content of a message/rfc822 part.
+// If full is false, only the fields stored in DynamoDB are populated.
+func parseAttachedEmail(index int, content []byte, full bool) (*types.AttachedEmail, error) {
+	env, err := enmime.ReadEnvelope(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	email := &types.AttachedEmail{
+		Index:     index,
+		MessageID: env.GetHeader("Message-ID"),
+		Subject:   env.GetHeader("Subject"),
+		From:      addressStrings(env, "From"),
+		To:        addressStrings(env, "To"),
+		Cc:        addressStrings(env, "Cc"),
+		Text:      env.Text,
+	}
+	if date, err := mail.ParseDate(env.GetHeader("Date")); err == nil {
+		email.Date = date.UTC().Format(time.RFC3339)
+	}
+	if full {
+		email.HTML = env.HTML
+		email.Attachments = ParseFiles(env.Attachments)
+		email.Inlines = ParseFiles(env.Inlines)
+	}
+	return email, nil
+}
+
+func addressStrings(env *enmime.Envelope, key string) []string {
+	list, err := env.AddressList(key)
+	if err != nil {
+		return []string{}
+	}
+	addresses := make([]string, len(list))
+	for i, address := range list {
+		addresses[i] = types.Address{Name: address.Name, Address: address.Address}.String()
+	}
+	return addresses
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/jhillyerd/enmime"
+	"github.com/stretchr/testify/assert"
+)
+
+const rawWithAttachedEmail = "From: user@example.com\r\n" +
+	"To: other@example.com\r\n" +
+	"Subject: Fwd: Hello\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"see below\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Disposition: attachment; filename=notes.txt\r\n" +
+	"\r\n" +
+	"notes\r\n" +
+	"--outer\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"Content-Disposition: attachment; filename=hello.eml\r\n" +
+	"\r\n" +
+	"From: \"Doe, John\" <john@example.com>\r\n" +
+	"To: user@example.com\r\n" +
+	"Subject: Hello\r\n" +
+	"Date: Tue, 12 Mar 2024 10:10:10 +0000\r\n" +
+	"Message-ID: <hello@example.com>\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>hello</p>\r\n" +
+	"--outer--\r\n"
+
+func TestS3_GetAttachedEmail(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	readEmailEnvelope = enmime.ReadEnvelope
+
+	client := mockGetObjectAPI(func(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+		assert.Equal(t, "exampleMessageID", *params.Key)
+		return &s3.GetObjectOutput{
+			Body: io.NopCloser(strings.NewReader(rawWithAttachedEmail)),
+		}, nil
+	})
+
+	tests := []struct {
+		index       int
+		expected    *types.AttachedEmail
+		expectedErr error
+	}{
+		{
+			index: 1,
+			expected: &types.AttachedEmail{
+				Index:       1,
+				MessageID:   "<hello@example.com>",
+				Subject:     "Hello",
+				From:        []string{`"Doe, John" <john@example.com>`},
+				To:          []string{"user@example.com"},
+				Cc:          []string{},
+				Date:        "2024-03-12T10:10:10Z",
+				Text:        "hello",
+				HTML:        "<p>hello</p>",
+				Attachments: types.Files{},
+				Inlines:     types.Files{},
+			},
+		},
+		{
+			index:       0,
+			expectedErr: ErrNotAttachedEmail,
+		},
+		{
+			index:       2,
+			expectedErr: ErrAttachmentNotFound,
+		},
+		{
+			index:       -1,
+			expectedErr: ErrAttachmentNotFound,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			actual, err := S3.GetAttachedEmail(context.TODO(), client, DefaultLocation("exampleMessageID"), test.index)
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestParseAttachedEmails(t *testing.T) {
+	envelope, err := enmime.ReadEnvelope(strings.NewReader(rawWithAttachedEmail))
+	assert.Nil(t, err)
+
+	emails := ParseAttachedEmails(envelope.Attachments)
+	assert.Len(t, emails, 1)
+	assert.Equal(t, 1, emails[0].Index)
+	assert.Equal(t, "Hello", emails[0].Subject)
+	assert.Equal(t, "", emails[0].HTML)
+	assert.Nil(t, emails[0].Attachments)
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/jhillyerd/enmime"
+)
+
+// benchCorpus are the emails in testdata/bench, each exercising a slow path of the receive path,
+// with the maximum bytes allocated per byte of raw email when parsing it.
+// The budgets are generous ceilings that catch regressions of an order of magnitude,
+// and allocations are checked instead of time so that the check is stable on shared CI runners.
+var benchCorpus = []struct {
+	name       string
+	allocRatio float64
+}{
+	{name: "newsletter", allocRatio: 50},  // large HTML body in quoted-printable
+	{name: "attachments", allocRatio: 50}, // many base64 attachments
+	{name: "nested", allocRatio: 500},     // deeply nested multiparts, where the per-part overhead dominates
+}
+
+func loadBenchEmail(tb testing.TB, name string) []byte {
+	tb.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "bench", name+".eml"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return raw
+}
+
+func newBenchClient(raw []byte) S3GetObjectAPI {
+	return mockGetObjectAPI(func(_ context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+		return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(raw))}, nil
+	})
+}
+
+// buildAttributes builds the attributes of the parse result stored with a received email
+func buildAttributes(result *GetEmailResult) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"Text":        &types.AttributeValueMemberS{Value: result.Text},
+		"HTML":        &types.AttributeValueMemberS{Value: result.HTML},
+		"Attachments": result.Attachments.ToAttributeValue(),
+		"Inlines":     result.Inlines.ToAttributeValue(),
+		"OtherParts":  result.OtherParts.ToAttributeValue(),
+		"Stats":       result.Stats.ToAttributeValue(),
+	}
+	if len(result.AttachedEmails) > 0 {
+		item["AttachedEmails"] = result.AttachedEmails.ToAttributeValue()
+	}
+	return item
+}
+
+func benchmarkGetEmail(b *testing.B, raw []byte) {
+	client := newBenchClient(raw)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(raw)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := S3.GetEmailAt(context.TODO(), client, DefaultLocation("exampleMessageID")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetEmail(b *testing.B) {
+	env.S3Bucket = "test_bucket"
+	readEmailEnvelope = enmime.ReadEnvelope
+
+	for _, corpus := range benchCorpus {
+		raw := loadBenchEmail(b, corpus.name)
+		b.Run(corpus.name, func(b *testing.B) {
+			benchmarkGetEmail(b, raw)
+		})
+	}
+}
+
+func BenchmarkBuildAttributes(b *testing.B) {
+	env.S3Bucket = "test_bucket"
+	readEmailEnvelope = enmime.ReadEnvelope
+
+	for _, corpus := range benchCorpus {
+		result, err := S3.GetEmailAt(context.TODO(), newBenchClient(loadBenchEmail(b, corpus.name)), DefaultLocation("exampleMessageID"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(corpus.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buildAttributes(result)
+			}
+		})
+	}
+}
+
+// TestBenchmarkBudgets fails if parsing the corpus allocates more than its budget.
+// It runs the benchmarks, so it's only enabled when MAILBOX_BENCH_BUDGET is set, e.g. by `make bench-budget`.
+func TestBenchmarkBudgets(t *testing.T) {
+	if os.Getenv("MAILBOX_BENCH_BUDGET") == "" {
+		t.Skip("set MAILBOX_BENCH_BUDGET to check benchmark budgets")
+	}
+	env.S3Bucket = "test_bucket"
+	readEmailEnvelope = enmime.ReadEnvelope
+
+	for _, corpus := range benchCorpus {
+		raw := loadBenchEmail(t, corpus.name)
+		result := testing.Benchmark(func(b *testing.B) {
+			benchmarkGetEmail(b, raw)
+		})
+		ratio := float64(result.AllocedBytesPerOp()) / float64(len(raw))
+		t.Logf("%s: %s, %.1f bytes allocated per byte", corpus.name, result.MemString(), ratio)
+		if ratio > corpus.allocRatio {
+			t.Errorf("%s: allocated %.1f bytes per byte, over the budget of %.0f", corpus.name, ratio, corpus.allocRatio)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/ctxutil"
+)
+
+// blobsMetadata is the S3 user metadata of a raw email whose large parts are stored as blobs.
+// It lists the blobs as offset:length:hash, separated by commas.
+const blobsMetadata = "blobs"
+
+// MaxBlobs is the maximum number of blobs of an email, so that they fit in the 2 KB of S3 user metadata
+const MaxBlobs = 16
+
+// ErrInvalidBlobs is returned when the blobs of a raw email can't be parsed or don't fit in the email
+var ErrInvalidBlobs = errors.New("invalid blobs of raw email")
+
+// BlobRef is a blob that holds the encoded body of a part of a raw email.
+// The raw email is stored without the body, which is spliced in when the email is read.
+type BlobRef struct {
+	Offset int64  // offset of the body in the original email
+	Length int64  // length of the body
+	Hash   string // hex encoded SHA-256 of the body, which is the key of the blob
+}
+
+// BlobLocation returns the location of a blob, which is under the blobs/ prefix next to the raw emails
+func BlobLocation(hash string) Location {
+	return Location{
+		Bucket: env.S3Bucket,
+		Key:    env.S3Prefix + "blobs/" + hash,
+	}
+}
+
+// BlobRefs returns the blobs of a raw email from the user metadata of its object, sorted by offset
+func BlobRefs(metadata map[string]string) ([]BlobRef, error) {
+	value := metadata[blobsMetadata]
+	if value == "" {
+		return nil, nil
+	}
+
+	var refs []BlobRef
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.Split(entry, ":")
+		if len(fields) != 3 {
+			return nil, ErrInvalidBlobs
+		}
+		offset, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, ErrInvalidBlobs
+		}
+		length, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, ErrInvalidBlobs
+		}
+		refs = append(refs, BlobRef{Offset: offset, Length: length, Hash: fields[2]})
+	}
+	if err := checkBlobRefs(refs, -1); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// checkBlobRefs checks that blobs are sorted and don't overlap, and that they fit in size bytes unless it's negative
+func checkBlobRefs(refs []BlobRef, size int64) error {
+	var end int64
+	for _, ref := range refs {
+		if ref.Offset < end || ref.Length <= 0 || ref.Hash == "" {
+			return ErrInvalidBlobs
+		}
+		end = ref.Offset + ref.Length
+	}
+	if size >= 0 && end > size {
+		return ErrInvalidBlobs
+	}
+	return nil
+}
+
+// PutBlob stores a blob. Blobs are content-addressed, so storing a blob again doesn't change it.
+func PutBlob(ctx context.Context, api S3PutObjectAPI, hash string, content []byte) error {
+	location := BlobLocation(hash)
+	input := &s3.PutObjectInput{
+		Bucket:      &location.Bucket,
+		Key:         &location.Key,
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String("application/octet-stream"),
+	}
+	if err := withRetention(input); err != nil {
+		return err
+	}
+	_, err := api.PutObject(ctx, input)
+	return err
+}
+
+// DeleteBlob deletes a blob, which must no longer be referenced by any email
+func DeleteBlob(ctx context.Context, api S3DeleteObjectAPI, hash string) error {
+	location := BlobLocation(hash)
+	_, err := api.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &location.Bucket,
+		Key:    &location.Key,
+	})
+	return err
+}
+
+// PutEmailStub replaces the raw email at location with a copy without the bodies stored as blobs,
+// which are listed in its metadata. The blobs must be stored before.
+func PutEmailStub(ctx context.Context, api S3PutObjectAPI, location Location, raw []byte, refs []BlobRef) error {
+	if len(refs) > MaxBlobs {
+		return ErrInvalidBlobs
+	}
+	refs = append([]BlobRef{}, refs...)
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Offset < refs[j].Offset })
+	if err := checkBlobRefs(refs, int64(len(raw))); err != nil {
+		return err
+	}
+
+	stub := make([]byte, 0, len(raw))
+	entries := make([]string, len(refs))
+	var pos int64
+	for i, ref := range refs {
+		stub = append(stub, raw[pos:ref.Offset]...)
+		pos = ref.Offset + ref.Length
+		entries[i] = fmt.Sprintf("%d:%d:%s", ref.Offset, ref.Length, ref.Hash)
+	}
+	stub = append(stub, raw[pos:]...)
+
+	input := &s3.PutObjectInput{
+		Bucket:      &location.Bucket,
+		Key:         &location.Key,
+		Body:        bytes.NewReader(stub),
+		ContentType: aws.String("message/rfc822"),
+		Metadata:    map[string]string{blobsMetadata: strings.Join(entries, ",")},
+	}
+	if err := withRetention(input); err != nil {
+		return err
+	}
+	_, err := api.PutObject(ctx, input)
+	return err
+}
+
+// getRawObject returns the raw email at location, with the bodies stored as blobs spliced in.
+// byteRange is an optional range of the original email in the form of bytes=start-end.
+// Emails without blobs are read with a single request.
+// The email must be read and closed within STORAGE_TIMEOUT.
+func getRawObject(ctx context.Context, api S3GetObjectAPI, location Location, byteRange *string) (io.ReadCloser, error) {
+	ctx, cancel := withStorageTimeout(ctx)
+	object, err := openRawObject(ctx, api, location, byteRange)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return ctxutil.CancelOnClose(object, cancel), nil
+}
+
+// withStorageTimeout returns ctx limited by STORAGE_TIMEOUT
+func withStorageTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return ctxutil.WithTimeout(ctx, env.StorageTimeout, DefaultStorageTimeout)
+}
+
+// openRawObject opens the raw email at location, see getRawObject
+func openRawObject(ctx context.Context, api S3GetObjectAPI, location Location, byteRange *string) (io.ReadCloser, error) {
+	object, err := api.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &location.Bucket,
+		Key:    &location.Key,
+		Range:  byteRange,
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if byteRange == nil || !errors.As(err, &apiErr) || apiErr.ErrorCode() != "InvalidRange" {
+			return nil, err
+		}
+		// the range is beyond the end of a stub, whose metadata lists the blobs
+		object, err = api.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: &location.Bucket,
+			Key:    &location.Key,
+			Range:  aws.String("bytes=0-0"),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	refs, err := BlobRefs(object.Metadata)
+	if err != nil {
+		object.Body.Close()
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return object.Body, nil
+	}
+
+	r := &spliceReader{
+		ctx:  ctx,
+		api:  api,
+		refs: refs,
+		end:  -1,
+	}
+	if byteRange == nil {
+		r.stub = object.Body
+		return r, nil
+	}
+	object.Body.Close()
+
+	var start, last int64
+	if _, err := fmt.Sscanf(*byteRange, "bytes=%d-%d", &start, &last); err != nil || start > last {
+		return nil, fmt.Errorf("invalid range %q", *byteRange)
+	}
+	r.pos, r.end = start, last+1
+	stubStart, stubEnd := stubOffset(refs, start), stubOffset(refs, last+1)
+	if stubStart == stubEnd {
+		// the range is within a blob
+		r.stub = io.NopCloser(bytes.NewReader(nil))
+		return r, nil
+	}
+	stub, err := api.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &location.Bucket,
+		Key:    &location.Key,
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", stubStart, stubEnd-1)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.stub = stub.Body
+	return r, nil
+}
+
+// stubOffset returns the offset in the stub of an offset in the original email.
+// An offset in a blob maps to the offset where the blob is spliced in.
+func stubOffset(refs []BlobRef, offset int64) int64 {
+	var removed int64
+	for _, ref := range refs {
+		if offset <= ref.Offset {
+			break
+		}
+		if offset < ref.Offset+ref.Length {
+			return ref.Offset - removed
+		}
+		removed += ref.Length
+	}
+	return offset - removed
+}
+
+// spliceReader reads an original email from its stub and blobs
+type spliceReader struct {
+	ctx  context.Context
+	api  S3GetObjectAPI
+	stub io.ReadCloser // positioned at pos
+	refs []BlobRef
+	pos  int64 // offset in the original email
+	end  int64 // end of the range to read, exclusive, or -1 to read to the end
+
+	blob    io.ReadCloser // blob being read, if pos is in a blob
+	blobEnd int64
+}
+
+func (r *spliceReader) Read(p []byte) (int, error) {
+	if r.end >= 0 && r.pos >= r.end {
+		return 0, io.EOF
+	}
+
+	if r.blob == nil {
+		if ref, ok := r.blobAt(r.pos); ok {
+			if err := r.openBlob(ref); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if r.blob != nil {
+		n, err := r.blob.Read(limitBuffer(p, r.blobEnd-r.pos))
+		r.pos += int64(n)
+		if r.pos >= r.blobEnd {
+			err = r.blob.Close()
+			r.blob = nil
+		} else if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+
+	// read the stub until the next blob
+	limit := r.end
+	for _, ref := range r.refs {
+		if ref.Offset > r.pos {
+			if limit < 0 || ref.Offset < limit {
+				limit = ref.Offset
+			}
+			break
+		}
+	}
+	if limit >= 0 {
+		p = limitBuffer(p, limit-r.pos)
+	}
+	n, err := r.stub.Read(p)
+	r.pos += int64(n)
+	if err == io.EOF && limit >= 0 && r.pos < limit && (r.end < 0 || r.pos < r.end) {
+		err = io.ErrUnexpectedEOF
+	} else if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// blobAt returns the blob that contains offset
+func (r *spliceReader) blobAt(offset int64) (BlobRef, bool) {
+	for _, ref := range r.refs {
+		if ref.Offset <= offset && offset < ref.Offset+ref.Length {
+			return ref, true
+		}
+	}
+	return BlobRef{}, false
+}
+
+// openBlob opens the remaining range of a blob from pos
+func (r *spliceReader) openBlob(ref BlobRef) error {
+	end := ref.Offset + ref.Length
+	if r.end >= 0 && r.end < end {
+		end = r.end
+	}
+	location := BlobLocation(ref.Hash)
+	object, err := r.api.GetObject(r.ctx, &s3.GetObjectInput{
+		Bucket: &location.Bucket,
+		Key:    &location.Key,
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", r.pos-ref.Offset, end-ref.Offset-1)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get blob %s: %w", ref.Hash, err)
+	}
+	r.blob = object.Body
+	r.blobEnd = end
+	return nil
+}
+
+func (r *spliceReader) Close() error {
+	if r.blob != nil {
+		r.blob.Close()
+	}
+	return r.stub.Close()
+}
+
+// limitBuffer returns p shortened to at most n bytes
+func limitBuffer(p []byte, n int64) []byte {
+	if int64(len(p)) > n {
+		return p[:n]
+	}
+	return p
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/jhillyerd/enmime"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockObject struct {
+	body     []byte
+	metadata map[string]string
+}
+
+// mockObjectStore stores objects like S3, including ranged reads
+type mockObjectStore struct {
+	objects map[string]mockObject
+	gets    int
+}
+
+func (m *mockObjectStore) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.gets++
+	object, ok := m.objects[*params.Key]
+	if !ok {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchKey"}
+	}
+	body := object.body
+	if params.Range != nil {
+		var start, end int
+		_, err := fmt.Sscanf(*params.Range, "bytes=%d-%d", &start, &end)
+		if err != nil || start >= len(body) {
+			return nil, &smithy.GenericAPIError{Code: "InvalidRange"}
+		}
+		if end >= len(body) {
+			end = len(body) - 1
+		}
+		body = body[start : end+1]
+	}
+	return &s3.GetObjectOutput{
+		Body:     io.NopCloser(bytes.NewReader(body)),
+		Metadata: object.metadata,
+	}, nil
+}
+
+func (m *mockObjectStore) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	if m.objects == nil {
+		m.objects = make(map[string]mockObject)
+	}
+	m.objects[*params.Key] = mockObject{body: body, metadata: params.Metadata}
+	return &s3.PutObjectOutput{}, nil
+}
+
+// putStub stores raw at location with the given ranges moved into blobs
+func putStub(t *testing.T, store *mockObjectStore, location Location, raw string, refs []BlobRef) {
+	t.Helper()
+	for _, ref := range refs {
+		err := PutBlob(context.TODO(), store, ref.Hash, []byte(raw[ref.Offset:ref.Offset+ref.Length]))
+		assert.Nil(t, err)
+	}
+	err := PutEmailStub(context.TODO(), store, location, []byte(raw), refs)
+	assert.Nil(t, err)
+}
+
+func TestPutEmailStub(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.S3Prefix = ""
+	raw := "Subject: x\r\n\r\n0123456789abcdefghij--tail"
+	store := &mockObjectStore{}
+	putStub(t, store, DefaultLocation("exampleMessageID"), raw, []BlobRef{
+		{Offset: 24, Length: 10, Hash: "b"},
+		{Offset: 14, Length: 5, Hash: "a"},
+	})
+
+	stub := store.objects["exampleMessageID"]
+	assert.Equal(t, "Subject: x\r\n\r\n56789--tail", string(stub.body))
+	assert.Equal(t, map[string]string{"blobs": "14:5:a,24:10:b"}, stub.metadata)
+	assert.Equal(t, "01234", string(store.objects["blobs/a"].body))
+	assert.Equal(t, "abcdefghij", string(store.objects["blobs/b"].body))
+
+	refs, err := BlobRefs(stub.metadata)
+	assert.Nil(t, err)
+	assert.Equal(t, []BlobRef{{Offset: 14, Length: 5, Hash: "a"}, {Offset: 24, Length: 10, Hash: "b"}}, refs)
+}
+
+func TestPutEmailStub_Invalid(t *testing.T) {
+	tests := [][]BlobRef{
+		{{Offset: 0, Length: 5, Hash: "a"}, {Offset: 4, Length: 2, Hash: "b"}}, // overlapping
+		{{Offset: 8, Length: 5, Hash: "a"}},                                    // beyond the end
+		{{Offset: 0, Length: 0, Hash: "a"}},
+		{{Offset: 0, Length: 1, Hash: ""}},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := PutEmailStub(context.TODO(), &mockObjectStore{}, DefaultLocation("exampleMessageID"), []byte("0123456789"), test)
+			assert.Equal(t, ErrInvalidBlobs, err)
+		})
+	}
+}
+
+func TestBlobRefs_Invalid(t *testing.T) {
+	tests := []string{
+		"1:2",
+		"a:2:x",
+		"1:b:x",
+		"10:5:a,12:5:b",
+		"1:-1:a",
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			_, err := BlobRefs(map[string]string{"blobs": test})
+			assert.Equal(t, ErrInvalidBlobs, err)
+		})
+	}
+}
+
+func TestGetRawObject_Blobs(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.S3Prefix = ""
+	raw := "Subject: x\r\n\r\n0123456789abcdefghij--tail"
+	location := DefaultLocation("exampleMessageID")
+	store := &mockObjectStore{}
+	putStub(t, store, location, raw, []BlobRef{
+		{Offset: 14, Length: 5, Hash: "a"},
+		{Offset: 24, Length: 10, Hash: "b"},
+	})
+
+	body, err := getRawObject(context.TODO(), store, location, nil)
+	assert.Nil(t, err)
+	content, err := io.ReadAll(body)
+	assert.Nil(t, err)
+	assert.Nil(t, body.Close())
+	assert.Equal(t, raw, string(content))
+
+	// every range, including ranges within a blob and beyond the end of the stub
+	for start := 0; start < len(raw); start++ {
+		for end := start; end < len(raw); end++ {
+			byteRange := fmt.Sprintf("bytes=%d-%d", start, end)
+			body, err := getRawObject(context.TODO(), store, location, &byteRange)
+			assert.Nil(t, err, byteRange)
+			content, err := io.ReadAll(body)
+			assert.Nil(t, err, byteRange)
+			assert.Nil(t, body.Close())
+			assert.Equal(t, raw[start:end+1], string(content), byteRange)
+		}
+	}
+}
+
+func TestGetRawObject_NoBlobs(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.S3Prefix = ""
+	store := &mockObjectStore{objects: map[string]mockObject{
+		"exampleMessageID": {body: []byte("Subject: x\r\n\r\nhello")},
+	}}
+
+	byteRange := "bytes=14-16"
+	body, err := getRawObject(context.TODO(), store, DefaultLocation("exampleMessageID"), &byteRange)
+	assert.Nil(t, err)
+	content, err := io.ReadAll(body)
+	assert.Nil(t, err)
+	assert.Equal(t, "hel", string(content))
+	assert.Equal(t, 1, store.gets)
+}
+
+func TestS3_GetEmailContent_Blob(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.S3Prefix = ""
+	readEmailEnvelope = enmime.ReadEnvelope
+	oldThreshold := LargePartThreshold
+	LargePartThreshold = 10
+	defer func() { LargePartThreshold = oldThreshold }()
+
+	store := &mockObjectStore{}
+	putStub(t, store, DefaultLocation("exampleMessageID"), rawWithLargeAttachment, []BlobRef{{
+		Offset: int64(strings.Index(rawWithLargeAttachment, "QUJD")),
+		Length: 36,
+		Hash:   "large",
+	}})
+
+	raw, err := S3.GetEmailRawAt(context.TODO(), store, DefaultLocation("exampleMessageID"))
+	assert.Nil(t, err)
+	assert.Equal(t, rawWithLargeAttachment, string(raw))
+
+	result, err := S3.GetEmailContent(context.TODO(), store, DefaultLocation("exampleMessageID"), DispositionAttachments, "large")
+	assert.Nil(t, err)
+	assert.Equal(t, "ABCDEFGHIJKLMNOPQRSTUVWXYZ", string(result.Content))
+
+	emailResult, err := S3.GetEmailAt(context.TODO(), store, DefaultLocation("exampleMessageID"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", emailResult.Text)
+	assert.Equal(t, "text/plain", emailResult.Attachments[0].DetectedContentType)
+}
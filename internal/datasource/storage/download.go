@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// DownloadExpiry is how long a pre-signed download can be used
+const DownloadExpiry = 15 * time.Minute
+
+// S3PresignGetObjectAPI defines set of API required to pre-sign a GET of an object, which is implemented by *s3.PresignClient
+type S3PresignGetObjectAPI interface {
+	PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+// Download is a pre-signed GET of S3, used by clients to download a file of an email directly from S3
+type Download struct {
+	URL     string `json:"url"`
+	Expires string `json:"expires"` // RFC3339
+}
+
+// ContentLocation returns the location where a decoded file of an email is stored to be downloaded.
+// It's an upload whose ID is derived from the file, so that downloading the file again replaces the same object,
+// and it expires with the other uploads.
+func ContentLocation(messageID, disposition, contentID string) Location {
+	hash := sha256.Sum256([]byte(messageID + "\x00" + disposition + "\x00" + contentID))
+	return UploadLocation(hex.EncodeToString(hash[:16]))
+}
+
+// PresignContent stores the decoded content of a file at location, and returns a pre-signed GET that downloads it,
+// see PresignDownload.
+func PresignContent(ctx context.Context, api S3PutObjectAPI, presigner S3PresignGetObjectAPI, location Location,
+	content []byte, contentType, contentDisposition string) (*Download, error) {
+	putCtx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+	_, err := api.PutObject(putCtx, &s3.PutObjectInput{
+		Bucket:      &location.Bucket,
+		Key:         &location.Key,
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return PresignDownload(ctx, presigner, location, contentType, contentDisposition)
+}
+
+// PresignDownload returns a pre-signed GET that downloads the object at location
+// with contentType and contentDisposition as the response headers, which expires after DownloadExpiry
+// or when the credentials expire, whichever is earlier.
+// The presigner is usually s3.NewPresignClient of the S3 client of the function.
+func PresignDownload(ctx context.Context, presigner S3PresignGetObjectAPI, location Location,
+	contentType, contentDisposition string) (*Download, error) {
+	signedAt := now().UTC()
+	req, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     &location.Bucket,
+		Key:                        &location.Key,
+		ResponseContentType:        aws.String(contentType),
+		ResponseContentDisposition: aws.String(contentDisposition),
+	}, s3.WithPresignExpires(DownloadExpiry))
+	if err != nil {
+		return nil, err
+	}
+	return &Download{
+		URL:     req.URL,
+		Expires: signedAt.Add(DownloadExpiry).Format(time.RFC3339),
+	}, nil
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentLocation(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.S3Prefix = "emails/"
+	defer func() {
+		env.S3Bucket = ""
+		env.S3Prefix = ""
+	}()
+
+	location := ContentLocation("exampleMessageID", DispositionAttachments, "contentID")
+	id, ok := strings.CutPrefix(location.Key, "emails/uploads/")
+	assert.True(t, ok)
+	assert.True(t, ValidUploadID(id))
+	assert.Equal(t, "test_bucket", location.Bucket)
+	assert.Equal(t, location, ContentLocation("exampleMessageID", DispositionAttachments, "contentID"))
+	assert.NotEqual(t, location, ContentLocation("exampleMessageID", DispositionInlines, "contentID"))
+}
+
+func TestPresignContent(t *testing.T) {
+	now = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC) }
+	defer func() {
+		now = time.Now
+	}()
+
+	var put *s3.PutObjectInput
+	var body []byte
+	client := mockPutObjectAPI(func(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		put = params
+		body, _ = io.ReadAll(params.Body)
+		return &s3.PutObjectOutput{}, nil
+	})
+	presigner := s3.NewPresignClient(s3.New(s3.Options{
+		Region:      "us-west-2",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", "token"),
+	}))
+	location := Location{Bucket: "test-bucket", Key: "uploads/0123456789abcdef0123456789abcdef"}
+
+	download, err := PresignContent(context.TODO(), client, presigner, location,
+		[]byte("content"), "application/pdf", `attachment; filename="report 1.pdf"`)
+	assert.Nil(t, err)
+	assert.Equal(t, "uploads/0123456789abcdef0123456789abcdef", *put.Key)
+	assert.Equal(t, "application/pdf", *put.ContentType)
+	assert.Equal(t, "content", string(body))
+	assert.Equal(t, "2023-01-02T03:19:05Z", download.Expires)
+
+	u, err := url.Parse(download.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "test-bucket.s3.us-west-2.amazonaws.com", u.Host)
+	assert.Equal(t, "/uploads/0123456789abcdef0123456789abcdef", u.Path)
+	query := u.Query()
+	assert.Equal(t, "900", query.Get("X-Amz-Expires"))
+	assert.True(t, strings.HasPrefix(query.Get("X-Amz-Credential"), "AKIDEXAMPLE/"))
+	assert.True(t, strings.HasSuffix(query.Get("X-Amz-Credential"), "/us-west-2/s3/aws4_request"))
+	assert.Equal(t, "token", query.Get("X-Amz-Security-Token"))
+	assert.Equal(t, "application/pdf", query.Get("response-content-type"))
+	assert.Equal(t, `attachment; filename="report 1.pdf"`, query.Get("response-content-disposition"))
+	assert.Len(t, query.Get("X-Amz-Signature"), 64)
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/jhillyerd/enmime"
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// goldenFile is the part of a parsed file compared with golden files
+type goldenFile struct {
+	Filename            string `json:"filename,omitempty"`
+	ContentType         string `json:"contentType"`
+	Size                int64  `json:"size"`
+	DetectedContentType string `json:"detectedContentType,omitempty"`
+	ContentTypeMismatch bool   `json:"contentTypeMismatch,omitempty"`
+}
+
+// goldenResult is the part of a parse result compared with golden files.
+// Line endings of the bodies are normalized, so that the fixtures can be edited on any platform.
+type goldenResult struct {
+	Text           string       `json:"text"`
+	HTML           string       `json:"html"`
+	Attachments    []goldenFile `json:"attachments"`
+	Inlines        []goldenFile `json:"inlines"`
+	OtherParts     []goldenFile `json:"otherParts"`
+	AttachedEmails int          `json:"attachedEmails"`
+	PartCount      int          `json:"partCount"`
+	LeafCount      int          `json:"leafCount"`
+}
+
+func normalizeBody(s string) string {
+	return strings.TrimSpace(strings.ReplaceAll(s, "\r\n", "\n"))
+}
+
+func newGoldenFiles(files types.Files) []goldenFile {
+	result := make([]goldenFile, len(files))
+	for i, file := range files {
+		result[i] = goldenFile{
+			Filename:            file.Filename,
+			ContentType:         file.ContentType,
+			Size:                file.Size,
+			DetectedContentType: file.DetectedContentType,
+			ContentTypeMismatch: file.ContentTypeMismatch,
+		}
+	}
+	return result
+}
+
+func newGoldenResult(result *GetEmailResult) goldenResult {
+	return goldenResult{
+		Text:           normalizeBody(result.Text),
+		HTML:           normalizeBody(result.HTML),
+		Attachments:    newGoldenFiles(result.Attachments),
+		Inlines:        newGoldenFiles(result.Inlines),
+		OtherParts:     newGoldenFiles(result.OtherParts),
+		AttachedEmails: len(result.AttachedEmails),
+		PartCount:      result.Stats.PartCount,
+		LeafCount:      result.Stats.LeafCount,
+	}
+}
+
+// TestS3_GetEmail_Golden parses the emails in testdata/golden and compares the results with the golden files next to them.
+// Run `go test ./internal/datasource/storage -run Golden -update` to update the golden files after an intended change.
+func TestS3_GetEmail_Golden(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	readEmailEnvelope = enmime.ReadEnvelope
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.eml"))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".eml")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(path)
+			assert.Nil(t, err)
+
+			result, err := S3.GetEmailAt(context.TODO(), newBenchClient(raw), DefaultLocation("exampleMessageID"))
+			assert.Nil(t, err)
+			actual := newGoldenResult(result)
+
+			goldenPath := strings.TrimSuffix(path, ".eml") + ".json"
+			if *updateGolden {
+				data, err := json.MarshalIndent(actual, "", "  ")
+				assert.Nil(t, err)
+				assert.Nil(t, os.WriteFile(goldenPath, append(data, '\n'), 0o644))
+				return
+			}
+
+			data, err := os.ReadFile(goldenPath)
+			assert.Nil(t, err)
+			var expected goldenResult
+			assert.Nil(t, json.Unmarshal(data, &expected))
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
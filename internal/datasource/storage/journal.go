@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// S3CopyObjectAPI defines set of API required by JournalEmail function
+type S3CopyObjectAPI interface {
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+}
+
+// JournalEnabled returns true if received emails are copied to JOURNAL_BUCKET
+func JournalEnabled() bool {
+	return env.JournalBucket != ""
+}
+
+// JournalLocation returns the location of the journal copy of a received email
+func JournalLocation(messageID string) Location {
+	return Location{
+		Bucket: env.JournalBucket,
+		Key:    env.JournalPrefix + messageID,
+	}
+}
+
+// JournalEmail copies a raw email to JOURNAL_BUCKET, which is expected to have S3 Object Lock enabled.
+// The copy is locked in compliance mode for JOURNAL_RETENTION_DAYS, or by the default retention of the bucket if it's not set.
+// Copying again creates another version of the object, and the locked versions are kept.
+func JournalEmail(ctx context.Context, api S3CopyObjectAPI, source Location, messageID string) error {
+	location := JournalLocation(messageID)
+	input := &s3.CopyObjectInput{
+		Bucket:     &location.Bucket,
+		Key:        &location.Key,
+		CopySource: aws.String((&url.URL{Path: source.Bucket + "/" + source.Key}).EscapedPath()),
+		// Object Lock requires an integrity check of the object
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+	}
+	if env.JournalRetentionDays != "" {
+		days, err := strconv.Atoi(env.JournalRetentionDays)
+		if err != nil || days <= 0 {
+			return fmt.Errorf("invalid JOURNAL_RETENTION_DAYS %q", env.JournalRetentionDays)
+		}
+		input.ObjectLockMode = types.ObjectLockModeCompliance
+		input.ObjectLockRetainUntilDate = aws.Time(now().AddDate(0, 0, days))
+	}
+
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+	_, err := api.CopyObject(ctx, input)
+	return err
+}
+
+// now is equal to time.Now, but will be replaced during testing
+var now = time.Now
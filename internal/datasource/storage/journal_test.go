@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockCopyObjectAPI func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+
+func (m mockCopyObjectAPI) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func TestJournalEmail(t *testing.T) {
+	env.JournalBucket = "journal"
+	env.JournalPrefix = "received/"
+	now = func() time.Time { return time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() {
+		env.JournalBucket, env.JournalPrefix, env.JournalRetentionDays = "", "", ""
+		now = time.Now
+	}()
+
+	tests := []struct {
+		retentionDays string
+		expectedMode  types.ObjectLockMode
+		expectedUntil *time.Time
+		expectedErr   bool
+	}{
+		{retentionDays: ""},
+		{
+			retentionDays: "365",
+			expectedMode:  types.ObjectLockModeCompliance,
+			expectedUntil: aws.Time(time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)),
+		},
+		{retentionDays: "0", expectedErr: true},
+		{retentionDays: "x", expectedErr: true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.JournalRetentionDays = test.retentionDays
+			copied := false
+			client := mockCopyObjectAPI(func(_ context.Context, params *s3.CopyObjectInput, _ ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+				copied = true
+				assert.Equal(t, "journal", *params.Bucket)
+				assert.Equal(t, "received/id", *params.Key)
+				assert.Equal(t, "bucket/inbound/id%20x", *params.CopySource)
+				assert.Equal(t, types.ChecksumAlgorithmSha256, params.ChecksumAlgorithm)
+				assert.Equal(t, test.expectedMode, params.ObjectLockMode)
+				assert.Equal(t, test.expectedUntil, params.ObjectLockRetainUntilDate)
+				return &s3.CopyObjectOutput{}, nil
+			})
+
+			err := JournalEmail(context.TODO(), client, Location{Bucket: "bucket", Key: "inbound/id x"}, "id")
+			assert.Equal(t, test.expectedErr, err != nil)
+			assert.Equal(t, !test.expectedErr, copied)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Attributes of an email item with the location of its raw email,
+// which are only stored if the raw email isn't at the default location
+const (
+	RawBucketAttribute = "RawBucket"
+	RawKeyAttribute    = "RawKey"
+)
+
+// Location is the location of a raw email in S3
+type Location struct {
+	Bucket string
+	Key    string
+}
+
+// DefaultLocation returns the location where the SES S3 action stores a raw email,
+// as configured by S3_BUCKET and S3_PREFIX
+func DefaultLocation(messageID string) Location {
+	return Location{
+		Bucket: env.S3Bucket,
+		Key:    env.S3Prefix + messageID,
+	}
+}
+
+// ResolveLocation returns the location of a raw email given by the receipt action.
+// The bucket and key are present when the notification is published by the S3 action,
+// e.g. for messages too large to be included in SNS notifications.
+// Otherwise the default location is used.
+func ResolveLocation(messageID, bucket, key string) Location {
+	if bucket == "" || key == "" {
+		return DefaultLocation(messageID)
+	}
+	return Location{
+		Bucket: bucket,
+		Key:    key,
+	}
+}
+
+// SetItemLocation stores the location of the raw email of messageID in its item, unless it's the default location
+func SetItemLocation(item map[string]types.AttributeValue, messageID string, location Location) {
+	if location == DefaultLocation(messageID) {
+		return
+	}
+	item[RawBucketAttribute] = &types.AttributeValueMemberS{Value: location.Bucket}
+	item[RawKeyAttribute] = &types.AttributeValueMemberS{Value: location.Key}
+}
+
+// ItemLocation returns the location of the raw email of messageID stored in its item,
+// or the default location if the item doesn't have one, e.g. it's received before locations are stored
+func ItemLocation(item map[string]types.AttributeValue, messageID string) Location {
+	bucket, _ := item[RawBucketAttribute].(*types.AttributeValueMemberS)
+	key, _ := item[RawKeyAttribute].(*types.AttributeValueMemberS)
+	if bucket == nil || key == nil {
+		return DefaultLocation(messageID)
+	}
+	return ResolveLocation(messageID, bucket.Value, key.Value)
+}
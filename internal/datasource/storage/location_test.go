@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveLocation(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.S3Prefix = "inbound/"
+	defer func() { env.S3Prefix = "" }()
+
+	assert.Equal(t, Location{Bucket: "test_bucket", Key: "inbound/id"}, DefaultLocation("id"))
+	assert.Equal(t, Location{Bucket: "test_bucket", Key: "inbound/id"}, ResolveLocation("id", "", ""))
+	assert.Equal(t, Location{Bucket: "other", Key: "emails/id"}, ResolveLocation("id", "other", "emails/id"))
+}
+
+func TestItemLocation(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.S3Prefix = "inbound/"
+	defer func() { env.S3Prefix = "" }()
+
+	item := map[string]types.AttributeValue{}
+	SetItemLocation(item, "id", DefaultLocation("id"))
+	assert.Empty(t, item)
+	assert.Equal(t, DefaultLocation("id"), ItemLocation(item, "id"))
+
+	SetItemLocation(item, "id", Location{Bucket: "other", Key: "emails/id"})
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "other"}, item[RawBucketAttribute])
+	assert.Equal(t, Location{Bucket: "other", Key: "emails/id"}, ItemLocation(item, "id"))
+}
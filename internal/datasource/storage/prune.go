@@ -0,0 +1,328 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// LargePartThreshold is the size in bytes of an encoded body above which a part is not buffered when parsing.
+// Such parts are parsed with an empty body, and their location in the raw email is recorded instead,
+// so that they can be streamed from S3 when requested.
+var LargePartThreshold int64 = 1 << 20 // 1 MiB
+
+// omittedPartHeader is added to parts whose bodies are omitted, with the offset and length of the encoded body
+const omittedPartHeader = "X-Mailbox-Omitted-Part"
+
+// pruneLargeParts copies a MIME message, omitting the bodies of leaf parts larger than threshold.
+// Memory usage is bounded by the size of the parts that are kept.
+func pruneLargeParts(r io.Reader, threshold int64) ([]byte, error) {
+	p := &pruner{
+		r:         bufio.NewReaderSize(r, 64*1024),
+		threshold: threshold,
+		lineStart: true,
+	}
+	if _, err := p.entity(nil); err != nil {
+		return nil, err
+	}
+	return p.out.Bytes(), nil
+}
+
+type pruner struct {
+	r         *bufio.Reader
+	out       bytes.Buffer
+	offset    int64 // offset of the next byte to be read
+	threshold int64
+	lineStart bool // whether the next read starts at the beginning of a line
+}
+
+// readLine reads the next line, including its line ending.
+// Lines longer than the buffer are returned in chunks, and isLine is false for chunks after the first one.
+// The returned slice is only valid until the next call.
+func (p *pruner) readLine() (line []byte, isLine bool, err error) {
+	isLine = p.lineStart
+	line, err = p.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		err = nil
+	}
+	p.offset += int64(len(line))
+	p.lineStart = len(line) > 0 && line[len(line)-1] == '\n'
+	return line, isLine, err
+}
+
+// entity processes the headers and body of an entity.
+// It returns the delimiter line of an enclosing multipart that ends the entity, or nil at EOF.
+// The returned line has not been written to the output.
+func (p *pruner) entity(boundaries []string) ([]byte, error) {
+	var header bytes.Buffer
+	for {
+		line, isLine, err := p.readLine()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		header.Write(line)
+		if err == io.EOF || (isLine && len(bytes.TrimRight(line, "\r\n")) == 0) {
+			break
+		}
+	}
+
+	mediaType, params := parseContentType(header.Bytes())
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		p.out.Write(header.Bytes())
+		return p.multipart(append(boundaries, params["boundary"]))
+	}
+	return p.leaf(header.Bytes(), boundaries)
+}
+
+// multipart processes the body of a multipart entity, whose boundary is the last one in boundaries
+func (p *pruner) multipart(boundaries []string) ([]byte, error) {
+	boundary := boundaries[len(boundaries)-1]
+	outer := boundaries[:len(boundaries)-1]
+	closed := false
+
+	var line []byte
+	var isLine, pending bool
+	var err error
+	for {
+		if !pending {
+			line, isLine, err = p.readLine()
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			if len(line) == 0 && err == io.EOF {
+				return nil, nil
+			}
+		}
+		pending = false
+
+		switch {
+		case isLine && !closed && isDelimiter(line, boundary, true):
+			p.out.Write(line)
+			closed = true
+		case isLine && !closed && isDelimiter(line, boundary, false):
+			p.out.Write(line)
+			next, err := p.entity(boundaries)
+			if err != nil {
+				return nil, err
+			}
+			if next == nil {
+				return nil, nil
+			}
+			// the delimiter that ends the part is processed in the next iteration
+			line, isLine, pending = next, true, true
+			continue
+		case isLine && matchesAny(line, outer):
+			return bytes.Clone(line), nil
+		default:
+			p.out.Write(line)
+		}
+		if err == io.EOF {
+			return nil, nil
+		}
+	}
+}
+
+// leaf processes the body of a non-multipart entity, omitting it if it's larger than the threshold
+func (p *pruner) leaf(header []byte, boundaries []string) ([]byte, error) {
+	header = stripHeader(header, omittedPartHeader)
+	start := p.offset
+
+	var body bytes.Buffer
+	var size, lastEOL int64
+	var delimiter []byte
+	omitted := false
+	for {
+		line, isLine, err := p.readLine()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if isLine && matchesAny(line, boundaries) {
+			delimiter = bytes.Clone(line)
+			break
+		}
+		size += int64(len(line))
+		lastEOL = int64(len(line) - len(bytes.TrimRight(line, "\r\n")))
+		if !omitted {
+			body.Write(line)
+			if size > p.threshold {
+				omitted = true
+				body = bytes.Buffer{}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if !omitted {
+		p.out.Write(header)
+		p.out.Write(body.Bytes())
+		return delimiter, nil
+	}
+
+	length := size
+	if delimiter != nil {
+		length -= lastEOL // the line break before a delimiter belongs to the delimiter
+	}
+	if fields := bytes.TrimRight(header, "\r\n"); len(fields) > 0 {
+		p.out.Write(fields)
+		p.out.WriteString("\r\n")
+	}
+	fmt.Fprintf(&p.out, "%s: %d %d\r\n\r\n", omittedPartHeader, start, length)
+	if delimiter != nil {
+		p.out.WriteString("\r\n")
+	}
+	return delimiter, nil
+}
+
+// parseContentType returns the media type and parameters of a raw header block
+func parseContentType(header []byte) (string, map[string]string) {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(header)))
+	fields, err := reader.ReadMIMEHeader()
+	if err != nil && len(fields) == 0 {
+		return "", nil
+	}
+	mediaType, params, err := mime.ParseMediaType(fields.Get("Content-Type"))
+	if err != nil {
+		return "", nil
+	}
+	return mediaType, params
+}
+
+// stripHeader removes all fields with the given name from a raw header block
+func stripHeader(header []byte, name string) []byte {
+	prefix := strings.ToLower(name) + ":"
+	if !bytes.Contains(bytes.ToLower(header), []byte(prefix)) {
+		return header
+	}
+	var result bytes.Buffer
+	skipping := false
+	for _, line := range bytes.SplitAfter(header, []byte("\n")) {
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			if !skipping {
+				result.Write(line)
+			}
+			continue
+		}
+		skipping = strings.HasPrefix(strings.ToLower(string(line)), prefix)
+		if !skipping {
+			result.Write(line)
+		}
+	}
+	return result.Bytes()
+}
+
+// isDelimiter reports whether line is a delimiter line of boundary, or a close-delimiter if closing is true
+func isDelimiter(line []byte, boundary string, closing bool) bool {
+	rest, ok := bytes.CutPrefix(line, []byte("--"+boundary))
+	if !ok {
+		return false
+	}
+	if closing {
+		rest, ok = bytes.CutPrefix(rest, []byte("--"))
+		if !ok {
+			return false
+		}
+	}
+	// transport padding is allowed after the boundary
+	return len(bytes.TrimRight(rest, " \t\r\n")) == 0
+}
+
+// matchesAny reports whether line is a delimiter or close-delimiter of any of the boundaries
+func matchesAny(line []byte, boundaries []string) bool {
+	for _, boundary := range boundaries {
+		if isDelimiter(line, boundary, false) || isDelimiter(line, boundary, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// omittedPartRange returns the location of the encoded body of a part omitted by pruneLargeParts
+func omittedPartRange(part *enmime.Part) (offset, length int64, ok bool) {
+	value := part.Header.Get(omittedPartHeader)
+	if value == "" {
+		return 0, 0, false
+	}
+	if _, err := fmt.Sscanf(value, "%d %d", &offset, &length); err != nil || offset < 0 || length < 0 {
+		return 0, 0, false
+	}
+	return offset, length, true
+}
+
+// readPartContent returns the decoded content of a part.
+// The body of an omitted part is streamed from the raw email in S3 and decoded.
+func readPartContent(ctx context.Context, api S3GetObjectAPI, location Location, part *enmime.Part) ([]byte, error) {
+	offset, length, ok := omittedPartRange(part)
+	if !ok {
+		return part.Content, nil
+	}
+	return readOmittedPart(ctx, api, location, part, offset, length, false)
+}
+
+// readPartHead returns at least the first n bytes of the decoded content of a part, if available.
+// Only the beginning of the body of an omitted part is read from S3.
+func readPartHead(ctx context.Context, api S3GetObjectAPI, location Location, part *enmime.Part, n int64) ([]byte, error) {
+	offset, length, ok := omittedPartRange(part)
+	if !ok {
+		return part.Content, nil
+	}
+	// base64 takes 4 bytes for every 3, plus line breaks
+	if encoded := 2 * n; encoded < length {
+		length = encoded
+	}
+	return readOmittedPart(ctx, api, location, part, offset, length, true)
+}
+
+// readOmittedPart reads and decodes the encoded body in the given range of the raw email.
+// If partial is true, the range may end in the middle of the body and decoding errors at the end are ignored.
+func readOmittedPart(ctx context.Context, api S3GetObjectAPI, location Location, part *enmime.Part, offset, length int64, partial bool) ([]byte, error) {
+	if length == 0 {
+		return []byte{}, nil
+	}
+
+	object, err := openOmittedPart(ctx, api, location, part, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	content, err := io.ReadAll(object)
+	if err != nil && partial && len(content) > 0 {
+		return content, nil
+	}
+	return content, err
+}
+
+// openOmittedPart returns a stream of the encoded body in the given range of the raw email, which is decoded as it's read
+func openOmittedPart(ctx context.Context, api S3GetObjectAPI, location Location, part *enmime.Part, offset, length int64) (io.ReadCloser, error) {
+	byteRange := fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	object, err := getRawObject(ctx, api, location, &byteRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader = object
+	switch strings.ToLower(strings.TrimSpace(part.Header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		reader = base64.NewDecoder(base64.StdEncoding, reader) // line breaks are ignored by the decoder
+	case "quoted-printable":
+		reader = quotedprintable.NewReader(reader)
+	}
+	return readCloser{Reader: reader, Closer: object}, nil
+}
+
+// readCloser reads from a decoder of a stream, and closes the stream
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/jhillyerd/enmime"
+	"github.com/stretchr/testify/assert"
+)
+
+const rawWithLargeAttachment = "From: a@example.com\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"preamble\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"hello\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"Content-Disposition: attachment; filename=large.bin\r\n" +
+	"Content-ID: <large>\r\n" +
+	"X-Mailbox-Omitted-Part: 0 5\r\n" +
+	"\r\n" +
+	"QUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVo=\r\n" +
+	"--outer--\r\n"
+
+func TestPruneLargeParts(t *testing.T) {
+	largeOffset := int64(strings.Index(rawWithLargeAttachment, "QUJD"))
+	tests := []struct {
+		raw       string
+		threshold int64
+		expected  string
+	}{
+		{"", 10, ""},
+		{rawWithLargeAttachment, 1 << 20, strings.Replace(rawWithLargeAttachment, "X-Mailbox-Omitted-Part: 0 5\r\n", "", 1)},
+		{
+			rawWithLargeAttachment,
+			10,
+			strings.Replace(rawWithLargeAttachment,
+				"X-Mailbox-Omitted-Part: 0 5\r\n\r\nQUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVo=\r\n",
+				fmt.Sprintf("X-Mailbox-Omitted-Part: %d 36\r\n\r\n\r\n", largeOffset), 1),
+		},
+		{"Subject: x\r\n\r\n0123456789abcdef", 10, "Subject: x\r\nX-Mailbox-Omitted-Part: 14 16\r\n\r\n"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			actual, err := pruneLargeParts(strings.NewReader(test.raw), test.threshold)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, string(actual))
+		})
+	}
+}
+
+func TestS3_GetEmailContent_LargePart(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	readEmailEnvelope = enmime.ReadEnvelope
+	oldThreshold := LargePartThreshold
+	LargePartThreshold = 10
+	defer func() { LargePartThreshold = oldThreshold }()
+
+	client := mockGetObjectAPI(func(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+		raw := rawWithLargeAttachment
+		if params.Range != nil {
+			var start, end int
+			_, err := fmt.Sscanf(*params.Range, "bytes=%d-%d", &start, &end)
+			assert.Nil(t, err)
+			raw = raw[start : end+1]
+		}
+		return &s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader([]byte(raw))),
+		}, nil
+	})
+
+	result, err := S3.GetEmailContent(context.TODO(), client, DefaultLocation("exampleMessageID"), DispositionAttachments, "large")
+	assert.Nil(t, err)
+	assert.Equal(t, "large.bin", result.Filename)
+	assert.Equal(t, "ABCDEFGHIJKLMNOPQRSTUVWXYZ", string(result.Content))
+
+	emailResult, err := S3.GetEmailAt(context.TODO(), client, DefaultLocation("exampleMessageID"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", emailResult.Text)
+	assert.Len(t, emailResult.Attachments, 1)
+	assert.Equal(t, int64(strings.Index(rawWithLargeAttachment, "QUJD")), emailResult.Attachments[0].Offset)
+	assert.Equal(t, int64(36), emailResult.Attachments[0].Length)
+	assert.Equal(t, "text/plain", emailResult.Attachments[0].DetectedContentType) // detected from a range request
+	assert.False(t, emailResult.Attachments[0].ContentTypeMismatch)
+}
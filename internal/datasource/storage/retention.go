@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// S3HeadObjectAPI defines set of API required by GetRetention function
+type S3HeadObjectAPI interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+// RetentionEnabled returns true if raw emails are written to S3_BUCKET with the retention of S3_RETENTION_MODE
+func RetentionEnabled() bool {
+	return env.S3RetentionMode != ""
+}
+
+// withRetention locks an object written to S3_BUCKET by S3_RETENTION_MODE for S3_RETENTION_DAYS, if it's enabled
+func withRetention(input *s3.PutObjectInput) error {
+	if !RetentionEnabled() {
+		return nil
+	}
+	mode := types.ObjectLockMode(strings.ToUpper(env.S3RetentionMode))
+	if mode != types.ObjectLockModeGovernance && mode != types.ObjectLockModeCompliance {
+		return fmt.Errorf("invalid S3_RETENTION_MODE %q", env.S3RetentionMode)
+	}
+	days, err := strconv.Atoi(env.S3RetentionDays)
+	if err != nil || days <= 0 {
+		return fmt.Errorf("invalid S3_RETENTION_DAYS %q", env.S3RetentionDays)
+	}
+
+	input.ObjectLockMode = mode
+	input.ObjectLockRetainUntilDate = aws.Time(now().AddDate(0, 0, days))
+	// Object Lock requires an integrity check of the object
+	input.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+	return nil
+}
+
+// Retention represents the S3 Object Lock protection of an object
+type Retention struct {
+	Until     *time.Time // the retain until date, nil if the object has no retention
+	LegalHold bool
+}
+
+// GetRetention returns the protection of the object at location if it can't be deleted, or nil otherwise.
+// Deleting such an object only adds a delete marker, so it's checked before deleting an email.
+func GetRetention(ctx context.Context, api S3HeadObjectAPI, location Location) (*Retention, error) {
+	object, err := api.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &location.Bucket,
+		Key:    &location.Key,
+	})
+	if err != nil {
+		// emails without raw objects, e.g. drafts, are not retained
+		if apiErr := new(types.NotFound); errors.As(err, &apiErr) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	retention := &Retention{
+		LegalHold: object.ObjectLockLegalHoldStatus == types.ObjectLockLegalHoldStatusOn,
+	}
+	if object.ObjectLockRetainUntilDate != nil && object.ObjectLockRetainUntilDate.After(now()) {
+		retention.Until = object.ObjectLockRetainUntilDate
+	}
+	if retention.Until == nil && !retention.LegalHold {
+		return nil, nil
+	}
+	return retention, nil
+}
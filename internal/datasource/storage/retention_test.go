@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockHeadObjectAPI func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+
+func (m mockHeadObjectAPI) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func TestS3_PutEmailRaw_Retention(t *testing.T) {
+	now = func() time.Time { return time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() {
+		env.S3RetentionMode, env.S3RetentionDays = "", ""
+		now = time.Now
+	}()
+
+	tests := []struct {
+		mode          string
+		days          string
+		expectedMode  types.ObjectLockMode
+		expectedUntil *time.Time
+		expectedErr   bool
+	}{
+		{},
+		{
+			mode:          "governance",
+			days:          "30",
+			expectedMode:  types.ObjectLockModeGovernance,
+			expectedUntil: aws.Time(time.Date(2022, 3, 31, 0, 0, 0, 0, time.UTC)),
+		},
+		{
+			mode:          "COMPLIANCE",
+			days:          "365",
+			expectedMode:  types.ObjectLockModeCompliance,
+			expectedUntil: aws.Time(time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)),
+		},
+		{mode: "legal", days: "30", expectedErr: true},
+		{mode: "governance", days: "", expectedErr: true},
+		{mode: "governance", days: "-1", expectedErr: true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.S3RetentionMode, env.S3RetentionDays = test.mode, test.days
+			written := false
+			client := mockPutObjectAPI(func(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				written = true
+				assert.Equal(t, test.expectedMode, params.ObjectLockMode)
+				assert.Equal(t, test.expectedUntil, params.ObjectLockRetainUntilDate)
+				if test.expectedMode != "" {
+					assert.Equal(t, types.ChecksumAlgorithmSha256, params.ChecksumAlgorithm)
+				}
+				return &s3.PutObjectOutput{}, nil
+			})
+
+			err := S3.PutEmailRaw(context.TODO(), client, "id", []byte("raw"))
+			assert.Equal(t, test.expectedErr, err != nil)
+			assert.Equal(t, !test.expectedErr, written)
+		})
+	}
+}
+
+func TestGetRetention(t *testing.T) {
+	now = func() time.Time { return time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() {
+		now = time.Now
+	}()
+
+	until := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		output      *s3.HeadObjectOutput
+		err         error
+		expected    *Retention
+		expectedErr error
+	}{
+		{
+			output: &s3.HeadObjectOutput{},
+		},
+		{
+			output: &s3.HeadObjectOutput{ObjectLockRetainUntilDate: aws.Time(time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC))},
+		},
+		{
+			output:   &s3.HeadObjectOutput{ObjectLockRetainUntilDate: aws.Time(until)},
+			expected: &Retention{Until: &until},
+		},
+		{
+			output:   &s3.HeadObjectOutput{ObjectLockLegalHoldStatus: types.ObjectLockLegalHoldStatusOn},
+			expected: &Retention{LegalHold: true},
+		},
+		{
+			err: &types.NotFound{},
+		},
+		{
+			err:         errors.New("error"),
+			expectedErr: errors.New("error"),
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := mockHeadObjectAPI(func(_ context.Context, params *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+				assert.Equal(t, "bucket", *params.Bucket)
+				assert.Equal(t, "id", *params.Key)
+				return test.output, test.err
+			})
+
+			retention, err := GetRetention(context.TODO(), client, Location{Bucket: "bucket", Key: "id"})
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expected, retention)
+		})
+	}
+}
@@ -1,13 +1,20 @@
 package storage
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/attachment"
 	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/harryzcy/mailbox/internal/util/sniff"
 	"github.com/jhillyerd/enmime"
 )
 
@@ -20,21 +27,34 @@ var (
 )
 
 type GetEmailResult struct {
-	Text        string
-	HTML        string
-	Attachments types.Files
-	Inlines     types.Files
-	OtherParts  types.Files
+	Text           string
+	HTML           string
+	Attachments    types.Files
+	Inlines        types.Files
+	OtherParts     types.Files
+	AttachedEmails types.AttachedEmails
+	Stats          types.EmailStats
 }
 
 // S3Storage is an interface that defines required S3 functions
 type S3Storage interface {
-	GetEmail(ctx context.Context, api S3GetObjectAPI, messageID string) (*GetEmailResult, error)
-	DeleteEmail(ctx context.Context, api S3DeleteObjectAPI, messageID string) error
-	GetEmailRaw(ctx context.Context, api S3GetObjectAPI, messageID string) ([]byte, error)
-	GetEmailContent(ctx context.Context, api S3GetObjectAPI, messageID, disposition, contentID string) (*GetEmailContentResult, error)
+	GetEmailAt(ctx context.Context, api S3GetObjectAPI, location Location) (*GetEmailResult, error)
+	DeleteEmail(ctx context.Context, api S3DeleteObjectAPI, location Location) error
+	PutEmailRaw(ctx context.Context, api S3PutObjectAPI, messageID string, raw []byte) error
+	GetEmailRawAt(ctx context.Context, api S3GetObjectAPI, location Location) ([]byte, error)
+	OpenEmailRaw(ctx context.Context, api S3GetObjectAPI, location Location) (io.ReadCloser, error)
+	OpenEmailHTML(ctx context.Context, api S3GetObjectAPI, location Location) (*EmailHTML, error)
+	GetEmailHeaders(ctx context.Context, api S3GetObjectAPI, location Location) (types.Headers, error)
+	GetEmailContent(ctx context.Context, api S3GetObjectAPI, location Location, disposition, contentID string) (*GetEmailContentResult, error)
+	GetAttachedEmail(ctx context.Context, api S3GetObjectAPI, location Location, index int) (*types.AttachedEmail, error)
+	CopyAttachmentsToUploads(ctx context.Context, api S3CopyToUploadAPI, location Location) ([]StoredUpload, error)
+	CopyRawToUpload(ctx context.Context, api S3CopyToUploadAPI, location Location) (string, error)
 }
 
+// DefaultStorageTimeout is the timeout of S3 operations on raw emails if STORAGE_TIMEOUT is not set,
+// which includes reading streamed emails until they are closed
+const DefaultStorageTimeout = 30 * time.Second
+
 type s3Storage struct{}
 
 // S3 holds functions that handles S3 related operations
@@ -43,67 +63,131 @@ var S3 S3Storage = s3Storage{}
 // readEmailEnvelope is used in GetEmail will be mocked in unit testing
 var readEmailEnvelope = enmime.ReadEnvelope
 
+// readPrunedEnvelope parses an email without buffering large parts, see LargePartThreshold
+func readPrunedEnvelope(r io.Reader) (*enmime.Envelope, error) {
+	pruned, err := pruneLargeParts(r, LargePartThreshold)
+	if err != nil {
+		return nil, err
+	}
+	return readEmailEnvelope(bytes.NewReader(pruned))
+}
+
 // S3GetObjectAPI defines set of API required by GetEmail functions
 type S3GetObjectAPI interface {
 	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 }
 
-// GetEmail retrieves an email from s3 bucket
-func (s s3Storage) GetEmail(ctx context.Context, api S3GetObjectAPI, messageID string) (*GetEmailResult, error) {
-	object, err := api.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: &env.S3Bucket,
-		Key:    &messageID,
-	})
+// GetEmailAt retrieves an email from the given location.
+// The object is parsed as it's streamed, so that large emails are not read into memory before parsing.
+func (s s3Storage) GetEmailAt(ctx context.Context, api S3GetObjectAPI, location Location) (*GetEmailResult, error) {
+	object, err := getRawObject(ctx, api, location, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer object.Body.Close()
+	defer object.Close()
 
-	env, err := readEmailEnvelope(object.Body)
+	body := &countingReader{r: object}
+	env, err := readPrunedEnvelope(body)
 	if err != nil {
 		return nil, err
 	}
-	return &GetEmailResult{
-		Text:        env.Text,
-		HTML:        env.HTML,
-		Attachments: ParseFiles(env.Attachments),
-		Inlines:     ParseFiles(env.Inlines),
-		OtherParts:  ParseFiles(env.OtherParts),
-	}, nil
+	result := &GetEmailResult{
+		Text:           env.Text,
+		HTML:           env.HTML,
+		Attachments:    ParseFiles(env.Attachments),
+		Inlines:        ParseFiles(env.Inlines),
+		OtherParts:     ParseFiles(env.OtherParts),
+		AttachedEmails: ParseAttachedEmails(env.Attachments),
+	}
+	detectOmittedContentTypes(ctx, api, location, env.Attachments, result.Attachments)
+	detectOmittedContentTypes(ctx, api, location, env.Inlines, result.Inlines)
+	detectOmittedContentTypes(ctx, api, location, env.OtherParts, result.OtherParts)
+	result.Stats = newEmailStats(body.n, env, result)
+	return result, nil
 }
 
-// GetEmailRaw retrieves raw MIME email from s3 bucket
-func (s s3Storage) GetEmailRaw(ctx context.Context, api S3GetObjectAPI, messageID string) ([]byte, error) {
-	object, err := api.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: &env.S3Bucket,
-		Key:    &messageID,
-	})
+// detectOmittedContentTypes detects the content types of omitted parts by reading the beginning of their bodies
+func detectOmittedContentTypes(ctx context.Context, api S3GetObjectAPI, location Location, parts []*enmime.Part, files types.Files) {
+	for i, part := range parts {
+		if files[i].Length == 0 {
+			continue
+		}
+		head, err := readPartHead(ctx, api, location, part, sniff.HeadSize)
+		if err != nil {
+			fmt.Printf("failed to read the beginning of part %s, %v\n", part.FileName, err)
+			continue
+		}
+		files[i].SetDetectedContentType(sniff.Detect(head))
+	}
+}
+
+// GetEmailRawAt retrieves raw MIME email stored at location
+func (s s3Storage) GetEmailRawAt(ctx context.Context, api S3GetObjectAPI, location Location) ([]byte, error) {
+	object, err := getRawObject(ctx, api, location, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer object.Body.Close()
+	defer object.Close()
 
-	raw, err := io.ReadAll(object.Body)
+	raw, err := io.ReadAll(object)
 	return raw, err
 }
 
+// GetEmailHeaders retrieves the header fields of a raw MIME email stored at location, in their original order
+func (s s3Storage) GetEmailHeaders(ctx context.Context, api S3GetObjectAPI, location Location) (types.Headers, error) {
+	object, err := getRawObject(ctx, api, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return ReadHeaders(object)
+}
+
+// ReadHeaders reads the header section of a MIME message, unfolding multi-line fields
+func ReadHeaders(r io.Reader) (types.Headers, error) {
+	headers := types.Headers{}
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed == "" {
+			// end of header section
+			return headers, nil
+		}
+
+		if (trimmed[0] == ' ' || trimmed[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1].Value += " " + strings.TrimSpace(trimmed)
+		} else if name, value, ok := strings.Cut(trimmed, ":"); ok {
+			headers = append(headers, types.Header{
+				Name:  strings.TrimSpace(name),
+				Value: strings.TrimSpace(value),
+			})
+		}
+
+		if err == io.EOF {
+			return headers, nil
+		}
+	}
+}
+
 type GetEmailContentResult struct {
 	types.File
 	Content []byte
 }
 
-// GetEmailContent retrieved the attachment of inline of an email from s3 bucket
-func (s s3Storage) GetEmailContent(ctx context.Context, api S3GetObjectAPI, messageID, disposition, contentID string) (*GetEmailContentResult, error) {
-	object, err := api.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: &env.S3Bucket,
-		Key:    &messageID,
-	})
+// GetEmailContent retrieved the attachment of inline of an email stored at location
+func (s s3Storage) GetEmailContent(ctx context.Context, api S3GetObjectAPI, location Location, disposition, contentID string) (*GetEmailContentResult, error) {
+	object, err := getRawObject(ctx, api, location, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer object.Body.Close()
+	defer object.Close()
 
-	env, err := readEmailEnvelope(object.Body)
+	env, err := readPrunedEnvelope(object)
 	if err != nil {
 		return nil, err
 	}
@@ -124,15 +208,22 @@ func (s s3Storage) GetEmailContent(ctx context.Context, api S3GetObjectAPI, mess
 	// find the part with the correct contentID
 	for _, part := range parts {
 		if part.ContentID == contentID {
-			return &GetEmailContentResult{
+			content, err := readPartContent(ctx, api, location, part)
+			if err != nil {
+				return nil, err
+			}
+			result := &GetEmailContentResult{
 				File: types.File{
 					ContentID:         part.ContentID,
 					ContentType:       part.ContentType,
 					ContentTypeParams: part.ContentTypeParams,
 					Filename:          part.FileName,
+					Size:              int64(len(content)),
 				},
-				Content: part.Content,
-			}, nil
+				Content: content,
+			}
+			result.SetDetectedContentType(sniff.Detect(content))
+			return result, nil
 		}
 	}
 	return nil, nil
@@ -143,11 +234,14 @@ type S3DeleteObjectAPI interface {
 	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
 }
 
-// DeleteEmail deletes an email from S3 bucket
-func (s s3Storage) DeleteEmail(ctx context.Context, api S3DeleteObjectAPI, messageID string) error {
+// DeleteEmail deletes the raw email stored at location
+func (s s3Storage) DeleteEmail(ctx context.Context, api S3DeleteObjectAPI, location Location) error {
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
 	_, err := api.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: &env.S3Bucket,
-		Key:    &messageID,
+		Bucket: &location.Bucket,
+		Key:    &location.Key,
 	})
 	if err != nil {
 		return err
@@ -156,6 +250,44 @@ func (s s3Storage) DeleteEmail(ctx context.Context, api S3DeleteObjectAPI, messa
 	return nil
 }
 
+// S3PutObjectAPI defines set of API required by PutEmailRaw functions
+type S3PutObjectAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// PutEmailRaw stores a raw MIME email in s3 bucket, where the SES S3 action stores received emails,
+// e.g. for emails imported from other providers
+func (s s3Storage) PutEmailRaw(ctx context.Context, api S3PutObjectAPI, messageID string, raw []byte) error {
+	location := DefaultLocation(messageID)
+	input := &s3.PutObjectInput{
+		Bucket:      &location.Bucket,
+		Key:         &location.Key,
+		Body:        bytes.NewReader(raw),
+		ContentType: aws.String("message/rfc822"),
+	}
+	if err := withRetention(input); err != nil {
+		return err
+	}
+
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+	_, err := api.PutObject(ctx, input)
+	return err
+}
+
+// inspectZip records the file listing of zip archives
+func inspectZip(file *types.File, content []byte) {
+	if !attachment.IsZip(*file) {
+		return
+	}
+	manifest, err := attachment.InspectZip(content)
+	if err != nil {
+		fmt.Printf("failed to inspect zip attachment %s, %v\n", file.Filename, err)
+		return
+	}
+	file.Zip = manifest
+}
+
 // ParseFiles parses enmime parts into File slice
 func ParseFiles(parts []*enmime.Part) types.Files {
 	files := make([]types.File, len(parts))
@@ -165,6 +297,14 @@ func ParseFiles(parts []*enmime.Part) types.Files {
 			ContentType:       part.ContentType,
 			ContentTypeParams: part.ContentTypeParams,
 			Filename:          part.FileName,
+			Size:              partSize(part),
+		}
+		if offset, length, ok := omittedPartRange(part); ok {
+			files[i].Offset = offset
+			files[i].Length = length
+		} else {
+			files[i].SetDetectedContentType(sniff.Detect(part.Content))
+			inspectZip(&files[i], part.Content)
 		}
 	}
 	return files
@@ -10,6 +10,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
 	"github.com/jhillyerd/enmime"
 	"github.com/stretchr/testify/assert"
 )
@@ -83,7 +84,7 @@ func TestS3_GetEmail(t *testing.T) {
 
 			readEmailEnvelope = test.readEmailEnvelope
 
-			response, err := S3.GetEmail(ctx, test.client(t), test.messageID)
+			response, err := S3.GetEmailAt(ctx, test.client(t), DefaultLocation(test.messageID))
 			assert.Equal(t, test.expectedErr, err)
 			if response != nil {
 				assert.Equal(t, test.expectedText, response.Text)
@@ -134,7 +135,7 @@ func TestS3_GetEmailRaw(t *testing.T) {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			ctx := context.TODO()
 
-			response, err := S3.GetEmailRaw(ctx, test.client(t), test.messageID)
+			response, err := S3.GetEmailRawAt(ctx, test.client(t), DefaultLocation(test.messageID))
 			assert.Equal(t, test.expectedErr, err)
 			if response != nil {
 				assert.Equal(t, test.expectedRaw, response)
@@ -143,6 +144,74 @@ func TestS3_GetEmailRaw(t *testing.T) {
 	}
 }
 
+func TestS3_GetEmailHeaders(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+
+	cases := []struct {
+		client          func(t *testing.T) S3GetObjectAPI
+		messageID       string
+		expectedHeaders types.Headers
+		expectedErr     error
+	}{
+		{
+			client: func(t *testing.T) S3GetObjectAPI {
+				return mockGetObjectAPI(func(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+					t.Helper()
+					assert.Equal(t, env.S3Bucket, *params.Bucket)
+					assert.Equal(t, "exampleMessageID", *params.Key)
+
+					raw := "Received: from a.example.com\r\n\tby b.example.com; Tue, 12 Mar 2024 10:10:10 +0000\r\n" +
+						"From: Example <example@example.com>\r\n" +
+						"Subject: Hello\r\n" +
+						"\r\n" +
+						"Body: not a header\r\n"
+					return &s3.GetObjectOutput{
+						Body: io.NopCloser(bytes.NewReader([]byte(raw))),
+					}, nil
+				})
+			},
+			messageID: "exampleMessageID",
+			expectedHeaders: types.Headers{
+				{Name: "Received", Value: "from a.example.com by b.example.com; Tue, 12 Mar 2024 10:10:10 +0000"},
+				{Name: "From", Value: "Example <example@example.com>"},
+				{Name: "Subject", Value: "Hello"},
+			},
+		},
+		{
+			client: func(t *testing.T) S3GetObjectAPI {
+				return mockGetObjectAPI(func(_ context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+					t.Helper()
+					return &s3.GetObjectOutput{
+						Body: io.NopCloser(bytes.NewReader([]byte("Subject: no body"))),
+					}, nil
+				})
+			},
+			expectedHeaders: types.Headers{
+				{Name: "Subject", Value: "no body"},
+			},
+		},
+		{
+			client: func(t *testing.T) S3GetObjectAPI {
+				return mockGetObjectAPI(func(_ context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+					t.Helper()
+					return &s3.GetObjectOutput{}, errors.New("some-error")
+				})
+			},
+			expectedErr: errors.New("some-error"),
+		},
+	}
+
+	for i, test := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.TODO()
+
+			headers, err := S3.GetEmailHeaders(ctx, test.client(t), DefaultLocation(test.messageID))
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expectedHeaders, headers)
+		})
+	}
+}
+
 type mockDeleteObjectAPI func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
 
 func (m mockDeleteObjectAPI) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
@@ -186,7 +255,44 @@ func TestS3_DeleteEmail(t *testing.T) {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			ctx := context.TODO()
 
-			err := S3.DeleteEmail(ctx, test.client(t), test.messageID)
+			err := S3.DeleteEmail(ctx, test.client(t), DefaultLocation(test.messageID))
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+}
+
+type mockPutObjectAPI func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+
+func (m mockPutObjectAPI) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func TestS3_PutEmailRaw(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.S3Prefix = "emails/"
+	defer func() { env.S3Prefix = "" }()
+
+	tests := []struct {
+		err         error
+		expectedErr error
+	}{
+		{nil, nil},
+		{errors.New("some-error"), errors.New("some-error")},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := mockPutObjectAPI(func(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				assert.Equal(t, "test_bucket", *params.Bucket)
+				assert.Equal(t, "emails/exampleMessageID", *params.Key)
+				assert.Equal(t, "message/rfc822", *params.ContentType)
+				body, err := io.ReadAll(params.Body)
+				assert.Nil(t, err)
+				assert.Equal(t, "raw", string(body))
+				return &s3.PutObjectOutput{}, test.err
+			})
+
+			err := S3.PutEmailRaw(context.TODO(), client, "exampleMessageID", []byte("raw"))
 			assert.Equal(t, test.expectedErr, err)
 		})
 	}
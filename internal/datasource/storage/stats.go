@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"io"
+	"strings"
+
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/jhillyerd/enmime"
+)
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// newEmailStats returns the statistics of a parsed email, whose raw size is rawSize
+func newEmailStats(rawSize int64, env *enmime.Envelope, result *GetEmailResult) types.EmailStats {
+	stats := types.EmailStats{
+		RawSize:         rawSize,
+		TextSize:        int64(len(result.Text)),
+		HTMLSize:        int64(len(result.HTML)),
+		AttachmentCount: len(result.Attachments),
+		AttachmentSize:  result.Attachments.TotalSize(),
+		InlineCount:     len(result.Inlines),
+		InlineSize:      result.Inlines.TotalSize(),
+		OtherPartCount:  len(result.OtherParts),
+	}
+	stats.PartCount, stats.LeafCount = countParts(env.Root)
+	return stats
+}
+
+// countParts returns the number of parts in the tree rooted at part, and the number of those without children
+func countParts(part *enmime.Part) (parts, leaves int) {
+	if part == nil {
+		return 0, 0
+	}
+	if part.FirstChild == nil {
+		return 1, 1
+	}
+	parts = 1
+	for child := part.FirstChild; child != nil; child = child.NextSibling {
+		p, l := countParts(child)
+		parts += p
+		leaves += l
+	}
+	return parts, leaves
+}
+
+// partSize returns the decoded size of a part, which is estimated from the encoded length for omitted parts
+func partSize(part *enmime.Part) int64 {
+	_, length, ok := omittedPartRange(part)
+	if !ok {
+		return int64(len(part.Content))
+	}
+	if strings.EqualFold(strings.TrimSpace(part.Header.Get("Content-Transfer-Encoding")), "base64") {
+		// base64 encodes 3 bytes in 4, in lines of 76 characters followed by CRLF
+		chars := length - 2*(length/78)
+		return chars / 4 * 3
+	}
+	return length
+}
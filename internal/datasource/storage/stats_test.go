@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/jhillyerd/enmime"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3_GetEmail_Stats(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	readEmailEnvelope = enmime.ReadEnvelope
+	oldThreshold := LargePartThreshold
+	defer func() { LargePartThreshold = oldThreshold }()
+
+	client := mockGetObjectAPI(func(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+		raw := rawWithLargeAttachment
+		if params.Range != nil {
+			raw = "QUJD" // only the beginning is read for content type detection
+		}
+		return &s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader([]byte(raw))),
+		}, nil
+	})
+
+	tests := []struct {
+		threshold      int64
+		attachmentSize int64
+	}{
+		{threshold: 1 << 20, attachmentSize: 26},
+		{threshold: 10, attachmentSize: 27}, // estimated from the encoded length
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			LargePartThreshold = test.threshold
+			result, err := S3.GetEmailAt(context.TODO(), client, DefaultLocation("exampleMessageID"))
+			assert.Nil(t, err)
+			assert.Equal(t, types.EmailStats{
+				RawSize:         int64(len(rawWithLargeAttachment)),
+				TextSize:        5,
+				AttachmentCount: 1,
+				AttachmentSize:  test.attachmentSize,
+				PartCount:       4,
+				LeafCount:       2,
+			}, result.Stats)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// EmailHTML is the HTML body of an email, which must be closed after it's read
+type EmailHTML struct {
+	Body    io.ReadCloser
+	Charset string
+}
+
+// OpenEmailRaw returns the raw MIME email as a stream, so that large emails are not read into memory
+func (s s3Storage) OpenEmailRaw(ctx context.Context, api S3GetObjectAPI, location Location) (io.ReadCloser, error) {
+	return getRawObject(ctx, api, location, nil)
+}
+
+// OpenEmailHTML returns the HTML body of an email, or nil if it has none.
+// Bodies larger than LargePartThreshold are omitted when parsing, so they are streamed from S3 in their original charset,
+// while other bodies are decoded to UTF-8.
+func (s s3Storage) OpenEmailHTML(ctx context.Context, api S3GetObjectAPI, location Location) (*EmailHTML, error) {
+	object, err := getRawObject(ctx, api, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	env, err := readPrunedEnvelope(object)
+	object.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if env.HTML != "" {
+		return &EmailHTML{
+			Body:    io.NopCloser(strings.NewReader(env.HTML)),
+			Charset: "utf-8",
+		}, nil
+	}
+
+	part := env.Root.BreadthMatchFirst(func(p *enmime.Part) bool {
+		return p.ContentType == "text/html" && p.Disposition != "attachment"
+	})
+	if part == nil {
+		return nil, nil
+	}
+	offset, length, ok := omittedPartRange(part)
+	if !ok || length == 0 {
+		return nil, nil
+	}
+	body, err := openOmittedPart(ctx, api, location, part, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	charset := part.Charset
+	if charset == "" {
+		charset = "us-ascii"
+	}
+	return &EmailHTML{
+		Body:    body,
+		Charset: charset,
+	}, nil
+}
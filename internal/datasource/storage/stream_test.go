@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/jhillyerd/enmime"
+	"github.com/stretchr/testify/assert"
+)
+
+func newHTMLEmail(contentType, encoding, body string) string {
+	return "From: a@example.com\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/alternative; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"hello\r\n" +
+		"--b\r\n" +
+		"Content-Type: " + contentType + "\r\n" +
+		"Content-Transfer-Encoding: " + encoding + "\r\n" +
+		"\r\n" +
+		body + "\r\n" +
+		"--b--\r\n"
+}
+
+func TestS3_OpenEmailRaw(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	raw := newHTMLEmail("text/html", "7bit", "<p>hello</p>")
+	store := &mockObjectStore{objects: map[string]mockObject{"exampleMessageID": {body: []byte(raw)}}}
+
+	body, err := S3.OpenEmailRaw(context.TODO(), store, DefaultLocation("exampleMessageID"))
+	assert.Nil(t, err)
+	defer body.Close()
+	actual, err := io.ReadAll(body)
+	assert.Nil(t, err)
+	assert.Equal(t, raw, string(actual))
+}
+
+func TestS3_OpenEmailHTML(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	readEmailEnvelope = enmime.ReadEnvelope
+	oldThreshold := LargePartThreshold
+	LargePartThreshold = 20
+	defer func() { LargePartThreshold = oldThreshold }()
+
+	tests := []struct {
+		raw             string
+		expected        string
+		expectedCharset string
+		expectedNil     bool
+	}{
+		{
+			raw:             newHTMLEmail("text/html; charset=utf-8", "7bit", "<p>hi</p>"),
+			expected:        "<p>hi</p>",
+			expectedCharset: "utf-8",
+		},
+		{
+			// omitted when parsing, and decoded as it's streamed
+			raw:             newHTMLEmail("text/html; charset=iso-8859-1", "base64", "PHA+aGVsbG8sIHdvcmxkIGZyb20gYSBsYXJnZSBwYXJ0PC9wPg=="),
+			expected:        "<p>hello, world from a large part</p>",
+			expectedCharset: "iso-8859-1",
+		},
+		{
+			raw:             newHTMLEmail("text/html", "quoted-printable", "<p>a long line that is=\r\n split by soft breaks</p>"),
+			expected:        "<p>a long line that is split by soft breaks</p>",
+			expectedCharset: "us-ascii",
+		},
+		{
+			raw:         newHTMLEmail("text/plain", "7bit", "no html"),
+			expectedNil: true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			store := &mockObjectStore{objects: map[string]mockObject{"exampleMessageID": {body: []byte(test.raw)}}}
+
+			html, err := S3.OpenEmailHTML(context.TODO(), store, DefaultLocation("exampleMessageID"))
+			assert.Nil(t, err)
+			if test.expectedNil {
+				assert.Nil(t, html)
+				return
+			}
+			defer html.Body.Close()
+			actual, err := io.ReadAll(html.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, strings.TrimSpace(string(actual)))
+			assert.Equal(t, test.expectedCharset, html.Charset)
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+const (
+	// UploadExpiry is how long a pre-signed upload can be used
+	UploadExpiry = 15 * time.Minute
+	// DefaultUploadMaxSize is the maximum size of an upload if UPLOAD_MAX_SIZE is not set
+	DefaultUploadMaxSize = 10 << 20
+)
+
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Upload is a pre-signed POST of S3, used by clients to upload an attachment of a draft directly to S3.
+// The form must include Fields before the file, and is sent to URL.
+type Upload struct {
+	UploadID string            `json:"uploadID"`
+	URL      string            `json:"url"`
+	Fields   map[string]string `json:"fields"`
+	Expires  string            `json:"expires"` // RFC3339
+	MaxSize  int64             `json:"maxSize"` // in bytes
+}
+
+// UploadLocation returns the location of an upload, which is under the uploads/ prefix next to the raw emails
+func UploadLocation(uploadID string) Location {
+	return Location{
+		Bucket: env.S3Bucket,
+		Key:    env.S3Prefix + "uploads/" + uploadID,
+	}
+}
+
+// ValidUploadID returns true if id is generated by PresignUpload, so that it can't refer to other objects
+func ValidUploadID(id string) bool {
+	return uploadIDPattern.MatchString(id)
+}
+
+// newUploadID returns a new ID of an upload, which is valid by ValidUploadID
+func newUploadID() string {
+	return strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+// UploadMaxSize returns the maximum size of uploads, configured by UPLOAD_MAX_SIZE
+func UploadMaxSize() (int64, error) {
+	if env.UploadMaxSize == "" {
+		return DefaultUploadMaxSize, nil
+	}
+	size, err := strconv.ParseInt(env.UploadMaxSize, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid UPLOAD_MAX_SIZE %q", env.UploadMaxSize)
+	}
+	return size, nil
+}
+
+// PresignUpload returns a pre-signed POST that uploads a file of contentType to a new location in S3_BUCKET.
+// The policy limits the file to contentType and UPLOAD_MAX_SIZE, and expires after UploadExpiry.
+func PresignUpload(ctx context.Context, provider aws.CredentialsProvider, contentType string) (*Upload, error) {
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	maxSize, err := UploadMaxSize()
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := provider.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadID := newUploadID()
+	location := UploadLocation(uploadID)
+	signedAt := now().UTC()
+	expires := signedAt.Add(UploadExpiry)
+	date := signedAt.Format("20060102")
+
+	fields := map[string]string{
+		"key":              location.Key,
+		"Content-Type":     contentType,
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": fmt.Sprintf("%s/%s/%s/s3/aws4_request", credentials.AccessKeyID, date, env.Region),
+		"x-amz-date":       signedAt.Format("20060102T150405Z"),
+	}
+	if credentials.SessionToken != "" {
+		fields["x-amz-security-token"] = credentials.SessionToken
+	}
+
+	conditions := []interface{}{
+		map[string]string{"bucket": location.Bucket},
+		[]interface{}{"content-length-range", 1, maxSize},
+	}
+	for _, name := range []string{"key", "Content-Type", "x-amz-algorithm", "x-amz-credential", "x-amz-date", "x-amz-security-token"} {
+		if value, ok := fields[name]; ok {
+			conditions = append(conditions, map[string]string{name: value})
+		}
+	}
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": expires.Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	encodedPolicy := base64.StdEncoding.EncodeToString(policy)
+	fields["policy"] = encodedPolicy
+	fields["x-amz-signature"] = signPolicy(credentials.SecretAccessKey, date, env.Region, encodedPolicy)
+
+	return &Upload{
+		UploadID: uploadID,
+		URL:      fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", location.Bucket, env.Region),
+		Fields:   fields,
+		Expires:  expires.Format(time.RFC3339),
+		MaxSize:  maxSize,
+	}, nil
+}
+
+// signPolicy returns the Signature Version 4 signature of a POST policy
+func signPolicy(secretAccessKey, date, region, encodedPolicy string) string {
+	key := []byte("AWS4" + secretAccessKey)
+	for _, data := range []string{date, region, "s3", "aws4_request", encodedPolicy} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(data))
+		key = mac.Sum(nil)
+	}
+	return hex.EncodeToString(key)
+}
+
+// GetUpload returns the content of an upload
+func GetUpload(ctx context.Context, api S3GetObjectAPI, uploadID string) ([]byte, error) {
+	location := UploadLocation(uploadID)
+	object, err := api.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &location.Bucket,
+		Key:    &location.Key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+	return io.ReadAll(object.Body)
+}
+
+// S3CopyToUploadAPI defines set of API required by CopyAttachmentsToUploads and CopyRawToUpload
+type S3CopyToUploadAPI interface {
+	S3GetObjectAPI
+	S3PutObjectAPI
+}
+
+// StoredUpload is a file stored as an upload by the mailbox, e.g. an attachment of a forwarded email
+type StoredUpload struct {
+	UploadID    string
+	Filename    string
+	ContentType string
+}
+
+// CopyAttachmentsToUploads stores the attachments of an email as uploads, so that they can be attached to a draft.
+// Attachments without a content type are stored as application/octet-stream.
+func (s s3Storage) CopyAttachmentsToUploads(ctx context.Context, api S3CopyToUploadAPI, location Location) ([]StoredUpload, error) {
+	object, err := getRawObject(ctx, api, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	envelope, err := readPrunedEnvelope(object)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := make([]StoredUpload, 0, len(envelope.Attachments))
+	for i, part := range envelope.Attachments {
+		content, err := readPartContent(ctx, api, location, part)
+		if err != nil {
+			return nil, err
+		}
+		upload := StoredUpload{
+			Filename:    part.FileName,
+			ContentType: part.ContentType,
+		}
+		if upload.Filename == "" {
+			upload.Filename = fmt.Sprintf("attachment-%d", i+1)
+		}
+		if _, _, err := mime.ParseMediaType(upload.ContentType); err != nil {
+			upload.ContentType = "application/octet-stream"
+		}
+		upload.UploadID, err = putUpload(ctx, api, content, upload.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
+
+// CopyRawToUpload stores the raw message of an email as an upload of message/rfc822, and returns its ID
+func (s s3Storage) CopyRawToUpload(ctx context.Context, api S3CopyToUploadAPI, location Location) (string, error) {
+	raw, err := s.GetEmailRawAt(ctx, api, location)
+	if err != nil {
+		return "", err
+	}
+	return putUpload(ctx, api, raw, "message/rfc822")
+}
+
+// putUpload stores content at the location of a new upload, and returns its ID
+func putUpload(ctx context.Context, api S3PutObjectAPI, content []byte, contentType string) (string, error) {
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	uploadID := newUploadID()
+	location := UploadLocation(uploadID)
+	_, err := api.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &location.Bucket,
+		Key:         &location.Key,
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+	return uploadID, nil
+}
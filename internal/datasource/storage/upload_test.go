@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadMaxSize(t *testing.T) {
+	defer func() { env.UploadMaxSize = "" }()
+
+	tests := []struct {
+		value       string
+		expected    int64
+		expectedErr bool
+	}{
+		{"", DefaultUploadMaxSize, false},
+		{"1024", 1024, false},
+		{"0", 0, true},
+		{"10MB", 0, true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.UploadMaxSize = test.value
+			size, err := UploadMaxSize()
+			assert.Equal(t, test.expectedErr, err != nil)
+			assert.Equal(t, test.expected, size)
+		})
+	}
+}
+
+func TestPresignUpload(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.S3Prefix = "emails/"
+	env.Region = "us-west-2"
+	now = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC) }
+	defer func() {
+		env.S3Prefix = ""
+		env.Region = ""
+		now = time.Now
+	}()
+
+	provider := credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", "token")
+	upload, err := PresignUpload(context.TODO(), provider, "application/pdf")
+	assert.Nil(t, err)
+
+	assert.True(t, ValidUploadID(upload.UploadID))
+	assert.Equal(t, "https://test_bucket.s3.us-west-2.amazonaws.com/", upload.URL)
+	assert.Equal(t, "2023-01-02T03:19:05Z", upload.Expires)
+	assert.Equal(t, int64(DefaultUploadMaxSize), upload.MaxSize)
+	assert.Equal(t, "emails/uploads/"+upload.UploadID, upload.Fields["key"])
+	assert.Equal(t, "application/pdf", upload.Fields["Content-Type"])
+	assert.Equal(t, "AKIDEXAMPLE/20230102/us-west-2/s3/aws4_request", upload.Fields["x-amz-credential"])
+	assert.Equal(t, "20230102T030405Z", upload.Fields["x-amz-date"])
+	assert.Equal(t, "token", upload.Fields["x-amz-security-token"])
+	assert.Equal(t, signPolicy("secret", "20230102", "us-west-2", upload.Fields["policy"]), upload.Fields["x-amz-signature"])
+
+	data, err := base64.StdEncoding.DecodeString(upload.Fields["policy"])
+	assert.Nil(t, err)
+	var policy struct {
+		Expiration string            `json:"expiration"`
+		Conditions []json.RawMessage `json:"conditions"`
+	}
+	assert.Nil(t, json.Unmarshal(data, &policy))
+	assert.Equal(t, "2023-01-02T03:19:05.000Z", policy.Expiration)
+	assert.Equal(t, `{"bucket":"test_bucket"}`, string(policy.Conditions[0]))
+	assert.Equal(t, `["content-length-range",1,10485760]`, string(policy.Conditions[1]))
+	assert.Len(t, policy.Conditions, 8)
+
+	_, err = PresignUpload(context.TODO(), provider, "")
+	assert.NotNil(t, err)
+}
+
+func TestSignPolicy(t *testing.T) {
+	// example of the S3 documentation of browser-based uploads using POST
+	policy := "eyAiZXhwaXJhdGlvbiI6ICIyMDE1LTEyLTMwVDEyOjAwOjAwLjAwMFoiLA0KICAiY29uZGl0aW9ucyI6IFsNCiAgICB7ImJ1Y2tldCI6ICJzaWd2NGV4YW1wbGVidWNrZXQifSwNCiAgICBbInN0YXJ0cy13aXRoIiwgIiRrZXkiLCAidXNlci91c2VyMS8iXSwNCiAgICB7ImFjbCI6ICJwdWJsaWMtcmVhZCJ9LA0KICAgIHsic3VjY2Vzc19hY3Rpb25fcmVkaXJlY3QiOiAiaHR0cDovL3NpZ3Y0ZXhhbXBsZWJ1Y2tldC5zMy5hbWF6b25hd3MuY29tL3N1Y2Nlc3NmdWxfdXBsb2FkLmh0bWwifSwNCiAgICBbInN0YXJ0cy13aXRoIiwgIiRDb250ZW50LVR5cGUiLCAiaW1hZ2UvIl0sDQogICAgeyJ4LWFtei1tZXRhLXV1aWQiOiAiMTQzNjUxMjM2NTEyNzQifSwNCiAgICB7IngtYW16LXNlcnZlci1zaWRlLWVuY3J5cHRpb24iOiAiQUVTMjU2In0sDQogICAgWyJzdGFydHMtd2l0aCIsICIkeC1hbXotbWV0YS10YWciLCAiIl0sDQoNCiAgICB7IngtYW16LWNyZWRlbnRpYWwiOiAiQUtJQUlPU0ZPRE5ON0VYQU1QTEUvMjAxNTEyMjkvdXMtZWFzdC0xL3MzL2F3czRfcmVxdWVzdCJ9LA0KICAgIHsieC1hbXotYWxnb3JpdGhtIjogIkFXUzQtSE1BQy1TSEEyNTYifSwNCiAgICB7IngtYW16LWRhdGUiOiAiMjAxNTEyMjlUMDAwMDAwWiIgfQ0KICBdDQp9"
+	signature := signPolicy("wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", "20151229", "us-east-1", policy)
+	assert.Equal(t, "8afdbf4008c03f22c2cd3cdb72e4afbb1f6a588f3255ac628749a66d7f09699e", signature)
+}
+
+func TestGetUpload(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	store := &mockObjectStore{objects: map[string]mockObject{
+		"uploads/0123456789abcdef0123456789abcdef": {body: []byte("content")},
+	}}
+
+	content, err := GetUpload(context.TODO(), store, "0123456789abcdef0123456789abcdef")
+	assert.Nil(t, err)
+	assert.Equal(t, "content", string(content))
+
+	_, err = GetUpload(context.TODO(), store, "fedcba9876543210fedcba9876543210")
+	assert.NotNil(t, err)
+}
+
+func TestCopyToUploads(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	raw := "From: sender@example.com\r\n" +
+		"To: me@example.com\r\n" +
+		"Subject: report\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"see attached\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/csv; name=report.csv\r\n" +
+		"Content-Disposition: attachment; filename=report.csv\r\n" +
+		"\r\n" +
+		"a,b\r\n" +
+		"--b--\r\n"
+	store := &mockObjectStore{objects: map[string]mockObject{
+		"exampleMessageID": {body: []byte(raw)},
+	}}
+
+	uploads, err := S3.CopyAttachmentsToUploads(context.TODO(), store, DefaultLocation("exampleMessageID"))
+	assert.Nil(t, err)
+	if assert.Len(t, uploads, 1) {
+		assert.True(t, ValidUploadID(uploads[0].UploadID))
+		assert.Equal(t, "report.csv", uploads[0].Filename)
+		assert.Equal(t, "text/csv", uploads[0].ContentType)
+		content, err := GetUpload(context.TODO(), store, uploads[0].UploadID)
+		assert.Nil(t, err)
+		assert.Equal(t, "a,b", strings.TrimSpace(string(content)))
+	}
+
+	uploadID, err := S3.CopyRawToUpload(context.TODO(), store, DefaultLocation("exampleMessageID"))
+	assert.Nil(t, err)
+	content, err := GetUpload(context.TODO(), store, uploadID)
+	assert.Nil(t, err)
+	assert.Equal(t, raw, string(content))
+
+	_, err = S3.CopyAttachmentsToUploads(context.TODO(), store, DefaultLocation("missingMessageID"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,275 @@
+// Package digest sends summaries of unread and starred emails received since the last digest,
+// so that mailboxes that are rarely checked don't miss anything.
+package digest
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+const (
+	// MaxEmails is the maximum number of emails listed in a digest
+	MaxEmails = 100
+	// DefaultSince is how far back the first digest looks
+	DefaultSince = 24 * time.Hour
+	// MaxLookback is how far back a digest looks, e.g. after digests are disabled for a while
+	MaxLookback = 7 * 24 * time.Hour
+
+	pageSize = 100
+)
+
+var getCurrentTime = func() time.Time {
+	return time.Now().UTC()
+}
+
+// Settings are the recipient and the label filter of digests
+type Settings struct {
+	To             string
+	From           string   // verified sender in SES, To if empty
+	Labels         []string // emails with any of the labels are included, or all emails if empty
+	ExcludedLabels []string // emails with any of the labels are excluded
+}
+
+// SettingsFromEnv returns the settings from DIGEST_TO, DIGEST_FROM and DIGEST_LABELS,
+// where labels prefixed with '-' are excluded. Digests are disabled if To is empty.
+func SettingsFromEnv() Settings {
+	settings := Settings{
+		To:   strings.TrimSpace(env.DigestTo),
+		From: strings.TrimSpace(env.DigestFrom),
+	}
+	for _, label := range strings.Split(env.DigestLabels, ",") {
+		label = strings.TrimSpace(label)
+		if excluded, ok := strings.CutPrefix(label, "-"); ok {
+			if excluded = strings.TrimSpace(excluded); excluded != "" {
+				settings.ExcludedLabels = append(settings.ExcludedLabels, excluded)
+			}
+		} else if label != "" {
+			settings.Labels = append(settings.Labels, label)
+		}
+	}
+	return settings
+}
+
+// Enabled returns true if digests have a recipient
+func (s Settings) Enabled() bool {
+	return s.To != ""
+}
+
+// includes returns true if an email is unread or starred, and passes the label filter
+func (s Settings) includes(item email.Item) bool {
+	if (item.Unread == nil || !*item.Unread) && !item.Flagged {
+		return false
+	}
+	if hasAnyLabel(item.Labels, s.ExcludedLabels) {
+		return false
+	}
+	return len(s.Labels) == 0 || hasAnyLabel(item.Labels, s.Labels)
+}
+
+func hasAnyLabel(labels, targets []string) bool {
+	for _, label := range labels {
+		for _, target := range targets {
+			if strings.EqualFold(label, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SendAPI defines set of API required to send an email to the recipient of digests
+type SendAPI interface {
+	SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+}
+
+// RunAPI defines set of API required to send a digest
+type RunAPI interface {
+	api.ListEmailsAPI
+	api.GetItemAPI // to get the time of the last digest
+	api.PutItemAPI // to save the time of the digest
+	SendAPI
+}
+
+// Result is the outcome of a digest run
+type Result struct {
+	Since     string `json:"since"`
+	Count     int    `json:"count"`
+	Truncated bool   `json:"truncated"`
+	Sent      bool   `json:"sent"` // false if there's nothing to report
+}
+
+// Run sends a digest of the emails received since the last digest, if any are included,
+// and saves the time of this digest
+func Run(ctx context.Context, client RunAPI, settings Settings) (*Result, error) {
+	if !settings.Enabled() {
+		return nil, api.ErrInvalidInput
+	}
+
+	current := getCurrentTime()
+	since, err := lastSent(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	if since.IsZero() {
+		since = current.Add(-DefaultSince)
+	}
+	if since.Before(current.Add(-MaxLookback)) {
+		since = current.Add(-MaxLookback)
+	}
+
+	items, truncated, err := collect(ctx, client, settings, since, current)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{
+		Since:     since.Format(time.RFC3339),
+		Count:     len(items),
+		Truncated: truncated,
+	}
+
+	if len(items) > 0 {
+		subject, text, htmlBody := compose(items, truncated, since)
+		if err := Send(ctx, client, settings, subject, text, htmlBody); err != nil {
+			return nil, err
+		}
+		result.Sent = true
+	}
+
+	if err := saveSent(ctx, client, current); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Send sends an email to the recipient of digests, from settings.From or the recipient itself.
+// It's used by digests, and by other summaries that are sent the same way, e.g. monthly reports.
+func Send(ctx context.Context, client SendAPI, settings Settings, subject, text, htmlBody string) error {
+	if !settings.Enabled() {
+		return api.ErrInvalidInput
+	}
+	from := settings.From
+	if from == "" {
+		from = settings.To
+	}
+	_, err := client.SendEmail(ctx, &sesv2.SendEmailInput{
+		Content: &sestypes.EmailContent{
+			Simple: &sestypes.Message{
+				Body: &sestypes.Body{
+					Html: &sestypes.Content{Data: aws.String(htmlBody), Charset: aws.String("UTF-8")},
+					Text: &sestypes.Content{Data: aws.String(text), Charset: aws.String("UTF-8")},
+				},
+				Subject: &sestypes.Content{Data: aws.String(subject), Charset: aws.String("UTF-8")},
+			},
+		},
+		Destination: &sestypes.Destination{
+			ToAddresses: []string{settings.To},
+		},
+		FromEmailAddress: aws.String(from),
+	})
+	return err
+}
+
+// collect returns the included emails received after since and up to current, from the newest.
+// truncated is true if there are more than MaxEmails.
+func collect(ctx context.Context, client api.ListEmailsAPI, settings Settings, since, current time.Time) ([]email.Item, bool, error) {
+	input := email.ListInput{
+		Type:         email.EmailTypeInbox,
+		PageSize:     pageSize,
+		ShowArchived: email.ShowTrashInclude, // emails filed into labels are archived
+	}
+
+	var items []email.Item
+	for {
+		result, err := email.List(ctx, client, input)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, item := range result.Items {
+			received, err := time.Parse(time.RFC3339, item.TimeReceived)
+			if err != nil {
+				fmt.Printf("invalid time received of %s, %v\n", item.MessageID, err)
+				continue
+			}
+			if received.After(current) {
+				continue
+			}
+			if !received.After(since) {
+				return items, false, nil
+			}
+			if !settings.includes(item) {
+				continue
+			}
+			if len(items) == MaxEmails {
+				return items, true, nil
+			}
+			items = append(items, item)
+		}
+		if !result.HasMore {
+			return items, false, nil
+		}
+		input.NextCursor = result.NextCursor
+	}
+}
+
+// compose returns the subject, text and HTML body of a digest
+func compose(items []email.Item, truncated bool, since time.Time) (subject, text, htmlBody string) {
+	loc := format.Location()
+	count := strconv.Itoa(len(items))
+	if truncated {
+		count += "+"
+	}
+	noun := "emails"
+	if len(items) == 1 && !truncated {
+		noun = "email"
+	}
+	subject = fmt.Sprintf("Digest: %s unread or starred %s", count, noun)
+	intro := fmt.Sprintf("%s unread or starred %s received since %s:", count, noun, since.In(loc).Format("Mon, 02 Jan 2006 15:04 MST"))
+
+	var t, h strings.Builder
+	t.WriteString(intro + "\n")
+	h.WriteString("<p>" + html.EscapeString(intro) + "</p>\n<ul>\n")
+	for _, item := range items {
+		title := item.Subject
+		if title == "" {
+			title = "(no subject)"
+		}
+		if item.Flagged {
+			title = "★ " + title
+		}
+		details := []string{"From: " + strings.Join(item.From, ", ")}
+		if received, err := time.Parse(time.RFC3339, item.TimeReceived); err == nil {
+			details = append(details, "Received: "+received.In(loc).Format("Mon, 02 Jan 2006 15:04 MST"))
+		}
+		if len(item.Labels) > 0 {
+			details = append(details, "Labels: "+strings.Join(item.Labels, ", "))
+		}
+
+		t.WriteString("\n" + title + "\n")
+		h.WriteString("<li><strong>" + html.EscapeString(title) + "</strong>")
+		for _, detail := range details {
+			t.WriteString("  " + detail + "\n")
+			h.WriteString("<br>" + html.EscapeString(detail))
+		}
+		h.WriteString("</li>\n")
+	}
+	h.WriteString("</ul>\n")
+	if truncated {
+		more := fmt.Sprintf("Only the latest %d emails are listed.", MaxEmails)
+		t.WriteString("\n" + more + "\n")
+		h.WriteString("<p>" + more + "</p>\n")
+	}
+	return subject, t.String(), h.String()
+}
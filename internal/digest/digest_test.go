@@ -0,0 +1,157 @@
+package digest
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingsFromEnv(t *testing.T) {
+	env.DigestTo = " me@example.com "
+	env.DigestFrom = ""
+	env.DigestLabels = "work, -newsletters,,- ,family"
+	defer func() { env.DigestTo, env.DigestLabels = "", "" }()
+
+	settings := SettingsFromEnv()
+	assert.Equal(t, Settings{
+		To:             "me@example.com",
+		Labels:         []string{"work", "family"},
+		ExcludedLabels: []string{"newsletters"},
+	}, settings)
+	assert.True(t, settings.Enabled())
+	assert.False(t, Settings{}.Enabled())
+}
+
+func TestSettings_Includes(t *testing.T) {
+	unread, read := true, false
+	tests := []struct {
+		settings Settings
+		item     email.Item
+		expected bool
+	}{
+		{Settings{}, email.Item{Unread: &unread}, true},
+		{Settings{}, email.Item{Unread: &read}, false},
+		{Settings{}, email.Item{}, false},
+		{Settings{}, email.Item{Unread: &read, Flagged: true}, true},
+		{Settings{Labels: []string{"work"}}, email.Item{Unread: &unread}, false},
+		{Settings{Labels: []string{"work"}}, email.Item{Unread: &unread, Labels: []string{"Work"}}, true},
+		{Settings{ExcludedLabels: []string{"newsletters"}}, email.Item{Unread: &unread, Labels: []string{"newsletters"}}, false},
+		{
+			Settings{Labels: []string{"work"}, ExcludedLabels: []string{"newsletters"}},
+			email.Item{Unread: &unread, Labels: []string{"work", "newsletters"}},
+			false,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, test.settings.includes(test.item))
+		})
+	}
+}
+
+func TestCompose(t *testing.T) {
+	env.TimeZone = ""
+	since := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	items := []email.Item{
+		{
+			TimeIndex: email.TimeIndex{MessageID: "1", TimeReceived: "2024-05-01T12:30:00Z"},
+			Subject:   "Invoice <42>",
+			From:      []string{"billing@example.com"},
+			Flagged:   true,
+			Labels:    []string{"work"},
+		},
+		{
+			TimeIndex: email.TimeIndex{MessageID: "2", TimeReceived: "2024-05-01T09:00:00Z"},
+			From:      []string{"alice@example.com"},
+		},
+	}
+
+	subject, text, htmlBody := compose(items, false, since)
+	assert.Equal(t, "Digest: 2 unread or starred emails", subject)
+	assert.Equal(t, "2 unread or starred emails received since Wed, 01 May 2024 08:00 UTC:\n"+
+		"\n★ Invoice <42>\n  From: billing@example.com\n  Received: Wed, 01 May 2024 12:30 UTC\n  Labels: work\n"+
+		"\n(no subject)\n  From: alice@example.com\n  Received: Wed, 01 May 2024 09:00 UTC\n", text)
+	assert.Contains(t, htmlBody, "<strong>★ Invoice &lt;42&gt;</strong>")
+	assert.NotContains(t, htmlBody, "Only the latest")
+
+	subject, text, htmlBody = compose(items[:1], true, since)
+	assert.Equal(t, "Digest: 1+ unread or starred emails", subject)
+	assert.True(t, strings.HasSuffix(text, "Only the latest 100 emails are listed.\n"))
+	assert.Contains(t, htmlBody, "Only the latest 100 emails are listed.")
+}
+
+type mockStateAPI map[string]types.AttributeValue
+
+func (m mockStateAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: m}, nil
+}
+
+func (m mockStateAPI) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	for k, v := range params.Item {
+		m[k] = v
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func TestState(t *testing.T) {
+	client := mockStateAPI{}
+	ctx := context.TODO()
+
+	sent, err := lastSent(ctx, client)
+	assert.Nil(t, err)
+	assert.True(t, sent.IsZero())
+
+	now := time.Date(2024, 5, 1, 8, 0, 0, 123000000, time.UTC)
+	assert.Nil(t, saveSent(ctx, client, now))
+	assert.Equal(t, &types.AttributeValueMemberS{Value: stateID}, client["MessageID"])
+
+	sent, err = lastSent(ctx, client)
+	assert.Nil(t, err)
+	assert.Equal(t, now, sent)
+}
+
+func TestRun_Disabled(t *testing.T) {
+	_, err := Run(context.TODO(), nil, Settings{})
+	assert.Equal(t, api.ErrInvalidInput, err)
+}
+
+type mockSendAPI func(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+
+func (m mockSendAPI) SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func TestSend(t *testing.T) {
+	var sent []*sesv2.SendEmailInput
+	client := mockSendAPI(func(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+		sent = append(sent, params)
+		return &sesv2.SendEmailOutput{}, nil
+	})
+
+	err := Send(context.TODO(), client, Settings{To: "me@example.com"}, "subject", "text", "<p>html</p>")
+	assert.Nil(t, err)
+	err = Send(context.TODO(), client, Settings{To: "me@example.com", From: "digest@example.com"}, "subject", "text", "<p>html</p>")
+	assert.Nil(t, err)
+	if assert.Len(t, sent, 2) {
+		assert.Equal(t, "me@example.com", *sent[0].FromEmailAddress)
+		assert.Equal(t, []string{"me@example.com"}, sent[0].Destination.ToAddresses)
+		assert.Equal(t, "subject", *sent[0].Content.Simple.Subject.Data)
+		assert.Equal(t, "text", *sent[0].Content.Simple.Body.Text.Data)
+		assert.Equal(t, "<p>html</p>", *sent[0].Content.Simple.Body.Html.Data)
+		assert.Equal(t, "digest@example.com", *sent[1].FromEmailAddress)
+	}
+
+	err = Send(context.TODO(), client, Settings{}, "subject", "text", "<p>html</p>")
+	assert.Equal(t, api.ErrInvalidInput, err)
+}
@@ -0,0 +1,56 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// stateID is the MessageID of the item storing the time of the last digest in the email table
+const stateID = "digest#state"
+
+// lastSent returns the time of the last digest, or the zero time if there's none
+func lastSent(ctx context.Context, client api.GetItemAPI) (time.Time, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: stateID},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return time.Time{}, api.ErrTooManyRequests
+		}
+		return time.Time{}, err
+	}
+
+	v, ok := resp.Item["TimeSent"].(*types.AttributeValueMemberS)
+	if !ok {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v.Value)
+}
+
+// saveSent saves the time of a digest, which emails in the next digest are received after
+func saveSent(ctx context.Context, client api.PutItemAPI, sent time.Time) error {
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: stateID},
+			"TimeSent":  &types.AttributeValueMemberS{Value: sent.Format(time.RFC3339Nano)},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+const (
+	ActionArchive   = "archive"
+	ActionUnarchive = "unarchive"
+)
+
+// Archive archives or unarchives a received email, which is recorded in the ArchivedTime attribute.
+// Archived emails are excluded from the inbox listing by default.
+// An InvalidTransitionError is returned if the email isn't received, is trashed, or is already in the target state.
+func Archive(ctx context.Context, client api.UpdateItemAPI, messageID, action string) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":v_type": &types.AttributeValueMemberS{Value: EmailTypeInbox + "#"},
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+
+	var op string
+	switch action {
+	case ActionArchive:
+		op = opArchive
+		input.UpdateExpression = aws.String("SET ArchivedTime = :archivedTime")
+		input.ConditionExpression = aws.String(
+			"begins_with(TypeYearMonth, :v_type) AND attribute_not_exists(TrashedTime) AND attribute_not_exists(ArchivedTime)")
+		input.ExpressionAttributeValues[":archivedTime"] = &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+	case ActionUnarchive:
+		op = opUnarchive
+		input.UpdateExpression = aws.String("REMOVE ArchivedTime")
+		input.ConditionExpression = aws.String(
+			"begins_with(TypeYearMonth, :v_type) AND attribute_not_exists(TrashedTime) AND attribute_exists(ArchivedTime)")
+	default:
+		return api.ErrInvalidInput
+	}
+
+	err := transitionEmail(op, func() error {
+		_, err := client.UpdateItem(ctx, input)
+		return err
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+
+	fmt.Println("archive method finished successfully")
+	return nil
+}
@@ -0,0 +1,61 @@
+package email
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchive(t *testing.T) {
+	tests := []struct {
+		action       string
+		condErr      error
+		expectedExpr string
+		expectedErr  error
+	}{
+		{
+			action:       ActionArchive,
+			expectedExpr: "SET ArchivedTime = :archivedTime",
+		},
+		{
+			action:       ActionUnarchive,
+			expectedExpr: "REMOVE ArchivedTime",
+		},
+		{
+			action: ActionArchive,
+			condErr: &types.ConditionalCheckFailedException{
+				Item: map[string]types.AttributeValue{
+					"TypeYearMonth": &types.AttributeValueMemberS{Value: "sent#2023-05"},
+				},
+			},
+			expectedExpr: "SET ArchivedTime = :archivedTime",
+			expectedErr:  &api.InvalidTransitionError{From: StateSent, To: StateArchived},
+		},
+		{
+			action:      "invalid",
+			expectedErr: api.ErrInvalidInput,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			called := false
+			client := mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+				called = true
+				assert.Equal(t, test.expectedExpr, *params.UpdateExpression)
+				assert.Contains(t, *params.ConditionExpression, "begins_with(TypeYearMonth, :v_type)")
+				assert.Equal(t, types.ReturnValuesOnConditionCheckFailureAllOld, params.ReturnValuesOnConditionCheckFailure)
+				return &dynamodb.UpdateItemOutput{}, test.condErr
+			})
+
+			err := Archive(context.TODO(), client, "exampleMessageID", test.action)
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expectedExpr != "", called)
+		})
+	}
+}
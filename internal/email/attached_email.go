@@ -0,0 +1,26 @@
+package email
+
+import (
+	"context"
+	"errors"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/types"
+)
+
+// GetAttachedEmail returns an email attached to another email as a message/rfc822 part, e.g. a forwarded message
+func GetAttachedEmail(ctx context.Context, client api.GetItemContentAPI, messageID string, index int) (*types.AttachedEmail, error) {
+	location, err := RawLocation(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := storage.S3.GetAttachedEmail(ctx, client, location, index)
+	if err != nil {
+		if errors.Is(err, storage.ErrAttachmentNotFound) {
+			return nil, api.ErrNotFound
+		}
+		return nil, err
+	}
+	return result, nil
+}
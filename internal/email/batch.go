@@ -0,0 +1,490 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/blob"
+	"github.com/harryzcy/mailbox/internal/counter"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+const (
+	// MaxBatchSize is the maximum number of emails changed by a batch operation
+	MaxBatchSize = 100
+
+	// batchTransactSize is the maximum number of emails changed in a transaction,
+	// which has at most maxTransactItems items, including the updates of the folder counters, see transactSize
+	batchTransactSize = 98
+	maxTransactItems  = 100
+)
+
+// Folders of received emails that BatchMove moves emails to
+const (
+	FolderInbox   = "inbox"
+	FolderArchive = "archive"
+)
+
+// BatchResult is the result of a batch operation, which succeeds or fails for each email separately
+type BatchResult struct {
+	Succeeded []string       `json:"succeeded"`           // changed emails
+	Unchanged []string       `json:"unchanged,omitempty"` // emails that are already in the requested state
+	Failed    []BatchFailure `json:"failed,omitempty"`
+}
+
+// BatchFailure is an email that a batch operation failed to change
+type BatchFailure struct {
+	MessageID string `json:"messageID"`
+	Error     string `json:"error"`
+}
+
+// Actions of batch operations, besides ActionRead and ActionUnread
+const (
+	ActionTrash  = "trash"
+	ActionDelete = "delete"
+	ActionMove   = "move"
+)
+
+// BatchInput is the input of Batch
+type BatchInput struct {
+	Action     string   `json:"action"`
+	Folder     string   `json:"folder"` // FolderInbox or FolderArchive, only for ActionMove
+	MessageIDs []string `json:"messageIDs"`
+}
+
+// batchOp describes how a batch operation changes each email
+type batchOp struct {
+	// check returns whether an email needs to be changed, or an error if it can't be, given its item, which is empty if it doesn't exist
+	check func(ctx context.Context, client api.BatchEmailAPI, messageID string, item map[string]types.AttributeValue) (bool, error)
+	// write returns the change of an email in a transaction, whose condition makes sure the email can be changed
+	write func(messageID string, item map[string]types.AttributeValue) types.TransactWriteItem
+	// transition returns the counter state of an email after it's changed, nil if it's removed
+	transition func(state counter.State) *counter.State
+	// after is called with each email changed by a transaction, if the change has effects outside the table
+	after func(ctx context.Context, client api.BatchEmailAPI, messageID string, item map[string]types.AttributeValue) error
+	// single changes an email by itself, which is used when the emails of a transaction are changed concurrently
+	single func(ctx context.Context, client api.BatchEmailAPI, messageID string) error
+}
+
+// batchChange is an email to be changed in a transaction
+type batchChange struct {
+	messageID string
+	item      map[string]types.AttributeValue
+}
+
+// Batch applies an action to up to MaxBatchSize emails, see BatchRead, BatchTrash, BatchDelete and BatchMove
+func Batch(ctx context.Context, client api.BatchEmailAPI, input BatchInput) (*BatchResult, error) {
+	switch input.Action {
+	case ActionRead, ActionUnread:
+		return BatchRead(ctx, client, input.MessageIDs, input.Action)
+	case ActionTrash:
+		return BatchTrash(ctx, client, input.MessageIDs)
+	case ActionDelete:
+		return BatchDelete(ctx, client, input.MessageIDs)
+	case ActionMove:
+		return BatchMove(ctx, client, input.MessageIDs, input.Folder)
+	}
+	return nil, api.ErrInvalidInput
+}
+
+// BatchRead marks up to MaxBatchSize received emails as read or unread, see Read
+func BatchRead(ctx context.Context, client api.BatchEmailAPI, messageIDs []string, action string) (*BatchResult, error) {
+	if action != ActionRead && action != ActionUnread {
+		return nil, api.ErrInvalidInput
+	}
+	unread := action == ActionUnread
+	return runBatch(ctx, client, messageIDs, batchOp{
+		check: func(_ context.Context, _ api.BatchEmailAPI, _ string, item map[string]types.AttributeValue) (bool, error) {
+			if len(item) == 0 {
+				return false, api.ErrNotFound
+			}
+			// only received emails, including trashed ones, are read or unread
+			if state := untrashedState(item); state != StateInbox && state != StateArchived {
+				return false, api.ErrReadActionFailed
+			}
+			_, isUnread := item["Unread"]
+			return isUnread != unread, nil
+		},
+		write: func(messageID string, _ map[string]types.AttributeValue) types.TransactWriteItem {
+			update := &types.Update{
+				TableName: aws.String(env.TableName),
+				Key:       messageKey(messageID),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":v_type": &types.AttributeValueMemberS{Value: EmailTypeInbox},
+				},
+			}
+			if unread {
+				update.UpdateExpression = aws.String("SET Unread = :val1")
+				update.ConditionExpression = aws.String("attribute_not_exists(Unread) AND begins_with(TypeYearMonth, :v_type)")
+				update.ExpressionAttributeValues[":val1"] = &types.AttributeValueMemberBOOL{Value: true}
+			} else {
+				update.UpdateExpression = aws.String("REMOVE Unread")
+				update.ConditionExpression = aws.String("attribute_exists(Unread) AND begins_with(TypeYearMonth, :v_type)")
+			}
+			return types.TransactWriteItem{Update: update}
+		},
+		transition: func(state counter.State) *counter.State {
+			state.Unread = unread
+			return &state
+		},
+		single: func(ctx context.Context, client api.BatchEmailAPI, messageID string) error {
+			return Read(ctx, client, messageID, action)
+		},
+	})
+}
+
+// BatchTrash trashes up to MaxBatchSize emails, see Trash
+func BatchTrash(ctx context.Context, client api.BatchEmailAPI, messageIDs []string) (*BatchResult, error) {
+	trashedTime := time.Now().UTC()
+	return runBatch(ctx, client, messageIDs, batchOp{
+		check: checkBatchTransition(opTrash),
+		write: func(messageID string, item map[string]types.AttributeValue) types.TransactWriteItem {
+			update := &types.Update{
+				TableName:           aws.String(env.TableName),
+				Key:                 messageKey(messageID),
+				UpdateExpression:    aws.String("SET TrashedTime = :val1"),
+				ConditionExpression: aws.String("attribute_not_exists(TrashedTime) AND NOT begins_with(TypeYearMonth, :v_type)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":val1":   &types.AttributeValueMemberS{Value: trashedTime.Format(time.RFC3339)},
+					":v_type": &types.AttributeValueMemberS{Value: EmailTypeDraft},
+				},
+			}
+			// emails in threads don't expire, see setTrashExpiry
+			if days, ok := trashRetentionDays(); ok {
+				if _, inThread := item["ThreadID"]; !inThread {
+					update.UpdateExpression = aws.String("SET TrashedTime = :val1, " + ExpiresAtAttribute + " = :expiresAt")
+					update.ConditionExpression = aws.String("(" + *update.ConditionExpression + ") AND attribute_not_exists(ThreadID)")
+					update.ExpressionAttributeValues[":expiresAt"] = &types.AttributeValueMemberN{
+						Value: strconv.FormatInt(trashedTime.AddDate(0, 0, days).Unix(), 10),
+					}
+				}
+			}
+			return types.TransactWriteItem{Update: update}
+		},
+		transition: func(state counter.State) *counter.State {
+			state.Trashed = true
+			return &state
+		},
+		single: func(ctx context.Context, client api.BatchEmailAPI, messageID string) error {
+			return Trash(ctx, client, messageID)
+		},
+	})
+}
+
+// BatchDelete deletes up to MaxBatchSize trashed emails or drafts, see Delete.
+// Emails that are already deleted are unchanged.
+func BatchDelete(ctx context.Context, client api.BatchEmailAPI, messageIDs []string) (*BatchResult, error) {
+	check := checkBatchTransition(opDelete)
+	return runBatch(ctx, client, messageIDs, batchOp{
+		check: func(ctx context.Context, client api.BatchEmailAPI, messageID string, item map[string]types.AttributeValue) (bool, error) {
+			changed, err := check(ctx, client, messageID, item)
+			if err != nil || !changed {
+				return changed, err
+			}
+			if _, ok := item["ThreadID"]; ok {
+				return false, api.ErrPartOfThread
+			}
+			if err := CheckRetention(ctx, client, storage.ItemLocation(item, messageID)); err != nil {
+				return false, err
+			}
+			return true, nil
+		},
+		write: func(messageID string, _ map[string]types.AttributeValue) types.TransactWriteItem {
+			return types.TransactWriteItem{Delete: &types.Delete{
+				TableName:           aws.String(env.TableName),
+				Key:                 messageKey(messageID),
+				ConditionExpression: aws.String("(attribute_exists(TrashedTime) OR begins_with(TypeYearMonth, :v_type)) AND attribute_not_exists(ThreadID)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":v_type": &types.AttributeValueMemberS{Value: EmailTypeDraft},
+				},
+			}}
+		},
+		transition: func(counter.State) *counter.State {
+			return nil
+		},
+		after: func(ctx context.Context, client api.BatchEmailAPI, messageID string, item map[string]types.AttributeValue) error {
+			err := storage.S3.DeleteEmail(ctx, client, storage.ItemLocation(item, messageID))
+			if err != nil {
+				return err
+			}
+			// the email is deleted, so blobs that fail to be released are only left behind
+			if err := blob.Release(ctx, client, blobsOf(item)); err != nil {
+				fmt.Printf("failed to release blobs: %v\n", err)
+			}
+			return nil
+		},
+		single: func(ctx context.Context, client api.BatchEmailAPI, messageID string) error {
+			return Delete(ctx, client, messageID)
+		},
+	})
+}
+
+// BatchMove moves up to MaxBatchSize received emails to the inbox or the archive, see Archive
+func BatchMove(ctx context.Context, client api.BatchEmailAPI, messageIDs []string, folder string) (*BatchResult, error) {
+	var op, action string
+	switch folder {
+	case FolderInbox:
+		op, action = opUnarchive, ActionUnarchive
+	case FolderArchive:
+		op, action = opArchive, ActionArchive
+	default:
+		return nil, api.ErrInvalidInput
+	}
+
+	archivedTime := time.Now().UTC().Format(time.RFC3339)
+	return runBatch(ctx, client, messageIDs, batchOp{
+		check: checkBatchTransition(op),
+		write: func(messageID string, _ map[string]types.AttributeValue) types.TransactWriteItem {
+			update := &types.Update{
+				TableName: aws.String(env.TableName),
+				Key:       messageKey(messageID),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":v_type": &types.AttributeValueMemberS{Value: EmailTypeInbox + "#"},
+				},
+			}
+			if op == opArchive {
+				update.UpdateExpression = aws.String("SET ArchivedTime = :archivedTime")
+				update.ConditionExpression = aws.String(
+					"begins_with(TypeYearMonth, :v_type) AND attribute_not_exists(TrashedTime) AND attribute_not_exists(ArchivedTime)")
+				update.ExpressionAttributeValues[":archivedTime"] = &types.AttributeValueMemberS{Value: archivedTime}
+			} else {
+				update.UpdateExpression = aws.String("REMOVE ArchivedTime")
+				update.ConditionExpression = aws.String(
+					"begins_with(TypeYearMonth, :v_type) AND attribute_not_exists(TrashedTime) AND attribute_exists(ArchivedTime)")
+			}
+			return types.TransactWriteItem{Update: update}
+		},
+		// archived emails are counted in the inbox folder
+		transition: func(state counter.State) *counter.State {
+			return &state
+		},
+		single: func(ctx context.Context, client api.BatchEmailAPI, messageID string) error {
+			return Archive(ctx, client, messageID, action)
+		},
+	})
+}
+
+// checkBatchTransition returns the check of a batch operation that applies op,
+// where emails already in the state op moves them to are unchanged
+func checkBatchTransition(op string) func(context.Context, api.BatchEmailAPI, string, map[string]types.AttributeValue) (bool, error) {
+	return func(_ context.Context, _ api.BatchEmailAPI, _ string, item map[string]types.AttributeValue) (bool, error) {
+		if StateOf(item) == transitions[op].to(item) {
+			return false, nil
+		}
+		if err := checkTransition(op, item); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+}
+
+// runBatch applies op to the emails, changing as many of them as possible in each transaction along with the counters.
+// If a transaction fails because an email changed since it's checked, its emails are changed one by one instead.
+func runBatch(ctx context.Context, client api.BatchEmailAPI, messageIDs []string, op batchOp) (*BatchResult, error) {
+	messageIDs = uniqueMessageIDs(messageIDs)
+	if len(messageIDs) == 0 || len(messageIDs) > MaxBatchSize {
+		return nil, api.ErrInvalidInput
+	}
+	items, err := getBatchItems(ctx, client, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{Succeeded: []string{}}
+	var changes []batchChange
+	for _, messageID := range messageIDs {
+		changed, err := op.check(ctx, client, messageID, items[messageID])
+		switch {
+		case err != nil:
+			result.fail(messageID, err)
+		case changed:
+			changes = append(changes, batchChange{messageID: messageID, item: items[messageID]})
+		default:
+			result.Unchanged = append(result.Unchanged, messageID)
+		}
+	}
+
+	for len(changes) > 0 {
+		n := transactSize(changes, op)
+		chunk := changes[:n]
+		changes = changes[n:]
+
+		err := transactBatch(ctx, client, chunk, op)
+		if counter.ConditionFailed(err) {
+			fmt.Printf("emails changed concurrently, changing %d emails one by one\n", len(chunk))
+			for _, change := range chunk {
+				err := op.single(ctx, client, change.messageID)
+				var transitionErr *api.InvalidTransitionError
+				switch {
+				case errors.As(err, &transitionErr) && transitionErr.From == transitionErr.To:
+					result.Unchanged = append(result.Unchanged, change.messageID)
+				case err != nil:
+					result.fail(change.messageID, err)
+				default:
+					result.Succeeded = append(result.Succeeded, change.messageID)
+				}
+			}
+			continue
+		}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			err = api.ErrTooManyRequests
+		}
+
+		for _, change := range chunk {
+			if err != nil {
+				result.fail(change.messageID, err)
+				continue
+			}
+			if op.after != nil {
+				if err := op.after(ctx, client, change.messageID, change.item); err != nil {
+					result.fail(change.messageID, err)
+					continue
+				}
+			}
+			result.Succeeded = append(result.Succeeded, change.messageID)
+		}
+	}
+
+	fmt.Printf("batch finished: %d succeeded, %d unchanged, %d failed\n", len(result.Succeeded), len(result.Unchanged), len(result.Failed))
+	return result, nil
+}
+
+// transactBatch changes the emails in a transaction, along with the changes of the counters they are counted in.
+// The condition of each email includes its counter state, so the transaction fails if any email changed since it's checked.
+func transactBatch(ctx context.Context, client api.TransactWriteItemsAPI, changes []batchChange, op batchOp) error {
+	items := make([]types.TransactWriteItem, 0, len(changes))
+	var deltas []counter.Delta
+	for _, change := range changes {
+		state := counter.StateOf(change.item)
+		item := op.write(change.messageID, change.item)
+		switch {
+		case item.Update != nil:
+			item.Update.ConditionExpression, item.Update.ExpressionAttributeValues =
+				withStateCondition(item.Update.ConditionExpression, item.Update.ExpressionAttributeValues, state)
+		case item.Delete != nil:
+			item.Delete.ConditionExpression, item.Delete.ExpressionAttributeValues =
+				withStateCondition(item.Delete.ConditionExpression, item.Delete.ExpressionAttributeValues, state)
+		}
+		items = append(items, item)
+		deltas = append(deltas, changeDeltas(change, op)...)
+	}
+
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append(items, counter.Updates(deltas...)...),
+	})
+	return err
+}
+
+// changeDeltas returns the counter changes of an email changed by op, if counters are maintained
+func changeDeltas(change batchChange, op batchOp) []counter.Delta {
+	state := counter.StateOf(change.item)
+	if !counter.Enabled() || !state.Counted() {
+		return nil
+	}
+	if next := op.transition(state); next != nil {
+		return counter.Transition(state, *next)
+	}
+	return counter.Remove(state)
+}
+
+// transactSize returns the number of changes that fit in a transaction along with their counter updates.
+// It's batchTransactSize at most, and less if the emails are counted in the folders of many labels.
+func transactSize(changes []batchChange, op batchOp) int {
+	n := min(len(changes), batchTransactSize)
+	var deltas []counter.Delta
+	for i := 0; i < n; i++ {
+		deltas = append(deltas, changeDeltas(changes[i], op)...)
+		if i+1+len(counter.Updates(deltas...)) > maxTransactItems {
+			return max(i, 1)
+		}
+	}
+	return n
+}
+
+// getBatchItems gets the attributes of the emails that decide how they are changed, by message ID.
+// Emails that don't exist are left out.
+func getBatchItems(ctx context.Context, client api.BatchGetItemAPI, messageIDs []string) (map[string]map[string]types.AttributeValue, error) {
+	keys := make([]map[string]types.AttributeValue, len(messageIDs))
+	for i, messageID := range messageIDs {
+		keys[i] = messageKey(messageID)
+	}
+
+	items := make(map[string]map[string]types.AttributeValue, len(messageIDs))
+	for len(keys) > 0 {
+		output, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				env.TableName: {
+					Keys:                 keys,
+					ProjectionExpression: aws.String("MessageID, " + counter.StateAttributes + ", ArchivedTime, ThreadID, Blobs, " + storage.RawBucketAttribute + ", " + storage.RawKeyAttribute),
+					ConsistentRead:       aws.Bool(true),
+				},
+			},
+		})
+		if err != nil {
+			if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return nil, api.ErrTooManyRequests
+			}
+			return nil, err
+		}
+		keys = nil
+		if unprocessed, ok := output.UnprocessedKeys[env.TableName]; ok {
+			keys = unprocessed.Keys
+		}
+
+		for _, item := range output.Responses[env.TableName] {
+			if messageID, ok := item["MessageID"].(*types.AttributeValueMemberS); ok {
+				items[messageID.Value] = item
+			}
+		}
+	}
+	return items, nil
+}
+
+// fail records that an email failed to be changed. Errors that aren't caused by the email are logged and hidden.
+func (r *BatchResult) fail(messageID string, err error) {
+	message := err.Error()
+	var transitionErr *api.InvalidTransitionError
+	var retentionErr *api.RetentionError
+	switch {
+	case errors.As(err, &transitionErr), errors.As(err, &retentionErr):
+	case err == api.ErrNotFound, err == api.ErrReadActionFailed, err == api.ErrPartOfThread, err == api.ErrTooManyRequests:
+	default:
+		fmt.Printf("batch failed for %s: %v\n", messageID, err)
+		message = "internal error"
+	}
+	r.Failed = append(r.Failed, BatchFailure{MessageID: messageID, Error: message})
+}
+
+// messageKey returns the key of an email item
+func messageKey(messageID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"MessageID": &types.AttributeValueMemberS{Value: messageID},
+	}
+}
+
+// uniqueMessageIDs removes duplicates while preserving order, since a batch can't get an item more than once.
+// It returns nil if any message ID is empty.
+func uniqueMessageIDs(messageIDs []string) []string {
+	seen := make(map[string]bool, len(messageIDs))
+	result := make([]string, 0, len(messageIDs))
+	for _, messageID := range messageIDs {
+		if messageID == "" {
+			return nil
+		}
+		if seen[messageID] {
+			continue
+		}
+		seen[messageID] = true
+		result = append(result, messageID)
+	}
+	return result
+}
@@ -0,0 +1,245 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/counter"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockBatchEmailAPI serves the items of emails to BatchGetItem, and records the transactions
+type mockBatchEmailAPI struct {
+	items        map[string]map[string]types.AttributeValue
+	transactErr  error
+	transactions []*dynamodb.TransactWriteItemsInput
+	updated      []string // message IDs updated one by one
+	deleted      []string // message IDs whose raw emails are deleted
+}
+
+func (m *mockBatchEmailAPI) BatchGetItem(_ context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	var responses []map[string]types.AttributeValue
+	for _, key := range params.RequestItems[env.TableName].Keys {
+		if item, ok := m.items[key["MessageID"].(*types.AttributeValueMemberS).Value]; ok {
+			responses = append(responses, item)
+		}
+	}
+	return &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{env.TableName: responses}}, nil
+}
+
+func (m *mockBatchEmailAPI) TransactWriteItems(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	m.transactions = append(m.transactions, params)
+	return &dynamodb.TransactWriteItemsOutput{}, m.transactErr
+}
+
+// GetItem is only called when counters are enabled and emails are changed one by one
+func (m *mockBatchEmailAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return nil, errors.New("unexpected GetItem call")
+}
+
+func (m *mockBatchEmailAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.updated = append(m.updated, params.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+// DeleteItem is only called when emails are deleted one by one
+func (m *mockBatchEmailAPI) DeleteItem(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return nil, errors.New("unexpected DeleteItem call")
+}
+
+func (m *mockBatchEmailAPI) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	m.deleted = append(m.deleted, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// HeadObject is only called when S3 retention is enabled
+func (m *mockBatchEmailAPI) HeadObject(_ context.Context, _ *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return nil, errors.New("unexpected HeadObject call")
+}
+
+func batchItem(messageID, typeYearMonth string, attributes ...string) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"MessageID":     &types.AttributeValueMemberS{Value: messageID},
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: typeYearMonth},
+	}
+	for _, attribute := range attributes {
+		item[attribute] = &types.AttributeValueMemberS{Value: "2023-05-02T03:04:05Z"}
+	}
+	return item
+}
+
+func TestBatchRead(t *testing.T) {
+	env.TableName = "table-for-batch"
+	env.CountersTableName = "counters"
+	defer func() { env.CountersTableName = "" }()
+
+	client := &mockBatchEmailAPI{items: map[string]map[string]types.AttributeValue{
+		"unread":  batchItem("unread", "inbox#2023-05", "Unread"),
+		"trashed": batchItem("trashed", "inbox#2023-05", "Unread", "TrashedTime"),
+		"read":    batchItem("read", "inbox#2023-05"),
+		"draft":   batchItem("draft", "draft#2023-05"),
+	}}
+
+	result, err := BatchRead(context.TODO(), client, []string{"unread", "trashed", "read", "draft", "missing", "unread"}, ActionRead)
+	assert.Nil(t, err)
+	assert.Equal(t, &BatchResult{
+		Succeeded: []string{"unread", "trashed"},
+		Unchanged: []string{"read"},
+		Failed: []BatchFailure{
+			{MessageID: "draft", Error: api.ErrReadActionFailed.Error()},
+			{MessageID: "missing", Error: api.ErrNotFound.Error()},
+		},
+	}, result)
+
+	assert.Len(t, client.transactions, 1)
+	items := client.transactions[0].TransactItems
+	// the emails, then the merged counter updates of the inbox and the trash
+	assert.Len(t, items, 4)
+	assert.Equal(t, "REMOVE Unread", *items[0].Update.UpdateExpression)
+	assert.Equal(t, "(attribute_exists(Unread) AND begins_with(TypeYearMonth, :v_type)) AND "+
+		"TypeYearMonth = :c_type AND attribute_exists(Unread) AND attribute_not_exists(TrashedTime) AND attribute_not_exists(Labels)", *items[0].Update.ConditionExpression)
+	assert.Equal(t, "counters", *items[2].Update.TableName)
+	assert.Equal(t, "inbox", items[2].Update.Key["Folder"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "0", items[2].Update.ExpressionAttributeValues[":total"].(*types.AttributeValueMemberN).Value)
+	assert.Equal(t, "-1", items[2].Update.ExpressionAttributeValues[":unread"].(*types.AttributeValueMemberN).Value)
+	assert.Equal(t, "trash", items[3].Update.Key["Folder"].(*types.AttributeValueMemberS).Value)
+
+	_, err = BatchRead(context.TODO(), client, []string{"unread"}, "star")
+	assert.Equal(t, api.ErrInvalidInput, err)
+}
+
+func TestBatchTrash(t *testing.T) {
+	env.TableName = "table-for-batch"
+	env.TrashRetentionDays = "30"
+	defer func() { env.TrashRetentionDays = "" }()
+
+	client := &mockBatchEmailAPI{items: map[string]map[string]types.AttributeValue{
+		"inbox":    batchItem("inbox", "inbox#2023-05"),
+		"threaded": batchItem("threaded", "sent#2023-05", "ThreadID"),
+		"trashed":  batchItem("trashed", "inbox#2023-05", "TrashedTime"),
+		"draft":    batchItem("draft", "draft#2023-05"),
+	}}
+
+	result, err := BatchTrash(context.TODO(), client, []string{"inbox", "threaded", "trashed", "draft"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"inbox", "threaded"}, result.Succeeded)
+	assert.Equal(t, []string{"trashed"}, result.Unchanged)
+	assert.Equal(t, []BatchFailure{{MessageID: "draft", Error: "email can't move from draft to trashed"}}, result.Failed)
+
+	// counters are disabled
+	items := client.transactions[0].TransactItems
+	assert.Len(t, items, 2)
+	assert.Equal(t, "SET TrashedTime = :val1, ExpiresAt = :expiresAt", *items[0].Update.UpdateExpression)
+	// emails in threads don't expire
+	assert.Equal(t, "SET TrashedTime = :val1", *items[1].Update.UpdateExpression)
+}
+
+func TestBatchDelete(t *testing.T) {
+	env.TableName = "table-for-batch"
+	client := &mockBatchEmailAPI{items: map[string]map[string]types.AttributeValue{
+		"trashed":  batchItem("trashed", "inbox#2023-05", "TrashedTime"),
+		"draft":    batchItem("draft", "draft#2023-05"),
+		"threaded": batchItem("threaded", "inbox#2023-05", "TrashedTime", "ThreadID"),
+		"inbox":    batchItem("inbox", "inbox#2023-05"),
+	}}
+
+	result, err := BatchDelete(context.TODO(), client, []string{"trashed", "draft", "threaded", "inbox", "purged"})
+	assert.Nil(t, err)
+	assert.Equal(t, &BatchResult{
+		Succeeded: []string{"trashed", "draft"},
+		Unchanged: []string{"purged"},
+		Failed: []BatchFailure{
+			{MessageID: "threaded", Error: api.ErrPartOfThread.Error()},
+			{MessageID: "inbox", Error: "email can't move from inbox to purged"},
+		},
+	}, result)
+	assert.Len(t, client.transactions[0].TransactItems, 2)
+	assert.NotNil(t, client.transactions[0].TransactItems[0].Delete)
+	assert.Equal(t, []string{"trashed", "draft"}, client.deleted)
+}
+
+func TestTransactSize(t *testing.T) {
+	env.CountersTableName = "counters"
+	defer func() { env.CountersTableName = "" }()
+
+	op := batchOp{transition: func(state counter.State) *counter.State {
+		state.Trashed = true
+		return &state
+	}}
+	changes := make([]batchChange, MaxBatchSize)
+	for i := range changes {
+		changes[i] = batchChange{messageID: strconv.Itoa(i), item: batchItem(strconv.Itoa(i), "inbox#2023-05")}
+	}
+	// the updates of the inbox and the trash
+	assert.Equal(t, batchTransactSize, transactSize(changes, op))
+
+	// each email has ten labels of its own, so 8 emails and 82 counter updates fit
+	for i := range changes {
+		labels := make([]string, 10)
+		for j := range labels {
+			labels[j] = strconv.Itoa(i) + "-" + strconv.Itoa(j)
+		}
+		changes[i].item["Labels"] = &types.AttributeValueMemberSS{Value: labels}
+	}
+	assert.Equal(t, 8, transactSize(changes, op))
+}
+
+func TestBatchMove(t *testing.T) {
+	env.TableName = "table-for-batch"
+	client := &mockBatchEmailAPI{items: map[string]map[string]types.AttributeValue{
+		"inbox":    batchItem("inbox", "inbox#2023-05"),
+		"archived": batchItem("archived", "inbox#2023-05", "ArchivedTime"),
+		"sent":     batchItem("sent", "sent#2023-05"),
+	}}
+
+	result, err := BatchMove(context.TODO(), client, []string{"inbox", "archived", "sent"}, FolderArchive)
+	assert.Nil(t, err)
+	assert.Equal(t, &BatchResult{
+		Succeeded: []string{"inbox"},
+		Unchanged: []string{"archived"},
+		Failed:    []BatchFailure{{MessageID: "sent", Error: "email can't move from sent to archived"}},
+	}, result)
+	assert.Equal(t, "SET ArchivedTime = :archivedTime", *client.transactions[0].TransactItems[0].Update.UpdateExpression)
+
+	_, err = BatchMove(context.TODO(), client, []string{"inbox"}, "trash")
+	assert.Equal(t, api.ErrInvalidInput, err)
+}
+
+func TestBatch_ConcurrentChange(t *testing.T) {
+	env.TableName = "table-for-batch"
+	client := &mockBatchEmailAPI{
+		items: map[string]map[string]types.AttributeValue{
+			"a": batchItem("a", "inbox#2023-05"),
+			"b": batchItem("b", "inbox#2023-05"),
+		},
+		transactErr: &types.TransactionCanceledException{
+			CancellationReasons: []types.CancellationReason{{Code: aws.String("None")}, {Code: aws.String("ConditionalCheckFailed")}},
+		},
+	}
+
+	result, err := BatchMove(context.TODO(), client, []string{"a", "b"}, FolderArchive)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, result.Succeeded)
+	// the emails are archived one by one after the transaction failed
+	assert.Equal(t, []string{"a", "b"}, client.updated)
+}
+
+func TestBatch_InvalidInput(t *testing.T) {
+	client := &mockBatchEmailAPI{}
+	tooMany := make([]string, MaxBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i)
+	}
+	for _, messageIDs := range [][]string{nil, {""}, {"a", ""}, tooMany} {
+		_, err := BatchTrash(context.TODO(), client, messageIDs)
+		assert.Equal(t, api.ErrInvalidInput, err)
+	}
+}
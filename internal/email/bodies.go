@@ -0,0 +1,155 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/blob"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// BodyExpiresAtAttribute is the epoch seconds when the bodies of a received email expire, see ExpireBodies.
+// It's set when the email is received if BODY_RETENTION_DAYS is set.
+const BodyExpiresAtAttribute = "BodyExpiresAt"
+
+// bodyAttributes are the attributes of the content of an email, which are removed when its bodies expire.
+// The rest, e.g. the subject, addresses, times and labels, are kept as the metadata of the email.
+var bodyAttributes = []string{"Text", "HTML", "Attachments", "Inlines", "OtherParts", "AttachedEmails", "Blobs"}
+
+// MetadataOnly returns true if the bodies of received emails aren't stored in DynamoDB,
+// in which case their content is only in the raw emails in S3
+func MetadataOnly() bool {
+	return env.MetadataOnly == "true"
+}
+
+// BodyRetentionDays returns the days the bodies of received emails are kept, which is false if BODY_RETENTION_DAYS isn't set.
+// It's at least S3_RETENTION_DAYS if S3_RETENTION_MODE is set, so that raw emails are no longer retained when they expire.
+func BodyRetentionDays() (int, bool) {
+	if env.BodyRetentionDays == "" {
+		return 0, false
+	}
+	days, err := strconv.Atoi(env.BodyRetentionDays)
+	if err != nil || days <= 0 {
+		fmt.Printf("invalid BODY_RETENTION_DAYS %q, bodies don't expire\n", env.BodyRetentionDays)
+		return 0, false
+	}
+	if storage.RetentionEnabled() {
+		if retentionDays, err := strconv.Atoi(env.S3RetentionDays); err == nil && retentionDays > days {
+			days = retentionDays
+		}
+	}
+	return days, true
+}
+
+// BodiesKept returns true if the bodies of received emails are stored and kept indefinitely
+func BodiesKept() bool {
+	_, ok := BodyRetentionDays()
+	return !ok && !MetadataOnly()
+}
+
+// BodyExpiry returns the attribute value of BodyExpiresAtAttribute of an email received at timeReceived,
+// which is false if bodies don't expire
+func BodyExpiry(timeReceived time.Time) (types.AttributeValue, bool) {
+	days, ok := BodyRetentionDays()
+	if !ok {
+		return nil, false
+	}
+	expiresAt := timeReceived.AddDate(0, 0, days).Unix()
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt, 10)}, true
+}
+
+// ExpireBodies removes the bodies of the emails whose BodyExpiresAt passed by scanning the table, keeping their metadata.
+// The raw messages are deleted from S3, the blobs are released, and BodyExpiredTime is set on the emails.
+// Emails whose raw message is retained by S3 Object Lock, e.g. under legal hold, are left for a later run.
+// It's meant to be run daily, and returns the number of emails whose bodies expired.
+func ExpireBodies(ctx context.Context, client api.ExpireBodiesAPI, now time.Time) (int, error) {
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String(env.TableName),
+		ProjectionExpression: aws.String("MessageID, Blobs, " + storage.RawBucketAttribute + ", " + storage.RawKeyAttribute),
+		FilterExpression:     aws.String(BodyExpiresAtAttribute + " <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	}
+	expired := 0
+	for {
+		output, err := client.Scan(ctx, input)
+		if err != nil {
+			return expired, err
+		}
+		for _, item := range output.Items {
+			ok, err := expireBody(ctx, client, item, now)
+			if err != nil {
+				return expired, err
+			}
+			if ok {
+				expired++
+			}
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+	return expired, nil
+}
+
+// expireBody removes the bodies of an email, returning false if it's left for a later run
+func expireBody(ctx context.Context, client api.ExpireBodiesAPI, item map[string]types.AttributeValue, now time.Time) (bool, error) {
+	messageID, ok := item["MessageID"].(*types.AttributeValueMemberS)
+	if !ok {
+		return false, nil
+	}
+
+	location := storage.ItemLocation(item, messageID.Value)
+	if err := CheckRetention(ctx, client, location); err != nil {
+		if !errors.Is(err, &api.RetentionError{}) {
+			return false, err
+		}
+		fmt.Printf("bodies of %s are kept: %v\n", messageID.Value, err)
+		return false, nil
+	}
+	// the raw message is deleted first, so that the email is expired again if removing the bodies fails
+	if err := storage.S3.DeleteEmail(ctx, client, location); err != nil {
+		return false, err
+	}
+
+	expression := "SET BodyExpiredTime = :now REMOVE " + BodyExpiresAtAttribute
+	for _, attribute := range bodyAttributes {
+		expression += ", " + attribute
+	}
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": messageID,
+		},
+		UpdateExpression:    aws.String(expression),
+		ConditionExpression: aws.String("attribute_exists(" + BodyExpiresAtAttribute + ")"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			// deleted in the meantime
+			return false, nil
+		}
+		return false, err
+	}
+
+	// the bodies are removed, so blobs that fail to be released are only left behind
+	if err := blob.Release(ctx, client, blobsOf(item)); err != nil {
+		fmt.Printf("failed to release blobs: %v\n", err)
+	}
+	fmt.Printf("bodies of %s expired\n", messageID.Value)
+	return true, nil
+}
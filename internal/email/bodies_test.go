@@ -0,0 +1,141 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+func TestBodyRetentionDays(t *testing.T) {
+	defer func() {
+		env.BodyRetentionDays = ""
+		env.S3RetentionMode = ""
+		env.S3RetentionDays = ""
+	}()
+
+	tests := []struct {
+		days          string
+		retentionMode string
+		retentionDays string
+		expected      int
+		expectedOK    bool
+	}{
+		{days: ""},
+		{days: "invalid"},
+		{days: "-1"},
+		{days: "7", expected: 7, expectedOK: true},
+		{days: "7", retentionMode: "COMPLIANCE", retentionDays: "30", expected: 30, expectedOK: true},
+		{days: "7", retentionMode: "COMPLIANCE", retentionDays: "1", expected: 7, expectedOK: true},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.BodyRetentionDays = test.days
+			env.S3RetentionMode = test.retentionMode
+			env.S3RetentionDays = test.retentionDays
+			days, ok := BodyRetentionDays()
+			assert.Equal(t, test.expected, days)
+			assert.Equal(t, test.expectedOK, ok)
+		})
+	}
+}
+
+func TestBodyExpiry(t *testing.T) {
+	defer func() {
+		env.BodyRetentionDays = ""
+		env.MetadataOnly = ""
+	}()
+
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, ok := BodyExpiry(received)
+	assert.False(t, ok)
+	assert.True(t, BodiesKept())
+
+	env.BodyRetentionDays = "7"
+	expiresAt, ok := BodyExpiry(received)
+	assert.True(t, ok)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: strconv.FormatInt(received.AddDate(0, 0, 7).Unix(), 10)}, expiresAt)
+	assert.False(t, BodiesKept())
+
+	env.BodyRetentionDays = ""
+	env.MetadataOnly = "true"
+	assert.False(t, BodiesKept())
+}
+
+func TestExpireBodies(t *testing.T) {
+	env.TableName = "table-for-bodies"
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+
+	var deleted []string
+	var updates []*dynamodb.UpdateItemInput
+	var released []string
+	client := clients.Fake{
+		MockScan: func(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+			assert.Equal(t, "BodyExpiresAt <= :now", *params.FilterExpression)
+			assert.Equal(t, strconv.FormatInt(now.Unix(), 10), params.ExpressionAttributeValues[":now"].(*types.AttributeValueMemberN).Value)
+			if params.ExclusiveStartKey == nil {
+				return &dynamodb.ScanOutput{
+					Items: []map[string]types.AttributeValue{{
+						"MessageID": &types.AttributeValueMemberS{Value: "first"},
+						"Blobs":     &types.AttributeValueMemberSS{Value: []string{"exampleHash"}},
+					}},
+					LastEvaluatedKey: map[string]types.AttributeValue{"MessageID": &types.AttributeValueMemberS{Value: "first"}},
+				}, nil
+			}
+			return &dynamodb.ScanOutput{
+				Items: []map[string]types.AttributeValue{
+					{"MessageID": &types.AttributeValueMemberS{Value: "second"}},
+					{"MessageID": &types.AttributeValueMemberS{Value: "deleted"}},
+				},
+			}, nil
+		},
+		MockDeleteObject: func(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+			deleted = append(deleted, *params.Key)
+			return &s3.DeleteObjectOutput{}, nil
+		},
+		MockUpdateItem: func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			messageID := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+			switch messageID {
+			case "blob#exampleHash":
+				released = append(released, messageID)
+				return &dynamodb.UpdateItemOutput{
+					Attributes: map[string]types.AttributeValue{"Refs": &types.AttributeValueMemberN{Value: "1"}},
+				}, nil
+			case "deleted":
+				return nil, &types.ConditionalCheckFailedException{}
+			}
+			updates = append(updates, params)
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+
+	expired, err := ExpireBodies(context.TODO(), client, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, expired)
+	assert.Equal(t, []string{"first", "second", "deleted"}, deleted)
+	assert.Equal(t, []string{"blob#exampleHash"}, released)
+	if assert.Len(t, updates, 2) {
+		assert.Equal(t, "SET BodyExpiredTime = :now REMOVE BodyExpiresAt, Text, HTML, Attachments, Inlines, OtherParts, AttachedEmails, Blobs",
+			*updates[0].UpdateExpression)
+		assert.Equal(t, "attribute_exists(BodyExpiresAt)", *updates[0].ConditionExpression)
+		assert.Equal(t, "2024-05-08T12:00:00Z", updates[0].ExpressionAttributeValues[":now"].(*types.AttributeValueMemberS).Value)
+	}
+
+	// the bodies are kept if the raw message can't be deleted
+	updates = nil
+	client.MockDeleteObject = func(_ context.Context, _ *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+		return nil, errors.New("error")
+	}
+	_, err = ExpireBodies(context.TODO(), client, now)
+	assert.EqualError(t, err, "error")
+	assert.Empty(t, updates)
+}
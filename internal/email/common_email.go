@@ -1,6 +1,20 @@
 package email
 
-import "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+import (
+	"errors"
+	"mime"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/addr"
+)
+
+// ErrNoReplyDisabled is returned by Validate for emails in no-reply mode when NO_REPLY_ADDRESS is not set
+var ErrNoReplyDisabled = errors.New("no-reply mode is not enabled")
 
 type Input struct {
 	MessageID  string   `json:"messageID"`
@@ -15,6 +29,50 @@ type Input struct {
 	Text       string `json:"text"`
 	HTML       string `json:"html"`
 	ThreadID   string `json:"threadID,omitempty"`
+	// NoReply sends the email with NO_REPLY_ADDRESS as Reply-To, replacing ReplyTo, e.g. for transactional emails
+	NoReply bool `json:"noReply"`
+	// DryRun validates, sends to the dry-run sink and stores the email as if it was sent, e.g. in staging environments
+	DryRun bool `json:"dryRun"`
+	// SendAttempts are the failed attempts to send the email, which are retried if they are transient
+	SendAttempts []SendAttempt `json:"-"`
+	// Uploads are files uploaded with pre-signed POSTs, which are attached when the email is sent
+	Uploads []UploadedFile `json:"uploads,omitempty"`
+}
+
+// UploadedFile is an attachment of a draft uploaded directly to S3, see storage.PresignUpload
+type UploadedFile struct {
+	UploadID    string `json:"uploadID"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+}
+
+// Validate checks that all addresses are valid, allowing internationalized addresses,
+// and that no-reply mode is enabled if it's used
+func (e Input) Validate() error {
+	if e.NoReply && env.NoReplyAddress == "" {
+		return ErrNoReplyDisabled
+	}
+	for _, list := range [][]string{e.From, e.To, e.Cc, e.Bcc, e.ReplyTo} {
+		if err := addr.ValidateAll(list); err != nil {
+			return err
+		}
+	}
+	for _, upload := range e.Uploads {
+		if !storage.ValidUploadID(upload.UploadID) || upload.Filename == "" {
+			return api.ErrInvalidInput
+		}
+		if _, _, err := mime.ParseMediaType(upload.ContentType); err != nil {
+			return api.ErrInvalidInput
+		}
+	}
+	return nil
+}
+
+// ApplyNoReply replaces the Reply-To of emails in no-reply mode with NO_REPLY_ADDRESS
+func (e *Input) ApplyNoReply() {
+	if e.NoReply {
+		e.ReplyTo = []string{env.NoReplyAddress}
+	}
 }
 
 // GenerateAttributes generates DynamoDB AttributeValues
@@ -52,6 +110,22 @@ func (e Input) GenerateAttributes(typeYearMonth, dateTime string) map[string]typ
 	if e.ThreadID != "" {
 		item["ThreadID"] = &types.AttributeValueMemberS{Value: e.ThreadID}
 	}
+	if e.NoReply {
+		item["NoReply"] = &types.AttributeValueMemberBOOL{Value: true}
+	}
+	if e.DryRun {
+		item["DryRun"] = &types.AttributeValueMemberBOOL{Value: true}
+	}
+	if len(e.SendAttempts) > 0 {
+		if attempts, err := attributevalue.Marshal(e.SendAttempts); err == nil {
+			item["SendAttempts"] = attempts
+		}
+	}
+	if len(e.Uploads) > 0 {
+		if uploads, err := attributevalue.Marshal(e.Uploads); err == nil {
+			item["Uploads"] = uploads
+		}
+	}
 
 	return item
 }
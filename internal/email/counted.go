@@ -0,0 +1,142 @@
+package email
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/counter"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// getCountedState gets the state of an email that decides which counter it's counted in.
+// counted is false if counters are disabled, or if the email doesn't exist or isn't counted.
+func getCountedState(ctx context.Context, client api.GetItemAPI, messageID string) (state counter.State, counted bool, err error) {
+	if !counter.Enabled() {
+		return counter.State{}, false, nil
+	}
+
+	output, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		ProjectionExpression: aws.String(counter.StateAttributes),
+	})
+	if err != nil {
+		return counter.State{}, false, err
+	}
+	if len(output.Item) == 0 {
+		return counter.State{}, false, nil
+	}
+
+	state = counter.StateOf(output.Item)
+	return state, state.Counted(), nil
+}
+
+// NewEmailCounterUpdates returns the counter updates of storing a new email, if counters are maintained
+func NewEmailCounterUpdates(item map[string]types.AttributeValue) []types.TransactWriteItem {
+	if !counter.Enabled() {
+		return nil
+	}
+	state := counter.StateOf(item)
+	if !state.Counted() {
+		return nil
+	}
+	return counter.Updates(counter.Add(state)...)
+}
+
+// withStateCondition returns condition combined with the condition that the email is still in state,
+// and values merged with the attribute values used by the latter
+func withStateCondition(condition *string, values map[string]types.AttributeValue, state counter.State) (*string, map[string]types.AttributeValue) {
+	expression, stateValues := state.Condition()
+	if condition != nil {
+		expression = "(" + *condition + ") AND " + expression
+	}
+	for k, v := range values {
+		stateValues[k] = v
+	}
+	return aws.String(expression), stateValues
+}
+
+// updateEmail updates an email. If the email is counted,
+// the update and the counter changes made by transition are applied in a single transaction.
+func updateEmail(ctx context.Context, client api.UpdateCountedEmailAPI, input *dynamodb.UpdateItemInput, messageID string,
+	transition func(counter.State) counter.State) error {
+	state, counted, err := getCountedState(ctx, client, messageID)
+	if err != nil {
+		return err
+	}
+	if !counted {
+		_, err = client.UpdateItem(ctx, input)
+		return err
+	}
+
+	condition, values := withStateCondition(input.ConditionExpression, input.ExpressionAttributeValues, state)
+	return counter.Transact(ctx, client, types.TransactWriteItem{
+		Update: &types.Update{
+			TableName:                 input.TableName,
+			Key:                       input.Key,
+			UpdateExpression:          input.UpdateExpression,
+			ConditionExpression:       condition,
+			ExpressionAttributeNames:  input.ExpressionAttributeNames,
+			ExpressionAttributeValues: values,
+
+			ReturnValuesOnConditionCheckFailure: input.ReturnValuesOnConditionCheckFailure,
+		},
+	}, counter.Transition(state, transition(state))...)
+}
+
+// deleteEmailItem deletes an email item and returns its blobs. If the email is counted,
+// it's deleted and removed from the counters in a single transaction.
+func deleteEmailItem(ctx context.Context, client api.DeleteCountedEmailAPI, input *dynamodb.DeleteItemInput, messageID string) (blobs []string, err error) {
+	state, counted, err := getCountedState(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if !counted {
+		output, err := client.DeleteItem(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		return blobsOf(output.Attributes), nil
+	}
+
+	// blobs are set when the email is received, so they can be read before the transaction
+	output, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            input.TableName,
+		Key:                  input.Key,
+		ProjectionExpression: aws.String("Blobs"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	condition, values := withStateCondition(input.ConditionExpression, input.ExpressionAttributeValues, state)
+	err = counter.Transact(ctx, client, types.TransactWriteItem{
+		Delete: &types.Delete{
+			TableName:                 input.TableName,
+			Key:                       input.Key,
+			ConditionExpression:       condition,
+			ExpressionAttributeNames:  input.ExpressionAttributeNames,
+			ExpressionAttributeValues: values,
+
+			ReturnValuesOnConditionCheckFailure: input.ReturnValuesOnConditionCheckFailure,
+		},
+	}, counter.Remove(state)...)
+	if err != nil {
+		return nil, err
+	}
+	return blobsOf(output.Item), nil
+}
+
+// blobsOf returns the hashes of the blobs referenced by an email item
+func blobsOf(item map[string]types.AttributeValue) []string {
+	if blobs, ok := item["Blobs"].(*types.AttributeValueMemberSS); ok {
+		return blobs.Value
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockCountedEmailAPI struct {
+	item               map[string]types.AttributeValue
+	mockTransact       func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	updateItemCalled   bool
+	deleteItemCalled   bool
+	deleteObjectCalled bool
+}
+
+func (m *mockCountedEmailAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: m.item}, nil
+}
+
+func (m *mockCountedEmailAPI) UpdateItem(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.updateItemCalled = true
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (m *mockCountedEmailAPI) DeleteItem(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.deleteItemCalled = true
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (m *mockCountedEmailAPI) DeleteObject(_ context.Context, _ *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	m.deleteObjectCalled = true
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// HeadObject is only called when S3 retention is enabled
+func (m *mockCountedEmailAPI) HeadObject(_ context.Context, _ *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return nil, errors.New("unexpected HeadObject call")
+}
+
+func (m *mockCountedEmailAPI) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return m.mockTransact(ctx, params, optFns...)
+}
+
+func TestTrash_Counted(t *testing.T) {
+	env.TableName = "table-for-counters"
+	env.CountersTableName = "counters"
+	defer func() { env.CountersTableName = "" }()
+
+	tests := []struct {
+		item         map[string]types.AttributeValue
+		transactErr  error
+		transacted   bool
+		expectedErr  error
+		expectedCond string
+	}{
+		{
+			item: map[string]types.AttributeValue{
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+				"Unread":        &types.AttributeValueMemberBOOL{Value: true},
+			},
+			transacted: true,
+			expectedCond: "(attribute_not_exists(TrashedTime) AND NOT begins_with(TypeYearMonth, :v_type)) AND " +
+				"TypeYearMonth = :c_type AND attribute_exists(Unread) AND attribute_not_exists(TrashedTime) AND attribute_not_exists(Labels)",
+		},
+		{
+			item: map[string]types.AttributeValue{
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+			},
+			transactErr: &types.TransactionCanceledException{
+				CancellationReasons: []types.CancellationReason{{
+					Code: aws.String("ConditionalCheckFailed"),
+					Item: map[string]types.AttributeValue{
+						"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+						"TrashedTime":   &types.AttributeValueMemberS{Value: "2023-05-02T03:04:05Z"},
+					},
+				}},
+			},
+			transacted:  true,
+			expectedErr: &api.InvalidTransitionError{From: StateTrashed, To: StateTrashed},
+		},
+		{
+			// sent emails aren't counted
+			item: map[string]types.AttributeValue{
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "sent#2023-05"},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			transacted := false
+			client := &mockCountedEmailAPI{
+				item: test.item,
+				mockTransact: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					transacted = true
+					assert.Len(t, params.TransactItems, 3) // email, inbox counter, trash counter
+					update := params.TransactItems[0].Update
+					if test.expectedCond != "" {
+						assert.Equal(t, test.expectedCond, *update.ConditionExpression)
+					}
+					assert.Contains(t, update.ExpressionAttributeValues, ":v_type")
+					assert.Contains(t, update.ExpressionAttributeValues, ":c_type")
+					assert.Equal(t, "counters", *params.TransactItems[1].Update.TableName)
+					return &dynamodb.TransactWriteItemsOutput{}, test.transactErr
+				},
+			}
+
+			err := Trash(context.TODO(), client, "exampleMessageID")
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.transacted, transacted)
+			assert.Equal(t, !test.transacted, client.updateItemCalled)
+		})
+	}
+}
+
+func TestTrash_CountedConcurrentChange(t *testing.T) {
+	env.TableName = "table-for-counters"
+	env.CountersTableName = "counters"
+	defer func() { env.CountersTableName = "" }()
+
+	attempts := 0
+	client := &mockCountedEmailAPI{
+		item: map[string]types.AttributeValue{
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+		},
+		mockTransact: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			attempts++
+			assert.Equal(t, types.ReturnValuesOnConditionCheckFailureAllOld, params.TransactItems[0].Update.ReturnValuesOnConditionCheckFailure)
+			if attempts == 1 {
+				// the email is read by another request, which changes the counted state but not the lifecycle state
+				return nil, &types.TransactionCanceledException{
+					CancellationReasons: []types.CancellationReason{{
+						Code: aws.String("ConditionalCheckFailed"),
+						Item: map[string]types.AttributeValue{
+							"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+							"Unread":        &types.AttributeValueMemberBOOL{Value: true},
+						},
+					}},
+				}
+			}
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+	}
+
+	err := Trash(context.TODO(), client, "exampleMessageID")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestDelete_Counted(t *testing.T) {
+	env.TableName = "table-for-counters"
+	env.CountersTableName = "counters"
+	defer func() { env.CountersTableName = "" }()
+
+	client := &mockCountedEmailAPI{
+		item: map[string]types.AttributeValue{
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+			"TrashedTime":   &types.AttributeValueMemberS{Value: "2023-05-01T00:00:00Z"},
+		},
+		mockTransact: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			assert.Len(t, params.TransactItems, 2)
+			assert.NotNil(t, params.TransactItems[0].Delete)
+			counter := params.TransactItems[1].Update
+			assert.Equal(t, &types.AttributeValueMemberS{Value: "trash"}, counter.Key["Folder"])
+			assert.Equal(t, &types.AttributeValueMemberN{Value: "-1"}, counter.ExpressionAttributeValues[":total"])
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+	}
+
+	err := Delete(context.TODO(), client, "exampleMessageID")
+	assert.Nil(t, err)
+	assert.False(t, client.deleteItemCalled)
+	assert.True(t, client.deleteObjectCalled)
+}
+
+func TestUpdateLabels_Counted(t *testing.T) {
+	env.TableName = "table-for-counters"
+	env.CountersTableName = "counters"
+	defer func() { env.CountersTableName = "" }()
+
+	var folders []string
+	client := &mockCountedEmailAPI{
+		item: map[string]types.AttributeValue{
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+			"Labels":        &types.AttributeValueMemberSS{Value: []string{"Work"}},
+		},
+		mockTransact: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			update := params.TransactItems[0].Update
+			assert.Equal(t, "ADD Labels :labels", *update.UpdateExpression)
+			assert.Equal(t, "(attribute_exists(MessageID) AND NOT begins_with(TypeYearMonth, :v_thread)) AND "+
+				"TypeYearMonth = :c_type AND attribute_not_exists(Unread) AND attribute_not_exists(TrashedTime) AND Labels = :c_labels",
+				*update.ConditionExpression)
+			for _, item := range params.TransactItems[1:] {
+				folders = append(folders, item.Update.Key["Folder"].(*types.AttributeValueMemberS).Value)
+			}
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+	}
+
+	err := UpdateLabels(context.TODO(), client, UpdateLabelsInput{MessageID: "exampleMessageID", Add: []string{"Work", "Receipts"}})
+	assert.Nil(t, err)
+	// the email is already counted in the inbox and Work
+	assert.Equal(t, []string{"label#Receipts"}, folders)
+	assert.False(t, client.updateItemCalled)
+}
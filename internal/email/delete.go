@@ -4,20 +4,31 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/blob"
 	"github.com/harryzcy/mailbox/internal/datasource/storage"
 	"github.com/harryzcy/mailbox/internal/env"
 )
 
-// Delete deletes an trashed email from DynamoDB and S3.
-// This action won't be successful if it's not trashed.
-func Delete(ctx context.Context, client api.DeleteItemAPI, messageID string) error {
-	_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+// Delete deletes an trashed email or a draft from DynamoDB and S3, which moves it to the purged state.
+// An InvalidTransitionError is returned if it's not trashed, ErrPartOfThread if it's part of a thread,
+// and a RetentionError if its raw message is protected by S3 Object Lock.
+func Delete(ctx context.Context, client api.DeleteCountedEmailAPI, messageID string) error {
+	location, err := RawLocation(ctx, client, messageID)
+	if err != nil {
+		return err
+	}
+	if err = CheckRetention(ctx, client, location); err != nil {
+		return err
+	}
+
+	input := &dynamodb.DeleteItemInput{
 		TableName: aws.String(env.TableName),
 		Key: map[string]types.AttributeValue{
 			"MessageID": &types.AttributeValueMemberS{Value: messageID},
@@ -26,16 +37,22 @@ func Delete(ctx context.Context, client api.DeleteItemAPI, messageID string) err
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":v_type": &types.AttributeValueMemberS{Value: EmailTypeDraft},
 		},
+		ReturnValues:                        types.ReturnValueAllOld, // to get the blobs of the email
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+	var blobs []string
+	err = transitionEmail(opDelete, func() (err error) {
+		blobs, err = deleteEmailItem(ctx, client, input, messageID)
+		return err
 	})
 	if err != nil {
-		var condFailedErr *types.ConditionalCheckFailedException
-		if errors.As(err, &condFailedErr) {
-			return &api.NotTrashedError{Type: "email"}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
 		}
 		return err
 	}
 
-	err = storage.S3.DeleteEmail(ctx, client, messageID)
+	err = storage.S3.DeleteEmail(ctx, client, location)
 	if err != nil {
 		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
 			return api.ErrTooManyRequests
@@ -43,6 +60,31 @@ func Delete(ctx context.Context, client api.DeleteItemAPI, messageID string) err
 		return err
 	}
 
+	// the email is deleted, so blobs that fail to be released are only left behind
+	if err := blob.Release(ctx, client, blobs); err != nil {
+		fmt.Printf("failed to release blobs: %v\n", err)
+	}
+
 	fmt.Println("delete method finished successfully")
 	return nil
 }
+
+// CheckRetention returns a RetentionError if the raw message of an email can't be deleted due to S3 Object Lock.
+// It's checked only if S3_RETENTION_MODE is set, before the email is deleted from DynamoDB,
+// since deleting a protected object only hides it behind a delete marker.
+func CheckRetention(ctx context.Context, client storage.S3HeadObjectAPI, location storage.Location) error {
+	if !storage.RetentionEnabled() {
+		return nil
+	}
+	retention, err := storage.GetRetention(ctx, client, location)
+	if err != nil {
+		return err
+	}
+	if retention == nil {
+		return nil
+	}
+	if retention.LegalHold {
+		return &api.RetentionError{}
+	}
+	return &api.RetentionError{Until: retention.Until.UTC().Format(time.RFC3339)}
+}
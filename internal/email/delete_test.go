@@ -2,39 +2,72 @@ package email
 
 import (
 	"context"
+	"errors"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockDeleteItemAPI struct {
+	rawItem          map[string]types.AttributeValue // item with the location of the raw email
 	mockDeleteItem   func(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
 	mockDeleteObject func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	mockHeadObject   func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
 }
 
 func (m mockDeleteItemAPI) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
 	return m.mockDeleteItem(ctx, params, optFns...)
 }
 
+// GetItem is only called to get the location of the raw email, or when counters are enabled
+func (m mockDeleteItemAPI) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if *params.ProjectionExpression != storage.RawBucketAttribute+", "+storage.RawKeyAttribute {
+		return nil, errors.New("unexpected GetItem call")
+	}
+	return &dynamodb.GetItemOutput{Item: m.rawItem}, nil
+}
+
+// TransactWriteItems is only called when counters are enabled
+func (m mockDeleteItemAPI) TransactWriteItems(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return nil, errors.New("unexpected TransactWriteItems call")
+}
+
+// UpdateItem is only called when the email has blobs
+func (m mockDeleteItemAPI) UpdateItem(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return nil, errors.New("unexpected UpdateItem call")
+}
+
 func (m mockDeleteItemAPI) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
 	return m.mockDeleteObject(ctx, params, optFns...)
 }
 
+// HeadObject is only called when S3 retention is enabled
+func (m mockDeleteItemAPI) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if m.mockHeadObject == nil {
+		return nil, errors.New("unexpected HeadObject call")
+	}
+	return m.mockHeadObject(ctx, params, optFns...)
+}
+
 func TestDelete(t *testing.T) {
 	env.TableName = "table-for-delete"
 	tests := []struct {
-		client      func(t *testing.T) api.DeleteItemAPI
+		client      func(t *testing.T) api.DeleteCountedEmailAPI
 		messageID   string
 		expectedErr error
 	}{
 		{
-			client: func(t *testing.T) api.DeleteItemAPI {
+			client: func(t *testing.T) api.DeleteCountedEmailAPI {
 				return mockDeleteItemAPI{
 					mockDeleteItem: func(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
 						t.Helper()
@@ -64,7 +97,7 @@ func TestDelete(t *testing.T) {
 			messageID: "exampleMessageID",
 		},
 		{
-			client: func(t *testing.T) api.DeleteItemAPI {
+			client: func(t *testing.T) api.DeleteCountedEmailAPI {
 				t.Helper()
 				return mockDeleteItemAPI{
 					mockDeleteItem: func(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
@@ -75,10 +108,42 @@ func TestDelete(t *testing.T) {
 					},
 				}
 			},
-			expectedErr: &api.NotTrashedError{Type: "email"},
+			expectedErr: &api.InvalidTransitionError{From: StatePurged, To: StatePurged},
+		},
+		{
+			client: func(t *testing.T) api.DeleteCountedEmailAPI {
+				t.Helper()
+				return mockDeleteItemAPI{
+					mockDeleteItem: func(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+						return &dynamodb.DeleteItemOutput{}, &types.ConditionalCheckFailedException{
+							Item: map[string]types.AttributeValue{
+								"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+							},
+						}
+					},
+				}
+			},
+			expectedErr: &api.InvalidTransitionError{From: StateInbox, To: StatePurged},
+		},
+		{
+			client: func(t *testing.T) api.DeleteCountedEmailAPI {
+				t.Helper()
+				return mockDeleteItemAPI{
+					mockDeleteItem: func(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+						return &dynamodb.DeleteItemOutput{}, &types.ConditionalCheckFailedException{
+							Item: map[string]types.AttributeValue{
+								"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+								"TrashedTime":   &types.AttributeValueMemberS{Value: "2023-05-02T03:04:05Z"},
+								"ThreadID":      &types.AttributeValueMemberS{Value: "exampleThreadID"},
+							},
+						}
+					},
+				}
+			},
+			expectedErr: api.ErrPartOfThread,
 		},
 		{
-			client: func(t *testing.T) api.DeleteItemAPI {
+			client: func(t *testing.T) api.DeleteCountedEmailAPI {
 				t.Helper()
 				return mockDeleteItemAPI{
 					mockDeleteItem: func(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
@@ -92,7 +157,7 @@ func TestDelete(t *testing.T) {
 			expectedErr: &api.NotTrashedError{Type: "email"},
 		},
 		{
-			client: func(t *testing.T) api.DeleteItemAPI {
+			client: func(t *testing.T) api.DeleteCountedEmailAPI {
 				t.Helper()
 				return mockDeleteItemAPI{
 					mockDeleteItem: func(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
@@ -105,6 +170,26 @@ func TestDelete(t *testing.T) {
 			},
 			expectedErr: api.ErrNotFound,
 		},
+		{
+			client: func(t *testing.T) api.DeleteCountedEmailAPI {
+				t.Helper()
+				return mockDeleteItemAPI{
+					rawItem: map[string]types.AttributeValue{
+						storage.RawBucketAttribute: &types.AttributeValueMemberS{Value: "other-bucket"},
+						storage.RawKeyAttribute:    &types.AttributeValueMemberS{Value: "large/exampleMessageID"},
+					},
+					mockDeleteItem: func(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+						return &dynamodb.DeleteItemOutput{}, nil
+					},
+					mockDeleteObject: func(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+						assert.Equal(t, "other-bucket", *params.Bucket)
+						assert.Equal(t, "large/exampleMessageID", *params.Key)
+						return &s3.DeleteObjectOutput{}, nil
+					},
+				}
+			},
+			messageID: "exampleMessageID",
+		},
 	}
 
 	for i, test := range tests {
@@ -116,3 +201,60 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestDelete_Retention(t *testing.T) {
+	env.TableName = "table-for-delete"
+	env.S3RetentionMode = "COMPLIANCE"
+	defer func() { env.S3RetentionMode = "" }()
+
+	until := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	tests := []struct {
+		output      *s3.HeadObjectOutput
+		err         error
+		deleted     bool
+		expectedErr error
+	}{
+		{
+			output:  &s3.HeadObjectOutput{},
+			deleted: true,
+		},
+		{
+			err:     &s3Types.NotFound{},
+			deleted: true,
+		},
+		{
+			output:      &s3.HeadObjectOutput{ObjectLockRetainUntilDate: aws.Time(until)},
+			expectedErr: &api.RetentionError{Until: until.Format(time.RFC3339)},
+		},
+		{
+			output: &s3.HeadObjectOutput{
+				ObjectLockRetainUntilDate: aws.Time(until),
+				ObjectLockLegalHoldStatus: s3Types.ObjectLockLegalHoldStatusOn,
+			},
+			expectedErr: &api.RetentionError{},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			deleted := false
+			client := mockDeleteItemAPI{
+				mockHeadObject: func(_ context.Context, params *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+					assert.Equal(t, "exampleMessageID", *params.Key)
+					return test.output, test.err
+				},
+				mockDeleteItem: func(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+					deleted = true
+					return &dynamodb.DeleteItemOutput{}, nil
+				},
+				mockDeleteObject: func(_ context.Context, _ *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+					return &s3.DeleteObjectOutput{}, nil
+				},
+			}
+
+			err := Delete(context.TODO(), client, "exampleMessageID")
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.deleted, deleted)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
+)
+
+// DeliveryPathResult represents the result of get delivery path method
+type DeliveryPathResult struct {
+	MessageID    string     `json:"messageID"`
+	DeliveryPath types.Hops `json:"deliveryPath"`
+}
+
+// GetDeliveryPath returns the relays an inbox email passed through,
+// ordered from the origin to the final destination
+func GetDeliveryPath(ctx context.Context, client api.GetItemAPI, messageID string) (*DeliveryPathResult, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		},
+		ProjectionExpression: aws.String("MessageID, DeliveryPath"),
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, api.ErrNotFound
+	}
+
+	result := new(DeliveryPathResult)
+	err = attributevalue.UnmarshalMap(resp.Item, result)
+	if err != nil {
+		return nil, err
+	}
+	if result.DeliveryPath == nil {
+		// emails received before delivery path is recorded
+		result.DeliveryPath = types.Hops{}
+	}
+
+	fmt.Println("get delivery path method finished successfully")
+	return result, nil
+}
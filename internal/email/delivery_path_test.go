@@ -0,0 +1,105 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDeliveryPath(t *testing.T) {
+	env.TableName = "table-for-get-delivery-path"
+	tests := []struct {
+		client      func(t *testing.T) api.GetItemAPI
+		messageID   string
+		expected    *DeliveryPathResult
+		expectedErr error
+	}{
+		{
+			client: func(t *testing.T) api.GetItemAPI {
+				return mockGetItemAPI(func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					t.Helper()
+					assert.Equal(t, env.TableName, *params.TableName)
+					assert.Equal(t, "exampleMessageID", params.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+					assert.Equal(t, "MessageID, DeliveryPath", *params.ProjectionExpression)
+
+					return &dynamodb.GetItemOutput{
+						Item: map[string]dynamodbTypes.AttributeValue{
+							"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "exampleMessageID"},
+							"DeliveryPath": types.Hops{
+								{From: "a.example.com", By: "b.example.com", IP: "192.0.2.1", With: "SMTP", Timestamp: "2024-03-12T10:10:10Z", Delay: 3},
+							}.ToAttributeValue(),
+						},
+					}, nil
+				})
+			},
+			messageID: "exampleMessageID",
+			expected: &DeliveryPathResult{
+				MessageID: "exampleMessageID",
+				DeliveryPath: types.Hops{
+					{From: "a.example.com", By: "b.example.com", IP: "192.0.2.1", With: "SMTP", Timestamp: "2024-03-12T10:10:10Z", Delay: 3},
+				},
+			},
+		},
+		{
+			client: func(t *testing.T) api.GetItemAPI {
+				return mockGetItemAPI(func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					t.Helper()
+					return &dynamodb.GetItemOutput{
+						Item: map[string]dynamodbTypes.AttributeValue{
+							"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "exampleMessageID"},
+						},
+					}, nil
+				})
+			},
+			messageID: "exampleMessageID",
+			expected: &DeliveryPathResult{
+				MessageID:    "exampleMessageID",
+				DeliveryPath: types.Hops{},
+			},
+		},
+		{
+			client: func(t *testing.T) api.GetItemAPI {
+				return mockGetItemAPI(func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					t.Helper()
+					return &dynamodb.GetItemOutput{}, nil
+				})
+			},
+			expectedErr: api.ErrNotFound,
+		},
+		{
+			client: func(t *testing.T) api.GetItemAPI {
+				return mockGetItemAPI(func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					t.Helper()
+					return nil, &dynamodbTypes.ProvisionedThroughputExceededException{}
+				})
+			},
+			expectedErr: api.ErrTooManyRequests,
+		},
+		{
+			client: func(t *testing.T) api.GetItemAPI {
+				return mockGetItemAPI(func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					t.Helper()
+					return nil, errors.New("error")
+				})
+			},
+			expectedErr: errors.New("error"),
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.TODO()
+			actual, err := GetDeliveryPath(ctx, test.client(t), test.messageID)
+			assert.Equal(t, test.expected, actual)
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package email
+
+import (
+	"context"
+
+	"github.com/harryzcy/mailbox/internal/api"
+)
+
+// ListDraftsInput represents the input of ListDrafts method
+type ListDraftsInput struct {
+	PageSize   int     `json:"pageSize"` // default is 100
+	NextCursor *Cursor `json:"nextCursor"`
+}
+
+// ListDrafts lists drafts by the time they're last edited, most recent first.
+// Drafts are stored in the month they're last edited, so the latest drafts are listed across months.
+func ListDrafts(ctx context.Context, client api.ListEmailsAPI, input ListDraftsInput) (*ListResult, error) {
+	if input.PageSize <= 0 {
+		input.PageSize = DefaultPageSize
+	}
+	return List(ctx, client, ListInput{
+		Type:       EmailTypeDraft,
+		PageSize:   input.PageSize,
+		NextCursor: input.NextCursor,
+	})
+}
@@ -0,0 +1,48 @@
+package email
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListDrafts(t *testing.T) {
+	now = func() time.Time { return time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() {
+		now = time.Now // cleanup
+	}()
+
+	var queried []string
+	found := 0
+	client := mockQueryAPI(func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+		typeYearMonth := params.ExpressionAttributeValues[":val"].(*types.AttributeValueMemberS).Value
+		queried = append(queried, typeYearMonth)
+		assert.False(t, *params.ScanIndexForward)
+		assert.Equal(t, int32(DefaultPageSize-found), *params.Limit) // the rest of the page
+
+		output := &dynamodb.QueryOutput{}
+		if typeYearMonth == "draft#2022-02" {
+			output.Items = []map[string]types.AttributeValue{
+				{
+					"MessageID":     &types.AttributeValueMemberS{Value: "draft-1"},
+					"TypeYearMonth": &types.AttributeValueMemberS{Value: typeYearMonth},
+					"DateTime":      &types.AttributeValueMemberS{Value: "20-10:00:00"},
+				},
+			}
+		}
+		found += len(output.Items)
+		return output, nil
+	})
+
+	result, err := ListDrafts(context.TODO(), mockListEmailsAPI{QueryAPI: client, oldest: "2021-02"}, ListDraftsInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, "draft#2022-03", queried[0])
+	assert.Equal(t, "draft#2022-02", queried[1])
+	assert.Len(t, result.Items, 1)
+	assert.Equal(t, "draft-1", result.Items[0].MessageID)
+	assert.Equal(t, "2022-02-20T10:00:00Z", result.Items[0].TimeUpdated)
+}
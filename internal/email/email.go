@@ -5,6 +5,8 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+	"github.com/harryzcy/mailbox/internal/util/addr"
 	"github.com/harryzcy/mailbox/internal/util/format"
 )
 
@@ -103,6 +105,15 @@ type Item struct {
 	Unread         *bool    `json:"unread,omitempty"`
 	ThreadID       string   `json:"threadID,omitempty"`
 	IsThreadLatest bool     `json:"isThreadLatest,omitempty"`
+	Flagged        bool     `json:"flagged,omitempty"`
+	Labels         []string `json:"labels,omitempty"`
+	ArchivedTime   string   `json:"archivedTime,omitempty"`
+
+	Stats *mailboxTypes.EmailStats `json:"stats,omitempty"`
+
+	// Send state and failed attempts of drafts whose sending failed, see ListOutbox
+	SendState    string        `json:"sendState,omitempty"`
+	SendAttempts []SendAttempt `json:"sendAttempts,omitempty"`
 }
 
 type RawEmailItem struct {
@@ -113,6 +124,12 @@ type RawEmailItem struct {
 	Unread         *bool    `json:"unread,omitempty"`
 	ThreadID       string   `json:"threadID,omitempty"`
 	IsThreadLatest bool     `json:"isThreadLatest,omitempty"`
+	Flagged        bool     `json:"flagged,omitempty"`
+	Labels         []string `json:"labels,omitempty"`
+	ArchivedTime   string   `json:"archivedTime,omitempty"`
+	Stats          *mailboxTypes.EmailStats
+	SendState      string
+	SendAttempts   []SendAttempt
 }
 
 func (raw RawEmailItem) ToEmailItem() (*Item, error) {
@@ -123,11 +140,17 @@ func (raw RawEmailItem) ToEmailItem() (*Item, error) {
 	item := &Item{
 		TimeIndex:      *index,
 		Subject:        raw.Subject,
-		From:           raw.From,
-		To:             raw.To,
+		From:           addr.DisplayAll(raw.From),
+		To:             addr.DisplayAll(raw.To),
 		Unread:         raw.Unread,
 		ThreadID:       raw.ThreadID,
 		IsThreadLatest: raw.IsThreadLatest,
+		Flagged:        raw.Flagged,
+		Labels:         raw.Labels,
+		ArchivedTime:   raw.ArchivedTime,
+		Stats:          raw.Stats,
+		SendState:      raw.SendState,
+		SendAttempts:   raw.SendAttempts,
 	}
 	if item.Unread == nil && item.Type == EmailTypeInbox {
 		item.Unread = new(bool)
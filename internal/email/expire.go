@@ -0,0 +1,114 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/blob"
+	"github.com/harryzcy/mailbox/internal/counter"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// ExpiresAtAttribute is the TTL attribute of the table, the epoch seconds when DynamoDB deletes a trashed email.
+// The deletion is processed from the table stream by Expire, which cleans up what's left outside the item.
+const ExpiresAtAttribute = "ExpiresAt"
+
+// trashRetentionDays returns the days trashed emails are kept, which is false if TRASH_RETENTION_DAYS isn't set.
+// It's at least S3_RETENTION_DAYS if S3_RETENTION_MODE is set, so that raw emails are no longer retained when they expire.
+func trashRetentionDays() (int, bool) {
+	if env.TrashRetentionDays == "" {
+		return 0, false
+	}
+	days, err := strconv.Atoi(env.TrashRetentionDays)
+	if err != nil || days <= 0 {
+		fmt.Printf("invalid TRASH_RETENTION_DAYS %q, trashed emails don't expire\n", env.TrashRetentionDays)
+		return 0, false
+	}
+	if storage.RetentionEnabled() {
+		if retentionDays, err := strconv.Atoi(env.S3RetentionDays); err == nil && retentionDays > days {
+			days = retentionDays
+		}
+	}
+	return days, true
+}
+
+// setTrashExpiry sets the TTL of an email trashed at trashedTime, if TRASH_RETENTION_DAYS is set.
+// Emails that are part of a thread never expire, since they can only be deleted with their thread.
+func setTrashExpiry(ctx context.Context, client api.UpdateItemAPI, messageID string, trashedTime time.Time) error {
+	days, ok := trashRetentionDays()
+	if !ok {
+		return nil
+	}
+
+	expiresAt := trashedTime.AddDate(0, 0, days).Unix()
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression:    aws.String("SET " + ExpiresAtAttribute + " = :expiresAt"),
+		ConditionExpression: aws.String("attribute_exists(TrashedTime) AND attribute_not_exists(ThreadID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt, 10)},
+		},
+	})
+	if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+		// part of a thread, or untrashed in the meantime
+		return nil
+	}
+	return err
+}
+
+// Expire cleans up an email that DynamoDB deleted when its trash expiry passed, given the old image of the item.
+// It removes the email from the folder counters, deletes its raw message from S3, and releases its blobs,
+// as Delete does for emails deleted by users. Items that aren't trashed emails are ignored.
+//
+// Errors are returned only before the counters are updated, so that the stream record can be retried.
+func Expire(ctx context.Context, client api.ExpireEmailAPI, item map[string]types.AttributeValue) error {
+	messageID, ok := item["MessageID"].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil
+	}
+	if StateOf(item) != StateTrashed {
+		fmt.Printf("ignoring expiry of %s, which isn't a trashed email\n", messageID.Value)
+		return nil
+	}
+
+	location := storage.ItemLocation(item, messageID.Value)
+	if err := CheckRetention(ctx, client, location); err != nil {
+		if !errors.Is(err, &api.RetentionError{}) {
+			return err
+		}
+		// deleting the raw message would only hide it behind a delete marker
+		fmt.Printf("raw message of expired email %s is kept: %v\n", messageID.Value, err)
+	} else if err := storage.S3.DeleteEmail(ctx, client, location); err != nil {
+		return err
+	}
+
+	if state := counter.StateOf(item); counter.Enabled() && state.Counted() {
+		_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: counter.Updates(counter.Remove(state)...),
+		})
+		if err != nil {
+			// the email is deleted either way, recounting fixes the counters
+			fmt.Printf("failed to update counters: %v\n", err)
+		}
+	}
+
+	// the email is deleted, so blobs that fail to be released are only left behind
+	if err := blob.Release(ctx, client, blobsOf(item)); err != nil {
+		fmt.Printf("failed to release blobs: %v\n", err)
+	}
+
+	fmt.Println("expire method finished successfully")
+	return nil
+}
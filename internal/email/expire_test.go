@@ -0,0 +1,146 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+func TestTrashRetentionDays(t *testing.T) {
+	defer func() {
+		env.TrashRetentionDays = ""
+		env.S3RetentionMode = ""
+		env.S3RetentionDays = ""
+	}()
+
+	tests := []struct {
+		days          string
+		retentionMode string
+		retentionDays string
+		expected      int
+		expectedOK    bool
+	}{
+		{days: ""},
+		{days: "invalid"},
+		{days: "0"},
+		{days: "30", expected: 30, expectedOK: true},
+		{days: "30", retentionMode: "GOVERNANCE", retentionDays: "90", expected: 90, expectedOK: true},
+		{days: "30", retentionMode: "GOVERNANCE", retentionDays: "7", expected: 30, expectedOK: true},
+		{days: "30", retentionDays: "90", expected: 30, expectedOK: true},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.TrashRetentionDays = test.days
+			env.S3RetentionMode = test.retentionMode
+			env.S3RetentionDays = test.retentionDays
+			days, ok := trashRetentionDays()
+			assert.Equal(t, test.expected, days)
+			assert.Equal(t, test.expectedOK, ok)
+		})
+	}
+}
+
+func TestTrash_Expiry(t *testing.T) {
+	env.TrashRetentionDays = "30"
+	defer func() { env.TrashRetentionDays = "" }()
+
+	var expressions []string
+	var expiresAt string
+	client := mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+		expressions = append(expressions, *params.UpdateExpression)
+		if value, ok := params.ExpressionAttributeValues[":expiresAt"].(*types.AttributeValueMemberN); ok {
+			assert.Equal(t, "attribute_exists(TrashedTime) AND attribute_not_exists(ThreadID)", *params.ConditionExpression)
+			expiresAt = value.Value
+		}
+		return &dynamodb.UpdateItemOutput{}, nil
+	})
+
+	before := time.Now().AddDate(0, 0, 30).Unix()
+	err := Trash(context.TODO(), client, "exampleMessageID")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"SET TrashedTime = :val1", "SET ExpiresAt = :expiresAt"}, expressions)
+	seconds, err := strconv.ParseInt(expiresAt, 10, 64)
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, seconds, before)
+	assert.LessOrEqual(t, seconds, time.Now().AddDate(0, 0, 30).Unix())
+
+	// emails that are part of a thread don't expire
+	client = mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+		if _, ok := params.ExpressionAttributeValues[":expiresAt"]; ok {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		return &dynamodb.UpdateItemOutput{}, nil
+	})
+	assert.Nil(t, Trash(context.TODO(), client, "exampleMessageID"))
+}
+
+func TestExpire(t *testing.T) {
+	env.CountersTableName = "counters"
+	defer func() { env.CountersTableName = "" }()
+
+	trashed := map[string]types.AttributeValue{
+		"MessageID":     &types.AttributeValueMemberS{Value: "exampleMessageID"},
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+		"TrashedTime":   &types.AttributeValueMemberS{Value: "2023-05-02T03:04:05Z"},
+		"Unread":        &types.AttributeValueMemberBOOL{Value: true},
+		"Blobs":         &types.AttributeValueMemberSS{Value: []string{"exampleHash"}},
+	}
+
+	var deleted []string
+	var transactions []*dynamodb.TransactWriteItemsInput
+	var released []string
+	client := clients.Fake{
+		MockDeleteObject: func(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+			deleted = append(deleted, *params.Key)
+			return &s3.DeleteObjectOutput{}, nil
+		},
+		MockTransactWriteItems: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			transactions = append(transactions, params)
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+		MockUpdateItem: func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			released = append(released, params.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+			return &dynamodb.UpdateItemOutput{
+				Attributes: map[string]types.AttributeValue{"Refs": &types.AttributeValueMemberN{Value: "1"}},
+			}, nil
+		},
+	}
+
+	err := Expire(context.TODO(), client, trashed)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"exampleMessageID"}, deleted)
+	if assert.Len(t, transactions, 1) && assert.Len(t, transactions[0].TransactItems, 1) {
+		update := transactions[0].TransactItems[0].Update
+		assert.Equal(t, "trash", update.Key["Folder"].(*types.AttributeValueMemberS).Value)
+		assert.Equal(t, "-1", update.ExpressionAttributeValues[":total"].(*types.AttributeValueMemberN).Value)
+		assert.Equal(t, "-1", update.ExpressionAttributeValues[":unread"].(*types.AttributeValueMemberN).Value)
+	}
+	assert.Equal(t, []string{"blob#exampleHash"}, released)
+
+	// items that aren't trashed emails are ignored
+	deleted = nil
+	assert.Nil(t, Expire(context.TODO(), client, map[string]types.AttributeValue{
+		"MessageID":     &types.AttributeValueMemberS{Value: "exampleMessageID"},
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+	}))
+	assert.Nil(t, Expire(context.TODO(), client, map[string]types.AttributeValue{}))
+	assert.Empty(t, deleted)
+
+	// the record is retried if the raw message can't be deleted
+	transactions = nil
+	client.MockDeleteObject = func(_ context.Context, _ *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+		return nil, errors.New("error")
+	}
+	assert.EqualError(t, Expire(context.TODO(), client, trashed), "error")
+	assert.Empty(t, transactions)
+}
@@ -0,0 +1,204 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/counter"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+const (
+	ActionStar   = "star"
+	ActionUnstar = "unstar"
+	// ActionFlag and ActionUnflag are the same as ActionStar and ActionUnstar, for clients that call stars flags
+	ActionFlag   = "flag"
+	ActionUnflag = "unflag"
+)
+
+const (
+	// MaxLabels is the maximum number of labels that can be added or removed at once
+	MaxLabels = 50
+	// MaxLabelLength is the maximum length of a label
+	MaxLabelLength = 100
+)
+
+// flagsInput returns the input to apply an update expression to an existing email, touching only the attributes in the expression.
+// Threads are not emails, so they can't be updated.
+func flagsInput(messageID, updateExpression string, values map[string]types.AttributeValue) *dynamodb.UpdateItemInput {
+	if values == nil {
+		values = make(map[string]types.AttributeValue)
+	}
+	values[":v_thread"] = &types.AttributeValueMemberS{Value: EmailTypeThread}
+
+	return &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression:          aws.String(updateExpression),
+		ConditionExpression:       aws.String("attribute_exists(MessageID) AND NOT begins_with(TypeYearMonth, :v_thread)"),
+		ExpressionAttributeValues: values,
+	}
+}
+
+// flagsError maps the error of a flags update to the API errors
+func flagsError(err error) error {
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return api.ErrNotFound
+		}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
+
+// updateFlags applies an update expression to an existing email
+func updateFlags(ctx context.Context, client api.UpdateItemAPI, messageID, updateExpression string, values map[string]types.AttributeValue) error {
+	_, err := client.UpdateItem(ctx, flagsInput(messageID, updateExpression, values))
+	return flagsError(err)
+}
+
+// updateLabels applies an update expression with labels to the Labels attribute of an existing email.
+// The label counters are changed in the same transaction, as transition changes the labels of the email.
+func updateLabels(ctx context.Context, client api.UpdateCountedEmailAPI, messageID, updateExpression string, labels []string,
+	transition func(current, labels []string) []string) error {
+	input := flagsInput(messageID, updateExpression, map[string]types.AttributeValue{
+		":labels": &types.AttributeValueMemberSS{Value: labels},
+	})
+	err := updateEmail(ctx, client, input, messageID, func(state counter.State) counter.State {
+		state.Labels = transition(state.Labels, labels)
+		return state
+	})
+	return flagsError(err)
+}
+
+// Star stars or unstars an email, which is recorded in the Flagged attribute
+func Star(ctx context.Context, client api.UpdateItemAPI, messageID, action string) error {
+	var err error
+	switch action {
+	case ActionStar, ActionFlag:
+		err = updateFlags(ctx, client, messageID, "SET Flagged = :flagged", map[string]types.AttributeValue{
+			":flagged": &types.AttributeValueMemberBOOL{Value: true},
+		})
+	case ActionUnstar, ActionUnflag:
+		err = updateFlags(ctx, client, messageID, "REMOVE Flagged", nil)
+	default:
+		return api.ErrInvalidInput
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("star method finished successfully")
+	return nil
+}
+
+// UpdateLabelsInput represents the input of UpdateLabels method
+type UpdateLabelsInput struct {
+	MessageID string   `json:"-"`
+	Add       []string `json:"add"`
+	Remove    []string `json:"remove"`
+}
+
+// UpdateLabels adds and removes labels of an email.
+// Labels are stored in a string set, so that they are changed without reading the email first,
+// unless the email is counted in the label counters.
+func UpdateLabels(ctx context.Context, client api.UpdateCountedEmailAPI, input UpdateLabelsInput) error {
+	add, err := NormalizeLabels(input.Add)
+	if err != nil {
+		return err
+	}
+	remove, err := NormalizeLabels(input.Remove)
+	if err != nil {
+		return err
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return api.ErrInvalidInput
+	}
+
+	// a string set can't be both added to and deleted from in one expression
+	if len(add) > 0 {
+		err = updateLabels(ctx, client, input.MessageID, "ADD Labels :labels", add, unionLabels)
+		if err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		err = updateLabels(ctx, client, input.MessageID, "DELETE Labels :labels", remove, subtractLabels)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("update labels method finished successfully")
+	return nil
+}
+
+// NormalizeLabels trims and deduplicates labels, and validates them.
+// api.ErrInvalidInput is returned if there are more than MaxLabels labels, or a label is empty or too long.
+func NormalizeLabels(labels []string) ([]string, error) {
+	if len(labels) > MaxLabels {
+		return nil, api.ErrInvalidInput
+	}
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(labels))
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" || len(label) > MaxLabelLength {
+			return nil, api.ErrInvalidInput
+		}
+		if seen[label] {
+			continue
+		}
+		seen[label] = true
+		result = append(result, label)
+	}
+	return result, nil
+}
+
+// unionLabels returns the labels in either current or labels, sorted as in counter.State
+func unionLabels(current, labels []string) []string {
+	set := make(map[string]bool, len(current)+len(labels))
+	for _, label := range current {
+		set[label] = true
+	}
+	for _, label := range labels {
+		set[label] = true
+	}
+	return sortedLabels(set)
+}
+
+// subtractLabels returns the labels in current but not in labels, sorted as in counter.State
+func subtractLabels(current, labels []string) []string {
+	set := make(map[string]bool, len(current))
+	for _, label := range current {
+		set[label] = true
+	}
+	for _, label := range labels {
+		delete(set, label)
+	}
+	return sortedLabels(set)
+}
+
+func sortedLabels(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(set))
+	for label := range set {
+		result = append(result, label)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,80 @@
+package email
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStar(t *testing.T) {
+	tests := []struct {
+		action             string
+		updateErr          error
+		expectedExpression string
+		expectedErr        error
+	}{
+		{action: ActionStar, expectedExpression: "SET Flagged = :flagged"},
+		{action: ActionUnstar, expectedExpression: "REMOVE Flagged"},
+		{action: ActionFlag, expectedExpression: "SET Flagged = :flagged"},
+		{action: ActionUnflag, expectedExpression: "REMOVE Flagged"},
+		{action: ActionStar, updateErr: &types.ConditionalCheckFailedException{}, expectedExpression: "SET Flagged = :flagged", expectedErr: api.ErrNotFound},
+		{action: "invalid", expectedErr: api.ErrInvalidInput},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+				assert.Equal(t, test.expectedExpression, *params.UpdateExpression)
+				assert.Equal(t, "attribute_exists(MessageID) AND NOT begins_with(TypeYearMonth, :v_thread)", *params.ConditionExpression)
+				return &dynamodb.UpdateItemOutput{}, test.updateErr
+			})
+			err := Star(context.TODO(), client, "exampleMessageID", test.action)
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+}
+
+func TestUpdateLabels(t *testing.T) {
+	tests := []struct {
+		input       UpdateLabelsInput
+		expected    map[string][]string // update expression -> labels
+		expectedErr error
+	}{
+		{
+			input: UpdateLabelsInput{Add: []string{" Work ", "Receipts", "Work"}, Remove: []string{"Personal"}},
+			expected: map[string][]string{
+				"ADD Labels :labels":    {"Work", "Receipts"},
+				"DELETE Labels :labels": {"Personal"},
+			},
+		},
+		{
+			input:       UpdateLabelsInput{},
+			expectedErr: api.ErrInvalidInput,
+		},
+		{
+			input:       UpdateLabelsInput{Add: []string{" "}},
+			expectedErr: api.ErrInvalidInput,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			updates := map[string][]string{}
+			client := mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+				updates[*params.UpdateExpression] = params.ExpressionAttributeValues[":labels"].(*types.AttributeValueMemberSS).Value
+				return &dynamodb.UpdateItemOutput{}, nil
+			})
+			test.input.MessageID = "exampleMessageID"
+			err := UpdateLabels(context.TODO(), client, test.input)
+			assert.Equal(t, test.expectedErr, err)
+			if test.expectedErr == nil {
+				assert.Equal(t, test.expected, updates)
+			}
+		})
+	}
+}
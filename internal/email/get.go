@@ -12,6 +12,7 @@ import (
 	"github.com/harryzcy/mailbox/internal/api"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/harryzcy/mailbox/internal/util/addr"
 )
 
 // GetResult represents the result of get method
@@ -29,6 +30,16 @@ type GetResult struct {
 	References        string   `json:"references"` // space separated string
 	ThreadID          string   `json:"threadID,omitempty"`
 	IsThreadLatest    bool     `json:"isThreadLatest,omitempty"`
+	DuplicateIDs      []string `json:"duplicateIDs,omitempty"` // emails with the same originalMessageID
+	Flagged           bool     `json:"flagged,omitempty"`      // whether the email is starred
+	Labels            []string `json:"labels,omitempty"`
+	// Key/values from the enrichment endpoint, e.g. a CRM record of the sender
+	Annotations types.Annotations `json:"annotations,omitempty"`
+	// Scores from the classification service, e.g. {"spam": 0.93}
+	Scores types.Scores `json:"scores,omitempty"`
+	// View of the content if it's not the raw one, see RenderView
+	View          string         `json:"view,omitempty"`
+	RenderedViews *RenderedViews `json:"-"`
 
 	// Inbox email attributes
 	TimeReceived string   `json:"timeReceived,omitempty"`
@@ -37,20 +48,70 @@ type GetResult struct {
 	Destination  []string `json:"destination,omitempty"`
 	ReturnPath   string   `json:"returnPath,omitempty"`
 	Verdict      *Verdict `json:"verdict,omitempty"`
+	VirusStatus  string   `json:"-"`                   // status of the SES virus verdict
+	ScanState    string   `json:"scanState,omitempty"` // whether the files can be downloaded, omitted if unscanned
 	Unread       *bool    `json:"unread,omitempty"`
+	ArchivedTime string   `json:"archivedTime,omitempty"`
+	// Time the bodies of the email expired, after which only its metadata is kept, see BODY_RETENTION_DAYS
+	BodyExpiredTime string   `json:"bodyExpiredTime,omitempty"`
+	FiredRules      []int    `json:"firedRules,omitempty"`   // lines of the Sieve rules that fired when received
+	MatchedRules    []string `json:"matchedRules,omitempty"` // IDs of the filtering rules that matched when received
+	// Stages of receiving the email that failed without failing receiving, see RECEIVE_FAILURE_POLICY
+	StageFailures []StageFailure `json:"stageFailures,omitempty"`
+
+	// Parsed address headers with display names and addresses separated
+	Addresses *types.Addresses `json:"addresses,omitempty"`
 
 	// Draft email attributes
 	TimeUpdated string   `json:"timeUpdated,omitempty"`
 	Cc          []string `json:"cc,omitempty"`
 	Bcc         []string `json:"bcc,omitempty"`
+	NoReply     bool     `json:"noReply,omitempty"` // sent or to be sent in no-reply mode
+	DryRun      bool     `json:"dryRun,omitempty"`  // simulated send, or to be sent as one
+	// Files uploaded with pre-signed POSTs, attached when the draft is sent
+	Uploads []UploadedFile `json:"uploads,omitempty"`
+
+	// Send state of drafts whose sending failed, retrying or failed
+	SendState string `json:"sendState,omitempty"`
+	// Failed attempts to send the email, of drafts and of sent emails that are sent after retries
+	SendAttempts []SendAttempt `json:"sendAttempts,omitempty"`
 
 	// Sent email attributes
-	TimeSent string `json:"timeSent,omitempty"`
+	TimeSent     string            `json:"timeSent,omitempty"`
+	Template     string            `json:"template,omitempty"` // SES template of transactional emails
+	TemplateData string            `json:"templateData,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`         // SES message tags
+	ComplaintIDs []string          `json:"complaintIDs,omitempty"` // feedback reports received about the email
+	Complainants []string          `json:"complainants,omitempty"` // recipients who complained about the email
 
 	// Attachment attributes, currently only support
 	Attachments *types.Files `json:"attachments,omitempty"`
 	Inlines     *types.Files `json:"inlines,omitempty"`
 	OtherParts  *types.Files `json:"otherParts,omitempty"`
+
+	// Emails attached as message/rfc822 parts, e.g. forwarded messages
+	AttachedEmails types.AttachedEmails `json:"attachedEmails,omitempty"`
+
+	// Sizes and part counts, only available for emails received or reparsed after they are recorded
+	Stats *types.EmailStats `json:"stats,omitempty"`
+}
+
+// DisplayAddresses converts the punycode domains of the addresses to Unicode, before the email is shown.
+// It's only used on responses, since the stored addresses are kept as received.
+func (r *GetResult) DisplayAddresses() {
+	r.From = addr.DisplayAll(r.From)
+	r.To = addr.DisplayAll(r.To)
+	r.ReplyTo = addr.DisplayAll(r.ReplyTo)
+	r.Cc = addr.DisplayAll(r.Cc)
+	r.Bcc = addr.DisplayAll(r.Bcc)
+	if r.Addresses != nil {
+		for _, list := range []types.AddressList{r.Addresses.From, r.Addresses.To, r.Addresses.Cc, r.Addresses.ReplyTo} {
+			for i := range list {
+				list[i].Address = addr.ToUnicode(list[i].Address)
+			}
+		}
+	}
 }
 
 type Verdict struct {
@@ -61,6 +122,14 @@ type Verdict struct {
 	Virus bool `json:"virus"`
 }
 
+// StageFailure is a stage of receiving an email that failed, and the outcome of its failure policy
+type StageFailure struct {
+	Stage   string `json:"stage"`
+	Outcome string `json:"outcome"` // continue or quarantine
+	Time    string `json:"time"`    // RFC3339
+	Error   string `json:"error"`
+}
+
 // Get returns the email and marks it as read
 func GetAndRead(ctx context.Context, client api.GetEmailAPI, messageID string) (*GetResult, error) {
 	result, err := Get(ctx, client, messageID)
@@ -132,6 +201,9 @@ func ParseGetResult(attributeValues map[string]dynamodbTypes.AttributeValue) (*G
 
 	if result.Type == EmailTypeInbox {
 		result.TimeReceived = emailTime
+		if result.VirusStatus != "" {
+			result.ScanState = ScanState(result.VirusStatus)
+		}
 		if result.Unread == nil {
 			unread := false
 			result.Unread = &unread
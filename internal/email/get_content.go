@@ -7,7 +7,17 @@ import (
 	"github.com/harryzcy/mailbox/internal/datasource/storage"
 )
 
-// Get returns the email
-func GetContent(ctx context.Context, client api.GetItemContentAPI, messageID, disposition, contentID string) (*storage.GetEmailContentResult, error) {
-	return storage.S3.GetEmailContent(ctx, client, messageID, disposition, contentID)
+// GetContent returns a file of an email, unless the email is infected or its scan is pending, see CheckScan.
+// force skips the check, e.g. for admins reviewing the file.
+func GetContent(ctx context.Context, client api.GetScannedContentAPI, messageID, disposition, contentID string, force bool) (*storage.GetEmailContentResult, error) {
+	if !force {
+		if err := CheckScan(ctx, client, messageID); err != nil {
+			return nil, err
+		}
+	}
+	location, err := RawLocation(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return storage.S3.GetEmailContent(ctx, client, location, disposition, contentID)
 }
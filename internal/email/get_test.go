@@ -10,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/api"
 	"github.com/harryzcy/mailbox/internal/env"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -156,3 +157,20 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestGetResult_DisplayAddresses(t *testing.T) {
+	result := &GetResult{
+		From:    []string{"Bücher <shop@xn--bcher-kva.example>"},
+		To:      []string{"me@example.com"},
+		ReplyTo: []string{"help@xn--bcher-kva.example"},
+		Addresses: &mailboxTypes.Addresses{
+			From: mailboxTypes.AddressList{{Name: "Bücher", Address: "shop@xn--bcher-kva.example"}},
+		},
+	}
+	result.DisplayAddresses()
+	assert.Equal(t, []string{"Bücher <shop@bücher.example>"}, result.From)
+	assert.Equal(t, []string{"me@example.com"}, result.To)
+	assert.Equal(t, []string{"help@bücher.example"}, result.ReplyTo)
+	assert.Nil(t, result.Cc)
+	assert.Equal(t, "shop@bücher.example", result.Addresses.From[0].Address)
+}
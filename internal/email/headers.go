@@ -0,0 +1,65 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
+)
+
+// HeadersResult represents the result of get headers method
+type HeadersResult struct {
+	MessageID string        `json:"messageID"`
+	Headers   types.Headers `json:"headers"`
+}
+
+// GetHeaders returns all original headers of an email, in the order they appear.
+// If the headers are not stored in DynamoDB, they are read from the raw email in S3.
+func GetHeaders(ctx context.Context, client api.GetHeadersAPI, messageID string) (*HeadersResult, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		},
+		ProjectionExpression: aws.String("MessageID, TypeYearMonth, Headers, " + storage.RawBucketAttribute + ", " + storage.RawKeyAttribute),
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, api.ErrNotFound
+	}
+
+	result := &HeadersResult{
+		MessageID: messageID,
+		Headers:   types.Headers{},
+	}
+	if av, ok := resp.Item["Headers"]; ok {
+		result.Headers, err = types.UnmarshalHeaders(av)
+		if err != nil {
+			return nil, err
+		}
+	} else if typeYearMonth, ok := resp.Item["TypeYearMonth"].(*dynamodbTypes.AttributeValueMemberS); ok &&
+		strings.HasPrefix(typeYearMonth.Value, EmailTypeInbox) {
+		// emails received before headers are stored, or whose headers are truncated by SES
+		fmt.Println("headers not stored, reading from S3")
+		result.Headers, err = storage.S3.GetEmailHeaders(ctx, client, storage.ItemLocation(resp.Item, messageID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Println("get headers method finished successfully")
+	return result, nil
+}
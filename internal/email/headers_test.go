@@ -0,0 +1,168 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockGetHeadersAPI struct {
+	mockGetItem   func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	mockGetObject func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+func (m mockGetHeadersAPI) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return m.mockGetItem(ctx, params, optFns...)
+}
+
+func (m mockGetHeadersAPI) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return m.mockGetObject(ctx, params, optFns...)
+}
+
+func TestGetHeaders(t *testing.T) {
+	env.TableName = "table-for-get-headers"
+	env.S3Bucket = "bucket-for-get-headers"
+
+	storedHeaders := types.Headers{
+		{Name: "Received", Value: "by a.example.com; Tue, 12 Mar 2024 10:10:09 +0000"},
+		{Name: "Subject", Value: "Hello"},
+	}
+	storedAttribute, err := storedHeaders.ToAttributeValue()
+	assert.Nil(t, err)
+
+	tests := []struct {
+		client      func(t *testing.T) api.GetHeadersAPI
+		messageID   string
+		expected    *HeadersResult
+		expectedErr error
+	}{
+		{
+			client: func(t *testing.T) api.GetHeadersAPI {
+				return mockGetHeadersAPI{
+					mockGetItem: func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+						t.Helper()
+						assert.Equal(t, env.TableName, *params.TableName)
+						assert.Equal(t, "exampleMessageID", params.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+
+						return &dynamodb.GetItemOutput{
+							Item: map[string]dynamodbTypes.AttributeValue{
+								"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "exampleMessageID"},
+								"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "inbox#2024-03"},
+								"Headers":       storedAttribute,
+							},
+						}, nil
+					},
+				}
+			},
+			messageID: "exampleMessageID",
+			expected: &HeadersResult{
+				MessageID: "exampleMessageID",
+				Headers:   storedHeaders,
+			},
+		},
+		{
+			client: func(t *testing.T) api.GetHeadersAPI {
+				return mockGetHeadersAPI{
+					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+						return &dynamodb.GetItemOutput{
+							Item: map[string]dynamodbTypes.AttributeValue{
+								"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "exampleMessageID"},
+								"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "inbox#2024-03"},
+							},
+						}, nil
+					},
+					mockGetObject: func(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+						t.Helper()
+						assert.Equal(t, env.S3Bucket, *params.Bucket)
+						assert.Equal(t, "exampleMessageID", *params.Key)
+						return &s3.GetObjectOutput{
+							Body: io.NopCloser(bytes.NewReader([]byte("Subject: Hello\r\n\r\nbody"))),
+						}, nil
+					},
+				}
+			},
+			messageID: "exampleMessageID",
+			expected: &HeadersResult{
+				MessageID: "exampleMessageID",
+				Headers:   types.Headers{{Name: "Subject", Value: "Hello"}},
+			},
+		},
+		{
+			client: func(_ *testing.T) api.GetHeadersAPI {
+				return mockGetHeadersAPI{
+					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+						return &dynamodb.GetItemOutput{
+							Item: map[string]dynamodbTypes.AttributeValue{
+								"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "draft-example"},
+								"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "draft#2024-03"},
+							},
+						}, nil
+					},
+				}
+			},
+			messageID: "draft-example",
+			expected: &HeadersResult{
+				MessageID: "draft-example",
+				Headers:   types.Headers{},
+			},
+		},
+		{
+			client: func(_ *testing.T) api.GetHeadersAPI {
+				return mockGetHeadersAPI{
+					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+						return &dynamodb.GetItemOutput{}, nil
+					},
+				}
+			},
+			expectedErr: api.ErrNotFound,
+		},
+		{
+			client: func(_ *testing.T) api.GetHeadersAPI {
+				return mockGetHeadersAPI{
+					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+						return nil, &dynamodbTypes.ProvisionedThroughputExceededException{}
+					},
+				}
+			},
+			expectedErr: api.ErrTooManyRequests,
+		},
+		{
+			client: func(_ *testing.T) api.GetHeadersAPI {
+				return mockGetHeadersAPI{
+					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+						return &dynamodb.GetItemOutput{
+							Item: map[string]dynamodbTypes.AttributeValue{
+								"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "exampleMessageID"},
+								"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "inbox#2024-03"},
+							},
+						}, nil
+					},
+					mockGetObject: func(_ context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+						return nil, errors.New("error")
+					},
+				}
+			},
+			expectedErr: errors.New("error"),
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.TODO()
+			actual, err := GetHeaders(ctx, test.client(t), test.messageID)
+			assert.Equal(t, test.expected, actual)
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Lifecycle states of an email
+const (
+	StateInbox    = "inbox"    // received, not archived
+	StateArchived = "archived" // received, archived
+	StateSent     = "sent"
+	StateDraft    = "draft"
+	StateTrashed  = "trashed"
+	StatePurged   = "purged" // deleted, or never existed
+)
+
+// Operations that move an email between lifecycle states
+const (
+	opTrash     = "trash"
+	opUntrash   = "untrash"
+	opDelete    = "delete"
+	opArchive   = "archive"
+	opUnarchive = "unarchive"
+	opSend      = "send"
+)
+
+// transition is a lifecycle transition, from any of the states in from to the state returned by to
+type transition struct {
+	from []string
+	to   func(item map[string]types.AttributeValue) string
+}
+
+// transitions are the valid lifecycle transitions of each operation.
+// Their condition expressions must allow exactly these transitions.
+var transitions = map[string]transition{
+	opTrash:     {from: []string{StateInbox, StateArchived, StateSent}, to: toState(StateTrashed)},
+	opUntrash:   {from: []string{StateTrashed}, to: untrashedState}, // back to the state it was trashed from
+	opDelete:    {from: []string{StateTrashed, StateDraft}, to: toState(StatePurged)},
+	opArchive:   {from: []string{StateInbox}, to: toState(StateArchived)},
+	opUnarchive: {from: []string{StateArchived}, to: toState(StateInbox)},
+	opSend:      {from: []string{StateDraft}, to: toState(StateSent)},
+}
+
+// maxTransitionAttempts is the maximum number of attempts of a transition,
+// which is retried when its condition failed only because other attributes of the email changed concurrently
+const maxTransitionAttempts = 3
+
+func toState(state string) func(map[string]types.AttributeValue) string {
+	return func(map[string]types.AttributeValue) string {
+		return state
+	}
+}
+
+// StateOf returns the lifecycle state of an email item, which is StatePurged if the item is empty
+func StateOf(item map[string]types.AttributeValue) string {
+	if len(item) == 0 {
+		return StatePurged
+	}
+	if _, ok := item["TrashedTime"]; ok {
+		return StateTrashed
+	}
+	return untrashedState(item)
+}
+
+// GetState reads the lifecycle state of an email, which is StatePurged if it doesn't exist
+func GetState(ctx context.Context, client api.GetItemAPI, messageID string) (string, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		ProjectionExpression: aws.String("MessageID, TypeYearMonth, TrashedTime, ArchivedTime"),
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return "", api.ErrTooManyRequests
+		}
+		return "", err
+	}
+	return StateOf(resp.Item), nil
+}
+
+// untrashedState returns the lifecycle state of an email item as if it's not trashed
+func untrashedState(item map[string]types.AttributeValue) string {
+	var typeYearMonth string
+	if value, ok := item["TypeYearMonth"].(*types.AttributeValueMemberS); ok {
+		typeYearMonth = value.Value
+	}
+
+	switch {
+	case strings.HasPrefix(typeYearMonth, EmailTypeDraft+"#"):
+		return StateDraft
+	case strings.HasPrefix(typeYearMonth, EmailTypeSent+"#"):
+		return StateSent
+	}
+	if _, ok := item["ArchivedTime"]; ok {
+		return StateArchived
+	}
+	return StateInbox
+}
+
+// checkTransition returns an InvalidTransitionError if op can't be applied to an email item
+func checkTransition(op string, item map[string]types.AttributeValue) error {
+	t := transitions[op]
+	from := StateOf(item)
+	for _, state := range t.from {
+		if state == from {
+			return nil
+		}
+	}
+	return &api.InvalidTransitionError{From: from, To: t.to(item)}
+}
+
+// CheckSend returns an InvalidTransitionError if a draft item can't be sent, e.g. after the send condition failed
+func CheckSend(item map[string]types.AttributeValue) error {
+	return checkTransition(opSend, item)
+}
+
+// transitionEmail applies op to an email by calling apply, whose condition expression enforces the transition.
+// apply is expected to request the item on condition failures, which tells invalid transitions apart from
+// concurrent changes to other attributes, e.g. the ones that decide the counters. The latter are retried.
+func transitionEmail(op string, apply func() error) error {
+	var err error
+	for attempt := 0; attempt < maxTransitionAttempts; attempt++ {
+		err = apply()
+		condErr := new(types.ConditionalCheckFailedException)
+		if !errors.As(err, &condErr) {
+			return err
+		}
+
+		if err := checkTransition(op, condErr.Item); err != nil {
+			return err
+		}
+		if _, ok := condErr.Item["ThreadID"]; ok && op == opDelete {
+			return api.ErrPartOfThread
+		}
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package email
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateOf(t *testing.T) {
+	tests := []struct {
+		item     map[string]types.AttributeValue
+		expected string
+	}{
+		{nil, StatePurged},
+		{map[string]types.AttributeValue{
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+		}, StateInbox},
+		{map[string]types.AttributeValue{
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+			"ArchivedTime":  &types.AttributeValueMemberS{Value: "2023-05-02T03:04:05Z"},
+		}, StateArchived},
+		{map[string]types.AttributeValue{
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+			"ArchivedTime":  &types.AttributeValueMemberS{Value: "2023-05-02T03:04:05Z"},
+			"TrashedTime":   &types.AttributeValueMemberS{Value: "2023-05-03T03:04:05Z"},
+		}, StateTrashed},
+		{map[string]types.AttributeValue{
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "sent#2023-05"},
+		}, StateSent},
+		{map[string]types.AttributeValue{
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "draft#2023-05"},
+		}, StateDraft},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, StateOf(test.item))
+		})
+	}
+}
+
+func TestCheckTransition(t *testing.T) {
+	archivedAndTrashed := map[string]types.AttributeValue{
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+		"ArchivedTime":  &types.AttributeValueMemberS{Value: "2023-05-02T03:04:05Z"},
+		"TrashedTime":   &types.AttributeValueMemberS{Value: "2023-05-03T03:04:05Z"},
+	}
+
+	tests := []struct {
+		op          string
+		item        map[string]types.AttributeValue
+		expectedErr error
+	}{
+		{opUntrash, archivedAndTrashed, nil},
+		{opDelete, archivedAndTrashed, nil},
+		{opArchive, archivedAndTrashed, &api.InvalidTransitionError{From: StateTrashed, To: StateArchived}},
+		{opUntrash, nil, &api.InvalidTransitionError{From: StatePurged, To: StateInbox}},
+		{opSend, map[string]types.AttributeValue{
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "sent#2023-05"},
+		}, &api.InvalidTransitionError{From: StateSent, To: StateSent}},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := checkTransition(test.op, test.item)
+			assert.Equal(t, test.expectedErr, err)
+			if err != nil {
+				assert.ErrorIs(t, err, &api.InvalidTransitionError{})
+			}
+		})
+	}
+}
+
+func TestGetState(t *testing.T) {
+	env.TableName = "table-for-get-state"
+	client := mockGetItemAPI(func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+		assert.Equal(t, env.TableName, *params.TableName)
+		if params.Key["MessageID"].(*types.AttributeValueMemberS).Value == "purged" {
+			return &dynamodb.GetItemOutput{}, nil
+		}
+		return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+			"MessageID":     params.Key["MessageID"],
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+			"ArchivedTime":  &types.AttributeValueMemberS{Value: "2023-05-02T03:04:05Z"},
+		}}, nil
+	})
+
+	state, err := GetState(context.TODO(), client, "archived")
+	assert.Nil(t, err)
+	assert.Equal(t, StateArchived, state)
+
+	state, err = GetState(context.TODO(), client, "purged")
+	assert.Nil(t, err)
+	assert.Equal(t, StatePurged, state)
+}
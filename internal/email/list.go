@@ -2,26 +2,46 @@ package email
 
 import (
 	"context"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/util/format"
 )
 
 const (
 	DefaultPageSize = 100
 )
 
+// Orders of listed emails, by the time they are received, sent or last edited
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
 // ListInput represents the input of list method
 type ListInput struct {
 	Type       string  `json:"type"`
 	Year       string  `json:"year"`
 	Month      string  `json:"month"`
-	Order      string  `json:"order"`     // asc or desc (default)
+	Order      string  `json:"order"`     // OrderAsc or OrderDesc (default)
 	ShowTrash  string  `json:"showTrash"` // 'include', 'exclude' or 'only' (default is 'exclude')
 	PageSize   int     `json:"pageSize"`  // 0 means no limit, default is 100
 	NextCursor *Cursor `json:"nextCursor"`
+
+	// ShowArchived applies to archived inbox emails, using the same values as ShowTrash (default is 'exclude')
+	ShowArchived string `json:"showArchived"`
+
+	// Label lists only emails with the label if not empty
+	Label string `json:"label"`
+	// Flagged lists only starred emails if true
+	Flagged bool `json:"flagged"`
+
+	// SendStates lists only drafts in these send states if not empty, see ListOutbox
+	SendStates []string `json:"-"`
 }
 
 // ListResult represents the result of list method
@@ -29,7 +49,7 @@ type ListResult struct {
 	Count      int     `json:"count"`
 	Items      []Item  `json:"items"`
 	NextCursor *Cursor `json:"nextCursor"`
-	HasMore    bool    `json:"hasMore"`
+	HasMore    bool    `json:"hasMore"` // whether there may be more emails in the next page, which may be empty
 }
 
 const (
@@ -43,23 +63,54 @@ const (
 // TODO: refactor this function
 //
 //gocyclo:ignore
-func List(ctx context.Context, client api.QueryAPI, input ListInput) (*ListResult, error) {
+func List(ctx context.Context, client api.ListEmailsAPI, input ListInput) (*ListResult, error) {
 	if input.Type != EmailTypeInbox && input.Type != EmailTypeDraft && input.Type != EmailTypeSent {
 		return nil, api.ErrInvalidInput
 	}
 
+	if input.Order == "" {
+		input.Order = OrderDesc
+	} else if input.Order != OrderAsc && input.Order != OrderDesc {
+		return nil, api.ErrInvalidInput
+	}
+	if input.PageSize < 0 {
+		return nil, api.ErrInvalidInput
+	}
+
+	// without year and month, emails are listed across months: from the latest in descending order,
+	// or from the oldest in ascending order
+	acrossMonths := false
+	var oldestYear, oldestMonth string
 	if input.Year == "" && input.Month == "" {
 		input.Year, input.Month = getCurrentYearMonth()
-		input.Order = "desc"
+		acrossMonths = input.PageSize > 0
+		if acrossMonths && input.NextCursor != nil && input.NextCursor.QueryInfo.Year != "" {
+			// continue from the month where the previous page ended
+			if !cursorMatches(input.NextCursor.QueryInfo, input) {
+				return nil, api.ErrQueryNotMatch
+			}
+			var err error
+			input.Year, input.Month, err = prepareYearMonth(input.NextCursor.QueryInfo.Year, input.NextCursor.QueryInfo.Month)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if acrossMonths {
+			var err error
+			oldestYear, oldestMonth, err = oldestYearMonth(ctx, client, input.Type)
+			if err != nil {
+				return nil, err
+			}
+			if input.Order == OrderAsc && (input.NextCursor == nil || input.NextCursor.QueryInfo.Year == "") {
+				input.Year, input.Month = oldestYear, oldestMonth
+			}
+		}
 	} else {
 		var err error
 		input.Year, input.Month, err = prepareYearMonth(input.Year, input.Month)
 		if err != nil {
 			return nil, err
 		}
-		if input.Order == "" {
-			input.Order = "desc"
-		}
 	}
 
 	if input.ShowTrash == "" {
@@ -72,24 +123,40 @@ func List(ctx context.Context, client api.QueryAPI, input ListInput) (*ListResul
 		}
 	}
 
+	if input.ShowArchived == "" {
+		input.ShowArchived = ShowTrashExclude
+	} else {
+		input.ShowArchived = strings.ToLower(input.ShowArchived)
+		if input.ShowArchived != ShowTrashOnly && input.ShowArchived != ShowTrashInclude && input.ShowArchived != ShowTrashExclude {
+			return nil, api.ErrInvalidInput
+		}
+	}
+
 	inputs := listQueryInput{
-		emailType: input.Type,
-		year:      input.Year,
-		month:     input.Month,
-		order:     input.Order,
-		showTrash: input.ShowTrash,
-		pageSize:  input.PageSize,
+		emailType:    input.Type,
+		year:         input.Year,
+		month:        input.Month,
+		order:        input.Order,
+		showTrash:    input.ShowTrash,
+		showArchived: input.ShowArchived,
+		label:        input.Label,
+		flagged:      input.Flagged,
+		sendStates:   input.SendStates,
+		pageSize:     input.PageSize,
 	}
 
 	if input.NextCursor != nil && len(input.NextCursor.LastEvaluatedKey) > 0 {
-		if input.NextCursor.QueryInfo.Type != input.Type ||
-			input.NextCursor.QueryInfo.Year != input.Year || input.NextCursor.QueryInfo.Month != input.Month ||
-			input.NextCursor.QueryInfo.Order != input.Order {
+		if !cursorMatches(input.NextCursor.QueryInfo, input) ||
+			input.NextCursor.QueryInfo.Year != input.Year || input.NextCursor.QueryInfo.Month != input.Month {
 			return nil, api.ErrQueryNotMatch
 		}
 
 		inputs.lastEvaluatedKey = input.NextCursor.LastEvaluatedKey
 	}
+	if acrossMonths {
+		return listAcrossMonths(ctx, client, inputs, oldestYear+oldestMonth)
+	}
+
 	result, err := listByYearMonth(ctx, client, inputs)
 	if err != nil {
 		return nil, err
@@ -99,10 +166,12 @@ func List(ctx context.Context, client api.QueryAPI, input ListInput) (*ListResul
 	if result.hasMore {
 		nextCursor = &Cursor{
 			QueryInfo: QueryInfo{
-				Type:  input.Type,
-				Year:  input.Year,
-				Month: input.Month,
-				Order: input.Order,
+				Type:    input.Type,
+				Year:    input.Year,
+				Month:   input.Month,
+				Order:   input.Order,
+				Label:   input.Label,
+				Flagged: input.Flagged,
 			},
 			LastEvaluatedKey: result.lastEvaluatedKey,
 		}
@@ -116,11 +185,106 @@ func List(ctx context.Context, client api.QueryAPI, input ListInput) (*ListResul
 	}, nil
 }
 
+// cursorMatches returns whether a cursor is returned by a query with the same input, apart from the month
+func cursorMatches(info QueryInfo, input ListInput) bool {
+	return info.Type == input.Type && info.Order == input.Order && info.Label == input.Label && info.Flagged == input.Flagged
+}
+
+// listAcrossMonths lists emails starting from the month in inputs, and continues with the following months in the order of inputs
+// until the page is full. Descending listing stops after the oldest month with emails, e.g. "202104", and ascending listing after the current month.
+// The returned cursor points to the month where the next page starts, so pages aren't cut off at month boundaries.
+func listAcrossMonths(ctx context.Context, client api.QueryAPI, inputs listQueryInput, oldest string) (*ListResult, error) {
+	currentYear, currentMonth := getCurrentYearMonth()
+	pageSize := inputs.pageSize
+	items := []Item{}
+	var nextCursor *Cursor
+	for {
+		inputs.pageSize = pageSize - len(items)
+		result, err := listByYearMonth(ctx, client, inputs)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, result.items...)
+
+		if result.hasMore {
+			nextCursor = newListCursor(inputs, result.lastEvaluatedKey)
+			break
+		}
+
+		if inputs.order == OrderAsc {
+			if inputs.year+inputs.month >= currentYear+currentMonth {
+				break
+			}
+			inputs.year, inputs.month = nextYearMonth(inputs.year, inputs.month)
+		} else {
+			if inputs.year+inputs.month <= oldest {
+				break
+			}
+			inputs.year, inputs.month = previousYearMonth(inputs.year, inputs.month)
+		}
+		inputs.lastEvaluatedKey = nil
+		if len(items) >= pageSize {
+			nextCursor = newListCursor(inputs, nil)
+			break
+		}
+	}
+
+	// items are already in order, unless emails are stored in a month other than the one they are sent or received
+	sort.SliceStable(items, func(i, j int) bool {
+		if inputs.order == OrderAsc {
+			return itemTime(items[i]).Before(itemTime(items[j]))
+		}
+		return itemTime(items[i]).After(itemTime(items[j]))
+	})
+
+	return &ListResult{
+		Count:      len(items),
+		Items:      items,
+		NextCursor: nextCursor,
+		HasMore:    nextCursor != nil,
+	}, nil
+}
+
+func newListCursor(inputs listQueryInput, lastEvaluatedKey map[string]types.AttributeValue) *Cursor {
+	return &Cursor{
+		QueryInfo: QueryInfo{
+			Type:    inputs.emailType,
+			Year:    inputs.year,
+			Month:   inputs.month,
+			Order:   inputs.order,
+			Label:   inputs.label,
+			Flagged: inputs.flagged,
+		},
+		LastEvaluatedKey: lastEvaluatedKey,
+	}
+}
+
+// itemTime returns the time used to sort an item
+func itemTime(item Item) time.Time {
+	value := item.TimeReceived
+	switch item.Type {
+	case EmailTypeDraft:
+		value = item.TimeUpdated
+	case EmailTypeSent:
+		value = item.TimeSent
+	}
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
+
+// previousYearMonth returns the year and month before the given 4 digit year and 2 digit month
+func previousYearMonth(year, month string) (string, string) {
+	y, _ := strconv.Atoi(year)
+	m, _ := strconv.Atoi(month)
+	t := time.Date(y, time.Month(m)-1, 1, 0, 0, 0, 0, time.UTC)
+	return t.Format("2006"), t.Format("01")
+}
+
 // now is equal to time.Now, but will be replaced during testing
 var now = time.Now
 
 func getCurrentYearMonth() (year, month string) {
-	now := now().UTC()
+	now := now().In(format.BucketLocation())
 
 	year = strconv.Itoa(now.Year())
 	month = strconv.Itoa(int(now.Month()))
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/base64"
 	"errors"
+	"net/url"
+	"strconv"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/util/avutil"
@@ -15,10 +17,12 @@ var (
 )
 
 type QueryInfo struct {
-	Type  string `json:"type"`
-	Year  string `json:"year"`
-	Month string `json:"month"`
-	Order string `json:"order"`
+	Type    string `json:"type"`
+	Year    string `json:"year"`
+	Month   string `json:"month"`
+	Order   string `json:"order"`
+	Label   string `json:"label,omitempty"`
+	Flagged bool   `json:"flagged,omitempty"`
 }
 
 type Cursor struct {
@@ -26,8 +30,16 @@ type Cursor struct {
 	LastEvaluatedKey LastEvaluatedKey `json:"lastEvaluatedKey"`
 }
 
+// cursorVersion is the first field of encoded cursors that include the label and flagged,
+// cursors without it are in the format of "type,year,month,order,lastEvaluatedKey"
+const cursorVersion = "2"
+
+// MarshalJSON encodes the cursor as an opaque string in the format of
+// "2,type,year,month,order,flagged,label,lastEvaluatedKey", where label is escaped
 func (c Cursor) MarshalJSON() ([]byte, error) {
 	var builder bytes.Buffer
+	builder.WriteString(cursorVersion)
+	builder.WriteByte(',')
 	builder.WriteString(c.QueryInfo.Type)
 	builder.WriteByte(',')
 	builder.WriteString(c.QueryInfo.Year)
@@ -36,6 +48,10 @@ func (c Cursor) MarshalJSON() ([]byte, error) {
 	builder.WriteByte(',')
 	builder.WriteString(c.QueryInfo.Order)
 	builder.WriteByte(',')
+	builder.WriteString(strconv.FormatBool(c.QueryInfo.Flagged))
+	builder.WriteByte(',')
+	builder.WriteString(url.QueryEscape(c.QueryInfo.Label))
+	builder.WriteByte(',')
 
 	data, err := c.LastEvaluatedKey.Encode()
 	if err != nil {
@@ -77,8 +93,32 @@ func (c *Cursor) Bind(data []byte) error {
 	if err != nil {
 		return err
 	}
-	// dst should be in the format of "type,year,month,order,lastEvaluatedKey"
-	// we need to extract the lastEvaluatedKey
+	// dst should be in the format of "2,type,year,month,order,flagged,label,lastEvaluatedKey",
+	// or "type,year,month,order,lastEvaluatedKey" for cursors encoded before labels are included.
+	// lastEvaluatedKey may contain commas, so it's the last part
+	if bytes.HasPrefix(dst, []byte(cursorVersion+",")) {
+		parts := bytes.SplitN(dst, []byte(","), 8)
+		if len(parts) != 8 {
+			return ErrInvalidInputToUnmarshal
+		}
+		flagged, err := strconv.ParseBool(string(parts[5]))
+		if err != nil {
+			return ErrInvalidInputToUnmarshal
+		}
+		label, err := url.QueryUnescape(string(parts[6]))
+		if err != nil {
+			return ErrInvalidInputToUnmarshal
+		}
+		c.QueryInfo = QueryInfo{
+			Type:    string(parts[1]),
+			Year:    string(parts[2]),
+			Month:   string(parts[3]),
+			Order:   string(parts[4]),
+			Label:   label,
+			Flagged: flagged,
+		}
+		return c.LastEvaluatedKey.Decode(parts[7])
+	}
 
 	parts := bytes.SplitN(dst, []byte(","), 5)
 	if len(parts) != 5 {
@@ -1,6 +1,7 @@
 package email
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -32,6 +33,21 @@ func TestCursor(t *testing.T) {
 				},
 			},
 		},
+		{
+			Cursor{
+				QueryInfo: QueryInfo{
+					Type:    "inbox",
+					Year:    "2022",
+					Month:   "04",
+					Order:   "desc",
+					Label:   "Receipts, 2022",
+					Flagged: true,
+				},
+				LastEvaluatedKey: map[string]types.AttributeValue{
+					"foo": &types.AttributeValueMemberS{Value: "bar,baz"},
+				},
+			},
+		},
 	}
 
 	for i, test := range tests {
@@ -64,6 +80,15 @@ func TestCursor(t *testing.T) {
 	}
 }
 
+func TestCursor_Legacy(t *testing.T) {
+	// cursors encoded before labels are included are still accepted
+	var cursor Cursor
+	err := cursor.BindString(base64.URLEncoding.EncodeToString([]byte("inbox,2022,04,asc,")))
+	assert.Nil(t, err)
+	assert.Equal(t, QueryInfo{Type: "inbox", Year: "2022", Month: "04", Order: "asc"}, cursor.QueryInfo)
+	assert.Empty(t, cursor.LastEvaluatedKey)
+}
+
 func TestCursor_Empty(t *testing.T) {
 	var cursor Cursor
 	err := cursor.BindString("")
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -20,6 +22,10 @@ type listQueryInput struct {
 	month            string
 	order            string
 	showTrash        string
+	showArchived     string // same values as showTrash, but empty is the same as 'include'
+	label            string // only emails with the label if not empty
+	flagged          bool   // only starred emails if true
+	sendStates       []string
 	pageSize         int
 	lastEvaluatedKey map[string]types.AttributeValue
 }
@@ -58,12 +64,37 @@ func listByYearMonth(ctx context.Context, client api.QueryAPI, input listQueryIn
 			"#tym": "TypeYearMonth",
 		},
 		Limit:            limit,
-		ScanIndexForward: aws.Bool(false), // reverse order
+		ScanIndexForward: aws.Bool(input.order == OrderAsc), // reverse order by default
 	}
+	var filters []string
 	if input.showTrash == ShowTrashExclude {
-		queryInput.FilterExpression = aws.String("attribute_not_exists(TrashedTime)")
+		filters = append(filters, "attribute_not_exists(TrashedTime)")
 	} else if input.showTrash == ShowTrashOnly {
-		queryInput.FilterExpression = aws.String("attribute_exists(TrashedTime)")
+		filters = append(filters, "attribute_exists(TrashedTime)")
+	}
+	if input.showArchived == ShowTrashExclude {
+		filters = append(filters, "attribute_not_exists(ArchivedTime)")
+	} else if input.showArchived == ShowTrashOnly {
+		filters = append(filters, "attribute_exists(ArchivedTime)")
+	}
+	if input.label != "" {
+		filters = append(filters, "contains(Labels, :label)")
+		queryInput.ExpressionAttributeValues[":label"] = &types.AttributeValueMemberS{Value: input.label}
+	}
+	if input.flagged {
+		filters = append(filters, "Flagged = :flagged")
+		queryInput.ExpressionAttributeValues[":flagged"] = &types.AttributeValueMemberBOOL{Value: true}
+	}
+	if len(input.sendStates) > 0 {
+		placeholders := make([]string, len(input.sendStates))
+		for i, state := range input.sendStates {
+			placeholders[i] = ":state" + strconv.Itoa(i)
+			queryInput.ExpressionAttributeValues[placeholders[i]] = &types.AttributeValueMemberS{Value: state}
+		}
+		filters = append(filters, "SendState IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if len(filters) > 0 {
+		queryInput.FilterExpression = aws.String(strings.Join(filters, " AND "))
 	}
 
 	resp, err := client.Query(ctx, queryInput)
@@ -164,6 +164,57 @@ func TestByYearMonth(t *testing.T) {
 				},
 			},
 		},
+		{
+			client: func(t *testing.T) api.QueryAPI {
+				t.Helper()
+				return mockQueryAPI(func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+					assert.Equal(t, "contains(Labels, :label)", *params.FilterExpression)
+					assert.Equal(t, &types.AttributeValueMemberS{Value: "Receipts"}, params.ExpressionAttributeValues[":label"])
+
+					return &dynamodb.QueryOutput{
+						Count:        0,
+						ScannedCount: 2,
+						Items:        []map[string]types.AttributeValue{},
+					}, nil
+				})
+			},
+			input: listQueryInput{
+				emailType: "inbox",
+				year:      "2022",
+				month:     "03",
+				showTrash: "include",
+				label:     "Receipts",
+			},
+			expected: listQueryResult{
+				items: []Item{},
+			},
+		},
+		{
+			client: func(t *testing.T) api.QueryAPI {
+				t.Helper()
+				return mockQueryAPI(func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+					assert.Equal(t, "contains(Labels, :label) AND Flagged = :flagged", *params.FilterExpression)
+					assert.Equal(t, &types.AttributeValueMemberBOOL{Value: true}, params.ExpressionAttributeValues[":flagged"])
+
+					return &dynamodb.QueryOutput{
+						Count:        0,
+						ScannedCount: 1,
+						Items:        []map[string]types.AttributeValue{},
+					}, nil
+				})
+			},
+			input: listQueryInput{
+				emailType: "inbox",
+				year:      "2022",
+				month:     "03",
+				showTrash: "include",
+				label:     "Receipts",
+				flagged:   true,
+			},
+			expected: listQueryResult{
+				items: []Item{},
+			},
+		},
 		{
 			client: func(t *testing.T) api.QueryAPI {
 				t.Helper()
@@ -209,7 +209,7 @@ func TestList(t *testing.T) {
 			if test.now != nil {
 				now = test.now
 			}
-			actual, err := List(ctx, test.client(t), test.input)
+			actual, err := List(ctx, mockListEmailsAPI{QueryAPI: test.client(t)}, test.input)
 			assert.Equal(t, test.expected, actual)
 			assert.Equal(t, test.expectedErr, err)
 		})
@@ -220,6 +220,214 @@ func TestList(t *testing.T) {
 	}()
 }
 
+func TestList_AcrossMonths(t *testing.T) {
+	now = func() time.Time { return time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() {
+		now = time.Now // cleanup
+	}()
+
+	partitions := map[string][]string{ // TypeYearMonth -> MessageID, in descending order
+		"inbox#2022-03": {"m1"},
+		"inbox#2022-02": {"f1", "f2", "f3"},
+	}
+	dateTimes := map[string]string{
+		"m1": "01-10:00:00",
+		"f1": "20-10:00:00",
+		"f2": "10-10:00:00",
+		"f3": "05-10:00:00",
+	}
+	var queried []string
+	client := mockListEmailsAPI{oldest: "2021-12"}
+	client.QueryAPI = mockQueryAPI(func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+		typeYearMonth := params.ExpressionAttributeValues[":val"].(*types.AttributeValueMemberS).Value
+		queried = append(queried, typeYearMonth)
+
+		ids := partitions[typeYearMonth]
+		if params.ExclusiveStartKey != nil {
+			start := params.ExclusiveStartKey["MessageID"].(*types.AttributeValueMemberS).Value
+			for i, id := range ids {
+				if id == start {
+					ids = ids[i+1:]
+					break
+				}
+			}
+		}
+
+		output := &dynamodb.QueryOutput{}
+		for i, id := range ids {
+			if i == int(*params.Limit) {
+				output.LastEvaluatedKey = map[string]types.AttributeValue{
+					"MessageID": &types.AttributeValueMemberS{Value: ids[i-1]},
+				}
+				break
+			}
+			output.Items = append(output.Items, map[string]types.AttributeValue{
+				"MessageID":     &types.AttributeValueMemberS{Value: id},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: typeYearMonth},
+				"DateTime":      &types.AttributeValueMemberS{Value: dateTimes[id]},
+			})
+		}
+		return output, nil
+	})
+
+	newItem := func(messageID, timeReceived string) Item {
+		return Item{
+			TimeIndex: TimeIndex{
+				MessageID:    messageID,
+				Type:         "inbox",
+				TimeReceived: timeReceived,
+			},
+			Unread: new(bool),
+		}
+	}
+
+	// the first page crosses the month boundary
+	result, err := List(context.TODO(), client, ListInput{Type: "inbox", PageSize: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"inbox#2022-03", "inbox#2022-02"}, queried)
+	assert.Equal(t, &ListResult{
+		Count: 3,
+		Items: []Item{
+			newItem("m1", "2022-03-01T10:00:00Z"),
+			newItem("f1", "2022-02-20T10:00:00Z"),
+			newItem("f2", "2022-02-10T10:00:00Z"),
+		},
+		NextCursor: &Cursor{
+			QueryInfo: QueryInfo{
+				Type:  "inbox",
+				Year:  "2022",
+				Month: "02",
+				Order: "desc",
+			},
+			LastEvaluatedKey: map[string]types.AttributeValue{
+				"MessageID": &types.AttributeValueMemberS{Value: "f2"},
+			},
+		},
+		HasMore: true,
+	}, result)
+
+	// the second page continues from the cursor, and stops after the recorded oldest month
+	queried = nil
+	result, err = List(context.TODO(), client, ListInput{Type: "inbox", PageSize: 3, NextCursor: result.NextCursor})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"inbox#2022-02", "inbox#2022-01", "inbox#2021-12"}, queried)
+	assert.Equal(t, &ListResult{
+		Count: 1,
+		Items: []Item{
+			newItem("f3", "2022-02-05T10:00:00Z"),
+		},
+		HasMore: false,
+	}, result)
+
+	// a page filled in the oldest month is the last one
+	client.oldest = "2022-02"
+	result, err = List(context.TODO(), client, ListInput{Type: "inbox", PageSize: 4})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, result.Count)
+	assert.Nil(t, result.NextCursor)
+	assert.False(t, result.HasMore)
+}
+
+func TestList_AcrossMonthsAscending(t *testing.T) {
+	now = func() time.Time { return time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() {
+		now = time.Now // cleanup
+	}()
+
+	partitions := map[string][]string{ // TypeYearMonth -> MessageID, in ascending order
+		"inbox#2021-12": {"d1", "d2"},
+		"inbox#2022-02": {"f1"},
+		"inbox#2022-03": {"m1", "m2"},
+	}
+	var queried []string
+	client := mockListEmailsAPI{oldest: "2021-12"}
+	client.QueryAPI = mockQueryAPI(func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+		typeYearMonth := params.ExpressionAttributeValues[":val"].(*types.AttributeValueMemberS).Value
+		queried = append(queried, typeYearMonth)
+
+		ids := partitions[typeYearMonth]
+		if params.ExclusiveStartKey != nil {
+			start := params.ExclusiveStartKey["MessageID"].(*types.AttributeValueMemberS).Value
+			for i, id := range ids {
+				if id == start {
+					ids = ids[i+1:]
+					break
+				}
+			}
+		}
+
+		output := &dynamodb.QueryOutput{}
+		for i, id := range ids {
+			if i == int(*params.Limit) {
+				output.LastEvaluatedKey = map[string]types.AttributeValue{
+					"MessageID": &types.AttributeValueMemberS{Value: ids[i-1]},
+				}
+				break
+			}
+			output.Items = append(output.Items, map[string]types.AttributeValue{
+				"MessageID":     &types.AttributeValueMemberS{Value: id},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: typeYearMonth},
+				"DateTime":      &types.AttributeValueMemberS{Value: "01-10:00:00"},
+			})
+		}
+		return output, nil
+	})
+
+	messageIDs := func(result *ListResult) []string {
+		ids := make([]string, len(result.Items))
+		for i, item := range result.Items {
+			ids[i] = item.MessageID
+		}
+		return ids
+	}
+
+	// the first page starts from the recorded oldest month, and crosses the empty month
+	result, err := List(context.TODO(), client, ListInput{Type: "inbox", Order: OrderAsc, PageSize: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"inbox#2021-12", "inbox#2022-01", "inbox#2022-02"}, queried)
+	assert.Equal(t, []string{"d1", "d2", "f1"}, messageIDs(result))
+	if assert.NotNil(t, result.NextCursor) {
+		assert.Equal(t, QueryInfo{Type: "inbox", Year: "2022", Month: "03", Order: OrderAsc}, result.NextCursor.QueryInfo)
+		assert.Empty(t, result.NextCursor.LastEvaluatedKey)
+	}
+
+	// the second page ends with the current month
+	queried = nil
+	result, err = List(context.TODO(), client, ListInput{Type: "inbox", Order: OrderAsc, PageSize: 3, NextCursor: result.NextCursor})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"inbox#2022-03"}, queried)
+	assert.Equal(t, []string{"m1", "m2"}, messageIDs(result))
+	assert.False(t, result.HasMore)
+
+	// the cursor can't be used with another order
+	_, err = List(context.TODO(), client, ListInput{Type: "inbox", PageSize: 3, NextCursor: &Cursor{
+		QueryInfo: QueryInfo{Type: "inbox", Year: "2022", Month: "03", Order: OrderAsc},
+	}})
+	assert.Equal(t, api.ErrQueryNotMatch, err)
+
+	_, err = List(context.TODO(), client, ListInput{Type: "inbox", Order: "newest"})
+	assert.Equal(t, api.ErrInvalidInput, err)
+}
+
+func TestPreviousYearMonth(t *testing.T) {
+	tests := []struct {
+		year, month                 string
+		expectedYear, expectedMonth string
+	}{
+		{"2022", "03", "2022", "02"},
+		{"2022", "01", "2021", "12"},
+		{"2022", "12", "2022", "11"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			year, month := previousYearMonth(test.year, test.month)
+			assert.Equal(t, test.expectedYear, year)
+			assert.Equal(t, test.expectedMonth, month)
+		})
+	}
+}
+
 func TestGetCurrentYearMonth(t *testing.T) {
 	tests := []struct {
 		now           time.Time
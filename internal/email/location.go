@@ -0,0 +1,33 @@
+package email
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// RawLocation returns the location of the raw email of an email in S3,
+// which is stored in its item if SES stores it at another location than S3_BUCKET and S3_PREFIX
+func RawLocation(ctx context.Context, client api.GetItemAPI, messageID string) (storage.Location, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		ProjectionExpression: aws.String(storage.RawBucketAttribute + ", " + storage.RawKeyAttribute),
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return storage.Location{}, api.ErrTooManyRequests
+		}
+		return storage.Location{}, err
+	}
+	return storage.ItemLocation(resp.Item, messageID), nil
+}
@@ -0,0 +1,147 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// oldestID is the MessageID of the item storing the oldest month with emails of each type in the email table,
+// which is where listing across months stops. Each type is an attribute with the month, e.g. inbox = "2021-04".
+const oldestID = "months#oldest"
+
+// recordedMonths caches the recorded months, at most the ones in the item, by email type in this process,
+// so that the item isn't updated for every email of a month that's already recorded
+var recordedMonths = new(sync.Map)
+
+// RecordMonth records the month of a stored email, e.g. "inbox#2021-04", as the oldest month of its type
+// if it's older than the recorded one. It's called when emails that may be older than the current month are stored,
+// e.g. imported ones, so that List knows where emails start. Types whose month isn't recorded yet are left to oldestYearMonth.
+func RecordMonth(ctx context.Context, client api.UpdateItemAPI, typeYearMonth string) error {
+	emailType, yearMonth, ok := strings.Cut(typeYearMonth, "#")
+	if !ok {
+		return api.ErrInvalidInput
+	}
+	return recordMonth(ctx, client, emailType, yearMonth, "#type > :month")
+}
+
+// recordMonth sets the month of a type if the condition is met, and caches the recorded month
+func recordMonth(ctx context.Context, client api.UpdateItemAPI, emailType, yearMonth, condition string) error {
+	if recorded, ok := recordedMonths.Load(emailType); ok && recorded.(string) <= yearMonth {
+		return nil
+	}
+
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: oldestID},
+		},
+		UpdateExpression:    aws.String("SET #type = :month"),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]string{
+			"#type": emailType,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":month": &types.AttributeValueMemberS{Value: yearMonth},
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		apiErr := new(types.ConditionalCheckFailedException)
+		if !errors.As(err, &apiErr) {
+			return err
+		}
+		// an older month is already recorded, or none is recorded yet
+		if v, ok := apiErr.Item[emailType].(*types.AttributeValueMemberS); ok {
+			recordedMonths.Store(emailType, v.Value)
+		}
+		return nil
+	}
+	recordedMonths.Store(emailType, yearMonth)
+	return nil
+}
+
+// oldestYearMonth returns the oldest month with emails of a type.
+// Types whose month isn't recorded yet, e.g. after upgrading with existing emails, are looked up by scanning the table once,
+// and the current month is recorded if there are no emails of the type.
+func oldestYearMonth(ctx context.Context, client api.ListEmailsAPI, emailType string) (string, string, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: oldestID},
+		},
+		ProjectionExpression: aws.String("#type"),
+		ExpressionAttributeNames: map[string]string{
+			"#type": emailType,
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return "", "", api.ErrTooManyRequests
+		}
+		return "", "", err
+	}
+
+	yearMonth := ""
+	if v, ok := resp.Item[emailType].(*types.AttributeValueMemberS); ok {
+		yearMonth = v.Value
+	} else {
+		yearMonth, err = scanOldestYearMonth(ctx, client, emailType)
+		if err != nil {
+			return "", "", err
+		}
+		if yearMonth == "" {
+			year, month := getCurrentYearMonth()
+			yearMonth = year + "-" + month
+		}
+		err = recordMonth(ctx, client, emailType, yearMonth, "attribute_not_exists(#type) OR #type > :month")
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	year, month, ok := strings.Cut(yearMonth, "-")
+	if !ok {
+		return "", "", errors.New("invalid oldest month: " + yearMonth)
+	}
+	return year, month, nil
+}
+
+// scanOldestYearMonth returns the oldest month with emails of a type by scanning the table, or an empty string if there are none
+func scanOldestYearMonth(ctx context.Context, client api.ScanAPI, emailType string) (string, error) {
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String(env.TableName),
+		ProjectionExpression: aws.String("TypeYearMonth"),
+		FilterExpression:     aws.String("begins_with(TypeYearMonth, :v_type)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":v_type": &types.AttributeValueMemberS{Value: emailType + "#"},
+		},
+	}
+	oldest := ""
+	for {
+		output, err := client.Scan(ctx, input)
+		if err != nil {
+			return "", err
+		}
+		for _, item := range output.Items {
+			v, ok := item["TypeYearMonth"].(*types.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			if yearMonth := strings.TrimPrefix(v.Value, emailType+"#"); oldest == "" || yearMonth < oldest {
+				oldest = yearMonth
+			}
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			return oldest, nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,159 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockListEmailsAPI lists emails with a mock of Query, where oldest is the recorded oldest month of every type,
+// e.g. "2021-12", or none is recorded and no emails are found by Scan if it's empty
+type mockListEmailsAPI struct {
+	api.QueryAPI
+	oldest string
+}
+
+func (m mockListEmailsAPI) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.oldest == "" {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{
+		Item: map[string]types.AttributeValue{
+			params.ExpressionAttributeNames["#type"]: &types.AttributeValueMemberS{Value: m.oldest},
+		},
+	}, nil
+}
+
+func (m mockListEmailsAPI) Scan(_ context.Context, _ *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return &dynamodb.ScanOutput{}, nil
+}
+
+func (m mockListEmailsAPI) UpdateItem(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestRecordMonth(t *testing.T) {
+	recordedMonths = new(sync.Map)
+	defer func() { recordedMonths = new(sync.Map) }()
+
+	var updated []string
+	var updateErr error
+	client := mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+		assert.Equal(t, oldestID, params.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+		assert.Equal(t, "#type > :month", *params.ConditionExpression)
+		updated = append(updated, params.ExpressionAttributeNames["#type"]+"#"+params.ExpressionAttributeValues[":month"].(*types.AttributeValueMemberS).Value)
+		return &dynamodb.UpdateItemOutput{}, updateErr
+	})
+
+	assert.Nil(t, RecordMonth(context.TODO(), client, "inbox#2022-03"))
+	// months that aren't older than the recorded one are skipped
+	assert.Nil(t, RecordMonth(context.TODO(), client, "inbox#2022-03"))
+	assert.Nil(t, RecordMonth(context.TODO(), client, "inbox#2022-04"))
+
+	// an older month recorded by another process fails the condition
+	updateErr = &types.ConditionalCheckFailedException{Item: map[string]types.AttributeValue{
+		"inbox": &types.AttributeValueMemberS{Value: "2021-12"},
+	}}
+	assert.Nil(t, RecordMonth(context.TODO(), client, "inbox#2022-01"))
+	assert.Nil(t, RecordMonth(context.TODO(), client, "inbox#2022-02"))
+
+	// so does a type without a recorded month, which isn't cached
+	updateErr = &types.ConditionalCheckFailedException{Item: map[string]types.AttributeValue{}}
+	assert.Nil(t, RecordMonth(context.TODO(), client, "sent#2022-04"))
+	assert.Nil(t, RecordMonth(context.TODO(), client, "sent#2022-04"))
+	assert.Equal(t, []string{"inbox#2022-03", "inbox#2022-01", "sent#2022-04", "sent#2022-04"}, updated)
+
+	updateErr = errors.New("error")
+	assert.Equal(t, updateErr, RecordMonth(context.TODO(), client, "draft#2022-01"))
+	assert.Equal(t, api.ErrInvalidInput, RecordMonth(context.TODO(), client, "2022-01"))
+}
+
+type mockOldestAPI struct {
+	mockListEmailsAPI
+	scan   func(params *dynamodb.ScanInput) (*dynamodb.ScanOutput, error)
+	update func(params *dynamodb.UpdateItemInput)
+}
+
+func (m mockOldestAPI) Scan(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return m.scan(params)
+}
+
+func (m mockOldestAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.update(params)
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestOldestYearMonth(t *testing.T) {
+	recordedMonths = new(sync.Map)
+	defer func() { recordedMonths = new(sync.Map) }()
+	now = func() time.Time { return time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() {
+		now = time.Now // cleanup
+	}()
+
+	var scanned int
+	var recorded []string
+	client := mockOldestAPI{
+		mockListEmailsAPI: mockListEmailsAPI{oldest: "2021-12"},
+		scan: func(params *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+			scanned++
+			assert.Equal(t, "inbox#", params.ExpressionAttributeValues[":v_type"].(*types.AttributeValueMemberS).Value)
+			if params.ExclusiveStartKey == nil {
+				return &dynamodb.ScanOutput{
+					Items: []map[string]types.AttributeValue{
+						{"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2021-06"}},
+						{"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2021-04"}},
+					},
+					LastEvaluatedKey: map[string]types.AttributeValue{
+						"MessageID": &types.AttributeValueMemberS{Value: "id"},
+					},
+				}, nil
+			}
+			return &dynamodb.ScanOutput{
+				Items: []map[string]types.AttributeValue{
+					{"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2021-05"}},
+				},
+			}, nil
+		},
+		update: func(params *dynamodb.UpdateItemInput) {
+			assert.Equal(t, "attribute_not_exists(#type) OR #type > :month", *params.ConditionExpression)
+			recorded = append(recorded, params.ExpressionAttributeValues[":month"].(*types.AttributeValueMemberS).Value)
+		},
+	}
+
+	// the recorded month is used
+	year, month, err := oldestYearMonth(context.TODO(), client, "inbox")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2021", "12"}, []string{year, month})
+	assert.Zero(t, scanned)
+
+	// the month is looked up and recorded if it's not recorded yet
+	client.oldest = ""
+	year, month, err = oldestYearMonth(context.TODO(), client, "inbox")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2021", "04"}, []string{year, month})
+	assert.Equal(t, 2, scanned)
+	assert.Equal(t, []string{"2021-04"}, recorded)
+
+	// the current month is recorded if there are no emails
+	client.scan = func(_ *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		return &dynamodb.ScanOutput{}, nil
+	}
+	year, month, err = oldestYearMonth(context.TODO(), client, "sent")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2022", "03"}, []string{year, month})
+	assert.Equal(t, []string{"2021-04", "2022-03"}, recorded)
+
+	client.scan = func(_ *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		return nil, errors.New("error")
+	}
+	_, _, err = oldestYearMonth(context.TODO(), client, "draft")
+	assert.EqualError(t, err, "error")
+}
@@ -0,0 +1,77 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// NormalizeOriginalMessageID returns the Message-ID enclosed in angle brackets,
+// which is the format stored in OriginalMessageID attribute (RFC 5322 3.6.4)
+func NormalizeOriginalMessageID(originalMessageID string) string {
+	originalMessageID = strings.TrimSpace(originalMessageID)
+	if originalMessageID == "" {
+		return ""
+	}
+	if !strings.HasPrefix(originalMessageID, "<") {
+		originalMessageID = "<" + originalMessageID
+	}
+	if !strings.HasSuffix(originalMessageID, ">") {
+		originalMessageID += ">"
+	}
+	return originalMessageID
+}
+
+// FindByOriginalMessageID returns the MessageIDs of the emails with the given RFC 5322 Message-ID
+func FindByOriginalMessageID(ctx context.Context, client api.QueryAPI, originalMessageID string) ([]string, error) {
+	resp, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(env.TableName),
+		IndexName:              aws.String(env.GsiOriginalIndexName),
+		KeyConditionExpression: aws.String("OriginalMessageID = :originalMessageID"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":originalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: originalMessageID},
+		},
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+
+	messageIDs := make([]string, 0, len(resp.Items))
+	for _, item := range resp.Items {
+		if messageID, ok := item["MessageID"].(*dynamodbTypes.AttributeValueMemberS); ok {
+			messageIDs = append(messageIDs, messageID.Value)
+		}
+	}
+	return messageIDs, nil
+}
+
+// GetByOriginalMessageID returns the email with the given RFC 5322 Message-ID
+func GetByOriginalMessageID(ctx context.Context, client api.QueryAndGetItemAPI, originalMessageID string) (*GetResult, error) {
+	originalMessageID = NormalizeOriginalMessageID(originalMessageID)
+	if originalMessageID == "" {
+		return nil, api.ErrInvalidInput
+	}
+
+	messageIDs, err := FindByOriginalMessageID(ctx, client, originalMessageID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messageIDs) == 0 {
+		return nil, api.ErrNotFound
+	}
+	if len(messageIDs) > 1 {
+		fmt.Printf("found %d emails with the same Message-ID, returning the first one\n", len(messageIDs))
+	}
+
+	return Get(ctx, client, messageIDs[0])
+}
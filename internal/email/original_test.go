@@ -0,0 +1,116 @@
+package email
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockQueryAndGetItemAPI struct {
+	mockQuery   mockQueryAPI
+	mockGetItem mockGetItemAPI
+}
+
+func (m mockQueryAndGetItemAPI) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return m.mockQuery(ctx, params, optFns...)
+}
+
+func (m mockQueryAndGetItemAPI) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return m.mockGetItem(ctx, params, optFns...)
+}
+
+func TestNormalizeOriginalMessageID(t *testing.T) {
+	assert.Equal(t, "<abc@example.com>", NormalizeOriginalMessageID("abc@example.com"))
+	assert.Equal(t, "<abc@example.com>", NormalizeOriginalMessageID(" <abc@example.com> "))
+	assert.Equal(t, "<abc@example.com>", NormalizeOriginalMessageID("<abc@example.com"))
+	assert.Equal(t, "", NormalizeOriginalMessageID(" "))
+}
+
+func TestGetByOriginalMessageID(t *testing.T) {
+	env.TableName = "table-for-get-by-original"
+	env.GsiOriginalIndexName = "index-for-get-by-original"
+	tests := []struct {
+		client            func(t *testing.T) api.QueryAndGetItemAPI
+		originalMessageID string
+		expectedID        string
+		expectedErr       error
+	}{
+		{
+			client: func(t *testing.T) api.QueryAndGetItemAPI {
+				return mockQueryAndGetItemAPI{
+					mockQuery: func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+						t.Helper()
+						assert.Equal(t, env.TableName, *params.TableName)
+						assert.Equal(t, env.GsiOriginalIndexName, *params.IndexName)
+						assert.Equal(t, "<abc@example.com>", params.ExpressionAttributeValues[":originalMessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+						return &dynamodb.QueryOutput{
+							Items: []map[string]dynamodbTypes.AttributeValue{
+								{"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "exampleMessageID"}},
+							},
+						}, nil
+					},
+					mockGetItem: func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+						t.Helper()
+						assert.Equal(t, "exampleMessageID", params.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+						return &dynamodb.GetItemOutput{
+							Item: map[string]dynamodbTypes.AttributeValue{
+								"MessageID":         &dynamodbTypes.AttributeValueMemberS{Value: "exampleMessageID"},
+								"OriginalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: "<abc@example.com>"},
+								"TypeYearMonth":     &dynamodbTypes.AttributeValueMemberS{Value: "inbox#2024-03"},
+								"DateTime":          &dynamodbTypes.AttributeValueMemberS{Value: "12-01:01:01"},
+							},
+						}, nil
+					},
+				}
+			},
+			originalMessageID: "abc@example.com",
+			expectedID:        "exampleMessageID",
+		},
+		{
+			client: func(_ *testing.T) api.QueryAndGetItemAPI {
+				return mockQueryAndGetItemAPI{
+					mockQuery: func(_ context.Context, _ *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+						return &dynamodb.QueryOutput{}, nil
+					},
+				}
+			},
+			originalMessageID: "<abc@example.com>",
+			expectedErr:       api.ErrNotFound,
+		},
+		{
+			client: func(_ *testing.T) api.QueryAndGetItemAPI {
+				return mockQueryAndGetItemAPI{
+					mockQuery: func(_ context.Context, _ *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+						return nil, &dynamodbTypes.ProvisionedThroughputExceededException{}
+					},
+				}
+			},
+			originalMessageID: "<abc@example.com>",
+			expectedErr:       api.ErrTooManyRequests,
+		},
+		{
+			client: func(_ *testing.T) api.QueryAndGetItemAPI {
+				return mockQueryAndGetItemAPI{}
+			},
+			originalMessageID: "",
+			expectedErr:       api.ErrInvalidInput,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ctx := context.TODO()
+			actual, err := GetByOriginalMessageID(ctx, test.client(t), test.originalMessageID)
+			assert.Equal(t, test.expectedErr, err)
+			if test.expectedErr == nil {
+				assert.Equal(t, test.expectedID, actual.MessageID)
+			}
+		})
+	}
+}
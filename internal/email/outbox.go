@@ -0,0 +1,82 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Send states of drafts whose sending failed, when retries are enabled by SEND_RETRY_QUEUE
+const (
+	SendStateRetrying = "retrying" // the send failed transiently, and is queued to be retried
+	SendStateFailed   = "failed"   // all attempts failed, or the last failure isn't transient
+)
+
+// SendAttempt is a failed attempt to send an email
+type SendAttempt struct {
+	Attempt int    `json:"attempt"` // 1 for the first attempt of a send, counting up to SEND_MAX_ATTEMPTS for its retries
+	Time    string `json:"time"`    // RFC3339
+	Error   string `json:"error"`
+}
+
+// ListOutboxInput represents the input of ListOutbox method
+type ListOutboxInput struct {
+	State      string  `json:"state"`    // retrying or failed, both if empty
+	PageSize   int     `json:"pageSize"` // default is 100
+	NextCursor *Cursor `json:"nextCursor"`
+}
+
+// ListOutbox lists drafts whose sending failed, i.e. that are retrying or failed, most recently edited first
+func ListOutbox(ctx context.Context, client api.ListEmailsAPI, input ListOutboxInput) (*ListResult, error) {
+	states := []string{SendStateRetrying, SendStateFailed}
+	switch input.State {
+	case "":
+	case SendStateRetrying, SendStateFailed:
+		states = []string{input.State}
+	default:
+		return nil, api.ErrInvalidInput
+	}
+	if input.PageSize <= 0 {
+		input.PageSize = DefaultPageSize
+	}
+	return List(ctx, client, ListInput{
+		Type:       EmailTypeDraft,
+		PageSize:   input.PageSize,
+		NextCursor: input.NextCursor,
+		SendStates: states,
+	})
+}
+
+// CancelSend removes a retrying or failed draft from the outbox, keeping it as a draft with its failed attempts.
+// Pending retries of the draft are skipped.
+func CancelSend(ctx context.Context, client api.UpdateItemAPI, messageID string) error {
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression:    aws.String("REMOVE SendState"),
+		ConditionExpression: aws.String("begins_with(TypeYearMonth, :v_draft) AND attribute_exists(SendState)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":v_draft": &types.AttributeValueMemberS{Value: EmailTypeDraft + "#"},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return api.ErrNotFound
+		}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+
+	fmt.Println("cancel method finished successfully")
+	return nil
+}
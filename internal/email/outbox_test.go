@@ -0,0 +1,113 @@
+package email
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListOutbox(t *testing.T) {
+	now = func() time.Time { return time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() {
+		now = time.Now // cleanup
+	}()
+
+	tests := []struct {
+		state          string
+		expectedFilter string
+		expectedStates []string
+		expectedErr    error
+	}{
+		{
+			state:          "",
+			expectedFilter: "attribute_not_exists(TrashedTime) AND attribute_not_exists(ArchivedTime) AND SendState IN (:state0, :state1)",
+			expectedStates: []string{SendStateRetrying, SendStateFailed},
+		},
+		{
+			state:          SendStateFailed,
+			expectedFilter: "attribute_not_exists(TrashedTime) AND attribute_not_exists(ArchivedTime) AND SendState IN (:state0)",
+			expectedStates: []string{SendStateFailed},
+		},
+		{
+			state:       "sent",
+			expectedErr: api.ErrInvalidInput,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := mockQueryAPI(func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+				assert.Equal(t, test.expectedFilter, *params.FilterExpression)
+				for j, state := range test.expectedStates {
+					assert.Equal(t, state, params.ExpressionAttributeValues[":state"+strconv.Itoa(j)].(*types.AttributeValueMemberS).Value)
+				}
+
+				output := &dynamodb.QueryOutput{}
+				typeYearMonth := params.ExpressionAttributeValues[":val"].(*types.AttributeValueMemberS).Value
+				if typeYearMonth == "draft#2022-03" {
+					output.Items = []map[string]types.AttributeValue{
+						{
+							"MessageID":     &types.AttributeValueMemberS{Value: "draft-1"},
+							"TypeYearMonth": &types.AttributeValueMemberS{Value: typeYearMonth},
+							"DateTime":      &types.AttributeValueMemberS{Value: "01-00:00:00"},
+							"SendState":     &types.AttributeValueMemberS{Value: test.expectedStates[0]},
+							"SendAttempts": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+								&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+									"Attempt": &types.AttributeValueMemberN{Value: "1"},
+									"Time":    &types.AttributeValueMemberS{Value: "2022-03-01T00:00:00Z"},
+									"Error":   &types.AttributeValueMemberS{Value: "throttled"},
+								}},
+							}},
+						},
+					}
+				}
+				return output, nil
+			})
+
+			result, err := ListOutbox(context.TODO(), mockListEmailsAPI{QueryAPI: client, oldest: "2021-03"}, ListOutboxInput{State: test.state})
+			assert.Equal(t, test.expectedErr, err)
+			if err != nil {
+				return
+			}
+			assert.Len(t, result.Items, 1)
+			assert.Equal(t, test.expectedStates[0], result.Items[0].SendState)
+			assert.Equal(t, []SendAttempt{{Attempt: 1, Time: "2022-03-01T00:00:00Z", Error: "throttled"}}, result.Items[0].SendAttempts)
+		})
+	}
+}
+
+func TestCancelSend(t *testing.T) {
+	tests := []struct {
+		err         error
+		expectedErr error
+	}{
+		{},
+		{
+			err:         &types.ConditionalCheckFailedException{},
+			expectedErr: api.ErrNotFound,
+		},
+		{
+			err:         &types.ProvisionedThroughputExceededException{},
+			expectedErr: api.ErrTooManyRequests,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+				assert.Equal(t, "REMOVE SendState", *params.UpdateExpression)
+				assert.Equal(t, "begins_with(TypeYearMonth, :v_draft) AND attribute_exists(SendState)", *params.ConditionExpression)
+				return &dynamodb.UpdateItemOutput{}, test.err
+			})
+
+			err := CancelSend(context.TODO(), client, "draft-id")
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+}
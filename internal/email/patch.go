@@ -0,0 +1,148 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/addr"
+	"github.com/harryzcy/mailbox/internal/util/format"
+	"github.com/harryzcy/mailbox/internal/util/htmlutil"
+)
+
+// PatchInput represents the input of patch method.
+// Only fields that are set are changed, the rest of the draft is kept as is.
+type PatchInput struct {
+	MessageID    string    `json:"-"`
+	Subject      *string   `json:"subject"`
+	From         *[]string `json:"from"`
+	To           *[]string `json:"to"`
+	Cc           *[]string `json:"cc"`
+	Bcc          *[]string `json:"bcc"`
+	ReplyTo      *[]string `json:"replyTo"`
+	Text         *string   `json:"text"`
+	HTML         *string   `json:"html"`
+	GenerateText string    `json:"generateText"` // on, off, or auto (default), only used when html is changed
+}
+
+// PatchResult represents the result of patch method
+type PatchResult struct {
+	TimeIndex
+}
+
+var generateText = htmlutil.GenerateText
+
+var getUpdatedTime = func() time.Time {
+	return time.Now().UTC()
+}
+
+// Patch updates the changed fields of a draft email, without rewriting the whole item.
+// It's meant for frequent autosaves, where usually only a few fields are changed.
+func Patch(ctx context.Context, client api.UpdateItemAPI, input PatchInput) (*PatchResult, error) {
+	fmt.Println("patch method started")
+	if !strings.HasPrefix(input.MessageID, "draft-") {
+		return nil, api.ErrEmailIsNotDraft
+	}
+	for _, list := range []*[]string{input.From, input.To, input.Cc, input.Bcc, input.ReplyTo} {
+		if list == nil {
+			continue
+		}
+		if err := addr.ValidateAll(*list); err != nil {
+			return nil, api.ErrInvalidInput
+		}
+	}
+
+	if input.HTML != nil && input.Text == nil && input.GenerateText != "off" {
+		text, err := generateText(*input.HTML)
+		if err != nil {
+			return nil, err
+		}
+		input.Text = &text
+	}
+
+	// the draft is moved to the month it's last edited, so that drafts are ordered by the last edited time
+	now := getUpdatedTime()
+	typeYearMonth, err := format.TypeYearMonth(EmailTypeDraft, now)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]types.AttributeValue{
+		":typeYearMonth": &types.AttributeValueMemberS{Value: typeYearMonth},
+		":dateTime":      &types.AttributeValueMemberS{Value: format.DateTime(now, input.MessageID)},
+		":v_type":        &types.AttributeValueMemberS{Value: EmailTypeDraft},
+	}
+	set := []string{"TypeYearMonth = :typeYearMonth", "DateTime = :dateTime"}
+	remove := []string{}
+	names := map[string]string{}
+
+	fields := map[string]*string{"Subject": input.Subject, "Text": input.Text, "HTML": input.HTML}
+	for name, value := range fields {
+		if value == nil {
+			continue
+		}
+		set = append(set, "#"+name+" = :"+name)
+		names["#"+name] = name
+		values[":"+name] = &types.AttributeValueMemberS{Value: *value}
+	}
+	lists := map[string]*[]string{"From": input.From, "To": input.To, "Cc": input.Cc, "Bcc": input.Bcc, "ReplyTo": input.ReplyTo}
+	for name, value := range lists {
+		if value == nil {
+			continue
+		}
+		names["#"+name] = name
+		if len(*value) == 0 {
+			// string sets can't be empty
+			remove = append(remove, "#"+name)
+			continue
+		}
+		set = append(set, "#"+name+" = :"+name)
+		values[":"+name] = &types.AttributeValueMemberSS{Value: *value}
+	}
+	sort.Strings(set[2:]) // keep the expression deterministic
+	sort.Strings(remove)
+
+	updateExpression := "SET " + strings.Join(set, ", ")
+	if len(remove) > 0 {
+		updateExpression += " REMOVE " + strings.Join(remove, ", ")
+	}
+	if len(names) == 0 {
+		names = nil
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: input.MessageID},
+		},
+		UpdateExpression:          aws.String(updateExpression),
+		ConditionExpression:       aws.String("attribute_exists(MessageID) AND begins_with(TypeYearMonth, :v_type)"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return nil, api.ErrNotFound
+		}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+
+	fmt.Println("patch method finished successfully")
+	return &PatchResult{
+		TimeIndex: TimeIndex{
+			MessageID:   input.MessageID,
+			Type:        EmailTypeDraft,
+			TimeUpdated: now.Format(time.RFC3339),
+		},
+	}, nil
+}
@@ -0,0 +1,90 @@
+package email
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/htmlutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatch(t *testing.T) {
+	oldGetUpdatedTime := getUpdatedTime
+	getUpdatedTime = func() time.Time { return time.Date(2022, 3, 16, 16, 55, 45, 0, time.UTC) }
+	defer func() { getUpdatedTime = oldGetUpdatedTime }()
+	generateText = func(html string) (string, error) { return "text of " + html, nil }
+	defer func() { generateText = htmlutil.GenerateText }()
+
+	env.TableName = "table-for-patch"
+	tests := []struct {
+		input              PatchInput
+		updateErr          error
+		expectedExpression string
+		expectedValues     map[string]string
+		expected           *PatchResult
+		expectedErr        error
+	}{
+		{
+			input: PatchInput{
+				MessageID: "draft-example",
+				Subject:   aws.String("subject"),
+				To:        &[]string{},
+			},
+			expectedExpression: "SET TypeYearMonth = :typeYearMonth, DateTime = :dateTime, #Subject = :Subject REMOVE #To",
+			expectedValues:     map[string]string{":Subject": "subject", ":typeYearMonth": "draft#2022-03"},
+			expected: &PatchResult{
+				TimeIndex: TimeIndex{MessageID: "draft-example", Type: "draft", TimeUpdated: "2022-03-16T16:55:45Z"},
+			},
+		},
+		{
+			input: PatchInput{
+				MessageID: "draft-example",
+				HTML:      aws.String("<p>html</p>"),
+			},
+			expectedExpression: "SET TypeYearMonth = :typeYearMonth, DateTime = :dateTime, #HTML = :HTML, #Text = :Text",
+			expectedValues:     map[string]string{":HTML": "<p>html</p>", ":Text": "text of <p>html</p>"},
+			expected: &PatchResult{
+				TimeIndex: TimeIndex{MessageID: "draft-example", Type: "draft", TimeUpdated: "2022-03-16T16:55:45Z"},
+			},
+		},
+		{
+			input:       PatchInput{MessageID: "draft-example"},
+			updateErr:   &types.ConditionalCheckFailedException{},
+			expectedErr: api.ErrNotFound,
+		},
+		{
+			input:       PatchInput{MessageID: "example"},
+			expectedErr: api.ErrEmailIsNotDraft,
+		},
+		{
+			input:       PatchInput{MessageID: "draft-example", To: &[]string{"invalid"}},
+			expectedErr: api.ErrInvalidInput,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+				assert.Equal(t, "attribute_exists(MessageID) AND begins_with(TypeYearMonth, :v_type)", *params.ConditionExpression)
+				if test.expectedExpression != "" {
+					assert.Equal(t, test.expectedExpression, *params.UpdateExpression)
+				}
+				for key, value := range test.expectedValues {
+					assert.Equal(t, value, params.ExpressionAttributeValues[key].(*types.AttributeValueMemberS).Value)
+				}
+				return &dynamodb.UpdateItemOutput{}, test.updateErr
+			})
+
+			result, err := Patch(context.TODO(), client, test.input)
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
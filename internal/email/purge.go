@@ -0,0 +1,92 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// purgeStopMargin is the time left before the deadline at which emptying the trash stops, to return what's deleted
+const purgeStopMargin = 5 * time.Second
+
+// ErrTrashRetentionNotSet is returned by PurgeTrash if TRASH_RETENTION_DAYS isn't set
+var ErrTrashRetentionNotSet = errors.New("trashed emails don't expire, TRASH_RETENTION_DAYS is not set")
+
+// EmptyTrashResult represents the result of emptying the trash
+type EmptyTrashResult struct {
+	Deleted []string       `json:"deleted"`
+	Failed  []BatchFailure `json:"failed,omitempty"`
+	// Whether trashed emails are left because the deadline is near, which are deleted by calling it again
+	Remaining bool `json:"remaining,omitempty"`
+}
+
+// EmptyTrash permanently deletes the emails trashed before the given time, see BatchDelete.
+// Emails that are part of a thread are left, since they can only be deleted with their thread.
+// If the deadline of ctx is near, it stops and returns what's deleted with Remaining set.
+func EmptyTrash(ctx context.Context, client api.EmptyTrashAPI, before time.Time) (*EmptyTrashResult, error) {
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String(env.TableName),
+		ProjectionExpression: aws.String("MessageID"),
+		FilterExpression:     aws.String("TrashedTime < :before AND attribute_not_exists(ThreadID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":before": &types.AttributeValueMemberS{Value: before.UTC().Format(time.RFC3339)},
+		},
+	}
+	result := &EmptyTrashResult{Deleted: []string{}}
+	for {
+		output, err := client.Scan(ctx, input)
+		if err != nil {
+			if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return result, api.ErrTooManyRequests
+			}
+			return result, err
+		}
+
+		messageIDs := make([]string, 0, len(output.Items))
+		for _, item := range output.Items {
+			if messageID, ok := item["MessageID"].(*types.AttributeValueMemberS); ok {
+				messageIDs = append(messageIDs, messageID.Value)
+			}
+		}
+		for len(messageIDs) > 0 {
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < purgeStopMargin {
+				result.Remaining = true
+				return result, nil
+			}
+			n := min(len(messageIDs), MaxBatchSize)
+			batch, err := BatchDelete(ctx, client, messageIDs[:n])
+			if err != nil {
+				return result, err
+			}
+			messageIDs = messageIDs[n:]
+			result.Deleted = append(result.Deleted, batch.Succeeded...)
+			result.Failed = append(result.Failed, batch.Failed...)
+		}
+
+		if len(output.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+
+	fmt.Printf("emptied trash: %d deleted, %d failed\n", len(result.Deleted), len(result.Failed))
+	return result, nil
+}
+
+// PurgeTrash permanently deletes the emails trashed longer than TRASH_RETENTION_DAYS ago, see EmptyTrash.
+// Unlike the expiry by the ExpiresAt TTL, it also purges emails trashed before TRASH_RETENTION_DAYS is set.
+func PurgeTrash(ctx context.Context, client api.EmptyTrashAPI, now time.Time) (*EmptyTrashResult, error) {
+	days, ok := trashRetentionDays()
+	if !ok {
+		return nil, ErrTrashRetentionNotSet
+	}
+	return EmptyTrash(ctx, client, now.AddDate(0, 0, -days))
+}
@@ -0,0 +1,77 @@
+package email
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+func mockEmptyTrashAPI(t *testing.T, before string, trashed ...string) (clients.Fake, *[]string) {
+	items := map[string]map[string]types.AttributeValue{}
+	for _, messageID := range trashed {
+		items[messageID] = batchItem(messageID, "inbox#2023-05", "TrashedTime")
+	}
+	deleted := &[]string{}
+	return clients.Fake{
+		MockScan: func(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+			assert.Equal(t, "TrashedTime < :before AND attribute_not_exists(ThreadID)", *params.FilterExpression)
+			assert.Equal(t, before, params.ExpressionAttributeValues[":before"].(*types.AttributeValueMemberS).Value)
+			output := &dynamodb.ScanOutput{}
+			for _, messageID := range trashed {
+				output.Items = append(output.Items, map[string]types.AttributeValue{
+					"MessageID": &types.AttributeValueMemberS{Value: messageID},
+				})
+			}
+			return output, nil
+		},
+		MockBatchGetItem: (&mockBatchEmailAPI{items: items}).BatchGetItem,
+		MockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+		MockDeleteObject: func(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+			*deleted = append(*deleted, *params.Key)
+			return &s3.DeleteObjectOutput{}, nil
+		},
+	}, deleted
+}
+
+func TestEmptyTrash(t *testing.T) {
+	env.TableName = "table-for-purge"
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	client, deleted := mockEmptyTrashAPI(t, "2024-05-08T12:00:00Z", "first", "second")
+
+	result, err := EmptyTrash(context.TODO(), client, now)
+	assert.Nil(t, err)
+	assert.Equal(t, &EmptyTrashResult{Deleted: []string{"first", "second"}}, result)
+	assert.Equal(t, []string{"first", "second"}, *deleted)
+
+	// it stops if the deadline is near
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	result, err = EmptyTrash(ctx, client, now)
+	assert.Nil(t, err)
+	assert.Equal(t, &EmptyTrashResult{Deleted: []string{}, Remaining: true}, result)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	env.TableName = "table-for-purge"
+	defer func() { env.TrashRetentionDays = "" }()
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	client, _ := mockEmptyTrashAPI(t, "2024-04-08T12:00:00Z", "expired")
+
+	_, err := PurgeTrash(context.TODO(), client, now)
+	assert.Equal(t, ErrTrashRetentionNotSet, err)
+
+	env.TrashRetentionDays = "30"
+	result, err := PurgeTrash(context.TODO(), client, now)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"expired"}, result.Deleted)
+}
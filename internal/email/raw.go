@@ -0,0 +1,47 @@
+package email
+
+import (
+	"context"
+	"io"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+)
+
+// GetRaw returns the raw MIME message of an email, unless the email is infected or its scan is pending, see CheckScan.
+// force skips the check, e.g. for admins reviewing the email.
+func GetRaw(ctx context.Context, client api.GetScannedContentAPI, messageID string, force bool) ([]byte, error) {
+	if !force {
+		if err := CheckScan(ctx, client, messageID); err != nil {
+			return nil, err
+		}
+	}
+	location, err := RawLocation(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return storage.S3.GetEmailRawAt(ctx, client, location)
+}
+
+// OpenRaw is GetRaw returning the raw MIME message as a stream, which must be closed after it's read
+func OpenRaw(ctx context.Context, client api.GetScannedContentAPI, messageID string, force bool) (io.ReadCloser, error) {
+	if !force {
+		if err := CheckScan(ctx, client, messageID); err != nil {
+			return nil, err
+		}
+	}
+	location, err := RawLocation(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return storage.S3.OpenEmailRaw(ctx, client, location)
+}
+
+// OpenHTML returns the HTML body of an email, or nil if it has none, see storage.S3Storage.OpenEmailHTML
+func OpenHTML(ctx context.Context, client api.GetItemContentAPI, messageID string) (*storage.EmailHTML, error) {
+	location, err := RawLocation(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return storage.S3.OpenEmailHTML(ctx, client, location)
+}
@@ -0,0 +1,60 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockGetRawAPI stores the item of an email, and its raw message at the key
+type mockGetRawAPI struct {
+	item map[string]types.AttributeValue
+	key  string
+}
+
+func (m mockGetRawAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: m.item}, nil
+}
+
+func (m mockGetRawAPI) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if *params.Key != m.key {
+		return nil, errors.New("unexpected key " + *params.Key)
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("raw"))}, nil
+}
+
+func TestGetRaw(t *testing.T) {
+	client := mockGetRawAPI{
+		item: map[string]types.AttributeValue{
+			"VirusStatus":              &types.AttributeValueMemberS{Value: "FAIL"},
+			storage.RawBucketAttribute: &types.AttributeValueMemberS{Value: "other-bucket"},
+			storage.RawKeyAttribute:    &types.AttributeValueMemberS{Value: "large/exampleMessageID"},
+		},
+		key: "large/exampleMessageID",
+	}
+
+	_, err := GetRaw(context.TODO(), client, "exampleMessageID", false)
+	assert.Equal(t, &api.ScanError{State: ScanStateInfected}, err)
+	_, err = OpenRaw(context.TODO(), client, "exampleMessageID", false)
+	assert.Equal(t, &api.ScanError{State: ScanStateInfected}, err)
+
+	raw, err := GetRaw(context.TODO(), client, "exampleMessageID", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "raw", string(raw))
+
+	client.item["VirusStatus"] = &types.AttributeValueMemberS{Value: "PASS"}
+	body, err := OpenRaw(context.TODO(), client, "exampleMessageID", false)
+	assert.Nil(t, err)
+	raw, _ = io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "raw", string(raw))
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/counter"
 	"github.com/harryzcy/mailbox/internal/env"
 )
 
@@ -18,7 +19,7 @@ const (
 )
 
 // Read marks an email as read or unread
-func Read(ctx context.Context, client api.UpdateItemAPI, messageID, action string) error {
+func Read(ctx context.Context, client api.UpdateCountedEmailAPI, messageID, action string) error {
 	input := &dynamodb.UpdateItemInput{
 		TableName: aws.String(env.TableName),
 		Key: map[string]types.AttributeValue{
@@ -37,7 +38,10 @@ func Read(ctx context.Context, client api.UpdateItemAPI, messageID, action strin
 		input.ExpressionAttributeValues[":val1"] = &types.AttributeValueMemberBOOL{Value: true}
 	}
 
-	_, err := client.UpdateItem(ctx, input)
+	err := updateEmail(ctx, client, input, messageID, func(state counter.State) counter.State {
+		state.Unread = action == ActionUnread
+		return state
+	})
 	if err != nil {
 		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
 			return api.ErrReadActionFailed
@@ -14,13 +14,13 @@ import (
 
 func TestRead(t *testing.T) {
 	tests := []struct {
-		client      func(t *testing.T) api.UpdateItemAPI
+		client      func(t *testing.T) api.UpdateCountedEmailAPI
 		messageID   string
 		action      string
 		expectedErr error
 	}{
 		{
-			client: func(t *testing.T) api.UpdateItemAPI {
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					assert.Len(t, params.Key, 1)
@@ -41,7 +41,7 @@ func TestRead(t *testing.T) {
 			action:    ActionRead,
 		},
 		{
-			client: func(t *testing.T) api.UpdateItemAPI {
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					assert.Len(t, params.Key, 1)
@@ -66,7 +66,7 @@ func TestRead(t *testing.T) {
 			action:    ActionUnread,
 		},
 		{
-			client: func(t *testing.T) api.UpdateItemAPI {
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					return &dynamodb.UpdateItemOutput{}, &types.ConditionalCheckFailedException{}
@@ -76,7 +76,7 @@ func TestRead(t *testing.T) {
 			expectedErr: api.ErrReadActionFailed,
 		},
 		{
-			client: func(t *testing.T) api.UpdateItemAPI {
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					return &dynamodb.UpdateItemOutput{}, api.ErrNotFound
@@ -86,7 +86,7 @@ func TestRead(t *testing.T) {
 			expectedErr: api.ErrNotFound,
 		},
 		{
-			client: func(t *testing.T) api.UpdateItemAPI {
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					return &dynamodb.UpdateItemOutput{}, &types.ProvisionedThroughputExceededException{}
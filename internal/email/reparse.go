@@ -17,7 +17,11 @@ import (
 func Reparse(ctx context.Context, client api.ReparseEmailAPI, messageID string) error {
 	item := make(map[string]types.AttributeValue)
 
-	emailResult, err := storage.S3.GetEmail(ctx, client, messageID)
+	location, err := RawLocation(ctx, client, messageID)
+	if err != nil {
+		return err
+	}
+	emailResult, err := storage.S3.GetEmailAt(ctx, client, location)
 	if err != nil {
 		return err
 	}
@@ -26,22 +30,26 @@ func Reparse(ctx context.Context, client api.ReparseEmailAPI, messageID string)
 	item["Attachments"] = emailResult.Attachments.ToAttributeValue()
 	item["Inlines"] = emailResult.Inlines.ToAttributeValue()
 	item["OtherParts"] = emailResult.OtherParts.ToAttributeValue()
+	item["AttachedEmails"] = emailResult.AttachedEmails.ToAttributeValue()
+	item["Stats"] = emailResult.Stats.ToAttributeValue()
 
 	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(env.TableName),
 		Key: map[string]types.AttributeValue{
 			"MessageID": &types.AttributeValueMemberS{Value: messageID},
 		},
-		UpdateExpression: aws.String("SET #tx = :text, HTML = :html, Attachments = :attachments, Inlines = :inlines, OtherParts = :others"),
+		UpdateExpression: aws.String("SET #tx = :text, HTML = :html, Attachments = :attachments, Inlines = :inlines, OtherParts = :others, AttachedEmails = :attachedEmails, Stats = :stats"),
 		ExpressionAttributeNames: map[string]string{
 			"#tx": "Text",
 		},
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":text":        &types.AttributeValueMemberS{Value: emailResult.Text},
-			":html":        &types.AttributeValueMemberS{Value: emailResult.HTML},
-			":attachments": emailResult.Attachments.ToAttributeValue(),
-			":inlines":     emailResult.Inlines.ToAttributeValue(),
-			":others":      emailResult.OtherParts.ToAttributeValue(),
+			":text":           &types.AttributeValueMemberS{Value: emailResult.Text},
+			":html":           &types.AttributeValueMemberS{Value: emailResult.HTML},
+			":attachments":    emailResult.Attachments.ToAttributeValue(),
+			":inlines":        emailResult.Inlines.ToAttributeValue(),
+			":others":         emailResult.OtherParts.ToAttributeValue(),
+			":attachedEmails": emailResult.AttachedEmails.ToAttributeValue(),
+			":stats":          emailResult.Stats.ToAttributeValue(),
 		},
 	})
 	if err != nil {
@@ -23,6 +23,11 @@ func (m mockReparseEmailAPI) GetObject(ctx context.Context, params *s3.GetObject
 	return m.mockGetObject(ctx, params, optFns...)
 }
 
+// GetItem returns an item without the location of the raw email, which is at the default location
+func (m mockReparseEmailAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{}}, nil
+}
+
 func (m mockReparseEmailAPI) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 	return m.mockUpdateItem(ctx, params, optFns...)
 }
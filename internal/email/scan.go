@@ -0,0 +1,66 @@
+package email
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Scan states of the attachments of an email, derived from the virus verdict of SES
+const (
+	ScanStateClean    = "clean"
+	ScanStateInfected = "infected"
+	// The scan was inconclusive or failed, so the attachments are held until they are reviewed
+	ScanStatePending = "pending"
+	// The email wasn't scanned, e.g. it's imported, received before the status was stored, or scanning is disabled
+	ScanStateUnscanned = "unscanned"
+)
+
+// ScanState returns the scan state of an email given the status of its SES virus verdict
+func ScanState(virusStatus string) string {
+	switch virusStatus {
+	case "PASS":
+		return ScanStateClean
+	case "FAIL":
+		return ScanStateInfected
+	case "GRAY", "PROCESSING_FAILED":
+		return ScanStatePending
+	default:
+		return ScanStateUnscanned
+	}
+}
+
+// CheckScan returns a *api.ScanError if the files of an email are infected or their scan is pending
+func CheckScan(ctx context.Context, client api.GetItemAPI, messageID string) error {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		ProjectionExpression: aws.String("VirusStatus"),
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+	if len(resp.Item) == 0 {
+		// the item may exist without the projected attribute, in which case the email is unscanned
+		return nil
+	}
+
+	var status string
+	if value, ok := resp.Item["VirusStatus"].(*types.AttributeValueMemberS); ok {
+		status = value.Value
+	}
+	if state := ScanState(status); state == ScanStateInfected || state == ScanStatePending {
+		return &api.ScanError{State: state}
+	}
+	return nil
+}
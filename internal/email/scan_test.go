@@ -0,0 +1,78 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanState(t *testing.T) {
+	tests := []struct {
+		status   string
+		expected string
+	}{
+		{"PASS", ScanStateClean},
+		{"FAIL", ScanStateInfected},
+		{"GRAY", ScanStatePending},
+		{"PROCESSING_FAILED", ScanStatePending},
+		{"DISABLED", ScanStateUnscanned},
+		{"", ScanStateUnscanned},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, ScanState(test.status))
+		})
+	}
+}
+
+func TestCheckScan(t *testing.T) {
+	tests := []struct {
+		item        map[string]types.AttributeValue
+		getErr      error
+		expectedErr error
+	}{
+		{
+			item: map[string]types.AttributeValue{"VirusStatus": &types.AttributeValueMemberS{Value: "PASS"}},
+		},
+		{
+			// imported or received before the status was stored
+			item: map[string]types.AttributeValue{},
+		},
+		{
+			item:        map[string]types.AttributeValue{"VirusStatus": &types.AttributeValueMemberS{Value: "FAIL"}},
+			expectedErr: &api.ScanError{State: ScanStateInfected},
+		},
+		{
+			item:        map[string]types.AttributeValue{"VirusStatus": &types.AttributeValueMemberS{Value: "GRAY"}},
+			expectedErr: &api.ScanError{State: ScanStatePending},
+		},
+		{
+			getErr:      &types.ProvisionedThroughputExceededException{},
+			expectedErr: api.ErrTooManyRequests,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := mockGetItemAPI(func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				assert.Equal(t, "VirusStatus", *params.ProjectionExpression)
+				if test.getErr != nil {
+					return nil, test.getErr
+				}
+				return &dynamodb.GetItemOutput{Item: test.item}, nil
+			})
+			err := CheckScan(context.TODO(), client, "exampleMessageID")
+			assert.Equal(t, test.expectedErr, err)
+			if test.expectedErr != nil && errors.Is(test.expectedErr, &api.ScanError{}) {
+				assert.ErrorIs(t, err, &api.ScanError{})
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/search"
+)
+
+// Limits of Search
+const (
+	DefaultSearchPageSize = 20
+	MaxSearchPageSize     = 100
+
+	// maxSearchScanned is the number of emails examined by a search in DynamoDB,
+	// after which the results so far are returned with a cursor to continue
+	maxSearchScanned = 1000
+	searchQueryLimit = 100
+	maxBatchGetKeys  = 100
+
+	// maxEmptyMonths is the number of consecutive months without emails after which searching stops
+	maxEmptyMonths = 12
+)
+
+// SearchInput represents the input of Search, where all the given terms must match
+type SearchInput struct {
+	Query      string `json:"q"` // matched against the subject, sender, recipients and body text
+	Subject    string `json:"subject"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Text       string `json:"text"` // body text
+	Type       string `json:"type"` // inbox (default), sent or draft
+	PageSize   int    `json:"pageSize"`
+	NextCursor string `json:"nextCursor"`
+}
+
+// SearchResult represents the result of Search, latest emails first
+type SearchResult struct {
+	Count      int    `json:"count"`
+	Items      []Item `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+}
+
+// Searcher searches the emails indexed by a search backend, see search.Client
+type Searcher interface {
+	Search(ctx context.Context, query search.Query) (*search.Result, error)
+}
+
+// Search returns the emails matching the input, excluding trashed emails.
+// Inbox emails are searched with searcher if it's not nil, otherwise emails are searched month by month in DynamoDB,
+// where terms match case-insensitively as substrings.
+func Search(ctx context.Context, client api.SearchEmailsAPI, searcher Searcher, input SearchInput) (*SearchResult, error) {
+	if input.Type == "" {
+		input.Type = EmailTypeInbox
+	}
+	if input.Type != EmailTypeInbox && input.Type != EmailTypeDraft && input.Type != EmailTypeSent {
+		return nil, api.ErrInvalidInput
+	}
+	if input.Query == "" && input.Subject == "" && input.From == "" && input.To == "" && input.Text == "" {
+		return nil, api.ErrInvalidInput
+	}
+	if input.PageSize == 0 {
+		input.PageSize = DefaultSearchPageSize
+	}
+	if input.PageSize < 0 || input.PageSize > MaxSearchPageSize {
+		return nil, api.ErrInvalidInput
+	}
+
+	if searcher != nil && input.Type == EmailTypeInbox {
+		return searchIndex(ctx, client, searcher, input)
+	}
+	return searchTable(ctx, client, input)
+}
+
+// searchIndex searches the index of the search backend, and reads the matching emails from DynamoDB,
+// so that emails deleted or trashed since they're indexed are left out
+func searchIndex(ctx context.Context, client api.BatchGetItemAPI, searcher Searcher, input SearchInput) (*SearchResult, error) {
+	offset := 0
+	if input.NextCursor != "" {
+		var err error
+		offset, err = strconv.Atoi(input.NextCursor)
+		if err != nil || offset <= 0 {
+			return nil, api.ErrInvalidInput
+		}
+	}
+	size := min(input.PageSize, search.MaxResults-offset)
+	if size <= 0 {
+		return &SearchResult{Items: []Item{}}, nil
+	}
+
+	result, err := searcher.Search(ctx, search.Query{
+		Query:   input.Query,
+		Subject: input.Subject,
+		From:    input.From,
+		To:      input.To,
+		Text:    input.Text,
+		Offset:  offset,
+		Size:    size,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := batchGetEmails(ctx, client, result.MessageIDs, "MessageID, TypeYearMonth, DateTime, Subject, #from, #to, "+
+		"Unread, TrashedTime, ThreadID, IsThreadLatest, Flagged, Labels, ArchivedTime, Stats",
+		map[string]string{"#from": "From", "#to": "To"})
+	if err != nil {
+		return nil, err
+	}
+	items := []Item{}
+	for _, messageID := range result.MessageIDs {
+		av, ok := found[messageID]
+		if !ok {
+			continue // deleted
+		}
+		if _, trashed := av["TrashedTime"]; trashed {
+			continue
+		}
+		var raw RawEmailItem
+		if err = attributevalue.UnmarshalMap(av, &raw); err != nil {
+			return nil, err
+		}
+		item, err := raw.ToEmailItem()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+
+	searchResult := &SearchResult{
+		Count: len(items),
+		Items: items,
+	}
+	next := offset + len(result.MessageIDs)
+	if len(result.MessageIDs) > 0 && next < result.Total && next < search.MaxResults {
+		searchResult.NextCursor = strconv.Itoa(next)
+		searchResult.HasMore = true
+	}
+	return searchResult, nil
+}
+
+// searchTable searches the emails of a type in DynamoDB, starting from the current month or the cursor,
+// and continuing with earlier months until the page is full or maxSearchScanned emails are examined
+//
+//gocyclo:ignore
+func searchTable(ctx context.Context, client api.SearchEmailsAPI, input SearchInput) (*SearchResult, error) {
+	year, month := getCurrentYearMonth()
+	var startKey map[string]types.AttributeValue
+	if input.NextCursor != "" {
+		cursor := &Cursor{}
+		if err := cursor.BindString(input.NextCursor); err != nil {
+			return nil, api.ErrInvalidInput
+		}
+		if cursor.QueryInfo.Type != input.Type {
+			return nil, api.ErrQueryNotMatch
+		}
+		var err error
+		year, month, err = prepareYearMonth(cursor.QueryInfo.Year, cursor.QueryInfo.Month)
+		if err != nil {
+			return nil, err
+		}
+		startKey = cursor.LastEvaluatedKey
+	}
+
+	matcher := newSearchMatcher(input)
+	items := []Item{}
+	scanned, monthScanned, emptyMonths := 0, 0, 0
+	for {
+		resp, err := client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              &env.TableName,
+			IndexName:              &env.GsiIndexName,
+			ExclusiveStartKey:      startKey,
+			KeyConditionExpression: aws.String("#tym = :val"),
+			FilterExpression:       aws.String("attribute_not_exists(TrashedTime)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":val": &types.AttributeValueMemberS{Value: input.Type + "#" + year + "-" + month},
+			},
+			ExpressionAttributeNames: map[string]string{
+				"#tym": "TypeYearMonth",
+			},
+			Limit:            aws.Int32(searchQueryLimit),
+			ScanIndexForward: aws.Bool(false),
+		})
+		if err != nil {
+			if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return nil, api.ErrTooManyRequests
+			}
+			return nil, err
+		}
+		scanned += int(resp.ScannedCount)
+		monthScanned += int(resp.ScannedCount)
+
+		var rawItems []RawEmailItem
+		if err = unmarshalListOfMaps(resp.Items, &rawItems); err != nil {
+			fmt.Printf("unmarshal failed: %v\n", err)
+			return nil, err
+		}
+
+		// the body text is read only for emails whose headers don't match all the terms
+		pending := make([][]string, len(rawItems)) // nil if the headers don't match
+		var textIDs []string
+		for i, raw := range rawItems {
+			ok, terms := matcher.matchHeaders(raw)
+			if !ok {
+				continue
+			}
+			pending[i] = terms
+			if len(terms) > 0 {
+				textIDs = append(textIDs, raw.MessageID)
+			}
+		}
+		texts, err := getTexts(ctx, client, textIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, raw := range rawItems {
+			if pending[i] == nil || !matchText(texts[raw.MessageID], pending[i]) {
+				continue
+			}
+			item, err := raw.ToEmailItem()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, *item)
+			if len(items) < input.PageSize {
+				continue
+			}
+
+			// the next page starts after this email
+			var cursor *Cursor
+			if i < len(rawItems)-1 || len(resp.LastEvaluatedKey) > 0 {
+				cursor = newSearchCursor(input.Type, year, month, indexKey(resp.Items[i]))
+			} else {
+				prevYear, prevMonth := previousYearMonth(year, month)
+				cursor = newSearchCursor(input.Type, prevYear, prevMonth, nil)
+			}
+			return newSearchResult(items, cursor)
+		}
+
+		if len(resp.LastEvaluatedKey) > 0 {
+			startKey = resp.LastEvaluatedKey
+		} else {
+			if monthScanned == 0 {
+				emptyMonths++
+			} else {
+				emptyMonths = 0
+			}
+			if emptyMonths >= maxEmptyMonths {
+				return newSearchResult(items, nil)
+			}
+			year, month = previousYearMonth(year, month)
+			startKey = nil
+			monthScanned = 0
+		}
+		if scanned >= maxSearchScanned {
+			return newSearchResult(items, newSearchCursor(input.Type, year, month, startKey))
+		}
+	}
+}
+
+func newSearchCursor(emailType, year, month string, lastEvaluatedKey map[string]types.AttributeValue) *Cursor {
+	return &Cursor{
+		QueryInfo: QueryInfo{
+			Type:  emailType,
+			Year:  year,
+			Month: month,
+			Order: "desc",
+		},
+		LastEvaluatedKey: lastEvaluatedKey,
+	}
+}
+
+func newSearchResult(items []Item, cursor *Cursor) (*SearchResult, error) {
+	result := &SearchResult{
+		Count: len(items),
+		Items: items,
+	}
+	if cursor != nil {
+		data, err := json.Marshal(cursor)
+		if err != nil {
+			return nil, err
+		}
+		result.NextCursor = strings.Trim(string(data), `"`)
+		result.HasMore = true
+	}
+	return result, nil
+}
+
+// indexKey returns the key of an item in the time index, from which a query continues
+func indexKey(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"MessageID":     item["MessageID"],
+		"TypeYearMonth": item["TypeYearMonth"],
+		"DateTime":      item["DateTime"],
+	}
+}
+
+// searchMatcher matches emails against a search in DynamoDB, case-insensitively
+type searchMatcher struct {
+	terms   []string // words of the query, each matching any of the fields
+	subject string
+	from    string
+	to      string
+	text    string
+}
+
+func newSearchMatcher(input SearchInput) searchMatcher {
+	return searchMatcher{
+		terms:   strings.Fields(strings.ToLower(input.Query)),
+		subject: strings.ToLower(input.Subject),
+		from:    strings.ToLower(input.From),
+		to:      strings.ToLower(input.To),
+		text:    strings.ToLower(input.Text),
+	}
+}
+
+// matchHeaders returns whether the subject, sender and recipients of an email match,
+// and the terms that must still be found in its body text
+func (m searchMatcher) matchHeaders(raw RawEmailItem) (bool, []string) {
+	subject := strings.ToLower(raw.Subject)
+	from := strings.ToLower(strings.Join(raw.From, " "))
+	to := strings.ToLower(strings.Join(raw.To, " "))
+	if !strings.Contains(subject, m.subject) || !strings.Contains(from, m.from) || !strings.Contains(to, m.to) {
+		return false, nil
+	}
+
+	headers := subject + "\n" + from + "\n" + to
+	pending := []string{}
+	for _, term := range m.terms {
+		if !strings.Contains(headers, term) {
+			pending = append(pending, term)
+		}
+	}
+	if m.text != "" {
+		pending = append(pending, m.text)
+	}
+	return true, pending
+}
+
+// matchText returns whether the body text contains all the terms
+func matchText(text string, terms []string) bool {
+	text = strings.ToLower(text)
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// getTexts returns the body texts of emails by their message IDs
+func getTexts(ctx context.Context, client api.BatchGetItemAPI, messageIDs []string) (map[string]string, error) {
+	found, err := batchGetEmails(ctx, client, messageIDs, "MessageID, #text", map[string]string{"#text": "Text"})
+	if err != nil {
+		return nil, err
+	}
+	texts := make(map[string]string, len(found))
+	for messageID, av := range found {
+		if text, ok := av["Text"].(*types.AttributeValueMemberS); ok {
+			texts[messageID] = text.Value
+		}
+	}
+	return texts, nil
+}
+
+// batchGetEmails returns the projected attributes of emails by their message IDs, leaving out emails that don't exist
+func batchGetEmails(ctx context.Context, client api.BatchGetItemAPI, messageIDs []string,
+	projection string, names map[string]string,
+) (map[string]map[string]types.AttributeValue, error) {
+	keys := make([]map[string]types.AttributeValue, len(messageIDs))
+	for i, messageID := range messageIDs {
+		keys[i] = map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		}
+	}
+
+	found := make(map[string]map[string]types.AttributeValue, len(messageIDs))
+	for len(keys) > 0 {
+		n := min(len(keys), maxBatchGetKeys)
+		resp, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				env.TableName: {
+					Keys:                     keys[:n],
+					ProjectionExpression:     aws.String(projection),
+					ExpressionAttributeNames: names,
+				},
+			},
+		})
+		if err != nil {
+			if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return nil, api.ErrTooManyRequests
+			}
+			return nil, err
+		}
+		keys = keys[n:]
+		if unprocessed, ok := resp.UnprocessedKeys[env.TableName]; ok {
+			keys = append(keys, unprocessed.Keys...)
+		}
+
+		for _, av := range resp.Responses[env.TableName] {
+			if messageID, ok := av["MessageID"].(*types.AttributeValueMemberS); ok {
+				found[messageID.Value] = av
+			}
+		}
+	}
+	return found, nil
+}
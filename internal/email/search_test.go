@@ -0,0 +1,161 @@
+package email
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/search"
+	"github.com/harryzcy/mailbox/internal/util/mockutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func searchItem(messageID, dateTime, subject, from string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"MessageID":     &types.AttributeValueMemberS{Value: messageID},
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2022-03"},
+		"DateTime":      &types.AttributeValueMemberS{Value: dateTime},
+		"Subject":       &types.AttributeValueMemberS{Value: subject},
+		"From":          &types.AttributeValueMemberSS{Value: []string{from}},
+	}
+}
+
+// mockBatchGetItem returns the items of the table that exist
+func mockBatchGetItem(items map[string]map[string]types.AttributeValue) func(context.Context, *dynamodb.BatchGetItemInput, ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	return func(_ context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+		var responses []map[string]types.AttributeValue
+		for _, key := range params.RequestItems[env.TableName].Keys {
+			if item, ok := items[key["MessageID"].(*types.AttributeValueMemberS).Value]; ok {
+				responses = append(responses, item)
+			}
+		}
+		return &dynamodb.BatchGetItemOutput{
+			Responses: map[string][]map[string]types.AttributeValue{env.TableName: responses},
+		}, nil
+	}
+}
+
+func TestSearch_InvalidInput(t *testing.T) {
+	tests := []SearchInput{
+		{},
+		{Query: "invoice", Type: "thread"},
+		{Query: "invoice", PageSize: MaxSearchPageSize + 1},
+		{Query: "invoice", NextCursor: "invalid"},
+	}
+	for _, input := range tests {
+		_, err := Search(context.TODO(), mockutil.MockListThreadsAPI{}, nil, input)
+		assert.Equal(t, api.ErrInvalidInput, err)
+	}
+}
+
+func TestSearch_Table(t *testing.T) {
+	now = func() time.Time { return time.Date(2022, 3, 20, 0, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() {
+		now = time.Now
+	})
+
+	queried := []string{}
+	textsRead := []string{}
+	client := mockutil.MockListThreadsAPI{
+		MockQuery: func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			typeYearMonth := params.ExpressionAttributeValues[":val"].(*types.AttributeValueMemberS).Value
+			queried = append(queried, typeYearMonth)
+			if typeYearMonth != "inbox#2022-03" {
+				return &dynamodb.QueryOutput{}, nil
+			}
+			return &dynamodb.QueryOutput{
+				Items: []map[string]types.AttributeValue{
+					searchItem("1", "15-01:01:01", "Invoice for March", "Alice <alice@example.com>"),
+					searchItem("2", "14-01:01:01", "Hello", "Bob <bob@example.com>"),
+					searchItem("3", "13-01:01:01", "Other", "Bob <bob@example.com>"),
+				},
+				ScannedCount: 3,
+			}, nil
+		},
+		MockBatchGetItem: func(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+			for _, key := range params.RequestItems[env.TableName].Keys {
+				textsRead = append(textsRead, key["MessageID"].(*types.AttributeValueMemberS).Value)
+			}
+			return mockBatchGetItem(map[string]map[string]types.AttributeValue{
+				"2": {
+					"MessageID": &types.AttributeValueMemberS{Value: "2"},
+					"Text":      &types.AttributeValueMemberS{Value: "Please find the INVOICE attached."},
+				},
+				"3": {
+					"MessageID": &types.AttributeValueMemberS{Value: "3"},
+					"Text":      &types.AttributeValueMemberS{Value: "Nothing here."},
+				},
+			})(ctx, params, optFns...)
+		},
+	}
+
+	result, err := Search(context.TODO(), client, nil, SearchInput{Query: "invoice"})
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, result.Count) {
+		assert.Equal(t, "1", result.Items[0].MessageID)
+		assert.Equal(t, "2022-03-15T01:01:01Z", result.Items[0].TimeReceived)
+		assert.Equal(t, "2", result.Items[1].MessageID)
+	}
+	assert.False(t, result.HasMore)
+	assert.Empty(t, result.NextCursor)
+	assert.Equal(t, []string{"2", "3"}, textsRead) // the subject of 1 matches
+	assert.Len(t, queried, 1+maxEmptyMonths)
+
+	// the next page starts after the last email of the page
+	result, err = Search(context.TODO(), client, nil, SearchInput{From: "bob", PageSize: 1})
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, result.Count) {
+		assert.Equal(t, "2", result.Items[0].MessageID)
+	}
+	assert.True(t, result.HasMore)
+	cursor := &Cursor{}
+	assert.NoError(t, cursor.BindString(result.NextCursor))
+	assert.Equal(t, QueryInfo{Type: "inbox", Year: "2022", Month: "03", Order: "desc"}, cursor.QueryInfo)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "2"}, cursor.LastEvaluatedKey["MessageID"])
+
+	_, err = Search(context.TODO(), client, nil, SearchInput{From: "bob", Type: "sent", NextCursor: result.NextCursor})
+	assert.Equal(t, api.ErrQueryNotMatch, err)
+}
+
+type mockSearcher func(ctx context.Context, query search.Query) (*search.Result, error)
+
+func (m mockSearcher) Search(ctx context.Context, query search.Query) (*search.Result, error) {
+	return m(ctx, query)
+}
+
+func TestSearch_Index(t *testing.T) {
+	trashed := searchItem("3", "13-01:01:01", "Invoice", "bob@example.com")
+	trashed["TrashedTime"] = &types.AttributeValueMemberS{Value: "2022-03-14T00:00:00Z"}
+	client := mockutil.MockListThreadsAPI{
+		MockBatchGetItem: mockBatchGetItem(map[string]map[string]types.AttributeValue{
+			"1": searchItem("1", "15-01:01:01", "Invoice", "alice@example.com"),
+			"3": trashed,
+		}),
+	}
+
+	var query search.Query
+	searcher := mockSearcher(func(_ context.Context, q search.Query) (*search.Result, error) {
+		query = q
+		return &search.Result{MessageIDs: []string{"1", "2", "3"}, Total: 5}, nil
+	})
+
+	result, err := Search(context.TODO(), client, searcher, SearchInput{Query: "invoice", PageSize: 3, NextCursor: "6"})
+	assert.NoError(t, err)
+	assert.Equal(t, search.Query{Query: "invoice", Offset: 6, Size: 3}, query)
+	if assert.Equal(t, 1, result.Count) { // 2 is deleted, 3 is trashed
+		assert.Equal(t, "1", result.Items[0].MessageID)
+	}
+	assert.False(t, result.HasMore)
+
+	searcher = func(_ context.Context, q search.Query) (*search.Result, error) {
+		return &search.Result{MessageIDs: []string{"1", "2", "3"}, Total: 5}, nil
+	}
+	result, err = Search(context.TODO(), client, searcher, SearchInput{Query: "invoice", PageSize: 3})
+	assert.NoError(t, err)
+	assert.True(t, result.HasMore)
+	assert.Equal(t, "3", result.NextCursor)
+}
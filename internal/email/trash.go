@@ -10,12 +10,16 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/counter"
 	"github.com/harryzcy/mailbox/internal/env"
 )
 
-// Trash marks an email as trashed
-func Trash(ctx context.Context, client api.UpdateItemAPI, messageID string) error {
-	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+// Trash marks an email as trashed.
+// An InvalidTransitionError is returned if the email is a draft, already trashed, or purged.
+// If TRASH_RETENTION_DAYS is set, the email expires and is purged by DynamoDB after that many days in the trash.
+func Trash(ctx context.Context, client api.UpdateCountedEmailAPI, messageID string) error {
+	trashedTime := time.Now().UTC()
+	input := &dynamodb.UpdateItemInput{
 		TableName: aws.String(env.TableName),
 		Key: map[string]types.AttributeValue{
 			"MessageID": &types.AttributeValueMemberS{Value: messageID},
@@ -23,14 +27,18 @@ func Trash(ctx context.Context, client api.UpdateItemAPI, messageID string) erro
 		UpdateExpression:    aws.String("SET TrashedTime = :val1"),
 		ConditionExpression: aws.String("attribute_not_exists(TrashedTime) AND NOT begins_with(TypeYearMonth, :v_type)"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":val1":   &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":val1":   &types.AttributeValueMemberS{Value: trashedTime.Format(time.RFC3339)},
 			":v_type": &types.AttributeValueMemberS{Value: EmailTypeDraft},
 		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+	err := transitionEmail(opTrash, func() error {
+		return updateEmail(ctx, client, input, messageID, func(state counter.State) counter.State {
+			state.Trashed = true
+			return state
+		})
 	})
 	if err != nil {
-		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
-			return &api.NotTrashedError{Type: "email"}
-		}
 		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
 			return api.ErrTooManyRequests
 		}
@@ -38,6 +46,11 @@ func Trash(ctx context.Context, client api.UpdateItemAPI, messageID string) erro
 		return err
 	}
 
+	// the email is trashed either way, it's only kept in the trash until deleted
+	if err := setTrashExpiry(ctx, client, messageID, trashedTime); err != nil {
+		fmt.Printf("failed to set trash expiry: %v\n", err)
+	}
+
 	fmt.Println("trash method finished successfully")
 	return nil
 }
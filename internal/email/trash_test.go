@@ -2,6 +2,7 @@ package email
 
 import (
 	"context"
+	"errors"
 	"strconv"
 	"strings"
 	"testing"
@@ -18,14 +19,24 @@ func (m mockUpdateItemAPI) UpdateItem(ctx context.Context, params *dynamodb.Upda
 	return m(ctx, params, optFns...)
 }
 
+// GetItem is only called when counters are enabled
+func (m mockUpdateItemAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return nil, errors.New("unexpected GetItem call")
+}
+
+// TransactWriteItems is only called when counters are enabled
+func (m mockUpdateItemAPI) TransactWriteItems(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return nil, errors.New("unexpected TransactWriteItems call")
+}
+
 func TestTrash(t *testing.T) {
 	tests := []struct {
-		client      func(t *testing.T) api.UpdateItemAPI
+		client      func(t *testing.T) api.UpdateCountedEmailAPI
 		messageID   string
 		expectedErr error
 	}{
 		{
-			client: func(t *testing.T) api.UpdateItemAPI {
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					assert.Len(t, params.Key, 1)
@@ -49,17 +60,33 @@ func TestTrash(t *testing.T) {
 			messageID: "exampleMessageID",
 		},
 		{
-			client: func(t *testing.T) api.UpdateItemAPI {
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					return &dynamodb.UpdateItemOutput{}, &types.ConditionalCheckFailedException{}
 				})
 			},
 			messageID:   "",
-			expectedErr: &api.NotTrashedError{Type: "email"},
+			expectedErr: &api.InvalidTransitionError{From: StatePurged, To: StateTrashed},
+		},
+		{
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
+				return mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					t.Helper()
+					assert.Equal(t, types.ReturnValuesOnConditionCheckFailureAllOld, params.ReturnValuesOnConditionCheckFailure)
+					return &dynamodb.UpdateItemOutput{}, &types.ConditionalCheckFailedException{
+						Item: map[string]types.AttributeValue{
+							"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2023-05"},
+							"TrashedTime":   &types.AttributeValueMemberS{Value: "2023-05-02T03:04:05Z"},
+						},
+					}
+				})
+			},
+			messageID:   "exampleMessageID",
+			expectedErr: &api.InvalidTransitionError{From: StateTrashed, To: StateTrashed},
 		},
 		{
-			client: func(t *testing.T) api.UpdateItemAPI {
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					return &dynamodb.UpdateItemOutput{}, api.ErrNotFound
@@ -9,27 +9,33 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/counter"
 	"github.com/harryzcy/mailbox/internal/env"
 )
 
-// Untrash marks an trashed email as not trashed
-func Untrash(ctx context.Context, client api.UpdateItemAPI, messageID string) error {
-	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+// Untrash marks an trashed email as not trashed, moving it back to the state it was trashed from.
+// An InvalidTransitionError is returned if the email isn't trashed, e.g. when it's already purged.
+// Its trash expiry is removed along with it.
+func Untrash(ctx context.Context, client api.UpdateCountedEmailAPI, messageID string) error {
+	input := &dynamodb.UpdateItemInput{
 		TableName: aws.String(env.TableName),
 		Key: map[string]types.AttributeValue{
 			"MessageID": &types.AttributeValueMemberS{Value: messageID},
 		},
-		UpdateExpression:    aws.String("REMOVE TrashedTime"),
+		UpdateExpression:    aws.String("REMOVE TrashedTime, " + ExpiresAtAttribute),
 		ConditionExpression: aws.String("attribute_exists(TrashedTime) AND NOT begins_with(TypeYearMonth, :v_type)"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":v_type": &types.AttributeValueMemberS{Value: EmailTypeDraft},
 		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+	err := transitionEmail(opUntrash, func() error {
+		return updateEmail(ctx, client, input, messageID, func(state counter.State) counter.State {
+			state.Trashed = false
+			return state
+		})
 	})
 	if err != nil {
-		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
-			return &api.NotTrashedError{Type: "email"}
-		}
-
 		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
 			return api.ErrTooManyRequests
 		}
@@ -13,12 +13,12 @@ import (
 
 func TestUntrash(t *testing.T) {
 	tests := []struct {
-		client      func(t *testing.T) api.UpdateItemAPI
+		client      func(t *testing.T) api.UpdateCountedEmailAPI
 		messageID   string
 		expectedErr error
 	}{
 		{
-			client: func(t *testing.T) api.UpdateItemAPI {
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					assert.Len(t, params.Key, 1)
@@ -27,7 +27,7 @@ func TestUntrash(t *testing.T) {
 						params.Key["MessageID"].(*types.AttributeValueMemberS).Value,
 						"exampleMessageID",
 					)
-					assert.Equal(t, "REMOVE TrashedTime", *params.UpdateExpression)
+					assert.Equal(t, "REMOVE TrashedTime, ExpiresAt", *params.UpdateExpression)
 					assert.Equal(t, "attribute_exists(TrashedTime) AND NOT begins_with(TypeYearMonth, :v_type)",
 						*params.ConditionExpression)
 
@@ -37,17 +37,31 @@ func TestUntrash(t *testing.T) {
 			messageID: "exampleMessageID",
 		},
 		{
-			client: func(t *testing.T) api.UpdateItemAPI {
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					return &dynamodb.UpdateItemOutput{}, &types.ConditionalCheckFailedException{}
 				})
 			},
 			messageID:   "",
-			expectedErr: &api.NotTrashedError{Type: "email"},
+			expectedErr: &api.InvalidTransitionError{From: StatePurged, To: StateInbox},
 		},
 		{
-			client: func(t *testing.T) api.UpdateItemAPI {
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
+				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					t.Helper()
+					return &dynamodb.UpdateItemOutput{}, &types.ConditionalCheckFailedException{
+						Item: map[string]types.AttributeValue{
+							"TypeYearMonth": &types.AttributeValueMemberS{Value: "sent#2023-05"},
+						},
+					}
+				})
+			},
+			messageID:   "exampleMessageID",
+			expectedErr: &api.InvalidTransitionError{From: StateSent, To: StateSent},
+		},
+		{
+			client: func(t *testing.T) api.UpdateCountedEmailAPI {
 				return mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 					t.Helper()
 					return &dynamodb.UpdateItemOutput{}, api.ErrNotFound
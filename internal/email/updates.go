@@ -0,0 +1,228 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// Limits of the updates endpoint
+const (
+	DefaultUpdatesLimit = 25
+	MaxUpdatesLimit     = 100
+
+	// DefaultUpdatesSince is how far back updates are returned when since is not provided
+	DefaultUpdatesSince = 24 * time.Hour
+	// MaxUpdatesLookback is how far back since can be
+	MaxUpdatesLookback = 90 * 24 * time.Hour
+)
+
+// UpdatesInput represents the input of Updates method
+type UpdatesInput struct {
+	Type  string `json:"type"`  // inbox (default) or sent
+	Since string `json:"since"` // RFC3339 time, only emails after it are returned
+	Limit int    `json:"limit"` // 0 means DefaultUpdatesLimit
+}
+
+// Update is a flat representation of an email, which is friendly to polling triggers of no-code platforms
+type Update struct {
+	ID        string `json:"id"` // deduplication key, the same email always has the same id
+	MessageID string `json:"messageID"`
+	Type      string `json:"type"`
+	Time      string `json:"time"` // received time for inbox emails, sent time for sent emails
+	Subject   string `json:"subject"`
+	From      string `json:"from"` // comma separated addresses
+	To        string `json:"to"`   // comma separated addresses
+	ThreadID  string `json:"threadID"`
+	Unread    bool   `json:"unread"`
+	Flagged   bool   `json:"flagged"`
+	Labels    string `json:"labels"` // comma separated labels
+}
+
+// UpdatesResult represents the result of Updates method
+type UpdatesResult struct {
+	Count     int      `json:"count"`
+	Items     []Update `json:"items"`
+	NextSince string   `json:"nextSince"` // since value of the next poll
+	HasMore   bool     `json:"hasMore"`
+}
+
+// Updates returns emails received or sent after the given time, in ascending order.
+// Polling again with NextSince returns the following emails without gaps or duplicates.
+func Updates(ctx context.Context, client api.QueryAPI, input UpdatesInput) (*UpdatesResult, error) {
+	if input.Type == "" {
+		input.Type = EmailTypeInbox
+	}
+	if input.Type != EmailTypeInbox && input.Type != EmailTypeSent {
+		return nil, api.ErrInvalidInput
+	}
+	if input.Limit == 0 {
+		input.Limit = DefaultUpdatesLimit
+	}
+	if input.Limit < 0 || input.Limit > MaxUpdatesLimit {
+		return nil, api.ErrInvalidInput
+	}
+
+	current := now()
+	since := current.Add(-DefaultUpdatesSince)
+	if input.Since != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, input.Since)
+		if err != nil {
+			return nil, api.ErrInvalidInput
+		}
+	}
+	if since.Before(current.Add(-MaxUpdatesLookback)) {
+		return nil, api.ErrInvalidInput
+	}
+
+	// one more item is queried to know whether there are more
+	items, err := queryUpdates(ctx, client, input.Type, since, current, input.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(items) > input.Limit
+	if hasMore {
+		items = trimTimeGroup(items[:input.Limit], itemTime(items[input.Limit]))
+	}
+
+	result := &UpdatesResult{
+		Count:     len(items),
+		Items:     make([]Update, len(items)),
+		NextSince: since.Format(time.RFC3339Nano),
+		HasMore:   hasMore,
+	}
+	for i, item := range items {
+		result.Items[i] = newUpdate(item)
+	}
+	if len(items) > 0 {
+		result.NextSince = result.Items[len(items)-1].Time
+	}
+	return result, nil
+}
+
+// queryUpdates queries the partitions from the month of since to the current month,
+// until limit items after since are found
+func queryUpdates(ctx context.Context, client api.QueryAPI, emailType string, since, current time.Time, limit int) ([]Item, error) {
+	loc := format.BucketLocation()
+	year, month := since.In(loc).Format("2006"), since.In(loc).Format("01")
+	currentYear, currentMonth := current.In(loc).Format("2006"), current.In(loc).Format("01")
+
+	// keys at the same millisecond as since are excluded, since '~' sorts after the tiebreaker
+	sinceKey, _, _ := strings.Cut(format.DateTime(since, ""), "#")
+	sinceKey += "#~"
+
+	items := []Item{}
+	first := true
+	for year+month <= currentYear+currentMonth {
+		queryInput := &dynamodb.QueryInput{
+			TableName:              &env.TableName,
+			IndexName:              &env.GsiIndexName,
+			KeyConditionExpression: aws.String("#tym = :val"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":val": &types.AttributeValueMemberS{Value: emailType + "#" + year + "-" + month},
+			},
+			ExpressionAttributeNames: map[string]string{
+				"#tym": "TypeYearMonth",
+			},
+			ScanIndexForward: aws.Bool(true),
+		}
+		if first {
+			// only the first partition contains emails before since
+			queryInput.KeyConditionExpression = aws.String("#tym = :val AND #dt > :since")
+			queryInput.ExpressionAttributeValues[":since"] = &types.AttributeValueMemberS{Value: sinceKey}
+			queryInput.ExpressionAttributeNames["#dt"] = "DateTime"
+		}
+
+		for {
+			queryInput.Limit = aws.Int32(int32(limit - len(items)))
+			fmt.Println("querying updates for TypeYearMonth:", year+"-"+month)
+			resp, err := client.Query(ctx, queryInput)
+			if err != nil {
+				if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+					return nil, api.ErrTooManyRequests
+				}
+				return nil, err
+			}
+
+			var rawItems []RawEmailItem
+			err = unmarshalListOfMaps(resp.Items, &rawItems)
+			if err != nil {
+				fmt.Printf("unmarshal failed: %v\n", err)
+				return nil, err
+			}
+			for _, rawItem := range rawItems {
+				item, err := rawItem.ToEmailItem()
+				if err != nil {
+					fmt.Printf("converting to time index failed: %v\n", err)
+					return nil, err
+				}
+				items = append(items, *item)
+			}
+
+			if len(items) >= limit {
+				return items, nil
+			}
+			if len(resp.LastEvaluatedKey) == 0 {
+				break
+			}
+			queryInput.ExclusiveStartKey = resp.LastEvaluatedKey
+		}
+
+		year, month = nextYearMonth(year, month)
+		first = false
+	}
+	return items, nil
+}
+
+// trimTimeGroup drops the trailing items with the same time as next, the first item after the page,
+// so that they are returned together by the next poll. If all items have the same time, they are kept.
+func trimTimeGroup(items []Item, next time.Time) []Item {
+	end := len(items)
+	for end > 0 && itemTime(items[end-1]).Equal(next) {
+		end--
+	}
+	if end == 0 {
+		return items
+	}
+	return items[:end]
+}
+
+func newUpdate(item Item) Update {
+	update := Update{
+		ID:        item.MessageID,
+		MessageID: item.MessageID,
+		Type:      item.Type,
+		Time:      item.TimeReceived,
+		Subject:   item.Subject,
+		From:      strings.Join(item.From, ", "),
+		To:        strings.Join(item.To, ", "),
+		ThreadID:  item.ThreadID,
+		Unread:    item.Unread != nil && *item.Unread,
+		Flagged:   item.Flagged,
+		Labels:    strings.Join(item.Labels, ", "),
+	}
+	if item.Type == EmailTypeSent {
+		update.Time = item.TimeSent
+	}
+	return update
+}
+
+// nextYearMonth returns the year and month after the given 4 digit year and 2 digit month
+func nextYearMonth(year, month string) (string, string) {
+	y, _ := strconv.Atoi(year)
+	m, _ := strconv.Atoi(month)
+	t := time.Date(y, time.Month(m)+1, 1, 0, 0, 0, 0, time.UTC)
+	return t.Format("2006"), t.Format("01")
+}
@@ -0,0 +1,158 @@
+package email
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdates(t *testing.T) {
+	now = func() time.Time { return time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC) }
+	defer func() {
+		now = time.Now // cleanup
+	}()
+
+	partitions := map[string][]string{ // TypeYearMonth -> MessageID, in ascending order
+		"inbox#2022-02": {"f1", "f2"},
+		"inbox#2022-03": {"m1", "m2", "m3"},
+	}
+	dateTimes := map[string]string{
+		"f1": "20-10:00:00.000#00000001",
+		"f2": "27-10:00:00.000#00000002",
+		"m1": "01-10:00:00.000#00000003",
+		"m2": "01-11:00:00.000#00000004",
+		"m3": "01-11:00:00.000#00000005",
+	}
+	var queried []string
+	client := mockQueryAPI(func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+		assert.True(t, *params.ScanIndexForward)
+		typeYearMonth := params.ExpressionAttributeValues[":val"].(*types.AttributeValueMemberS).Value
+		queried = append(queried, typeYearMonth)
+
+		output := &dynamodb.QueryOutput{}
+		for _, id := range partitions[typeYearMonth] {
+			if since, ok := params.ExpressionAttributeValues[":since"]; ok {
+				assert.Equal(t, "#tym = :val AND #dt > :since", *params.KeyConditionExpression)
+				if dateTimes[id] <= since.(*types.AttributeValueMemberS).Value {
+					continue
+				}
+			}
+			if len(output.Items) == int(*params.Limit) {
+				break
+			}
+			output.Items = append(output.Items, map[string]types.AttributeValue{
+				"MessageID":     &types.AttributeValueMemberS{Value: id},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: typeYearMonth},
+				"DateTime":      &types.AttributeValueMemberS{Value: dateTimes[id]},
+				"Subject":       &types.AttributeValueMemberS{Value: "subject " + id},
+			})
+		}
+		return output, nil
+	})
+
+	tests := []struct {
+		input           UpdatesInput
+		expectedQueried []string
+		expectedIDs     []string
+		expectedSince   string
+		expectedHasMore bool
+	}{
+		{
+			// since defaults to a day ago
+			input:           UpdatesInput{},
+			expectedQueried: []string{"inbox#2022-03"},
+			expectedIDs:     []string{"m1", "m2", "m3"},
+			expectedSince:   "2022-03-01T11:00:00Z",
+		},
+		{
+			input:           UpdatesInput{Since: "2022-02-20T10:00:00Z"},
+			expectedQueried: []string{"inbox#2022-02", "inbox#2022-03"},
+			expectedIDs:     []string{"f2", "m1", "m2", "m3"},
+			expectedSince:   "2022-03-01T11:00:00Z",
+		},
+		{
+			// the page doesn't split emails with the same time
+			input:           UpdatesInput{Since: "2022-02-20T09:00:00Z", Limit: 4},
+			expectedQueried: []string{"inbox#2022-02", "inbox#2022-03"},
+			expectedIDs:     []string{"f1", "f2", "m1"},
+			expectedSince:   "2022-03-01T10:00:00Z",
+			expectedHasMore: true,
+		},
+		{
+			input:           UpdatesInput{Since: "2022-03-01T11:00:00Z"},
+			expectedQueried: []string{"inbox#2022-03"},
+			expectedIDs:     []string{},
+			expectedSince:   "2022-03-01T11:00:00Z",
+		},
+		{
+			input:           UpdatesInput{Type: "sent", Since: "2022-03-01T11:00:00Z"},
+			expectedQueried: []string{"sent#2022-03"},
+			expectedIDs:     []string{},
+			expectedSince:   "2022-03-01T11:00:00Z",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			queried = nil
+			result, err := Updates(context.TODO(), client, test.input)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expectedQueried, queried)
+
+			ids := []string{}
+			for _, item := range result.Items {
+				assert.Equal(t, item.MessageID, item.ID)
+				assert.Equal(t, "subject "+item.ID, item.Subject)
+				ids = append(ids, item.ID)
+			}
+			assert.Equal(t, test.expectedIDs, ids)
+			assert.Equal(t, len(test.expectedIDs), result.Count)
+			assert.Equal(t, test.expectedSince, result.NextSince)
+			assert.Equal(t, test.expectedHasMore, result.HasMore)
+		})
+	}
+}
+
+func TestUpdates_InvalidInput(t *testing.T) {
+	now = func() time.Time { return time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC) }
+	defer func() {
+		now = time.Now // cleanup
+	}()
+
+	tests := []UpdatesInput{
+		{Type: "draft"},
+		{Limit: -1},
+		{Limit: MaxUpdatesLimit + 1},
+		{Since: "yesterday"},
+		{Since: "2021-01-01T00:00:00Z"}, // beyond MaxUpdatesLookback
+	}
+	for i, input := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			_, err := Updates(context.TODO(), nil, input)
+			assert.Equal(t, api.ErrInvalidInput, err)
+		})
+	}
+}
+
+func TestNextYearMonth(t *testing.T) {
+	tests := []struct {
+		year, month                 string
+		expectedYear, expectedMonth string
+	}{
+		{"2022", "03", "2022", "04"},
+		{"2022", "12", "2023", "01"},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			year, month := nextYearMonth(test.year, test.month)
+			assert.Equal(t, test.expectedYear, year)
+			assert.Equal(t, test.expectedMonth, month)
+		})
+	}
+}
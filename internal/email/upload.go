@@ -0,0 +1,115 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/attachment"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/env"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+)
+
+const (
+	// MaxDraftUploads is the maximum number of files uploaded to a draft with CreateUpload
+	MaxDraftUploads = 20
+	// maxUploadFilenameLength is the maximum length of the filename of an upload, in characters
+	maxUploadFilenameLength = 255
+)
+
+// UploadInput is a file to upload to a draft
+type UploadInput struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+}
+
+// DraftUpload is a pre-signed POST of a file of a draft, and the file as it's attached to the draft
+type DraftUpload struct {
+	*storage.Upload
+	File UploadedFile `json:"file"`
+}
+
+// validate checks that the filename is a name without directories, and that the file isn't dangerous to send
+func (input UploadInput) validate() error {
+	if input.Filename == "" || utf8.RuneCountInString(input.Filename) > maxUploadFilenameLength ||
+		strings.ContainsAny(input.Filename, `/\`) || strings.ContainsFunc(input.Filename, func(r rune) bool { return r < ' ' }) {
+		return api.ErrInvalidInput
+	}
+	if _, _, err := mime.ParseMediaType(input.ContentType); err != nil {
+		return api.ErrInvalidInput
+	}
+	if attachment.IsDangerous(mailboxTypes.File{Filename: input.Filename, ContentType: input.ContentType}) {
+		return api.ErrUploadNotAllowed
+	}
+	return nil
+}
+
+// CreateUpload creates a pre-signed POST that uploads a file of a draft to S3, and adds the file to the uploads of the draft,
+// so that it's attached when the draft is sent. The upload is limited to the content type and to UPLOAD_MAX_SIZE.
+// Executables, scripts and macro-enabled documents are rejected with api.ErrUploadNotAllowed.
+// api.ErrNotFound is returned if the draft doesn't exist, api.ErrEmailIsNotDraft if the email isn't a draft,
+// and api.ErrTooManyUploads if the draft has MaxDraftUploads uploads.
+func CreateUpload(ctx context.Context, client api.UpdateItemAPI, provider aws.CredentialsProvider, messageID string, input UploadInput) (*DraftUpload, error) {
+	if !strings.HasPrefix(messageID, "draft-") {
+		return nil, api.ErrEmailIsNotDraft
+	}
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+
+	upload, err := storage.PresignUpload(ctx, provider, input.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	file := UploadedFile{
+		UploadID:    upload.UploadID,
+		Filename:    input.Filename,
+		ContentType: input.ContentType,
+	}
+	av, err := attributevalue.Marshal(file)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression:    aws.String("SET Uploads = list_append(if_not_exists(Uploads, :empty), :uploads)"),
+		ConditionExpression: aws.String("begins_with(TypeYearMonth, :v_draft) AND (attribute_not_exists(Uploads) OR size(Uploads) < :max)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":empty":   &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+			":uploads": &types.AttributeValueMemberL{Value: []types.AttributeValue{av}},
+			":v_draft": &types.AttributeValueMemberS{Value: EmailTypeDraft + "#"},
+			":max":     &types.AttributeValueMemberN{Value: strconv.Itoa(MaxDraftUploads)},
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		if condErr := new(types.ConditionalCheckFailedException); errors.As(err, &condErr) {
+			switch StateOf(condErr.Item) {
+			case StatePurged:
+				return nil, api.ErrNotFound
+			case StateDraft:
+				return nil, api.ErrTooManyUploads
+			default:
+				return nil, api.ErrEmailIsNotDraft
+			}
+		}
+		return nil, err
+	}
+	return &DraftUpload{Upload: upload, File: file}, nil
+}
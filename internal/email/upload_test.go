@@ -0,0 +1,114 @@
+package email
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+func TestUploadInput_Validate(t *testing.T) {
+	tests := []struct {
+		input    UploadInput
+		expected error
+	}{
+		{input: UploadInput{Filename: "report.pdf", ContentType: "application/pdf"}},
+		{input: UploadInput{Filename: "Résumé 2024.docx", ContentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"}},
+		{input: UploadInput{ContentType: "application/pdf"}, expected: api.ErrInvalidInput},
+		{input: UploadInput{Filename: "../report.pdf", ContentType: "application/pdf"}, expected: api.ErrInvalidInput},
+		{input: UploadInput{Filename: "report\n.pdf", ContentType: "application/pdf"}, expected: api.ErrInvalidInput},
+		{input: UploadInput{Filename: "report.pdf"}, expected: api.ErrInvalidInput},
+		{input: UploadInput{Filename: "setup.exe", ContentType: "application/octet-stream"}, expected: api.ErrUploadNotAllowed},
+		{input: UploadInput{Filename: "budget.xlsm", ContentType: "application/octet-stream"}, expected: api.ErrUploadNotAllowed},
+		{input: UploadInput{Filename: "script", ContentType: "application/javascript"}, expected: api.ErrUploadNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.input.Filename, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.input.validate())
+		})
+	}
+}
+
+func TestCreateUpload(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.Region = "us-west-2"
+	defer func() {
+		env.S3Bucket = ""
+		env.Region = ""
+	}()
+	provider := credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", "")
+	input := UploadInput{Filename: "report.pdf", ContentType: "application/pdf"}
+
+	var uploads []types.AttributeValue
+	client := mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+		assert.Equal(t, "draft-example", params.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+		assert.Equal(t, "20", params.ExpressionAttributeValues[":max"].(*types.AttributeValueMemberN).Value)
+		uploads = append(uploads, params.ExpressionAttributeValues[":uploads"].(*types.AttributeValueMemberL).Value...)
+		return &dynamodb.UpdateItemOutput{}, nil
+	})
+
+	result, err := CreateUpload(context.TODO(), client, provider, "draft-example", input)
+	assert.Nil(t, err)
+	assert.True(t, storage.ValidUploadID(result.UploadID))
+	assert.Equal(t, "application/pdf", result.Fields["Content-Type"])
+	assert.Equal(t, UploadedFile{UploadID: result.UploadID, Filename: "report.pdf", ContentType: "application/pdf"}, result.File)
+	assert.Equal(t, []types.AttributeValue{
+		&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"UploadID":    &types.AttributeValueMemberS{Value: result.UploadID},
+			"Filename":    &types.AttributeValueMemberS{Value: "report.pdf"},
+			"ContentType": &types.AttributeValueMemberS{Value: "application/pdf"},
+		}},
+	}, uploads)
+
+	_, err = CreateUpload(context.TODO(), client, provider, "exampleMessageID", input)
+	assert.Equal(t, api.ErrEmailIsNotDraft, err)
+	_, err = CreateUpload(context.TODO(), client, provider, "draft-example", UploadInput{Filename: "run.sh", ContentType: "text/plain"})
+	assert.Equal(t, api.ErrUploadNotAllowed, err)
+	assert.Len(t, uploads, 1)
+}
+
+func TestCreateUpload_ConditionFailed(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	env.Region = "us-west-2"
+	defer func() {
+		env.S3Bucket = ""
+		env.Region = ""
+	}()
+	provider := credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", "")
+	input := UploadInput{Filename: "report.pdf", ContentType: "application/pdf"}
+
+	tests := []struct {
+		item     map[string]types.AttributeValue
+		expected error
+	}{
+		{item: nil, expected: api.ErrNotFound},
+		{
+			item: map[string]types.AttributeValue{
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "draft#2024-05"},
+			},
+			expected: api.ErrTooManyUploads,
+		},
+		{
+			item: map[string]types.AttributeValue{
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "sent#2024-05"},
+			},
+			expected: api.ErrEmailIsNotDraft,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expected.Error(), func(t *testing.T) {
+			client := mockUpdateItemAPI(func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+				return nil, &types.ConditionalCheckFailedException{Item: test.item}
+			})
+			_, err := CreateUpload(context.TODO(), client, provider, "draft-example", input)
+			assert.Equal(t, test.expected, err)
+		})
+	}
+}
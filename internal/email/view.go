@@ -0,0 +1,136 @@
+package email
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/htmlutil"
+)
+
+// Views of the content of an email, see RenderView
+const (
+	ViewRaw       = "raw"       // HTML as it's stored
+	ViewSanitized = "sanitized" // HTML without scripts, event handlers, embedded documents, forms, and AMP components
+	ViewText      = "text"      // text only, generated from the HTML if the email has no text
+	ViewReader    = "reader"    // main content of the HTML, without boilerplate such as headers and footers
+	ViewDark      = "dark"      // sanitized HTML with light backgrounds darkened, for dark mode clients
+)
+
+// viewRenderers compute the views of the HTML of an email
+var viewRenderers = map[string]func(html string) (string, error){
+	ViewSanitized: htmlutil.Sanitize,
+	ViewText:      htmlutil.GenerateText,
+	ViewReader:    htmlutil.ReaderMode,
+	ViewDark:      htmlutil.DarkMode,
+}
+
+// maxCachedViewSize is the size in bytes of the largest view cached on the item, to stay clear of the item size limit
+const maxCachedViewSize = 64 << 10
+
+// RenderedViews caches the views of an email on its item.
+// They are valid as long as the HTML of the email has the same hash, so they don't need to be cleared when it's changed.
+type RenderedViews struct {
+	Hash  string
+	Views map[string]string
+}
+
+// IsValidView reports whether view is one of the views of RenderView, where empty is ViewRaw
+func IsValidView(view string) bool {
+	_, ok := viewRenderers[view]
+	return ok || view == "" || view == ViewRaw
+}
+
+// RenderView replaces the content of an email with the given view.
+// Views are computed when they are first requested, and cached on the item.
+func RenderView(ctx context.Context, client api.UpdateItemAPI, result *GetResult, view string) error {
+	if !IsValidView(view) {
+		return api.ErrInvalidView
+	}
+	if view == "" || view == ViewRaw {
+		return nil
+	}
+	result.View = view
+	if view == ViewText {
+		defer func() { result.HTML = "" }()
+		if result.Text != "" {
+			return nil
+		}
+	}
+	if result.HTML == "" {
+		// e.g. text-only emails, or large bodies that are only available by streaming
+		return nil
+	}
+
+	hash := contentHash(result.HTML)
+	if cached := result.RenderedViews; cached != nil && cached.Hash == hash {
+		if content, ok := cached.Views[view]; ok {
+			setView(result, view, content)
+			return nil
+		}
+	}
+
+	content, err := viewRenderers[view](result.HTML)
+	if err != nil {
+		return err
+	}
+	if len(content) <= maxCachedViewSize {
+		cacheView(ctx, client, result, hash, view, content)
+	}
+	setView(result, view, content)
+	return nil
+}
+
+func setView(result *GetResult, view, content string) {
+	if view == ViewText {
+		result.Text = content
+		return
+	}
+	result.HTML = content
+}
+
+// cacheView stores a view on the item, along with the other views of the same content.
+// Failures are only logged, since the view is computed again on the next request.
+func cacheView(ctx context.Context, client api.UpdateItemAPI, result *GetResult, hash, view, content string) {
+	views := map[string]string{view: content}
+	if cached := result.RenderedViews; cached != nil && cached.Hash == hash {
+		for k, v := range cached.Views {
+			if _, ok := views[k]; !ok {
+				views[k] = v
+			}
+		}
+	}
+	value, err := attributevalue.Marshal(RenderedViews{Hash: hash, Views: views})
+	if err != nil {
+		fmt.Printf("unable to marshal views: %v\n", err)
+		return
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: result.MessageID},
+		},
+		UpdateExpression:    aws.String("SET RenderedViews = :views"),
+		ConditionExpression: aws.String("attribute_exists(MessageID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":views": value,
+		},
+	})
+	if err != nil {
+		fmt.Printf("unable to cache %s view: %v\n", view, err)
+	}
+}
+
+// contentHash returns the hash of the HTML of an email, which the views are computed from
+func contentHash(html string) string {
+	sum := sha256.Sum256([]byte(html))
+	return hex.EncodeToString(sum[:])
+}
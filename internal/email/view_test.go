@@ -0,0 +1,95 @@
+package email
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderView(t *testing.T) {
+	html := `<p onclick="alert(1)">Hello</p>`
+	sanitized := `<html><head></head><body><p>Hello</p></body></html>`
+	tests := []struct {
+		result      *GetResult
+		view        string
+		expected    *GetResult
+		cached      bool // whether the view is written to the item
+		expectedErr error
+	}{
+		{
+			result:   &GetResult{MessageID: "exampleMessageID", HTML: html},
+			view:     "",
+			expected: &GetResult{MessageID: "exampleMessageID", HTML: html},
+		},
+		{
+			result:   &GetResult{MessageID: "exampleMessageID", HTML: html},
+			view:     ViewSanitized,
+			expected: &GetResult{MessageID: "exampleMessageID", HTML: sanitized, View: ViewSanitized},
+			cached:   true,
+		},
+		{
+			result: &GetResult{MessageID: "exampleMessageID", HTML: html, RenderedViews: &RenderedViews{
+				Hash:  contentHash(html),
+				Views: map[string]string{ViewSanitized: "cached"},
+			}},
+			view: ViewSanitized,
+			expected: &GetResult{MessageID: "exampleMessageID", HTML: "cached", View: ViewSanitized, RenderedViews: &RenderedViews{
+				Hash:  contentHash(html),
+				Views: map[string]string{ViewSanitized: "cached"},
+			}},
+		},
+		{
+			// the HTML is changed after the view is cached
+			result: &GetResult{MessageID: "exampleMessageID", HTML: html, RenderedViews: &RenderedViews{
+				Hash:  contentHash("old"),
+				Views: map[string]string{ViewSanitized: "cached"},
+			}},
+			view: ViewSanitized,
+			expected: &GetResult{MessageID: "exampleMessageID", HTML: sanitized, View: ViewSanitized, RenderedViews: &RenderedViews{
+				Hash:  contentHash("old"),
+				Views: map[string]string{ViewSanitized: "cached"},
+			}},
+			cached: true,
+		},
+		{
+			result:   &GetResult{MessageID: "exampleMessageID", Text: "text", HTML: html},
+			view:     ViewText,
+			expected: &GetResult{MessageID: "exampleMessageID", Text: "text", View: ViewText},
+		},
+		{
+			result:   &GetResult{MessageID: "exampleMessageID", HTML: "<p>Title</p>"},
+			view:     ViewText,
+			expected: &GetResult{MessageID: "exampleMessageID", Text: "Title", View: ViewText},
+			cached:   true,
+		},
+		{
+			result:      &GetResult{MessageID: "exampleMessageID", HTML: html},
+			view:        "amp",
+			expected:    &GetResult{MessageID: "exampleMessageID", HTML: html},
+			expectedErr: api.ErrInvalidView,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cached := false
+			client := mockUpdateItemAPI(func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+				cached = true
+				assert.Equal(t, "SET RenderedViews = :views", *params.UpdateExpression)
+				views := params.ExpressionAttributeValues[":views"].(*types.AttributeValueMemberM).Value
+				assert.Equal(t, &types.AttributeValueMemberS{Value: contentHash(test.result.HTML)}, views["Hash"])
+				return &dynamodb.UpdateItemOutput{}, nil
+			})
+
+			err := RenderView(context.TODO(), client, test.result, test.view)
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expected, test.result)
+			assert.Equal(t, test.cached, cached)
+		})
+	}
+}
@@ -6,11 +6,190 @@ var (
 	// AWS Region
 	Region = os.Getenv("REGION")
 
-	TableName            = os.Getenv("DYNAMODB_TABLE")
+	// Name of the deployment, e.g. staging, so that several deployments can share an AWS account.
+	// If set, table and queue names are prefixed by "<name>-", S3 keys by "<name>/", and hooks carry it.
+	Environment = os.Getenv("ENVIRONMENT")
+
+	TableName            = prefixName(os.Getenv("DYNAMODB_TABLE"))
 	GsiOriginalIndexName = os.Getenv("DYNAMODB_ORIGINAL_INDEX")
 	GsiIndexName         = os.Getenv("DYNAMODB_TIME_INDEX")
+	GsiThreadIndexName   = os.Getenv("DYNAMODB_THREAD_INDEX")
+	CountersTableName    = prefixName(os.Getenv("DYNAMODB_COUNTERS_TABLE")) // folder counters are maintained only if set
 	S3Bucket             = os.Getenv("S3_BUCKET")
-	QueueName            = os.Getenv("SQS_QUEUE")
+	S3Prefix             = prefixKey(os.Getenv("S3_PREFIX")) // object key prefix used by the SES S3 action
+	QueueName            = prefixName(os.Getenv("SQS_QUEUE"))
+
+	WebhookURL     = os.Getenv("WEBHOOK_URL")
+	WebhookTimeout = os.Getenv("WEBHOOK_TIMEOUT") // Go duration, e.g. 10s (default 5s)
+	WebhookProxy   = os.Getenv("WEBHOOK_PROXY")   // HTTP(S) proxy URL for webhooks, enrichment and classification, otherwise HTTPS_PROXY and HTTP_PROXY are used
+	// Secrets Manager secret with the PEM encoded CA bundle and mTLS client certificate of the webhook receiver
+	WebhookTLSSecret = os.Getenv("WEBHOOK_TLS_SECRET")
+
+	// Endpoint asked for annotations of received emails, e.g. a CRM lookup by sender
+	EnrichmentURL       = os.Getenv("ENRICHMENT_URL")
+	EnrichmentTimeout   = os.Getenv("ENRICHMENT_TIMEOUT")    // Go duration, e.g. 2s (default 5s)
+	EnrichmentTLSSecret = os.Getenv("ENRICHMENT_TLS_SECRET") // same format as WEBHOOK_TLS_SECRET
+
+	// Classification service asked for labels and scores of received emails, e.g. a user's own ML model
+	ClassificationURL       = os.Getenv("CLASSIFICATION_URL")
+	ClassificationTimeout   = os.Getenv("CLASSIFICATION_TIMEOUT")    // Go duration, e.g. 2s (default 5s)
+	ClassificationTLSSecret = os.Getenv("CLASSIFICATION_TLS_SECRET") // same format as WEBHOOK_TLS_SECRET
+	ClassificationRaw       = os.Getenv("CLASSIFICATION_RAW")        // "true" to send raw emails, not only the parsed features
+
+	// Timeouts of operations as Go durations, e.g. 5s, so that a hung dependency can't use up the Lambda timeout
+	HookTimeout    = os.Getenv("HOOK_TIMEOUT")    // sending a hook to SQS, webhooks and push notifications (default 10s)
+	StorageTimeout = os.Getenv("STORAGE_TIMEOUT") // reading, streaming or writing a raw email in S3 (default 30s)
+	ThreadTimeout  = os.Getenv("THREAD_TIMEOUT")  // storing a received email in its thread (default 10s)
+
+	// Quiet hours of notifications in TIME_ZONE, e.g. 22:00-07:00, when webhooks and push notifications are deferred and batched
+	NotificationQuietHours = os.Getenv("NOTIFICATION_QUIET_HOURS")
+	// Comma separated weekdays that are quiet all day, e.g. sat,sun
+	NotificationQuietDays = os.Getenv("NOTIFICATION_QUIET_DAYS")
+
+	// Secrets Manager secret with the Firebase service account key, push notifications are disabled if empty
+	PushFCMSecret = os.Getenv("PUSH_FCM_SECRET")
+	// Base64url encoded P-256 private key of Web Push, Web Push notifications are disabled if empty
+	PushVAPIDPrivateKey = os.Getenv("PUSH_VAPID_PRIVATE_KEY")
+	PushVAPIDSubject    = os.Getenv("PUSH_VAPID_SUBJECT") // contact of the mailbox owner, e.g. mailto:admin@example.com
+
+	// Comma separated hosts that server-initiated requests may reach, e.g. hooks.example.com,*.example.org (default any)
+	EgressAllowlist = os.Getenv("EGRESS_ALLOWLIST")
+	// true allows server-initiated requests to private, loopback and link-local addresses
+	EgressAllowPrivate = os.Getenv("EGRESS_ALLOW_PRIVATE")
+
+	// IANA time zone of the mailbox, e.g. America/New_York, used for monthly partitions and displayed times (default UTC)
+	TimeZone = os.Getenv("TIME_ZONE")
+	// bucket (default) or display, where display only converts displayed times for compatibility with existing data
+	TimeZoneMode = os.Getenv("TIME_ZONE_MODE")
+
+	// What API access logs redact: redacted (default), addresses, full, or off
+	AccessLogPolicy = os.Getenv("ACCESS_LOG_POLICY")
+
+	// Key that signs share links of emails, sharing is disabled if empty
+	ShareSigningKey = os.Getenv("SHARE_SIGNING_KEY")
+
+	// Sink address set as Reply-To of emails sent in no-reply mode, which is disabled if empty.
+	// It must be received by the mailbox, so that bounces are trashed and replies are labeled.
+	NoReplyAddress = os.Getenv("NO_REPLY_ADDRESS")
+
+	// Address that receives feedback reports of ISP feedback loops, whose complainants are suppressed in SES.
+	// Feedback reports are processed as other emails if empty.
+	AbuseAddress = os.Getenv("ABUSE_ADDRESS")
+
+	// SQS queue of drafts whose sending failed transiently, e.g. by throttling of SES, to be retried with backoff.
+	// Failures are returned to the sender without retries if empty.
+	SendRetryQueue  = prefixName(os.Getenv("SEND_RETRY_QUEUE"))
+	SendMaxAttempts = os.Getenv("SEND_MAX_ATTEMPTS") // attempts of a send before the draft is marked failed (default 5)
+
+	// Write-once bucket with S3 Object Lock where every received raw email is copied, e.g. in another account.
+	// Journaling of received emails is disabled if empty.
+	JournalBucket        = os.Getenv("JOURNAL_BUCKET")
+	JournalPrefix        = prefixKey(os.Getenv("JOURNAL_PREFIX"))
+	JournalRetentionDays = os.Getenv("JOURNAL_RETENTION_DAYS") // compliance mode retention, the bucket's default retention if empty
+
+	// Retention of raw emails written to S3_BUCKET when it has S3 Object Lock enabled: GOVERNANCE or COMPLIANCE mode,
+	// kept for S3_RETENTION_DAYS. Retained emails can't be deleted until their retention expires, disabled if empty.
+	S3RetentionMode = os.Getenv("S3_RETENTION_MODE")
+	S3RetentionDays = os.Getenv("S3_RETENTION_DAYS")
+
+	// Days an email is kept in the trash before DynamoDB purges it by the ExpiresAt TTL, trashed emails are kept until deleted if empty.
+	// The deletions are processed from the table stream by the trashExpire function, which deletes the raw emails in S3.
+	TrashRetentionDays = os.Getenv("TRASH_RETENTION_DAYS")
 
-	WebhookURL = os.Getenv("WEBHOOK_URL")
+	// Days the bodies, attachments and raw messages of received emails are kept before the bodiesExpire function removes them,
+	// keeping their metadata, e.g. for deployments that only relay notifications. Bodies are kept indefinitely if empty.
+	BodyRetentionDays = os.Getenv("BODY_RETENTION_DAYS")
+	// Whether the bodies of received emails are only in the raw messages in S3, not stored in DynamoDB ("true" or "false")
+	MetadataOnly = os.Getenv("METADATA_ONLY")
+
+	// Bucket where the emailsExport function writes the metadata of emails as JSON Lines for analytics, export is disabled if empty
+	ExportBucket = os.Getenv("EXPORT_BUCKET")
+	ExportPrefix = prefixKey(os.Getenv("EXPORT_PREFIX"))
+
+	// SQS queue of asynchronous jobs, e.g. archives requested by POST /exports and bulk changes requested by
+	// POST /emails/bulk-delete and POST /emails/bulk-label, which the jobs function runs. Jobs are disabled if empty.
+	JobsQueue = prefixName(os.Getenv("JOBS_QUEUE"))
+	BulkRate  = os.Getenv("BULK_RATE") // emails changed per second by a bulk job (default 25)
+
+	// SQS queue whose messages start executions of the jobs state machine, through an EventBridge Pipe,
+	// for the kinds of jobs in JOBS_WORKFLOW_KINDS (comma-separated, e.g. "bulk-delete,bulk-label").
+	// The state machine runs the jobs with the jobsWorkflow function, in parallel parts if the kind supports it.
+	// Jobs of all kinds are queued in JOBS_QUEUE if empty.
+	JobsWorkflowQueue = prefixName(os.Getenv("JOBS_WORKFLOW_QUEUE"))
+	JobsWorkflowKinds = os.Getenv("JOBS_WORKFLOW_KINDS")
+	JobsWorkflowParts = os.Getenv("JOBS_WORKFLOW_PARTS") // parts of a job run in parallel by the state machine (default 4)
+
+	// Kinesis Data Firehose delivery stream where a metadata record of every received and sent email is put,
+	// e.g. to be converted to Parquet in S3 for Athena, analytics records are disabled if empty
+	AnalyticsStream = os.Getenv("ANALYTICS_STREAM")
+
+	// Archive address that receives a Bcc copy of every sent email for compliance, journaling is disabled if empty.
+	// Emails are still sent if the copy is rejected, e.g. when the address isn't verified in the SES sandbox.
+	JournalAddress = os.Getenv("JOURNAL_ADDRESS")
+
+	// Sink of all sends: off (default), simulator for the SES mailbox simulator, or noop to not call SES.
+	// Emails are validated and stored as sent, and marked as dry runs.
+	DryRun = os.Getenv("DRY_RUN")
+
+	// Comma separated IAM user or role ARNs allowed to use the admin API, which is disabled if empty
+	AdminCallers = os.Getenv("ADMIN_CALLERS")
+
+	// Comma separated stages of receiving emails that are skipped: authenticate, classify, rules, notify, or reply
+	ReceiveDisabledStages = os.Getenv("RECEIVE_DISABLED_STAGES")
+	// Comma separated policies of stages of receiving emails when they fail, e.g. classify=continue,notify=continue.
+	// A policy is abort, continue, or quarantine.
+	ReceiveFailurePolicy = os.Getenv("RECEIVE_FAILURE_POLICY")
+
+	// Action taken on dangerous attachments when receiving emails: allow (default), strip, quarantine, or block
+	AttachmentPolicy = os.Getenv("ATTACHMENT_POLICY")
+
+	// Whether large attachments of received emails are stored once by content hash, set to "true" to enable
+	AttachmentDedup = os.Getenv("ATTACHMENT_DEDUP")
+
+	// Maximum size in bytes of attachments uploaded to drafts with pre-signed POSTs (default 10 MiB)
+	UploadMaxSize = os.Getenv("UPLOAD_MAX_SIZE")
+
+	// Credentials of the POP3 server, which refuses all logins if the password is empty
+	POP3Username = os.Getenv("POP3_USERNAME")
+	POP3Password = os.Getenv("POP3_PASSWORD")
+	POP3Address  = os.Getenv("POP3_ADDRESS")      // listen address (default :995 with TLS, otherwise :110)
+	POP3TLSCert  = os.Getenv("POP3_TLS_CERT")     // path to the PEM encoded certificate chain
+	POP3TLSKey   = os.Getenv("POP3_TLS_KEY")      // path to the PEM encoded private key
+	POP3Insecure = os.Getenv("POP3_INSECURE")     // true allows serving without TLS, e.g. behind a TLS terminating proxy
+	POP3Limit    = os.Getenv("POP3_MAX_MESSAGES") // number of the latest inbox emails served (default 500)
+
+	// Servers advertised to mail clients by autoconfig and autodiscover, as host:port, e.g. mail.example.com:995
+	AutoconfigIMAPServer = os.Getenv("AUTOCONFIG_IMAP_SERVER")
+	AutoconfigPOP3Server = os.Getenv("AUTOCONFIG_POP3_SERVER")
+	AutoconfigSMTPServer = os.Getenv("AUTOCONFIG_SMTP_SERVER")
+
+	// Endpoint of the OpenSearch domain or serverless collection where received emails are indexed for search,
+	// e.g. https://search-mailbox-abc123.us-east-1.es.amazonaws.com. Emails are searched in DynamoDB if empty.
+	SearchURL   = os.Getenv("SEARCH_URL")
+	SearchIndex = prefixName(os.Getenv("SEARCH_INDEX")) // name of the index (default mailbox)
+
+	// Recipient of digests of unread and starred emails, digests are disabled if empty
+	DigestTo   = os.Getenv("DIGEST_TO")
+	DigestFrom = os.Getenv("DIGEST_FROM") // sender verified in SES (default DIGEST_TO)
+	// Comma separated labels of emails in digests, where labels prefixed with - are excluded (default all emails)
+	DigestLabels = os.Getenv("DIGEST_LABELS")
+	// Whether monthly reports are emailed to DIGEST_TO, set to "true" to enable
+	ReportEmail = os.Getenv("REPORT_EMAIL")
 )
+
+// prefixName prefixes the name of a table or queue by the environment.
+// Empty names stay empty, since they disable the features using them.
+func prefixName(name string) string {
+	if Environment == "" || name == "" {
+		return name
+	}
+	return Environment + "-" + name
+}
+
+// prefixKey prefixes an S3 object key prefix by the environment
+func prefixKey(prefix string) string {
+	if Environment == "" {
+		return prefix
+	}
+	return Environment + "/" + prefix
+}
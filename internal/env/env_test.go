@@ -0,0 +1,22 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefix(t *testing.T) {
+	original := Environment
+	defer func() { Environment = original }()
+
+	Environment = ""
+	assert.Equal(t, "mailbox", prefixName("mailbox"))
+	assert.Equal(t, "incoming/", prefixKey("incoming/"))
+
+	Environment = "staging"
+	assert.Equal(t, "staging-mailbox", prefixName("mailbox"))
+	assert.Equal(t, "", prefixName(""))
+	assert.Equal(t, "staging/incoming/", prefixKey("incoming/"))
+	assert.Equal(t, "staging/", prefixKey(""))
+}
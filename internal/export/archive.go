@@ -0,0 +1,651 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/harryzcy/mailbox/internal/admin"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/jobs"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// Formats of archives
+const (
+	FormatMbox = "mbox" // a single mbox file, in the mboxrd variant
+	FormatEML  = "eml"  // a zip of .eml files
+)
+
+// KindArchive is the kind of the jobs packaging archives
+const KindArchive = "export"
+
+func init() {
+	jobs.Register(KindArchive, func() jobs.Runner { return &Archive{} })
+}
+
+// archiveStopMargin is the time left before the deadline at which a part of an archive is discarded,
+// to be packaged again by the next run, as the stop margin of jobs
+const archiveStopMargin = 30 * time.Second
+
+const (
+	// maxArchiveParts is the maximum number of parts of a multipart upload
+	maxArchiveParts = 10000
+	// archiveTimeLayout is the time of an email in its key in an archive, with fixed width so that keys sort by time
+	archiveTimeLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+// archivePartSize is the size at which a part of an archive ends, at least the 5 MiB minimum of S3.
+// It's a variable so that tests can split small archives.
+var archivePartSize int64 = 8 << 20
+
+// BuildArchiveAPI defines set of API required to package an archive
+type BuildArchiveAPI interface {
+	api.QueryAPI
+	api.ScanAPI
+	clients.Storage
+}
+
+// ArchiveInput is the request of an archive of the raw received emails.
+// Dates are in TIME_ZONE, as the monthly partitions of the table.
+type ArchiveInput struct {
+	Format string `json:"format"` // mbox or eml, mbox if empty
+	From   string `json:"from"`   // first day, YYYY-MM-DD, the entire mailbox if both From and To are empty
+	To     string `json:"to"`     // last day, YYYY-MM-DD, today if empty
+	Label  string `json:"label"`  // only emails with the label if not empty
+	// Force includes emails that are infected or whose scan is pending, only allowed for ADMIN_CALLERS
+	Force  bool   `json:"force"`
+	Caller string `json:"-"` // identity of the request, set by the API
+}
+
+// Archive is an export of raw received emails into a single object in S3_BUCKET,
+// which is packaged asynchronously by a job, in parts of a multipart upload if it doesn't fit in one
+type Archive struct {
+	jobs.Job
+	Format   string            `json:"format"`
+	From     string            `json:"from,omitempty"`
+	To       string            `json:"to,omitempty"`
+	Label    string            `json:"label,omitempty"`
+	Emails   int               `json:"emails"`
+	Skipped  int               `json:"skipped"`                           // emails whose raw messages are missing
+	Held     int               `json:"held"`                              // emails that are infected or whose scan is pending
+	ForcedBy string            `json:"forcedBy,omitempty"`                // admin who requested held emails to be included
+	Size     int64             `json:"size"`                              // in bytes, packaged so far while running
+	Download *storage.Download `json:"download,omitempty" dynamodbav:"-"` // set by the API when completed
+
+	UploadID string `json:"-"` // multipart upload of the archive, after its first part
+	Parts    int    `json:"-"` // parts uploaded
+	Cursor   string `json:"-"` // key of the last email packaged or left out, see archiveEmail.key
+
+	emails []archiveEmail // emails of the archive, listed once by each run
+}
+
+// Location returns the location of the archive in S3_BUCKET, under the exports/ prefix next to the raw emails
+func (a *Archive) Location() storage.Location {
+	return storage.Location{
+		Bucket: env.S3Bucket,
+		Key:    env.S3Prefix + "exports/" + a.JobID + a.extension(),
+	}
+}
+
+// Filename returns the name of the downloaded archive
+func (a *Archive) Filename() string {
+	return "mailbox-" + a.JobID + a.extension()
+}
+
+// ContentType returns the media type of the archive
+func (a *Archive) ContentType() string {
+	if a.Format == FormatEML {
+		return "application/zip"
+	}
+	return "application/mbox"
+}
+
+// partLocation returns the location of what the last part needs of a previous part, see archiveWriter
+func (a *Archive) partLocation(part int) storage.Location {
+	location := a.Location()
+	location.Key += ".parts/" + strconv.Itoa(part)
+	return location
+}
+
+func (a *Archive) extension() string {
+	if a.Format == FormatEML {
+		return ".zip"
+	}
+	return ".mbox"
+}
+
+// CreateArchive saves a pending archive of the emails requested by input, and queues it in JOBS_QUEUE
+func CreateArchive(ctx context.Context, client jobs.CreateAPI, input ArchiveInput) (*Archive, error) {
+	if input.Format == "" {
+		input.Format = FormatMbox
+	}
+	if input.Format != FormatMbox && input.Format != FormatEML {
+		return nil, api.ErrInvalidInput
+	}
+	if _, _, _, err := parseArchiveRange(input); err != nil {
+		fmt.Printf("invalid range of archive: %v\n", err)
+		return nil, api.ErrInvalidInput
+	}
+	if len(input.Label) > email.MaxLabelLength {
+		return nil, api.ErrInvalidInput
+	}
+	if input.Force {
+		if err := admin.Authorize(input.Caller); err != nil {
+			return nil, err
+		}
+	}
+
+	archive := &Archive{
+		Format: input.Format,
+		From:   input.From,
+		To:     input.To,
+		Label:  input.Label,
+	}
+	if input.Force {
+		archive.ForcedBy = input.Caller
+	}
+	if err := jobs.Create(ctx, client, KindArchive, archive); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// GetArchive returns an archive by its job ID
+func GetArchive(ctx context.Context, client api.GetItemAPI, jobID string) (*Archive, error) {
+	archive, err := jobs.Get(ctx, client, KindArchive, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return archive.(*Archive), nil
+}
+
+// Step packages the next part of the archive, of about archivePartSize, and returns true after the last one.
+// An archive of a single part is put at once, otherwise each part is uploaded to a multipart upload,
+// which is completed by the last part, and the progress is saved after each part,
+// so that large archives are packaged over as many runs as they need. A failed archive aborts its upload.
+func (a *Archive) Step(ctx context.Context, client jobs.StepAPI) (bool, error) {
+	done, err := writeArchivePart(ctx, client, a)
+	if err != nil && a.UploadID != "" {
+		abortArchive(ctx, client, a)
+	}
+	return done, err
+}
+
+// Summary returns the number of emails and the size of the archive
+func (a *Archive) Summary() string {
+	return fmt.Sprintf("%d emails, %d bytes", a.Emails, a.Size)
+}
+
+// archivePart is the progress of a part of an archive, which is added to the archive once the part is uploaded
+type archivePart struct {
+	emails  int
+	skipped int
+	held    int
+	forced  []archiveEmail // held emails included by an admin
+	cursor  string
+}
+
+// writeArchivePart writes the next part of the archive to a temporary file, which is then uploaded to its location.
+// The file is used instead of memory, so that the size of parts is limited by the ephemeral storage of the function.
+// It returns false without changing the archive if the deadline is near, so that the part is packaged again by the next run.
+func writeArchivePart(ctx context.Context, client BuildArchiveAPI, archive *Archive) (bool, error) {
+	if archive.emails == nil {
+		emails, err := listArchiveEmails(ctx, client, archive)
+		if err != nil {
+			return false, err
+		}
+		archive.emails = emails
+	}
+	emails := archive.emails[sort.Search(len(archive.emails), func(i int) bool {
+		return archive.emails[i].key() > archive.Cursor
+	}):]
+
+	file, err := os.CreateTemp("", "archive-*"+archive.extension())
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	counter := &countingWriter{w: file}
+	writer := newArchiveWriter(counter, archive.Format, archive.Size, archive.Emails)
+	part := archivePart{cursor: archive.Cursor}
+	last := true
+	for _, e := range emails {
+		if counter.n >= archivePartSize {
+			last = false
+			break
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < archiveStopMargin {
+			fmt.Printf("discarding part %d of archive %s before the deadline\n", archive.Parts+1, archive.JobID)
+			return false, nil
+		}
+		part.cursor = e.key()
+		held := e.scanState == email.ScanStateInfected || e.scanState == email.ScanStatePending
+		if held && archive.ForcedBy == "" {
+			part.held++
+			continue
+		}
+		raw, err := storage.S3.OpenEmailRaw(ctx, client, e.location)
+		if err != nil {
+			if apiErr := new(s3types.NoSuchKey); errors.As(err, &apiErr) {
+				part.skipped++
+				continue
+			}
+			return false, err
+		}
+		err = writer.Add(e.messageID, e.time, e.from, raw)
+		raw.Close()
+		if err != nil {
+			return false, err
+		}
+		if held {
+			part.forced = append(part.forced, e)
+		}
+		part.emails++
+	}
+
+	if !last && archive.Parts+1 >= maxArchiveParts {
+		return false, fmt.Errorf("archive has more than %d parts, try a shorter range", maxArchiveParts)
+	}
+
+	var state []byte
+	if last {
+		var previous [][]byte
+		if archive.Format == FormatEML {
+			if previous, err = readArchiveStates(ctx, client, archive); err != nil {
+				return false, err
+			}
+		}
+		err = writer.Close(previous)
+	} else {
+		state, err = writer.Flush()
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err = file.Seek(0, 0); err != nil {
+		return false, err
+	}
+
+	switch {
+	case last && archive.UploadID == "":
+		err = putArchive(ctx, client, archive, file, counter.n)
+	case last && counter.n == 0:
+		// the remaining emails were all left out
+		err = completeArchive(ctx, client, archive)
+	default:
+		err = uploadArchivePart(ctx, client, archive, file, counter.n, state)
+		if err == nil && last {
+			err = completeArchive(ctx, client, archive)
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	archive.Size += counter.n
+	archive.Emails += part.emails
+	archive.Skipped += part.skipped
+	archive.Held += part.held
+	archive.Cursor = part.cursor
+	for _, e := range part.forced {
+		admin.ScanOverride{
+			Action:    admin.ActionExportScanOverride,
+			Caller:    archive.ForcedBy,
+			MessageID: e.messageID,
+			ScanState: e.scanState,
+		}.Log()
+	}
+	if last && archive.Format == FormatEML {
+		deleteArchiveStates(ctx, client, archive)
+	}
+	return last, nil
+}
+
+// putArchive puts an archive of a single part to its location
+func putArchive(ctx context.Context, client BuildArchiveAPI, archive *Archive, body io.Reader, size int64) error {
+	location := archive.Location()
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(location.Bucket),
+		Key:           aws.String(location.Key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(archive.ContentType()),
+	})
+	return err
+}
+
+// uploadArchivePart uploads the next part of an archive, and starts its multipart upload before the first part.
+// The state of the part, that the last part needs, is put next to the archive.
+func uploadArchivePart(ctx context.Context, client BuildArchiveAPI, archive *Archive, body io.Reader, size int64, state []byte) error {
+	location := archive.Location()
+	if archive.UploadID == "" {
+		output, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:      aws.String(location.Bucket),
+			Key:         aws.String(location.Key),
+			ContentType: aws.String(archive.ContentType()),
+		})
+		if err != nil {
+			return err
+		}
+		archive.UploadID = aws.ToString(output.UploadId)
+	}
+	_, err := client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(location.Bucket),
+		Key:           aws.String(location.Key),
+		UploadId:      aws.String(archive.UploadID),
+		PartNumber:    aws.Int32(int32(archive.Parts + 1)),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return err
+	}
+	if len(state) > 0 {
+		stateLocation := archive.partLocation(archive.Parts + 1)
+		_, err = client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:        aws.String(stateLocation.Bucket),
+			Key:           aws.String(stateLocation.Key),
+			Body:          bytes.NewReader(state),
+			ContentLength: aws.Int64(int64(len(state))),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	archive.Parts++
+	return nil
+}
+
+// completeArchive completes the multipart upload of an archive with its uploaded parts
+func completeArchive(ctx context.Context, client BuildArchiveAPI, archive *Archive) error {
+	location := archive.Location()
+	var parts []s3types.CompletedPart
+	input := &s3.ListPartsInput{
+		Bucket:   aws.String(location.Bucket),
+		Key:      aws.String(location.Key),
+		UploadId: aws.String(archive.UploadID),
+	}
+	for {
+		output, err := client.ListParts(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, part := range output.Parts {
+			parts = append(parts, s3types.CompletedPart{ETag: part.ETag, PartNumber: part.PartNumber})
+		}
+		if !aws.ToBool(output.IsTruncated) {
+			break
+		}
+		input.PartNumberMarker = output.NextPartNumberMarker
+	}
+	if len(parts) != archive.Parts {
+		return fmt.Errorf("multipart upload of archive has %d parts, expected %d", len(parts), archive.Parts)
+	}
+
+	_, err := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(location.Bucket),
+		Key:             aws.String(location.Key),
+		UploadId:        aws.String(archive.UploadID),
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+	})
+	return err
+}
+
+// readArchiveStates returns the states of the previous parts of an archive in order
+func readArchiveStates(ctx context.Context, client BuildArchiveAPI, archive *Archive) ([][]byte, error) {
+	states := make([][]byte, 0, archive.Parts)
+	for part := 1; part <= archive.Parts; part++ {
+		location := archive.partLocation(part)
+		output, err := client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(location.Bucket),
+			Key:    aws.String(location.Key),
+		})
+		if err != nil {
+			return nil, err
+		}
+		state, err := io.ReadAll(output.Body)
+		output.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// deleteArchiveStates deletes the states of the parts of an archive, errors are only logged
+// since they're also removed by the lifecycle rule of exports/
+func deleteArchiveStates(ctx context.Context, client BuildArchiveAPI, archive *Archive) {
+	for part := 1; part <= archive.Parts; part++ {
+		location := archive.partLocation(part)
+		_, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(location.Bucket),
+			Key:    aws.String(location.Key),
+		})
+		if err != nil {
+			fmt.Printf("failed to delete part %d of archive %s: %v\n", part, archive.JobID, err)
+		}
+	}
+}
+
+// abortArchive aborts the multipart upload of a failed archive, errors are only logged
+// since incomplete uploads are also removed by the lifecycle rule of exports/
+func abortArchive(ctx context.Context, client BuildArchiveAPI, archive *Archive) {
+	location := archive.Location()
+	_, err := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(location.Bucket),
+		Key:      aws.String(location.Key),
+		UploadId: aws.String(archive.UploadID),
+	})
+	if err != nil {
+		fmt.Printf("failed to abort upload of archive %s: %v\n", archive.JobID, err)
+	}
+	if archive.Format == FormatEML {
+		deleteArchiveStates(ctx, client, archive)
+	}
+}
+
+// archiveEmail is a received email in an archive
+type archiveEmail struct {
+	messageID string
+	location  storage.Location // of the raw email
+	scanState string
+	time      time.Time
+	from      string // envelope sender of the From line of mbox, empty if unknown
+}
+
+// key returns the key of the email in the order of an archive, by time and message ID
+func (e archiveEmail) key() string {
+	return e.time.UTC().Format(archiveTimeLayout) + "#" + e.messageID
+}
+
+// parseArchiveRange returns the first and last day of an archive, or all if it's the entire mailbox
+func parseArchiveRange(input ArchiveInput) (from, to time.Time, all bool, err error) {
+	if input.From == "" && input.To == "" {
+		return from, to, true, nil
+	}
+	if input.From == "" {
+		return from, to, false, errors.New("from is required with to")
+	}
+	loc := format.BucketLocation()
+	if from, err = time.ParseInLocation(dateLayout, input.From, loc); err != nil {
+		return from, to, false, fmt.Errorf("invalid from %q, expected YYYY-MM-DD", input.From)
+	}
+	if input.To == "" {
+		today := now().In(loc)
+		to = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, loc)
+	} else if to, err = time.ParseInLocation(dateLayout, input.To, loc); err != nil {
+		return from, to, false, fmt.Errorf("invalid to %q, expected YYYY-MM-DD", input.To)
+	}
+	if to.Before(from) {
+		return from, to, false, fmt.Errorf("to %s is before from %s", to.Format(dateLayout), input.From)
+	}
+	return from, to, false, nil
+}
+
+// listArchiveEmails returns the received emails of an archive that aren't trashed, from the earliest.
+// The entire mailbox is scanned from the time index, and a range is queried by month.
+func listArchiveEmails(ctx context.Context, client BuildArchiveAPI, archive *Archive) ([]archiveEmail, error) {
+	from, to, all, err := parseArchiveRange(ArchiveInput{From: archive.From, To: archive.To})
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []string{"attribute_not_exists(TrashedTime)"}
+	values := map[string]types.AttributeValue{}
+	if archive.Label != "" {
+		filters = append(filters, "contains(Labels, :label)")
+		values[":label"] = &types.AttributeValueMemberS{Value: archive.Label}
+	}
+	names := map[string]string{
+		"#tym":  "TypeYearMonth",
+		"#dt":   "DateTime",
+		"#from": "From",
+	}
+	projection := aws.String("MessageID, #tym, #dt, #from, VirusStatus, " + storage.RawBucketAttribute + ", " + storage.RawKeyAttribute)
+
+	var items []map[string]types.AttributeValue
+	if all {
+		values[":inbox"] = &types.AttributeValueMemberS{Value: email.EmailTypeInbox + "#"}
+		input := &dynamodb.ScanInput{
+			TableName:                 aws.String(env.TableName),
+			IndexName:                 aws.String(env.GsiIndexName),
+			FilterExpression:          aws.String(strings.Join(append([]string{"begins_with(#tym, :inbox)"}, filters...), " AND ")),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+			ProjectionExpression:      projection,
+		}
+		for {
+			output, err := client.Scan(ctx, input)
+			if err != nil {
+				return nil, mapArchiveError(err)
+			}
+			items = append(items, output.Items...)
+			if len(output.LastEvaluatedKey) == 0 {
+				break
+			}
+			input.ExclusiveStartKey = output.LastEvaluatedKey
+		}
+	} else {
+		for month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location()); !month.After(to); month = month.AddDate(0, 1, 0) {
+			typeYearMonth, err := format.TypeYearMonth(email.EmailTypeInbox, month)
+			if err != nil {
+				return nil, err
+			}
+			// DateTime starts with the day of the month
+			first, last := "00", "32"
+			if month.Year() == from.Year() && month.Month() == from.Month() {
+				first = from.Format("02") + "-"
+			}
+			if month.Year() == to.Year() && month.Month() == to.Month() {
+				last = to.Format("02") + "-~"
+			}
+			monthValues := map[string]types.AttributeValue{
+				":tym":   &types.AttributeValueMemberS{Value: typeYearMonth},
+				":first": &types.AttributeValueMemberS{Value: first},
+				":last":  &types.AttributeValueMemberS{Value: last},
+			}
+			for k, v := range values {
+				monthValues[k] = v
+			}
+			input := &dynamodb.QueryInput{
+				TableName:                 aws.String(env.TableName),
+				IndexName:                 aws.String(env.GsiIndexName),
+				KeyConditionExpression:    aws.String("#tym = :tym AND #dt BETWEEN :first AND :last"),
+				FilterExpression:          aws.String(strings.Join(filters, " AND ")),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: monthValues,
+				ProjectionExpression:      projection,
+			}
+			for {
+				output, err := client.Query(ctx, input)
+				if err != nil {
+					return nil, mapArchiveError(err)
+				}
+				items = append(items, output.Items...)
+				if len(output.LastEvaluatedKey) == 0 {
+					break
+				}
+				input.ExclusiveStartKey = output.LastEvaluatedKey
+			}
+		}
+	}
+
+	emails := make([]archiveEmail, 0, len(items))
+	for _, item := range items {
+		e, err := toArchiveEmail(item)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, e)
+	}
+	sort.Slice(emails, func(i, j int) bool {
+		return emails[i].key() < emails[j].key()
+	})
+	return emails, nil
+}
+
+// toArchiveEmail converts an item of the time index to an email of an archive
+func toArchiveEmail(item map[string]types.AttributeValue) (archiveEmail, error) {
+	var attributes struct {
+		MessageID     string
+		TypeYearMonth string
+		DateTime      string
+		From          []string
+		VirusStatus   string
+	}
+	if err := attributevalue.UnmarshalMap(item, &attributes); err != nil {
+		return archiveEmail{}, err
+	}
+	_, yearMonth, err := format.ExtractTypeYearMonth(attributes.TypeYearMonth)
+	if err != nil {
+		return archiveEmail{}, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, format.RejoinDate(yearMonth, attributes.DateTime))
+	if err != nil {
+		return archiveEmail{}, err
+	}
+
+	e := archiveEmail{
+		messageID: attributes.MessageID,
+		location:  storage.ItemLocation(item, attributes.MessageID),
+		scanState: email.ScanState(attributes.VirusStatus),
+		time:      t,
+	}
+	if len(attributes.From) > 0 {
+		// the From line ends at the first space
+		if address, err := mail.ParseAddress(attributes.From[0]); err == nil && !strings.ContainsAny(address.Address, " \t") {
+			e.from = address.Address
+		}
+	}
+	return e, nil
+}
+
+func mapArchiveError(err error) error {
+	if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+		return api.ErrTooManyRequests
+	}
+	return err
+}
@@ -0,0 +1,464 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/jobs"
+)
+
+func TestParseArchiveRange(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		input        ArchiveInput
+		expectedAll  bool
+		expectedFrom string
+		expectedTo   string
+		expectedErr  string
+	}{
+		{input: ArchiveInput{}, expectedAll: true},
+		{input: ArchiveInput{From: "2024-01-01"}, expectedFrom: "2024-01-01", expectedTo: "2024-05-01"},
+		{input: ArchiveInput{From: "2020-01-01", To: "2024-01-31"}, expectedFrom: "2020-01-01", expectedTo: "2024-01-31"},
+		{input: ArchiveInput{To: "2024-01-31"}, expectedErr: "from is required with to"},
+		{input: ArchiveInput{From: "2024-01-31", To: "2024-01-01"}, expectedErr: "to 2024-01-01 is before from 2024-01-31"},
+		{input: ArchiveInput{From: "20240101"}, expectedErr: `invalid from "20240101", expected YYYY-MM-DD`},
+	}
+	for _, test := range tests {
+		t.Run(test.input.From+"_"+test.input.To, func(t *testing.T) {
+			from, to, all, err := parseArchiveRange(test.input)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.expectedAll, all)
+			if !all {
+				assert.Equal(t, test.expectedFrom, from.Format(dateLayout))
+				assert.Equal(t, test.expectedTo, to.Format(dateLayout))
+			}
+		})
+	}
+}
+
+func TestCreateArchive(t *testing.T) {
+	env.JobsQueue = "jobs"
+	defer func() { env.JobsQueue = "" }()
+
+	var saved map[string]types.AttributeValue
+	var body string
+	client := clients.Fake{
+		MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			saved = params.Item
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		MockGetQueueUrl: func(_ context.Context, params *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+			assert.Equal(t, "jobs", *params.QueueName)
+			return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.example.com/jobs")}, nil
+		},
+		MockSendMessage: func(_ context.Context, params *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+			body = *params.MessageBody
+			return &sqs.SendMessageOutput{}, nil
+		},
+	}
+
+	archive, err := CreateArchive(context.TODO(), client, ArchiveInput{From: "2024-01-01", Label: "work"})
+	assert.Nil(t, err)
+	assert.Equal(t, FormatMbox, archive.Format)
+	assert.Equal(t, jobs.StatusPending, archive.Status)
+	assert.Equal(t, KindArchive, archive.Kind)
+	assert.Equal(t, "job#"+archive.JobID, saved["MessageID"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "work", saved["Label"].(*types.AttributeValueMemberS).Value)
+
+	jobID, err := jobs.ParseMessage(body)
+	assert.Nil(t, err)
+	assert.Equal(t, archive.JobID, jobID)
+
+	assert.Empty(t, archive.ForcedBy)
+
+	// only admins may include held emails
+	env.AdminCallers = "arn:aws:iam::123456789012:user/ops"
+	defer func() { env.AdminCallers = "" }()
+	archive, err = CreateArchive(context.TODO(), client, ArchiveInput{Force: true, Caller: "arn:aws:iam::123456789012:user/ops"})
+	assert.Nil(t, err)
+	assert.Equal(t, "arn:aws:iam::123456789012:user/ops", archive.ForcedBy)
+	_, err = CreateArchive(context.TODO(), client, ArchiveInput{Force: true, Caller: "arn:aws:iam::123456789012:user/app"})
+	assert.Equal(t, api.ErrForbidden, err)
+
+	_, err = CreateArchive(context.TODO(), client, ArchiveInput{Format: "pst"})
+	assert.Equal(t, api.ErrInvalidInput, err)
+	_, err = CreateArchive(context.TODO(), client, ArchiveInput{To: "2024-01-01"})
+	assert.Equal(t, api.ErrInvalidInput, err)
+}
+
+func TestCreateArchive_NotEnabled(t *testing.T) {
+	_, err := CreateArchive(context.TODO(), clients.Fake{}, ArchiveInput{})
+	assert.Equal(t, jobs.ErrNotEnabled, err)
+}
+
+// mockArchiveTable keeps the archive item, so that its status can be checked after the job runs
+type mockArchiveTable struct {
+	clients.Fake
+	item map[string]types.AttributeValue
+}
+
+func (m *mockArchiveTable) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: m.item}, nil
+}
+
+func (m *mockArchiveTable) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.item = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockArchiveTable) archive(t *testing.T) *Archive {
+	archive := &Archive{}
+	assert.Nil(t, attributevalue.UnmarshalMap(m.item, archive))
+	return archive
+}
+
+func newMockArchiveTable(t *testing.T, archive *Archive) *mockArchiveTable {
+	item, err := attributevalue.MarshalMap(archive)
+	assert.Nil(t, err)
+	item["MessageID"] = &types.AttributeValueMemberS{Value: "job#" + archive.JobID}
+	return &mockArchiveTable{item: item}
+}
+
+func TestRunArchive(t *testing.T) {
+	env.S3Bucket = "mailbox"
+	defer func() { env.S3Bucket = "" }()
+
+	table := newMockArchiveTable(t, &Archive{Job: jobs.Job{JobID: "export-id", Kind: KindArchive, Status: jobs.StatusPending}, Format: FormatMbox, From: "2024-04-30", To: "2024-05-01"})
+	months := []string{}
+	table.MockQuery = func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+		tym := params.ExpressionAttributeValues[":tym"].(*types.AttributeValueMemberS).Value
+		months = append(months, tym)
+		assert.Equal(t, "attribute_not_exists(TrashedTime)", *params.FilterExpression)
+		if tym != "inbox#2024-05" {
+			return &dynamodb.QueryOutput{}, nil
+		}
+		assert.Equal(t, "00", params.ExpressionAttributeValues[":first"].(*types.AttributeValueMemberS).Value)
+		assert.Equal(t, "01-~", params.ExpressionAttributeValues[":last"].(*types.AttributeValueMemberS).Value)
+		return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+			{
+				"MessageID":     &types.AttributeValueMemberS{Value: "later"},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+				"DateTime":      &types.AttributeValueMemberS{Value: "01-13:00:00.000#abcd"},
+				"From":          &types.AttributeValueMemberSS{Value: []string{"Sender <sender@example.com>"}},
+			},
+			{
+				"MessageID":     &types.AttributeValueMemberS{Value: "earlier"},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+				"DateTime":      &types.AttributeValueMemberS{Value: "01-12:00:00.000#abcd"},
+			},
+			{
+				"MessageID":     &types.AttributeValueMemberS{Value: "held"},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+				"DateTime":      &types.AttributeValueMemberS{Value: "01-15:00:00.000#abcd"},
+				"VirusStatus":   &types.AttributeValueMemberS{Value: "FAIL"},
+			},
+			{
+				"MessageID":     &types.AttributeValueMemberS{Value: "missing"},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+				"DateTime":      &types.AttributeValueMemberS{Value: "01-14:00:00.000#abcd"},
+			},
+		}}, nil
+	}
+	table.MockGetObject = func(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+		if *params.Key == "missing" {
+			return nil, &s3types.NoSuchKey{}
+		}
+		return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("Subject: " + *params.Key + "\r\n\r\nbody\r\n"))}, nil
+	}
+	var object string
+	table.MockPutObject = func(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		assert.Equal(t, "mailbox", *params.Bucket)
+		assert.Equal(t, "exports/export-id.mbox", *params.Key)
+		assert.Equal(t, "application/mbox", *params.ContentType)
+		body, err := io.ReadAll(params.Body)
+		assert.Nil(t, err)
+		object = string(body)
+		return &s3.PutObjectOutput{}, nil
+	}
+
+	assert.Nil(t, jobs.Run(context.TODO(), table, "export-id"))
+	assert.Equal(t, []string{"inbox#2024-04", "inbox#2024-05"}, months)
+	assert.Equal(t, "From MAILER-DAEMON Wed May  1 12:00:00 2024\nSubject: earlier\n\nbody\n\n"+
+		"From sender@example.com Wed May  1 13:00:00 2024\nSubject: later\n\nbody\n\n", object)
+
+	archive := table.archive(t)
+	assert.Equal(t, jobs.StatusCompleted, archive.Status)
+	assert.Equal(t, 2, archive.Emails)
+	assert.Equal(t, 1, archive.Skipped)
+	assert.Equal(t, 1, archive.Held)
+	assert.Equal(t, int64(len(object)), archive.Size)
+
+	// completed archives aren't packaged again
+	assert.Nil(t, jobs.Run(context.TODO(), table, "export-id"))
+
+	// held emails are included if an admin forces it
+	forced := newMockArchiveTable(t, &Archive{
+		Job:    jobs.Job{JobID: "export-id", Kind: KindArchive, Status: jobs.StatusPending},
+		Format: FormatMbox, From: "2024-04-30", To: "2024-05-01", ForcedBy: "arn:aws:iam::123456789012:user/ops",
+	})
+	forced.MockQuery, forced.MockGetObject, forced.MockPutObject = table.MockQuery, table.MockGetObject, table.MockPutObject
+	assert.Nil(t, jobs.Run(context.TODO(), forced, "export-id"))
+	assert.Contains(t, object, "Subject: held")
+	archive = forced.archive(t)
+	assert.Equal(t, 3, archive.Emails)
+	assert.Equal(t, 0, archive.Held)
+}
+
+func TestRunArchive_Failed(t *testing.T) {
+	table := newMockArchiveTable(t, &Archive{Job: jobs.Job{JobID: "export-id", Kind: KindArchive, Status: jobs.StatusPending}, Format: FormatEML})
+	table.MockScan = func(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+		assert.Equal(t, "begins_with(#tym, :inbox) AND attribute_not_exists(TrashedTime)", *params.FilterExpression)
+		return nil, errors.New("scan failed")
+	}
+
+	assert.Nil(t, jobs.Run(context.TODO(), table, "export-id"))
+	archive := table.archive(t)
+	assert.Equal(t, jobs.StatusFailed, archive.Status)
+	assert.Equal(t, "scan failed", archive.LastError)
+}
+
+// mockArchiveStorage keeps the objects put, and assembles the parts of multipart uploads
+type mockArchiveStorage struct {
+	clients.Fake
+	objects map[string][]byte
+	uploads map[string]map[int32][]byte
+	raw     map[string]string
+	aborted bool
+}
+
+func newMockArchiveStorage(raw map[string]string) *mockArchiveStorage {
+	return &mockArchiveStorage{objects: map[string][]byte{}, uploads: map[string]map[int32][]byte{}, raw: raw}
+}
+
+func (m *mockArchiveStorage) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if object, ok := m.objects[*params.Key]; ok {
+		return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(object))}, nil
+	}
+	if raw, ok := m.raw[*params.Key]; ok {
+		return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(raw))}, nil
+	}
+	return nil, &s3types.NoSuchKey{}
+}
+
+func (m *mockArchiveStorage) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.objects[*params.Key] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *mockArchiveStorage) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	delete(m.objects, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (m *mockArchiveStorage) CreateMultipartUpload(_ context.Context, params *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	uploadID := "upload-" + *params.Key
+	m.uploads[uploadID] = map[int32][]byte{}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(uploadID)}, nil
+}
+
+func (m *mockArchiveStorage) UploadPart(_ context.Context, params *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.uploads[*params.UploadId][*params.PartNumber] = body
+	return &s3.UploadPartOutput{}, nil
+}
+
+// ListParts lists a part at a time, to check that the parts are paginated
+func (m *mockArchiveStorage) ListParts(_ context.Context, params *s3.ListPartsInput, _ ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	next := int32(1)
+	if params.PartNumberMarker != nil {
+		marker, err := strconv.Atoi(*params.PartNumberMarker)
+		if err != nil {
+			return nil, err
+		}
+		next = int32(marker) + 1
+	}
+	parts := m.uploads[*params.UploadId]
+	return &s3.ListPartsOutput{
+		Parts:                []s3types.Part{{PartNumber: aws.Int32(next), ETag: aws.String(fmt.Sprint("etag-", next))}},
+		IsTruncated:          aws.Bool(int(next) < len(parts)),
+		NextPartNumberMarker: aws.String(strconv.Itoa(int(next))),
+	}, nil
+}
+
+func (m *mockArchiveStorage) CompleteMultipartUpload(_ context.Context, params *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	var object []byte
+	for i, part := range params.MultipartUpload.Parts {
+		if *part.PartNumber != int32(i+1) || *part.ETag != fmt.Sprint("etag-", i+1) {
+			return nil, fmt.Errorf("unexpected part %d", *part.PartNumber)
+		}
+		object = append(object, m.uploads[*params.UploadId][*part.PartNumber]...)
+	}
+	delete(m.uploads, *params.UploadId)
+	m.objects[*params.Key] = object
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (m *mockArchiveStorage) AbortMultipartUpload(_ context.Context, params *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	delete(m.uploads, *params.UploadId)
+	m.aborted = true
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestRunArchive_Parts(t *testing.T) {
+	archivePartSize = 1
+	defer func() { archivePartSize = 8 << 20 }()
+
+	// bodies that don't compress into a single buffer of the writers, so that each email is a part
+	random := rand.New(rand.NewSource(1))
+	raw := map[string]string{}
+	items := []map[string]types.AttributeValue{}
+	for i, id := range []string{"a", "missing", "b", "held", "c"} {
+		body := make([]byte, 100000)
+		random.Read(body)
+		raw[id] = "Subject: " + id + "\r\n\r\n" + hex.EncodeToString(body) + "\r\n"
+		item := map[string]types.AttributeValue{
+			"MessageID":     &types.AttributeValueMemberS{Value: id},
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+			"DateTime":      &types.AttributeValueMemberS{Value: fmt.Sprintf("01-1%d:00:00.000#abcd", i)},
+		}
+		if id == "held" {
+			item["VirusStatus"] = &types.AttributeValueMemberS{Value: "FAIL"}
+		}
+		items = append(items, item)
+	}
+	delete(raw, "missing")
+
+	for _, archiveFormat := range []string{FormatMbox, FormatEML} {
+		t.Run(archiveFormat, func(t *testing.T) {
+			storage := newMockArchiveStorage(raw)
+			storage.MockQuery = func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+				return &dynamodb.QueryOutput{Items: items}, nil
+			}
+			archive := &Archive{Job: jobs.Job{JobID: "export-id", Kind: KindArchive}, Format: archiveFormat, From: "2024-05-01", To: "2024-05-01"}
+
+			// a part isn't packaged if the deadline is near
+			ctx, cancel := context.WithTimeout(context.TODO(), archiveStopMargin/2)
+			done, err := archive.Step(ctx, storage)
+			cancel()
+			assert.Nil(t, err)
+			assert.False(t, done)
+			assert.Equal(t, 0, archive.Parts)
+			assert.Equal(t, "", archive.UploadID)
+
+			// each run resumes from the saved archive
+			steps := 0
+			for !done {
+				item, err := attributevalue.MarshalMap(archive)
+				assert.Nil(t, err)
+				archive = &Archive{}
+				assert.Nil(t, attributevalue.UnmarshalMap(item, archive))
+				archive.JobID = "export-id"
+
+				done, err = archive.Step(context.TODO(), storage)
+				if !assert.Nil(t, err) {
+					return
+				}
+				steps++
+			}
+			assert.Equal(t, 3, steps)
+			assert.Equal(t, 3, archive.Parts)
+			assert.Equal(t, 3, archive.Emails)
+			assert.Equal(t, 1, archive.Held)
+			assert.Equal(t, 1, archive.Skipped)
+			assert.Empty(t, storage.uploads)
+			assert.Len(t, storage.objects, 1, "the states of the parts are deleted")
+
+			object := storage.objects[archive.Location().Key]
+			assert.Equal(t, int64(len(object)), archive.Size)
+			if archiveFormat == FormatMbox {
+				assert.Equal(t, "From MAILER-DAEMON Wed May  1 10:00:00 2024\n"+strings.ReplaceAll(raw["a"], "\r\n", "\n")+"\n"+
+					"From MAILER-DAEMON Wed May  1 12:00:00 2024\n"+strings.ReplaceAll(raw["b"], "\r\n", "\n")+"\n"+
+					"From MAILER-DAEMON Wed May  1 14:00:00 2024\n"+strings.ReplaceAll(raw["c"], "\r\n", "\n")+"\n", string(object))
+				return
+			}
+			r, err := zip.NewReader(bytes.NewReader(object), int64(len(object)))
+			assert.Nil(t, err)
+			assert.Len(t, r.File, 3)
+			for i, id := range []string{"a", "b", "c"} {
+				assert.Equal(t, id+".eml", r.File[i].Name)
+				f, err := r.File[i].Open()
+				assert.Nil(t, err)
+				content, err := io.ReadAll(f)
+				assert.Nil(t, err)
+				assert.Equal(t, raw[id], string(content))
+			}
+		})
+	}
+}
+
+func TestRunArchive_Aborted(t *testing.T) {
+	archivePartSize = 1
+	defer func() { archivePartSize = 8 << 20 }()
+
+	storage := newMockArchiveStorage(map[string]string{"a": strings.Repeat("a", 10000)})
+	storage.MockQuery = func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+		return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+			{
+				"MessageID":     &types.AttributeValueMemberS{Value: "a"},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+				"DateTime":      &types.AttributeValueMemberS{Value: "01-10:00:00.000#abcd"},
+			},
+			{
+				"MessageID":     &types.AttributeValueMemberS{Value: "b"},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+				"DateTime":      &types.AttributeValueMemberS{Value: "01-11:00:00.000#abcd"},
+			},
+		}}, nil
+	}
+	archive := &Archive{Job: jobs.Job{JobID: "export-id", Kind: KindArchive}, Format: FormatMbox, From: "2024-05-01", To: "2024-05-01"}
+
+	done, err := archive.Step(context.TODO(), storage)
+	assert.Nil(t, err)
+	assert.False(t, done)
+	assert.Equal(t, 1, archive.Parts)
+
+	// a failed part aborts the upload
+	_, err = archive.Step(context.TODO(), failingArchiveStorage{storage})
+	assert.EqualError(t, err, "get failed")
+	assert.True(t, storage.aborted)
+	assert.Empty(t, storage.uploads)
+}
+
+// failingArchiveStorage fails to get raw emails
+type failingArchiveStorage struct {
+	*mockArchiveStorage
+}
+
+func (failingArchiveStorage) GetObject(_ context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return nil, errors.New("get failed")
+}
@@ -0,0 +1,326 @@
+// Package export writes the metadata of emails to S3 as JSON Lines, one object for each day,
+// under Hive style partitions, e.g. date=2024-05-01/emails.jsonl,
+// so that mail volume, senders and labels can be analyzed with Athena or DuckDB without reading the table.
+// It also packages raw received emails into mbox or zip archives that users download, see CreateArchive.
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+const (
+	// MaxDays is the maximum number of days exported by an invocation
+	MaxDays = 366
+
+	dateLayout      = "2006-01-02"
+	maxBatchGetKeys = 100
+)
+
+// ErrNotEnabled is returned if EXPORT_BUCKET isn't set
+var ErrNotEnabled = errors.New("export is not enabled, EXPORT_BUCKET is not set")
+
+// now is equal to time.Now, but will be replaced during testing
+var now = time.Now
+
+// metadataAttributes are the attributes of emails that are exported, bodyAttributes are added with bodies
+var (
+	metadataAttributes = []string{
+		"MessageID", "TypeYearMonth", "DateTime", "Subject", "From", "To", "Cc", "Source", "Destination",
+		"Labels", "Unread", "Flagged", "ArchivedTime", "TrashedTime", "ThreadID", "Verdict", "Stats",
+	}
+	bodyAttributes = []string{"Text", "HTML"}
+)
+
+// API defines set of API required to export emails
+type API interface {
+	api.QueryAPI
+	api.BatchGetItemAPI
+	storage.S3PutObjectAPI
+}
+
+// Input is the event of the export function.
+// Dates are in TIME_ZONE, as the monthly partitions of the table.
+type Input struct {
+	From   string `json:"from"`   // first day to export, YYYY-MM-DD, yesterday if empty
+	To     string `json:"to"`     // last day to export, From if empty
+	Bodies bool   `json:"bodies"` // whether the text and HTML bodies are exported
+}
+
+// Record is a line of an export
+type Record struct {
+	MessageID   string                   `json:"messageID"`
+	Type        string                   `json:"type"` // inbox or sent
+	Time        string                   `json:"time"` // time received or sent
+	Subject     string                   `json:"subject"`
+	From        []string                 `json:"from"`
+	To          []string                 `json:"to"`
+	Cc          []string                 `json:"cc,omitempty"`
+	Source      string                   `json:"source,omitempty"`
+	Destination []string                 `json:"destination,omitempty"`
+	Labels      []string                 `json:"labels,omitempty"`
+	Unread      bool                     `json:"unread"`
+	Flagged     bool                     `json:"flagged"`
+	Archived    bool                     `json:"archived"`
+	Trashed     bool                     `json:"trashed"`
+	ThreadID    string                   `json:"threadID,omitempty"`
+	Verdict     *email.Verdict           `json:"verdict,omitempty"`
+	Stats       *mailboxTypes.EmailStats `json:"stats,omitempty"`
+	Text        string                   `json:"text,omitempty"`
+	HTML        string                   `json:"html,omitempty"`
+}
+
+// Result is the result of an export
+type Result struct {
+	Days    int      `json:"days"`
+	Emails  int      `json:"emails"`
+	Objects []string `json:"objects"` // keys of the objects written to EXPORT_BUCKET
+}
+
+// Run exports the received and sent emails of each day from input.From to input.To to EXPORT_BUCKET.
+// The object of a day is overwritten, so days can be exported again, e.g. after emails are labeled.
+func Run(ctx context.Context, client API, input Input) (*Result, error) {
+	if env.ExportBucket == "" {
+		return nil, ErrNotEnabled
+	}
+	from, to, err := parseRange(input)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Objects: []string{}}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		records, err := exportDay(ctx, client, day, input.Bodies)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", day.Format(dateLayout), err)
+		}
+		result.Days++
+		result.Emails += records
+		result.Objects = append(result.Objects, objectKey(day))
+	}
+	return result, nil
+}
+
+// parseRange returns the first and the last day to export
+func parseRange(input Input) (from, to time.Time, err error) {
+	loc := format.BucketLocation()
+	if input.From == "" {
+		today := now().In(loc)
+		from = time.Date(today.Year(), today.Month(), today.Day()-1, 0, 0, 0, 0, loc)
+	} else if from, err = time.ParseInLocation(dateLayout, input.From, loc); err != nil {
+		return from, to, fmt.Errorf("invalid from %q, expected YYYY-MM-DD", input.From)
+	}
+
+	to = from
+	if input.To != "" {
+		if to, err = time.ParseInLocation(dateLayout, input.To, loc); err != nil {
+			return from, to, fmt.Errorf("invalid to %q, expected YYYY-MM-DD", input.To)
+		}
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("to %s is before from %s", input.To, from.Format(dateLayout))
+	}
+	// days may have 23 or 25 hours in TIME_ZONE
+	if days := int(math.Round(to.Sub(from).Hours()/24)) + 1; days > MaxDays {
+		return from, to, fmt.Errorf("%d days requested, at most %d days are exported at once", days, MaxDays)
+	}
+	return from, to, nil
+}
+
+// objectKey returns the key of the object of a day
+func objectKey(day time.Time) string {
+	return env.ExportPrefix + "date=" + day.Format(dateLayout) + "/emails.jsonl"
+}
+
+// exportDay writes the emails of a day to its object, and returns the number of emails
+func exportDay(ctx context.Context, client API, day time.Time, bodies bool) (int, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	count := 0
+	for _, emailType := range []string{email.EmailTypeInbox, email.EmailTypeSent} {
+		messageIDs, err := queryDay(ctx, client, emailType, day)
+		if err != nil {
+			return 0, err
+		}
+		items, err := batchGet(ctx, client, messageIDs, bodies)
+		if err != nil {
+			return 0, err
+		}
+		// in the order of the index, which BatchGetItem doesn't keep
+		for _, messageID := range messageIDs {
+			item, ok := items[messageID]
+			if !ok {
+				continue // deleted in the meantime
+			}
+			record, err := toRecord(item)
+			if err != nil {
+				return 0, err
+			}
+			if err := encoder.Encode(record); err != nil {
+				return 0, err
+			}
+			count++
+		}
+	}
+
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(env.ExportBucket),
+		Key:         aws.String(objectKey(day)),
+		Body:        bytes.NewReader(buf.Bytes()),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	if err != nil {
+		return 0, err
+	}
+	fmt.Printf("exported %d emails of %s\n", count, day.Format(dateLayout))
+	return count, nil
+}
+
+// queryDay returns the message IDs of the emails of a type on a day, from the earliest
+func queryDay(ctx context.Context, client api.QueryAPI, emailType string, day time.Time) ([]string, error) {
+	typeYearMonth, err := format.TypeYearMonth(emailType, day)
+	if err != nil {
+		return nil, err
+	}
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(env.TableName),
+		IndexName:              aws.String(env.GsiIndexName),
+		KeyConditionExpression: aws.String("#tym = :tym AND begins_with(#dt, :day)"),
+		ExpressionAttributeNames: map[string]string{
+			"#tym": "TypeYearMonth",
+			"#dt":  "DateTime",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":tym": &types.AttributeValueMemberS{Value: typeYearMonth},
+			":day": &types.AttributeValueMemberS{Value: day.Format("02") + "-"},
+		},
+		ProjectionExpression: aws.String("MessageID"),
+	}
+
+	var messageIDs []string
+	for {
+		output, err := client.Query(ctx, input)
+		if err != nil {
+			if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return nil, api.ErrTooManyRequests
+			}
+			return nil, err
+		}
+		for _, item := range output.Items {
+			if messageID, ok := item["MessageID"].(*types.AttributeValueMemberS); ok {
+				messageIDs = append(messageIDs, messageID.Value)
+			}
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			return messageIDs, nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+// batchGet returns the exported attributes of emails by their message IDs, leaving out emails that don't exist
+func batchGet(ctx context.Context, client api.BatchGetItemAPI, messageIDs []string, bodies bool) (map[string]map[string]types.AttributeValue, error) {
+	attributes := metadataAttributes
+	if bodies {
+		attributes = append(attributes[:len(attributes):len(attributes)], bodyAttributes...)
+	}
+	// attributes such as From and To are reserved words
+	placeholders := make([]string, len(attributes))
+	names := make(map[string]string, len(attributes))
+	for i, attribute := range attributes {
+		placeholders[i] = fmt.Sprintf("#a%d", i)
+		names[placeholders[i]] = attribute
+	}
+
+	keys := make([]map[string]types.AttributeValue, len(messageIDs))
+	for i, messageID := range messageIDs {
+		keys[i] = map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		}
+	}
+
+	found := make(map[string]map[string]types.AttributeValue, len(messageIDs))
+	for len(keys) > 0 {
+		n := min(len(keys), maxBatchGetKeys)
+		output, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				env.TableName: {
+					Keys:                     keys[:n],
+					ProjectionExpression:     aws.String(strings.Join(placeholders, ", ")),
+					ExpressionAttributeNames: names,
+				},
+			},
+		})
+		if err != nil {
+			if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return nil, api.ErrTooManyRequests
+			}
+			return nil, err
+		}
+		keys = keys[n:]
+		if unprocessed, ok := output.UnprocessedKeys[env.TableName]; ok {
+			keys = append(keys, unprocessed.Keys...)
+		}
+
+		for _, item := range output.Responses[env.TableName] {
+			if messageID, ok := item["MessageID"].(*types.AttributeValueMemberS); ok {
+				found[messageID.Value] = item
+			}
+		}
+	}
+	return found, nil
+}
+
+// toRecord converts an email item to its record
+func toRecord(item map[string]types.AttributeValue) (*Record, error) {
+	result, err := email.ParseGetResult(item)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &Record{
+		MessageID:   result.MessageID,
+		Type:        result.Type,
+		Time:        result.TimeReceived,
+		Subject:     result.Subject,
+		From:        result.From,
+		To:          result.To,
+		Cc:          result.Cc,
+		Source:      result.Source,
+		Destination: result.Destination,
+		Labels:      result.Labels,
+		Unread:      result.Unread != nil && *result.Unread,
+		Flagged:     result.Flagged,
+		Archived:    result.ArchivedTime != "",
+		ThreadID:    result.ThreadID,
+		Verdict:     result.Verdict,
+		Stats:       result.Stats,
+		Text:        result.Text,
+		HTML:        result.HTML,
+	}
+	if result.Type == email.EmailTypeSent {
+		record.Time = result.TimeSent
+	}
+	_, record.Trashed = item["TrashedTime"]
+	return record, nil
+}
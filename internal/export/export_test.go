@@ -0,0 +1,135 @@
+package export
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+func TestParseRange(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		input        Input
+		expectedFrom string
+		expectedTo   string
+		expectedErr  string
+	}{
+		{input: Input{}, expectedFrom: "2024-04-30", expectedTo: "2024-04-30"},
+		{input: Input{From: "2024-01-01"}, expectedFrom: "2024-01-01", expectedTo: "2024-01-01"},
+		{input: Input{From: "2024-01-01", To: "2024-01-31"}, expectedFrom: "2024-01-01", expectedTo: "2024-01-31"},
+		{input: Input{From: "2024-01-01", To: "2024-12-31"}, expectedFrom: "2024-01-01", expectedTo: "2024-12-31"},
+		{input: Input{From: "2023-01-01", To: "2024-12-31"}, expectedErr: "731 days requested, at most 366 days are exported at once"},
+		{input: Input{From: "2024-01-31", To: "2024-01-01"}, expectedErr: "to 2024-01-01 is before from 2024-01-31"},
+		{input: Input{From: "20240101"}, expectedErr: `invalid from "20240101", expected YYYY-MM-DD`},
+		{input: Input{From: "2024-01-01", To: "tomorrow"}, expectedErr: `invalid to "tomorrow", expected YYYY-MM-DD`},
+	}
+	for _, test := range tests {
+		t.Run(test.input.From+"_"+test.input.To, func(t *testing.T) {
+			from, to, err := parseRange(test.input)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.expectedFrom, from.Format(dateLayout))
+			assert.Equal(t, test.expectedTo, to.Format(dateLayout))
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	env.ExportBucket = "exports"
+	env.ExportPrefix = "export/"
+	defer func() {
+		env.ExportBucket = ""
+		env.ExportPrefix = ""
+	}()
+
+	items := map[string]map[string]types.AttributeValue{
+		"received": {
+			"MessageID":     &types.AttributeValueMemberS{Value: "received"},
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+			"DateTime":      &types.AttributeValueMemberS{Value: "01-12:00:00.000#abcd"},
+			"Subject":       &types.AttributeValueMemberS{Value: "hello <world>"},
+			"From":          &types.AttributeValueMemberSS{Value: []string{"sender@example.com"}},
+			"To":            &types.AttributeValueMemberSS{Value: []string{"me@example.com"}},
+			"Labels":        &types.AttributeValueMemberSS{Value: []string{"work"}},
+			"Unread":        &types.AttributeValueMemberBOOL{Value: true},
+			"TrashedTime":   &types.AttributeValueMemberS{Value: "2024-05-02T00:00:00Z"},
+		},
+		"sent": {
+			"MessageID":     &types.AttributeValueMemberS{Value: "sent"},
+			"TypeYearMonth": &types.AttributeValueMemberS{Value: "sent#2024-05"},
+			"DateTime":      &types.AttributeValueMemberS{Value: "01-13:00:00.000#abcd"},
+			"Subject":       &types.AttributeValueMemberS{Value: "re: hello"},
+			"From":          &types.AttributeValueMemberSS{Value: []string{"me@example.com"}},
+			"To":            &types.AttributeValueMemberSS{Value: []string{"sender@example.com"}},
+		},
+	}
+
+	objects := make(map[string]string)
+	client := clients.Fake{
+		MockQuery: func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			assert.Equal(t, "MessageID", *params.ProjectionExpression)
+			tym := params.ExpressionAttributeValues[":tym"].(*types.AttributeValueMemberS).Value
+			day := params.ExpressionAttributeValues[":day"].(*types.AttributeValueMemberS).Value
+			output := &dynamodb.QueryOutput{}
+			if day != "01-" {
+				return output, nil
+			}
+			for _, item := range items {
+				if item["TypeYearMonth"].(*types.AttributeValueMemberS).Value == tym {
+					output.Items = append(output.Items, map[string]types.AttributeValue{"MessageID": item["MessageID"]})
+				}
+			}
+			return output, nil
+		},
+		MockBatchGetItem: func(_ context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+			request := params.RequestItems[env.TableName]
+			assert.NotContains(t, request.ExpressionAttributeNames, "Text")
+			output := &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{}}
+			for _, key := range request.Keys {
+				messageID := key["MessageID"].(*types.AttributeValueMemberS).Value
+				output.Responses[env.TableName] = append(output.Responses[env.TableName], items[messageID])
+			}
+			return output, nil
+		},
+		MockPutObject: func(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			assert.Equal(t, "exports", *params.Bucket)
+			body, err := io.ReadAll(params.Body)
+			assert.Nil(t, err)
+			objects[*params.Key] = string(body)
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	result, err := Run(context.TODO(), client, Input{From: "2024-05-01", To: "2024-05-02"})
+	assert.Nil(t, err)
+	assert.Equal(t, &Result{
+		Days:    2,
+		Emails:  2,
+		Objects: []string{"export/date=2024-05-01/emails.jsonl", "export/date=2024-05-02/emails.jsonl"},
+	}, result)
+	assert.Equal(t, `{"messageID":"received","type":"inbox","time":"2024-05-01T12:00:00Z","subject":"hello <world>",`+
+		`"from":["sender@example.com"],"to":["me@example.com"],"labels":["work"],"unread":true,"flagged":false,"archived":false,"trashed":true}`+"\n"+
+		`{"messageID":"sent","type":"sent","time":"2024-05-01T13:00:00Z","subject":"re: hello",`+
+		`"from":["me@example.com"],"to":["sender@example.com"],"unread":false,"flagged":false,"archived":false,"trashed":false}`+"\n",
+		objects["export/date=2024-05-01/emails.jsonl"])
+	assert.Equal(t, "", objects["export/date=2024-05-02/emails.jsonl"])
+}
+
+func TestRun_NotEnabled(t *testing.T) {
+	_, err := Run(context.TODO(), clients.Fake{}, Input{})
+	assert.Equal(t, ErrNotEnabled, err)
+}
@@ -0,0 +1,282 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// archiveWriter writes raw emails into a part of an archive, which is packaged in parts by the steps of its job
+type archiveWriter interface {
+	// Add writes a raw email received at t, whose envelope sender is from
+	Add(messageID string, t time.Time, from string, raw io.Reader) error
+	// Flush ends a part that isn't the last one, and returns what the last part needs of it,
+	// e.g. the central directory of a zip archive. The underlying writer isn't closed.
+	Flush() ([]byte, error)
+	// Close ends the last part and the archive, given what the previous parts returned by Flush in order.
+	// The underlying writer isn't closed.
+	Close(parts [][]byte) error
+}
+
+// newArchiveWriter returns the writer of a part of an archive in format,
+// which starts at offset of the archive after the given number of emails
+func newArchiveWriter(w io.Writer, format string, offset int64, emails int) archiveWriter {
+	if format == FormatEML {
+		z := &zipWriter{w: &partWriter{w: w}, offset: offset, previous: emails}
+		z.zip = zip.NewWriter(z.w)
+		z.zip.SetOffset(offset)
+		z.zip.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			compressor, err := flate.NewWriter(w, flate.DefaultCompression)
+			z.compressor = &onceCloser{WriteCloser: compressor}
+			return z.compressor, err
+		})
+		return z
+	}
+	return &mboxWriter{w: bufio.NewWriter(w)}
+}
+
+// mboxWriter writes emails in the mboxrd format, where each email starts with a From line,
+// lines of the email starting with From, after any number of >, are quoted with another >,
+// and line endings are LF
+type mboxWriter struct {
+	w *bufio.Writer
+}
+
+// mboxFromLayout is the layout of the time in From lines, as asctime(3) in UTC
+const mboxFromLayout = "Mon Jan _2 15:04:05 2006"
+
+func (m *mboxWriter) Add(_ string, t time.Time, from string, raw io.Reader) error {
+	if from == "" {
+		from = "MAILER-DAEMON"
+	}
+	if _, err := fmt.Fprintf(m.w, "From %s %s\n", from, t.UTC().Format(mboxFromLayout)); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(raw)
+	lineStart := true
+	for {
+		// lines longer than the buffer are read in several chunks
+		chunk, err := r.ReadSlice('\n')
+		if len(chunk) > 0 {
+			if lineStart && bytes.HasPrefix(bytes.TrimLeft(chunk, ">"), []byte("From ")) {
+				if err := m.w.WriteByte('>'); err != nil {
+					return err
+				}
+			}
+			if bytes.HasSuffix(chunk, []byte("\r\n")) {
+				chunk = append(chunk[:len(chunk)-2:len(chunk)-2], '\n')
+			}
+			if _, err := m.w.Write(chunk); err != nil {
+				return err
+			}
+			lineStart = chunk[len(chunk)-1] == '\n'
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+
+	// an empty line separates emails
+	if !lineStart {
+		if err := m.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return m.w.WriteByte('\n')
+}
+
+func (m *mboxWriter) Flush() ([]byte, error) {
+	return nil, m.w.Flush()
+}
+
+// Close ends the archive, since the emails of an mbox are only concatenated
+func (m *mboxWriter) Close(_ [][]byte) error {
+	return m.w.Flush()
+}
+
+// zipWriter writes each email as a .eml file named by its message ID in a zip archive.
+// Since the central directory of the files is at the end of the archive, each part keeps the directory of its files,
+// which is written with the ones of the previous parts by the last part.
+type zipWriter struct {
+	w        *partWriter
+	zip      *zip.Writer
+	offset   int64 // of the part in the archive
+	previous int   // files in the previous parts
+	files    int   // files in the part
+
+	compressor *onceCloser // of the last file, closed by Flush before its data descriptor is written
+}
+
+// onceCloser ignores calls to Close after the first one
+type onceCloser struct {
+	io.WriteCloser
+	closed bool
+}
+
+func (c *onceCloser) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.WriteCloser.Close()
+}
+
+// countingWriter counts the bytes written to the underlying writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// partWriter writes a part to w, and counts the written bytes, until the central directory is written to dir
+type partWriter struct {
+	w   io.Writer
+	n   int64
+	dir *bytes.Buffer
+}
+
+func (p *partWriter) Write(b []byte) (int, error) {
+	if p.dir != nil {
+		return p.dir.Write(b)
+	}
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	return n, err
+}
+
+func (z *zipWriter) Add(messageID string, t time.Time, _ string, raw io.Reader) error {
+	w, err := z.zip.CreateHeader(&zip.FileHeader{
+		Name:     messageID + ".eml",
+		Method:   zip.Deflate,
+		Modified: t,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, raw); err != nil {
+		return err
+	}
+	z.files++
+	return nil
+}
+
+// Flush returns the central directory of the files of the part
+func (z *zipWriter) Flush() ([]byte, error) {
+	// the files are flushed before the directory is redirected
+	if z.compressor != nil {
+		if err := z.compressor.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := z.zip.Flush(); err != nil {
+		return nil, err
+	}
+	z.w.dir = new(bytes.Buffer)
+	if err := z.zip.Close(); err != nil {
+		return nil, err
+	}
+
+	dir := z.w.dir.Bytes()
+	z.w.dir = nil
+	if z.files > 0 {
+		// the data descriptor of the last file is written by Close, before the directory
+		if len(dir) < dataDescriptorLen+4 || binary.LittleEndian.Uint32(dir) != dataDescriptorSignature ||
+			binary.LittleEndian.Uint32(dir[dataDescriptorLen:]) != directoryHeaderSignature {
+			return nil, errors.New("unexpected end of zip part")
+		}
+		if _, err := z.w.Write(dir[:dataDescriptorLen]); err != nil {
+			return nil, err
+		}
+		dir = dir[dataDescriptorLen:]
+	}
+
+	// the end records written by Close are only for the part, see writeZipEnd
+	end := zipEndLen
+	if needZip64(uint64(z.files), uint64(len(dir)-end), uint64(z.offset+z.w.n)) {
+		end += zip64EndLen + zip64LocatorLen
+	}
+	return dir[:len(dir)-end], nil
+}
+
+// Close writes the central directories of the previous parts and of the part, and the end records of the archive
+func (z *zipWriter) Close(parts [][]byte) error {
+	dir, err := z.Flush()
+	if err != nil {
+		return err
+	}
+	offset := uint64(z.offset + z.w.n)
+	size := uint64(len(dir))
+	for _, part := range parts {
+		if _, err := z.w.w.Write(part); err != nil {
+			return err
+		}
+		size += uint64(len(part))
+	}
+	if _, err := z.w.w.Write(dir); err != nil {
+		return err
+	}
+	return writeZipEnd(z.w.w, uint64(z.previous+z.files), size, offset)
+}
+
+// Signatures and lengths of zip records, as written by archive/zip
+const (
+	dataDescriptorSignature  = 0x08074b50
+	directoryHeaderSignature = 0x02014b50
+	dataDescriptorLen        = 16 // with the signature, and sizes of files smaller than 4 GiB
+
+	zipEndLen       = 22 // end of central directory record, without a comment
+	zip64EndLen     = 56 // zip64 end of central directory record
+	zip64LocatorLen = 20 // zip64 end of central directory locator
+)
+
+// needZip64 returns true if the end of a zip archive needs the zip64 records, as archive/zip decides
+func needZip64(records, size, offset uint64) bool {
+	return records >= math.MaxUint16 || size >= math.MaxUint32 || offset >= math.MaxUint32
+}
+
+// writeZipEnd writes the end records of a zip archive as archive/zip does,
+// given the number of files, the size of the central directory and its offset
+func writeZipEnd(w io.Writer, records, size, offset uint64) error {
+	le := binary.LittleEndian
+	var b []byte
+	if needZip64(records, size, offset) {
+		b = make([]byte, zip64EndLen+zip64LocatorLen)
+		le.PutUint32(b[0:], 0x06064b50)     // zip64 end of central directory signature
+		le.PutUint64(b[4:], zip64EndLen-12) // size of the rest of the record
+		le.PutUint16(b[12:], 45)            // version made by
+		le.PutUint16(b[14:], 45)            // version needed to extract
+		le.PutUint64(b[24:], records)       // records on this disk
+		le.PutUint64(b[32:], records)       // total records
+		le.PutUint64(b[40:], size)          // size of the central directory
+		le.PutUint64(b[48:], offset)        // offset of the central directory
+		le.PutUint32(b[56:], 0x07064b50)    // zip64 end of central directory locator signature
+		le.PutUint64(b[64:], offset+size)   // offset of the zip64 end of central directory record
+		le.PutUint32(b[72:], 1)             // total number of disks
+		// the values of the regular record are in the zip64 record
+		records, size, offset = math.MaxUint16, math.MaxUint32, math.MaxUint32
+	}
+	end := make([]byte, zipEndLen)
+	le.PutUint32(end[0:], 0x06054b50) // end of central directory signature
+	le.PutUint16(end[8:], uint16(records))
+	le.PutUint16(end[10:], uint16(records))
+	le.PutUint32(end[12:], uint32(size))
+	le.PutUint32(end[16:], uint32(offset))
+	_, err := w.Write(append(b, end...))
+	return err
+}
@@ -0,0 +1,108 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMboxWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newArchiveWriter(&buf, FormatMbox, 0, 0)
+
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	raw := "Subject: hi\r\n\r\nFrom here\r\n>From there\r\nnot From\r\n"
+	assert.Nil(t, writer.Add("a", received, "sender@example.com", strings.NewReader(raw)))
+	// without a final line ending, and with a line longer than the buffer
+	long := strings.Repeat("x", 5000)
+	part, err := writer.Flush()
+	assert.Nil(t, err)
+	assert.Nil(t, part)
+	// the emails of parts are concatenated
+	writer = newArchiveWriter(&buf, FormatMbox, int64(buf.Len()), 1)
+	assert.Nil(t, writer.Add("b", received.AddDate(0, 0, 1), "", strings.NewReader("Subject: ho\n\nFrom "+long)))
+	assert.Nil(t, writer.Close(nil))
+
+	assert.Equal(t, "From sender@example.com Wed May  1 10:00:00 2024\n"+
+		"Subject: hi\n\n>From here\n>>From there\nnot From\n\n"+
+		"From MAILER-DAEMON Thu May  2 10:00:00 2024\n"+
+		"Subject: ho\n\n>From "+long+"\n\n", buf.String())
+}
+
+func TestZipWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newArchiveWriter(&buf, FormatEML, 0, 0)
+
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, writer.Add("a", received, "sender@example.com", strings.NewReader("Subject: hi\r\n\r\nhello\r\n")))
+	assert.Nil(t, writer.Add("b", received, "", strings.NewReader("Subject: ho\r\n\r\n")))
+	assert.Nil(t, writer.Close(nil))
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	assert.Len(t, r.File, 2)
+	assert.Equal(t, "a.eml", r.File[0].Name)
+	assert.Equal(t, "b.eml", r.File[1].Name)
+	assert.True(t, r.File[0].Modified.Equal(received))
+
+	f, err := r.File[0].Open()
+	assert.Nil(t, err)
+	content, err := io.ReadAll(f)
+	assert.Nil(t, err)
+	assert.Equal(t, "Subject: hi\r\n\r\nhello\r\n", string(content))
+}
+
+func TestZipWriter_Parts(t *testing.T) {
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	parts := [][]string{{"a", "b"}, {}, {"c"}, {"d"}}
+
+	var buf bytes.Buffer
+	var dirs [][]byte
+	emails := 0
+	for i, ids := range parts {
+		writer := newArchiveWriter(&buf, FormatEML, int64(buf.Len()), emails)
+		for _, id := range ids {
+			assert.Nil(t, writer.Add(id, received, "", strings.NewReader("Subject: "+id+"\r\n\r\n"+strings.Repeat(id, 1000))))
+		}
+		emails += len(ids)
+		if i == len(parts)-1 {
+			assert.Nil(t, writer.Close(dirs))
+			break
+		}
+		dir, err := writer.Flush()
+		assert.Nil(t, err)
+		dirs = append(dirs, dir)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	assert.Len(t, r.File, 4)
+	for i, id := range []string{"a", "b", "c", "d"} {
+		assert.Equal(t, id+".eml", r.File[i].Name)
+		f, err := r.File[i].Open()
+		assert.Nil(t, err)
+		content, err := io.ReadAll(f)
+		assert.Nil(t, err)
+		assert.Equal(t, "Subject: "+id+"\r\n\r\n"+strings.Repeat(id, 1000), string(content))
+	}
+}
+
+func TestWriteZipEnd(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, writeZipEnd(&buf, 2, 100, 1000))
+	assert.Equal(t, zipEndLen, buf.Len())
+
+	buf.Reset()
+	assert.Nil(t, writeZipEnd(&buf, 1<<16, 100, 1000))
+	assert.Equal(t, zip64EndLen+zip64LocatorLen+zipEndLen, buf.Len())
+	b := buf.Bytes()
+	assert.Equal(t, uint64(1<<16), binary.LittleEndian.Uint64(b[32:]))
+	assert.Equal(t, uint64(1100), binary.LittleEndian.Uint64(b[64:]))
+	assert.Equal(t, uint16(0xffff), binary.LittleEndian.Uint16(b[zip64EndLen+zip64LocatorLen+10:]))
+}
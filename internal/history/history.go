@@ -0,0 +1,126 @@
+// Package history records the lifecycle events of each email, e.g. when it's received, stored, read or trashed,
+// so that what happened to an email can be inspected. The events are kept after the email is deleted.
+package history
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Lifecycle events of an email
+const (
+	EventReceived   = "received"   // received by SES, or imported
+	EventParsed     = "parsed"     // the raw email is parsed
+	EventClassified = "classified" // the attachment policy and classification are applied
+	EventStored     = "stored"     // stored in its thread
+	EventNotified   = "notified"   // sent to SQS, webhooks and push notifications
+	EventFailed     = "failed"     // a stage of receiving failed
+	EventRead       = "read"
+	EventUnread     = "unread"
+	EventArchived   = "archived"
+	EventUnarchived = "unarchived"
+	EventTrashed    = "trashed"
+	EventRestored   = "restored" // untrashed
+	EventPurged     = "purged"   // deleted
+)
+
+const (
+	// historyPrefix prefixes the MessageID of the item storing the events of an email in the email table
+	historyPrefix = "history#"
+
+	// MaxEvents is the maximum number of events of an email, later events are not recorded
+	MaxEvents = 1000
+)
+
+// now is equal to time.Now, but will be replaced during testing
+var now = time.Now
+
+// Event is a lifecycle event of an email
+type Event struct {
+	Event  string `json:"event"`
+	Time   string `json:"time"` // RFC3339 with fractional seconds
+	Detail string `json:"detail,omitempty"`
+}
+
+// NewEvent returns an event that happens now
+func NewEvent(event, detail string) Event {
+	return Event{
+		Event:  event,
+		Time:   now().UTC().Format(time.RFC3339Nano),
+		Detail: detail,
+	}
+}
+
+// Record appends events to the history of an email.
+// Events beyond MaxEvents are dropped, since an item can't grow indefinitely.
+func Record(ctx context.Context, client api.UpdateItemAPI, messageID string, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	values := make([]types.AttributeValue, len(events))
+	for i, event := range events {
+		av, err := attributevalue.Marshal(event)
+		if err != nil {
+			return err
+		}
+		values[i] = av
+	}
+
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: historyPrefix + messageID},
+		},
+		UpdateExpression:    aws.String("SET Events = list_append(if_not_exists(Events, :empty), :events)"),
+		ConditionExpression: aws.String("attribute_not_exists(Events) OR size(Events) < :max"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":empty":  &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+			":events": &types.AttributeValueMemberL{Value: values},
+			":max":    &types.AttributeValueMemberN{Value: strconv.Itoa(MaxEvents)},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return nil
+		}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
+
+// Get returns the events of an email, from the earliest.
+// It's empty for emails without events, e.g. the ones received before events are recorded.
+func Get(ctx context.Context, client api.GetItemAPI, messageID string) ([]Event, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: historyPrefix + messageID},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+
+	events := []Event{}
+	if av, ok := resp.Item["Events"]; ok {
+		if err := attributevalue.Unmarshal(av, &events); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,92 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockHistoryAPI stores the events of emails like DynamoDB
+type mockHistoryAPI struct {
+	items map[string][]types.AttributeValue
+	err   error
+}
+
+func (m *mockHistoryAPI) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	id := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+	events, ok := m.items[id]
+	if !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{
+		Item: map[string]types.AttributeValue{"Events": &types.AttributeValueMemberL{Value: events}},
+	}, nil
+}
+
+func (m *mockHistoryAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	id := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+	if len(m.items[id]) >= MaxEvents {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	m.items[id] = append(m.items[id], params.ExpressionAttributeValues[":events"].(*types.AttributeValueMemberL).Value...)
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestHistory(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 123000000, time.UTC) }
+	defer func() { now = time.Now }()
+
+	client := &mockHistoryAPI{items: make(map[string][]types.AttributeValue)}
+	ctx := context.TODO()
+
+	events, err := Get(ctx, client, "exampleMessageID")
+	assert.NoError(t, err)
+	assert.Equal(t, []Event{}, events)
+
+	err = Record(ctx, client, "exampleMessageID", NewEvent(EventReceived, ""), NewEvent(EventStored, ""))
+	assert.NoError(t, err)
+	err = Record(ctx, client, "exampleMessageID", NewEvent(EventTrashed, "pop3"))
+	assert.NoError(t, err)
+	assert.Contains(t, client.items, "history#exampleMessageID")
+
+	events, err = Get(ctx, client, "exampleMessageID")
+	assert.NoError(t, err)
+	assert.Equal(t, []Event{
+		{Event: EventReceived, Time: "2024-05-01T12:00:00.123Z"},
+		{Event: EventStored, Time: "2024-05-01T12:00:00.123Z"},
+		{Event: EventTrashed, Time: "2024-05-01T12:00:00.123Z", Detail: "pop3"},
+	}, events)
+
+	// events beyond the maximum are dropped
+	for i := len(events); i < MaxEvents; i++ {
+		assert.NoError(t, Record(ctx, client, "exampleMessageID", NewEvent(EventRead, "")))
+	}
+	assert.NoError(t, Record(ctx, client, "exampleMessageID", NewEvent(EventUnread, "")))
+	assert.Len(t, client.items["history#exampleMessageID"], MaxEvents)
+}
+
+func TestHistory_Error(t *testing.T) {
+	ctx := context.TODO()
+	client := &mockHistoryAPI{err: &types.ProvisionedThroughputExceededException{}}
+	_, err := Get(ctx, client, "exampleMessageID")
+	assert.Equal(t, api.ErrTooManyRequests, err)
+	assert.Equal(t, api.ErrTooManyRequests, Record(ctx, client, "exampleMessageID", NewEvent(EventRead, "")))
+
+	client = &mockHistoryAPI{err: errors.New("error")}
+	assert.EqualError(t, Record(ctx, client, "exampleMessageID", NewEvent(EventRead, "")), "error")
+
+	// nothing is recorded without events
+	assert.NoError(t, Record(ctx, client, "exampleMessageID"))
+}
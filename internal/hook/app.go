@@ -0,0 +1,324 @@
+package hook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/ctxutil"
+	"github.com/harryzcy/mailbox/internal/util/egress"
+)
+
+const (
+	// appWebhooksID is the MessageID of the item storing the webhooks of third-party apps in the email table
+	appWebhooksID = "hook#apps"
+
+	// MaxAppWebhooks is the maximum number of webhooks of an app, i.e. of an API caller
+	MaxAppWebhooks = 10
+	// maxTotalAppWebhooks is the maximum number of webhooks of all apps
+	maxTotalAppWebhooks = 100
+
+	maxAppWebhookURLLength = 2048
+	maxAppWebhookLabels    = 20
+)
+
+// AppWebhook is a webhook endpoint registered by a third-party app, which receives hooks of received emails.
+// It's owned by the API caller that registered it, and is separate from the webhook of WEBHOOK_URL.
+type AppWebhook struct {
+	ID     string   `json:"id"`
+	Owner  string   `json:"-"` // IAM identity of the API caller
+	URL    string   `json:"url"`
+	Labels []string `json:"labels"` // the webhook receives only emails with any of the labels, or all emails if empty
+	// Secret signs the requests in the SignatureHeader, it's only returned when the webhook is created
+	Secret      string `json:"secret,omitempty"`
+	TimeCreated string `json:"timeCreated"`
+}
+
+// CreateAppWebhookInput is the input of CreateAppWebhook
+type CreateAppWebhookInput struct {
+	URL    string   `json:"url"`
+	Labels []string `json:"labels"`
+}
+
+// matches returns true if the webhook receives emails with labels
+func (w AppWebhook) matches(labels []string) bool {
+	if len(w.Labels) == 0 {
+		return true
+	}
+	for _, label := range labels {
+		for _, l := range w.Labels {
+			if label == l {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CreateAppWebhook registers a webhook of the API caller owner.
+// api.ErrTooManyWebhooks is returned if the owner already has MaxAppWebhooks.
+func CreateAppWebhook(ctx context.Context, client api.CreateAppWebhookAPI, owner string, input CreateAppWebhookInput) (*AppWebhook, error) {
+	if owner == "" {
+		return nil, api.ErrForbidden
+	}
+	if len(input.URL) > maxAppWebhookURLLength || len(input.Labels) > maxAppWebhookLabels {
+		return nil, api.ErrInvalidInput
+	}
+	u, err := url.Parse(input.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, api.ErrInvalidInput
+	}
+	if err := egress.FromEnv().CheckURL(u); err != nil {
+		return nil, api.ErrInvalidInput
+	}
+	for _, label := range input.Labels {
+		if label == "" {
+			return nil, api.ErrInvalidInput
+		}
+	}
+
+	existing, err := listAppWebhooks(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	count := 0
+	for _, webhook := range existing {
+		if webhook.Owner == owner {
+			count++
+		}
+	}
+	if count >= MaxAppWebhooks {
+		return nil, api.ErrTooManyWebhooks
+	}
+
+	webhook := &AppWebhook{
+		ID:          randomHex(8),
+		Owner:       owner,
+		URL:         input.URL,
+		Labels:      uniqueLabels(input.Labels),
+		Secret:      randomHex(32),
+		TimeCreated: getCurrentTime().Format(time.RFC3339),
+	}
+	entry := map[string]types.AttributeValue{
+		"Owner":       &types.AttributeValueMemberS{Value: webhook.Owner},
+		"URL":         &types.AttributeValueMemberS{Value: webhook.URL},
+		"Secret":      &types.AttributeValueMemberS{Value: webhook.Secret},
+		"TimeCreated": &types.AttributeValueMemberS{Value: webhook.TimeCreated},
+	}
+	if len(webhook.Labels) > 0 {
+		entry["Labels"] = &types.AttributeValueMemberSS{Value: webhook.Labels}
+	}
+
+	// a nested attribute can only be set in an existing map
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: appWebhooksID},
+		},
+		UpdateExpression: aws.String("SET Webhooks = if_not_exists(Webhooks, :empty)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":empty": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}},
+		},
+	})
+	if err != nil {
+		return nil, mapDynamoDBError(err)
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: appWebhooksID},
+		},
+		UpdateExpression:    aws.String("SET Webhooks.#id = :webhook"),
+		ConditionExpression: aws.String("size(Webhooks) < :max"),
+		ExpressionAttributeNames: map[string]string{
+			"#id": webhook.ID,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":webhook": &types.AttributeValueMemberM{Value: entry},
+			":max":     &types.AttributeValueMemberN{Value: strconv.Itoa(maxTotalAppWebhooks)},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyWebhooks
+		}
+		return nil, mapDynamoDBError(err)
+	}
+	return webhook, nil
+}
+
+// ListAppWebhooks returns the webhooks of the API caller owner, from the earliest created, without their secrets
+func ListAppWebhooks(ctx context.Context, client api.GetItemAPI, owner string) ([]AppWebhook, error) {
+	if owner == "" {
+		return nil, api.ErrForbidden
+	}
+	webhooks, err := listAppWebhooks(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]AppWebhook, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		if webhook.Owner == owner {
+			webhook.Secret = ""
+			result = append(result, webhook)
+		}
+	}
+	return result, nil
+}
+
+// DeleteAppWebhook removes a webhook of the API caller owner.
+// api.ErrWebhookNotFound is returned if it doesn't exist or belongs to another caller.
+func DeleteAppWebhook(ctx context.Context, client api.UpdateItemAPI, owner, id string) error {
+	if owner == "" {
+		return api.ErrForbidden
+	}
+	if id == "" {
+		return api.ErrWebhookNotFound
+	}
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: appWebhooksID},
+		},
+		UpdateExpression:    aws.String("REMOVE Webhooks.#id"),
+		ConditionExpression: aws.String("Webhooks.#id.#owner = :owner"),
+		ExpressionAttributeNames: map[string]string{
+			"#id":    id,
+			"#owner": "Owner",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: owner},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return api.ErrWebhookNotFound
+		}
+		return mapDynamoDBError(err)
+	}
+	return nil
+}
+
+// NotifyApps sends a hook of an email with labels to the webhooks of third-party apps that match the labels.
+// The hooks are sent immediately, since quiet hours are for the notifications of the mailbox owner,
+// and all of them are sent within HOOK_TIMEOUT.
+func NotifyApps(ctx context.Context, client api.GetItemAPI, data *Hook, labels []string) error {
+	webhooks, err := listAppWebhooks(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctxutil.WithTimeout(ctx, env.HookTimeout, DefaultHookTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, webhook := range webhooks {
+		if !webhook.matches(labels) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			// the remaining webhooks are skipped
+			errs = append(errs, err)
+			break
+		}
+		err := SendWebhookTo(ctx, WebhookEndpoint{
+			URL:           webhook.URL,
+			Proxy:         env.WebhookProxy,
+			SigningSecret: webhook.Secret,
+		}, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("app webhook %s: %w", webhook.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// listAppWebhooks returns the webhooks of all apps, from the earliest created
+func listAppWebhooks(ctx context.Context, client api.GetItemAPI) ([]AppWebhook, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: appWebhooksID},
+		},
+	})
+	if err != nil {
+		return nil, mapDynamoDBError(err)
+	}
+
+	attr, ok := resp.Item["Webhooks"].(*types.AttributeValueMemberM)
+	if !ok {
+		return []AppWebhook{}, nil
+	}
+	webhooks := make([]AppWebhook, 0, len(attr.Value))
+	for id, av := range attr.Value {
+		m, ok := av.(*types.AttributeValueMemberM)
+		if !ok {
+			continue
+		}
+		webhook := AppWebhook{
+			ID:          id,
+			Owner:       stringValue(m.Value, "Owner"),
+			URL:         stringValue(m.Value, "URL"),
+			Labels:      []string{},
+			Secret:      stringValue(m.Value, "Secret"),
+			TimeCreated: stringValue(m.Value, "TimeCreated"),
+		}
+		if labels, ok := m.Value["Labels"].(*types.AttributeValueMemberSS); ok {
+			webhook.Labels = labels.Value
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if webhooks[i].TimeCreated != webhooks[j].TimeCreated {
+			return webhooks[i].TimeCreated < webhooks[j].TimeCreated
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks, nil
+}
+
+func uniqueLabels(labels []string) []string {
+	result := []string{}
+	seen := make(map[string]bool)
+	for _, label := range labels {
+		if !seen[label] {
+			seen[label] = true
+			result = append(result, label)
+		}
+	}
+	return result
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b) // never returns an error
+	return hex.EncodeToString(b)
+}
+
+// stringValue returns a string attribute of a map, or an empty string
+func stringValue(m map[string]types.AttributeValue, name string) string {
+	if s, ok := m[name].(*types.AttributeValueMemberS); ok {
+		return s.Value
+	}
+	return ""
+}
+
+func mapDynamoDBError(err error) error {
+	if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+		return api.ErrTooManyRequests
+	}
+	return err
+}
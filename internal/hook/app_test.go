@@ -0,0 +1,186 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockAppWebhooksAPI stores the webhooks of apps like DynamoDB
+type mockAppWebhooksAPI struct {
+	webhooks map[string]types.AttributeValue
+}
+
+func (m *mockAppWebhooksAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.webhooks == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{
+		Item: map[string]types.AttributeValue{"Webhooks": &types.AttributeValueMemberM{Value: m.webhooks}},
+	}, nil
+}
+
+func (m *mockAppWebhooksAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	switch *params.UpdateExpression {
+	case "SET Webhooks = if_not_exists(Webhooks, :empty)":
+		if m.webhooks == nil {
+			m.webhooks = make(map[string]types.AttributeValue)
+		}
+	case "SET Webhooks.#id = :webhook":
+		limit, _ := strconv.Atoi(params.ExpressionAttributeValues[":max"].(*types.AttributeValueMemberN).Value)
+		if len(m.webhooks) >= limit {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		m.webhooks[params.ExpressionAttributeNames["#id"]] = params.ExpressionAttributeValues[":webhook"]
+	case "REMOVE Webhooks.#id":
+		id := params.ExpressionAttributeNames["#id"]
+		webhook, ok := m.webhooks[id].(*types.AttributeValueMemberM)
+		if !ok || stringValue(webhook.Value, "Owner") != params.ExpressionAttributeValues[":owner"].(*types.AttributeValueMemberS).Value {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		delete(m.webhooks, id)
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestAppWebhooks(t *testing.T) {
+	client := &mockAppWebhooksAPI{}
+	ctx := context.TODO()
+	alice, bob := "arn:aws:iam::123456789012:user/alice", "arn:aws:iam::123456789012:user/bob"
+
+	webhooks, err := ListAppWebhooks(ctx, client, alice)
+	assert.Nil(t, err)
+	assert.Empty(t, webhooks)
+
+	created, err := CreateAppWebhook(ctx, client, alice, CreateAppWebhookInput{
+		URL:    "https://crm.example.com/hooks",
+		Labels: []string{"sales", "sales", "support"},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, created.ID, 16)
+	assert.Len(t, created.Secret, 64)
+	assert.Equal(t, []string{"sales", "support"}, created.Labels)
+
+	_, err = CreateAppWebhook(ctx, client, bob, CreateAppWebhookInput{URL: "https://chat.example.com/hooks"})
+	assert.Nil(t, err)
+
+	// each app only sees its own webhooks, without secrets
+	webhooks, err = ListAppWebhooks(ctx, client, alice)
+	assert.Nil(t, err)
+	assert.Len(t, webhooks, 1)
+	assert.Equal(t, created.ID, webhooks[0].ID)
+	assert.Equal(t, "https://crm.example.com/hooks", webhooks[0].URL)
+	assert.Empty(t, webhooks[0].Secret)
+
+	// and can't delete webhooks of other apps
+	err = DeleteAppWebhook(ctx, client, bob, created.ID)
+	assert.Equal(t, api.ErrWebhookNotFound, err)
+	err = DeleteAppWebhook(ctx, client, alice, created.ID)
+	assert.Nil(t, err)
+	err = DeleteAppWebhook(ctx, client, alice, created.ID)
+	assert.Equal(t, api.ErrWebhookNotFound, err)
+
+	webhooks, err = ListAppWebhooks(ctx, client, bob)
+	assert.Nil(t, err)
+	assert.Len(t, webhooks, 1)
+}
+
+func TestCreateAppWebhook_Invalid(t *testing.T) {
+	tests := []struct {
+		owner string
+		input CreateAppWebhookInput
+		err   error
+	}{
+		{"", CreateAppWebhookInput{URL: "https://crm.example.com/hooks"}, api.ErrForbidden},
+		{"alice", CreateAppWebhookInput{URL: "http://crm.example.com/hooks"}, api.ErrInvalidInput},
+		{"alice", CreateAppWebhookInput{URL: "https:///hooks"}, api.ErrInvalidInput},
+		{"alice", CreateAppWebhookInput{URL: "https://127.0.0.1/hooks"}, api.ErrInvalidInput}, // denied by the egress policy
+		{"alice", CreateAppWebhookInput{URL: "https://crm.example.com/hooks", Labels: []string{""}}, api.ErrInvalidInput},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			_, err := CreateAppWebhook(context.TODO(), &mockAppWebhooksAPI{}, test.owner, test.input)
+			assert.Equal(t, test.err, err)
+		})
+	}
+}
+
+func TestCreateAppWebhook_TooMany(t *testing.T) {
+	client := &mockAppWebhooksAPI{}
+	input := CreateAppWebhookInput{URL: "https://crm.example.com/hooks"}
+	for i := 0; i < MaxAppWebhooks; i++ {
+		_, err := CreateAppWebhook(context.TODO(), client, "alice", input)
+		assert.Nil(t, err)
+	}
+	_, err := CreateAppWebhook(context.TODO(), client, "alice", input)
+	assert.Equal(t, api.ErrTooManyWebhooks, err)
+
+	// the limit applies to each app
+	_, err = CreateAppWebhook(context.TODO(), client, "bob", input)
+	assert.Nil(t, err)
+}
+
+func TestNotifyApps(t *testing.T) {
+	env.EgressAllowPrivate = "true" // the test server listens on loopback
+	defer func() { env.EgressAllowPrivate = "" }()
+
+	var mu sync.Mutex
+	received := make(map[string]string) // path -> signature
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		assert.Nil(t, err)
+		var data Hook
+		assert.Nil(t, json.Unmarshal(body, &data))
+		assert.Equal(t, "123", data.Email.ID)
+
+		mu.Lock()
+		defer mu.Unlock()
+		received[req.URL.Path] = req.Header.Get(SignatureHeader)
+		assert.Equal(t, Sign("secret"+req.URL.Path, body), req.Header.Get(SignatureHeader))
+	}))
+	defer server.Close()
+
+	webhook := func(path string, labels ...string) types.AttributeValue {
+		entry := map[string]types.AttributeValue{
+			"Owner":  &types.AttributeValueMemberS{Value: "alice"},
+			"URL":    &types.AttributeValueMemberS{Value: server.URL + path},
+			"Secret": &types.AttributeValueMemberS{Value: "secret" + path},
+		}
+		if len(labels) > 0 {
+			entry["Labels"] = &types.AttributeValueMemberSS{Value: labels}
+		}
+		return &types.AttributeValueMemberM{Value: entry}
+	}
+	client := &mockAppWebhooksAPI{webhooks: map[string]types.AttributeValue{
+		"1": webhook("/all"),
+		"2": webhook("/sales", "sales"),
+		"3": webhook("/support", "support", "billing"),
+	}}
+
+	err := NotifyApps(context.TODO(), client, &Hook{
+		Event:  EventEmail,
+		Action: ActionReceived,
+		Email:  Email{ID: "123"},
+	}, []string{"billing"})
+	assert.Nil(t, err)
+	assert.Len(t, received, 2)
+	assert.Contains(t, received, "/all")
+	assert.Contains(t, received, "/support")
+}
+
+func TestNotifyApps_NoWebhooks(t *testing.T) {
+	err := NotifyApps(context.TODO(), &mockAppWebhooksAPI{}, &Hook{Event: EventEmail, Action: ActionReceived}, nil)
+	assert.Nil(t, err)
+}
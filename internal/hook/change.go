@@ -0,0 +1,32 @@
+package hook
+
+import (
+	"context"
+	"time"
+)
+
+// SendEmailWebhook sends the webhook of a change of an email, e.g. ActionRead, if webhook is enabled.
+// The event and the timestamp of data are set by it.
+func SendEmailWebhook(ctx context.Context, data *Hook) error {
+	data.Event = EventEmail
+	data.Timestamp = getCurrentTime().Format(time.RFC3339)
+	return SendWebhook(ctx, data)
+}
+
+// SendBatchWebhook sends the hooks of the emails changed by a batch request in a single webhook, if webhook is enabled
+func SendBatchWebhook(ctx context.Context, hooks []Hook) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	timestamp := getCurrentTime().Format(time.RFC3339)
+	for i := range hooks {
+		hooks[i].Event = EventEmail
+		hooks[i].Timestamp = timestamp
+	}
+	return SendWebhook(ctx, &Hook{
+		Event:     EventBatch,
+		Action:    ActionChanged,
+		Timestamp: timestamp,
+		Batch:     hooks,
+	})
+}
@@ -0,0 +1,54 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendBatchWebhook(t *testing.T) {
+	getCurrentTime = func() time.Time {
+		return time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	}
+	defer func() { getCurrentTime = func() time.Time { return time.Now().UTC() } }()
+
+	var received []Hook
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var data Hook
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&data))
+		received = append(received, data)
+	}))
+	defer server.Close()
+
+	env.EgressAllowPrivate = "true"
+	env.WebhookURL = server.URL
+	defer func() {
+		env.EgressAllowPrivate = ""
+		env.WebhookURL = ""
+	}()
+
+	// batches that changed no emails aren't sent
+	assert.Nil(t, SendBatchWebhook(context.Background(), nil))
+	assert.Empty(t, received)
+
+	err := SendBatchWebhook(context.Background(), []Hook{
+		{Action: ActionMoved, Email: Email{ID: "1"}, Folder: "archived"},
+		{Action: ActionMoved, Email: Email{ID: "2"}, Folder: "archived"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []Hook{{
+		Event:     EventBatch,
+		Action:    ActionChanged,
+		Timestamp: "2024-06-01T12:00:00Z",
+		Batch: []Hook{
+			{Event: EventEmail, Action: ActionMoved, Timestamp: "2024-06-01T12:00:00Z", Email: Email{ID: "1"}, Folder: "archived"},
+			{Event: EventEmail, Action: ActionMoved, Timestamp: "2024-06-01T12:00:00Z", Email: Email{ID: "2"}, Folder: "archived"},
+		},
+	}}, received)
+}
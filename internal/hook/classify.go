@@ -0,0 +1,194 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/harryzcy/mailbox/internal/util/egress"
+)
+
+// Limits of the request and response of the classification service
+const (
+	// MaxClassificationTextSize is the maximum size of the text sent to the classification service, longer texts are truncated
+	MaxClassificationTextSize = 64 << 10
+	// MaxClassificationRawSize is the maximum size of raw emails sent to the classification service, larger ones are left out
+	MaxClassificationRawSize = 5 << 20
+	// MaxScores is the maximum number of scores kept, with names up to MaxScoreNameLength bytes
+	MaxScores          = 20
+	MaxScoreNameLength = 64
+
+	maxClassificationResponseSize = 64 << 10
+)
+
+// ErrClassificationFailed is returned when the classification service responds with an error
+var ErrClassificationFailed = errors.New("classification failed")
+
+// ClassificationRequest is sent to the classification service when an email is received.
+// It has the features extracted by the MIME parser, and the raw email if CLASSIFICATION_RAW is true.
+type ClassificationRequest struct {
+	MessageID    string                     `json:"messageID"`
+	TimeReceived string                     `json:"timeReceived"`
+	Subject      string                     `json:"subject"`
+	Source       string                     `json:"source"` // envelope sender
+	From         []string                   `json:"from"`   // addresses only, without display names
+	To           []string                   `json:"to"`
+	Cc           []string                   `json:"cc,omitempty"`
+	Text         string                     `json:"text"` // truncated to MaxClassificationTextSize
+	Attachments  []ClassificationAttachment `json:"attachments,omitempty"`
+	Verdict      ClassificationVerdict      `json:"verdict"`
+	Size         int64                      `json:"size"`          // size of the raw email in bytes
+	Raw          []byte                     `json:"raw,omitempty"` // base64 encoded raw email
+}
+
+// ClassificationAttachment describes an attachment of a classified email, without its content
+type ClassificationAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// ClassificationVerdict has the verdicts of SES, which are true if they pass
+type ClassificationVerdict struct {
+	Spam  bool `json:"spam"`
+	Virus bool `json:"virus"`
+	SPF   bool `json:"spf"`
+	DKIM  bool `json:"dkim"`
+	DMARC bool `json:"dmarc"`
+}
+
+// ClassificationResponse is expected from the classification service
+type ClassificationResponse struct {
+	Labels []string     `json:"labels"`
+	Scores types.Scores `json:"scores"`
+}
+
+// ClassificationEnabled returns true if the classification service is configured
+func ClassificationEnabled() bool {
+	return env.ClassificationURL != ""
+}
+
+// ClassificationRawEnabled returns true if raw emails are sent to the classification service
+func ClassificationRawEnabled() bool {
+	return env.ClassificationRaw == "true"
+}
+
+// classificationEndpoint returns the classification service configured by environment variables
+func classificationEndpoint() (WebhookEndpoint, error) {
+	endpoint := WebhookEndpoint{
+		URL:         env.ClassificationURL,
+		Proxy:       env.WebhookProxy,
+		TLSSecretID: env.ClassificationTLSSecret,
+	}
+	if env.ClassificationTimeout != "" {
+		timeout, err := time.ParseDuration(env.ClassificationTimeout)
+		if err != nil || timeout <= 0 {
+			return WebhookEndpoint{}, ErrInvalidWebhookTimeout
+		}
+		endpoint.Timeout = timeout
+	}
+	return endpoint, nil
+}
+
+// Classify asks the configured classification service for labels and scores of a received email,
+// e.g. from a user's own spam or priority model. If classification is not enabled, it does nothing and returns nil.
+func Classify(ctx context.Context, data *ClassificationRequest) (*ClassificationResponse, error) {
+	if !ClassificationEnabled() {
+		return nil, nil
+	}
+
+	endpoint, err := classificationEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return nil, err
+	}
+	if err := egress.FromEnv().CheckURL(u); err != nil {
+		return nil, err
+	}
+	client, err := webhookClient(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data.Text) > MaxClassificationTextSize {
+		data.Text = truncateUTF8(data.Text, MaxClassificationTextSize)
+	}
+	body := new(bytes.Buffer)
+	err = json.NewEncoder(body).Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrClassificationFailed, res.Status)
+	}
+
+	var result ClassificationResponse
+	err = json.NewDecoder(io.LimitReader(res.Body, maxClassificationResponseSize)).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClassificationFailed, err)
+	}
+	result.Scores = limitScores(result.Scores)
+	return &result, nil
+}
+
+// limitScores drops empty names, non-finite values, and the entries beyond the limits, keeping the first names in sorted order
+func limitScores(scores types.Scores) types.Scores {
+	names := make([]string, 0, len(scores))
+	for k := range scores {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	limited := make(types.Scores, len(scores))
+	for _, k := range names {
+		v := scores[k]
+		if k == "" || len(k) > MaxScoreNameLength || math.IsNaN(v) || math.IsInf(v, 0) {
+			fmt.Printf("score %q dropped: invalid name or value\n", k)
+			continue
+		}
+		if len(limited) == MaxScores {
+			fmt.Printf("scores dropped: more than %d\n", MaxScores)
+			break
+		}
+		limited[k] = v
+	}
+	if len(limited) == 0 {
+		return nil
+	}
+	return limited
+}
+
+// truncateUTF8 truncates s to at most n bytes, without splitting a UTF-8 encoded character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
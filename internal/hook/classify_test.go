@@ -0,0 +1,116 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	defer func() {
+		env.ClassificationURL = ""
+		env.EgressAllowPrivate = ""
+	}()
+	env.EgressAllowPrivate = "true" // the test server listens on loopback
+
+	tests := []struct {
+		status      int
+		response    string
+		expected    *ClassificationResponse
+		expectedErr bool
+	}{
+		{
+			status:   http.StatusOK,
+			response: `{"labels":["newsletter"],"scores":{"spam":0.1,"priority":0.8}}`,
+			expected: &ClassificationResponse{Labels: []string{"newsletter"}, Scores: types.Scores{"spam": 0.1, "priority": 0.8}},
+		},
+		{
+			status:   http.StatusOK,
+			response: `{}`,
+			expected: &ClassificationResponse{},
+		},
+		{
+			status:      http.StatusInternalServerError,
+			response:    `error`,
+			expectedErr: true,
+		},
+		{
+			status:      http.StatusOK,
+			response:    `{"scores":{"spam":"high"}}`,
+			expectedErr: true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				var data ClassificationRequest
+				err := json.NewDecoder(req.Body).Decode(&data)
+				assert.Nil(t, err)
+				assert.Equal(t, "exampleMessageID", data.MessageID)
+				assert.Equal(t, "raw email", string(data.Raw))
+				assert.Len(t, data.Text, MaxClassificationTextSize)
+
+				rw.WriteHeader(test.status)
+				_, err = rw.Write([]byte(test.response))
+				assert.Nil(t, err)
+			}))
+			defer server.Close()
+			env.ClassificationURL = server.URL
+
+			result, err := Classify(context.Background(), &ClassificationRequest{
+				MessageID: "exampleMessageID",
+				Text:      strings.Repeat("a", MaxClassificationTextSize+1),
+				Raw:       []byte("raw email"),
+			})
+			assert.Equal(t, test.expectedErr, err != nil, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestClassify_NoOp(t *testing.T) {
+	env.ClassificationURL = ""
+	result, err := Classify(context.Background(), &ClassificationRequest{MessageID: "exampleMessageID"})
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+}
+
+func TestLimitScores(t *testing.T) {
+	scores := types.Scores{
+		"":                      1,
+		strings.Repeat("k", 65): 1,
+		"nan":                   math.NaN(),
+		"inf":                   math.Inf(1),
+		strings.Repeat("k", 64): 0.5,
+		"spam":                  0.9,
+	}
+	assert.Equal(t, types.Scores{
+		strings.Repeat("k", 64): 0.5,
+		"spam":                  0.9,
+	}, limitScores(scores))
+
+	many := make(types.Scores)
+	for i := 0; i < MaxScores+10; i++ {
+		many["score"+strconv.Itoa(100+i)] = 1
+	}
+	limited := limitScores(many)
+	assert.Len(t, limited, MaxScores)
+	assert.Contains(t, limited, "score100")
+	assert.NotContains(t, limited, "score129")
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	assert.Equal(t, "ab", truncateUTF8("ab", 5))
+	assert.Equal(t, "a", truncateUTF8("a€", 3))
+	assert.Equal(t, "a€", truncateUTF8("a€b", 4))
+}
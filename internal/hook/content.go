@@ -1,8 +1,28 @@
 package hook
 
 const (
-	EventEmail     = "email"
-	ActionReceived = "received"
+	EventEmail        = "email"
+	ActionReceived    = "received"
+	ActionSent        = "sent"        // only delivered to notifiers recording sent emails, not as webhooks
+	ActionRuleMatched = "ruleMatched" // only sent to the webhooks of the filtering rules that match a received email
+	ActionRead        = "read"        // changes of emails made through the API, only sent to the webhook of the mailbox owner
+	ActionUnread      = "unread"
+	ActionMoved       = "moved" // archived, unarchived, trashed or untrashed, with the state it's moved to in Folder
+	ActionLabeled     = "labeled"
+
+	EventSecurity            = "security"
+	ActionAttachmentsBlocked = "attachmentsBlocked" // dangerous attachments were stripped, quarantined, or the email was blocked
+
+	EventComplaint = "complaint" // with ActionReceived, a feedback report is received at ABUSE_ADDRESS
+
+	EventDraft    = "draft" // changes of drafts made through the API, only sent to the webhook of the mailbox owner
+	ActionCreated = "created"
+	ActionUpdated = "updated" // saved or patched, including autosaves
+	ActionDeleted = "deleted" // deleted without being sent
+
+	EventBatch     = "batch"
+	ActionDeferred = "deferred" // hooks deferred by quiet hours, in the order they happened
+	ActionChanged  = "changed"  // hooks of the emails changed by a batch request
 )
 
 // EmailReceipt contains information needed for an email receipt
@@ -12,12 +32,45 @@ type EmailReceipt struct {
 }
 
 type Hook struct {
-	Event     string `json:"event"`
-	Action    string `json:"action"`
-	Timestamp string `json:"timestamp"`
-	Email     Email
+	Event       string `json:"event"`
+	Action      string `json:"action"`
+	Timestamp   string `json:"timestamp"`
+	Environment string `json:"environment,omitempty"` // ENVIRONMENT of the deployment, if set
+	Email       Email
+	Security    *Security  `json:"security,omitempty"`
+	Complaint   *Complaint `json:"complaint,omitempty"`
+	Rule        *Rule      `json:"rule,omitempty"`
+	Folder      string     `json:"folder,omitempty"` // lifecycle state of a moved email, e.g. archived
+	Labels      *Labels    `json:"labels,omitempty"`
+	Batch       []Hook     `json:"batch,omitempty"`
 }
 
 type Email struct {
 	ID string `json:"id"` // message id
 }
+
+// Security describes the action taken by a security policy
+type Security struct {
+	Policy      string   `json:"policy"`      // e.g. strip, quarantine, block
+	Attachments []string `json:"attachments"` // filenames of the affected attachments
+}
+
+// Complaint describes a feedback report of recipients who complained about a sent email, e.g. marked it as spam
+type Complaint struct {
+	FeedbackType      string   `json:"feedbackType"`          // e.g. abuse, fraud, virus, other
+	Complainants      []string `json:"complainants"`          // addresses added to the suppression list, empty if redacted
+	OriginalMessageID string   `json:"originalMessageID"`     // Message-ID header of the email complained about
+	SentEmailID       string   `json:"sentEmailID,omitempty"` // ID of the sent email complained about, if found
+}
+
+// Labels are the labels added to and removed from an email
+type Labels struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// Rule is the filtering rule whose webhook action sends a hook
+type Rule struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
@@ -0,0 +1,17 @@
+package hook
+
+import (
+	"context"
+	"time"
+)
+
+// SendDraftWebhook sends the webhook of a change of a draft, e.g. ActionCreated, if webhook is enabled.
+// Drafts are changed by API requests, so it's called by the functions that change them.
+func SendDraftWebhook(ctx context.Context, action, messageID string) error {
+	return SendWebhook(ctx, &Hook{
+		Event:     EventDraft,
+		Action:    action,
+		Timestamp: getCurrentTime().Format(time.RFC3339),
+		Email:     Email{ID: messageID},
+	})
+}
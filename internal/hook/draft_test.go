@@ -0,0 +1,42 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendDraftWebhook(t *testing.T) {
+	getCurrentTime = func() time.Time {
+		return time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	}
+	defer func() { getCurrentTime = func() time.Time { return time.Now().UTC() } }()
+
+	var received Hook
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	env.EgressAllowPrivate = "true"
+	env.WebhookURL = server.URL
+	defer func() {
+		env.EgressAllowPrivate = ""
+		env.WebhookURL = ""
+	}()
+
+	err := SendDraftWebhook(context.Background(), ActionUpdated, "draft-123")
+	assert.Nil(t, err)
+	assert.Equal(t, Hook{
+		Event:     EventDraft,
+		Action:    ActionUpdated,
+		Timestamp: "2024-06-01T12:00:00Z",
+		Email:     Email{ID: "draft-123"},
+	}, received)
+}
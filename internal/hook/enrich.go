@@ -0,0 +1,146 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/harryzcy/mailbox/internal/util/egress"
+)
+
+// Limits of the annotations returned by the enrichment endpoint, entries beyond them are dropped
+const (
+	MaxAnnotations           = 50
+	MaxAnnotationKeyLength   = 64
+	MaxAnnotationValueLength = 1024
+
+	maxEnrichmentResponseSize = 64 << 10
+)
+
+// ErrEnrichmentFailed is returned when the enrichment endpoint responds with an error
+var ErrEnrichmentFailed = errors.New("enrichment failed")
+
+// EnrichmentRequest is sent to the enrichment endpoint when an email is received
+type EnrichmentRequest struct {
+	MessageID    string   `json:"messageID"`
+	TimeReceived string   `json:"timeReceived"`
+	Subject      string   `json:"subject"`
+	Source       string   `json:"source"` // envelope sender
+	From         []string `json:"from"`   // addresses only, without display names
+	To           []string `json:"to"`
+	Cc           []string `json:"cc,omitempty"`
+}
+
+// EnrichmentResponse is expected from the enrichment endpoint
+type EnrichmentResponse struct {
+	Annotations types.Annotations `json:"annotations"`
+}
+
+// enrichmentEnabled returns true if enrichment is enabled
+func enrichmentEnabled() bool {
+	return env.EnrichmentURL != ""
+}
+
+// enrichmentEndpoint returns the enrichment endpoint configured by environment variables
+func enrichmentEndpoint() (WebhookEndpoint, error) {
+	endpoint := WebhookEndpoint{
+		URL:         env.EnrichmentURL,
+		Proxy:       env.WebhookProxy,
+		TLSSecretID: env.EnrichmentTLSSecret,
+	}
+	if env.EnrichmentTimeout != "" {
+		timeout, err := time.ParseDuration(env.EnrichmentTimeout)
+		if err != nil || timeout <= 0 {
+			return WebhookEndpoint{}, ErrInvalidWebhookTimeout
+		}
+		endpoint.Timeout = timeout
+	}
+	return endpoint, nil
+}
+
+// Enrich asks the configured enrichment endpoint for annotations of a received email, e.g. a CRM lookup by sender.
+// If enrichment is not enabled, it does nothing and returns nil.
+func Enrich(ctx context.Context, data *EnrichmentRequest) (types.Annotations, error) {
+	if !enrichmentEnabled() {
+		return nil, nil
+	}
+
+	endpoint, err := enrichmentEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return nil, err
+	}
+	if err := egress.FromEnv().CheckURL(u); err != nil {
+		return nil, err
+	}
+	client, err := webhookClient(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	body := new(bytes.Buffer)
+	err = json.NewEncoder(body).Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrEnrichmentFailed, res.Status)
+	}
+
+	var result EnrichmentResponse
+	err = json.NewDecoder(io.LimitReader(res.Body, maxEnrichmentResponseSize)).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEnrichmentFailed, err)
+	}
+	return limitAnnotations(result.Annotations), nil
+}
+
+// limitAnnotations drops empty keys and the entries beyond the limits, keeping the first keys in sorted order
+func limitAnnotations(annotations types.Annotations) types.Annotations {
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	limited := make(types.Annotations, len(annotations))
+	for _, k := range keys {
+		v := annotations[k]
+		if k == "" || len(k) > MaxAnnotationKeyLength || len(v) > MaxAnnotationValueLength {
+			fmt.Printf("annotation %q dropped: key or value too long\n", k)
+			continue
+		}
+		if len(limited) == MaxAnnotations {
+			fmt.Printf("annotations dropped: more than %d\n", MaxAnnotations)
+			break
+		}
+		limited[k] = v
+	}
+	if len(limited) == 0 {
+		return nil
+	}
+	return limited
+}
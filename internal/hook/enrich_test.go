@@ -0,0 +1,121 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrich(t *testing.T) {
+	defer func() {
+		env.EnrichmentURL = ""
+		env.EnrichmentTimeout = ""
+		env.EgressAllowPrivate = ""
+	}()
+	env.EgressAllowPrivate = "true" // the test server listens on loopback
+
+	tests := []struct {
+		status      int
+		response    string
+		expected    types.Annotations
+		expectedErr bool
+	}{
+		{
+			status:   http.StatusOK,
+			response: `{"annotations":{"crmID":"42","company":"Example Inc."}}`,
+			expected: types.Annotations{"crmID": "42", "company": "Example Inc."},
+		},
+		{
+			status:   http.StatusOK,
+			response: `{"annotations":{}}`,
+			expected: nil,
+		},
+		{
+			status:      http.StatusNotFound,
+			response:    `not found`,
+			expectedErr: true,
+		},
+		{
+			status:      http.StatusOK,
+			response:    `{"annotations":{"crmID":42}}`,
+			expectedErr: true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				var data EnrichmentRequest
+				err := json.NewDecoder(req.Body).Decode(&data)
+				assert.Nil(t, err)
+				assert.Equal(t, "exampleMessageID", data.MessageID)
+				assert.Equal(t, []string{"alice@example.com"}, data.From)
+
+				rw.WriteHeader(test.status)
+				_, err = rw.Write([]byte(test.response))
+				assert.Nil(t, err)
+			}))
+			defer server.Close()
+			env.EnrichmentURL = server.URL
+
+			annotations, err := Enrich(context.Background(), &EnrichmentRequest{
+				MessageID: "exampleMessageID",
+				From:      []string{"alice@example.com"},
+			})
+			assert.Equal(t, test.expectedErr, err != nil, err)
+			assert.Equal(t, test.expected, annotations)
+		})
+	}
+}
+
+func TestEnrich_NoOp(t *testing.T) {
+	env.EnrichmentURL = ""
+	annotations, err := Enrich(context.Background(), &EnrichmentRequest{MessageID: "exampleMessageID"})
+	assert.Nil(t, err)
+	assert.Nil(t, annotations)
+}
+
+func TestEnrich_InvalidTimeout(t *testing.T) {
+	defer func() {
+		env.EnrichmentURL = ""
+		env.EnrichmentTimeout = ""
+	}()
+	env.EnrichmentURL = "https://crm.example.com/enrich"
+	env.EnrichmentTimeout = "5"
+
+	_, err := Enrich(context.Background(), &EnrichmentRequest{MessageID: "exampleMessageID"})
+	assert.Equal(t, ErrInvalidWebhookTimeout, err)
+}
+
+func TestLimitAnnotations(t *testing.T) {
+	annotations := types.Annotations{
+		"":                      "empty key",
+		strings.Repeat("k", 65): "long key",
+		"long":                  strings.Repeat("v", 1025),
+		strings.Repeat("k", 64): "max key",
+		"max":                   strings.Repeat("v", 1024),
+		"crmID":                 "42",
+	}
+	assert.Equal(t, types.Annotations{
+		strings.Repeat("k", 64): "max key",
+		"max":                   strings.Repeat("v", 1024),
+		"crmID":                 "42",
+	}, limitAnnotations(annotations))
+
+	many := make(types.Annotations)
+	for i := 0; i < MaxAnnotations+10; i++ {
+		many["key"+strconv.Itoa(100+i)] = "value"
+	}
+	limited := limitAnnotations(many)
+	assert.Len(t, limited, MaxAnnotations)
+	assert.Contains(t, limited, "key100")
+	assert.NotContains(t, limited, "key159")
+}
@@ -0,0 +1,177 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/ctxutil"
+)
+
+// deferredID is the MessageID of the item storing the hooks deferred by quiet hours in the email table
+const deferredID = "hook#deferred"
+
+// DefaultHookTimeout is the timeout of sending a hook to all its receivers if HOOK_TIMEOUT is not set
+const DefaultHookTimeout = 10 * time.Second
+
+var getCurrentTime = func() time.Time {
+	return time.Now().UTC()
+}
+
+// Notifier delivers hooks other than the webhook, e.g. push notifications to mobile devices
+type Notifier interface {
+	Enabled() bool
+	Notify(ctx context.Context, data *Hook) error
+}
+
+// deliver sends the notifications of a hook through the webhook and the enabled notifiers, within HOOK_TIMEOUT.
+// The remaining notifiers are skipped once it times out.
+var deliver = func(ctx context.Context, data *Hook, notifiers []Notifier) error {
+	ctx, cancel := ctxutil.WithTimeout(ctx, env.HookTimeout, DefaultHookTimeout)
+	defer cancel()
+
+	var errs []error
+	if webhookEnabled() {
+		errs = append(errs, SendWebhook(ctx, data))
+	}
+	for _, notifier := range notifiers {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if notifier.Enabled() {
+			errs = append(errs, notifier.Notify(ctx, data))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notificationsEnabled returns true if the webhook or any of the notifiers is enabled
+func notificationsEnabled(notifiers []Notifier) bool {
+	if webhookEnabled() {
+		return true
+	}
+	for _, notifier := range notifiers {
+		if notifier.Enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify sends the notifications of a hook, i.e. the webhook and the notifiers.
+// During quiet hours, the hook is deferred and sent in a batch by Flush when they are over.
+func Notify(ctx context.Context, client api.UpdateItemAPI, data *Hook, notifiers ...Notifier) error {
+	if !notificationsEnabled(notifiers) {
+		return nil
+	}
+	if !ScheduleFromEnv().Quiet(getCurrentTime()) {
+		return deliver(ctx, data, notifiers)
+	}
+
+	fmt.Printf("deferring %s/%s hook in quiet hours\n", data.Event, data.Action)
+	err := deferHooks(ctx, client, []Hook{*data})
+	if err != nil {
+		// rather notify during quiet hours than not at all
+		fmt.Printf("failed to defer hook, sending it now, %v\n", err)
+		return deliver(ctx, data, notifiers)
+	}
+	return nil
+}
+
+// Flush sends the deferred hooks in a batch, unless it's still quiet, and returns the number of hooks sent.
+// It's meant to be invoked on a schedule, with the same notifiers as Notify.
+func Flush(ctx context.Context, client api.UpdateItemAPI, notifiers ...Notifier) (int, error) {
+	if ScheduleFromEnv().Quiet(getCurrentTime()) {
+		return 0, nil
+	}
+
+	resp, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: deferredID},
+		},
+		UpdateExpression: aws.String("REMOVE Hooks"),
+		ReturnValues:     types.ReturnValueUpdatedOld,
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return 0, api.ErrTooManyRequests
+		}
+		return 0, err
+	}
+
+	list, _ := resp.Attributes["Hooks"].(*types.AttributeValueMemberL)
+	if list == nil || len(list.Value) == 0 {
+		return 0, nil
+	}
+	hooks := make([]Hook, 0, len(list.Value))
+	for _, av := range list.Value {
+		s, ok := av.(*types.AttributeValueMemberS)
+		if !ok {
+			continue
+		}
+		var hook Hook
+		if err := json.Unmarshal([]byte(s.Value), &hook); err != nil {
+			fmt.Printf("invalid deferred hook, %v\n", err)
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+	if len(hooks) == 0 {
+		return 0, nil
+	}
+
+	err = deliver(ctx, &Hook{
+		Event:     EventBatch,
+		Action:    ActionDeferred,
+		Timestamp: getCurrentTime().Format(time.RFC3339),
+		Batch:     hooks,
+	}, notifiers)
+	if err != nil {
+		// keep them for the next flush
+		if deferErr := deferHooks(ctx, client, hooks); deferErr != nil {
+			fmt.Printf("failed to defer hooks again, %v\n", deferErr)
+		}
+		return 0, err
+	}
+	return len(hooks), nil
+}
+
+// deferHooks appends hooks to the deferred hooks
+func deferHooks(ctx context.Context, client api.UpdateItemAPI, hooks []Hook) error {
+	values := make([]types.AttributeValue, len(hooks))
+	for i, hook := range hooks {
+		data, err := json.Marshal(hook)
+		if err != nil {
+			return err
+		}
+		values[i] = &types.AttributeValueMemberS{Value: string(data)}
+	}
+
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: deferredID},
+		},
+		UpdateExpression: aws.String("SET Hooks = list_append(if_not_exists(Hooks, :empty), :hooks)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":empty": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+			":hooks": &types.AttributeValueMemberL{Value: values},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockDeferredAPI stores the deferred hooks like DynamoDB
+type mockDeferredAPI struct {
+	hooks []types.AttributeValue
+	err   error
+}
+
+func (m *mockDeferredAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if *params.UpdateExpression == "REMOVE Hooks" {
+		output := &dynamodb.UpdateItemOutput{}
+		if m.hooks != nil {
+			output.Attributes = map[string]types.AttributeValue{"Hooks": &types.AttributeValueMemberL{Value: m.hooks}}
+		}
+		m.hooks = nil
+		return output, nil
+	}
+	m.hooks = append(m.hooks, params.ExpressionAttributeValues[":hooks"].(*types.AttributeValueMemberL).Value...)
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+var defaultDeliver = deliver
+
+func TestNotify(t *testing.T) {
+	env.WebhookURL = "https://hooks.example.com"
+	env.NotificationQuietHours = "22:00-07:00"
+	defer func() {
+		env.WebhookURL, env.NotificationQuietHours = "", ""
+		deliver = defaultDeliver
+		getCurrentTime = func() time.Time { return time.Now().UTC() }
+	}()
+
+	var delivered []*Hook
+	var deliverErr error
+	deliver = func(_ context.Context, data *Hook, _ []Notifier) error {
+		if deliverErr != nil {
+			return deliverErr
+		}
+		delivered = append(delivered, data)
+		return nil
+	}
+	client := &mockDeferredAPI{}
+	ctx := context.TODO()
+
+	// outside quiet hours, hooks are sent right away
+	getCurrentTime = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	assert.Nil(t, Notify(ctx, client, &Hook{Event: EventEmail, Action: ActionReceived, Email: Email{ID: "1"}}))
+	assert.Len(t, delivered, 1)
+
+	// in quiet hours, they are deferred
+	getCurrentTime = func() time.Time { return time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC) }
+	assert.Nil(t, Notify(ctx, client, &Hook{Event: EventEmail, Action: ActionReceived, Email: Email{ID: "2"}}))
+	assert.Nil(t, Notify(ctx, client, &Hook{Event: EventEmail, Action: ActionReceived, Email: Email{ID: "3"}}))
+	assert.Len(t, delivered, 1)
+	assert.Len(t, client.hooks, 2)
+
+	count, err := Flush(ctx, client)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count) // still quiet
+
+	// a failed batch is kept for the next flush
+	getCurrentTime = func() time.Time { return time.Date(2024, 5, 2, 7, 0, 0, 0, time.UTC) }
+	deliverErr = errors.New("unavailable")
+	_, err = Flush(ctx, client)
+	assert.Equal(t, deliverErr, err)
+	assert.Len(t, client.hooks, 2)
+
+	deliverErr = nil
+	count, err = Flush(ctx, client)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Len(t, delivered, 2)
+	assert.Equal(t, EventBatch, delivered[1].Event)
+	assert.Equal(t, ActionDeferred, delivered[1].Action)
+	assert.Equal(t, "2024-05-02T07:00:00Z", delivered[1].Timestamp)
+	assert.Equal(t, []Hook{
+		{Event: EventEmail, Action: ActionReceived, Email: Email{ID: "2"}},
+		{Event: EventEmail, Action: ActionReceived, Email: Email{ID: "3"}},
+	}, delivered[1].Batch)
+
+	count, err = Flush(ctx, client)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	// hooks are sent if they can't be deferred
+	getCurrentTime = func() time.Time { return time.Date(2024, 5, 2, 23, 0, 0, 0, time.UTC) }
+	client.err = errors.New("throttled")
+	assert.Nil(t, Notify(ctx, client, &Hook{Event: EventEmail, Action: ActionReceived, Email: Email{ID: "4"}}))
+	assert.Len(t, delivered, 3)
+}
+
+func TestNotify_NoOp(t *testing.T) {
+	env.WebhookURL = ""
+	assert.Nil(t, Notify(context.TODO(), nil, &Hook{}))
+	assert.Nil(t, Notify(context.TODO(), nil, &Hook{}, &mockNotifier{}))
+}
+
+type mockNotifier struct {
+	enabled bool
+	err     error
+	hooks   []*Hook
+}
+
+func (m *mockNotifier) Enabled() bool {
+	return m.enabled
+}
+
+func (m *mockNotifier) Notify(_ context.Context, data *Hook) error {
+	m.hooks = append(m.hooks, data)
+	return m.err
+}
+
+func TestNotify_Notifiers(t *testing.T) {
+	env.WebhookURL = ""
+	env.NotificationQuietHours = ""
+	push := &mockNotifier{enabled: true, err: errors.New("unavailable")}
+	disabled := &mockNotifier{}
+
+	err := Notify(context.TODO(), nil, &Hook{Event: EventEmail, Action: ActionReceived}, push, disabled)
+	assert.ErrorIs(t, err, push.err)
+	assert.Len(t, push.hooks, 1)
+	assert.Empty(t, disabled.hooks)
+}
+
+// hangingNotifier blocks until the context is done
+type hangingNotifier struct{}
+
+func (hangingNotifier) Enabled() bool {
+	return true
+}
+
+func (hangingNotifier) Notify(ctx context.Context, _ *Hook) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestNotify_Timeout(t *testing.T) {
+	env.WebhookURL = ""
+	env.NotificationQuietHours = ""
+	env.HookTimeout = "10ms"
+	defer func() { env.HookTimeout = "" }()
+	push := &mockNotifier{enabled: true}
+
+	err := Notify(context.TODO(), nil, &Hook{Event: EventEmail, Action: ActionReceived}, hangingNotifier{}, push)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, push.hooks)
+}
@@ -0,0 +1,105 @@
+package hook
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// Schedule is when notifications are quiet, i.e. deferred until the quiet time is over
+type Schedule struct {
+	// Quiet hours as offsets from midnight, where Start after End spans midnight, e.g. 22:00-07:00.
+	// There are no quiet hours if Start equals End.
+	Start time.Duration
+	End   time.Duration
+	// Days that are quiet all day, e.g. weekends
+	Days     map[time.Weekday]bool
+	Location *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ScheduleFromEnv returns the schedule from NOTIFICATION_QUIET_HOURS, e.g. 22:00-07:00,
+// and NOTIFICATION_QUIET_DAYS, e.g. sat,sun, in the time zone of the mailbox.
+// Invalid values are ignored, so that notifications are not lost.
+func ScheduleFromEnv() Schedule {
+	schedule, err := ParseSchedule(env.NotificationQuietHours, env.NotificationQuietDays, format.Location())
+	if err != nil {
+		fmt.Printf("invalid notification schedule, quiet hours are disabled, %v\n", err)
+		return Schedule{Location: format.Location()}
+	}
+	return schedule
+}
+
+// ParseSchedule parses quiet hours in the HH:MM-HH:MM format and comma separated weekdays, e.g. sat,sun
+func ParseSchedule(hours, days string, loc *time.Location) (Schedule, error) {
+	schedule := Schedule{Days: make(map[time.Weekday]bool), Location: loc}
+
+	if hours = strings.TrimSpace(hours); hours != "" {
+		start, end, ok := strings.Cut(hours, "-")
+		if !ok {
+			return Schedule{}, fmt.Errorf("quiet hours %q are not in the HH:MM-HH:MM format", hours)
+		}
+		var err error
+		if schedule.Start, err = parseClock(start); err != nil {
+			return Schedule{}, err
+		}
+		if schedule.End, err = parseClock(end); err != nil {
+			return Schedule{}, err
+		}
+	}
+
+	for _, day := range strings.Split(days, ",") {
+		day = strings.ToLower(strings.TrimSpace(day))
+		if day == "" {
+			continue
+		}
+		weekday, ok := weekdays[day]
+		if !ok {
+			return Schedule{}, fmt.Errorf("invalid weekday %q, expected one of sun, mon, tue, wed, thu, fri, sat", day)
+		}
+		schedule.Days[weekday] = true
+	}
+	return schedule, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Quiet returns true if notifications at t are deferred
+func (s Schedule) Quiet(t time.Time) bool {
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := t.In(loc)
+	if s.Days[local.Weekday()] {
+		return true
+	}
+	if s.Start == s.End {
+		return false
+	}
+
+	// wall clock time, which differs from the time since midnight on daylight saving days
+	offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+	if s.Start < s.End {
+		return offset >= s.Start && offset < s.End
+	}
+	return offset >= s.Start || offset < s.End
+}
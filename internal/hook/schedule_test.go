@@ -0,0 +1,79 @@
+package hook
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		hours    string
+		days     string
+		expected Schedule
+		err      string
+	}{
+		{"", "", Schedule{Days: map[time.Weekday]bool{}, Location: time.UTC}, ""},
+		{
+			"22:00-07:30", " Sat, sun ",
+			Schedule{
+				Start: 22 * time.Hour, End: 7*time.Hour + 30*time.Minute,
+				Days:     map[time.Weekday]bool{time.Saturday: true, time.Sunday: true},
+				Location: time.UTC,
+			}, "",
+		},
+		{"22:00", "", Schedule{}, `quiet hours "22:00" are not in the HH:MM-HH:MM format`},
+		{"22:00-25:00", "", Schedule{}, `invalid time "25:00", expected HH:MM`},
+		{"", "saturday", Schedule{}, `invalid weekday "saturday", expected one of sun, mon, tue, wed, thu, fri, sat`},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			schedule, err := ParseSchedule(test.hours, test.days, time.UTC)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, schedule)
+		})
+	}
+}
+
+func TestSchedule_Quiet(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.Nil(t, err)
+
+	overnight, _ := ParseSchedule("22:00-07:00", "", time.UTC)
+	daytime, _ := ParseSchedule("09:00-17:00", "", time.UTC)
+	weekends, _ := ParseSchedule("", "sat,sun", time.UTC)
+	local, _ := ParseSchedule("22:00-07:00", "", newYork)
+
+	tests := []struct {
+		schedule Schedule
+		time     time.Time
+		expected bool
+	}{
+		{Schedule{}, time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC), false},
+		{overnight, time.Date(2024, 5, 1, 21, 59, 0, 0, time.UTC), false},
+		{overnight, time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC), true},
+		{overnight, time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC), true},
+		{overnight, time.Date(2024, 5, 2, 7, 0, 0, 0, time.UTC), false},
+		{daytime, time.Date(2024, 5, 1, 8, 59, 0, 0, time.UTC), false},
+		{daytime, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), true},
+		{daytime, time.Date(2024, 5, 1, 17, 0, 0, 0, time.UTC), false},
+		{weekends, time.Date(2024, 5, 4, 12, 0, 0, 0, time.UTC), true},  // Saturday
+		{weekends, time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC), false}, // Monday
+		{local, time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC), true},      // 23:00 in New York
+		{local, time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC), false},    // 08:00 in New York
+		{local, time.Date(2024, 3, 10, 7, 30, 0, 0, time.UTC), true},    // 03:30 on a daylight saving day
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, test.schedule.Quiet(test.time))
+		})
+	}
+}
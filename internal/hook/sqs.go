@@ -8,8 +8,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
-	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/queue"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/ctxutil"
 )
 
 // sqsEnabled returns true if SQS is enabled
@@ -19,7 +20,7 @@ func sqsEnabled() bool {
 
 // SendSQS sends an email receipt to SQS, if SQS is enabled.
 // Otherwise, it does nothing.
-func SendSQS(ctx context.Context, api api.SQSSendMessageAPI, input EmailReceipt) error {
+func SendSQS(ctx context.Context, api queue.SendMessageAPI, input EmailReceipt) error {
 	if !sqsEnabled() {
 		return nil
 	}
@@ -36,7 +37,10 @@ func SendSQS(ctx context.Context, api api.SQSSendMessageAPI, input EmailReceipt)
 }
 
 // sendSQSEmailNotification notifies about a change of state of an email, categorized by event.
-func sendSQSEmailNotification(ctx context.Context, api api.SQSSendMessageAPI, input Hook) error {
+func sendSQSEmailNotification(ctx context.Context, api queue.SendMessageAPI, input Hook) error {
+	ctx, cancel := ctxutil.WithTimeout(ctx, env.HookTimeout, DefaultHookTimeout)
+	defer cancel()
+
 	result, err := api.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
 		QueueName: &env.QueueName,
 	})
@@ -45,6 +49,7 @@ func sendSQSEmailNotification(ctx context.Context, api api.SQSSendMessageAPI, in
 		return err
 	}
 
+	input.Environment = env.Environment
 	body, err := json.Marshal(input)
 	if err != nil {
 		fmt.Println("Failed to marshal input")
@@ -0,0 +1,143 @@
+package hook
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/egress"
+	"github.com/harryzcy/mailbox/internal/util/secrets"
+)
+
+// DefaultWebhookTimeout is the timeout of webhook requests if it's not configured
+const DefaultWebhookTimeout = 5 * time.Second
+
+// Errors
+var (
+	ErrInvalidWebhookTimeout = errors.New("invalid webhook timeout: expecting a positive duration, e.g. 10s")
+	ErrInvalidWebhookProxy   = errors.New("invalid webhook proxy: expecting an http or https URL")
+	ErrInvalidWebhookTLS     = errors.New("invalid webhook TLS secret")
+)
+
+// WebhookEndpoint is a webhook receiver and how it's reached
+type WebhookEndpoint struct {
+	URL     string
+	Timeout time.Duration // DefaultWebhookTimeout if zero
+	Proxy   string        // HTTP(S) proxy URL, or the proxy from HTTPS_PROXY and HTTP_PROXY if empty
+
+	// TLSSecretID is the ID of a Secrets Manager secret holding the PEM encoded CA bundle and client certificate
+	// of the endpoint, in the format of WebhookTLSSecret
+	TLSSecretID string
+
+	// SigningSecret signs request bodies with HMAC-SHA256 in the SignatureHeader, if it's set
+	SigningSecret string
+}
+
+// WebhookTLSSecret is the value of the secret that configures TLS of a webhook endpoint.
+// Either the CA bundle or the client certificate and key may be omitted.
+type WebhookTLSSecret struct {
+	CABundle          string `json:"caBundle,omitempty"`          // trusted in place of the system roots
+	ClientCertificate string `json:"clientCertificate,omitempty"` // presented for mutual TLS
+	ClientKey         string `json:"clientKey,omitempty"`
+}
+
+// defaultWebhookEndpoint returns the webhook endpoint configured by environment variables
+func defaultWebhookEndpoint() (WebhookEndpoint, error) {
+	endpoint := WebhookEndpoint{
+		URL:         env.WebhookURL,
+		Proxy:       env.WebhookProxy,
+		TLSSecretID: env.WebhookTLSSecret,
+	}
+	if env.WebhookTimeout != "" {
+		timeout, err := time.ParseDuration(env.WebhookTimeout)
+		if err != nil || timeout <= 0 {
+			return WebhookEndpoint{}, ErrInvalidWebhookTimeout
+		}
+		endpoint.Timeout = timeout
+	}
+	return endpoint, nil
+}
+
+var webhookClients sync.Map // WebhookEndpoint -> *http.Client
+
+// webhookClient returns the HTTP client of a webhook endpoint.
+// Clients are reused across invocations, so that secrets are loaded and connections are established once.
+func webhookClient(ctx context.Context, endpoint WebhookEndpoint) (*http.Client, error) {
+	if client, ok := webhookClients.Load(endpoint); ok {
+		return client.(*http.Client), nil
+	}
+
+	client, err := newWebhookClient(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	webhookClients.Store(endpoint, client)
+	return client, nil
+}
+
+// newWebhookClient returns a new HTTP client with the timeout, proxy and TLS configuration of endpoint
+func newWebhookClient(ctx context.Context, endpoint WebhookEndpoint) (*http.Client, error) {
+	timeout := endpoint.Timeout
+	if timeout == 0 {
+		timeout = DefaultWebhookTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if endpoint.Proxy != "" {
+		proxy, err := url.Parse(endpoint.Proxy)
+		if err != nil || (proxy.Scheme != "http" && proxy.Scheme != "https") || proxy.Host == "" {
+			return nil, ErrInvalidWebhookProxy
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if endpoint.TLSSecretID != "" {
+		secret, err := secrets.Get(ctx, endpoint.TLSSecretID)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig, err = webhookTLSConfig(secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+	egress.FromEnv().Apply(client)
+	return client, nil
+}
+
+// webhookTLSConfig parses the secret value in the format of WebhookTLSSecret to a TLS configuration
+func webhookTLSConfig(value string) (*tls.Config, error) {
+	var secret WebhookTLSSecret
+	if err := json.Unmarshal([]byte(value), &secret); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhookTLS, err)
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if secret.CABundle != "" {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM([]byte(secret.CABundle)) {
+			return nil, fmt.Errorf("%w: no certificates found in caBundle", ErrInvalidWebhookTLS)
+		}
+	}
+	if secret.ClientCertificate != "" || secret.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(secret.ClientCertificate), []byte(secret.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidWebhookTLS, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,199 @@
+package hook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultWebhookEndpoint(t *testing.T) {
+	defer func() {
+		env.WebhookTimeout = ""
+		env.WebhookProxy = ""
+		env.WebhookTLSSecret = ""
+	}()
+
+	tests := []struct {
+		timeout     string
+		expected    WebhookEndpoint
+		expectedErr error
+	}{
+		{"", WebhookEndpoint{URL: "https://example.com", Proxy: "http://proxy:3128", TLSSecretID: "secret"}, nil},
+		{"10s", WebhookEndpoint{URL: "https://example.com", Timeout: 10 * time.Second, Proxy: "http://proxy:3128", TLSSecretID: "secret"}, nil},
+		{"10", WebhookEndpoint{}, ErrInvalidWebhookTimeout},
+		{"-1s", WebhookEndpoint{}, ErrInvalidWebhookTimeout},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.WebhookURL = "https://example.com"
+			env.WebhookTimeout = test.timeout
+			env.WebhookProxy = "http://proxy:3128"
+			env.WebhookTLSSecret = "secret"
+
+			endpoint, err := defaultWebhookEndpoint()
+			assert.Equal(t, test.expected, endpoint)
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+}
+
+func TestSendWebhookTo_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+	env.EgressAllowPrivate = "true"
+	defer func() { env.EgressAllowPrivate = "" }()
+
+	err := SendWebhookTo(context.Background(), WebhookEndpoint{URL: server.URL, Timeout: 50 * time.Millisecond}, &Hook{})
+	assert.Error(t, err)
+}
+
+func TestSendWebhookTo_Proxy(t *testing.T) {
+	var proxiedHost string
+	proxy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		proxiedHost = req.Host
+	}))
+	defer proxy.Close()
+
+	err := SendWebhookTo(context.Background(), WebhookEndpoint{
+		URL:   "http://receiver.example.com/webhook",
+		Proxy: proxy.URL,
+	}, &Hook{})
+	assert.Nil(t, err)
+	assert.Equal(t, "receiver.example.com", proxiedHost)
+
+	err = SendWebhookTo(context.Background(), WebhookEndpoint{
+		URL:   "http://receiver.example.com/webhook",
+		Proxy: "socks5://proxy:1080",
+	}, &Hook{})
+	assert.Equal(t, ErrInvalidWebhookProxy, err)
+}
+
+func TestSendWebhookTo_MutualTLS(t *testing.T) {
+	clientCert, clientKey := generateCertificate(t)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Len(t, req.TLS.PeerCertificates, 1)
+		assert.Equal(t, "mailbox", req.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(clientCert)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+	env.EgressAllowPrivate = "true"
+	defer func() { env.EgressAllowPrivate = "" }()
+
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	tlsSecrets := map[string]WebhookTLSSecret{
+		"mtls":    {CABundle: string(caBundle), ClientCertificate: string(clientCert), ClientKey: string(clientKey)},
+		"ca-only": {CABundle: string(caBundle)},
+	}
+	extension := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		secret, ok := tlsSecrets[req.URL.Query().Get("secretId")]
+		if !ok {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		value, err := json.Marshal(secret)
+		assert.Nil(t, err)
+		err = json.NewEncoder(rw).Encode(map[string]string{"SecretString": string(value)})
+		assert.Nil(t, err)
+	}))
+	defer extension.Close()
+	oldURL := secrets.ExtensionURL
+	secrets.ExtensionURL = extension.URL
+	defer func() { secrets.ExtensionURL = oldURL }()
+
+	tests := []struct {
+		secretID  string
+		expectErr bool
+	}{
+		{"mtls", false},
+		{"ca-only", true}, // no client certificate
+		{"", true},        // server certificate not trusted
+		{"missing", true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := SendWebhookTo(context.Background(), WebhookEndpoint{URL: server.URL, TLSSecretID: test.secretID}, &Hook{})
+			assert.Equal(t, test.expectErr, err != nil, err)
+		})
+	}
+}
+
+func TestWebhookTLSConfig(t *testing.T) {
+	cert, key := generateCertificate(t)
+
+	tests := []struct {
+		secret      string
+		expectedErr bool
+	}{
+		{`{}`, false},
+		{`invalid`, true},
+		{`{"caBundle":"invalid"}`, true},
+		{`{"clientCertificate":"invalid","clientKey":"invalid"}`, true},
+		{`{"clientCertificate":` + strconv.Quote(string(cert)) + `}`, true}, // missing key
+		{`{"caBundle":` + strconv.Quote(string(cert)) + `,"clientCertificate":` + strconv.Quote(string(cert)) +
+			`,"clientKey":` + strconv.Quote(string(key)) + `}`, false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			config, err := webhookTLSConfig(test.secret)
+			if test.expectedErr {
+				assert.ErrorIs(t, err, ErrInvalidWebhookTLS)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+		})
+	}
+}
+
+// generateCertificate returns a PEM encoded self-signed certificate and its private key
+func generateCertificate(t *testing.T) (cert, key []byte) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "mailbox"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(privateKey)
+	assert.Nil(t, err)
+
+	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	key = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return cert, key
+}
@@ -3,13 +3,21 @@ package hook
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
-	"time"
+	"net/url"
 
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/egress"
 )
 
+// SignatureHeader is the header of the signature of webhooks to endpoints with a signing secret,
+// in the format sha256=<hex encoded HMAC-SHA256 of the body>
+const SignatureHeader = "X-Mailbox-Signature"
+
 // webhookEnabled returns true if webhook is enabled.
 func webhookEnabled() bool {
 	return env.WebhookURL != ""
@@ -22,19 +30,46 @@ func SendWebhook(ctx context.Context, data *Hook) error {
 		return nil
 	}
 
-	client := http.Client{
-		Timeout: 5 * time.Second,
+	endpoint, err := defaultWebhookEndpoint()
+	if err != nil {
+		return err
+	}
+	return SendWebhookTo(ctx, endpoint, data)
+}
+
+// SendWebhookTo sends a webhook to endpoint, if it's allowed by the egress policy
+func SendWebhookTo(ctx context.Context, endpoint WebhookEndpoint, data *Hook) error {
+	u, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return err
+	}
+	if err := egress.FromEnv().CheckURL(u); err != nil {
+		return err
+	}
+
+	client, err := webhookClient(ctx, endpoint)
+	if err != nil {
+		return err
 	}
 
+	payload := *data
+	payload.Environment = env.Environment
 	body := new(bytes.Buffer)
-	err := json.NewEncoder(body).Encode(data)
+	err = json.NewEncoder(body).Encode(payload)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, env.WebhookURL, body)
+	signature := ""
+	if endpoint.SigningSecret != "" {
+		signature = Sign(endpoint.SigningSecret, body.Bytes())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, body)
 	if err != nil {
 		return err
 	}
+	if signature != "" {
+		req.Header.Set(SignatureHeader, signature)
+	}
 
 	res, err := client.Do(req)
 	if err != nil {
@@ -44,3 +79,10 @@ func SendWebhook(ctx context.Context, data *Hook) error {
 
 	return nil
 }
+
+// Sign returns the value of the SignatureHeader of a webhook body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/egress"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,6 +28,8 @@ func TestSendWebhook(t *testing.T) {
 	}))
 	defer server.Close()
 
+	env.EgressAllowPrivate = "true" // the test server listens on loopback
+	defer func() { env.EgressAllowPrivate = "" }()
 	env.WebhookURL = server.URL
 	err := SendWebhook(context.Background(), &Hook{
 		Event:  EventEmail,
@@ -34,6 +39,32 @@ func TestSendWebhook(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSendWebhook_Environment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var webhook Hook
+		err := json.NewDecoder(req.Body).Decode(&webhook)
+		assert.Nil(t, err)
+		assert.Equal(t, "staging", webhook.Environment)
+	}))
+	defer server.Close()
+
+	env.EgressAllowPrivate = "true"
+	env.Environment = "staging"
+	defer func() {
+		env.EgressAllowPrivate = ""
+		env.Environment = ""
+	}()
+	env.WebhookURL = server.URL
+	data := &Hook{
+		Event:  EventEmail,
+		Action: ActionReceived,
+		Email:  Email{ID: "123"},
+	}
+	err := SendWebhook(context.Background(), data)
+	assert.NoError(t, err)
+	assert.Empty(t, data.Environment)
+}
+
 func TestSendWebhook_NoOp(t *testing.T) {
 	env.WebhookURL = ""
 	err := SendWebhook(context.Background(), &Hook{
@@ -53,3 +84,32 @@ func TestSendWebhook_Error(t *testing.T) {
 	})
 	assert.Error(t, err)
 }
+
+func TestSendWebhook_EgressDenied(t *testing.T) {
+	defer func() { env.EgressAllowlist = "" }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Error("request should be denied")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		url         string
+		allowlist   string
+		expectedErr error
+	}{
+		{server.URL, "", egress.ErrPrivateAddress},
+		{"http://localhost:" + server.URL[strings.LastIndex(server.URL, ":")+1:], "", egress.ErrPrivateAddress},
+		{"http://169.254.169.254/latest/meta-data/", "", egress.ErrPrivateAddress},
+		{"https://attacker.example.com/webhook", "hooks.example.com", egress.ErrHostNotAllowed},
+		{"file:///etc/passwd", "", egress.ErrSchemeNotAllowed},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.EgressAllowlist = test.allowlist
+			err := SendWebhookTo(context.Background(), WebhookEndpoint{URL: test.url}, &Hook{})
+			assert.ErrorIs(t, err, test.expectedErr)
+		})
+	}
+}
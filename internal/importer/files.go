@@ -0,0 +1,297 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+)
+
+// ProviderFiles is the provider name of imports of mbox and .eml files in S3, e.g. exported from Gmail or Fastmail
+const ProviderFiles = "files"
+
+// mboxTimeLayouts are the layouts of the time in From lines of mbox files, as asctime(3) with an optional zone
+var mboxTimeLayouts = []string{
+	"Mon Jan _2 15:04:05 2006",
+	"Mon Jan _2 15:04:05 -0700 2006",
+	"Mon Jan _2 15:04:05 MST 2006",
+}
+
+// FilesAPI defines set of API required to import files in S3
+type FilesAPI interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	storage.S3GetObjectAPI
+}
+
+// Files is a connector that imports the files under a location in S3.
+// Files ending in .eml hold an email each, files ending in .mbox or without an extension are mbox files,
+// whose emails start with From lines, and other files are ignored.
+// A page is a file, and the ID of an email is its byte range in the file.
+type Files struct {
+	api    FilesAPI
+	bucket string
+	prefix string
+
+	keys  []string         // keys of the files, sorted
+	sizes map[string]int64 // key -> size
+}
+
+// ParseFilesLocation parses an S3 location in the form of s3://bucket/prefix, where the prefix is optional
+func ParseFilesLocation(location string) (bucket, prefix string, err error) {
+	rest, ok := strings.CutPrefix(location, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("invalid location %q, expected s3://bucket/prefix", location)
+	}
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("invalid location %q, expected s3://bucket/prefix", location)
+	}
+	return bucket, prefix, nil
+}
+
+// NewFiles returns a Files connector, which imports the files under location
+func NewFiles(api FilesAPI, location string) (*Files, error) {
+	bucket, prefix, err := ParseFilesLocation(location)
+	if err != nil {
+		return nil, err
+	}
+	return &Files{
+		api:    api,
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
+
+// List lists the emails of the file identified by pageToken, or the first file if it's empty.
+// The next page token is the key of the next file.
+func (f *Files) List(ctx context.Context, pageToken string) ([]string, string, error) {
+	if f.keys == nil {
+		if err := f.listKeys(ctx); err != nil {
+			return nil, "", err
+		}
+	}
+	if len(f.keys) == 0 {
+		return nil, "", nil
+	}
+
+	i := 0
+	if pageToken != "" {
+		i = sort.SearchStrings(f.keys, pageToken)
+		if i == len(f.keys) || f.keys[i] != pageToken {
+			return nil, "", fmt.Errorf("file %s is deleted during the import", pageToken)
+		}
+	}
+	key := f.keys[i]
+	nextPageToken := ""
+	if i+1 < len(f.keys) {
+		nextPageToken = f.keys[i+1]
+	}
+
+	if isEML(key) {
+		return []string{fileID(key, 0, f.sizes[key])}, nextPageToken, nil
+	}
+	ids, err := f.listMbox(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return ids, nextPageToken, nil
+}
+
+// listKeys lists the files that can be imported
+func (f *Files) listKeys(ctx context.Context) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(f.bucket),
+		Prefix: aws.String(f.prefix),
+	}
+	f.keys = []string{}
+	f.sizes = make(map[string]int64)
+	for {
+		output, err := f.api.ListObjectsV2(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, object := range output.Contents {
+			key, size := aws.ToString(object.Key), aws.ToInt64(object.Size)
+			if size == 0 || !(isEML(key) || isMbox(key)) {
+				continue
+			}
+			f.keys = append(f.keys, key)
+			f.sizes[key] = size
+		}
+		if !aws.ToBool(output.IsTruncated) {
+			break
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+	sort.Strings(f.keys)
+	return nil
+}
+
+// listMbox returns the IDs of the emails in an mbox file.
+// An email starts with a From line at the beginning of the file or after an empty line.
+func (f *Files) listMbox(ctx context.Context, key string) ([]string, error) {
+	object, err := f.api.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(f.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+
+	var ids []string
+	r := bufio.NewReader(object.Body)
+	var offset int64
+	start := int64(-1)
+	lineStart, previousEmpty := true, true
+	for {
+		// lines longer than the buffer are read in several chunks
+		chunk, err := r.ReadSlice('\n')
+		if lineStart && previousEmpty && bytes.HasPrefix(chunk, []byte("From ")) {
+			if start >= 0 {
+				ids = append(ids, fileID(key, start, offset-start))
+			}
+			start = offset
+		}
+		if len(chunk) > 0 {
+			if lineStart {
+				previousEmpty = len(bytes.TrimRight(chunk, "\r\n")) == 0
+			} else {
+				previousEmpty = false
+			}
+			lineStart = chunk[len(chunk)-1] == '\n'
+		}
+		offset += int64(len(chunk))
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+	if start >= 0 && offset > start {
+		ids = append(ids, fileID(key, start, offset-start))
+	}
+	return ids, nil
+}
+
+// Fetch fetches an email by its byte range in a file.
+// Emails in mbox files are unquoted, and their time is read from the From line,
+// otherwise from the Date header, or the time the file was uploaded.
+func (f *Files) Fetch(ctx context.Context, id string) (*Message, error) {
+	key, offset, length, err := parseFileID(id)
+	if err != nil {
+		return nil, err
+	}
+	object, err := f.api.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(f.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		if apiErr := new(s3types.NoSuchKey); errors.As(err, &apiErr) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	defer object.Body.Close()
+	raw, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &Message{ID: id}
+	if fromLine, rest, ok := bytes.Cut(raw, []byte("\n")); ok && bytes.HasPrefix(fromLine, []byte("From ")) {
+		message.Time = parseFromLineTime(string(bytes.TrimRight(fromLine, "\r")))
+		raw = unquoteMbox(rest)
+	}
+	message.Raw = raw
+	if message.Time.IsZero() {
+		if m, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+			if date, err := m.Header.Date(); err == nil {
+				message.Time = date
+			}
+		}
+	}
+	if message.Time.IsZero() {
+		message.Time = aws.ToTime(object.LastModified)
+	}
+	message.Time = message.Time.UTC()
+	return message, nil
+}
+
+// fileID returns the ID of an email, which is its byte range in a file
+func fileID(key string, offset, length int64) string {
+	return key + "#" + strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(length, 10)
+}
+
+// parseFileID parses the ID of an email returned by fileID
+func parseFileID(id string) (key string, offset, length int64, err error) {
+	i := strings.LastIndexByte(id, '#')
+	if i < 0 {
+		return "", 0, 0, fmt.Errorf("invalid file ID %q", id)
+	}
+	start, size, ok := strings.Cut(id[i+1:], "-")
+	offset, err1 := strconv.ParseInt(start, 10, 64)
+	length, err2 := strconv.ParseInt(size, 10, 64)
+	if !ok || err1 != nil || err2 != nil || offset < 0 || length <= 0 {
+		return "", 0, 0, fmt.Errorf("invalid file ID %q", id)
+	}
+	return id[:i], offset, length, nil
+}
+
+// parseFromLineTime returns the time of a From line, e.g. From sender@example.com Wed May  1 12:00:00 2024,
+// or the zero time if it can't be parsed
+func parseFromLineTime(line string) time.Time {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return time.Time{}
+	}
+	value := strings.Join(fields[2:], " ")
+	for _, layout := range mboxTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// unquoteMbox removes the > that quotes lines starting with From, after any number of >,
+// and the empty line that separates emails
+func unquoteMbox(raw []byte) []byte {
+	raw = bytes.TrimSuffix(raw, []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	lines := bytes.SplitAfter(raw, []byte("\n"))
+	var buf bytes.Buffer
+	buf.Grow(len(raw))
+	for _, line := range lines {
+		if bytes.HasPrefix(line, []byte(">")) && bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) {
+			line = line[1:]
+		}
+		buf.Write(line)
+	}
+	return buf.Bytes()
+}
+
+func isEML(key string) bool {
+	return strings.EqualFold(path.Ext(key), ".eml")
+}
+
+func isMbox(key string) bool {
+	ext := path.Ext(key)
+	return ext == "" || strings.EqualFold(ext, ".mbox")
+}
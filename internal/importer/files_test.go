@@ -0,0 +1,177 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockFiles serves files from memory, listing one file per page
+type mockFiles map[string]string
+
+var mockFilesModified = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func (m mockFiles) ListObjectsV2(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	keys := []string{}
+	for key := range m {
+		if strings.HasPrefix(key, *params.Prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	i := 0
+	if params.ContinuationToken != nil {
+		i = sort.SearchStrings(keys, *params.ContinuationToken)
+	}
+	output := &s3.ListObjectsV2Output{
+		Contents: []s3types.Object{{Key: aws.String(keys[i]), Size: aws.Int64(int64(len(m[keys[i]])))}},
+	}
+	if i+1 < len(keys) {
+		output.IsTruncated = aws.Bool(true)
+		output.NextContinuationToken = aws.String(keys[i+1])
+	}
+	return output, nil
+}
+
+func (m mockFiles) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	content, ok := m[*params.Key]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+	if params.Range != nil {
+		var start, end int
+		_, err := fmt.Sscanf(*params.Range, "bytes=%d-%d", &start, &end)
+		if err != nil {
+			return nil, err
+		}
+		content = content[start : end+1]
+	}
+	return &s3.GetObjectOutput{
+		Body:         io.NopCloser(strings.NewReader(content)),
+		LastModified: aws.Time(mockFilesModified),
+	}, nil
+}
+
+func TestParseFilesLocation(t *testing.T) {
+	tests := []struct {
+		location       string
+		expectedBucket string
+		expectedPrefix string
+		expectedErr    bool
+	}{
+		{location: "s3://bucket/imports/", expectedBucket: "bucket", expectedPrefix: "imports/"},
+		{location: "s3://bucket", expectedBucket: "bucket"},
+		{location: "s3:///imports/", expectedErr: true},
+		{location: "bucket/imports/", expectedErr: true},
+		{location: "", expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.location, func(t *testing.T) {
+			bucket, prefix, err := ParseFilesLocation(test.location)
+			if test.expectedErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.expectedBucket, bucket)
+			assert.Equal(t, test.expectedPrefix, prefix)
+		})
+	}
+}
+
+func TestFiles(t *testing.T) {
+	mbox := "From sender@example.com Wed May  1 12:00:00 2024\n" +
+		"Subject: first\n\n>From here\n>>From there\n\n" +
+		"From MAILER-DAEMON Thu May  2 12:00:00 +0200 2024\n" +
+		"Subject: second\n\nnot a From line\nFrom the middle of a paragraph\n\n"
+	files := mockFiles{
+		"imports/a.mbox":     mbox,
+		"imports/b.eml":      "Date: Fri, 3 May 2024 12:00:00 +0000\r\nSubject: third\r\n\r\nhello\r\n",
+		"imports/c/d.EML":    "Subject: fourth\r\n\r\n",
+		"imports/notes.txt":  "not an email",
+		"imports/empty.mbox": "",
+		"other/e.eml":        "Subject: other\r\n\r\n",
+	}
+	connector, err := NewFiles(files, "s3://bucket/imports/")
+	assert.Nil(t, err)
+
+	type listed struct {
+		ids  []string
+		next string
+	}
+	pages := []listed{}
+	pageToken := ""
+	for {
+		ids, next, err := connector.List(context.TODO(), pageToken)
+		assert.Nil(t, err)
+		pages = append(pages, listed{ids, next})
+		if next == "" {
+			break
+		}
+		pageToken = next
+	}
+	secondStart := strings.Index(mbox, "From MAILER-DAEMON")
+	assert.Equal(t, []listed{
+		{[]string{fileID("imports/a.mbox", 0, int64(secondStart)), fileID("imports/a.mbox", int64(secondStart), int64(len(mbox)-secondStart))}, "imports/b.eml"},
+		{[]string{fileID("imports/b.eml", 0, int64(len(files["imports/b.eml"])))}, "imports/c/d.EML"},
+		{[]string{fileID("imports/c/d.EML", 0, int64(len(files["imports/c/d.EML"])))}, ""},
+	}, pages)
+
+	tests := []struct {
+		id           string
+		expectedRaw  string
+		expectedTime time.Time
+	}{
+		{
+			id:           pages[0].ids[0],
+			expectedRaw:  "Subject: first\n\nFrom here\n>From there\n",
+			expectedTime: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			id:           pages[0].ids[1],
+			expectedRaw:  "Subject: second\n\nnot a From line\nFrom the middle of a paragraph\n",
+			expectedTime: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			id:           pages[1].ids[0],
+			expectedRaw:  files["imports/b.eml"],
+			expectedTime: time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			id:           pages[2].ids[0],
+			expectedRaw:  files["imports/c/d.EML"],
+			expectedTime: mockFilesModified,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.id, func(t *testing.T) {
+			message, err := connector.Fetch(context.TODO(), test.id)
+			assert.Nil(t, err)
+			assert.Equal(t, test.id, message.ID)
+			assert.Equal(t, test.expectedRaw, string(message.Raw))
+			assert.True(t, test.expectedTime.Equal(message.Time), message.Time)
+		})
+	}
+
+	delete(files, "imports/b.eml")
+	_, err = connector.Fetch(context.TODO(), pages[1].ids[0])
+	assert.Equal(t, ErrMessageNotFound, err)
+}
+
+func TestFiles_Empty(t *testing.T) {
+	connector, err := NewFiles(mockFiles{"imports/notes.txt": "not an email"}, "s3://bucket/imports/")
+	assert.Nil(t, err)
+	ids, next, err := connector.List(context.TODO(), "")
+	assert.Nil(t, err)
+	assert.Empty(t, ids)
+	assert.Empty(t, next)
+}
@@ -0,0 +1,255 @@
+package importer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/util/egress"
+)
+
+// ProviderGmail is the provider name of the Gmail connector
+const ProviderGmail = "gmail"
+
+// DefaultGmailQuery excludes emails that are not received, since imported emails are stored in the inbox
+const DefaultGmailQuery = "-in:sent -in:drafts -in:chats"
+
+// gmailPageSize is the number of messages listed at once, which is the maximum allowed by the Gmail API
+const gmailPageSize = 500
+
+// URLs of Google APIs, which are replaced during testing
+var (
+	gmailAPIURL    = "https://gmail.googleapis.com/gmail/v1/users/me"
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+)
+
+// GmailCredentials are the OAuth credentials of a Gmail account, stored as a JSON secret.
+// The refresh token needs the https://www.googleapis.com/auth/gmail.readonly scope.
+type GmailCredentials struct {
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"clientSecret"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// Gmail is a connector that imports emails through the Gmail API
+type Gmail struct {
+	credentials GmailCredentials
+	query       string
+	client      *http.Client
+
+	accessToken string
+	expiry      time.Time
+	labels      map[string]string // label ID -> name of user labels
+}
+
+// NewGmail returns a Gmail connector, which imports emails matching query in the Gmail search syntax,
+// or DefaultGmailQuery if it's empty
+func NewGmail(credentials GmailCredentials, query string) *Gmail {
+	if query == "" {
+		query = DefaultGmailQuery
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	egress.FromEnv().Apply(client)
+	return &Gmail{
+		credentials: credentials,
+		query:       query,
+		client:      client,
+	}
+}
+
+// List lists message IDs matching the query, from the newest to the oldest
+func (g *Gmail) List(ctx context.Context, pageToken string) ([]string, string, error) {
+	params := url.Values{
+		"q":          {g.query},
+		"maxResults": {strconv.Itoa(gmailPageSize)},
+	}
+	if pageToken != "" {
+		params.Set("pageToken", pageToken)
+	}
+
+	var result struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+		NextPageToken string `json:"nextPageToken"`
+	}
+	if err := g.get(ctx, "/messages?"+params.Encode(), &result); err != nil {
+		return nil, "", err
+	}
+
+	ids := make([]string, len(result.Messages))
+	for i, message := range result.Messages {
+		ids[i] = message.ID
+	}
+	return ids, result.NextPageToken, nil
+}
+
+// Fetch fetches the raw content and labels of a message
+func (g *Gmail) Fetch(ctx context.Context, id string) (*Message, error) {
+	if g.labels == nil {
+		if err := g.loadLabels(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var result struct {
+		ID           string   `json:"id"`
+		LabelIDs     []string `json:"labelIds"`
+		InternalDate string   `json:"internalDate"` // milliseconds since epoch
+		Raw          string   `json:"raw"`          // base64url encoded
+	}
+	if err := g.get(ctx, "/messages/"+url.PathEscape(id)+"?format=raw", &result); err != nil {
+		return nil, err
+	}
+
+	raw, err := base64.URLEncoding.DecodeString(result.Raw)
+	if err != nil {
+		// padding is omitted by some responses
+		raw, err = base64.RawURLEncoding.DecodeString(result.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid raw content of message %s: %w", id, err)
+		}
+	}
+	internalDate, err := strconv.ParseInt(result.InternalDate, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid internal date of message %s: %w", id, err)
+	}
+
+	message := &Message{
+		ID:   id,
+		Raw:  raw,
+		Time: time.UnixMilli(internalDate).UTC(),
+	}
+	for _, labelID := range result.LabelIDs {
+		switch labelID {
+		case "UNREAD":
+			message.Unread = true
+		case "STARRED":
+			message.Flagged = true
+		default:
+			// system labels, such as INBOX and CATEGORY_UPDATES, are not imported
+			if name, ok := g.labels[labelID]; ok {
+				message.Labels = append(message.Labels, name)
+			}
+		}
+	}
+	return message, nil
+}
+
+// loadLabels loads the names of user labels
+func (g *Gmail) loadLabels(ctx context.Context) error {
+	var result struct {
+		Labels []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			Type string `json:"type"` // system or user
+		} `json:"labels"`
+	}
+	if err := g.get(ctx, "/labels", &result); err != nil {
+		return err
+	}
+
+	g.labels = make(map[string]string)
+	for _, label := range result.Labels {
+		if label.Type == "user" {
+			g.labels[label.ID] = label.Name
+		}
+	}
+	return nil
+}
+
+// get sends a GET request to the Gmail API, and decodes the JSON response into v
+func (g *Gmail) get(ctx context.Context, path string, v any) error {
+	token, err := g.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gmailAPIURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := g.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return json.NewDecoder(res.Body).Decode(v)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %s", ErrUnauthorized, readError(res))
+	case http.StatusNotFound:
+		return ErrMessageNotFound
+	default:
+		return fmt.Errorf("gmail request failed: %s", readError(res))
+	}
+}
+
+// token returns an access token, which is refreshed if it's about to expire
+func (g *Gmail) token(ctx context.Context) (string, error) {
+	if g.accessToken != "" && time.Until(g.expiry) > time.Minute {
+		return g.accessToken, nil
+	}
+
+	form := url.Values{
+		"client_id":     {g.credentials.ClientID},
+		"client_secret": {g.credentials.ClientSecret},
+		"refresh_token": {g.credentials.RefreshToken},
+		"grant_type":    {"refresh_token"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, googleTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := g.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnauthorized {
+		// e.g. invalid_grant when the refresh token is revoked
+		return "", fmt.Errorf("%w: %s", ErrUnauthorized, readError(res))
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %s", readError(res))
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"` // in seconds
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	g.accessToken = result.AccessToken
+	g.expiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	return g.accessToken, nil
+}
+
+// do sends a request after checking it against the egress policy
+func (g *Gmail) do(req *http.Request) (*http.Response, error) {
+	if err := egress.FromEnv().CheckURL(req.URL); err != nil {
+		return nil, err
+	}
+	return g.client.Do(req)
+}
+
+// readError returns the status and the beginning of the response body, which describes the error
+func readError(res *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return strings.TrimSpace(res.Status + " " + string(body))
+}
@@ -0,0 +1,116 @@
+package importer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupGmail(t *testing.T, handler http.HandlerFunc) func() {
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/token" {
+			tokenRequests++
+			assert.Nil(t, req.ParseForm())
+			if req.PostForm.Get("refresh_token") != "refresh-token" {
+				rw.WriteHeader(http.StatusBadRequest)
+				_, _ = rw.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+			assert.Equal(t, "client-id", req.PostForm.Get("client_id"))
+			assert.Equal(t, "refresh_token", req.PostForm.Get("grant_type"))
+			assert.Nil(t, json.NewEncoder(rw).Encode(map[string]any{"access_token": "access-token", "expires_in": 3600}))
+			return
+		}
+		assert.Equal(t, "Bearer access-token", req.Header.Get("Authorization"))
+		handler(rw, req)
+	}))
+
+	oldAPIURL, oldTokenURL := gmailAPIURL, googleTokenURL
+	gmailAPIURL = server.URL + "/gmail"
+	googleTokenURL = server.URL + "/token"
+	env.EgressAllowPrivate = "true" // the test server listens on loopback
+	return func() {
+		server.Close()
+		gmailAPIURL, googleTokenURL = oldAPIURL, oldTokenURL
+		env.EgressAllowPrivate = ""
+		assert.LessOrEqual(t, tokenRequests, 1, "access token should be reused")
+	}
+}
+
+func TestGmail_List(t *testing.T) {
+	defer setupGmail(t, func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/gmail/messages", req.URL.Path)
+		assert.Equal(t, DefaultGmailQuery, req.URL.Query().Get("q"))
+		if req.URL.Query().Get("pageToken") == "" {
+			_, _ = rw.Write([]byte(`{"messages":[{"id":"a","threadId":"t"},{"id":"b","threadId":"t"}],"nextPageToken":"page2"}`))
+			return
+		}
+		assert.Equal(t, "page2", req.URL.Query().Get("pageToken"))
+		_, _ = rw.Write([]byte(`{"resultSizeEstimate":0}`))
+	})()
+
+	gmail := NewGmail(GmailCredentials{ClientID: "client-id", RefreshToken: "refresh-token"}, "")
+	ids, next, err := gmail.List(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids)
+	assert.Equal(t, "page2", next)
+
+	ids, next, err = gmail.List(context.Background(), "page2")
+	assert.Nil(t, err)
+	assert.Empty(t, ids)
+	assert.Equal(t, "", next)
+}
+
+func TestGmail_Fetch(t *testing.T) {
+	raw := "From: alice@example.com\r\nSubject: Hi\r\n\r\nHello"
+	defer setupGmail(t, func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/gmail/labels":
+			_, _ = rw.Write([]byte(`{"labels":[{"id":"INBOX","name":"INBOX","type":"system"},{"id":"Label_1","name":"Work","type":"user"}]}`))
+		case "/gmail/messages/a":
+			assert.Equal(t, "raw", req.URL.Query().Get("format"))
+			err := json.NewEncoder(rw).Encode(map[string]any{
+				"id":           "a",
+				"labelIds":     []string{"INBOX", "UNREAD", "STARRED", "Label_1", "CATEGORY_UPDATES"},
+				"internalDate": "1714564800000",
+				"raw":          base64.RawURLEncoding.EncodeToString([]byte(raw)),
+			})
+			assert.Nil(t, err)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	})()
+
+	gmail := NewGmail(GmailCredentials{ClientID: "client-id", RefreshToken: "refresh-token"}, "label:work")
+	message, err := gmail.Fetch(context.Background(), "a")
+	assert.Nil(t, err)
+	assert.Equal(t, &Message{
+		ID:      "a",
+		Raw:     []byte(raw),
+		Time:    time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Unread:  true,
+		Flagged: true,
+		Labels:  []string{"Work"},
+	}, message)
+
+	_, err = gmail.Fetch(context.Background(), "deleted")
+	assert.Equal(t, ErrMessageNotFound, err)
+}
+
+func TestGmail_Unauthorized(t *testing.T) {
+	defer setupGmail(t, func(rw http.ResponseWriter, req *http.Request) {
+		t.Fatal("no request should be sent without an access token")
+	})()
+
+	gmail := NewGmail(GmailCredentials{ClientID: "client-id", RefreshToken: "revoked"}, "")
+	_, _, err := gmail.List(context.Background(), "")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
@@ -0,0 +1,183 @@
+// Package importer pulls historical emails from other providers into the mailbox.
+// Connectors fetch raw emails from a provider, which are stored through the same pipeline as emails received by SES.
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/util/secrets"
+)
+
+// Errors returned by connectors
+var (
+	// ErrUnknownProvider means there's no connector for the provider
+	ErrUnknownProvider = errors.New("unknown provider")
+	// ErrUnauthorized means the credentials are rejected by the provider, so the import can't continue
+	ErrUnauthorized = errors.New("unauthorized by the provider")
+	// ErrMessageNotFound means the message is deleted from the provider after it's listed
+	ErrMessageNotFound = errors.New("message not found in the provider")
+)
+
+// Message is an email fetched from another provider
+type Message struct {
+	ID      string    // ID in the provider
+	Raw     []byte    // raw MIME email
+	Time    time.Time // time received by the provider
+	Unread  bool
+	Flagged bool
+	Labels  []string
+}
+
+// Connector fetches emails from another provider
+type Connector interface {
+	// List returns the IDs of messages in the page identified by pageToken, or the first page if it's empty,
+	// and the token of the next page, which is empty after the last page
+	List(ctx context.Context, pageToken string) (ids []string, nextPageToken string, err error)
+	// Fetch returns a message by its ID
+	Fetch(ctx context.Context, id string) (*Message, error)
+}
+
+// NewConnector returns the connector of an import, with the credentials read from its secret.
+// Imports of files in S3 use NewFiles instead, which reads them with the S3 client of the function.
+func NewConnector(ctx context.Context, progress *Progress) (Connector, error) {
+	switch progress.Provider {
+	case ProviderGmail:
+		secret, err := secrets.Get(ctx, progress.SecretID)
+		if err != nil {
+			return nil, err
+		}
+		var credentials GmailCredentials
+		if err := json.Unmarshal([]byte(secret), &credentials); err != nil {
+			return nil, fmt.Errorf("invalid gmail credentials: %w", err)
+		}
+		return NewGmail(credentials, progress.Query), nil
+	default:
+		return nil, ErrUnknownProvider
+	}
+}
+
+// StoreFunc stores a message under messageID, returning ErrSkipped if it's deliberately not stored
+type StoreFunc func(ctx context.Context, messageID string, message *Message) error
+
+// ErrSkipped is returned by StoreFunc if the message is not stored, e.g. blocked by the attachment policy
+var ErrSkipped = errors.New("message skipped")
+
+// stopMargin is the time left before the deadline at which an import run stops, to save its progress
+const stopMargin = time.Minute
+
+// MessageID returns the ID of an imported email in the mailbox.
+// It's derived from the provider and the ID in the provider, so that importing a message again is detected.
+func MessageID(provider, id string) string {
+	sum := sha256.Sum256([]byte(provider + "\x00" + id))
+	return provider + "-" + hex.EncodeToString(sum[:16])
+}
+
+// Run continues the import from its saved progress, until all messages are imported,
+// the deadline of ctx is near, or an error occurs. Progress is saved after each message,
+// so that the next run resumes from where this one stops.
+func Run(ctx context.Context, client ImportAPI, progress *Progress, connector Connector, store StoreFunc) error {
+	if progress.Status != StatusRunning {
+		fmt.Printf("import %s is %s\n", progress.ImportID, progress.Status)
+		return nil
+	}
+
+	for {
+		ids, nextPageToken, err := connector.List(ctx, progress.PageToken)
+		if err != nil {
+			return stop(ctx, client, progress, err)
+		}
+
+		for ; progress.PageOffset < len(ids); progress.PageOffset++ {
+			if deadlineNear(ctx) {
+				fmt.Printf("stopping import %s before the deadline\n", progress.ImportID)
+				return saveProgress(ctx, client, progress)
+			}
+
+			err = importMessage(ctx, client, progress.Provider, ids[progress.PageOffset], connector, store)
+			switch {
+			case err == nil:
+				progress.Imported++
+			case errors.Is(err, ErrSkipped), errors.Is(err, ErrMessageNotFound):
+				progress.Skipped++
+			default:
+				return stop(ctx, client, progress, err)
+			}
+			if err = saveProgress(ctx, client, progress); err != nil {
+				return err
+			}
+		}
+
+		progress.PageToken = nextPageToken
+		progress.PageOffset = 0
+		if nextPageToken == "" {
+			progress.Status = StatusCompleted
+			progress.LastError = ""
+			progress.TimeCompleted = getCurrentTime().Format(time.RFC3339)
+			fmt.Printf("import %s completed: %d imported, %d skipped\n", progress.ImportID, progress.Imported, progress.Skipped)
+			return saveProgress(ctx, client, progress)
+		}
+		if err = saveProgress(ctx, client, progress); err != nil {
+			return err
+		}
+	}
+}
+
+// importMessage imports a single message, unless it's already imported
+func importMessage(ctx context.Context, client ImportAPI, provider, id string, connector Connector, store StoreFunc) error {
+	messageID := MessageID(provider, id)
+	exists, err := emailExists(ctx, client, messageID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrSkipped
+	}
+
+	message, err := connector.Fetch(ctx, id)
+	if err != nil {
+		return err
+	}
+	message.Labels = limitLabels(message.Labels)
+	return store(ctx, messageID, message)
+}
+
+// stop records err in progress, and fails the import if it can't continue
+func stop(ctx context.Context, client ImportAPI, progress *Progress, err error) error {
+	progress.LastError = err.Error()
+	if errors.Is(err, ErrUnauthorized) {
+		progress.Status = StatusFailed
+	}
+	if saveErr := saveProgress(ctx, client, progress); saveErr != nil {
+		fmt.Printf("failed to save progress, %v\n", saveErr)
+	}
+	return err
+}
+
+func deadlineNear(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) < stopMargin
+}
+
+// limitLabels drops labels that can't be stored, which are either too long or beyond the maximum number
+func limitLabels(labels []string) []string {
+	var result []string
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" || len(label) > email.MaxLabelLength {
+			continue
+		}
+		if len(result) == email.MaxLabels {
+			break
+		}
+		result = append(result, label)
+	}
+	return result
+}
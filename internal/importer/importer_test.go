@@ -0,0 +1,210 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockImportAPI struct {
+	emails   map[string]bool
+	progress []Progress // saved progress, in order
+}
+
+func (m *mockImportAPI) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	messageID := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+	if m.emails[messageID] {
+		return &dynamodb.GetItemOutput{Item: params.Key}, nil
+	}
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+func (m *mockImportAPI) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	var progress Progress
+	err := attributevalue.UnmarshalMap(params.Item, &progress)
+	if err != nil {
+		return nil, err
+	}
+	progress.ImportID = strings.TrimPrefix(params.Item["MessageID"].(*types.AttributeValueMemberS).Value, itemPrefix)
+	m.progress = append(m.progress, progress)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+type mockConnector struct {
+	pages    map[string][]string // page token -> IDs
+	next     map[string]string   // page token -> next page token
+	fetchErr map[string]error
+}
+
+func (c mockConnector) List(_ context.Context, pageToken string) ([]string, string, error) {
+	if pageToken == "broken" {
+		return nil, "", ErrUnauthorized
+	}
+	return c.pages[pageToken], c.next[pageToken], nil
+}
+
+func (c mockConnector) Fetch(_ context.Context, id string) (*Message, error) {
+	if err := c.fetchErr[id]; err != nil {
+		return nil, err
+	}
+	return &Message{ID: id, Raw: []byte("raw " + id)}, nil
+}
+
+var importTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestRun(t *testing.T) {
+	getCurrentTime = func() time.Time { return importTime }
+	defer func() { getCurrentTime = func() time.Time { return time.Now().UTC() } }()
+
+	connector := mockConnector{
+		pages: map[string][]string{
+			"":      {"a", "b", "c"},
+			"page2": {"d", "e"},
+		},
+		next: map[string]string{
+			"": "page2",
+		},
+		fetchErr: map[string]error{
+			"c": ErrMessageNotFound,
+			"e": errors.New("temporary error"),
+		},
+	}
+	client := &mockImportAPI{
+		emails: map[string]bool{
+			MessageID(ProviderGmail, "b"): true, // already imported
+		},
+	}
+	var stored []string
+	store := func(_ context.Context, messageID string, message *Message) error {
+		assert.Equal(t, MessageID(ProviderGmail, message.ID), messageID)
+		assert.Equal(t, "raw "+message.ID, string(message.Raw))
+		stored = append(stored, message.ID)
+		if message.ID == "d" {
+			return ErrSkipped
+		}
+		return nil
+	}
+
+	progress, err := NewProgress(StartInput{ImportID: "example", Provider: ProviderGmail, SecretID: "secret"})
+	assert.Nil(t, err)
+
+	// the first run stops at the temporary error
+	err = Run(context.TODO(), client, progress, connector, store)
+	assert.EqualError(t, err, "temporary error")
+	assert.Equal(t, []string{"a", "d"}, stored)
+	assert.Equal(t, StatusRunning, progress.Status)
+	assert.Equal(t, "page2", progress.PageToken)
+	assert.Equal(t, 1, progress.PageOffset)
+	assert.Equal(t, 1, progress.Imported)
+	assert.Equal(t, 3, progress.Skipped)
+	assert.Equal(t, "temporary error", progress.LastError)
+	assert.Equal(t, *progress, client.progress[len(client.progress)-1])
+
+	// the next run resumes from the saved progress
+	delete(connector.fetchErr, "e")
+	stored = nil
+	resumed := client.progress[len(client.progress)-1]
+	err = Run(context.TODO(), client, &resumed, connector, store)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"e"}, stored)
+	assert.Equal(t, StatusCompleted, resumed.Status)
+	assert.Equal(t, "", resumed.LastError)
+	assert.Equal(t, 2, resumed.Imported)
+	assert.Equal(t, 3, resumed.Skipped)
+	assert.Equal(t, importTime.Format(time.RFC3339), resumed.TimeCompleted)
+
+	// completed imports are not run again
+	stored = nil
+	err = Run(context.TODO(), client, &resumed, connector, store)
+	assert.Nil(t, err)
+	assert.Nil(t, stored)
+}
+
+func TestRun_Unauthorized(t *testing.T) {
+	client := &mockImportAPI{}
+	progress := &Progress{ImportID: "example", Provider: ProviderGmail, Status: StatusRunning, PageToken: "broken"}
+
+	err := Run(context.TODO(), client, progress, mockConnector{}, nil)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.Equal(t, StatusFailed, progress.Status)
+	assert.Equal(t, StatusFailed, client.progress[0].Status)
+
+	progress.Retry()
+	assert.Equal(t, StatusRunning, progress.Status)
+	assert.Equal(t, "", progress.LastError)
+}
+
+func TestRun_Deadline(t *testing.T) {
+	client := &mockImportAPI{}
+	progress := &Progress{ImportID: "example", Provider: ProviderGmail, Status: StatusRunning}
+	connector := mockConnector{pages: map[string][]string{"": {"a"}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stopMargin/2)
+	defer cancel()
+	err := Run(ctx, client, progress, connector, func(context.Context, string, *Message) error {
+		t.Fatal("no message should be imported")
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, StatusRunning, progress.Status)
+	assert.Equal(t, 0, progress.PageOffset)
+	assert.Len(t, client.progress, 1)
+}
+
+func TestNewProgress(t *testing.T) {
+	tests := []struct {
+		input       StartInput
+		expectedErr error
+	}{
+		{StartInput{ImportID: "example", Provider: ProviderGmail, SecretID: "secret"}, nil},
+		{StartInput{Provider: ProviderGmail, SecretID: "secret"}, api.ErrInvalidInput},
+		{StartInput{ImportID: "a#b", Provider: ProviderGmail, SecretID: "secret"}, api.ErrInvalidInput},
+		{StartInput{ImportID: "example", SecretID: "secret"}, api.ErrInvalidInput},
+		{StartInput{ImportID: "example", Provider: ProviderGmail}, api.ErrInvalidInput},
+		{StartInput{ImportID: "example", Provider: ProviderFiles, Location: "s3://bucket/imports/"}, nil},
+		{StartInput{ImportID: "example", Provider: ProviderFiles, SecretID: "secret"}, api.ErrInvalidInput},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			progress, err := NewProgress(test.input)
+			assert.Equal(t, test.expectedErr, err)
+			if err == nil {
+				assert.Equal(t, StatusRunning, progress.Status)
+			}
+		})
+	}
+}
+
+func TestGetProgress(t *testing.T) {
+	client := &mockImportAPI{}
+	_, err := GetProgress(context.TODO(), client, "missing")
+	assert.Equal(t, api.ErrNotFound, err)
+}
+
+func TestMessageID(t *testing.T) {
+	id := MessageID(ProviderGmail, "18c2f")
+	assert.True(t, strings.HasPrefix(id, "gmail-"))
+	assert.Len(t, id, len("gmail-")+32)
+	assert.Equal(t, id, MessageID(ProviderGmail, "18c2f"))
+	assert.NotEqual(t, id, MessageID(ProviderGmail, "18c2e"))
+}
+
+func TestLimitLabels(t *testing.T) {
+	assert.Equal(t, []string{"Work", "Travel"}, limitLabels([]string{" Work ", "", strings.Repeat("x", 101), "Travel"}))
+
+	many := make([]string, 60)
+	for i := range many {
+		many[i] = "label" + strconv.Itoa(i)
+	}
+	assert.Len(t, limitLabels(many), 50)
+}
@@ -0,0 +1,163 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Statuses of an import
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed" // the credentials are rejected, see StartInput.Retry
+)
+
+// itemPrefix is the prefix of the MessageID of import items, which are stored in the email table
+const itemPrefix = "import#"
+
+var getCurrentTime = func() time.Time {
+	return time.Now().UTC()
+}
+
+// ImportAPI defines set of API required to import emails and track the progress
+type ImportAPI interface {
+	api.GetItemAPI
+	api.PutItemAPI
+}
+
+// StartInput represents the input of an import
+type StartInput struct {
+	ImportID string `json:"importID"`
+	Provider string `json:"provider"` // e.g. gmail
+	SecretID string `json:"secretID"` // Secrets Manager secret with the credentials of the provider
+	Location string `json:"location"` // S3 location of the files provider, s3://bucket/prefix
+	Query    string `json:"query"`    // provider specific filter of messages, if any
+	Retry    bool   `json:"retry"`    // resumes a failed import, e.g. after the credentials are updated
+}
+
+// Progress is the progress of an import, which is saved so that it can be resumed
+type Progress struct {
+	ImportID      string `json:"importID" dynamodbav:"-"`
+	Provider      string `json:"provider"`
+	SecretID      string `json:"-"`
+	Location      string `json:"location,omitempty"`
+	Query         string `json:"query,omitempty"`
+	Status        string `json:"status"`
+	Imported      int    `json:"imported"`
+	Skipped       int    `json:"skipped"` // already imported, deleted from the provider, or blocked
+	PageToken     string `json:"-"`
+	PageOffset    int    `json:"-"`
+	LastError     string `json:"lastError,omitempty"`
+	TimeStarted   string `json:"timeStarted"`
+	TimeUpdated   string `json:"timeUpdated"`
+	TimeCompleted string `json:"timeCompleted,omitempty"`
+}
+
+// NewProgress returns the progress of a new import
+func NewProgress(input StartInput) (*Progress, error) {
+	if input.ImportID == "" || strings.ContainsAny(input.ImportID, "#/") || input.Provider == "" {
+		return nil, api.ErrInvalidInput
+	}
+	// files are read with the role of the function, while other providers need credentials
+	if input.Provider == ProviderFiles {
+		if _, _, err := ParseFilesLocation(input.Location); err != nil {
+			return nil, api.ErrInvalidInput
+		}
+	} else if input.SecretID == "" {
+		return nil, api.ErrInvalidInput
+	}
+	now := getCurrentTime().Format(time.RFC3339)
+	return &Progress{
+		ImportID:    input.ImportID,
+		Provider:    input.Provider,
+		SecretID:    input.SecretID,
+		Location:    input.Location,
+		Query:       input.Query,
+		Status:      StatusRunning,
+		TimeStarted: now,
+		TimeUpdated: now,
+	}, nil
+}
+
+// Retry resumes a failed import from where it stops
+func (p *Progress) Retry() {
+	if p.Status == StatusFailed {
+		p.Status = StatusRunning
+		p.LastError = ""
+	}
+}
+
+// GetProgress returns the progress of an import
+func GetProgress(ctx context.Context, client api.GetItemAPI, importID string) (*Progress, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: itemPrefix + importID},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, api.ErrNotFound
+	}
+
+	progress := &Progress{}
+	if err = attributevalue.UnmarshalMap(resp.Item, progress); err != nil {
+		return nil, err
+	}
+	progress.ImportID = importID
+	return progress, nil
+}
+
+// saveProgress replaces the saved progress of an import
+func saveProgress(ctx context.Context, client api.PutItemAPI, progress *Progress) error {
+	progress.TimeUpdated = getCurrentTime().Format(time.RFC3339)
+	item, err := attributevalue.MarshalMap(progress)
+	if err != nil {
+		return err
+	}
+	item["MessageID"] = &types.AttributeValueMemberS{Value: itemPrefix + progress.ImportID}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item:      item,
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
+
+// emailExists returns true if an email with messageID is stored
+func emailExists(ctx context.Context, client api.GetItemAPI, messageID string) (bool, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		ProjectionExpression: aws.String("MessageID"),
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return false, api.ErrTooManyRequests
+		}
+		return false, err
+	}
+	return len(resp.Item) > 0, nil
+}
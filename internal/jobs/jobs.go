@@ -0,0 +1,434 @@
+// Package jobs runs long operations, e.g. bulk changes of emails or archives of raw emails, as asynchronous jobs.
+// A job is saved in the email table and queued in JOBS_QUEUE, and the jobs function runs it in steps.
+// The job is saved after each step, so that it resumes where it stops when it's queued again before the timeout.
+// Jobs of the kinds in JOBS_WORKFLOW_KINDS are run by a Step Functions state machine instead, see RunWorkflow.
+// Each kind of job is registered by the package implementing it, see Register.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/google/uuid"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/datasource/queue"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Statuses of a job
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// itemPrefix is the prefix of the MessageID of job items, which are stored in the email table
+const itemPrefix = "job#"
+
+// stopMargin is the time left before the deadline at which a run stops, to save the job and queue it again
+const stopMargin = 30 * time.Second
+
+// ErrNotEnabled is returned if JOBS_QUEUE isn't set
+var ErrNotEnabled = errors.New("jobs are not enabled, JOBS_QUEUE is not set")
+
+// errCanceled is returned when a job is saved after it's canceled
+var errCanceled = errors.New("job is canceled")
+
+// now is equal to time.Now, but will be replaced during testing
+var now = time.Now
+
+// StepAPI defines set of API available to the steps of jobs, and required to run them with RunWorkflow
+type StepAPI interface {
+	clients.Table
+	clients.Storage
+}
+
+// RunAPI defines set of API required to run a job with Run, which queues the job again if it doesn't finish in time
+type RunAPI interface {
+	StepAPI
+	clients.Queue
+}
+
+// CreateAPI defines set of API required to request a job
+type CreateAPI interface {
+	api.PutItemAPI
+	queue.SendMessageAPI
+}
+
+// Job has the status of a job, which is embedded by the job of each kind with its input and progress
+type Job struct {
+	JobID         string `json:"jobID" dynamodbav:"-"`
+	Kind          string `json:"kind"`
+	Status        string `json:"status"`
+	LastError     string `json:"lastError,omitempty"` // error of the job if failed, or of the last failed item of the job
+	Runs          int    `json:"-"`                   // runs started, a run stops before the timeout and queues the job again
+	Parent        string `json:"parent,omitempty"`    // ID of the job this job is a part of, see Partitioned
+	Parts         int    `json:"parts,omitempty"`     // parts run in parallel by the state machine, whose progress is added when they finish
+	TimeCreated   string `json:"timeCreated"`
+	TimeUpdated   string `json:"timeUpdated"`
+	TimeCompleted string `json:"timeCompleted,omitempty"` // also set when the job fails or is canceled
+}
+
+func (j *Job) job() *Job {
+	return j
+}
+
+// Runner is a job of a kind, which is a pointer to a struct embedding Job
+type Runner interface {
+	job() *Job
+	// Step runs the next part of the job, and returns true after the last one.
+	// The job is saved after each step, so a step should take much less than the timeout of the function.
+	// An error fails the job, errors of single items should be recorded in the job instead.
+	Step(ctx context.Context, client StepAPI) (bool, error)
+	// Summary describes the result of the job for the logs
+	Summary() string
+}
+
+// Partitioned is a job that the state machine runs in parts in parallel, e.g. segments of a scan
+type Partitioned interface {
+	Runner
+	// Partition returns the part i of n of the job, as an empty job of the same kind with the input of the job
+	Partition(i, n int) Runner
+	// Merge adds the progress of a finished part to the job
+	Merge(part Runner)
+}
+
+// kinds are the functions returning an empty job of each registered kind
+var kinds = map[string]func() Runner{}
+
+// Register makes a kind of job available to the functions running and reading jobs.
+// It's called from init by the package implementing the kind, with a function returning an empty job of the kind.
+func Register(kind string, newRunner func() Runner) {
+	if _, ok := kinds[kind]; ok {
+		panic("jobs: kind " + kind + " is registered twice")
+	}
+	kinds[kind] = newRunner
+}
+
+// newRunner returns an empty job of a kind
+func newRunner(kind string) (Runner, error) {
+	if newRunner, ok := kinds[kind]; ok {
+		return newRunner(), nil
+	}
+	return nil, fmt.Errorf("unknown kind of job %q", kind)
+}
+
+// message is the message sent to JOBS_QUEUE or JOBS_WORKFLOW_QUEUE for a job
+type message struct {
+	JobID string `json:"jobID"`
+}
+
+// queueOf returns the queue of the jobs of a kind, which is JOBS_WORKFLOW_QUEUE if the kind is in JOBS_WORKFLOW_KINDS
+func queueOf(kind string) string {
+	if env.JobsWorkflowQueue != "" {
+		for _, k := range strings.Split(env.JobsWorkflowKinds, ",") {
+			if strings.TrimSpace(k) == kind {
+				return env.JobsWorkflowQueue
+			}
+		}
+	}
+	return env.JobsQueue
+}
+
+// Create saves a pending job of a kind, and queues it in JOBS_QUEUE, or in JOBS_WORKFLOW_QUEUE for the kinds run by the state machine.
+// The ID, kind, status and times of the job are set.
+func Create(ctx context.Context, client CreateAPI, kind string, runner Runner) error {
+	queueName := queueOf(kind)
+	if queueName == "" {
+		return ErrNotEnabled
+	}
+
+	created := now().UTC().Format(time.RFC3339)
+	job := runner.job()
+	job.JobID = uuid.New().String()
+	job.Kind = kind
+	job.Status = StatusPending
+	job.TimeCreated = created
+	job.TimeUpdated = created
+	if err := save(ctx, client, runner); err != nil {
+		return err
+	}
+
+	if err := enqueue(ctx, client, queueName, job.JobID); err != nil {
+		job.Status = StatusFailed
+		job.LastError = "failed to queue the job"
+		if saveErr := save(ctx, client, runner); saveErr != nil {
+			fmt.Printf("failed to save job %s, %v\n", job.JobID, saveErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// enqueue sends a message to a queue of jobs to run the job
+func enqueue(ctx context.Context, client queue.SendMessageAPI, queueName, jobID string) error {
+	result, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName: aws.String(queueName),
+	})
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(message{JobID: jobID})
+	if err != nil {
+		return err
+	}
+	_, err = client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    result.QueueUrl,
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+// ParseMessage returns the ID of the job of a message in JOBS_QUEUE
+func ParseMessage(body string) (string, error) {
+	var msg message
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		return "", err
+	}
+	if msg.JobID == "" {
+		return "", api.ErrInvalidInput
+	}
+	return msg.JobID, nil
+}
+
+// jobKey returns the key of the item of a job
+func jobKey(jobID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"MessageID": &types.AttributeValueMemberS{Value: itemPrefix + jobID},
+	}
+}
+
+// unmarshal returns the job of an item, as the registered job of its kind.
+// api.ErrNotFound is returned if kind isn't empty and the job is of another kind.
+func unmarshal(item map[string]types.AttributeValue, kind, jobID string) (Runner, error) {
+	var job Job
+	if err := attributevalue.UnmarshalMap(item, &job); err != nil {
+		return nil, err
+	}
+	if kind != "" && job.Kind != kind {
+		return nil, api.ErrNotFound
+	}
+
+	runner, err := newRunner(job.Kind)
+	if err != nil {
+		return nil, err
+	}
+	if err = attributevalue.UnmarshalMap(item, runner); err != nil {
+		return nil, err
+	}
+	runner.job().JobID = jobID
+	return runner, nil
+}
+
+// Get returns a job by its ID. Kind is the expected kind of the job, or empty for any kind,
+// and api.ErrNotFound is returned if the job is of another kind.
+func Get(ctx context.Context, client api.GetItemAPI, kind, jobID string) (Runner, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key:       jobKey(jobID),
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, api.ErrNotFound
+	}
+	return unmarshal(resp.Item, kind, jobID)
+}
+
+// save replaces the saved job, errCanceled is returned if the job is canceled meanwhile
+func save(ctx context.Context, client api.PutItemAPI, runner Runner) error {
+	job := runner.job()
+	job.TimeUpdated = now().UTC().Format(time.RFC3339)
+	item, err := attributevalue.MarshalMap(runner)
+	if err != nil {
+		return err
+	}
+	for name, value := range jobKey(job.JobID) {
+		item[name] = value
+	}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(env.TableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(MessageID) OR #status <> :canceled"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":canceled": &types.AttributeValueMemberS{Value: StatusCanceled},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return errCanceled
+		}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
+
+// Cancel cancels a pending or running job, and returns the canceled job. The job stops after the step it's running,
+// whose changes are kept. Kind is the expected kind of the job, or empty for any kind.
+// api.ErrNotFound is returned if the job doesn't exist, is of another kind, or is finished.
+func Cancel(ctx context.Context, client api.UpdateItemAPI, kind, jobID string) (Runner, error) {
+	canceled := now().UTC().Format(time.RFC3339)
+	condition := "#status IN (:pending, :running)"
+	values := map[string]types.AttributeValue{
+		":canceled": &types.AttributeValueMemberS{Value: StatusCanceled},
+		":pending":  &types.AttributeValueMemberS{Value: StatusPending},
+		":running":  &types.AttributeValueMemberS{Value: StatusRunning},
+		":time":     &types.AttributeValueMemberS{Value: canceled},
+	}
+	if kind != "" {
+		condition += " AND Kind = :kind"
+		values[":kind"] = &types.AttributeValueMemberS{Value: kind}
+	}
+	resp, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(env.TableName),
+		Key:                 jobKey(jobID),
+		UpdateExpression:    aws.String("SET #status = :canceled, TimeUpdated = :time, TimeCompleted = :time"),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return nil, api.ErrNotFound
+		}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	return unmarshal(resp.Attributes, kind, jobID)
+}
+
+// Run continues a job from where it stops, until its last step or until the deadline of ctx is near,
+// in which case the job is saved and queued again. Jobs that are finished are skipped,
+// a job fails if a step returns an error, and it stops if it's canceled.
+// Only errors reading, saving or queueing the job are returned.
+func Run(ctx context.Context, client RunAPI, jobID string) error {
+	done, err := run(ctx, client, jobID)
+	if err != nil || done {
+		return err
+	}
+	return enqueue(ctx, client, env.JobsQueue, jobID)
+}
+
+// run runs a job like Run, and returns true if the job doesn't need to run again.
+// The job is only saved when the deadline is near, and the caller runs it again, e.g. by queueing it.
+// A part of a job stops if its parent is finished or canceled.
+func run(ctx context.Context, client StepAPI, jobID string) (bool, error) {
+	runner, err := Get(ctx, client, "", jobID)
+	if err != nil {
+		if err == api.ErrNotFound {
+			fmt.Printf("job %s not found, skipping\n", jobID)
+			return true, nil
+		}
+		return false, err
+	}
+	job := runner.job()
+	if !active(job) {
+		fmt.Printf("%s job %s is %s, skipping\n", job.Kind, jobID, job.Status)
+		return true, nil
+	}
+
+	job.Status = StatusRunning
+	job.Runs++
+	if err = save(ctx, client, runner); err != nil {
+		return true, stopped(job, err)
+	}
+
+	for {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < stopMargin {
+			fmt.Printf("stopping %s job %s before the deadline\n", job.Kind, jobID)
+			if err = save(ctx, client, runner); err != nil {
+				return true, stopped(job, err)
+			}
+			return false, nil
+		}
+		if job.Parent != "" {
+			running, err := parentActive(ctx, client, job)
+			if err != nil {
+				return false, err
+			}
+			if !running {
+				return true, nil
+			}
+		}
+
+		done, err := runner.Step(ctx, client)
+		if err != nil {
+			return true, fail(ctx, client, runner, err)
+		}
+		if done {
+			job.Status = StatusCompleted
+			job.TimeCompleted = now().UTC().Format(time.RFC3339)
+			fmt.Printf("%s job %s completed: %s\n", job.Kind, jobID, runner.Summary())
+			return true, stopped(job, save(ctx, client, runner))
+		}
+		if err = save(ctx, client, runner); err != nil {
+			return true, stopped(job, err)
+		}
+	}
+}
+
+// active returns whether a job is pending or running
+func active(job *Job) bool {
+	return job.Status == StatusPending || job.Status == StatusRunning
+}
+
+// parentActive returns whether the parent of a part of a job is pending or running, so that parts stop when it's canceled
+func parentActive(ctx context.Context, client api.GetItemAPI, job *Job) (bool, error) {
+	parent, err := Get(ctx, client, job.Kind, job.Parent)
+	if err != nil && err != api.ErrNotFound {
+		return false, err
+	}
+	if err == api.ErrNotFound || !active(parent.job()) {
+		fmt.Printf("parent job %s of %s job %s is finished, stopping\n", job.Parent, job.Kind, job.JobID)
+		return false, nil
+	}
+	return true, nil
+}
+
+// stopped returns err of saving a job, or nil if the job isn't saved because it's canceled
+func stopped(job *Job, err error) error {
+	if err == errCanceled {
+		fmt.Printf("%s job %s is canceled, stopping\n", job.Kind, job.JobID)
+		return nil
+	}
+	return err
+}
+
+// fail saves the job as failed with err
+func fail(ctx context.Context, client api.PutItemAPI, runner Runner, err error) error {
+	job := runner.job()
+	fmt.Printf("%s job %s failed, %v\n", job.Kind, job.JobID, err)
+	job.Status = StatusFailed
+	job.LastError = err.Error()
+	job.TimeCompleted = now().UTC().Format(time.RFC3339)
+	return stopped(job, save(ctx, client, runner))
+}
@@ -0,0 +1,244 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+const kindCount = "count"
+
+// countJob counts up to Total, a step at a time
+type countJob struct {
+	Job
+	Total int
+	Count int
+	Err   string // error of the step after which Count is Total, if set
+}
+
+func (j *countJob) Step(_ context.Context, _ StepAPI) (bool, error) {
+	j.Count++
+	if j.Count < j.Total {
+		return false, nil
+	}
+	if j.Err != "" {
+		return false, errors.New(j.Err)
+	}
+	return true, nil
+}
+
+func (j *countJob) Summary() string {
+	return fmt.Sprintf("counted to %d", j.Count)
+}
+
+func (j *countJob) Partition(_, _ int) Runner {
+	return &countJob{Total: j.Total, Err: j.Err}
+}
+
+func (j *countJob) Merge(part Runner) {
+	j.Count += part.(*countJob).Count
+}
+
+func init() {
+	Register(kindCount, func() Runner { return &countJob{} })
+}
+
+// mockJobTable keeps the saved items of jobs by their keys
+type mockJobTable struct {
+	clients.Fake
+	items map[string]map[string]types.AttributeValue
+	saves int
+}
+
+func (m *mockJobTable) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: m.items[params.Key["MessageID"].(*types.AttributeValueMemberS).Value]}, nil
+}
+
+func (m *mockJobTable) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	key := params.Item["MessageID"].(*types.AttributeValueMemberS).Value
+	if saved, ok := m.items[key]; ok && saved["Status"].(*types.AttributeValueMemberS).Value == StatusCanceled {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	m.items[key] = params.Item
+	m.saves++
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockJobTable) job(t *testing.T, jobID string) *countJob {
+	job := &countJob{}
+	assert.Nil(t, attributevalue.UnmarshalMap(m.items[itemPrefix+jobID], job))
+	return job
+}
+
+func newMockJobTable(t *testing.T, job *countJob) *mockJobTable {
+	item, err := attributevalue.MarshalMap(job)
+	assert.Nil(t, err)
+	item["MessageID"] = &types.AttributeValueMemberS{Value: itemPrefix + job.JobID}
+	return &mockJobTable{items: map[string]map[string]types.AttributeValue{itemPrefix + job.JobID: item}}
+}
+
+func TestCreate(t *testing.T) {
+	env.JobsQueue = "jobs"
+	defer func() { env.JobsQueue = "" }()
+	table := &mockJobTable{items: map[string]map[string]types.AttributeValue{}}
+	var body string
+	table.MockGetQueueUrl = func(_ context.Context, params *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+		assert.Equal(t, "jobs", *params.QueueName)
+		return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.example.com/jobs")}, nil
+	}
+	table.MockSendMessage = func(_ context.Context, params *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+		body = *params.MessageBody
+		return &sqs.SendMessageOutput{}, nil
+	}
+
+	job := &countJob{Total: 3}
+	assert.Nil(t, Create(context.TODO(), table, kindCount, job))
+	assert.NotEmpty(t, job.JobID)
+	assert.Equal(t, kindCount, job.Kind)
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Equal(t, 3, table.job(t, job.JobID).Total)
+	jobID, err := ParseMessage(body)
+	assert.Nil(t, err)
+	assert.Equal(t, job.JobID, jobID)
+
+	// the job is saved as failed if it can't be queued
+	table.MockSendMessage = func(_ context.Context, _ *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+		return nil, errors.New("queue failed")
+	}
+	job = &countJob{Total: 3}
+	assert.EqualError(t, Create(context.TODO(), table, kindCount, job), "queue failed")
+	assert.Equal(t, StatusFailed, table.job(t, job.JobID).Status)
+
+	env.JobsQueue = ""
+	assert.Equal(t, ErrNotEnabled, Create(context.TODO(), table, kindCount, &countJob{}))
+}
+
+func TestParseMessage(t *testing.T) {
+	jobID, err := ParseMessage(`{"jobID":"exampleJobID"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "exampleJobID", jobID)
+
+	_, err = ParseMessage(`{"kind":"export"}`)
+	assert.Equal(t, api.ErrInvalidInput, err)
+}
+
+func TestGet(t *testing.T) {
+	table := newMockJobTable(t, &countJob{Job: Job{JobID: "exampleJobID", Kind: kindCount, Status: StatusRunning}, Total: 3, Count: 1})
+
+	job, err := Get(context.TODO(), table, "", "exampleJobID")
+	assert.Nil(t, err)
+	if assert.IsType(t, &countJob{}, job) {
+		assert.Equal(t, "exampleJobID", job.(*countJob).JobID)
+		assert.Equal(t, 1, job.(*countJob).Count)
+	}
+
+	_, err = Get(context.TODO(), table, "export", "exampleJobID")
+	assert.Equal(t, api.ErrNotFound, err)
+	_, err = Get(context.TODO(), table, "", "otherJobID")
+	assert.Equal(t, api.ErrNotFound, err)
+}
+
+func TestRun(t *testing.T) {
+	table := newMockJobTable(t, &countJob{Job: Job{JobID: "exampleJobID", Kind: kindCount, Status: StatusPending}, Total: 3})
+
+	assert.Nil(t, Run(context.TODO(), table, "exampleJobID"))
+	job := table.job(t, "exampleJobID")
+	assert.Equal(t, StatusCompleted, job.Status)
+	assert.Equal(t, 3, job.Count)
+	assert.Equal(t, 1, job.Runs)
+	assert.NotEmpty(t, job.TimeCompleted)
+	assert.Equal(t, 4, table.saves) // when it starts, and after each step
+
+	// finished jobs are skipped
+	assert.Nil(t, Run(context.TODO(), table, "exampleJobID"))
+	assert.Equal(t, 4, table.saves)
+}
+
+func TestRun_Failed(t *testing.T) {
+	table := newMockJobTable(t, &countJob{Job: Job{JobID: "exampleJobID", Kind: kindCount, Status: StatusPending}, Total: 2, Err: "step failed"})
+
+	assert.Nil(t, Run(context.TODO(), table, "exampleJobID"))
+	job := table.job(t, "exampleJobID")
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Equal(t, "step failed", job.LastError)
+	assert.Equal(t, 2, job.Count)
+}
+
+func TestRun_Deadline(t *testing.T) {
+	table := newMockJobTable(t, &countJob{Job: Job{JobID: "exampleJobID", Kind: kindCount, Status: StatusPending}, Total: 3})
+	var queued bool
+	table.MockGetQueueUrl = func(_ context.Context, _ *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+		return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.example.com/jobs")}, nil
+	}
+	table.MockSendMessage = func(_ context.Context, _ *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+		queued = true
+		return &sqs.SendMessageOutput{}, nil
+	}
+
+	// it's queued again without running a step if the deadline is near
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	assert.Nil(t, Run(ctx, table, "exampleJobID"))
+	assert.True(t, queued)
+	job := table.job(t, "exampleJobID")
+	assert.Equal(t, StatusRunning, job.Status)
+	assert.Equal(t, 0, job.Count)
+}
+
+func TestRun_Canceled(t *testing.T) {
+	table := newMockJobTable(t, &countJob{Job: Job{JobID: "exampleJobID", Kind: kindCount, Status: StatusRunning}, Total: 3})
+	client := &canceledJobTable{mockJobTable: table}
+
+	// the job is canceled after it's read, so it stops without running a step
+	assert.Nil(t, Run(context.TODO(), client, "exampleJobID"))
+	assert.Equal(t, 0, table.job(t, "exampleJobID").Count)
+	assert.Equal(t, 0, table.saves)
+}
+
+// canceledJobTable rejects saving jobs, as if they are canceled
+type canceledJobTable struct {
+	*mockJobTable
+}
+
+func (m *canceledJobTable) PutItem(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return nil, &types.ConditionalCheckFailedException{}
+}
+
+func TestCancel(t *testing.T) {
+	env.TableName = "table-for-jobs"
+	canceled, err := attributevalue.MarshalMap(countJob{Job: Job{Kind: kindCount, Status: StatusCanceled}, Total: 3})
+	assert.Nil(t, err)
+	var updateErr error
+	client := clients.Fake{
+		MockUpdateItem: func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			assert.Equal(t, "job#exampleJobID", params.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+			assert.Equal(t, "#status IN (:pending, :running)", *params.ConditionExpression)
+			return &dynamodb.UpdateItemOutput{Attributes: canceled}, updateErr
+		},
+	}
+
+	job, err := Cancel(context.TODO(), client, "", "exampleJobID")
+	assert.Nil(t, err)
+	if assert.IsType(t, &countJob{}, job) {
+		assert.Equal(t, "exampleJobID", job.(*countJob).JobID)
+		assert.Equal(t, StatusCanceled, job.(*countJob).Status)
+	}
+
+	// the job doesn't exist or is finished
+	updateErr = &types.ConditionalCheckFailedException{}
+	_, err = Cancel(context.TODO(), client, "", "exampleJobID")
+	assert.Equal(t, api.ErrNotFound, err)
+}
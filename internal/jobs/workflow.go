@@ -0,0 +1,185 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Actions of the jobsWorkflow function, each invoked by a state of the jobs state machine
+const (
+	ActionStart  = "start"  // splits the job into parts, see Partitioned
+	ActionRun    = "run"    // runs a part until it's done or the deadline is near, the state machine invokes it again until it's done
+	ActionFinish = "finish" // adds the progress of the parts to the job, and completes it
+)
+
+const (
+	// defaultParts is the number of parts of a partitioned job if JOBS_WORKFLOW_PARTS isn't set
+	defaultParts = 4
+	// maxParts is the maximum number of parts of a partitioned job
+	maxParts = 100
+)
+
+// WorkflowInput is the input of the jobsWorkflow function from the state machine
+type WorkflowInput struct {
+	Action string `json:"action"`
+	JobID  string `json:"jobID"`
+}
+
+// WorkflowOutput is the output of the jobsWorkflow function to the state machine
+type WorkflowOutput struct {
+	JobID string   `json:"jobID"`
+	Parts []string `json:"parts"` // IDs of the jobs the run state is mapped over, which are the job itself if it isn't partitioned
+	Done  bool     `json:"done"`  // true if the job, or the part, doesn't need to run again
+}
+
+// RunWorkflow runs an action of the jobs state machine on a job.
+// The state machine starts a job, runs its parts in parallel until they're done, then finishes the job.
+// Like Run, jobs that are finished are skipped, and only errors reading, saving or splitting jobs are returned,
+// which the state machine retries.
+func RunWorkflow(ctx context.Context, client StepAPI, input WorkflowInput) (*WorkflowOutput, error) {
+	if input.JobID == "" {
+		return nil, api.ErrInvalidInput
+	}
+	switch input.Action {
+	case ActionStart:
+		return start(ctx, client, input.JobID)
+	case ActionRun:
+		done, err := run(ctx, client, input.JobID)
+		if err != nil {
+			return nil, err
+		}
+		return &WorkflowOutput{JobID: input.JobID, Parts: []string{}, Done: done}, nil
+	case ActionFinish:
+		return finish(ctx, client, input.JobID)
+	}
+	return nil, fmt.Errorf("unknown action %q", input.Action)
+}
+
+// start splits a partitioned job into JOBS_WORKFLOW_PARTS parts, which are saved as pending jobs with the job as their parent.
+// The parts are created once, and are returned again if the state machine retries.
+// Jobs that aren't partitioned are run as they are.
+func start(ctx context.Context, client StepAPI, jobID string) (*WorkflowOutput, error) {
+	output := &WorkflowOutput{JobID: jobID, Parts: []string{}}
+	runner, err := Get(ctx, client, "", jobID)
+	if err != nil {
+		if err == api.ErrNotFound {
+			fmt.Printf("job %s not found, skipping\n", jobID)
+			output.Done = true
+			return output, nil
+		}
+		return nil, err
+	}
+	job := runner.job()
+	if !active(job) {
+		fmt.Printf("%s job %s is %s, skipping\n", job.Kind, jobID, job.Status)
+		output.Done = true
+		return output, nil
+	}
+
+	partitioned, ok := runner.(Partitioned)
+	n := parts()
+	if job.Parts == 0 && (!ok || n == 1) {
+		output.Parts = []string{jobID}
+		return output, nil
+	}
+
+	if job.Parts == 0 {
+		created := now().UTC().Format(time.RFC3339)
+		for i := 0; i < n; i++ {
+			part := partitioned.Partition(i, n)
+			p := part.job()
+			p.JobID = partID(jobID, i)
+			p.Kind = job.Kind
+			p.Status = StatusPending
+			p.Parent = jobID
+			p.TimeCreated = created
+			if err = save(ctx, client, part); err != nil {
+				return nil, err
+			}
+		}
+
+		job.Status = StatusRunning
+		job.Parts = n
+		job.Runs++
+		if err = save(ctx, client, runner); err != nil {
+			if err == errCanceled {
+				fmt.Printf("%s job %s is canceled, stopping\n", job.Kind, jobID)
+				output.Done = true
+				return output, nil
+			}
+			return nil, err
+		}
+		fmt.Printf("%s job %s is split into %d parts\n", job.Kind, jobID, n)
+	}
+
+	for i := 0; i < job.Parts; i++ {
+		output.Parts = append(output.Parts, partID(jobID, i))
+	}
+	return output, nil
+}
+
+// finish adds the progress of the parts of a job to it after they're done, and completes it.
+// The job fails with the error of a part that failed or is canceled.
+func finish(ctx context.Context, client StepAPI, jobID string) (*WorkflowOutput, error) {
+	output := &WorkflowOutput{JobID: jobID, Parts: []string{}, Done: true}
+	runner, err := Get(ctx, client, "", jobID)
+	if err != nil {
+		if err == api.ErrNotFound {
+			return output, nil
+		}
+		return nil, err
+	}
+	job := runner.job()
+	partitioned, ok := runner.(Partitioned)
+	if !active(job) || job.Parts == 0 || !ok {
+		return output, nil // finished by its run, or canceled
+	}
+
+	var failure error
+	for i := 0; i < job.Parts; i++ {
+		part, err := Get(ctx, client, job.Kind, partID(jobID, i))
+		if err != nil {
+			return nil, err
+		}
+		p := part.job()
+		partitioned.Merge(part)
+		switch p.Status {
+		case StatusCompleted:
+		case StatusFailed:
+			failure = fmt.Errorf("part %s failed, %s", p.JobID, p.LastError)
+		default:
+			failure = fmt.Errorf("part %s is %s", p.JobID, p.Status)
+		}
+	}
+	if failure != nil {
+		err = fail(ctx, client, runner, failure)
+	} else {
+		job.Status = StatusCompleted
+		job.TimeCompleted = now().UTC().Format(time.RFC3339)
+		fmt.Printf("%s job %s completed: %s\n", job.Kind, jobID, runner.Summary())
+		err = stopped(job, save(ctx, client, runner))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// partID returns the job ID of the part i of a job
+func partID(jobID string, i int) string {
+	return jobID + "." + strconv.Itoa(i)
+}
+
+// parts returns JOBS_WORKFLOW_PARTS, or defaultParts if it isn't a positive number, up to maxParts
+func parts() int {
+	n, err := strconv.Atoi(env.JobsWorkflowParts)
+	if err != nil || n <= 0 {
+		return defaultParts
+	}
+	return min(n, maxParts)
+}
@@ -0,0 +1,163 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+func TestCreate_Workflow(t *testing.T) {
+	env.JobsQueue = "jobs"
+	env.JobsWorkflowQueue = "jobs-workflow"
+	env.JobsWorkflowKinds = "export, " + kindCount
+	defer func() { env.JobsQueue, env.JobsWorkflowQueue, env.JobsWorkflowKinds = "", "", "" }()
+	table := &mockJobTable{items: map[string]map[string]types.AttributeValue{}}
+	var queueName string
+	table.MockGetQueueUrl = func(_ context.Context, params *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+		queueName = *params.QueueName
+		return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.example.com/" + queueName)}, nil
+	}
+	table.MockSendMessage = func(_ context.Context, _ *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+		return &sqs.SendMessageOutput{}, nil
+	}
+
+	assert.Nil(t, Create(context.TODO(), table, kindCount, &countJob{Total: 3}))
+	assert.Equal(t, "jobs-workflow", queueName)
+
+	// the kind is run by the jobs function if the workflow isn't enabled
+	env.JobsWorkflowQueue = ""
+	assert.Nil(t, Create(context.TODO(), table, kindCount, &countJob{Total: 3}))
+	assert.Equal(t, "jobs", queueName)
+}
+
+func TestRunWorkflow(t *testing.T) {
+	env.JobsWorkflowParts = "2"
+	defer func() { env.JobsWorkflowParts = "" }()
+	table := newMockJobTable(t, &countJob{Job: Job{JobID: "exampleJobID", Kind: kindCount, Status: StatusPending}, Total: 3})
+	ctx := context.TODO()
+
+	output, err := RunWorkflow(ctx, table, WorkflowInput{Action: ActionStart, JobID: "exampleJobID"})
+	assert.Nil(t, err)
+	assert.False(t, output.Done)
+	assert.Equal(t, []string{"exampleJobID.0", "exampleJobID.1"}, output.Parts)
+	job := table.job(t, "exampleJobID")
+	assert.Equal(t, StatusRunning, job.Status)
+	assert.Equal(t, 2, job.Parts)
+	part := table.job(t, "exampleJobID.1")
+	assert.Equal(t, StatusPending, part.Status)
+	assert.Equal(t, "exampleJobID", part.Parent)
+	assert.Equal(t, 3, part.Total)
+
+	// the parts are created once
+	saves := table.saves
+	output, err = RunWorkflow(ctx, table, WorkflowInput{Action: ActionStart, JobID: "exampleJobID"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"exampleJobID.0", "exampleJobID.1"}, output.Parts)
+	assert.Equal(t, saves, table.saves)
+
+	for _, partID := range output.Parts {
+		partOutput, err := RunWorkflow(ctx, table, WorkflowInput{Action: ActionRun, JobID: partID})
+		assert.Nil(t, err)
+		assert.True(t, partOutput.Done)
+		assert.Equal(t, StatusCompleted, table.job(t, partID).Status)
+	}
+
+	output, err = RunWorkflow(ctx, table, WorkflowInput{Action: ActionFinish, JobID: "exampleJobID"})
+	assert.Nil(t, err)
+	assert.True(t, output.Done)
+	job = table.job(t, "exampleJobID")
+	assert.Equal(t, StatusCompleted, job.Status)
+	assert.Equal(t, 6, job.Count)
+	assert.NotEmpty(t, job.TimeCompleted)
+
+	// finished jobs are skipped
+	output, err = RunWorkflow(ctx, table, WorkflowInput{Action: ActionStart, JobID: "exampleJobID"})
+	assert.Nil(t, err)
+	assert.True(t, output.Done)
+	assert.Empty(t, output.Parts)
+
+	_, err = RunWorkflow(ctx, table, WorkflowInput{Action: "pause", JobID: "exampleJobID"})
+	assert.EqualError(t, err, `unknown action "pause"`)
+}
+
+func TestRunWorkflow_Unpartitioned(t *testing.T) {
+	env.JobsWorkflowParts = "1"
+	defer func() { env.JobsWorkflowParts = "" }()
+	table := newMockJobTable(t, &countJob{Job: Job{JobID: "exampleJobID", Kind: kindCount, Status: StatusPending}, Total: 3})
+	ctx := context.TODO()
+
+	output, err := RunWorkflow(ctx, table, WorkflowInput{Action: ActionStart, JobID: "exampleJobID"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"exampleJobID"}, output.Parts)
+
+	output, err = RunWorkflow(ctx, table, WorkflowInput{Action: ActionRun, JobID: "exampleJobID"})
+	assert.Nil(t, err)
+	assert.True(t, output.Done)
+
+	// the job is completed by its run
+	saves := table.saves
+	output, err = RunWorkflow(ctx, table, WorkflowInput{Action: ActionFinish, JobID: "exampleJobID"})
+	assert.Nil(t, err)
+	assert.True(t, output.Done)
+	assert.Equal(t, saves, table.saves)
+	job := table.job(t, "exampleJobID")
+	assert.Equal(t, StatusCompleted, job.Status)
+	assert.Equal(t, 3, job.Count)
+}
+
+func TestRunWorkflow_Deadline(t *testing.T) {
+	table := newMockJobTable(t, &countJob{Job: Job{JobID: "exampleJobID", Kind: kindCount, Status: StatusPending}, Total: 3})
+
+	// the state machine runs it again, it isn't queued
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	output, err := RunWorkflow(ctx, table, WorkflowInput{Action: ActionRun, JobID: "exampleJobID"})
+	assert.Nil(t, err)
+	assert.False(t, output.Done)
+	job := table.job(t, "exampleJobID")
+	assert.Equal(t, StatusRunning, job.Status)
+	assert.Equal(t, 0, job.Count)
+}
+
+func TestRunWorkflow_CanceledParent(t *testing.T) {
+	table := newMockJobTable(t, &countJob{Job: Job{JobID: "exampleJobID", Kind: kindCount, Status: StatusCanceled, Parts: 1}, Total: 3})
+	assert.Nil(t, save(context.TODO(), table, &countJob{Job: Job{JobID: "exampleJobID.0", Kind: kindCount, Status: StatusPending, Parent: "exampleJobID"}, Total: 3}))
+
+	output, err := RunWorkflow(context.TODO(), table, WorkflowInput{Action: ActionRun, JobID: "exampleJobID.0"})
+	assert.Nil(t, err)
+	assert.True(t, output.Done)
+	assert.Equal(t, 0, table.job(t, "exampleJobID.0").Count)
+
+	output, err = RunWorkflow(context.TODO(), table, WorkflowInput{Action: ActionFinish, JobID: "exampleJobID"})
+	assert.Nil(t, err)
+	assert.True(t, output.Done)
+	assert.Equal(t, StatusCanceled, table.job(t, "exampleJobID").Status)
+}
+
+func TestRunWorkflow_FailedPart(t *testing.T) {
+	env.JobsWorkflowParts = "2"
+	defer func() { env.JobsWorkflowParts = "" }()
+	table := newMockJobTable(t, &countJob{Job: Job{JobID: "exampleJobID", Kind: kindCount, Status: StatusPending}, Total: 2, Err: "step failed"})
+	ctx := context.TODO()
+
+	output, err := RunWorkflow(ctx, table, WorkflowInput{Action: ActionStart, JobID: "exampleJobID"})
+	assert.Nil(t, err)
+	for _, partID := range output.Parts {
+		_, err = RunWorkflow(ctx, table, WorkflowInput{Action: ActionRun, JobID: partID})
+		assert.Nil(t, err)
+	}
+
+	_, err = RunWorkflow(ctx, table, WorkflowInput{Action: ActionFinish, JobID: "exampleJobID"})
+	assert.Nil(t, err)
+	job := table.job(t, "exampleJobID")
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Equal(t, "part exampleJobID.1 failed, step failed", job.LastError)
+	assert.Equal(t, 4, job.Count)
+}
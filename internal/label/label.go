@@ -0,0 +1,261 @@
+// Package label manages user-defined labels, e.g. Work, Personal or Receipts, which organize emails beyond inbox, sent and draft.
+// An email has any number of labels in its Labels attribute, which are added and removed by email.UpdateLabels,
+// and emails with a label are listed by email.List. Labels are defined here, so that clients can show them with their colors.
+package label
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+const (
+	// labelsID is the MessageID of the item storing the label definitions in the email table
+	labelsID = "label#definitions"
+
+	// MaxLabels is the maximum number of defined labels
+	MaxLabels = 500
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// now is equal to time.Now, but will be replaced during testing
+var now = time.Now
+
+// Label is a user-defined label, identified by its name
+type Label struct {
+	Name        string `json:"name"`
+	Color       string `json:"color,omitempty"` // e.g. #1a73e8
+	TimeCreated string `json:"timeCreated"`
+}
+
+// CreateInput is the input of Create
+type CreateInput struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// UpdateInput is the input of Update
+type UpdateInput struct {
+	Name  string `json:"-"`
+	Color string `json:"color"` // empty to remove the color
+}
+
+// Create defines a label.
+// api.ErrLabelExists is returned if it's already defined, and api.ErrTooManyLabels if MaxLabels are defined.
+func Create(ctx context.Context, client api.CreateLabelAPI, input CreateInput) (*Label, error) {
+	name, err := normalizeName(input.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !validColor(input.Color) {
+		return nil, api.ErrInvalidInput
+	}
+
+	existing, err := List(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range existing {
+		if label.Name == name {
+			return nil, api.ErrLabelExists
+		}
+	}
+	if len(existing) >= MaxLabels {
+		return nil, api.ErrTooManyLabels
+	}
+
+	label := &Label{
+		Name:        name,
+		Color:       input.Color,
+		TimeCreated: now().UTC().Format(time.RFC3339),
+	}
+	entry := map[string]types.AttributeValue{
+		"TimeCreated": &types.AttributeValueMemberS{Value: label.TimeCreated},
+	}
+	if label.Color != "" {
+		entry["Color"] = &types.AttributeValueMemberS{Value: label.Color}
+	}
+
+	// a nested attribute can only be set in an existing map
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: labelsID},
+		},
+		UpdateExpression: aws.String("SET Definitions = if_not_exists(Definitions, :empty)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":empty": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}},
+		},
+	})
+	if err != nil {
+		return nil, mapDynamoDBError(err)
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: labelsID},
+		},
+		UpdateExpression:    aws.String("SET Definitions.#name = :label"),
+		ConditionExpression: aws.String("attribute_not_exists(Definitions.#name) AND size(Definitions) < :max"),
+		ExpressionAttributeNames: map[string]string{
+			"#name": label.Name,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":label": &types.AttributeValueMemberM{Value: entry},
+			":max":   &types.AttributeValueMemberN{Value: strconv.Itoa(MaxLabels)},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			// the label is defined concurrently, since the limit is checked above
+			return nil, api.ErrLabelExists
+		}
+		return nil, mapDynamoDBError(err)
+	}
+	return label, nil
+}
+
+// List returns the defined labels, ordered by name
+func List(ctx context.Context, client api.GetItemAPI) ([]Label, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: labelsID},
+		},
+	})
+	if err != nil {
+		return nil, mapDynamoDBError(err)
+	}
+
+	attr, ok := resp.Item["Definitions"].(*types.AttributeValueMemberM)
+	if !ok {
+		return []Label{}, nil
+	}
+	labels := make([]Label, 0, len(attr.Value))
+	for name, av := range attr.Value {
+		m, ok := av.(*types.AttributeValueMemberM)
+		if !ok {
+			continue
+		}
+		labels = append(labels, Label{
+			Name:        name,
+			Color:       stringValue(m.Value, "Color"),
+			TimeCreated: stringValue(m.Value, "TimeCreated"),
+		})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels, nil
+}
+
+// Update changes the color of a label.
+// api.ErrLabelNotFound is returned if it's not defined.
+func Update(ctx context.Context, client api.UpdateItemAPI, input UpdateInput) error {
+	name, err := normalizeName(input.Name)
+	if err != nil {
+		return api.ErrLabelNotFound
+	}
+	if !validColor(input.Color) {
+		return api.ErrInvalidInput
+	}
+
+	params := &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: labelsID},
+		},
+		UpdateExpression:    aws.String("REMOVE Definitions.#name.#color"),
+		ConditionExpression: aws.String("attribute_exists(Definitions.#name)"),
+		ExpressionAttributeNames: map[string]string{
+			"#name":  name,
+			"#color": "Color",
+		},
+	}
+	if input.Color != "" {
+		params.UpdateExpression = aws.String("SET Definitions.#name.#color = :color")
+		params.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":color": &types.AttributeValueMemberS{Value: input.Color},
+		}
+	}
+
+	_, err = client.UpdateItem(ctx, params)
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return api.ErrLabelNotFound
+		}
+		return mapDynamoDBError(err)
+	}
+	return nil
+}
+
+// Delete removes the definition of a label.
+// Emails keep the label, which can be removed from them by email.UpdateLabels.
+// api.ErrLabelNotFound is returned if it's not defined.
+func Delete(ctx context.Context, client api.UpdateItemAPI, name string) error {
+	name, err := normalizeName(name)
+	if err != nil {
+		return api.ErrLabelNotFound
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: labelsID},
+		},
+		UpdateExpression:    aws.String("REMOVE Definitions.#name"),
+		ConditionExpression: aws.String("attribute_exists(Definitions.#name)"),
+		ExpressionAttributeNames: map[string]string{
+			"#name": name,
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return api.ErrLabelNotFound
+		}
+		return mapDynamoDBError(err)
+	}
+	return nil
+}
+
+// normalizeName trims a label name, and validates it the same way as the labels of emails
+func normalizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > email.MaxLabelLength {
+		return "", api.ErrInvalidInput
+	}
+	return name, nil
+}
+
+// validColor returns true if color is empty or a hex color, e.g. #1a73e8
+func validColor(color string) bool {
+	return color == "" || colorPattern.MatchString(color)
+}
+
+// stringValue returns a string attribute of a map, or an empty string
+func stringValue(m map[string]types.AttributeValue, name string) string {
+	if s, ok := m[name].(*types.AttributeValueMemberS); ok {
+		return s.Value
+	}
+	return ""
+}
+
+func mapDynamoDBError(err error) error {
+	if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+		return api.ErrTooManyRequests
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package label
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockLabelsAPI stores the label definitions like DynamoDB
+type mockLabelsAPI struct {
+	definitions map[string]types.AttributeValue
+}
+
+func (m *mockLabelsAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.definitions == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{
+		Item: map[string]types.AttributeValue{"Definitions": &types.AttributeValueMemberM{Value: m.definitions}},
+	}, nil
+}
+
+func (m *mockLabelsAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if *params.UpdateExpression == "SET Definitions = if_not_exists(Definitions, :empty)" {
+		if m.definitions == nil {
+			m.definitions = make(map[string]types.AttributeValue)
+		}
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+
+	name := params.ExpressionAttributeNames["#name"]
+	label, exists := m.definitions[name].(*types.AttributeValueMemberM)
+	switch *params.UpdateExpression {
+	case "SET Definitions.#name = :label":
+		limit, _ := strconv.Atoi(params.ExpressionAttributeValues[":max"].(*types.AttributeValueMemberN).Value)
+		if exists || len(m.definitions) >= limit {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		m.definitions[name] = params.ExpressionAttributeValues[":label"]
+	case "SET Definitions.#name.#color = :color":
+		if !exists {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		label.Value["Color"] = params.ExpressionAttributeValues[":color"]
+	case "REMOVE Definitions.#name.#color":
+		if !exists {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		delete(label.Value, "Color")
+	case "REMOVE Definitions.#name":
+		if !exists {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		delete(m.definitions, name)
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestLabels(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	client := &mockLabelsAPI{}
+	ctx := context.TODO()
+
+	labels, err := List(ctx, client)
+	assert.NoError(t, err)
+	assert.Empty(t, labels)
+
+	work, err := Create(ctx, client, CreateInput{Name: " Work ", Color: "#1a73e8"})
+	assert.NoError(t, err)
+	assert.Equal(t, &Label{Name: "Work", Color: "#1a73e8", TimeCreated: "2024-05-01T12:00:00Z"}, work)
+
+	_, err = Create(ctx, client, CreateInput{Name: "Receipts"})
+	assert.NoError(t, err)
+
+	_, err = Create(ctx, client, CreateInput{Name: "Work"})
+	assert.Equal(t, api.ErrLabelExists, err)
+	_, err = Create(ctx, client, CreateInput{Name: " "})
+	assert.Equal(t, api.ErrInvalidInput, err)
+	_, err = Create(ctx, client, CreateInput{Name: "Personal", Color: "blue"})
+	assert.Equal(t, api.ErrInvalidInput, err)
+
+	labels, err = List(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, []Label{
+		{Name: "Receipts", TimeCreated: "2024-05-01T12:00:00Z"},
+		{Name: "Work", Color: "#1a73e8", TimeCreated: "2024-05-01T12:00:00Z"},
+	}, labels)
+
+	assert.NoError(t, Update(ctx, client, UpdateInput{Name: "Receipts", Color: "#0b8043"}))
+	assert.NoError(t, Update(ctx, client, UpdateInput{Name: "Work"}))
+	assert.Equal(t, api.ErrLabelNotFound, Update(ctx, client, UpdateInput{Name: "Personal"}))
+	assert.Equal(t, api.ErrInvalidInput, Update(ctx, client, UpdateInput{Name: "Work", Color: "#12"}))
+
+	labels, err = List(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, "#0b8043", labels[0].Color)
+	assert.Equal(t, "", labels[1].Color)
+
+	assert.NoError(t, Delete(ctx, client, "Work"))
+	assert.Equal(t, api.ErrLabelNotFound, Delete(ctx, client, "Work"))
+
+	labels, err = List(ctx, client)
+	assert.NoError(t, err)
+	assert.Len(t, labels, 1)
+}
+
+func TestCreate_TooManyLabels(t *testing.T) {
+	client := &mockLabelsAPI{definitions: make(map[string]types.AttributeValue)}
+	for i := 0; i < MaxLabels; i++ {
+		client.definitions["label"+strconv.Itoa(i)] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}}
+	}
+
+	_, err := Create(context.TODO(), client, CreateInput{Name: "Work"})
+	assert.Equal(t, api.ErrTooManyLabels, err)
+}
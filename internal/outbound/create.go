@@ -1,4 +1,4 @@
-package email
+package outbound
 
 import (
 	"context"
@@ -12,6 +12,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/uuid"
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/util/format"
 	"github.com/harryzcy/mailbox/internal/util/htmlutil"
@@ -20,7 +22,7 @@ import (
 
 // CreateInput represents the input of create method
 type CreateInput struct {
-	Input
+	email.Input
 	GenerateText string `json:"generateText"` // on, off, or auto (default)
 	Send         bool   `json:"send"`         // send email immediately
 	ReplyEmailID string `json:"replyEmailID"` // reply to an email, empty if not reply
@@ -28,16 +30,19 @@ type CreateInput struct {
 
 // CreateResult represents the result of create method
 type CreateResult struct {
-	TimeIndex
-	Subject  string   `json:"subject"`
-	From     []string `json:"from"`
-	To       []string `json:"to"`
-	Cc       []string `json:"cc"`
-	Bcc      []string `json:"bcc"`
-	ReplyTo  []string `json:"replyTo"`
-	Text     string   `json:"text"`
-	HTML     string   `json:"html"`
-	ThreadID string   `json:"threadID,omitempty"`
+	email.TimeIndex
+	Subject  string               `json:"subject"`
+	From     []string             `json:"from"`
+	To       []string             `json:"to"`
+	Cc       []string             `json:"cc"`
+	Bcc      []string             `json:"bcc"`
+	ReplyTo  []string             `json:"replyTo"`
+	Text     string               `json:"text"`
+	HTML     string               `json:"html"`
+	ThreadID string               `json:"threadID,omitempty"`
+	NoReply  bool                 `json:"noReply,omitempty"`
+	DryRun   bool                 `json:"dryRun,omitempty"`
+	Uploads  []email.UploadedFile `json:"uploads,omitempty"`
 }
 
 func generateDraftID() string {
@@ -53,14 +58,18 @@ var generateText = htmlutil.GenerateText
 // TODO: refactor this function
 //
 //gocyclo:ignore
-func Create(ctx context.Context, client api.CreateAndSendEmailAPI, input CreateInput) (*CreateResult, error) {
+func Create(ctx context.Context, client API, input CreateInput) (*CreateResult, error) {
+	if err := input.Validate(); err != nil {
+		return nil, api.ErrInvalidInput
+	}
+	input.ApplyNoReply()
 	input.MessageID = generateDraftID()
 	now := getUpdatedTime()
-	typeYearMonth, err := format.TypeYearMonth(EmailTypeDraft, now)
+	typeYearMonth, err := format.TypeYearMonth(email.EmailTypeDraft, now)
 	if err != nil {
 		return nil, err
 	}
-	dateTime := now.Format("02-15:04:05")
+	dateTime := format.DateTime(now, input.MessageID)
 
 	if (input.GenerateText == "on") || (input.GenerateText == "auto" && input.Text == "") {
 		input.Text, err = generateText(input.HTML)
@@ -109,7 +118,7 @@ func Create(ctx context.Context, client api.CreateAndSendEmailAPI, input CreateI
 			fmt.Println("found existing thread")
 			// for existing thread, we need to put the email and add MessageID to thread as DraftID attribute
 			_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-				TransactItems: []types.TransactWriteItem{
+				TransactItems: append([]types.TransactWriteItem{
 					{
 						Put: &types.Put{
 							TableName: aws.String(env.TableName),
@@ -128,7 +137,7 @@ func Create(ctx context.Context, client api.CreateAndSendEmailAPI, input CreateI
 							},
 						},
 					},
-				},
+				}, email.NewEmailCounterUpdates(item)...),
 			})
 			if err != nil {
 				if apiErr := new(types.TransactionCanceledException); errors.As(err, &apiErr) {
@@ -147,7 +156,7 @@ func Create(ctx context.Context, client api.CreateAndSendEmailAPI, input CreateI
 
 			t := time.Now().UTC()
 			var threadTypeYearMonth string
-			threadTypeYearMonth, err = format.TypeYearMonth(EmailTypeThread, t)
+			threadTypeYearMonth, err = format.TypeYearMonth(email.EmailTypeThread, t)
 			if err != nil {
 				return nil, err
 			}
@@ -162,10 +171,11 @@ func Create(ctx context.Context, client api.CreateAndSendEmailAPI, input CreateI
 					},
 				},
 				"TimeUpdated": &types.AttributeValueMemberS{Value: format.RFC3399(t)},
+				"ItemType":    &types.AttributeValueMemberS{Value: email.EmailTypeThread}, // indexed by the thread index
 				"DraftID":     item["MessageID"],
 			}
 			_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-				TransactItems: []types.TransactWriteItem{
+				TransactItems: append([]types.TransactWriteItem{
 					{
 						Put: &types.Put{
 							TableName: aws.String(env.TableName),
@@ -195,7 +205,7 @@ func Create(ctx context.Context, client api.CreateAndSendEmailAPI, input CreateI
 							},
 						},
 					},
-				},
+				}, email.NewEmailCounterUpdates(item)...),
 			})
 			if err != nil {
 				if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
@@ -205,11 +215,20 @@ func Create(ctx context.Context, client api.CreateAndSendEmailAPI, input CreateI
 			}
 		}
 	} else {
-		// is not part of the thread, so we can just put the email
-		_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
-			TableName: aws.String(env.TableName),
-			Item:      item,
-		})
+		// is not part of the thread, so we can just put the email, along with the drafts counter
+		if updates := email.NewEmailCounterUpdates(item); len(updates) > 0 {
+			_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+				TransactItems: append([]types.TransactWriteItem{{Put: &types.Put{
+					TableName: aws.String(env.TableName),
+					Item:      item,
+				}}}, updates...),
+			})
+		} else {
+			_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+				TableName: aws.String(env.TableName),
+				Item:      item,
+			})
+		}
 		if err != nil {
 			if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
 				return nil, api.ErrTooManyRequests
@@ -218,9 +237,9 @@ func Create(ctx context.Context, client api.CreateAndSendEmailAPI, input CreateI
 		}
 	}
 
-	emailType := EmailTypeDraft
+	emailType := email.EmailTypeDraft
 	if input.Send {
-		email := &Input{
+		msg := &email.Input{
 			MessageID:  input.MessageID,
 			Subject:    input.Subject,
 			From:       input.From,
@@ -228,28 +247,32 @@ func Create(ctx context.Context, client api.CreateAndSendEmailAPI, input CreateI
 			Cc:         input.Cc,
 			Bcc:        input.Bcc,
 			ReplyTo:    input.ReplyTo,
+			NoReply:    input.NoReply,
+			DryRun:     input.DryRun,
 			Text:       input.Text,
 			HTML:       input.HTML,
+			Uploads:    input.Uploads,
 			ThreadID:   threadID,
 			InReplyTo:  inReplyTo,
 			References: references,
 		}
 
 		var newMessageID string
-		if newMessageID, err = sendEmailViaSES(ctx, client, email); err != nil {
+		if newMessageID, err = sendEmailViaSES(ctx, client, msg); err != nil {
 			return nil, err
 		}
-		email.MessageID = newMessageID
+		msg.MessageID = newMessageID
+		input.DryRun = msg.DryRun
 
-		if err = markEmailAsSent(ctx, client, input.MessageID, email); err != nil {
+		if err = markEmailAsSent(ctx, client, input.MessageID, msg); err != nil {
 			return nil, err
 		}
 		input.MessageID = newMessageID
-		emailType = EmailTypeSent
+		emailType = email.EmailTypeSent
 	}
 
 	result := &CreateResult{
-		TimeIndex: TimeIndex{
+		TimeIndex: email.TimeIndex{
 			MessageID:   input.MessageID,
 			Type:        emailType,
 			TimeUpdated: now.Format(time.RFC3339),
@@ -262,6 +285,9 @@ func Create(ctx context.Context, client api.CreateAndSendEmailAPI, input CreateI
 		ReplyTo:  input.ReplyTo,
 		Text:     input.Text,
 		HTML:     input.HTML,
+		NoReply:  input.NoReply,
+		DryRun:   input.DryRun,
+		Uploads:  input.Uploads,
 		ThreadID: threadID,
 	}
 
@@ -280,27 +306,27 @@ type ThreadInfo struct {
 	ReplyToMessageID string // the original message id from the sender, rather than the one generated by SES
 }
 
-func getThreadInfo(ctx context.Context, client api.CreateAndSendEmailAPI, replyEmailID string) (*ThreadInfo, error) {
+func getThreadInfo(ctx context.Context, client clients.Table, replyEmailID string) (*ThreadInfo, error) {
 	fmt.Println("getting email to reply to")
-	email, err := Get(ctx, client, replyEmailID)
+	msg, err := email.Get(ctx, client, replyEmailID)
 	if err != nil {
 		return nil, err
 	}
 	var replyToMessageID string
-	switch email.Type {
-	case EmailTypeInbox:
-		replyToMessageID = email.OriginalMessageID
-	case EmailTypeSent:
-		replyToMessageID = fmt.Sprintf("%s@%s.amazonses.com", email.MessageID, env.Region)
+	switch msg.Type {
+	case email.EmailTypeInbox:
+		replyToMessageID = msg.OriginalMessageID
+	case email.EmailTypeSent:
+		replyToMessageID = fmt.Sprintf("%s@%s.amazonses.com", msg.MessageID, env.Region)
 	default:
 		return nil, errors.New("invalid email type")
 	}
 
 	return &ThreadInfo{
-		ThreadID:         email.ThreadID,
-		References:       email.References,
-		CreatingEmailID:  email.MessageID,
-		CreatingSubject:  email.Subject,
+		ThreadID:         msg.ThreadID,
+		References:       msg.References,
+		CreatingEmailID:  msg.MessageID,
+		CreatingSubject:  msg.Subject,
 		ReplyToMessageID: replyToMessageID,
 	}, nil
 }
@@ -1,4 +1,4 @@
-package email
+package outbound
 
 import (
 	"context"
@@ -13,34 +13,13 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/util/htmlutil"
 	"github.com/stretchr/testify/assert"
 )
 
-type mockCreateEmailAPI struct {
-	mockGetItem            func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
-	mockPutItem            func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
-	mockSendEmail          func(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
-	mockTransactWriteItems func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
-}
-
-func (m mockCreateEmailAPI) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
-	return m.mockGetItem(ctx, params, optFns...)
-}
-
-func (m mockCreateEmailAPI) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
-	return m.mockPutItem(ctx, params, optFns...)
-}
-
-func (m mockCreateEmailAPI) SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
-	return m.mockSendEmail(ctx, params, optFns...)
-}
-
-func (m mockCreateEmailAPI) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
-	return m.mockTransactWriteItems(ctx, params, optFns...)
-}
-
 func TestCreate(t *testing.T) {
 	oldGetUpdatedTime := getUpdatedTime
 	getUpdatedTime = func() time.Time { return time.Date(2022, 3, 16, 16, 55, 45, 0, time.UTC) }
@@ -48,17 +27,17 @@ func TestCreate(t *testing.T) {
 
 	env.TableName = "table-for-create"
 	tests := []struct {
-		client       func(t *testing.T) api.CreateAndSendEmailAPI
+		client       func(t *testing.T) API
 		input        CreateInput
 		generateText func(html string) (string, error)
 		expected     *CreateResult
 		expectedErr  error
 	}{
 		{ // without Send
-			client: func(t *testing.T) api.CreateAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockCreateEmailAPI{
-					mockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+				return clients.Fake{
+					MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						t.Helper()
 
 						assert.Equal(t, env.TableName, *params.TableName)
@@ -72,7 +51,7 @@ func TestCreate(t *testing.T) {
 				}
 			},
 			input: CreateInput{
-				Input: Input{
+				Input: email.Input{
 					Subject: "subject",
 					From:    []string{"example@example.com"},
 					To:      []string{"example@example.com"},
@@ -85,8 +64,8 @@ func TestCreate(t *testing.T) {
 				GenerateText: "off",
 			},
 			expected: &CreateResult{
-				TimeIndex: TimeIndex{
-					Type:        EmailTypeDraft,
+				TimeIndex: email.TimeIndex{
+					Type:        email.EmailTypeDraft,
 					TimeUpdated: "2022-03-16T16:55:45Z",
 				},
 				Subject: "subject",
@@ -100,16 +79,16 @@ func TestCreate(t *testing.T) {
 			},
 		},
 		{ // without Send
-			client: func(t *testing.T) api.CreateAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockCreateEmailAPI{
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+				return clients.Fake{
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
 				}
 			},
 			input: CreateInput{
-				Input: Input{
+				Input: email.Input{
 					Subject: "subject",
 					From:    []string{"example@example.com"},
 					To:      []string{"example@example.com"},
@@ -121,8 +100,8 @@ func TestCreate(t *testing.T) {
 				GenerateText: "auto",
 			},
 			expected: &CreateResult{
-				TimeIndex: TimeIndex{
-					Type:        EmailTypeDraft,
+				TimeIndex: email.TimeIndex{
+					Type:        email.EmailTypeDraft,
 					TimeUpdated: "2022-03-16T16:55:45Z",
 				},
 				Subject: "subject",
@@ -136,16 +115,16 @@ func TestCreate(t *testing.T) {
 			},
 		},
 		{ // without Send
-			client: func(t *testing.T) api.CreateAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockCreateEmailAPI{
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+				return clients.Fake{
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
 				}
 			},
 			input: CreateInput{
-				Input: Input{
+				Input: email.Input{
 					Subject: "subject",
 					From:    []string{"example@example.com"},
 					To:      []string{"example@example.com"},
@@ -158,8 +137,8 @@ func TestCreate(t *testing.T) {
 				GenerateText: "auto",
 			},
 			expected: &CreateResult{
-				TimeIndex: TimeIndex{
-					Type:        EmailTypeDraft,
+				TimeIndex: email.TimeIndex{
+					Type:        email.EmailTypeDraft,
 					TimeUpdated: "2022-03-16T16:55:45Z",
 				},
 				Subject: "subject",
@@ -173,16 +152,16 @@ func TestCreate(t *testing.T) {
 			},
 		},
 		{ // without Send
-			client: func(t *testing.T) api.CreateAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockCreateEmailAPI{
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+				return clients.Fake{
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
 				}
 			},
 			input: CreateInput{
-				Input: Input{
+				Input: email.Input{
 					Subject: "subject",
 					From:    []string{"example@example.com"},
 					To:      []string{"example@example.com"},
@@ -195,9 +174,9 @@ func TestCreate(t *testing.T) {
 				GenerateText: "on",
 			},
 			expected: &CreateResult{
-				TimeIndex: TimeIndex{
+				TimeIndex: email.TimeIndex{
 					MessageID:   "new-message-id",
-					Type:        EmailTypeDraft,
+					Type:        email.EmailTypeDraft,
 					TimeUpdated: "2022-03-16T16:55:45Z",
 				},
 				Subject: "subject",
@@ -212,18 +191,18 @@ func TestCreate(t *testing.T) {
 		},
 		{
 			// with Send
-			client: func(t *testing.T) api.CreateAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockCreateEmailAPI{
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+				return clients.Fake{
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
-					mockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					MockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
 						return &sesv2.SendEmailOutput{
 							MessageId: aws.String("sent-message-id"),
 						}, nil
 					},
-					mockTransactWriteItems: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					MockTransactWriteItems: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
 						t.Helper()
 						assert.Len(t, params.TransactItems, 2)
 
@@ -250,7 +229,7 @@ func TestCreate(t *testing.T) {
 				}
 			},
 			input: CreateInput{
-				Input: Input{
+				Input: email.Input{
 					Subject: "subject",
 					From:    []string{"example@example.com"},
 					To:      []string{"example@example.com"},
@@ -264,9 +243,9 @@ func TestCreate(t *testing.T) {
 				Send:         true,
 			},
 			expected: &CreateResult{
-				TimeIndex: TimeIndex{
+				TimeIndex: email.TimeIndex{
 					MessageID:   "sent-message-id",
-					Type:        EmailTypeSent,
+					Type:        email.EmailTypeSent,
 					TimeUpdated: "2022-03-16T16:55:45Z",
 				},
 				Subject: "subject",
@@ -280,16 +259,16 @@ func TestCreate(t *testing.T) {
 			},
 		},
 		{ // without Send
-			client: func(t *testing.T) api.CreateAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockCreateEmailAPI{
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+				return clients.Fake{
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
 				}
 			},
 			input: CreateInput{
-				Input:        Input{},
+				Input:        email.Input{},
 				GenerateText: "on",
 			},
 			generateText: func(_ string) (string, error) {
@@ -298,10 +277,10 @@ func TestCreate(t *testing.T) {
 			expectedErr: errors.New("err"),
 		},
 		{ // without Send
-			client: func(t *testing.T) api.CreateAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockCreateEmailAPI{
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+				return clients.Fake{
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, api.ErrInvalidInput
 					},
 				}
@@ -309,19 +288,19 @@ func TestCreate(t *testing.T) {
 			expectedErr: api.ErrInvalidInput,
 		},
 		{ // with Send
-			client: func(t *testing.T) api.CreateAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockCreateEmailAPI{
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+				return clients.Fake{
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
-					mockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					MockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
 						return &sesv2.SendEmailOutput{}, errSend
 					},
 				}
 			},
 			input: CreateInput{
-				Input: Input{
+				Input: email.Input{
 					From: []string{""},
 				},
 				Send: true,
@@ -329,28 +308,65 @@ func TestCreate(t *testing.T) {
 			expectedErr: errSend,
 		},
 		{ // with Send
-			client: func(t *testing.T) api.CreateAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockCreateEmailAPI{
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+				return clients.Fake{
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
-					mockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					MockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
 						return &sesv2.SendEmailOutput{MessageId: aws.String("sent-message-id")}, nil
 					},
-					mockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					MockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
 						return &dynamodb.TransactWriteItemsOutput{}, errBatchWrite
 					},
 				}
 			},
 			input: CreateInput{
-				Input: Input{
+				Input: email.Input{
 					From: []string{""},
 				},
 				Send: true,
 			},
 			expectedErr: errBatchWrite,
 		},
+		{ // invalid address
+			client: func(t *testing.T) API {
+				t.Helper()
+				return clients.Fake{}
+			},
+			input: CreateInput{
+				Input: email.Input{
+					To: []string{"example@-example.com"},
+				},
+			},
+			expectedErr: api.ErrInvalidInput,
+		},
+		{ // internationalized address
+			client: func(t *testing.T) API {
+				t.Helper()
+				return clients.Fake{
+					MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+						t.Helper()
+						assert.Equal(t, []string{"用户@例子.广告"}, params.Item["To"].(*types.AttributeValueMemberSS).Value)
+						return &dynamodb.PutItemOutput{}, nil
+					},
+				}
+			},
+			input: CreateInput{
+				Input: email.Input{
+					To: []string{"用户@例子.广告"},
+				},
+				GenerateText: "off",
+			},
+			expected: &CreateResult{
+				TimeIndex: email.TimeIndex{
+					Type:        email.EmailTypeDraft,
+					TimeUpdated: "2022-03-16T16:55:45Z",
+				},
+				To: []string{"用户@例子.广告"},
+			},
+		},
 	}
 
 	for i, test := range tests {
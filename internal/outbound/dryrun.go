@@ -0,0 +1,69 @@
+package outbound
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/google/uuid"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Sinks of dry-run sends
+const (
+	DryRunSimulator = "simulator" // SES mailbox simulator, which accepts the email without delivering it
+	DryRunNoop      = "noop"      // SES isn't called
+)
+
+// SimulatorAddress is the SES mailbox simulator address that accepts emails without delivering them
+const SimulatorAddress = "success@simulator.amazonses.com"
+
+// dryRunSink returns the sink of a send, or empty if the email should be sent.
+// DRY_RUN applies to all sends, and requested dry runs go to the simulator unless DRY_RUN is noop.
+func dryRunSink(requested bool) string {
+	switch strings.ToLower(env.DryRun) {
+	case "", "off", "false":
+		if requested {
+			return DryRunSimulator
+		}
+		return ""
+	case DryRunNoop:
+		return DryRunNoop
+	default:
+		// unknown values don't send, which is safer in staging environments
+		return DryRunSimulator
+	}
+}
+
+// deliver sends an email via SES, or routes it to the dry-run sink, and returns the ID of the message.
+// dryRun reports whether the email is simulated, which is the case for requested dry runs and when DRY_RUN is set.
+func deliver(ctx context.Context, client clients.Mailer, input *sesv2.SendEmailInput, requested bool) (messageID string, dryRun bool, err error) {
+	switch dryRunSink(requested) {
+	case DryRunNoop:
+		fmt.Println("dry run, not sending email")
+		return "dryrun-" + strings.ReplaceAll(uuid.New().String(), "-", ""), true, nil
+	case DryRunSimulator:
+		fmt.Println("dry run, sending email to the SES mailbox simulator")
+		// Destination is also the envelope of raw emails, so their recipients aren't reached
+		input.Destination = &sestypes.Destination{
+			ToAddresses: []string{SimulatorAddress},
+		}
+		dryRun = true
+	}
+
+	journaled := !dryRun && addJournal(input)
+	resp, err := client.SendEmail(ctx, input)
+	if err != nil && journaled && isJournalRejected(err) {
+		fmt.Printf("email with journal copy rejected, sending without it, %v\n", err)
+		removeJournal(input)
+		resp, err = client.SendEmail(ctx, input)
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return aws.ToString(resp.MessageId), dryRun, nil
+}
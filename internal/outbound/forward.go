@@ -0,0 +1,177 @@
+package outbound
+
+import (
+	"context"
+	"html"
+	"strings"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+)
+
+// Modes of forwarding an email
+const (
+	// ForwardModeInline quotes the forwarded email below the body of the draft, and attaches its attachments
+	ForwardModeInline = "inline"
+	// ForwardModeAttachment attaches the forwarded email as a message/rfc822 part, including its attachments
+	ForwardModeAttachment = "attachment"
+)
+
+const forwardedSeparator = "---------- Forwarded message ---------"
+
+// ForwardInput represents the input of Forward, where Text and HTML are written above the forwarded email
+type ForwardInput struct {
+	email.Input
+	Mode string `json:"mode"` // inline (default) or attachment
+	Send bool   `json:"send"` // send email immediately
+}
+
+// Forward creates a draft that forwards an email, with the subject prefixed by "Fwd: " unless input has one.
+// The files of the forwarded email are copied from S3 as uploads of the draft, so they're attached when it's sent.
+// Sent emails are only forwarded inline, with the uploads they were sent with.
+// api.ErrNotFound is returned if the email doesn't exist, and a *api.ScanError if its files are infected or their scan is pending.
+func Forward(ctx context.Context, client API, messageID string, input ForwardInput) (*CreateResult, error) {
+	if input.Mode == "" {
+		input.Mode = ForwardModeInline
+	}
+	if input.Mode != ForwardModeInline && input.Mode != ForwardModeAttachment {
+		return nil, api.ErrInvalidInput
+	}
+	if err := input.Validate(); err != nil {
+		return nil, api.ErrInvalidInput
+	}
+
+	original, err := email.Get(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if original.Type == email.EmailTypeDraft || (original.Type == email.EmailTypeSent && input.Mode == ForwardModeAttachment) {
+		return nil, api.ErrInvalidInput
+	}
+	if err := email.CheckScan(ctx, client, messageID); err != nil {
+		return nil, err
+	}
+
+	if input.Subject == "" {
+		input.Subject = forwardSubject(original.Subject)
+	}
+	if input.Text == "" && input.HTML != "" {
+		if input.Text, err = generateText(input.HTML); err != nil {
+			return nil, err
+		}
+	}
+
+	location, err := email.RawLocation(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case input.Mode == ForwardModeAttachment:
+		uploadID, err := storage.S3.CopyRawToUpload(ctx, client, location)
+		if err != nil {
+			return nil, err
+		}
+		input.Uploads = append(input.Uploads, email.UploadedFile{
+			UploadID:    uploadID,
+			Filename:    forwardFilename(original.Subject),
+			ContentType: "message/rfc822",
+		})
+	case original.Type == email.EmailTypeSent:
+		input.Uploads = append(input.Uploads, original.Uploads...)
+		input.Text, input.HTML = quoteForwarded(input.Text, input.HTML, original)
+	default:
+		uploads, err := storage.S3.CopyAttachmentsToUploads(ctx, client, location)
+		if err != nil {
+			return nil, err
+		}
+		for _, upload := range uploads {
+			input.Uploads = append(input.Uploads, email.UploadedFile{
+				UploadID:    upload.UploadID,
+				Filename:    upload.Filename,
+				ContentType: upload.ContentType,
+			})
+		}
+		input.Text, input.HTML = quoteForwarded(input.Text, input.HTML, original)
+	}
+
+	return Create(ctx, client, CreateInput{
+		Input:        input.Input,
+		GenerateText: "off", // the text is quoted along with the HTML
+		Send:         input.Send,
+	})
+}
+
+// forwardSubject returns the subject of a forwarded email
+func forwardSubject(subject string) string {
+	if strings.HasPrefix(strings.ToLower(subject), "fwd:") {
+		return subject
+	}
+	return "Fwd: " + subject
+}
+
+// forwardFilename returns the filename of an email attached in ForwardModeAttachment
+func forwardFilename(subject string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(subject))
+	if name == "" {
+		name = "forwarded"
+	}
+	return name + ".eml"
+}
+
+// quoteForwarded returns the text and HTML with the forwarded email quoted below them
+func quoteForwarded(text, htmlBody string, original *email.GetResult) (string, string) {
+	date := original.DateSent
+	if date == "" {
+		date = original.TimeReceived
+	}
+	if date == "" {
+		date = original.TimeSent
+	}
+	headers := [][2]string{
+		{"From", strings.Join(original.From, ", ")},
+		{"Date", date},
+		{"Subject", original.Subject},
+		{"To", strings.Join(original.To, ", ")},
+	}
+	if len(original.Cc) > 0 {
+		headers = append(headers, [2]string{"Cc", strings.Join(original.Cc, ", ")})
+	}
+
+	var textBuilder strings.Builder
+	if text != "" {
+		textBuilder.WriteString(text + "\n\n")
+	}
+	textBuilder.WriteString(forwardedSeparator + "\n")
+	for _, header := range headers {
+		textBuilder.WriteString(header[0] + ": " + header[1] + "\n")
+	}
+	textBuilder.WriteString("\n" + original.Text)
+
+	if htmlBody == "" && original.HTML == "" {
+		return textBuilder.String(), ""
+	}
+	var htmlBuilder strings.Builder
+	if htmlBody != "" {
+		htmlBuilder.WriteString(htmlBody)
+	} else if text != "" {
+		htmlBuilder.WriteString("<div>" + strings.ReplaceAll(html.EscapeString(text), "\n", "<br>") + "</div>")
+	}
+	htmlBuilder.WriteString("<br><div>" + forwardedSeparator + "<br>")
+	for _, header := range headers {
+		htmlBuilder.WriteString(header[0] + ": " + html.EscapeString(header[1]) + "<br>")
+	}
+	htmlBuilder.WriteString("</div><br>")
+	if original.HTML != "" {
+		htmlBuilder.WriteString(original.HTML)
+	} else {
+		htmlBuilder.WriteString("<pre>" + html.EscapeString(original.Text) + "</pre>")
+	}
+	return textBuilder.String(), htmlBuilder.String()
+}
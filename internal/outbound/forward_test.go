@@ -0,0 +1,153 @@
+package outbound
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+)
+
+const forwardedRaw = "From: sender@example.com\r\n" +
+	"To: me@example.com\r\n" +
+	"Subject: report\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=b\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"see attached\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/csv; name=report.csv\r\n" +
+	"Content-Disposition: attachment; filename=report.csv\r\n" +
+	"\r\n" +
+	"a,b\r\n" +
+	"--b--\r\n"
+
+// mockForwardAPI returns a client with an email of the type, whose raw message is forwardedRaw,
+// and records the objects and the draft written
+func mockForwardAPI(emailType string, objects map[string][]byte, draft *map[string]types.AttributeValue) clients.Fake {
+	return clients.Fake{
+		MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			item := map[string]types.AttributeValue{
+				"MessageID":     &types.AttributeValueMemberS{Value: "exampleMessageID"},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: emailType + "#2024-05"},
+				"DateTime":      &types.AttributeValueMemberS{Value: "01-12:00:00"},
+				"Subject":       &types.AttributeValueMemberS{Value: "report"},
+				"From":          &types.AttributeValueMemberSS{Value: []string{"sender@example.com"}},
+				"To":            &types.AttributeValueMemberSS{Value: []string{"me@example.com"}},
+				"Text":          &types.AttributeValueMemberS{Value: "see attached"},
+			}
+			if emailType == email.EmailTypeSent {
+				item["Uploads"] = &types.AttributeValueMemberL{Value: []types.AttributeValue{
+					&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+						"UploadID":    &types.AttributeValueMemberS{Value: "0123456789abcdef0123456789abcdef"},
+						"Filename":    &types.AttributeValueMemberS{Value: "sent.pdf"},
+						"ContentType": &types.AttributeValueMemberS{Value: "application/pdf"},
+					}},
+				}}
+			}
+			return &dynamodb.GetItemOutput{Item: item}, nil
+		},
+		MockGetObject: func(_ context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(forwardedRaw))}, nil
+		},
+		MockPutObject: func(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			body, _ := io.ReadAll(params.Body)
+			objects[*params.Key] = body
+			return &s3.PutObjectOutput{}, nil
+		},
+		MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			*draft = params.Item
+			return &dynamodb.PutItemOutput{}, nil
+		},
+	}
+}
+
+func TestForward(t *testing.T) {
+	objects := make(map[string][]byte)
+	var draft map[string]types.AttributeValue
+	client := mockForwardAPI(email.EmailTypeInbox, objects, &draft)
+
+	result, err := Forward(context.TODO(), client, "exampleMessageID", ForwardInput{
+		Input: email.Input{
+			From: []string{"me@example.com"},
+			To:   []string{"colleague@example.com"},
+			Text: "FYI",
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "Fwd: report", result.Subject)
+	assert.Equal(t, "FYI\n\n---------- Forwarded message ---------\n"+
+		"From: sender@example.com\nDate: 2024-05-01T12:00:00Z\nSubject: report\nTo: me@example.com\n\nsee attached", result.Text)
+	assert.Equal(t, "", result.HTML)
+	if assert.Len(t, result.Uploads, 1) {
+		assert.Equal(t, "report.csv", result.Uploads[0].Filename)
+		assert.Equal(t, "text/csv", result.Uploads[0].ContentType)
+		assert.Equal(t, "a,b", strings.TrimSpace(string(objects["uploads/"+result.Uploads[0].UploadID])))
+	}
+	assert.Contains(t, draft, "Uploads")
+
+	// attached as a message/rfc822 part
+	result, err = Forward(context.TODO(), client, "exampleMessageID", ForwardInput{
+		Input: email.Input{Subject: "see this", To: []string{"colleague@example.com"}, HTML: "<p>FYI</p>"},
+		Mode:  ForwardModeAttachment,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "see this", result.Subject)
+	assert.Equal(t, "<p>FYI</p>", result.HTML)
+	if assert.Len(t, result.Uploads, 1) {
+		assert.Equal(t, email.UploadedFile{UploadID: result.Uploads[0].UploadID, Filename: "report.eml", ContentType: "message/rfc822"}, result.Uploads[0])
+		assert.True(t, bytes.Equal([]byte(forwardedRaw), objects["uploads/"+result.Uploads[0].UploadID]))
+	}
+}
+
+func TestForward_Sent(t *testing.T) {
+	objects := make(map[string][]byte)
+	var draft map[string]types.AttributeValue
+	client := mockForwardAPI(email.EmailTypeSent, objects, &draft)
+
+	result, err := Forward(context.TODO(), client, "exampleMessageID", ForwardInput{
+		Input: email.Input{To: []string{"colleague@example.com"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []email.UploadedFile{{UploadID: "0123456789abcdef0123456789abcdef", Filename: "sent.pdf", ContentType: "application/pdf"}}, result.Uploads)
+	assert.Empty(t, objects)
+
+	// sent emails have no raw message to attach
+	_, err = Forward(context.TODO(), client, "exampleMessageID", ForwardInput{Mode: ForwardModeAttachment})
+	assert.Equal(t, api.ErrInvalidInput, err)
+}
+
+func TestForward_InvalidInput(t *testing.T) {
+	var draft map[string]types.AttributeValue
+	client := mockForwardAPI(email.EmailTypeDraft, make(map[string][]byte), &draft)
+
+	_, err := Forward(context.TODO(), client, "exampleMessageID", ForwardInput{})
+	assert.Equal(t, api.ErrInvalidInput, err)
+	_, err = Forward(context.TODO(), client, "exampleMessageID", ForwardInput{Mode: "quoted"})
+	assert.Equal(t, api.ErrInvalidInput, err)
+	_, err = Forward(context.TODO(), client, "exampleMessageID", ForwardInput{Input: email.Input{To: []string{"invalid"}}})
+	assert.Equal(t, api.ErrInvalidInput, err)
+	assert.Nil(t, draft)
+}
+
+func TestForwardSubjectAndFilename(t *testing.T) {
+	assert.Equal(t, "Fwd: report", forwardSubject("report"))
+	assert.Equal(t, "FWD: report", forwardSubject("FWD: report"))
+	assert.Equal(t, "Fwd: ", forwardSubject(""))
+
+	assert.Equal(t, "report.eml", forwardFilename("report"))
+	assert.Equal(t, "Q1_Q2 _draft_.eml", forwardFilename(" Q1/Q2 <draft> "))
+	assert.Equal(t, "forwarded.eml", forwardFilename(""))
+}
@@ -0,0 +1,52 @@
+package outbound
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/addr"
+)
+
+// journalAddress returns JOURNAL_ADDRESS in the format accepted by SES, or empty if journaling is disabled
+func journalAddress() string {
+	if env.JournalAddress == "" {
+		return ""
+	}
+	address, err := addr.ToASCII(env.JournalAddress)
+	if err != nil {
+		fmt.Printf("invalid journal address, journaling is disabled, %v\n", err)
+		return ""
+	}
+	return address
+}
+
+// addJournal adds JOURNAL_ADDRESS to the Bcc recipients of a send, which is also the envelope of raw emails.
+// It returns false if journaling is disabled.
+func addJournal(input *sesv2.SendEmailInput) bool {
+	address := journalAddress()
+	if address == "" {
+		return false
+	}
+	if input.Destination == nil {
+		input.Destination = &sestypes.Destination{}
+	}
+	input.Destination.BccAddresses = append(input.Destination.BccAddresses, address)
+	return true
+}
+
+// removeJournal removes the journal address added by addJournal
+func removeJournal(input *sesv2.SendEmailInput) {
+	bcc := input.Destination.BccAddresses
+	input.Destination.BccAddresses = bcc[:len(bcc)-1]
+}
+
+// isJournalRejected returns true if a send may have been rejected because of the journal address,
+// e.g. when it isn't verified in the SES sandbox, so that it's sent again without the journal copy
+func isJournalRejected(err error) bool {
+	var rejected *sestypes.MessageRejected
+	var badRequest *sestypes.BadRequestException
+	return errors.As(err, &rejected) || errors.As(err, &badRequest)
+}
@@ -0,0 +1,89 @@
+package outbound
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliver_Journal(t *testing.T) {
+	defer func() { env.JournalAddress, env.DryRun = "", "" }()
+
+	tests := []struct {
+		journalAddress string
+		dryRun         bool
+		errs           []error // returned by each call of SendEmail
+		expectedBcc    [][]string
+		expectedErr    error
+	}{
+		{ // journaling is disabled
+			expectedBcc: [][]string{{"bcc@example.com"}},
+		},
+		{
+			journalAddress: "journal@example.com",
+			expectedBcc:    [][]string{{"bcc@example.com", "journal@example.com"}},
+		},
+		{ // internationalized domains are converted to punycode
+			journalAddress: "journal@例え.jp",
+			expectedBcc:    [][]string{{"bcc@example.com", "journal@xn--r8jz45g.jp"}},
+		},
+		{ // dry runs aren't journaled
+			journalAddress: "journal@example.com",
+			dryRun:         true,
+			expectedBcc:    [][]string{nil},
+		},
+		{ // rejected with the journal copy, sent without it
+			journalAddress: "journal@example.com",
+			errs:           []error{&sestypes.MessageRejected{}},
+			expectedBcc:    [][]string{{"bcc@example.com", "journal@example.com"}, {"bcc@example.com"}},
+		},
+		{ // other failures aren't retried
+			journalAddress: "journal@example.com",
+			errs:           []error{&sestypes.TooManyRequestsException{}},
+			expectedBcc:    [][]string{{"bcc@example.com", "journal@example.com"}},
+			expectedErr:    &sestypes.TooManyRequestsException{},
+		},
+		{ // rejected without the journal copy too
+			journalAddress: "journal@example.com",
+			errs:           []error{&sestypes.MessageRejected{}, &sestypes.MessageRejected{}},
+			expectedBcc:    [][]string{{"bcc@example.com", "journal@example.com"}, {"bcc@example.com"}},
+			expectedErr:    &sestypes.MessageRejected{},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.JournalAddress = test.journalAddress
+			var bcc [][]string
+			client := clients.Fake{
+				MockSendEmail: func(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					bcc = append(bcc, append([]string(nil), params.Destination.BccAddresses...))
+					if len(bcc) <= len(test.errs) {
+						return nil, test.errs[len(bcc)-1]
+					}
+					return &sesv2.SendEmailOutput{MessageId: aws.String("newID")}, nil
+				},
+			}
+			input := &sesv2.SendEmailInput{
+				Destination: &sestypes.Destination{
+					ToAddresses:  []string{"user@example.com"},
+					BccAddresses: []string{"bcc@example.com"},
+				},
+			}
+
+			messageID, _, err := deliver(context.TODO(), client, input, test.dryRun)
+			assert.Equal(t, test.expectedErr, err)
+			if err == nil {
+				assert.Equal(t, "newID", messageID)
+			}
+			assert.Equal(t, test.expectedBcc, bcc)
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package outbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/queue"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+const (
+	// DefaultSendMaxAttempts is the number of attempts of a send before it's marked failed, unless SEND_MAX_ATTEMPTS is set
+	DefaultSendMaxAttempts = 5
+
+	retryBaseDelay = 60  // seconds before the first retry, doubled for each retry
+	retryMaxDelay  = 900 // maximum delay of SQS messages
+)
+
+// RetryMessage is the body of messages in SEND_RETRY_QUEUE
+type RetryMessage struct {
+	MessageID string `json:"messageID"` // ID of the draft
+}
+
+// retryEnabled returns true if transient failures are retried
+func retryEnabled() bool {
+	return env.SendRetryQueue != ""
+}
+
+// sendMaxAttempts returns the number of attempts of a send before it's marked failed
+func sendMaxAttempts() int {
+	if n, err := strconv.Atoi(env.SendMaxAttempts); err == nil && n > 0 {
+		return n
+	}
+	return DefaultSendMaxAttempts
+}
+
+// retryDelay returns the seconds before retrying a send that failed the given number of times
+func retryDelay(failures int) int32 {
+	delay := retryBaseDelay
+	for i := 1; i < failures && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return int32(delay)
+}
+
+// isTransient returns true if a send failed with an error that may not happen again, e.g. throttling by SES
+func isTransient(err error) bool {
+	var tooManyRequests *sestypes.TooManyRequestsException
+	var limitExceeded *sestypes.LimitExceededException
+	if errors.As(err, &tooManyRequests) || errors.As(err, &limitExceeded) {
+		return true
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorFault() == smithy.FaultServer
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// handleSendFailure records a failed attempt to send a draft, and queues it to be retried if the failure is transient.
+// If the send isn't retried, the draft is marked failed, and the error wraps api.ErrSendFailed.
+func handleSendFailure(ctx context.Context, client SendAPI, draft *email.GetResult, sendErr error) (*SendResult, error) {
+	// a draft that isn't retrying is sent again from its first attempt, e.g. a failed draft sent manually
+	failures := 1
+	if n := len(draft.SendAttempts); draft.SendState == email.SendStateRetrying && n > 0 {
+		failures = draft.SendAttempts[n-1].Attempt + 1
+	}
+	attempt := email.SendAttempt{
+		Attempt: failures,
+		Time:    format.RFC3399(getUpdatedTime()),
+		Error:   sendErr.Error(),
+	}
+	state := email.SendStateRetrying
+	if !isTransient(sendErr) || failures >= sendMaxAttempts() {
+		state = email.SendStateFailed
+	}
+
+	err := recordSendAttempt(ctx, client, draft.MessageID, attempt, state)
+	if err != nil {
+		return nil, err
+	}
+	if state == email.SendStateFailed {
+		fmt.Printf("send of %s failed after %d attempts\n", draft.MessageID, failures)
+		return nil, fmt.Errorf("%w: %v", api.ErrSendFailed, sendErr)
+	}
+
+	err = queueRetry(ctx, client, draft.MessageID, retryDelay(failures))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("send of %s failed transiently, retrying in %d seconds\n", draft.MessageID, retryDelay(failures))
+	return &SendResult{
+		MessageID: draft.MessageID,
+		Retrying:  true,
+	}, nil
+}
+
+// recordSendAttempt appends a failed attempt to the draft, and sets its send state
+func recordSendAttempt(ctx context.Context, client api.UpdateItemAPI, messageID string, attempt email.SendAttempt, state string) error {
+	attemptValue, err := attributevalue.Marshal(attempt)
+	if err != nil {
+		return err
+	}
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]dynamodbTypes.AttributeValue{
+			"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression: aws.String("SET SendState = :state, SendAttempts = list_append(if_not_exists(SendAttempts, :empty), :attempt)"),
+		// the draft may be sent or deleted meanwhile
+		ConditionExpression: aws.String("begins_with(TypeYearMonth, :v_draft)"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":state":   &dynamodbTypes.AttributeValueMemberS{Value: state},
+			":empty":   &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{}},
+			":attempt": &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{attemptValue}},
+			":v_draft": &dynamodbTypes.AttributeValueMemberS{Value: email.EmailTypeDraft + "#"},
+		},
+	})
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return api.ErrNotFound
+		}
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
+
+// queueRetry sends a message to SEND_RETRY_QUEUE to retry sending the draft after the delay
+func queueRetry(ctx context.Context, client queue.SendMessageAPI, messageID string, delay int32) error {
+	result, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName: aws.String(env.SendRetryQueue),
+	})
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(RetryMessage{MessageID: messageID})
+	if err != nil {
+		return err
+	}
+	_, err = client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:     result.QueueUrl,
+		MessageBody:  aws.String(string(body)),
+		DelaySeconds: delay,
+	})
+	return err
+}
+
+// RetryFailedSend sends a failed draft again, starting from its first attempt.
+// Retrying drafts are already retried, so an InvalidTransitionError is returned for them, as for drafts that aren't failed.
+func RetryFailedSend(ctx context.Context, client SendAPI, messageID string) (*SendResult, error) {
+	draft, err := email.Get(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Type != email.EmailTypeDraft {
+		return nil, &api.InvalidTransitionError{From: draft.Type, To: email.StateSent}
+	}
+	if draft.SendState != email.SendStateFailed {
+		from := draft.SendState
+		if from == "" {
+			from = email.EmailTypeDraft
+		}
+		return nil, &api.InvalidTransitionError{From: from, To: email.StateSent}
+	}
+
+	result, err := sendDraft(ctx, client, draft)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("retry method finished successfully")
+	return result, nil
+}
+
+// RetrySend retries sending a draft queued by a transient failure.
+// Drafts that are sent, deleted, or no longer retrying meanwhile are skipped.
+// Failures of the send itself are recorded on the draft, and only other errors are returned.
+func RetrySend(ctx context.Context, client SendAPI, messageID string) (*SendResult, error) {
+	draft, err := email.Get(ctx, client, messageID)
+	if err != nil {
+		if errors.Is(err, api.ErrNotFound) {
+			fmt.Printf("draft %s not found, skipping retry\n", messageID)
+			return nil, nil
+		}
+		return nil, err
+	}
+	if draft.Type != email.EmailTypeDraft || draft.SendState != email.SendStateRetrying {
+		fmt.Printf("email %s is not retrying, skipping retry\n", messageID)
+		return nil, nil
+	}
+
+	result, err := sendDraft(ctx, client, draft)
+	if errors.Is(err, api.ErrSendFailed) || errors.Is(err, api.ErrNotFound) || errors.Is(err, &api.InvalidTransitionError{}) {
+		fmt.Printf("retry of %s failed: %v\n", messageID, err)
+		return nil, nil
+	}
+	return result, err
+}
@@ -0,0 +1,314 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockGetQueueURL returns the URL of a queue by its name
+func mockGetQueueURL(_ context.Context, params *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.example.com/" + *params.QueueName)}, nil
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		expected int32
+	}{
+		{1, 60},
+		{2, 120},
+		{3, 240},
+		{4, 480},
+		{5, 900},
+		{10, 900},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, retryDelay(test.failures))
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{&sestypes.TooManyRequestsException{}, true},
+		{&sestypes.LimitExceededException{}, true},
+		{&smithy.GenericAPIError{Code: "InternalFailure", Fault: smithy.FaultServer}, true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{&sestypes.MessageRejected{}, false},
+		{&sestypes.AccountSuspendedException{}, false},
+		{errors.New("error"), false},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, isTransient(test.err))
+		})
+	}
+}
+
+func TestSendMaxAttempts(t *testing.T) {
+	defer func() { env.SendMaxAttempts = "" }()
+
+	tests := []struct {
+		env      string
+		expected int
+	}{
+		{"", DefaultSendMaxAttempts},
+		{"3", 3},
+		{"0", DefaultSendMaxAttempts},
+		{"x", DefaultSendMaxAttempts},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.SendMaxAttempts = test.env
+			assert.Equal(t, test.expected, sendMaxAttempts())
+		})
+	}
+}
+
+func TestHandleSendFailure(t *testing.T) {
+	env.SendRetryQueue = "retry"
+	defer func() { env.SendRetryQueue = "" }()
+
+	tests := []struct {
+		draft         *email.GetResult
+		err           error
+		expectedState string
+		expectedDelay int32
+		expectedErr   error
+	}{
+		{ // first transient failure
+			draft:         &email.GetResult{MessageID: "draft-id"},
+			err:           &sestypes.TooManyRequestsException{},
+			expectedState: email.SendStateRetrying,
+			expectedDelay: 60,
+		},
+		{ // third transient failure
+			draft: &email.GetResult{MessageID: "draft-id", SendState: email.SendStateRetrying, SendAttempts: []email.SendAttempt{
+				{Attempt: 1}, {Attempt: 2},
+			}},
+			err:           &sestypes.TooManyRequestsException{},
+			expectedState: email.SendStateRetrying,
+			expectedDelay: 240,
+		},
+		{ // last attempt
+			draft: &email.GetResult{MessageID: "draft-id", SendState: email.SendStateRetrying, SendAttempts: []email.SendAttempt{
+				{Attempt: 1}, {Attempt: 2}, {Attempt: 3}, {Attempt: 4},
+			}},
+			err:           &sestypes.TooManyRequestsException{},
+			expectedState: email.SendStateFailed,
+			expectedErr:   api.ErrSendFailed,
+		},
+		{ // a failed draft sent again starts from its first attempt
+			draft: &email.GetResult{MessageID: "draft-id", SendState: email.SendStateFailed, SendAttempts: []email.SendAttempt{
+				{Attempt: 1}, {Attempt: 2}, {Attempt: 3}, {Attempt: 4}, {Attempt: 5},
+			}},
+			err:           &sestypes.TooManyRequestsException{},
+			expectedState: email.SendStateRetrying,
+			expectedDelay: 60,
+		},
+		{ // permanent failure
+			draft:         &email.GetResult{MessageID: "draft-id"},
+			err:           &sestypes.MessageRejected{},
+			expectedState: email.SendStateFailed,
+			expectedErr:   api.ErrSendFailed,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var state string
+			var delay int32
+			client := clients.Fake{
+				MockUpdateItem: func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					state = params.ExpressionAttributeValues[":state"].(*dynamodbTypes.AttributeValueMemberS).Value
+					return &dynamodb.UpdateItemOutput{}, nil
+				},
+				MockGetQueueUrl: mockGetQueueURL,
+				MockSendMessage: func(_ context.Context, params *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+					assert.Equal(t, "https://sqs.example.com/retry", *params.QueueUrl)
+					assert.JSONEq(t, `{"messageID":"draft-id"}`, *params.MessageBody)
+					delay = params.DelaySeconds
+					return &sqs.SendMessageOutput{}, nil
+				},
+			}
+
+			result, err := handleSendFailure(context.TODO(), client, test.draft, test.err)
+			assert.Equal(t, test.expectedState, state)
+			assert.Equal(t, test.expectedDelay, delay)
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				assert.Nil(t, result)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, &SendResult{MessageID: "draft-id", Retrying: true}, result)
+		})
+	}
+}
+
+func TestRetrySend(t *testing.T) {
+	env.SendRetryQueue = "retry"
+	defer func() { env.SendRetryQueue = "" }()
+
+	draft := func(state string) map[string]dynamodbTypes.AttributeValue {
+		item := map[string]dynamodbTypes.AttributeValue{
+			"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "draft-id"},
+			"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: "draft#2022-03"},
+			"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: "12-01:01:01"},
+			"Subject":       &dynamodbTypes.AttributeValueMemberS{Value: "subject"},
+			"From":          &dynamodbTypes.AttributeValueMemberSS{Value: []string{"example@example.com"}},
+			"To":            &dynamodbTypes.AttributeValueMemberSS{Value: []string{"example@example.com"}},
+			"Text":          &dynamodbTypes.AttributeValueMemberS{Value: "text"},
+		}
+		if state != "" {
+			item["SendState"] = &dynamodbTypes.AttributeValueMemberS{Value: state}
+		}
+		return item
+	}
+
+	tests := []struct {
+		item     map[string]dynamodbTypes.AttributeValue
+		sendErr  error
+		sent     bool
+		expected *SendResult
+	}{
+		{ // sent
+			item:     draft(email.SendStateRetrying),
+			sent:     true,
+			expected: &SendResult{MessageID: "newID"},
+		},
+		{ // failed again
+			item:     draft(email.SendStateRetrying),
+			sendErr:  &sestypes.TooManyRequestsException{},
+			sent:     true,
+			expected: &SendResult{MessageID: "draft-id", Retrying: true},
+		},
+		{ // failed permanently, which is recorded and not returned
+			item:    draft(email.SendStateRetrying),
+			sendErr: &sestypes.MessageRejected{},
+			sent:    true,
+		},
+		{ // saved meanwhile
+			item: draft(""),
+		},
+		{ // deleted meanwhile
+			item: nil,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			sent := false
+			client := clients.Fake{
+				MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					return &dynamodb.GetItemOutput{Item: test.item}, nil
+				},
+				MockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					sent = true
+					if test.sendErr != nil {
+						return nil, test.sendErr
+					}
+					return &sesv2.SendEmailOutput{MessageId: aws.String("newID")}, nil
+				},
+				MockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					return &dynamodb.TransactWriteItemsOutput{}, nil
+				},
+				MockUpdateItem: func(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					return &dynamodb.UpdateItemOutput{}, nil
+				},
+				MockGetQueueUrl: mockGetQueueURL,
+				MockSendMessage: func(_ context.Context, _ *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+					return &sqs.SendMessageOutput{}, nil
+				},
+			}
+
+			result, err := RetrySend(context.TODO(), client, "draft-id")
+			assert.Nil(t, err)
+			assert.Equal(t, test.sent, sent)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestRetryFailedSend(t *testing.T) {
+	draft := func(typeYearMonth, state string) map[string]dynamodbTypes.AttributeValue {
+		item := map[string]dynamodbTypes.AttributeValue{
+			"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "draft-id"},
+			"TypeYearMonth": &dynamodbTypes.AttributeValueMemberS{Value: typeYearMonth},
+			"DateTime":      &dynamodbTypes.AttributeValueMemberS{Value: "12-01:01:01"},
+			"From":          &dynamodbTypes.AttributeValueMemberSS{Value: []string{"example@example.com"}},
+			"To":            &dynamodbTypes.AttributeValueMemberSS{Value: []string{"example@example.com"}},
+		}
+		if state != "" {
+			item["SendState"] = &dynamodbTypes.AttributeValueMemberS{Value: state}
+		}
+		return item
+	}
+
+	tests := []struct {
+		item        map[string]dynamodbTypes.AttributeValue
+		expected    *SendResult
+		expectedErr error
+	}{
+		{
+			item:     draft("draft#2022-03", email.SendStateFailed),
+			expected: &SendResult{MessageID: "newID"},
+		},
+		{
+			item:        draft("draft#2022-03", email.SendStateRetrying),
+			expectedErr: &api.InvalidTransitionError{From: email.SendStateRetrying, To: email.StateSent},
+		},
+		{
+			item:        draft("draft#2022-03", ""),
+			expectedErr: &api.InvalidTransitionError{From: email.EmailTypeDraft, To: email.StateSent},
+		},
+		{
+			item:        draft("sent#2022-03", ""),
+			expectedErr: &api.InvalidTransitionError{From: email.EmailTypeSent, To: email.StateSent},
+		},
+		{
+			item:        nil,
+			expectedErr: api.ErrNotFound,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := clients.Fake{
+				MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					return &dynamodb.GetItemOutput{Item: test.item}, nil
+				},
+				MockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					return &sesv2.SendEmailOutput{MessageId: aws.String("newID")}, nil
+				},
+				MockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					return &dynamodb.TransactWriteItemsOutput{}, nil
+				},
+			}
+
+			result, err := RetryFailedSend(context.TODO(), client, "draft-id")
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
@@ -1,4 +1,4 @@
-package email
+package outbound
 
 import (
 	"context"
@@ -11,29 +11,33 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/util/format"
 )
 
 // SaveInput represents the input of save method
 type SaveInput struct {
-	Input
+	email.Input
 	GenerateText string `json:"generateText"` // on, off, or auto (default)
 	Send         bool   `json:"send"`         // send email immediately
 }
 
 // SaveResult represents the result of save method
 type SaveResult struct {
-	TimeIndex
-	Subject  string   `json:"subject"`
-	From     []string `json:"from"`
-	To       []string `json:"to"`
-	Cc       []string `json:"cc"`
-	Bcc      []string `json:"bcc"`
-	ReplyTo  []string `json:"replyTo"`
-	Text     string   `json:"text"`
-	HTML     string   `json:"html"`
-	ThreadID string   `json:"threadID,omitempty"`
+	email.TimeIndex
+	Subject  string               `json:"subject"`
+	From     []string             `json:"from"`
+	To       []string             `json:"to"`
+	Cc       []string             `json:"cc"`
+	Bcc      []string             `json:"bcc"`
+	ReplyTo  []string             `json:"replyTo"`
+	Text     string               `json:"text"`
+	HTML     string               `json:"html"`
+	ThreadID string               `json:"threadID,omitempty"`
+	NoReply  bool                 `json:"noReply,omitempty"`
+	DryRun   bool                 `json:"dryRun,omitempty"`
+	Uploads  []email.UploadedFile `json:"uploads,omitempty"`
 }
 
 var getUpdatedTime = func() time.Time {
@@ -45,18 +49,22 @@ var getUpdatedTime = func() time.Time {
 // TODO: refactor this function
 //
 //gocyclo:ignore
-func Save(ctx context.Context, client api.SaveAndSendEmailAPI, input SaveInput) (*SaveResult, error) {
+func Save(ctx context.Context, client API, input SaveInput) (*SaveResult, error) {
 	fmt.Println("save method started")
 	if !strings.HasPrefix(input.MessageID, "draft-") {
 		return nil, api.ErrEmailIsNotDraft
 	}
+	if err := input.Validate(); err != nil {
+		return nil, api.ErrInvalidInput
+	}
+	input.ApplyNoReply()
 
 	now := getUpdatedTime()
-	typeYearMonth, err := format.TypeYearMonth(EmailTypeDraft, now)
+	typeYearMonth, err := format.TypeYearMonth(email.EmailTypeDraft, now)
 	if err != nil {
 		return nil, err
 	}
-	dateTime := format.DateTime(now)
+	dateTime := format.DateTime(now, input.MessageID)
 
 	if (input.GenerateText == "on") || (input.GenerateText == "auto" && input.Text == "") {
 		input.Text, err = generateText(input.HTML)
@@ -111,10 +119,10 @@ func Save(ctx context.Context, client api.SaveAndSendEmailAPI, input SaveInput)
 		return nil, err
 	}
 
-	emailType := EmailTypeDraft
+	emailType := email.EmailTypeDraft
 	messageID := input.MessageID
 	if input.Send {
-		email := &Input{
+		msg := &email.Input{
 			MessageID:  messageID,
 			Subject:    input.Subject,
 			From:       input.From,
@@ -122,28 +130,32 @@ func Save(ctx context.Context, client api.SaveAndSendEmailAPI, input SaveInput)
 			Cc:         input.Cc,
 			Bcc:        input.Bcc,
 			ReplyTo:    input.ReplyTo,
+			NoReply:    input.NoReply,
+			DryRun:     input.DryRun,
 			Text:       input.Text,
 			HTML:       input.HTML,
+			Uploads:    input.Uploads,
 			ThreadID:   extraFields["ThreadID"],
 			InReplyTo:  extraFields["InReplyTo"],
 			References: extraFields["References"],
 		}
 
 		var newMessageID string
-		if newMessageID, err = sendEmailViaSES(ctx, client, email); err != nil {
+		if newMessageID, err = sendEmailViaSES(ctx, client, msg); err != nil {
 			return nil, err
 		}
-		email.MessageID = newMessageID
+		msg.MessageID = newMessageID
+		input.DryRun = msg.DryRun
 
-		if err = markEmailAsSent(ctx, client, messageID, email); err != nil {
+		if err = markEmailAsSent(ctx, client, messageID, msg); err != nil {
 			return nil, err
 		}
 		messageID = newMessageID
-		emailType = EmailTypeSent
+		emailType = email.EmailTypeSent
 	}
 
 	result := &SaveResult{
-		TimeIndex: TimeIndex{
+		TimeIndex: email.TimeIndex{
 			MessageID:   messageID,
 			Type:        emailType,
 			TimeUpdated: now.Format(time.RFC3339),
@@ -156,6 +168,9 @@ func Save(ctx context.Context, client api.SaveAndSendEmailAPI, input SaveInput)
 		ReplyTo:  input.ReplyTo,
 		Text:     input.Text,
 		HTML:     input.HTML,
+		NoReply:  input.NoReply,
+		DryRun:   input.DryRun,
+		Uploads:  input.Uploads,
 		ThreadID: extraFields["ThreadID"],
 	}
 
@@ -1,4 +1,4 @@
-package email
+package outbound
 
 import (
 	"context"
@@ -12,9 +12,10 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/harryzcy/mailbox/internal/util/htmlutil"
-	"github.com/harryzcy/mailbox/internal/util/mockutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,29 +24,6 @@ var (
 	errBatchWrite = errors.New("test batch write error")
 )
 
-type mockSaveEmailAPI struct {
-	mockGetItem           mockGetItemAPI
-	mockPutItem           func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
-	mockTransactWriteItem mockutil.MockTransactWriteItemAPI
-	mockSendEmail         func(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
-}
-
-func (m mockSaveEmailAPI) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
-	return m.mockGetItem(ctx, params, optFns...)
-}
-
-func (m mockSaveEmailAPI) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
-	return m.mockPutItem(ctx, params, optFns...)
-}
-
-func (m mockSaveEmailAPI) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
-	return m.mockTransactWriteItem(ctx, params, optFns...)
-}
-
-func (m mockSaveEmailAPI) SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
-	return m.mockSendEmail(ctx, params, optFns...)
-}
-
 func TestTetUpdatedTime(t *testing.T) {
 	assert.NotNil(t, getUpdatedTime())
 }
@@ -57,22 +35,22 @@ func TestSave(t *testing.T) {
 
 	env.TableName = "table-for-save"
 	tests := []struct {
-		client       func(t *testing.T) api.SaveAndSendEmailAPI
+		client       func(t *testing.T) API
 		input        SaveInput
 		generateText func(html string) (string, error)
 		expected     *SaveResult
 		expectedErr  error
 	}{
 		{ // without Send
-			client: func(t *testing.T) api.SaveAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockSaveEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]types.AttributeValue{},
 						}, nil
 					},
-					mockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+					MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						assert.Equal(t, env.TableName, *params.TableName)
 
 						messageID := params.Item["MessageID"].(*types.AttributeValueMemberS).Value
@@ -89,7 +67,7 @@ func TestSave(t *testing.T) {
 				}
 			},
 			input: SaveInput{
-				Input: Input{
+				Input: email.Input{
 					MessageID: "draft-example",
 					Subject:   "subject",
 					From:      []string{"example@example.com"},
@@ -103,9 +81,9 @@ func TestSave(t *testing.T) {
 				GenerateText: "off",
 			},
 			expected: &SaveResult{
-				TimeIndex: TimeIndex{
+				TimeIndex: email.TimeIndex{
 					MessageID:   "draft-example",
-					Type:        EmailTypeDraft,
+					Type:        email.EmailTypeDraft,
 					TimeUpdated: "2022-03-16T16:55:45Z",
 				},
 				Subject: "subject",
@@ -119,21 +97,21 @@ func TestSave(t *testing.T) {
 			},
 		},
 		{ // without Send
-			client: func(t *testing.T) api.SaveAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockSaveEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]types.AttributeValue{},
 						}, nil
 					},
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
 				}
 			},
 			input: SaveInput{
-				Input: Input{
+				Input: email.Input{
 					MessageID: "draft-example",
 					Subject:   "subject",
 					From:      []string{"example@example.com"},
@@ -147,9 +125,9 @@ func TestSave(t *testing.T) {
 				GenerateText: "on",
 			},
 			expected: &SaveResult{
-				TimeIndex: TimeIndex{
+				TimeIndex: email.TimeIndex{
 					MessageID:   "draft-example",
-					Type:        EmailTypeDraft,
+					Type:        email.EmailTypeDraft,
 					TimeUpdated: "2022-03-16T16:55:45Z",
 				},
 				Subject: "subject",
@@ -163,21 +141,21 @@ func TestSave(t *testing.T) {
 			},
 		},
 		{ // without Send
-			client: func(t *testing.T) api.SaveAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockSaveEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]types.AttributeValue{},
 						}, nil
 					},
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
 				}
 			},
 			input: SaveInput{
-				Input: Input{
+				Input: email.Input{
 					MessageID: "draft-example",
 					Subject:   "subject",
 					From:      []string{"example@example.com"},
@@ -190,9 +168,9 @@ func TestSave(t *testing.T) {
 				GenerateText: "auto",
 			},
 			expected: &SaveResult{
-				TimeIndex: TimeIndex{
+				TimeIndex: email.TimeIndex{
 					MessageID:   "draft-example",
-					Type:        EmailTypeDraft,
+					Type:        email.EmailTypeDraft,
 					TimeUpdated: "2022-03-16T16:55:45Z",
 				},
 				Subject: "subject",
@@ -206,23 +184,23 @@ func TestSave(t *testing.T) {
 			},
 		},
 		{ // with Send
-			client: func(t *testing.T) api.SaveAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockSaveEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]types.AttributeValue{},
 						}, nil
 					},
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
-					mockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					MockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
 						return &sesv2.SendEmailOutput{
 							MessageId: aws.String("sent-message-id"),
 						}, nil
 					},
-					mockTransactWriteItem: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					MockTransactWriteItems: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
 						assert.Len(t, params.TransactItems, 2)
 
 						for _, item := range params.TransactItems {
@@ -243,7 +221,7 @@ func TestSave(t *testing.T) {
 				}
 			},
 			input: SaveInput{
-				Input: Input{
+				Input: email.Input{
 					MessageID: "draft-example",
 					Subject:   "subject",
 					From:      []string{"example@example.com"},
@@ -257,9 +235,9 @@ func TestSave(t *testing.T) {
 				Send:         true,
 			},
 			expected: &SaveResult{
-				TimeIndex: TimeIndex{
+				TimeIndex: email.TimeIndex{
 					MessageID:   "sent-message-id",
-					Type:        EmailTypeSent,
+					Type:        email.EmailTypeSent,
 					TimeUpdated: "2022-03-16T16:55:45Z",
 				},
 				Subject: "subject",
@@ -273,21 +251,21 @@ func TestSave(t *testing.T) {
 			},
 		},
 		{ // without Send
-			client: func(t *testing.T) api.SaveAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockSaveEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]types.AttributeValue{},
 						}, nil
 					},
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
 				}
 			},
 			input: SaveInput{
-				Input: Input{
+				Input: email.Input{
 					MessageID: "draft-example",
 				},
 				GenerateText: "on",
@@ -298,36 +276,36 @@ func TestSave(t *testing.T) {
 			expectedErr: api.ErrInvalidInput,
 		},
 		{ // without Send
-			client: func(t *testing.T) api.SaveAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockSaveEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]types.AttributeValue{},
 						}, nil
 					},
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, api.ErrInvalidInput
 					},
 				}
 			},
 			input: SaveInput{
-				Input: Input{
+				Input: email.Input{
 					MessageID: "draft-example",
 				},
 			},
 			expectedErr: api.ErrInvalidInput,
 		},
 		{ // without Send
-			client: func(t *testing.T) api.SaveAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockSaveEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]types.AttributeValue{},
 						}, nil
 					},
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						t.Helper()
 						t.Error("this mock shouldn't be reached")
 						return &dynamodb.PutItemOutput{}, nil
@@ -337,45 +315,45 @@ func TestSave(t *testing.T) {
 			expectedErr: api.ErrEmailIsNotDraft,
 		},
 		{ // without Send
-			client: func(t *testing.T) api.SaveAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockSaveEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]types.AttributeValue{},
 						}, nil
 					},
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, &types.ConditionalCheckFailedException{}
 					},
 				}
 			},
 			input: SaveInput{
-				Input: Input{
+				Input: email.Input{
 					MessageID: "draft-example",
 				},
 			},
 			expectedErr: api.ErrNotFound,
 		},
 		{ // with Send
-			client: func(t *testing.T) api.SaveAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockCreateEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]types.AttributeValue{},
 						}, nil
 					},
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
-					mockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					MockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
 						return &sesv2.SendEmailOutput{}, errSend
 					},
 				}
 			},
 			input: SaveInput{
-				Input: Input{
+				Input: email.Input{
 					MessageID: "draft-example",
 					From:      []string{""},
 				},
@@ -384,27 +362,27 @@ func TestSave(t *testing.T) {
 			expectedErr: errSend,
 		},
 		{ // with Send
-			client: func(t *testing.T) api.SaveAndSendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockCreateEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]types.AttributeValue{},
 						}, nil
 					},
-					mockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+					MockPutItem: func(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 						return &dynamodb.PutItemOutput{}, nil
 					},
-					mockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					MockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
 						return &sesv2.SendEmailOutput{MessageId: aws.String("sent-message-id")}, nil
 					},
-					mockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					MockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
 						return &dynamodb.TransactWriteItemsOutput{}, errBatchWrite
 					},
 				}
 			},
 			input: SaveInput{
-				Input: Input{
+				Input: email.Input{
 					MessageID: "draft-example",
 					From:      []string{""},
 				},
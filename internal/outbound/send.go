@@ -0,0 +1,415 @@
+package outbound
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/counter"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/addr"
+	"github.com/harryzcy/mailbox/internal/util/format"
+	"github.com/jhillyerd/enmime"
+)
+
+// API defines set of API required to create, save, forward and send emails
+type API interface {
+	clients.Table
+	clients.Storage
+	clients.Mailer
+}
+
+// SendAPI defines set of API required to send drafts, which are queued to be retried if sending fails transiently
+type SendAPI interface {
+	API
+	clients.Queue
+}
+
+type SendResult struct {
+	MessageID string
+	DryRun    bool `json:"dryRun,omitempty"`   // whether the email is a simulated send
+	Retrying  bool `json:"retrying,omitempty"` // whether the send failed transiently and is queued to be retried
+}
+
+// Send sends a draft email.
+// If SEND_RETRY_QUEUE is set, failed sends are recorded on the draft, and transient failures are retried,
+// in which case the result has Retrying set and the MessageID of the draft.
+func Send(ctx context.Context, client SendAPI, messageID string) (*SendResult, error) {
+	if !strings.HasPrefix(messageID, "draft-") {
+		return nil, api.ErrEmailIsNotDraft
+	}
+
+	resp, err := email.Get(ctx, client, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Type != email.EmailTypeDraft {
+		return nil, &api.InvalidTransitionError{From: resp.Type, To: email.StateSent}
+	}
+
+	result, err := sendDraft(ctx, client, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("send method finished successfully")
+	return result, nil
+}
+
+// sendDraft sends a draft and marks it as sent, see Send
+func sendDraft(ctx context.Context, client SendAPI, draft *email.GetResult) (*SendResult, error) {
+	msg := &email.Input{
+		MessageID:    draft.MessageID,
+		Subject:      draft.Subject,
+		From:         draft.From,
+		To:           draft.To,
+		Cc:           draft.Cc,
+		Bcc:          draft.Bcc,
+		ReplyTo:      draft.ReplyTo,
+		InReplyTo:    draft.InReplyTo,
+		References:   draft.References,
+		Text:         draft.Text,
+		HTML:         draft.HTML,
+		ThreadID:     draft.ThreadID,
+		NoReply:      draft.NoReply,
+		DryRun:       draft.DryRun,
+		SendAttempts: draft.SendAttempts,
+		Uploads:      draft.Uploads,
+	}
+	newMessageID, err := sendEmailViaSES(ctx, client, msg)
+	if err != nil {
+		if retryEnabled() && !errors.Is(err, api.ErrInvalidInput) && !errors.Is(err, api.ErrUploadNotFound) {
+			return handleSendFailure(ctx, client, draft, err)
+		}
+		return nil, err
+	}
+	msg.MessageID = newMessageID
+
+	err = markEmailAsSent(ctx, client, draft.MessageID, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SendResult{
+		MessageID: newMessageID,
+		DryRun:    msg.DryRun,
+	}, nil
+}
+
+// sendEmailViaSES sends an email via SES.
+// If it is a reply, it will build the MIME message and send it as a raw email.
+// In this case, it is assumed that both InReplyTo and References are not empty.
+// Otherwise, it will use the simple email API.
+// In dry-run mode, msg.DryRun is set and the email is routed to the dry-run sink.
+func sendEmailViaSES(ctx context.Context, client API, msg *email.Input) (string, error) {
+	fmt.Println("sending email via SES")
+	contents, err := loadUploads(ctx, client, msg)
+	if err != nil {
+		return "", err
+	}
+	input, err := newSendEmailInput(msg, contents)
+	if err != nil {
+		return "", err
+	}
+
+	messageID, dryRun, err := deliver(ctx, client, input, msg.DryRun)
+	if err != nil {
+		return "", err
+	}
+	msg.DryRun = dryRun
+
+	fmt.Println("email sent successfully")
+	return messageID, nil
+}
+
+// newSendEmailInput builds the SES input of an email with the contents of its uploads, see sendEmailViaSES
+func newSendEmailInput(msg *email.Input, uploadContents [][]byte) (*sesv2.SendEmailInput, error) {
+	if len(msg.From) == 0 {
+		return nil, api.ErrInvalidInput
+	}
+	if msg.NoReply {
+		if env.NoReplyAddress == "" {
+			return nil, api.ErrInvalidInput
+		}
+		msg.ApplyNoReply()
+	}
+	// SES requires internationalized domains in punycode
+	var addresses [5][]string
+	for i, list := range [][]string{msg.From[:1], msg.To, msg.Cc, msg.Bcc, msg.ReplyTo} {
+		converted, err := addr.ToASCIIAll(list)
+		if err != nil {
+			return nil, api.ErrInvalidInput
+		}
+		addresses[i] = converted
+	}
+	input := &sesv2.SendEmailInput{
+		Content: &sestypes.EmailContent{},
+		Destination: &sestypes.Destination{
+			ToAddresses:  addresses[1],
+			CcAddresses:  addresses[2],
+			BccAddresses: addresses[3],
+		},
+		FromEmailAddress: aws.String(addresses[0][0]),
+		ReplyToAddresses: addresses[4],
+	}
+	if msg.NoReply {
+		// bounces go to the sink address too, where they are trashed when received
+		input.FeedbackForwardingEmailAddress = aws.String(addresses[4][0])
+	}
+
+	if msg.InReplyTo == "" && len(msg.Uploads) == 0 {
+		// Use simple email when it's not a reply and has no attachments,
+		// since we don't need to customize the headers in this case
+		fmt.Println("sending simple email")
+		input.Content.Simple = &sestypes.Message{
+			Body: &sestypes.Body{
+				Html: &sestypes.Content{
+					Data:    aws.String(msg.HTML),
+					Charset: aws.String("UTF-8"),
+				},
+				Text: &sestypes.Content{
+					Data:    aws.String(msg.Text),
+					Charset: aws.String("UTF-8"),
+				},
+			},
+			Subject: &sestypes.Content{
+				Data:    aws.String(msg.Subject),
+				Charset: aws.String("UTF-8"),
+			},
+		}
+	} else {
+		// Use raw email when it's a reply or has attachments.
+		// We need to customize the In-Reply-To and References headers, or add the attachments
+		fmt.Println("sending raw email")
+		data, err := buildMIMEEmail(msg, uploadContents)
+		if err != nil {
+			return nil, err
+		}
+		input.Content.Raw = &sestypes.RawMessage{
+			Data: data,
+		}
+	}
+	return input, nil
+}
+
+// markEmailAsSent marks an email as sent in DynamoDB.
+// It will delete the old draft email and create a new sent email.
+// If the email is a reply, it will also update the thread by removing the DraftID attribute and append the new MessageID to the EmailIDs attribute.
+//
+// input:
+//   - oldMessageID: the MessageID of the draft email
+//   - email: the new sent email (with the new MessageID)
+func markEmailAsSent(ctx context.Context, client clients.Table, oldMessageID string, msg *email.Input) error {
+	fmt.Println("marking email as sent")
+	now := getUpdatedTime()
+	typeYearMonth, err := format.TypeYearMonth(email.EmailTypeSent, now)
+	if err != nil {
+		return err
+	}
+	dateTime := format.DateTime(now, msg.MessageID)
+
+	item := msg.GenerateAttributes(typeYearMonth, dateTime)
+
+	// Delete the old draft email and create the new sent email
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []dynamodbTypes.TransactWriteItem{
+			{
+				Delete: &dynamodbTypes.Delete{
+					TableName: aws.String(env.TableName),
+					Key: map[string]dynamodbTypes.AttributeValue{
+						"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: oldMessageID},
+					},
+					// the draft may be sent by a concurrent request, which shouldn't create another sent email
+					ConditionExpression: aws.String("begins_with(TypeYearMonth, :v_draft)"),
+					ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+						":v_draft": &dynamodbTypes.AttributeValueMemberS{Value: email.EmailTypeDraft + "#"},
+					},
+					ReturnValuesOnConditionCheckFailure: dynamodbTypes.ReturnValuesOnConditionCheckFailureAllOld,
+				},
+			},
+			{
+				Put: &dynamodbTypes.Put{
+					TableName: aws.String(env.TableName),
+					Item:      item,
+				},
+			},
+		},
+	}
+	// If it's a reply, update the thread:
+	// 1. removing DraftID
+	// 2.  append the new MessageID to the EmailIDs attribute
+	// 3. update the time of the latest activity
+	if msg.InReplyTo != "" {
+		fmt.Println("include thread update")
+		input.TransactItems = append(input.TransactItems, dynamodbTypes.TransactWriteItem{
+			Update: &dynamodbTypes.Update{
+				TableName: aws.String(env.TableName),
+				Key: map[string]dynamodbTypes.AttributeValue{
+					"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: msg.ThreadID},
+				},
+				UpdateExpression: aws.String("REMOVE DraftID SET EmailIDs = list_append(EmailIDs, :newMessageID), TimeUpdated = :timeUpdated, ItemType = :itemType"),
+				ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+					":timeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: format.RFC3399(now)},
+					":itemType":    &dynamodbTypes.AttributeValueMemberS{Value: email.EmailTypeThread},
+					":newMessageID": &dynamodbTypes.AttributeValueMemberL{
+						Value: []dynamodbTypes.AttributeValue{
+							&dynamodbTypes.AttributeValueMemberS{Value: msg.MessageID},
+						},
+					},
+				},
+			},
+		})
+	}
+	if counter.Enabled() {
+		// the draft is removed from the drafts counter, while sent emails aren't counted
+		input.TransactItems = append(input.TransactItems,
+			counter.Updates(counter.Remove(counter.State{TypeYearMonth: email.EmailTypeDraft + "#"})...)...)
+	}
+	_, err = client.TransactWriteItems(ctx, input)
+
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		if apiErr := new(dynamodbTypes.TransactionCanceledException); errors.As(err, &apiErr) {
+			fmt.Printf("transaction canceled, %s\n", apiErr.Error())
+			logCancellationReasons(apiErr.CancellationReasons)
+			if len(apiErr.CancellationReasons) > 0 && aws.ToString(apiErr.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+				return email.CheckSend(apiErr.CancellationReasons[0].Item)
+			}
+		}
+		return err
+	}
+	fmt.Println("email marked as sent successfully")
+	return nil
+}
+
+func buildMIMEEmail(msg *email.Input, uploadContents [][]byte) ([]byte, error) {
+	var errs []error
+	builder := enmime.Builder()
+	builder = builder.Subject(msg.Subject)
+
+	if len(msg.From) == 0 {
+		errs = append(errs, api.ErrInvalidInput)
+	} else {
+		if from, err := addr.ParseMailAddresses(msg.From[:1]); err == nil {
+			builder = builder.From(from[0].Name, from[0].Address)
+		} else {
+			errs = append(errs, fmt.Errorf("failed to parse from address: %v", err))
+		}
+	}
+
+	if to, err := convertToMailAddresses(msg.To); err == nil {
+		builder = builder.ToAddrs(to)
+	} else {
+		errs = append(errs, fmt.Errorf("failed to parse to address: %v", err))
+	}
+
+	if cc, err := convertToMailAddresses(msg.Cc); err == nil {
+		builder = builder.CCAddrs(cc)
+	} else {
+		errs = append(errs, fmt.Errorf("failed to parse cc address: %v", err))
+	}
+
+	if bcc, err := convertToMailAddresses(msg.Bcc); err == nil {
+		builder = builder.BCCAddrs(bcc)
+	} else {
+		errs = append(errs, fmt.Errorf("failed to parse bcc address: %v", err))
+	}
+
+	if len(msg.ReplyTo) == 0 {
+		errs = append(errs, api.ErrInvalidInput)
+	} else {
+		if replyTo, err := addr.ParseMailAddresses(msg.ReplyTo[:1]); err == nil {
+			builder = builder.ReplyTo(replyTo[0].Name, replyTo[0].Address)
+		} else {
+			errs = append(errs, fmt.Errorf("failed to parse reply-to address: %v", err))
+		}
+	}
+
+	if msg.InReplyTo != "" {
+		builder = builder.Header("In-Reply-To", msg.InReplyTo)
+	}
+	if msg.References != "" {
+		builder = builder.Header("References", msg.References)
+	}
+	builder = builder.Text([]byte(msg.Text))
+	builder = builder.HTML([]byte(msg.HTML))
+	for i, upload := range msg.Uploads {
+		if i >= len(uploadContents) {
+			errs = append(errs, fmt.Errorf("upload %s is not loaded", upload.UploadID))
+			break
+		}
+		builder = builder.AddAttachment(uploadContents[i], upload.ContentType, upload.Filename)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	part, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	writer := bytes.NewBuffer(nil)
+	err = part.Encode(writer)
+	if err != nil {
+		return nil, err
+	}
+	return writer.Bytes(), nil
+}
+
+// loadUploads reads the contents of the uploaded attachments of an email
+func loadUploads(ctx context.Context, client storage.S3GetObjectAPI, msg *email.Input) ([][]byte, error) {
+	contents := make([][]byte, 0, len(msg.Uploads))
+	for _, upload := range msg.Uploads {
+		content, err := storage.GetUpload(ctx, client, upload.UploadID)
+		if err != nil {
+			if apiErr := new(s3types.NoSuchKey); errors.As(err, &apiErr) {
+				return nil, api.ErrUploadNotFound
+			}
+			return nil, err
+		}
+		contents = append(contents, content)
+	}
+	return contents, nil
+}
+
+func convertToMailAddresses(addresses []string) ([]mail.Address, error) {
+	return addr.ParseMailAddresses(addresses)
+}
+
+func logCancellationReasons(reasons []dynamodbTypes.CancellationReason) {
+	for _, reason := range reasons {
+		if reason.Code == nil {
+			continue
+		}
+
+		log := fmt.Sprintf("code: %s, message: ", *reason.Code)
+		if reason.Message != nil {
+			log += *reason.Message
+		} else {
+			log += "nil"
+		}
+		log += ", item: "
+		if reason.Item != nil {
+			log += fmt.Sprintf("%v", reason.Item)
+		} else {
+			log += "nil"
+		}
+		fmt.Println(log)
+	}
+}
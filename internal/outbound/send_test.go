@@ -1,50 +1,40 @@
-package email
+package outbound
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
 	"net/mail"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	"github.com/harryzcy/mailbox/internal/api"
-	"github.com/harryzcy/mailbox/internal/util/mockutil"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/jhillyerd/enmime"
 	"github.com/stretchr/testify/assert"
 )
 
-type mockSendEmailAPI struct {
-	mockGetItem           mockGetItemAPI
-	mockTransactWriteItem mockutil.MockTransactWriteItemAPI
-	mockSendEmail         func(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
-}
-
-func (m mockSendEmailAPI) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
-	return m.mockGetItem(ctx, params, optFns...)
-}
-
-func (m mockSendEmailAPI) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
-	return m.mockTransactWriteItem(ctx, params, optFns...)
-}
-
-func (m mockSendEmailAPI) SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
-	return m.mockSendEmail(ctx, params, optFns...)
-}
-
 func TestSend(t *testing.T) {
 	tests := []struct {
-		client      func(t *testing.T) api.GetAndSendEmailAPI
+		client      func(t *testing.T) SendAPI
 		messageID   string
 		expectedErr error
 	}{
 		{
-			client: func(t *testing.T) api.GetAndSendEmailAPI {
+			client: func(t *testing.T) SendAPI {
 				t.Helper()
-				return mockSendEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]dynamodbTypes.AttributeValue{
 								"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "draft-id"},
@@ -62,12 +52,12 @@ func TestSend(t *testing.T) {
 							},
 						}, nil
 					},
-					mockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					MockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
 						return &sesv2.SendEmailOutput{
 							MessageId: aws.String("newID"),
 						}, nil
 					},
-					mockTransactWriteItem: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					MockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
 						return &dynamodb.TransactWriteItemsOutput{}, nil
 					},
 				}
@@ -75,18 +65,18 @@ func TestSend(t *testing.T) {
 			messageID: "draft-id",
 		},
 		{
-			client: func(t *testing.T) api.GetAndSendEmailAPI {
+			client: func(t *testing.T) SendAPI {
 				t.Helper()
-				return mockSendEmailAPI{}
+				return clients.Fake{}
 			},
 			messageID:   "invalid-id",
 			expectedErr: api.ErrEmailIsNotDraft,
 		},
 		{
-			client: func(t *testing.T) api.GetAndSendEmailAPI {
+			client: func(t *testing.T) SendAPI {
 				t.Helper()
-				return mockSendEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]dynamodbTypes.AttributeValue{},
 						}, api.ErrNotFound
@@ -97,10 +87,10 @@ func TestSend(t *testing.T) {
 			expectedErr: api.ErrNotFound,
 		},
 		{
-			client: func(t *testing.T) api.GetAndSendEmailAPI {
+			client: func(t *testing.T) SendAPI {
 				t.Helper()
-				return mockSendEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]dynamodbTypes.AttributeValue{
 								"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "draft-id"},
@@ -118,10 +108,10 @@ func TestSend(t *testing.T) {
 							},
 						}, nil
 					},
-					mockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					MockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
 						return &sesv2.SendEmailOutput{}, errors.New("1")
 					},
-					mockTransactWriteItem: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					MockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
 						return &dynamodb.TransactWriteItemsOutput{}, nil
 					},
 				}
@@ -130,10 +120,10 @@ func TestSend(t *testing.T) {
 			expectedErr: errors.New("1"),
 		},
 		{
-			client: func(t *testing.T) api.GetAndSendEmailAPI {
+			client: func(t *testing.T) SendAPI {
 				t.Helper()
-				return mockSendEmailAPI{
-					mockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return clients.Fake{
+					MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 						return &dynamodb.GetItemOutput{
 							Item: map[string]dynamodbTypes.AttributeValue{
 								"MessageID":     &dynamodbTypes.AttributeValueMemberS{Value: "draft-id"},
@@ -151,12 +141,12 @@ func TestSend(t *testing.T) {
 							},
 						}, nil
 					},
-					mockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					MockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
 						return &sesv2.SendEmailOutput{
 							MessageId: aws.String("newID"),
 						}, nil
 					},
-					mockTransactWriteItem: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					MockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
 						return &dynamodb.TransactWriteItemsOutput{}, errors.New("2")
 					},
 				}
@@ -183,34 +173,34 @@ func TestSend(t *testing.T) {
 
 func TestSendEmailViaSES(t *testing.T) {
 	tests := []struct {
-		client            func(t *testing.T, email *Input) api.SendEmailAPI
-		email             *Input
+		client            func(t *testing.T, msg *email.Input) API
+		msg               *email.Input
 		expectedMessageID string
 		expectedErr       error
 	}{
 		{
-			client: func(t *testing.T, email *Input) api.SendEmailAPI {
+			client: func(t *testing.T, msg *email.Input) API {
 				t.Helper()
-				return mockSendEmailAPI{
-					mockSendEmail: func(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+				return clients.Fake{
+					MockSendEmail: func(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
 						t.Helper()
 
 						assert.Nil(t, params.Content.Raw)
 						assert.Nil(t, params.Content.Template)
-						assert.Equal(t, email.HTML, *params.Content.Simple.Body.Html.Data)
+						assert.Equal(t, msg.HTML, *params.Content.Simple.Body.Html.Data)
 						assert.Equal(t, "UTF-8", *params.Content.Simple.Body.Html.Charset)
-						assert.Equal(t, email.Text, *params.Content.Simple.Body.Text.Data)
+						assert.Equal(t, msg.Text, *params.Content.Simple.Body.Text.Data)
 						assert.Equal(t, "UTF-8", *params.Content.Simple.Body.Text.Charset)
 
-						assert.Equal(t, email.Subject, *params.Content.Simple.Subject.Data)
+						assert.Equal(t, msg.Subject, *params.Content.Simple.Subject.Data)
 						assert.Equal(t, "UTF-8", *params.Content.Simple.Subject.Charset)
 
-						assert.Equal(t, email.To, params.Destination.ToAddresses)
-						assert.Equal(t, email.Cc, params.Destination.CcAddresses)
-						assert.Equal(t, email.Bcc, params.Destination.BccAddresses)
+						assert.Equal(t, msg.To, params.Destination.ToAddresses)
+						assert.Equal(t, msg.Cc, params.Destination.CcAddresses)
+						assert.Equal(t, msg.Bcc, params.Destination.BccAddresses)
 
-						assert.Equal(t, email.From[0], *params.FromEmailAddress)
-						assert.Equal(t, email.ReplyTo, params.ReplyToAddresses)
+						assert.Equal(t, msg.From[0], *params.FromEmailAddress)
+						assert.Equal(t, msg.ReplyTo, params.ReplyToAddresses)
 
 						return &sesv2.SendEmailOutput{
 							MessageId: aws.String("newMessageID"),
@@ -218,7 +208,7 @@ func TestSendEmailViaSES(t *testing.T) {
 					},
 				}
 			},
-			email: &Input{
+			msg: &email.Input{
 				MessageID: "exampleMessageID",
 				Subject:   "subject",
 				To:        []string{"example@example.com"},
@@ -232,44 +222,215 @@ func TestSendEmailViaSES(t *testing.T) {
 			expectedMessageID: "newMessageID",
 		},
 		{
-			client: func(t *testing.T, _ *Input) api.SendEmailAPI {
+			client: func(t *testing.T, _ *email.Input) API {
 				t.Helper()
-				return mockSendEmailAPI{
-					mockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+				return clients.Fake{
+					MockSendEmail: func(_ context.Context, _ *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
 						return &sesv2.SendEmailOutput{}, api.ErrEmailIsNotDraft
 					},
 				}
 			},
-			email: &Input{
+			msg: &email.Input{
 				From: []string{""},
 			},
 			expectedErr: api.ErrEmailIsNotDraft,
 		},
+		{ // internationalized domains are converted to punycode
+			client: func(t *testing.T, _ *email.Input) API {
+				t.Helper()
+				return clients.Fake{
+					MockSendEmail: func(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+						t.Helper()
+						assert.Equal(t, []string{"user@xn--bcher-kva.example"}, params.Destination.ToAddresses)
+						assert.Equal(t, "example@example.com", *params.FromEmailAddress)
+						return &sesv2.SendEmailOutput{
+							MessageId: aws.String("newMessageID"),
+						}, nil
+					},
+				}
+			},
+			msg: &email.Input{
+				From: []string{"example@example.com"},
+				To:   []string{"user@bücher.example"},
+			},
+			expectedMessageID: "newMessageID",
+		},
+		{
+			client: func(t *testing.T, _ *email.Input) API {
+				t.Helper()
+				return clients.Fake{}
+			},
+			msg: &email.Input{
+				From: []string{"example@example.com"},
+				To:   []string{"invalid"},
+			},
+			expectedErr: api.ErrInvalidInput,
+		},
 	}
 
 	for i, test := range tests {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			t.Helper()
 			ctx := context.TODO()
-			messageID, err := sendEmailViaSES(ctx, test.client(t, test.email), test.email)
+			messageID, err := sendEmailViaSES(ctx, test.client(t, test.msg), test.msg)
 			assert.Equal(t, test.expectedMessageID, messageID)
 			assert.Equal(t, test.expectedErr, err)
 		})
 	}
 }
 
+func TestSendEmailViaSES_NoReply(t *testing.T) {
+	env.NoReplyAddress = "no-reply@example.com"
+	defer func() { env.NoReplyAddress = "" }()
+
+	client := clients.Fake{
+		MockSendEmail: func(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+			assert.Equal(t, []string{"no-reply@example.com"}, params.ReplyToAddresses)
+			assert.Equal(t, "no-reply@example.com", *params.FeedbackForwardingEmailAddress)
+			return &sesv2.SendEmailOutput{
+				MessageId: aws.String("newMessageID"),
+			}, nil
+		},
+	}
+	msg := &email.Input{
+		From:    []string{"example@example.com"},
+		To:      []string{"example@example.com"},
+		ReplyTo: []string{"support@example.com"},
+		NoReply: true,
+	}
+	messageID, err := sendEmailViaSES(context.TODO(), client, msg)
+	assert.Nil(t, err)
+	assert.Equal(t, "newMessageID", messageID)
+	assert.Equal(t, []string{"no-reply@example.com"}, msg.ReplyTo) // stored as sent
+
+	// no-reply mode is disabled without the sink address
+	env.NoReplyAddress = ""
+	_, err = sendEmailViaSES(context.TODO(), clients.Fake{}, &email.Input{From: []string{"example@example.com"}, NoReply: true})
+	assert.Equal(t, api.ErrInvalidInput, err)
+	assert.Equal(t, email.ErrNoReplyDisabled, email.Input{NoReply: true}.Validate())
+}
+
+func TestSendEmailViaSES_Uploads(t *testing.T) {
+	env.S3Bucket = "test_bucket"
+	uploadID := "0123456789abcdef0123456789abcdef"
+
+	client := clients.Fake{
+		MockGetObject: func(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			if *params.Key != "uploads/"+uploadID {
+				return nil, &s3types.NoSuchKey{}
+			}
+			return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("%PDF-1.4"))}, nil
+		},
+		MockSendEmail: func(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+			// emails with attachments are sent as raw emails
+			assert.Nil(t, params.Content.Simple)
+			env, err := enmime.ReadEnvelope(bytes.NewReader(params.Content.Raw.Data))
+			assert.Nil(t, err)
+			assert.Len(t, env.Attachments, 1)
+			assert.Equal(t, "report.pdf", env.Attachments[0].FileName)
+			assert.Equal(t, "application/pdf", env.Attachments[0].ContentType)
+			assert.Equal(t, "%PDF-1.4", string(env.Attachments[0].Content))
+			return &sesv2.SendEmailOutput{MessageId: aws.String("newMessageID")}, nil
+		},
+	}
+	msg := &email.Input{
+		From:    []string{"example@example.com"},
+		To:      []string{"example@example.com"},
+		ReplyTo: []string{"example@example.com"},
+		Text:    "see attached",
+		Uploads: []email.UploadedFile{{UploadID: uploadID, Filename: "report.pdf", ContentType: "application/pdf"}},
+	}
+	messageID, err := sendEmailViaSES(context.TODO(), client, msg)
+	assert.Nil(t, err)
+	assert.Equal(t, "newMessageID", messageID)
+
+	// the upload expired or was never completed
+	msg.Uploads[0].UploadID = "fedcba9876543210fedcba9876543210"
+	_, err = sendEmailViaSES(context.TODO(), client, msg)
+	assert.Equal(t, api.ErrUploadNotFound, err)
+}
+
+func TestInput_Validate_Uploads(t *testing.T) {
+	tests := []struct {
+		upload   email.UploadedFile
+		expected error
+	}{
+		{email.UploadedFile{UploadID: "0123456789abcdef0123456789abcdef", Filename: "a.pdf", ContentType: "application/pdf"}, nil},
+		{email.UploadedFile{UploadID: "../emails/exampleMessageID", Filename: "a.pdf", ContentType: "application/pdf"}, api.ErrInvalidInput},
+		{email.UploadedFile{UploadID: "0123456789abcdef0123456789abcdef", ContentType: "application/pdf"}, api.ErrInvalidInput},
+		{email.UploadedFile{UploadID: "0123456789abcdef0123456789abcdef", Filename: "a.pdf"}, api.ErrInvalidInput},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, email.Input{Uploads: []email.UploadedFile{test.upload}}.Validate())
+		})
+	}
+}
+
+func TestSendEmailViaSES_DryRun(t *testing.T) {
+	defer func() { env.DryRun = "" }()
+
+	tests := []struct {
+		env       string
+		requested bool
+		dryRun    bool
+		sent      bool
+		to        []string
+	}{
+		{"", false, false, true, []string{"user@example.com"}},
+		{"off", true, true, true, []string{SimulatorAddress}},
+		{"simulator", false, true, true, []string{SimulatorAddress}},
+		{"noop", true, true, false, nil},
+		{"typo", false, true, true, []string{SimulatorAddress}},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.DryRun = test.env
+			sent := false
+			client := clients.Fake{
+				MockSendEmail: func(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+					sent = true
+					assert.Equal(t, test.to, params.Destination.ToAddresses)
+					assert.Empty(t, params.Destination.BccAddresses)
+					return &sesv2.SendEmailOutput{
+						MessageId: aws.String("newMessageID"),
+					}, nil
+				},
+			}
+			msg := &email.Input{
+				From:   []string{"example@example.com"},
+				To:     []string{"user@example.com"},
+				DryRun: test.requested,
+			}
+			if test.dryRun {
+				msg.Bcc = []string{"audit@example.com"}
+			}
+			messageID, err := sendEmailViaSES(context.TODO(), client, msg)
+			assert.Nil(t, err)
+			assert.NotEmpty(t, messageID)
+			assert.Equal(t, test.sent, sent)
+			assert.Equal(t, test.dryRun, msg.DryRun)
+			assert.Equal(t, []string{"user@example.com"}, msg.To) // stored with the original recipients
+			_, marked := msg.GenerateAttributes("sent#2022-03", "")["DryRun"]
+			assert.Equal(t, test.dryRun, marked)
+		})
+	}
+}
+
 func TestMarkEmailAsSent(t *testing.T) {
 	tests := []struct {
-		client       func(t *testing.T) api.SendEmailAPI
+		client       func(t *testing.T) API
 		oldMessageID string
-		email        *Input
+		msg          *email.Input
 		expectedErr  error
 	}{
 		{
-			client: func(t *testing.T) api.SendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockSendEmailAPI{
-					mockTransactWriteItem: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+				return clients.Fake{
+					MockTransactWriteItems: func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
 						t.Helper()
 
 						assert.Len(t, params.TransactItems, 2)
@@ -290,7 +451,7 @@ func TestMarkEmailAsSent(t *testing.T) {
 				}
 			},
 			oldMessageID: "oldID",
-			email: &Input{
+			msg: &email.Input{
 				MessageID: "newID",
 				Subject:   "subject",
 				To:        []string{"example@example.com"},
@@ -303,15 +464,15 @@ func TestMarkEmailAsSent(t *testing.T) {
 			},
 		},
 		{
-			client: func(t *testing.T) api.SendEmailAPI {
+			client: func(t *testing.T) API {
 				t.Helper()
-				return mockSendEmailAPI{
-					mockTransactWriteItem: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+				return clients.Fake{
+					MockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
 						return &dynamodb.TransactWriteItemsOutput{}, api.ErrNotFound
 					},
 				}
 			},
-			email: &Input{
+			msg: &email.Input{
 				MessageID: "newID",
 				Subject:   "subject",
 				To:        []string{"example@example.com"},
@@ -330,7 +491,7 @@ func TestMarkEmailAsSent(t *testing.T) {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			t.Helper()
 			ctx := context.TODO()
-			err := markEmailAsSent(ctx, test.client(t), test.oldMessageID, test.email)
+			err := markEmailAsSent(ctx, test.client(t), test.oldMessageID, test.msg)
 			assert.Equal(t, test.expectedErr, err)
 		})
 	}
@@ -338,13 +499,13 @@ func TestMarkEmailAsSent(t *testing.T) {
 
 func TestBuildMIMEEmail(t *testing.T) {
 	tests := []struct {
-		input        *Input
+		input        *email.Input
 		containLines []string
 		noLines      []string
 		expectedErr  error
 	}{
 		{
-			input: &Input{
+			input: &email.Input{
 				Subject: "this is the subject",
 				From:    []string{"Some One <someone@example.com>"},
 				To:      []string{"To One <toone@example.com>"},
@@ -367,13 +528,13 @@ func TestBuildMIMEEmail(t *testing.T) {
 
 	for i, test := range tests {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			email, err := buildMIMEEmail(test.input)
+			msg, err := buildMIMEEmail(test.input, nil)
 			assert.Equal(t, test.expectedErr, err)
 			for _, line := range test.containLines {
-				assert.Contains(t, string(email), line)
+				assert.Contains(t, string(msg), line)
 			}
 			for _, line := range test.noLines {
-				assert.NotContains(t, string(email), line)
+				assert.NotContains(t, string(msg), line)
 			}
 		})
 	}
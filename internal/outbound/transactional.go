@@ -0,0 +1,316 @@
+package outbound
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// Limits of transactional emails
+const (
+	MaxTags             = 10 // SES message tags
+	MaxMetadata         = 50
+	MaxMetadataKeyLen   = 64
+	MaxMetadataValueLen = 1024
+	MaxIdempotencyKey   = 255
+
+	// IdempotencyKeyLifetime is how long a request is replayed for the same idempotency key
+	IdempotencyKeyLifetime = 24 * time.Hour
+)
+
+// idempotencyItemPrefix is the prefix of the MessageID of the items claiming idempotency keys, which are stored in the email table
+const idempotencyItemPrefix = "send#"
+
+// tagPattern matches the names and values of SES message tags
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// TransactionalInput represents the input of SendTransactional method
+type TransactionalInput struct {
+	email.Input
+	// Template is a template stored in SES, used instead of subject, text and html
+	Template *TemplateRef      `json:"template,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"` // stored on the sent email
+	Tags     map[string]string `json:"tags,omitempty"`     // stored on the sent email and sent as SES message tags
+
+	IdempotencyKey string `json:"-"` // from the Idempotency-Key header
+}
+
+// TemplateRef references an SES email template
+type TemplateRef struct {
+	Name string          `json:"name"`
+	Data json.RawMessage `json:"data,omitempty"` // JSON object of the replacement values
+}
+
+// TransactionalResult represents the result of SendTransactional method
+type TransactionalResult struct {
+	MessageID string `json:"messageID"`        // SES message ID, which is also the ID of the sent email
+	DryRun    bool   `json:"dryRun,omitempty"` // whether the email is a simulated send
+}
+
+// SendTransactional sends an email without creating a draft, and stores it as a sent email.
+// Requests with the same IdempotencyKey are sent once, and replayed with the same result within IdempotencyKeyLifetime.
+func SendTransactional(ctx context.Context, client API, input TransactionalInput) (*TransactionalResult, error) {
+	if err := input.validate(); err != nil {
+		return nil, api.ErrInvalidInput
+	}
+
+	msg := input.Input
+	msg.MessageID, msg.ThreadID, msg.InReplyTo, msg.References = "", "", "", ""
+	if input.Template != nil {
+		msg.Subject, msg.Text, msg.HTML = "", "", ""
+	}
+
+	now := getUpdatedTime()
+	var fingerprint string
+	if input.IdempotencyKey != "" {
+		fingerprint = input.fingerprint()
+		messageID, err := claimIdempotencyKey(ctx, client, input.IdempotencyKey, fingerprint, now)
+		if err != nil {
+			return nil, err
+		}
+		if messageID != "" {
+			fmt.Println("replaying request with the same idempotency key")
+			return &TransactionalResult{MessageID: messageID}, nil
+		}
+	}
+
+	sesInput, err := newSendEmailInput(&msg, nil)
+	if err != nil {
+		return nil, errors.Join(err, releaseIdempotencyKey(ctx, client, input.IdempotencyKey, fingerprint))
+	}
+	if input.Template != nil {
+		data := string(input.Template.Data)
+		if data == "" {
+			data = "{}"
+		}
+		sesInput.Content = &sestypes.EmailContent{
+			Template: &sestypes.Template{
+				TemplateName: aws.String(input.Template.Name),
+				TemplateData: aws.String(data),
+			},
+		}
+	}
+	for _, name := range sortedKeys(input.Tags) {
+		sesInput.EmailTags = append(sesInput.EmailTags, sestypes.MessageTag{
+			Name:  aws.String(name),
+			Value: aws.String(input.Tags[name]),
+		})
+	}
+
+	fmt.Println("sending transactional email via SES")
+	msg.MessageID, msg.DryRun, err = deliver(ctx, client, sesInput, input.DryRun)
+	if err != nil {
+		return nil, errors.Join(err, releaseIdempotencyKey(ctx, client, input.IdempotencyKey, fingerprint))
+	}
+
+	err = storeTransactional(ctx, client, input, &msg, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("send transactional method finished successfully")
+	return &TransactionalResult{MessageID: msg.MessageID, DryRun: msg.DryRun}, nil
+}
+
+// storeTransactional stores the sent email, and completes the idempotency key if there's one
+func storeTransactional(ctx context.Context, client clients.Table, input TransactionalInput, msg *email.Input, now time.Time) error {
+	typeYearMonth, err := format.TypeYearMonth(email.EmailTypeSent, now)
+	if err != nil {
+		return err
+	}
+	item := msg.GenerateAttributes(typeYearMonth, format.DateTime(now, msg.MessageID))
+	if input.Template != nil {
+		item["Template"] = &types.AttributeValueMemberS{Value: input.Template.Name}
+		if len(input.Template.Data) > 0 {
+			item["TemplateData"] = &types.AttributeValueMemberS{Value: string(input.Template.Data)}
+		}
+	}
+	if len(input.Metadata) > 0 {
+		item["Metadata"] = stringMapAttribute(input.Metadata)
+	}
+	if len(input.Tags) > 0 {
+		item["Tags"] = stringMapAttribute(input.Tags)
+	}
+
+	transactItems := []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName: aws.String(env.TableName),
+				Item:      item,
+			},
+		},
+	}
+	if input.IdempotencyKey != "" {
+		transactItems = append(transactItems, types.TransactWriteItem{
+			Update: &types.Update{
+				TableName: aws.String(env.TableName),
+				Key: map[string]types.AttributeValue{
+					"MessageID": &types.AttributeValueMemberS{Value: idempotencyItemPrefix + input.IdempotencyKey},
+				},
+				UpdateExpression: aws.String("SET EmailID = :emailID"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":emailID": &types.AttributeValueMemberS{Value: msg.MessageID},
+				},
+			},
+		})
+	}
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		// the email is sent, but retrying with the same idempotency key is rejected until it expires
+		fmt.Printf("failed to store sent email %s: %v\n", msg.MessageID, err)
+		return err
+	}
+	return nil
+}
+
+// claimIdempotencyKey claims an idempotency key for a request.
+// If the key is already used by the same request, the ID of the email sent is returned.
+func claimIdempotencyKey(ctx context.Context, client clients.Table, key, fingerprint string, now time.Time) (string, error) {
+	id := idempotencyItemPrefix + key
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item: map[string]types.AttributeValue{
+			"MessageID":   &types.AttributeValueMemberS{Value: id},
+			"Fingerprint": &types.AttributeValueMemberS{Value: fingerprint},
+			"ExpiresTime": &types.AttributeValueMemberS{Value: format.RFC3399(now.Add(IdempotencyKeyLifetime))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(MessageID) OR ExpiresTime < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: format.RFC3399(now)},
+		},
+	})
+	if err == nil {
+		return "", nil
+	}
+	if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+		return "", api.ErrTooManyRequests
+	}
+	if apiErr := new(types.ConditionalCheckFailedException); !errors.As(err, &apiErr) {
+		return "", err
+	}
+
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	if stored, ok := resp.Item["Fingerprint"].(*types.AttributeValueMemberS); !ok || stored.Value != fingerprint {
+		return "", api.ErrIdempotencyKeyReused
+	}
+	if emailID, ok := resp.Item["EmailID"].(*types.AttributeValueMemberS); ok {
+		return emailID.Value, nil
+	}
+	return "", api.ErrSendInProgress
+}
+
+// releaseIdempotencyKey deletes the claim of an idempotency key if the email isn't sent, so that the request can be retried
+func releaseIdempotencyKey(ctx context.Context, client clients.Table, key, fingerprint string) error {
+	if key == "" {
+		return nil
+	}
+	_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: idempotencyItemPrefix + key},
+		},
+		ConditionExpression: aws.String("Fingerprint = :fingerprint AND attribute_not_exists(EmailID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":fingerprint": &types.AttributeValueMemberS{Value: fingerprint},
+		},
+	})
+	if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+		return nil
+	}
+	return err
+}
+
+// validate checks the input, besides the checks of Input.Validate
+func (input TransactionalInput) validate() error {
+	if err := input.Input.Validate(); err != nil {
+		return err
+	}
+	if len(input.From) == 0 || len(input.To)+len(input.Cc)+len(input.Bcc) == 0 {
+		return api.ErrInvalidInput
+	}
+	if input.Template != nil {
+		if input.Template.Name == "" || input.Subject != "" || input.Text != "" || input.HTML != "" {
+			return api.ErrInvalidInput
+		}
+		data := bytes.TrimSpace(input.Template.Data)
+		if len(data) > 0 && (data[0] != '{' || !json.Valid(data)) {
+			return api.ErrInvalidInput
+		}
+	} else if input.Subject == "" || (input.Text == "" && input.HTML == "") {
+		return api.ErrInvalidInput
+	}
+
+	if len(input.Tags) > MaxTags {
+		return api.ErrInvalidInput
+	}
+	for name, value := range input.Tags {
+		if !tagPattern.MatchString(name) || !tagPattern.MatchString(value) {
+			return api.ErrInvalidInput
+		}
+	}
+	if len(input.Metadata) > MaxMetadata {
+		return api.ErrInvalidInput
+	}
+	for key, value := range input.Metadata {
+		if key == "" || len(key) > MaxMetadataKeyLen || len(value) > MaxMetadataValueLen {
+			return api.ErrInvalidInput
+		}
+	}
+	if len(input.IdempotencyKey) > MaxIdempotencyKey {
+		return api.ErrInvalidInput
+	}
+	return nil
+}
+
+// fingerprint identifies the request, so that an idempotency key can't be reused by a different request
+func (input TransactionalInput) fingerprint() string {
+	data, _ := json.Marshal(input) // maps are marshaled in sorted order
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func stringMapAttribute(m map[string]string) types.AttributeValue {
+	value := make(map[string]types.AttributeValue, len(m))
+	for k, v := range m {
+		value[k] = &types.AttributeValueMemberS{Value: v}
+	}
+	return &types.AttributeValueMemberM{Value: value}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
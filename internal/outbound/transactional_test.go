@@ -0,0 +1,200 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockTransactionalAPI stores items like DynamoDB and records the emails sent
+type mockTransactionalAPI struct {
+	clients.Fake
+	items   map[string]map[string]dynamodbTypes.AttributeValue
+	sent    []*sesv2.SendEmailInput
+	sendErr error
+}
+
+func (m *mockTransactionalAPI) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	id := params.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: m.items[id]}, nil
+}
+
+func (m *mockTransactionalAPI) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	id := params.Item["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value
+	if existing, ok := m.items[id]; ok {
+		now := params.ExpressionAttributeValues[":now"].(*dynamodbTypes.AttributeValueMemberS).Value
+		if existing["ExpiresTime"].(*dynamodbTypes.AttributeValueMemberS).Value >= now {
+			return nil, &dynamodbTypes.ConditionalCheckFailedException{}
+		}
+	}
+	m.items[id] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockTransactionalAPI) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	delete(m.items, params.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (m *mockTransactionalAPI) TransactWriteItems(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	for _, item := range params.TransactItems {
+		if item.Put != nil {
+			m.items[item.Put.Item["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value] = item.Put.Item
+		}
+		if item.Update != nil {
+			id := item.Update.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value
+			m.items[id]["EmailID"] = item.Update.ExpressionAttributeValues[":emailID"]
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (m *mockTransactionalAPI) SendEmail(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	if m.sendErr != nil {
+		return nil, m.sendErr
+	}
+	m.sent = append(m.sent, params)
+	return &sesv2.SendEmailOutput{MessageId: aws.String("ses-" + strconv.Itoa(len(m.sent)))}, nil
+}
+
+func TestSendTransactional(t *testing.T) {
+	oldGetUpdatedTime := getUpdatedTime
+	getUpdatedTime = func() time.Time { return time.Date(2022, 3, 16, 16, 55, 45, 0, time.UTC) }
+	defer func() { getUpdatedTime = oldGetUpdatedTime }()
+
+	client := &mockTransactionalAPI{items: make(map[string]map[string]dynamodbTypes.AttributeValue)}
+	input := TransactionalInput{
+		Input: email.Input{
+			From: []string{"example@example.com"},
+			To:   []string{"user@example.com"},
+		},
+		Template: &TemplateRef{Name: "welcome", Data: []byte(`{"name":"user"}`)},
+		Metadata: map[string]string{"userID": "42"},
+		Tags:     map[string]string{"campaign": "welcome", "app": "signup"},
+	}
+
+	result, err := SendTransactional(context.TODO(), client, input)
+	assert.Nil(t, err)
+	assert.Equal(t, "ses-1", result.MessageID)
+
+	sent := client.sent[0]
+	assert.Equal(t, "welcome", *sent.Content.Template.TemplateName)
+	assert.Equal(t, `{"name":"user"}`, *sent.Content.Template.TemplateData)
+	assert.Nil(t, sent.Content.Simple)
+	assert.Len(t, sent.EmailTags, 2)
+	assert.Equal(t, "app", *sent.EmailTags[0].Name)
+	assert.Equal(t, "signup", *sent.EmailTags[0].Value)
+
+	item := client.items["ses-1"]
+	assert.Equal(t, "sent#2022-03", item["TypeYearMonth"].(*dynamodbTypes.AttributeValueMemberS).Value)
+	assert.Equal(t, "welcome", item["Template"].(*dynamodbTypes.AttributeValueMemberS).Value)
+	msg, err := email.ParseGetResult(item)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"userID": "42"}, msg.Metadata)
+	assert.Equal(t, map[string]string{"campaign": "welcome", "app": "signup"}, msg.Tags)
+}
+
+func TestSendTransactional_IdempotencyKey(t *testing.T) {
+	oldGetUpdatedTime := getUpdatedTime
+	now := time.Date(2022, 3, 16, 16, 55, 45, 0, time.UTC)
+	getUpdatedTime = func() time.Time { return now }
+	defer func() { getUpdatedTime = oldGetUpdatedTime }()
+
+	client := &mockTransactionalAPI{items: make(map[string]map[string]dynamodbTypes.AttributeValue)}
+	input := TransactionalInput{
+		Input: email.Input{
+			From:    []string{"example@example.com"},
+			To:      []string{"user@example.com"},
+			Subject: "Your receipt",
+			Text:    "Thanks!",
+		},
+		IdempotencyKey: "order-1",
+	}
+
+	// sending fails, so the request can be retried
+	client.sendErr = errors.New("throttled")
+	_, err := SendTransactional(context.TODO(), client, input)
+	assert.NotNil(t, err)
+	assert.Empty(t, client.items)
+	client.sendErr = nil
+
+	result, err := SendTransactional(context.TODO(), client, input)
+	assert.Nil(t, err)
+	assert.Equal(t, "ses-1", result.MessageID)
+
+	// retries are replayed
+	result, err = SendTransactional(context.TODO(), client, input)
+	assert.Nil(t, err)
+	assert.Equal(t, "ses-1", result.MessageID)
+	assert.Len(t, client.sent, 1)
+
+	// the key can't be used by a different request
+	different := input
+	different.Text = "Thank you!"
+	_, err = SendTransactional(context.TODO(), client, different)
+	assert.Equal(t, api.ErrIdempotencyKeyReused, err)
+
+	// the key can't be used while its request is in progress
+	inProgress := input
+	inProgress.IdempotencyKey = "order-2"
+	_, err = claimIdempotencyKey(context.TODO(), client, "order-2", inProgress.fingerprint(), now)
+	assert.Nil(t, err)
+	_, err = SendTransactional(context.TODO(), client, inProgress)
+	assert.Equal(t, api.ErrSendInProgress, err)
+
+	// the key can be used again after it expires
+	now = now.Add(IdempotencyKeyLifetime + time.Second)
+	result, err = SendTransactional(context.TODO(), client, different)
+	assert.Nil(t, err)
+	assert.Equal(t, "ses-2", result.MessageID)
+}
+
+func TestSendTransactional_InvalidInput(t *testing.T) {
+	valid := func() TransactionalInput {
+		return TransactionalInput{
+			Input: email.Input{
+				From:    []string{"example@example.com"},
+				To:      []string{"user@example.com"},
+				Subject: "subject",
+				Text:    "text",
+			},
+		}
+	}
+	tests := []func(input *TransactionalInput){
+		func(input *TransactionalInput) { input.From = nil },
+		func(input *TransactionalInput) { input.To = nil },
+		func(input *TransactionalInput) { input.Subject = "" },
+		func(input *TransactionalInput) { input.Text = "" },
+		func(input *TransactionalInput) { input.Template = &TemplateRef{Name: "welcome"} },
+		func(input *TransactionalInput) {
+			input.Subject, input.Text = "", ""
+			input.Template = &TemplateRef{Name: "welcome", Data: []byte(`["not an object"]`)}
+		},
+		func(input *TransactionalInput) { input.Tags = map[string]string{"name": "with space"} },
+		func(input *TransactionalInput) { input.Tags = map[string]string{"ses:name": "value"} },
+		func(input *TransactionalInput) { input.Metadata = map[string]string{"": "value"} },
+		func(input *TransactionalInput) { input.NoReply = true },
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := &mockTransactionalAPI{items: make(map[string]map[string]dynamodbTypes.AttributeValue)}
+			input := valid()
+			test(&input)
+			_, err := SendTransactional(context.TODO(), client, input)
+			assert.Equal(t, api.ErrInvalidInput, err)
+			assert.Empty(t, client.sent)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package pop3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/history"
+)
+
+// DefaultInboxLimit is the default number of the latest emails in the maildrop
+const DefaultInboxLimit = 500
+
+// InboxAPI defines set of API required to serve the inbox over POP3
+type InboxAPI interface {
+	api.ListEmailsAPI
+	api.UpdateCountedEmailAPI
+}
+
+// Inbox is the Mailbox of inbox emails, where deleted emails are moved to trash.
+// Archived and trashed emails are not in the maildrop.
+type Inbox struct {
+	Client InboxAPI
+	S3     storage.S3GetObjectAPI
+	Limit  int // number of the latest emails in the maildrop, DefaultInboxLimit if 0
+}
+
+// List returns the latest inbox emails
+func (i Inbox) List(ctx context.Context) ([]Message, error) {
+	limit := i.Limit
+	if limit <= 0 {
+		limit = DefaultInboxLimit
+	}
+
+	result, err := email.List(ctx, i.Client, email.ListInput{
+		Type:     email.EmailTypeInbox,
+		PageSize: limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// emails are listed from the newest, while messages are numbered from the oldest
+	messages := make([]Message, len(result.Items))
+	for j, item := range result.Items {
+		message := Message{ID: item.MessageID}
+		if item.Stats != nil {
+			message.Size = item.Stats.RawSize
+		}
+		messages[len(messages)-1-j] = message
+	}
+	return messages, nil
+}
+
+// Retrieve returns the raw email, or a *api.ScanError if it's infected or its scan is pending,
+// since POP3 clients can't override the scan as admins
+func (i Inbox) Retrieve(ctx context.Context, id string) ([]byte, error) {
+	if err := email.CheckScan(ctx, i.Client, id); err != nil {
+		return nil, err
+	}
+	location, err := email.RawLocation(ctx, i.Client, id)
+	if err != nil {
+		return nil, err
+	}
+	return storage.S3.GetEmailRawAt(ctx, i.S3, location)
+}
+
+// Delete moves an email to trash, unless it's already trashed or deleted by another client
+func (i Inbox) Delete(ctx context.Context, id string) error {
+	err := email.Trash(ctx, i.Client, id)
+	if errors.Is(err, &api.InvalidTransitionError{From: email.StateTrashed}) ||
+		errors.Is(err, &api.InvalidTransitionError{From: email.StatePurged}) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := history.Record(ctx, i.Client, id, history.NewEvent(history.EventTrashed, "pop3")); err != nil {
+		fmt.Printf("failed to record history: %v\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,433 @@
+// Package pop3 implements a minimal POP3 server (RFC 1939) exposing the inbox,
+// for legacy devices and scripts that can only fetch emails over POP3.
+package pop3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/api"
+)
+
+// Message is an email in the maildrop
+type Message struct {
+	ID   string // unique and persistent, used as the UIDL
+	Size int64  // size of the raw email in bytes, or 0 if unknown
+}
+
+// Mailbox is the storage behind the POP3 server
+type Mailbox interface {
+	// List returns the messages in the maildrop, from the oldest to the newest
+	List(ctx context.Context) ([]Message, error)
+	// Retrieve returns the raw MIME content of a message
+	Retrieve(ctx context.Context, id string) ([]byte, error)
+	// Delete removes a message from the maildrop, which is called when the session ends with QUIT
+	Delete(ctx context.Context, id string) error
+}
+
+const (
+	// idleTimeout is the inactivity autologout timer, which is at least 10 minutes per RFC 1939
+	idleTimeout = 10 * time.Minute
+	// maxLineLength is the maximum length of a command line, including CRLF
+	maxLineLength = 512
+	// maxAuthFailures is the number of failed logins before the connection is closed
+	maxAuthFailures = 3
+	// commandTimeout bounds the storage requests of a single command
+	commandTimeout = time.Minute
+)
+
+// authFailureDelay slows down password guessing, which is replaced during testing
+var authFailureDelay = 2 * time.Second
+
+// Server serves a single mailbox over POP3
+type Server struct {
+	Username string
+	Password string
+	Mailbox  Mailbox
+}
+
+// Serve accepts connections on l until it's closed
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a single POP3 session, and closes conn afterwards
+func (s *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+
+	sess := &session{
+		server: s,
+		conn:   conn,
+		reader: bufio.NewReaderSize(conn, maxLineLength),
+		writer: bufio.NewWriter(conn),
+	}
+	if err := sess.run(); err != nil && !errors.Is(err, io.EOF) {
+		fmt.Printf("pop3 session from %s ended: %v\n", conn.RemoteAddr(), err)
+	}
+}
+
+// errQuit ends a session after the response is written
+var errQuit = errors.New("quit")
+
+type session struct {
+	server *Server
+	ctx    context.Context // context of the current command
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+
+	username      string
+	authenticated bool
+	authFailures  int
+
+	messages []Message
+	deleted  []bool
+}
+
+func (s *session) run() error {
+	if err := s.reply(true, "POP3 server ready"); err != nil {
+		return err
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		if err := s.conn.SetDeadline(time.Now().Add(idleTimeout)); err != nil {
+			return err
+		}
+		line, err := s.readLine()
+		if err != nil {
+			return err
+		}
+
+		command, args, _ := strings.Cut(line, " ")
+		command = strings.ToUpper(command)
+		var cancel context.CancelFunc
+		s.ctx, cancel = context.WithTimeout(context.Background(), commandTimeout)
+		if s.authenticated {
+			err = s.transaction(command, args)
+		} else {
+			err = s.authorization(command, args)
+		}
+		cancel()
+		if err == nil {
+			err = s.writer.Flush()
+		}
+		if err != nil {
+			if errors.Is(err, errQuit) {
+				return s.writer.Flush()
+			}
+			return err
+		}
+	}
+}
+
+// readLine reads a command line without the line ending
+func (s *session) readLine() (string, error) {
+	line, err := s.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", errors.New("command line too long")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// authorization handles commands before the user is authenticated
+func (s *session) authorization(command, args string) error {
+	switch command {
+	case "CAPA":
+		return s.capabilities()
+	case "USER":
+		if args == "" {
+			return s.reply(false, "username required")
+		}
+		s.username = args
+		return s.reply(true, "send password")
+	case "PASS":
+		if s.username == "" {
+			return s.reply(false, "send USER first")
+		}
+		if !s.server.authenticate(s.username, args) {
+			s.username = ""
+			s.authFailures++
+			time.Sleep(authFailureDelay)
+			if s.authFailures >= maxAuthFailures {
+				_ = s.reply(false, "[AUTH] too many failures")
+				return errQuit
+			}
+			return s.reply(false, "[AUTH] invalid username or password")
+		}
+		return s.login()
+	case "QUIT":
+		_ = s.reply(true, "bye")
+		return errQuit
+	default:
+		return s.reply(false, "unknown command in authorization state")
+	}
+}
+
+// login loads the maildrop, which stays the same for the rest of the session
+func (s *session) login() error {
+	messages, err := s.server.Mailbox.List(s.ctx)
+	if err != nil {
+		fmt.Printf("list messages failed: %v\n", err)
+		_ = s.reply(false, "[SYS/TEMP] unable to open maildrop")
+		return errQuit
+	}
+	s.authenticated = true
+	s.messages = messages
+	s.deleted = make([]bool, len(messages))
+	return s.reply(true, "maildrop has "+strconv.Itoa(len(messages))+" messages")
+}
+
+// transaction handles commands after the user is authenticated
+//
+//gocyclo:ignore
+func (s *session) transaction(command, args string) error {
+	switch command {
+	case "CAPA":
+		return s.capabilities()
+	case "NOOP":
+		return s.reply(true, "")
+	case "STAT":
+		count, size := 0, int64(0)
+		for i := range s.messages {
+			if s.deleted[i] {
+				continue
+			}
+			msgSize, err := s.size(i)
+			if err != nil {
+				return s.replyError(err)
+			}
+			count++
+			size += msgSize
+		}
+		return s.reply(true, strconv.Itoa(count)+" "+strconv.FormatInt(size, 10))
+	case "LIST", "UIDL":
+		if args != "" {
+			i, ok := s.message(args)
+			if !ok {
+				return s.reply(false, "no such message")
+			}
+			value, err := s.listValue(command, i)
+			if err != nil {
+				return s.replyError(err)
+			}
+			return s.reply(true, args+" "+value)
+		}
+
+		lines := make([]string, 0, len(s.messages))
+		for i := range s.messages {
+			if s.deleted[i] {
+				continue
+			}
+			value, err := s.listValue(command, i)
+			if err != nil {
+				return s.replyError(err)
+			}
+			lines = append(lines, strconv.Itoa(i+1)+" "+value)
+		}
+		if err := s.reply(true, ""); err != nil {
+			return err
+		}
+		return s.multiline([]byte(strings.Join(lines, "\r\n")))
+	case "RETR":
+		i, ok := s.message(args)
+		if !ok {
+			return s.reply(false, "no such message")
+		}
+		raw, err := s.server.Mailbox.Retrieve(s.ctx, s.messages[i].ID)
+		if err != nil {
+			return s.replyError(err)
+		}
+		if err = s.reply(true, strconv.Itoa(len(raw))+" octets"); err != nil {
+			return err
+		}
+		return s.multiline(raw)
+	case "TOP":
+		number, lines, _ := strings.Cut(args, " ")
+		i, ok := s.message(number)
+		n, err := strconv.Atoi(lines)
+		if !ok || err != nil || n < 0 {
+			return s.reply(false, "usage: TOP msg n")
+		}
+		raw, err := s.server.Mailbox.Retrieve(s.ctx, s.messages[i].ID)
+		if err != nil {
+			return s.replyError(err)
+		}
+		if err = s.reply(true, ""); err != nil {
+			return err
+		}
+		return s.multiline(top(raw, n))
+	case "DELE":
+		i, ok := s.message(args)
+		if !ok {
+			return s.reply(false, "no such message")
+		}
+		s.deleted[i] = true
+		return s.reply(true, "message "+args+" deleted")
+	case "RSET":
+		s.deleted = make([]bool, len(s.messages))
+		return s.reply(true, "maildrop has "+strconv.Itoa(len(s.messages))+" messages")
+	case "QUIT":
+		return s.update()
+	default:
+		return s.reply(false, "unknown command")
+	}
+}
+
+// update removes messages marked as deleted, when the session ends with QUIT
+func (s *session) update() error {
+	failed := 0
+	for i, message := range s.messages {
+		if !s.deleted[i] {
+			continue
+		}
+		if err := s.server.Mailbox.Delete(s.ctx, message.ID); err != nil {
+			fmt.Printf("delete message %s failed: %v\n", message.ID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		_ = s.reply(false, "some deleted messages not removed")
+		return errQuit
+	}
+	_ = s.reply(true, "bye")
+	return errQuit
+}
+
+// message returns the index of a message by its number, if it exists and is not deleted
+func (s *session) message(number string) (int, bool) {
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 || n > len(s.messages) || s.deleted[n-1] {
+		return 0, false
+	}
+	return n - 1, true
+}
+
+// listValue returns the size for LIST, or the unique ID for UIDL
+func (s *session) listValue(command string, i int) (string, error) {
+	if command == "UIDL" {
+		return s.messages[i].ID, nil
+	}
+	size, err := s.size(i)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(size, 10), nil
+}
+
+// size returns the size of a message, which is retrieved if it's unknown
+func (s *session) size(i int) (int64, error) {
+	if s.messages[i].Size == 0 {
+		raw, err := s.server.Mailbox.Retrieve(s.ctx, s.messages[i].ID)
+		if errors.Is(err, &api.ScanError{}) {
+			// held messages can't be retrieved, so their size is unknown
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.messages[i].Size = int64(len(raw))
+	}
+	return s.messages[i].Size, nil
+}
+
+func (s *session) capabilities() error {
+	if err := s.reply(true, "capability list follows"); err != nil {
+		return err
+	}
+	return s.multiline([]byte("USER\r\nTOP\r\nUIDL\r\nRESP-CODES\r\nAUTH-RESP-CODE\r\nIMPLEMENTATION mailbox"))
+}
+
+func (s *session) reply(ok bool, text string) error {
+	status := "+OK"
+	if !ok {
+		status = "-ERR"
+	}
+	if text != "" {
+		status += " " + text
+	}
+	_, err := s.writer.WriteString(status + "\r\n")
+	return err
+}
+
+func (s *session) replyError(err error) error {
+	fmt.Printf("pop3 command failed: %v\n", err)
+	if errors.Is(err, &api.ScanError{}) {
+		// not temporary, so that clients don't retry until the scan is reviewed
+		return s.reply(false, "message is held, "+err.Error())
+	}
+	return s.reply(false, "[SYS/TEMP] unable to read message")
+}
+
+// multiline writes a multi-line response, with lines ending in CRLF and
+// lines starting with the termination octet byte-stuffed
+func (s *session) multiline(data []byte) error {
+	for len(data) > 0 {
+		line, rest, _ := bytes.Cut(data, []byte("\n"))
+		data = rest
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if bytes.HasPrefix(line, []byte(".")) {
+			if err := s.writer.WriteByte('.'); err != nil {
+				return err
+			}
+		}
+		if _, err := s.writer.Write(line); err != nil {
+			return err
+		}
+		if _, err := s.writer.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	_, err := s.writer.WriteString(".\r\n")
+	return err
+}
+
+// authenticate compares the credentials in constant time
+func (s *Server) authenticate(username, password string) bool {
+	usernameOK := subtle.ConstantTimeCompare([]byte(username), []byte(s.Username)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.Password)) == 1
+	return usernameOK && passwordOK && s.Password != ""
+}
+
+// top returns the headers of a raw email and the first n lines of its body
+func top(raw []byte, n int) []byte {
+	end := len(raw)
+	if i := bytes.Index(raw, []byte("\n\r\n")); i != -1 {
+		end = i + 3
+	}
+	if i := bytes.Index(raw, []byte("\n\n")); i != -1 && i+2 < end {
+		end = i + 2
+	}
+
+	for ; n > 0 && end < len(raw); n-- {
+		i := bytes.IndexByte(raw[end:], '\n')
+		if i == -1 {
+			return raw
+		}
+		end += i + 1
+	}
+	return raw[:end]
+}
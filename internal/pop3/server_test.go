@@ -0,0 +1,241 @@
+package pop3
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockMailbox struct {
+	messages map[string]string // ID -> raw
+	held     map[string]string // ID -> scan state of held messages
+	order    []string
+	deleted  []string
+	listErr  error
+}
+
+func (m *mockMailbox) List(_ context.Context) ([]Message, error) {
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
+	var messages []Message
+	for _, id := range m.order {
+		messages = append(messages, Message{ID: id})
+	}
+	return messages, nil
+}
+
+func (m *mockMailbox) Retrieve(_ context.Context, id string) ([]byte, error) {
+	if state, ok := m.held[id]; ok {
+		return nil, &api.ScanError{State: state}
+	}
+	return []byte(m.messages[id]), nil
+}
+
+func (m *mockMailbox) Delete(_ context.Context, id string) error {
+	m.deleted = append(m.deleted, id)
+	return nil
+}
+
+// client is a POP3 client for testing
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	done   chan struct{}
+}
+
+func newClient(t *testing.T, mailbox Mailbox) *client {
+	authFailureDelay = 0
+
+	serverConn, clientConn := net.Pipe()
+	server := &Server{Username: "user", Password: "secret", Mailbox: mailbox}
+	done := make(chan struct{})
+	go func() {
+		server.ServeConn(serverConn)
+		close(done)
+	}()
+
+	c := &client{t: t, conn: clientConn, reader: bufio.NewReader(clientConn), done: done}
+	assert.Equal(t, "+OK POP3 server ready", c.line())
+	return c
+}
+
+func (c *client) line() string {
+	line, err := c.reader.ReadString('\n')
+	assert.Nil(c.t, err)
+	assert.True(c.t, strings.HasSuffix(line, "\r\n"))
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+// cmd sends a command and returns the status line
+func (c *client) cmd(command string) string {
+	_, err := c.conn.Write([]byte(command + "\r\n"))
+	assert.Nil(c.t, err)
+	return c.line()
+}
+
+// multiline reads the lines of a multi-line response, without the termination line
+func (c *client) multiline() []string {
+	var lines []string
+	for {
+		line := c.line()
+		if line == "." {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func (c *client) login() {
+	assert.Equal(c.t, "+OK send password", c.cmd("USER user"))
+	assert.True(c.t, strings.HasPrefix(c.cmd("PASS secret"), "+OK maildrop has"))
+}
+
+func (c *client) quit() {
+	c.cmd("QUIT")
+	<-c.done
+	c.conn.Close()
+}
+
+func TestServer(t *testing.T) {
+	mailbox := &mockMailbox{
+		messages: map[string]string{
+			"first":  "Subject: First\r\n\r\nHello\r\n.hidden\r\n",
+			"second": "Subject: Second\n\nline 1\nline 2\nline 3\n",
+		},
+		order: []string{"first", "second"},
+	}
+	c := newClient(t, mailbox)
+	c.login()
+
+	assert.Equal(t, "+OK 2 72", c.cmd("STAT"))
+
+	assert.Equal(t, "+OK", c.cmd("LIST"))
+	assert.Equal(t, []string{"1 34", "2 38"}, c.multiline())
+	assert.Equal(t, "+OK 2 38", c.cmd("LIST 2"))
+	assert.Equal(t, "-ERR no such message", c.cmd("LIST 3"))
+
+	assert.Equal(t, "+OK", c.cmd("UIDL"))
+	assert.Equal(t, []string{"1 first", "2 second"}, c.multiline())
+
+	assert.Equal(t, "+OK 34 octets", c.cmd("RETR 1"))
+	assert.Equal(t, []string{"Subject: First", "", "Hello", "..hidden"}, c.multiline())
+
+	assert.Equal(t, "+OK", c.cmd("TOP 2 1"))
+	assert.Equal(t, []string{"Subject: Second", "", "line 1"}, c.multiline())
+
+	assert.Equal(t, "+OK message 1 deleted", c.cmd("DELE 1"))
+	assert.Equal(t, "-ERR no such message", c.cmd("RETR 1"))
+	assert.Equal(t, "+OK 1 38", c.cmd("STAT"))
+	assert.Equal(t, "+OK maildrop has 2 messages", c.cmd("RSET"))
+	assert.Equal(t, "+OK message 2 deleted", c.cmd("DELE 2"))
+
+	assert.Equal(t, "+OK", c.cmd("NOOP"))
+	assert.Equal(t, "-ERR unknown command", c.cmd("APOP user digest"))
+
+	c.quit()
+	assert.Equal(t, []string{"second"}, mailbox.deleted)
+}
+
+func TestServer_Held(t *testing.T) {
+	mailbox := &mockMailbox{
+		messages: map[string]string{
+			"first": "Subject: First\r\n\r\nHello\r\n",
+		},
+		held:  map[string]string{"second": "infected"},
+		order: []string{"first", "second"},
+	}
+	c := newClient(t, mailbox)
+	c.login()
+
+	// held messages are listed without their size
+	assert.Equal(t, "+OK 2 25", c.cmd("STAT"))
+	assert.Equal(t, "+OK 2 0", c.cmd("LIST 2"))
+	assert.Equal(t, "-ERR message is held, attachment scan is infected", c.cmd("RETR 2"))
+	assert.Equal(t, "-ERR message is held, attachment scan is infected", c.cmd("TOP 2 0"))
+	assert.Equal(t, "+OK 25 octets", c.cmd("RETR 1"))
+	c.multiline()
+	c.quit()
+}
+
+func TestServer_Authorization(t *testing.T) {
+	tests := []struct {
+		commands []string
+		expected []string
+	}{
+		{
+			commands: []string{"STAT", "PASS secret"},
+			expected: []string{"-ERR unknown command in authorization state", "-ERR send USER first"},
+		},
+		{
+			commands: []string{"USER user", "PASS wrong", "PASS secret"},
+			expected: []string{"+OK send password", "-ERR [AUTH] invalid username or password", "-ERR send USER first"},
+		},
+		{
+			commands: []string{"USER other", "PASS secret"},
+			expected: []string{"+OK send password", "-ERR [AUTH] invalid username or password"},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			c := newClient(t, &mockMailbox{})
+			for j, command := range test.commands {
+				assert.Equal(t, test.expected[j], c.cmd(command))
+			}
+			c.quit()
+		})
+	}
+}
+
+func TestServer_TooManyFailures(t *testing.T) {
+	c := newClient(t, &mockMailbox{})
+	for i := 1; i < maxAuthFailures; i++ {
+		c.cmd("USER user")
+		assert.Equal(t, "-ERR [AUTH] invalid username or password", c.cmd("PASS wrong"))
+	}
+	c.cmd("USER user")
+	assert.Equal(t, "-ERR [AUTH] too many failures", c.cmd("PASS wrong"))
+	<-c.done
+}
+
+func TestServer_ListFailed(t *testing.T) {
+	c := newClient(t, &mockMailbox{listErr: errors.New("error")})
+	c.cmd("USER user")
+	assert.Equal(t, "-ERR [SYS/TEMP] unable to open maildrop", c.cmd("PASS secret"))
+	<-c.done
+}
+
+func TestServer_EmptyPassword(t *testing.T) {
+	server := &Server{Username: "user"}
+	assert.False(t, server.authenticate("user", ""))
+}
+
+func TestTop(t *testing.T) {
+	tests := []struct {
+		raw      string
+		n        int
+		expected string
+	}{
+		{"A: 1\r\nB: 2\r\n\r\nbody 1\r\nbody 2\r\n", 0, "A: 1\r\nB: 2\r\n\r\n"},
+		{"A: 1\r\nB: 2\r\n\r\nbody 1\r\nbody 2\r\n", 1, "A: 1\r\nB: 2\r\n\r\nbody 1\r\n"},
+		{"A: 1\r\nB: 2\r\n\r\nbody 1\r\nbody 2\r\n", 5, "A: 1\r\nB: 2\r\n\r\nbody 1\r\nbody 2\r\n"},
+		{"A: 1\n\nbody 1\nbody 2", 2, "A: 1\n\nbody 1\nbody 2"},
+		{"A: 1\n\nbody 1\nbody 2", 1, "A: 1\n\nbody 1\n"},
+		{"A: 1\r\n", 1, "A: 1\r\n"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, string(top([]byte(test.raw), test.n)))
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Package push sends new email notifications to mobile apps through Firebase Cloud Messaging,
+// which delivers to Android devices, and to iOS devices through APNs,
+// and to web apps through the Web Push protocol.
+package push
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+const (
+	// devicesID is the MessageID of the item storing the registered devices in the email table
+	devicesID = "push#devices"
+
+	// MaxDevices is the maximum number of registered devices
+	MaxDevices = 20
+
+	maxTokenLength = 4096
+)
+
+var deviceRegistry = registry{
+	itemID:    devicesID,
+	attribute: "Devices",
+	max:       MaxDevices,
+	notFound:  api.ErrDeviceNotFound,
+	full:      api.ErrTooManyDevices,
+}
+
+// Platforms of registered devices
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+)
+
+var getCurrentTime = func() time.Time {
+	return time.Now().UTC()
+}
+
+// Enabled returns true if push notifications are enabled, which requires the FCM service account
+func Enabled() bool {
+	return env.PushFCMSecret != ""
+}
+
+// Device is a mobile device registered for push notifications
+type Device struct {
+	ID             string `json:"id"`
+	Platform       string `json:"platform"`
+	Token          string `json:"-"` // FCM registration token
+	TimeRegistered string `json:"timeRegistered"`
+}
+
+// RegisterInput is the device registration sent by a mobile app
+type RegisterInput struct {
+	Token    string `json:"token"` // FCM registration token
+	Platform string `json:"platform"`
+}
+
+// Register registers a device for push notifications, or refreshes the registration of a known token.
+// api.ErrTooManyDevices is returned if MaxDevices are already registered.
+func Register(ctx context.Context, client api.UpdateItemAPI, input RegisterInput) (*Device, error) {
+	token := strings.TrimSpace(input.Token)
+	if token == "" || len(token) > maxTokenLength {
+		return nil, api.ErrInvalidInput
+	}
+	if input.Platform != PlatformIOS && input.Platform != PlatformAndroid {
+		return nil, api.ErrInvalidInput
+	}
+
+	device := &Device{
+		ID:             entryID(token),
+		Platform:       input.Platform,
+		Token:          token,
+		TimeRegistered: getCurrentTime().Format(time.RFC3339),
+	}
+	err := deviceRegistry.put(ctx, client, device.ID, map[string]types.AttributeValue{
+		"Platform":       &types.AttributeValueMemberS{Value: device.Platform},
+		"Token":          &types.AttributeValueMemberS{Value: device.Token},
+		"TimeRegistered": &types.AttributeValueMemberS{Value: device.TimeRegistered},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// List returns the registered devices, from the earliest registered
+func List(ctx context.Context, client api.GetItemAPI) ([]Device, error) {
+	entries, err := deviceRegistry.entries(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Device, 0, len(entries))
+	for id, entry := range entries {
+		result = append(result, Device{
+			ID:             id,
+			Platform:       stringValue(entry, "Platform"),
+			Token:          stringValue(entry, "Token"),
+			TimeRegistered: stringValue(entry, "TimeRegistered"),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TimeRegistered != result[j].TimeRegistered {
+			return result[i].TimeRegistered < result[j].TimeRegistered
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// Unregister removes a registered device, api.ErrDeviceNotFound is returned if it's not registered
+func Unregister(ctx context.Context, client api.UpdateItemAPI, id string) error {
+	return deviceRegistry.remove(ctx, client, id)
+}
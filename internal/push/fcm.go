@@ -0,0 +1,264 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/util/egress"
+)
+
+// endpoints, which are replaced during testing
+var (
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+	fcmURL         = "https://fcm.googleapis.com/v1/projects/"
+)
+
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// ErrUnregistered is returned when a registration token is no longer valid, e.g. the app is uninstalled
+var ErrUnregistered = errors.New("registration token is unregistered")
+
+// ServiceAccount is a Firebase service account key, as downloaded from the Firebase console and stored as a JSON secret
+type ServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"` // PEM encoded PKCS #8 RSA key
+}
+
+// Message is a notification sent to a device
+type Message struct {
+	Title       string
+	Body        string
+	CollapseKey string            // a pending or displayed notification with the same key is replaced
+	Badge       *int64            // unread count shown on the app icon, unchanged if nil
+	Data        map[string]string // custom data handled by the app
+}
+
+// FCM sends messages through the Firebase Cloud Messaging HTTP v1 API
+type FCM struct {
+	account ServiceAccount
+	key     *rsa.PrivateKey
+	client  *http.Client
+
+	accessToken string
+	expiry      time.Time
+}
+
+// NewFCM returns an FCM client that authenticates as the service account
+func NewFCM(account ServiceAccount) (*FCM, error) {
+	if account.ProjectID == "" || account.ClientEmail == "" {
+		return nil, errors.New("invalid service account")
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid service account private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service account private key is not an RSA key")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	egress.FromEnv().Apply(client)
+	return &FCM{
+		account: account,
+		key:     key,
+		client:  client,
+	}, nil
+}
+
+// Send sends a message to the device with the registration token.
+// ErrUnregistered is returned if the token is no longer valid.
+func (f *FCM) Send(ctx context.Context, token string, msg Message) error {
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"message": fcmMessage(token, msg),
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := fcmURL + url.PathEscape(f.account.ProjectID) + "/messages:send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := f.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if res.StatusCode == http.StatusNotFound || fcmErrorCode(data) == "UNREGISTERED" {
+		return ErrUnregistered
+	}
+	return fmt.Errorf("fcm request failed: %s", strings.TrimSpace(res.Status+" "+string(data)))
+}
+
+// fcmMessage returns the FCM message of msg, with the collapse key and badge set for both Android and iOS
+func fcmMessage(token string, msg Message) map[string]interface{} {
+	message := map[string]interface{}{
+		"token": token,
+		"notification": map[string]string{
+			"title": msg.Title,
+			"body":  msg.Body,
+		},
+	}
+	if len(msg.Data) > 0 {
+		message["data"] = msg.Data
+	}
+
+	android := map[string]interface{}{}
+	androidNotification := map[string]interface{}{}
+	apnsHeaders := map[string]string{}
+	aps := map[string]interface{}{}
+	if msg.CollapseKey != "" {
+		android["collapse_key"] = msg.CollapseKey
+		androidNotification["tag"] = msg.CollapseKey
+		apnsHeaders["apns-collapse-id"] = msg.CollapseKey
+	}
+	if msg.Badge != nil {
+		androidNotification["notification_count"] = *msg.Badge
+		aps["badge"] = *msg.Badge
+	}
+	if len(androidNotification) > 0 {
+		android["notification"] = androidNotification
+	}
+	if len(android) > 0 {
+		message["android"] = android
+	}
+	if len(apnsHeaders) > 0 || len(aps) > 0 {
+		apns := map[string]interface{}{}
+		if len(apnsHeaders) > 0 {
+			apns["headers"] = apnsHeaders
+		}
+		if len(aps) > 0 {
+			apns["payload"] = map[string]interface{}{"aps": aps}
+		}
+		message["apns"] = apns
+	}
+	return message
+}
+
+// fcmErrorCode returns the FCM error code of an error response, e.g. UNREGISTERED
+func fcmErrorCode(data []byte) string {
+	var body struct {
+		Error struct {
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return ""
+	}
+	for _, detail := range body.Error.Details {
+		if detail.ErrorCode != "" {
+			return detail.ErrorCode
+		}
+	}
+	return ""
+}
+
+// token returns an access token, which is requested again if it's about to expire
+func (f *FCM) token(ctx context.Context) (string, error) {
+	if f.accessToken != "" && time.Until(f.expiry) > time.Minute {
+		return f.accessToken, nil
+	}
+
+	assertion, err := f.assertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, googleTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := f.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return "", fmt.Errorf("token request failed: %s", strings.TrimSpace(res.Status+" "+string(data)))
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"` // in seconds
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	f.accessToken = result.AccessToken
+	f.expiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	return f.accessToken, nil
+}
+
+// assertion returns the JWT signed by the service account that's exchanged for an access token
+func (f *FCM) assertion(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   f.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   googleTokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// do sends a request after checking it against the egress policy
+func (f *FCM) do(req *http.Request) (*http.Response, error) {
+	if err := egress.FromEnv().CheckURL(req.URL); err != nil {
+		return nil, err
+	}
+	return f.client.Do(req)
+}
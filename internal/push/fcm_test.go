@@ -0,0 +1,107 @@
+package push
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func testServiceAccount(t *testing.T) ServiceAccount {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	return ServiceAccount{
+		ProjectID:   "mailbox-app",
+		ClientEmail: "push@mailbox-app.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}
+}
+
+func TestNewFCM_Invalid(t *testing.T) {
+	_, err := NewFCM(ServiceAccount{})
+	assert.NotNil(t, err)
+	_, err = NewFCM(ServiceAccount{ProjectID: "p", ClientEmail: "e", PrivateKey: "invalid"})
+	assert.NotNil(t, err)
+}
+
+func TestFCM_Send(t *testing.T) {
+	env.EgressAllowPrivate = "true" // the test server listens on loopback
+	defer func() { env.EgressAllowPrivate = "" }()
+
+	tokenRequests := 0
+	var sent []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/token":
+			tokenRequests++
+			assert.Nil(t, req.ParseForm())
+			assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", req.PostForm.Get("grant_type"))
+			assert.Len(t, strings.Split(req.PostForm.Get("assertion"), "."), 3)
+			_, err := rw.Write([]byte(`{"access_token":"access","expires_in":3600}`))
+			assert.Nil(t, err)
+		case "/v1/projects/mailbox-app/messages:send":
+			assert.Equal(t, "Bearer access", req.Header.Get("Authorization"))
+			var body map[string]map[string]interface{}
+			assert.Nil(t, json.NewDecoder(req.Body).Decode(&body))
+			sent = append(sent, body["message"])
+			if body["message"]["token"] == "stale" {
+				rw.WriteHeader(http.StatusNotFound)
+				_, err := rw.Write([]byte(`{"error":{"code":404,"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+				assert.Nil(t, err)
+				return
+			}
+			_, err := rw.Write([]byte(`{"name":"projects/mailbox-app/messages/1"}`))
+			assert.Nil(t, err)
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	tokenURL, sendURL := googleTokenURL, fcmURL
+	googleTokenURL, fcmURL = server.URL+"/token", server.URL+"/v1/projects/"
+	defer func() { googleTokenURL, fcmURL = tokenURL, sendURL }()
+
+	f, err := NewFCM(testServiceAccount(t))
+	assert.Nil(t, err)
+
+	badge := int64(3)
+	err = f.Send(context.TODO(), "device-token", Message{
+		Title:       "Alice",
+		Body:        "Hello",
+		CollapseKey: collapseKey,
+		Badge:       &badge,
+		Data:        map[string]string{"messageID": "1"},
+	})
+	assert.Nil(t, err)
+	err = f.Send(context.TODO(), "stale", Message{Title: "Alice", Body: "Hello"})
+	assert.Equal(t, ErrUnregistered, err)
+
+	assert.Equal(t, 1, tokenRequests) // the access token is reused
+	assert.Len(t, sent, 2)
+	assert.Equal(t, map[string]interface{}{
+		"token":        "device-token",
+		"notification": map[string]interface{}{"title": "Alice", "body": "Hello"},
+		"data":         map[string]interface{}{"messageID": "1"},
+		"android": map[string]interface{}{
+			"collapse_key": collapseKey,
+			"notification": map[string]interface{}{"tag": collapseKey, "notification_count": float64(3)},
+		},
+		"apns": map[string]interface{}{
+			"headers": map[string]interface{}{"apns-collapse-id": collapseKey},
+			"payload": map[string]interface{}{"aps": map[string]interface{}{"badge": float64(3)}},
+		},
+	}, sent[0])
+	assert.NotContains(t, sent[1], "android")
+	assert.NotContains(t, sent[1], "apns")
+}
@@ -0,0 +1,277 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/counter"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/util/secrets"
+)
+
+// collapseKey is shared by new email notifications, so that a device shows the latest one with the unread count,
+// instead of one notification per email
+const collapseKey = "new-email"
+
+// maxTextLength is the maximum number of characters of a notification title or body
+const maxTextLength = 200
+
+// NotifierAPI defines set of API required to send push notifications
+type NotifierAPI interface {
+	api.GetItemAPI    // to get the devices, received emails and the unread count
+	api.UpdateItemAPI // to remove unregistered devices
+}
+
+// sender sends a message to a registration token, which is FCM except in tests
+type sender interface {
+	Send(ctx context.Context, token string, msg Message) error
+}
+
+// Notifier sends push notifications of received emails to the registered mobile devices, it implements hook.Notifier
+type Notifier struct {
+	client NotifierAPI
+	sender sender // created from the service account on first use
+}
+
+var _ hook.Notifier = (*Notifier)(nil)
+
+// NewNotifier returns a Notifier
+func NewNotifier(client NotifierAPI) *Notifier {
+	return &Notifier{client: client}
+}
+
+// Enabled returns true if push notifications are enabled
+func (n *Notifier) Enabled() bool {
+	return Enabled()
+}
+
+// Notify sends a push notification of a hook to the registered devices.
+// Only received emails are notified, individually or in a batch, others are ignored.
+// Devices whose registration tokens are no longer valid are unregistered.
+func (n *Notifier) Notify(ctx context.Context, data *hook.Hook) error {
+	msg, ok, err := newMessage(ctx, n.client, data)
+	if err != nil || !ok {
+		return err
+	}
+
+	devices, err := List(ctx, n.client)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+	if n.sender == nil {
+		n.sender, err = newFCMFromSecret(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for _, device := range devices {
+		err := n.sender.Send(ctx, device.Token, *msg)
+		if errors.Is(err, ErrUnregistered) {
+			fmt.Printf("unregistering device %s, %v\n", device.ID, err)
+			if err := Unregister(ctx, n.client, device.ID); err != nil && !errors.Is(err, api.ErrDeviceNotFound) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify device %s: %w", device.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newMessage returns the push notification of a hook, ok is false if the hook isn't notified
+func newMessage(ctx context.Context, client api.GetItemAPI, data *hook.Hook) (msg *Message, ok bool, err error) {
+	switch {
+	case data.Event == hook.EventEmail && data.Action == hook.ActionReceived:
+		result, err := email.Get(ctx, client, data.Email.ID)
+		if err != nil {
+			return nil, false, err
+		}
+		if result.ArchivedTime != "" {
+			// filed away by rules, e.g. into a label
+			return nil, false, nil
+		}
+		subject := result.Subject
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		msg = &Message{
+			Title: truncate(senderName(result.From)),
+			Body:  truncate(subject),
+			Data: map[string]string{
+				"event":     data.Event,
+				"action":    data.Action,
+				"messageID": data.Email.ID,
+			},
+		}
+	case data.Event == hook.EventBatch:
+		var received []hook.Hook
+		for _, h := range data.Batch {
+			if h.Event == hook.EventEmail && h.Action == hook.ActionReceived {
+				received = append(received, h)
+			}
+		}
+		if len(received) == 0 {
+			return nil, false, nil
+		}
+		if len(received) == 1 {
+			return newMessage(ctx, client, &received[0])
+		}
+		msg = &Message{
+			Title: strconv.Itoa(len(received)) + " new emails",
+			Body:  "Received during quiet hours",
+			Data: map[string]string{
+				"event":  data.Event,
+				"action": data.Action,
+				"count":  strconv.Itoa(len(received)),
+			},
+		}
+	default:
+		return nil, false, nil
+	}
+
+	msg.CollapseKey = collapseKey
+	if counter.Enabled() {
+		inbox, err := counter.Get(ctx, client, counter.FolderInbox)
+		if err != nil {
+			// the badge is left unchanged
+			fmt.Printf("failed to get unread count, %v\n", err)
+		} else {
+			msg.Badge = &inbox.Unread
+		}
+	}
+	return msg, true, nil
+}
+
+// truncate shortens a notification text, since push services limit the size of messages
+func truncate(s string) string {
+	runes := []rune(s)
+	if len(runes) <= maxTextLength {
+		return s
+	}
+	return string(runes[:maxTextLength-1]) + "…"
+}
+
+// senderName returns the display name of the first sender, or its address if there's no name
+func senderName(from []string) string {
+	if len(from) == 0 {
+		return "New email"
+	}
+	address, err := mail.ParseAddress(from[0])
+	if err != nil {
+		return from[0]
+	}
+	if address.Name != "" {
+		return address.Name
+	}
+	return address.Address
+}
+
+// newFCMFromSecret returns an FCM client of the service account in the PUSH_FCM_SECRET secret
+func newFCMFromSecret(ctx context.Context) (*FCM, error) {
+	secret, err := secrets.Get(ctx, env.PushFCMSecret)
+	if err != nil {
+		return nil, err
+	}
+	var account ServiceAccount
+	if err := json.Unmarshal([]byte(secret), &account); err != nil {
+		return nil, fmt.Errorf("invalid service account secret: %w", err)
+	}
+	return NewFCM(account)
+}
+
+// webSender sends a payload to a browser subscription, which is WebPush except in tests
+type webSender interface {
+	Send(ctx context.Context, sub Subscription, payload []byte, topic string) error
+}
+
+// WebNotifier sends Web Push notifications of received emails to the browser subscriptions, it implements hook.Notifier
+type WebNotifier struct {
+	client NotifierAPI
+	sender webSender // created from the VAPID key on first use
+}
+
+var _ hook.Notifier = (*WebNotifier)(nil)
+
+// NewWebNotifier returns a WebNotifier
+func NewWebNotifier(client NotifierAPI) *WebNotifier {
+	return &WebNotifier{client: client}
+}
+
+// Enabled returns true if Web Push notifications are enabled
+func (n *WebNotifier) Enabled() bool {
+	return WebEnabled()
+}
+
+// WebPayload is the JSON payload of Web Push notifications, which the service worker of the web app shows
+type WebPayload struct {
+	Title  string            `json:"title"`
+	Body   string            `json:"body"`
+	Tag    string            `json:"tag"`              // notifications with the same tag replace each other
+	Unread *int64            `json:"unread,omitempty"` // number of unread emails, e.g. for navigator.setAppBadge
+	Data   map[string]string `json:"data"`
+}
+
+// Notify sends a Web Push notification of a hook to the browser subscriptions, like Notifier.Notify.
+// Expired subscriptions are removed.
+func (n *WebNotifier) Notify(ctx context.Context, data *hook.Hook) error {
+	msg, ok, err := newMessage(ctx, n.client, data)
+	if err != nil || !ok {
+		return err
+	}
+
+	subs, err := ListSubscriptions(ctx, n.client)
+	if err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	if n.sender == nil {
+		vapid, err := ParseVAPID(env.PushVAPIDPrivateKey, env.PushVAPIDSubject)
+		if err != nil {
+			return err
+		}
+		n.sender = NewWebPush(vapid)
+	}
+
+	payload, err := json.Marshal(WebPayload{
+		Title:  msg.Title,
+		Body:   msg.Body,
+		Tag:    msg.CollapseKey,
+		Unread: msg.Badge,
+		Data:   msg.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sub := range subs {
+		err := n.sender.Send(ctx, sub, payload, msg.CollapseKey)
+		if errors.Is(err, ErrUnregistered) {
+			fmt.Printf("removing subscription %s, %v\n", sub.ID, err)
+			if err := Unsubscribe(ctx, n.client, sub.ID); err != nil && !errors.Is(err, api.ErrSubscriptionNotFound) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify subscription %s: %w", sub.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,296 @@
+package push
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockNotifierAPI stores the registries, emails and counters like DynamoDB
+type mockNotifierAPI struct {
+	registries map[string]map[string]types.AttributeValue // attribute -> entries, nil before the first entry
+	emails     map[string]map[string]types.AttributeValue
+	counters   map[string]map[string]types.AttributeValue
+}
+
+func (m *mockNotifierAPI) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if folder, ok := params.Key["Folder"].(*types.AttributeValueMemberS); ok {
+		return &dynamodb.GetItemOutput{Item: m.counters[folder.Value]}, nil
+	}
+	id := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+	for _, r := range []registry{deviceRegistry, subscriptionRegistry} {
+		if id != r.itemID {
+			continue
+		}
+		if m.registries[r.attribute] == nil {
+			return &dynamodb.GetItemOutput{}, nil
+		}
+		return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+			r.attribute: &types.AttributeValueMemberM{Value: m.registries[r.attribute]},
+		}}, nil
+	}
+	return &dynamodb.GetItemOutput{Item: m.emails[id]}, nil
+}
+
+func (m *mockNotifierAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if m.registries == nil {
+		m.registries = make(map[string]map[string]types.AttributeValue)
+	}
+	conditionFailed := &types.ConditionalCheckFailedException{}
+	fields := strings.Fields(*params.UpdateExpression)
+	id := params.ExpressionAttributeNames["#id"]
+	switch {
+	case fields[0] == "SET" && fields[2] == "=" && strings.HasPrefix(fields[3], "if_not_exists"):
+		if m.registries[fields[1]] == nil {
+			m.registries[fields[1]] = map[string]types.AttributeValue{}
+		}
+	case fields[0] == "SET":
+		entries := m.registries[strings.TrimSuffix(fields[1], ".#id")]
+		max, _ := strconv.Atoi(params.ExpressionAttributeValues[":max"].(*types.AttributeValueMemberN).Value)
+		if _, ok := entries[id]; !ok && len(entries) >= max {
+			return nil, conditionFailed
+		}
+		entries[id] = params.ExpressionAttributeValues[":entry"]
+	case fields[0] == "REMOVE":
+		entries := m.registries[strings.TrimSuffix(fields[1], ".#id")]
+		if _, ok := entries[id]; !ok {
+			return nil, conditionFailed
+		}
+		delete(entries, id)
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+type mockSender struct {
+	sent         map[string][]Message // token -> messages
+	unregistered map[string]bool
+}
+
+func (m *mockSender) Send(_ context.Context, token string, msg Message) error {
+	if m.unregistered[token] {
+		return ErrUnregistered
+	}
+	m.sent[token] = append(m.sent[token], msg)
+	return nil
+}
+
+func TestDevices(t *testing.T) {
+	getCurrentTime = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { getCurrentTime = func() time.Time { return time.Now().UTC() } }()
+	client := &mockNotifierAPI{}
+	ctx := context.TODO()
+
+	devices, err := List(ctx, client)
+	assert.Nil(t, err)
+	assert.Equal(t, []Device{}, devices)
+
+	_, err = Register(ctx, client, RegisterInput{Token: "token", Platform: "windows"})
+	assert.Equal(t, api.ErrInvalidInput, err)
+	_, err = Register(ctx, client, RegisterInput{Token: " ", Platform: PlatformIOS})
+	assert.Equal(t, api.ErrInvalidInput, err)
+
+	device, err := Register(ctx, client, RegisterInput{Token: "ios-token", Platform: PlatformIOS})
+	assert.Nil(t, err)
+	assert.Len(t, device.ID, 16)
+	again, err := Register(ctx, client, RegisterInput{Token: "ios-token", Platform: PlatformIOS})
+	assert.Nil(t, err)
+	assert.Equal(t, device.ID, again.ID)
+
+	devices, err = List(ctx, client)
+	assert.Nil(t, err)
+	assert.Equal(t, []Device{{
+		ID:             device.ID,
+		Platform:       PlatformIOS,
+		Token:          "ios-token",
+		TimeRegistered: "2024-05-01T12:00:00Z",
+	}}, devices)
+
+	for i := 1; i < MaxDevices; i++ {
+		_, err = Register(ctx, client, RegisterInput{Token: "token-" + strconv.Itoa(i), Platform: PlatformAndroid})
+		assert.Nil(t, err)
+	}
+	_, err = Register(ctx, client, RegisterInput{Token: "one-too-many", Platform: PlatformAndroid})
+	assert.Equal(t, api.ErrTooManyDevices, err)
+
+	assert.Nil(t, Unregister(ctx, client, device.ID))
+	assert.Equal(t, api.ErrDeviceNotFound, Unregister(ctx, client, device.ID))
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	env.CountersTableName = "counters"
+	defer func() { env.CountersTableName = "" }()
+	client := &mockNotifierAPI{
+		emails: map[string]map[string]types.AttributeValue{
+			"1": {
+				"MessageID":     &types.AttributeValueMemberS{Value: "1"},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+				"DateTime":      &types.AttributeValueMemberS{Value: "01-12:00:00"},
+				"Subject":       &types.AttributeValueMemberS{Value: "Hello"},
+				"From":          &types.AttributeValueMemberSS{Value: []string{"Alice <alice@example.com>"}},
+			},
+			"2": {
+				"MessageID":     &types.AttributeValueMemberS{Value: "2"},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+				"DateTime":      &types.AttributeValueMemberS{Value: "01-12:00:00"},
+				"Subject":       &types.AttributeValueMemberS{Value: "Newsletter"},
+				"ArchivedTime":  &types.AttributeValueMemberS{Value: "2024-05-01T12:00:00Z"},
+			},
+		},
+		counters: map[string]map[string]types.AttributeValue{
+			"inbox": {"Total": &types.AttributeValueMemberN{Value: "10"}, "Unread": &types.AttributeValueMemberN{Value: "4"}},
+		},
+	}
+	ctx := context.TODO()
+	active, err := Register(ctx, client, RegisterInput{Token: "active", Platform: PlatformAndroid})
+	assert.Nil(t, err)
+	stale, err := Register(ctx, client, RegisterInput{Token: "stale", Platform: PlatformIOS})
+	assert.Nil(t, err)
+
+	sender := &mockSender{sent: map[string][]Message{}, unregistered: map[string]bool{"stale": true}}
+	notifier := &Notifier{client: client, sender: sender}
+
+	err = notifier.Notify(ctx, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionReceived, Email: hook.Email{ID: "1"}})
+	assert.Nil(t, err)
+	unread := int64(4)
+	assert.Equal(t, []Message{{
+		Title:       "Alice",
+		Body:        "Hello",
+		CollapseKey: collapseKey,
+		Badge:       &unread,
+		Data:        map[string]string{"event": "email", "action": "received", "messageID": "1"},
+	}}, sender.sent["active"])
+
+	// the stale device is unregistered
+	devices, err := List(ctx, client)
+	assert.Nil(t, err)
+	assert.Len(t, devices, 1)
+	assert.Equal(t, active.ID, devices[0].ID)
+	assert.NotEqual(t, stale.ID, devices[0].ID)
+
+	// archived emails and other hooks are not notified
+	assert.Nil(t, notifier.Notify(ctx, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionReceived, Email: hook.Email{ID: "2"}}))
+	assert.Nil(t, notifier.Notify(ctx, &hook.Hook{Event: hook.EventSecurity, Action: hook.ActionAttachmentsBlocked}))
+	assert.Len(t, sender.sent["active"], 1)
+
+	err = notifier.Notify(ctx, &hook.Hook{Event: hook.EventBatch, Action: hook.ActionDeferred, Batch: []hook.Hook{
+		{Event: hook.EventEmail, Action: hook.ActionReceived, Email: hook.Email{ID: "1"}},
+		{Event: hook.EventEmail, Action: hook.ActionReceived, Email: hook.Email{ID: "3"}},
+	}})
+	assert.Nil(t, err)
+	assert.Len(t, sender.sent["active"], 2)
+	assert.Equal(t, "2 new emails", sender.sent["active"][1].Title)
+	assert.Equal(t, "2", sender.sent["active"][1].Data["count"])
+
+	// a missing email fails the notification
+	err = notifier.Notify(ctx, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionReceived, Email: hook.Email{ID: "3"}})
+	assert.True(t, errors.Is(err, api.ErrNotFound))
+}
+
+func TestSenderName(t *testing.T) {
+	assert.Equal(t, "Alice", senderName([]string{"Alice <alice@example.com>", "bob@example.com"}))
+	assert.Equal(t, "alice@example.com", senderName([]string{"alice@example.com"}))
+	assert.Equal(t, "not an address", senderName([]string{"not an address"}))
+	assert.Equal(t, "New email", senderName(nil))
+}
+
+func TestSubscriptions(t *testing.T) {
+	client := &mockNotifierAPI{}
+	ctx := context.TODO()
+	browser := newTestBrowser(t)
+
+	input := SubscribeInput{Endpoint: "https://fcm.googleapis.com/fcm/send/abc"}
+	input.Keys.P256dh = browser.subscription("").P256dh
+	input.Keys.Auth = base64.URLEncoding.EncodeToString(browser.auth) // padded
+	sub, err := Subscribe(ctx, client, input)
+	assert.Nil(t, err)
+	assert.Equal(t, "fcm.googleapis.com", sub.Service)
+
+	invalid := input
+	invalid.Endpoint = "http://push.example.com"
+	_, err = Subscribe(ctx, client, invalid)
+	assert.Equal(t, api.ErrInvalidInput, err)
+	invalid = input
+	invalid.Keys.P256dh = "AAAA"
+	_, err = Subscribe(ctx, client, invalid)
+	assert.Equal(t, api.ErrInvalidInput, err)
+
+	subs, err := ListSubscriptions(ctx, client)
+	assert.Nil(t, err)
+	assert.Len(t, subs, 1)
+	assert.Equal(t, sub.ID, subs[0].ID)
+	assert.Equal(t, input.Endpoint, subs[0].Endpoint)
+
+	// devices are stored separately
+	devices, err := List(ctx, client)
+	assert.Nil(t, err)
+	assert.Empty(t, devices)
+
+	assert.Nil(t, Unsubscribe(ctx, client, sub.ID))
+	assert.Equal(t, api.ErrSubscriptionNotFound, Unsubscribe(ctx, client, sub.ID))
+}
+
+type mockWebSender struct {
+	payloads map[string][][]byte // endpoint -> payloads
+}
+
+func (m *mockWebSender) Send(_ context.Context, sub Subscription, payload []byte, topic string) error {
+	if strings.HasSuffix(sub.Endpoint, "/expired") {
+		return ErrUnregistered
+	}
+	m.payloads[sub.Endpoint] = append(m.payloads[sub.Endpoint], payload)
+	return nil
+}
+
+func TestWebNotifier_Notify(t *testing.T) {
+	client := &mockNotifierAPI{
+		emails: map[string]map[string]types.AttributeValue{
+			"1": {
+				"MessageID":     &types.AttributeValueMemberS{Value: "1"},
+				"TypeYearMonth": &types.AttributeValueMemberS{Value: "inbox#2024-05"},
+				"DateTime":      &types.AttributeValueMemberS{Value: "01-12:00:00"},
+				"Subject":       &types.AttributeValueMemberS{Value: strings.Repeat("a", 300)},
+				"From":          &types.AttributeValueMemberSS{Value: []string{"alice@example.com"}},
+			},
+		},
+	}
+	ctx := context.TODO()
+	browser := newTestBrowser(t)
+	for _, endpoint := range []string{"https://push.example.com/active", "https://push.example.com/expired"} {
+		input := SubscribeInput{Endpoint: endpoint}
+		input.Keys.P256dh = browser.subscription("").P256dh
+		input.Keys.Auth = browser.subscription("").Auth
+		_, err := Subscribe(ctx, client, input)
+		assert.Nil(t, err)
+	}
+
+	sender := &mockWebSender{payloads: map[string][][]byte{}}
+	notifier := &WebNotifier{client: client, sender: sender}
+	err := notifier.Notify(ctx, &hook.Hook{Event: hook.EventEmail, Action: hook.ActionReceived, Email: hook.Email{ID: "1"}})
+	assert.Nil(t, err)
+
+	payloads := sender.payloads["https://push.example.com/active"]
+	assert.Len(t, payloads, 1)
+	var payload WebPayload
+	assert.Nil(t, json.Unmarshal(payloads[0], &payload))
+	assert.Equal(t, "alice@example.com", payload.Title)
+	assert.Equal(t, strings.Repeat("a", maxTextLength-1)+"…", payload.Body)
+	assert.Equal(t, collapseKey, payload.Tag)
+	assert.Nil(t, payload.Unread) // counters are disabled
+	assert.Equal(t, "1", payload.Data["messageID"])
+
+	subs, err := ListSubscriptions(ctx, client)
+	assert.Nil(t, err)
+	assert.Len(t, subs, 1)
+}
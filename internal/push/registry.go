@@ -0,0 +1,137 @@
+package push
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// registry is a map attribute of an item in the email table, whose entries are registered for push notifications
+type registry struct {
+	itemID    string // MessageID of the item
+	attribute string // name of the map attribute
+	max       int    // maximum number of entries
+	notFound  error  // returned when removing an entry that's not registered
+	full      error  // returned when adding an entry while the registry is full
+}
+
+// entryID returns the ID of an entry, which is derived from its key so that registering again doesn't add an entry
+func entryID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// put adds an entry, or replaces the entry with the same ID
+func (r registry) put(ctx context.Context, client api.UpdateItemAPI, id string, entry map[string]types.AttributeValue) error {
+	// a nested attribute can only be set in an existing map
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: r.itemID},
+		},
+		UpdateExpression: aws.String("SET " + r.attribute + " = if_not_exists(" + r.attribute + ", :empty)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":empty": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}},
+		},
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: r.itemID},
+		},
+		UpdateExpression:    aws.String("SET " + r.attribute + ".#id = :entry"),
+		ConditionExpression: aws.String("attribute_exists(" + r.attribute + ".#id) OR size(" + r.attribute + ") < :max"),
+		ExpressionAttributeNames: map[string]string{
+			"#id": id,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":entry": &types.AttributeValueMemberM{Value: entry},
+			":max":   &types.AttributeValueMemberN{Value: strconv.Itoa(r.max)},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return r.full
+		}
+		return mapError(err)
+	}
+	return nil
+}
+
+// entries returns the registered entries by ID
+func (r registry) entries(ctx context.Context, client api.GetItemAPI) (map[string]map[string]types.AttributeValue, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: r.itemID},
+		},
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	entries := make(map[string]map[string]types.AttributeValue)
+	attr, ok := resp.Item[r.attribute].(*types.AttributeValueMemberM)
+	if !ok {
+		return entries, nil
+	}
+	for id, av := range attr.Value {
+		if m, ok := av.(*types.AttributeValueMemberM); ok {
+			entries[id] = m.Value
+		}
+	}
+	return entries, nil
+}
+
+// remove removes a registered entry
+func (r registry) remove(ctx context.Context, client api.UpdateItemAPI, id string) error {
+	if id == "" {
+		return r.notFound
+	}
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: r.itemID},
+		},
+		UpdateExpression:    aws.String("REMOVE " + r.attribute + ".#id"),
+		ConditionExpression: aws.String("attribute_exists(" + r.attribute + ".#id)"),
+		ExpressionAttributeNames: map[string]string{
+			"#id": id,
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return r.notFound
+		}
+		return mapError(err)
+	}
+	return nil
+}
+
+// stringValue returns a string attribute of an entry, or an empty string
+func stringValue(entry map[string]types.AttributeValue, name string) string {
+	if s, ok := entry[name].(*types.AttributeValueMemberS); ok {
+		return s.Value
+	}
+	return ""
+}
+
+func mapError(err error) error {
+	if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+		return api.ErrTooManyRequests
+	}
+	return err
+}
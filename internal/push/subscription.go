@@ -0,0 +1,133 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdh"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+const (
+	// subscriptionsID is the MessageID of the item storing the Web Push subscriptions in the email table
+	subscriptionsID = "push#subscriptions"
+
+	// MaxSubscriptions is the maximum number of Web Push subscriptions
+	MaxSubscriptions = 20
+
+	maxEndpointLength = 2048
+)
+
+var subscriptionRegistry = registry{
+	itemID:    subscriptionsID,
+	attribute: "Subscriptions",
+	max:       MaxSubscriptions,
+	notFound:  api.ErrSubscriptionNotFound,
+	full:      api.ErrTooManySubscriptions,
+}
+
+// WebEnabled returns true if Web Push notifications are enabled, which requires the VAPID key and subject
+func WebEnabled() bool {
+	return env.PushVAPIDPrivateKey != "" && env.PushVAPIDSubject != ""
+}
+
+// Subscription is a browser subscribed to Web Push notifications
+type Subscription struct {
+	ID             string `json:"id"`
+	Service        string `json:"service"` // host of the push service, e.g. fcm.googleapis.com for Chrome
+	Endpoint       string `json:"-"`
+	P256dh         string `json:"-"` // public key of the browser
+	Auth           string `json:"-"` // authentication secret
+	TimeSubscribed string `json:"timeSubscribed"`
+}
+
+// SubscribeInput is a browser subscription, as returned by PushSubscription.toJSON() in browsers
+type SubscribeInput struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// Subscribe stores a browser subscription for Web Push notifications, or refreshes a known subscription.
+// api.ErrTooManySubscriptions is returned if MaxSubscriptions are already stored.
+func Subscribe(ctx context.Context, client api.UpdateItemAPI, input SubscribeInput) (*Subscription, error) {
+	if len(input.Endpoint) > maxEndpointLength {
+		return nil, api.ErrInvalidInput
+	}
+	endpoint, err := url.Parse(input.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, api.ErrInvalidInput
+	}
+	p256dh, err := decodeBase64URL(input.Keys.P256dh)
+	if err != nil {
+		return nil, api.ErrInvalidInput
+	}
+	if _, err := ecdh.P256().NewPublicKey(p256dh); err != nil {
+		return nil, api.ErrInvalidInput
+	}
+	auth, err := decodeBase64URL(input.Keys.Auth)
+	if err != nil || len(auth) != 16 {
+		return nil, api.ErrInvalidInput
+	}
+
+	sub := &Subscription{
+		ID:             entryID(input.Endpoint),
+		Service:        endpoint.Hostname(),
+		Endpoint:       input.Endpoint,
+		P256dh:         input.Keys.P256dh,
+		Auth:           input.Keys.Auth,
+		TimeSubscribed: getCurrentTime().Format(time.RFC3339),
+	}
+	err = subscriptionRegistry.put(ctx, client, sub.ID, map[string]types.AttributeValue{
+		"Endpoint":       &types.AttributeValueMemberS{Value: sub.Endpoint},
+		"P256dh":         &types.AttributeValueMemberS{Value: sub.P256dh},
+		"Auth":           &types.AttributeValueMemberS{Value: sub.Auth},
+		"TimeSubscribed": &types.AttributeValueMemberS{Value: sub.TimeSubscribed},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ListSubscriptions returns the Web Push subscriptions, from the earliest subscribed
+func ListSubscriptions(ctx context.Context, client api.GetItemAPI) ([]Subscription, error) {
+	entries, err := subscriptionRegistry.entries(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Subscription, 0, len(entries))
+	for id, entry := range entries {
+		sub := Subscription{
+			ID:             id,
+			Endpoint:       stringValue(entry, "Endpoint"),
+			P256dh:         stringValue(entry, "P256dh"),
+			Auth:           stringValue(entry, "Auth"),
+			TimeSubscribed: stringValue(entry, "TimeSubscribed"),
+		}
+		if endpoint, err := url.Parse(sub.Endpoint); err == nil {
+			sub.Service = endpoint.Hostname()
+		}
+		result = append(result, sub)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TimeSubscribed != result[j].TimeSubscribed {
+			return result[i].TimeSubscribed < result[j].TimeSubscribed
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// Unsubscribe removes a Web Push subscription, api.ErrSubscriptionNotFound is returned if it's not stored
+func Unsubscribe(ctx context.Context, client api.UpdateItemAPI, id string) error {
+	return subscriptionRegistry.remove(ctx, client, id)
+}
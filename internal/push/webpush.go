@@ -0,0 +1,242 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/util/egress"
+)
+
+const (
+	// webPushTTL is how long a push service keeps a message for an offline browser
+	webPushTTL = 24 * time.Hour
+	// recordSize is the record size of the aes128gcm content coding, the encrypted payload is sent in a single record
+	recordSize = 4096
+)
+
+// VAPID is the identity of the mailbox as an application server of Web Push (RFC 8292)
+type VAPID struct {
+	key     *ecdsa.PrivateKey
+	subject string // contact of the application server, as a mailto: or https: URL
+}
+
+// ParseVAPID returns the VAPID identity of a base64url encoded P-256 private key,
+// e.g. generated by `npx web-push generate-vapid-keys`
+func ParseVAPID(privateKey, subject string) (*VAPID, error) {
+	if !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https://") {
+		return nil, errors.New("VAPID subject must be a mailto: or https: URL")
+	}
+	d, err := decodeBase64URL(privateKey)
+	if err != nil || len(d) != 32 {
+		return nil, errors.New("invalid VAPID private key")
+	}
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	public := key.PublicKey().Bytes() // uncompressed point
+	return &VAPID{
+		key: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(public[1:33]),
+				Y:     new(big.Int).SetBytes(public[33:]),
+			},
+			D: new(big.Int).SetBytes(d),
+		},
+		subject: subject,
+	}, nil
+}
+
+// PublicKey returns the base64url encoded public key, which is the applicationServerKey of browser subscriptions
+func (v *VAPID) PublicKey() string {
+	public := make([]byte, 65)
+	public[0] = 4 // uncompressed point
+	v.key.X.FillBytes(public[1:33])
+	v.key.Y.FillBytes(public[33:])
+	return base64.RawURLEncoding.EncodeToString(public)
+}
+
+// authorization returns the Authorization header of a request to a push service
+func (v *VAPID) authorization(endpoint *url.URL, now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": now.Add(12 * time.Hour).Unix(),
+		"sub": v.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, v.key, hash[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	token := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return "vapid t=" + token + ", k=" + v.PublicKey(), nil
+}
+
+// WebPush sends encrypted messages to browser subscriptions through their push services
+type WebPush struct {
+	vapid  *VAPID
+	client *http.Client
+}
+
+// NewWebPush returns a WebPush client that identifies as vapid
+func NewWebPush(vapid *VAPID) *WebPush {
+	client := &http.Client{Timeout: 10 * time.Second}
+	egress.FromEnv().Apply(client)
+	return &WebPush{
+		vapid:  vapid,
+		client: client,
+	}
+}
+
+// Send sends a payload to a subscription. A pending message with the same topic is replaced.
+// ErrUnregistered is returned if the subscription is expired or unsubscribed.
+func (w *WebPush) Send(ctx context.Context, sub Subscription, payload []byte, topic string) error {
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+	if err := egress.FromEnv().CheckURL(endpoint); err != nil {
+		return err
+	}
+
+	body, err := encrypt(sub, payload)
+	if err != nil {
+		return err
+	}
+	authorization, err := w.vapid.authorization(endpoint, time.Now())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(webPushTTL.Seconds())))
+	if topic != "" {
+		req.Header.Set("Topic", topic)
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
+		return ErrUnregistered
+	}
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return fmt.Errorf("web push request failed: %s", strings.TrimSpace(res.Status+" "+string(data)))
+}
+
+// encrypt encrypts a payload for a subscription with the aes128gcm content coding (RFC 8188 and RFC 8291)
+func encrypt(sub Subscription, payload []byte) ([]byte, error) {
+	if len(payload)+1+16 > recordSize {
+		return nil, errors.New("web push payload is too large")
+	}
+	uaPublic, err := decodeBase64URL(sub.P256dh)
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := decodeBase64URL(sub.Auth)
+	if err != nil {
+		return nil, err
+	}
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	// a new key pair of the application server for each message
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := asKey.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asKey.PublicKey().Bytes()
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(authSecret, secret, keyInfo, 32)
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	plaintext := append(append([]byte{}, payload...), 2) // delimiter of the last record
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// hkdf derives a key of at most 32 bytes with HKDF-SHA-256 (RFC 5869)
+func hkdf(salt, ikm, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:length]
+}
+
+// decodeBase64URL decodes base64url, with or without padding, as browsers encode subscription keys
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,155 @@
+package push
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+// testBrowser is the key pair and authentication secret of a browser subscription
+type testBrowser struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newTestBrowser(t *testing.T) *testBrowser {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	auth := make([]byte, 16)
+	_, err = rand.Read(auth)
+	assert.Nil(t, err)
+	return &testBrowser{key: key, auth: auth}
+}
+
+func (b *testBrowser) subscription(endpoint string) Subscription {
+	return Subscription{
+		Endpoint: endpoint,
+		P256dh:   base64.RawURLEncoding.EncodeToString(b.key.PublicKey().Bytes()),
+		Auth:     base64.RawURLEncoding.EncodeToString(b.auth),
+	}
+}
+
+// decrypt decrypts a message like a browser does
+func (b *testBrowser) decrypt(t *testing.T, body []byte) []byte {
+	salt := body[:16]
+	assert.Equal(t, uint32(recordSize), binary.BigEndian.Uint32(body[16:20]))
+	idLen := int(body[20])
+	asPublic := body[21 : 21+idLen]
+	ciphertext := body[21+idLen:]
+
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	assert.Nil(t, err)
+	secret, err := b.key.ECDH(asKey)
+	assert.Nil(t, err)
+	keyInfo := append([]byte("WebPush: info\x00"), b.key.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(b.auth, secret, keyInfo, 32)
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	assert.Nil(t, err)
+	gcm, err := cipher.NewGCM(block)
+	assert.Nil(t, err)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(2), plaintext[len(plaintext)-1])
+	return plaintext[:len(plaintext)-1]
+}
+
+func testVAPID(t *testing.T) *VAPID {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	vapid, err := ParseVAPID(base64.RawURLEncoding.EncodeToString(key.Bytes()), "mailto:admin@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), vapid.PublicKey())
+	return vapid
+}
+
+func TestParseVAPID_Invalid(t *testing.T) {
+	_, err := ParseVAPID("invalid", "mailto:admin@example.com")
+	assert.NotNil(t, err)
+	_, err = ParseVAPID(base64.RawURLEncoding.EncodeToString(make([]byte, 32)), "admin@example.com")
+	assert.NotNil(t, err)
+}
+
+func TestEncrypt(t *testing.T) {
+	browser := newTestBrowser(t)
+	payload := []byte(`{"title":"Alice","body":"Hello"}`)
+
+	body, err := encrypt(browser.subscription("https://push.example.com/1"), payload)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, browser.decrypt(t, body))
+
+	_, err = encrypt(browser.subscription("https://push.example.com/1"), make([]byte, recordSize))
+	assert.NotNil(t, err)
+}
+
+func TestWebPush_Send(t *testing.T) {
+	env.EgressAllowPrivate = "true" // the test server listens on loopback
+	defer func() { env.EgressAllowPrivate = "" }()
+
+	vapid := testVAPID(t)
+	browser := newTestBrowser(t)
+	var received []byte
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/expired" {
+			rw.WriteHeader(http.StatusGone)
+			return
+		}
+		assert.Equal(t, "aes128gcm", req.Header.Get("Content-Encoding"))
+		assert.Equal(t, "86400", req.Header.Get("TTL"))
+		assert.Equal(t, collapseKey, req.Header.Get("Topic"))
+
+		// the VAPID token is signed by the key in k=
+		authorization := strings.TrimPrefix(req.Header.Get("Authorization"), "vapid ")
+		token, key, _ := strings.Cut(authorization, ", ")
+		token, key = strings.TrimPrefix(token, "t="), strings.TrimPrefix(key, "k=")
+		assert.Equal(t, vapid.PublicKey(), key)
+		parts := strings.Split(token, ".")
+		assert.Len(t, parts, 3)
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		assert.Nil(t, err)
+		hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		assert.True(t, ecdsa.Verify(&vapid.key.PublicKey, hash[:], r, s))
+		claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+		assert.Nil(t, err)
+		var decoded map[string]interface{}
+		assert.Nil(t, json.Unmarshal(claims, &decoded))
+		assert.Equal(t, "https://"+req.Host, decoded["aud"])
+		assert.Equal(t, "mailto:admin@example.com", decoded["sub"])
+
+		body, err := io.ReadAll(req.Body)
+		assert.Nil(t, err)
+		received = browser.decrypt(t, body)
+		rw.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	w := NewWebPush(vapid)
+	w.client = server.Client()
+	payload := []byte(`{"title":"Alice"}`)
+	err := w.Send(context.TODO(), browser.subscription(server.URL+"/active"), payload, collapseKey)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, received)
+
+	err = w.Send(context.TODO(), browser.subscription(server.URL+"/expired"), payload, collapseKey)
+	assert.Equal(t, ErrUnregistered, err)
+}
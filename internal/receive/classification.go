@@ -0,0 +1,95 @@
+package receive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+// classifyWithService sends the features of the email, and the raw email if enabled, to the classification service,
+// and merges the returned labels and scores into the item. If the service fails, the email is stored without them.
+func classifyWithService(ctx context.Context, r *receipt) {
+	if !hook.ClassificationEnabled() {
+		return
+	}
+	ses := r.ses
+	request := &hook.ClassificationRequest{
+		MessageID:    ses.Mail.MessageID,
+		TimeReceived: format.RFC3399(ses.Mail.Timestamp),
+		Subject:      ses.Mail.CommonHeaders.Subject,
+		Source:       ses.Mail.Source,
+		From:         r.addresses.From.Addresses(),
+		To:           r.addresses.To.Addresses(),
+		Cc:           r.addresses.Cc.Addresses(),
+		Text:         r.email.Text,
+		Verdict: hook.ClassificationVerdict{
+			Spam:  ses.Receipt.SpamVerdict.Status == StatusPass,
+			Virus: ses.Receipt.VirusVerdict.Status == StatusPass,
+			SPF:   ses.Receipt.SPFVerdict.Status == StatusPass,
+			DKIM:  ses.Receipt.DKIMVerdict.Status == StatusPass,
+			DMARC: ses.Receipt.DMARCVerdict.Status == StatusPass,
+		},
+		Size: r.email.Stats.RawSize,
+	}
+	for _, file := range r.email.Attachments {
+		request.Attachments = append(request.Attachments, hook.ClassificationAttachment{
+			Filename:    file.Filename,
+			ContentType: file.ContentType,
+			Size:        file.Size,
+		})
+	}
+	if hook.ClassificationRawEnabled() && request.Size <= hook.MaxClassificationRawSize {
+		raw, err := storage.S3.GetEmailRawAt(ctx, s3Client.Get(r.cfg), r.location)
+		if err != nil {
+			// the features are still sent
+			fmt.Fprintf(os.Stderr, "failed to get raw email for classification, %v\n", err)
+		} else {
+			request.Raw = raw
+		}
+	}
+
+	result, err := hook.Classify(ctx, request)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to classify email, %v\n", err)
+		return
+	}
+	mergeClassification(r.item, result)
+}
+
+// mergeClassification adds the labels and scores of the classification service to the item,
+// dropping labels that are too long or beyond the maximum number
+func mergeClassification(item map[string]types.AttributeValue, result *hook.ClassificationResponse) {
+	if result == nil {
+		return
+	}
+	var labels []string
+	if existing, ok := item["Labels"].(*types.AttributeValueMemberSS); ok {
+		labels = existing.Value
+	}
+	for _, label := range result.Labels {
+		label = strings.TrimSpace(label)
+		if label == "" || len(label) > email.MaxLabelLength {
+			fmt.Printf("classification label %q dropped: empty or too long\n", label)
+			continue
+		}
+		labels = append(labels, label)
+	}
+	labels = uniqueStrings(labels)
+	if len(labels) > email.MaxLabels {
+		labels = labels[:email.MaxLabels]
+	}
+	if len(labels) > 0 {
+		item["Labels"] = &types.AttributeValueMemberSS{Value: labels}
+	}
+	if len(result.Scores) > 0 {
+		item["Scores"] = result.Scores.ToAttributeValue()
+	}
+}
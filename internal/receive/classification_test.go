@@ -0,0 +1,32 @@
+package receive
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/hook"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeClassification(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"Labels": &types.AttributeValueMemberSS{Value: []string{"important"}},
+	}
+	mergeClassification(item, &hook.ClassificationResponse{
+		Labels: []string{" newsletter ", "important", "", strings.Repeat("l", email.MaxLabelLength+1)},
+		Scores: mailboxTypes.Scores{"spam": 0.25},
+	})
+	assert.Equal(t, []string{"important", "newsletter"}, item["Labels"].(*types.AttributeValueMemberSS).Value)
+	assert.Equal(t, &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		"spam": &types.AttributeValueMemberN{Value: "0.25"},
+	}}, item["Scores"])
+
+	// nothing is added if the service returns nothing
+	item = map[string]types.AttributeValue{}
+	mergeClassification(item, &hook.ClassificationResponse{})
+	mergeClassification(item, nil)
+	assert.Empty(t, item)
+}
@@ -0,0 +1,233 @@
+package receive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sesv2Types "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/datasource/mailer"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/util/addr"
+	"github.com/harryzcy/mailbox/internal/util/arf"
+)
+
+// ComplaintLabel is added to feedback reports received at ABUSE_ADDRESS
+const ComplaintLabel = "complaint"
+
+// isComplaint returns true if the email is a feedback report received at ABUSE_ADDRESS
+func isComplaint(ses events.SimpleEmailService) bool {
+	if env.AbuseAddress == "" || !receivedAt(ses, env.AbuseAddress) {
+		return false
+	}
+	for _, header := range ses.Mail.Headers {
+		if strings.EqualFold(header.Name, "Content-Type") && arf.IsReport(header.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseComplaint parses the feedback report stored at location, and returns nil if it can't be parsed
+func parseComplaint(ctx context.Context, client storage.S3GetObjectAPI, location storage.Location) *arf.Report {
+	raw, err := storage.S3.GetEmailRawAt(ctx, client, location)
+	if err != nil {
+		fmt.Printf("failed to get raw feedback report, %v\n", err)
+		return nil
+	}
+	report, err := arf.Parse(raw)
+	if err != nil {
+		fmt.Printf("failed to parse feedback report, %v\n", err)
+		return nil
+	}
+	return report
+}
+
+// labelComplaint keeps a feedback report out of the inbox, archiving it and labeling it with ComplaintLabel
+func labelComplaint(item map[string]types.AttributeValue) {
+	item["ArchivedTime"] = &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+
+	var labels []string
+	if existing, ok := item["Labels"].(*types.AttributeValueMemberSS); ok {
+		labels = existing.Value
+	}
+	labels = uniqueStrings(append(labels, ComplaintLabel))
+	if len(labels) > email.MaxLabels {
+		labels = labels[:email.MaxLabels]
+	}
+	item["Labels"] = &types.AttributeValueMemberSS{Value: labels}
+}
+
+// sentEmailID returns the ID of the sent email with the Message-ID header, which SES generates as <ID@region.amazonses.com>.
+// An empty string is returned for emails that aren't sent by SES.
+func sentEmailID(originalMessageID string) string {
+	local, domain, found := strings.Cut(strings.Trim(strings.TrimSpace(originalMessageID), "<>"), "@")
+	if !found || local == "" || !strings.HasSuffix(strings.ToLower(domain), "amazonses.com") {
+		return ""
+	}
+	return local
+}
+
+// isAuthenticated returns true if the email passes SPF or DKIM, so that it's sent by the domain it claims
+func isAuthenticated(ses events.SimpleEmailService) bool {
+	return ses.Receipt.SPFVerdict.Status == StatusPass || ses.Receipt.DKIMVerdict.Status == StatusPass
+}
+
+// HandleComplaintAPI defines set of API required to link a complaint to the sent email, and suppress its complainants
+type HandleComplaintAPI interface {
+	api.GetItemAPI
+	api.UpdateItemAPI
+	mailer.SuppressAPI
+}
+
+// handleComplaint links a feedback report to the sent email complained about, and suppresses its complainants in SES,
+// so that later sends to them are dropped. Since reports can be forged, only the recipients of the sent email are complainants,
+// and they are suppressed only if the report is authenticated by SPF or DKIM; otherwise the report is only labeled and reported.
+// It returns the complaint to report in the complaint.received hook.
+func handleComplaint(ctx context.Context, client HandleComplaintAPI, messageID string, report *arf.Report, authenticated bool) *hook.Complaint {
+	complaint := &hook.Complaint{
+		FeedbackType:      report.FeedbackType,
+		Complainants:      []string{},
+		OriginalMessageID: report.OriginalMessageID,
+	}
+
+	id := sentEmailID(report.OriginalMessageID)
+	if id == "" {
+		fmt.Println("feedback report isn't about an email sent by SES, skipping suppression")
+		return complaint
+	}
+	recipients, err := sentRecipients(ctx, client, id)
+	if err != nil {
+		fmt.Printf("failed to get sent email %s, %v\n", id, err)
+		return complaint
+	}
+	var complainants []string
+	for _, address := range report.Complainants() {
+		if recipients[strings.ToLower(address)] {
+			complainants = append(complainants, address)
+		}
+	}
+	if err = linkComplaint(ctx, client, id, messageID, complainants); err != nil {
+		fmt.Printf("failed to link feedback report to sent email %s, %v\n", id, err)
+		return complaint
+	}
+	complaint.SentEmailID = id
+
+	if !authenticated {
+		fmt.Println("feedback report fails SPF and DKIM, skipping suppression")
+		return complaint
+	}
+	for _, address := range complainants {
+		_, err := client.PutSuppressedDestination(ctx, &sesv2.PutSuppressedDestinationInput{
+			EmailAddress: aws.String(address),
+			Reason:       sesv2Types.SuppressionListReasonComplaint,
+		})
+		if err != nil {
+			fmt.Printf("failed to suppress %s, %v\n", address, err)
+			continue
+		}
+		complaint.Complainants = append(complaint.Complainants, address)
+	}
+	fmt.Printf("suppressed %d complainants\n", len(complaint.Complainants))
+	return complaint
+}
+
+// sentRecipients returns the lowercase addresses in To, Cc and Bcc of a sent email, or api.ErrNotFound if it's not a sent email
+func sentRecipients(ctx context.Context, client api.GetItemAPI, sentID string) (map[string]bool, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: sentID},
+		},
+		ProjectionExpression: aws.String("TypeYearMonth, #to, Cc, Bcc"),
+		ExpressionAttributeNames: map[string]string{
+			"#to": "To",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	typeYearMonth, ok := resp.Item["TypeYearMonth"].(*types.AttributeValueMemberS)
+	if !ok || !strings.HasPrefix(typeYearMonth.Value, email.EmailTypeSent+"#") {
+		return nil, api.ErrNotFound
+	}
+
+	recipients := map[string]bool{}
+	for _, name := range []string{"To", "Cc", "Bcc"} {
+		values, ok := resp.Item[name].(*types.AttributeValueMemberSS)
+		if !ok {
+			continue
+		}
+		for _, value := range values.Value {
+			for _, address := range addr.ParseListLenient(value) {
+				recipients[strings.ToLower(address.Address)] = true
+			}
+		}
+	}
+	return recipients, nil
+}
+
+// linkComplaint adds the feedback report and its complainants to the sent email
+func linkComplaint(ctx context.Context, client api.UpdateItemAPI, sentID, messageID string, complainants []string) error {
+	expression := "ADD ComplaintIDs :complaintID"
+	values := map[string]types.AttributeValue{
+		":complaintID": &types.AttributeValueMemberSS{Value: []string{messageID}},
+		":v_sent":      &types.AttributeValueMemberS{Value: email.EmailTypeSent + "#"},
+	}
+	if len(complainants) > 0 {
+		expression += ", Complainants :complainants"
+		values[":complainants"] = &types.AttributeValueMemberSS{Value: uniqueStrings(complainants)}
+	}
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: sentID},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String("begins_with(TypeYearMonth, :v_sent)"),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return api.ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// sendComplaintWebhook reports a feedback report received at ABUSE_ADDRESS
+func sendComplaintWebhook(ctx context.Context, ses events.SimpleEmailService, complaint *hook.Complaint) {
+	err := hook.SendWebhook(ctx, &hook.Hook{
+		Event:  hook.EventComplaint,
+		Action: hook.ActionReceived,
+		Email: hook.Email{
+			ID: ses.Mail.MessageID,
+		},
+		Complaint: complaint,
+		Timestamp: ses.Mail.Timestamp.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("failed to send complaint webhook, %v\n", err)
+	}
+}
+
+// complaintClient combines the clients required to handle complaints
+type complaintClient struct {
+	clients.Table
+	clients.Mailer
+}
@@ -0,0 +1,231 @@
+package receive
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sesv2Types "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/arf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsComplaint(t *testing.T) {
+	report := events.SimpleEmailHeader{
+		Name:  "Content-Type",
+		Value: `multipart/report; report-type=feedback-report; boundary="b"`,
+	}
+	bounce := events.SimpleEmailHeader{
+		Name:  "Content-Type",
+		Value: `multipart/report; report-type=delivery-status; boundary="b"`,
+	}
+	tests := []struct {
+		abuseAddress string
+		recipients   []string
+		headers      []events.SimpleEmailHeader
+		expected     bool
+	}{
+		{"abuse@example.com", []string{"Abuse@example.com"}, []events.SimpleEmailHeader{report}, true},
+		{"abuse@example.com", []string{"abuse@example.com"}, []events.SimpleEmailHeader{bounce}, false},
+		{"abuse@example.com", []string{"me@example.com"}, []events.SimpleEmailHeader{report}, false},
+		{"", []string{"abuse@example.com"}, []events.SimpleEmailHeader{report}, false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.AbuseAddress = test.abuseAddress
+			defer func() { env.AbuseAddress = "" }()
+
+			ses := events.SimpleEmailService{
+				Mail:    events.SimpleEmailMessage{Headers: test.headers},
+				Receipt: events.SimpleEmailReceipt{Recipients: test.recipients},
+			}
+			assert.Equal(t, test.expected, isComplaint(ses))
+		})
+	}
+}
+
+func TestLabelComplaint(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"Labels": &types.AttributeValueMemberSS{Value: []string{"important"}},
+	}
+	labelComplaint(item)
+	assert.Equal(t, []string{"important", ComplaintLabel}, item["Labels"].(*types.AttributeValueMemberSS).Value)
+	assert.Contains(t, item, "ArchivedTime")
+}
+
+func TestSentEmailID(t *testing.T) {
+	tests := []struct {
+		messageID string
+		expected  string
+	}{
+		{"<0100018f-abc-000000@us-west-2.amazonses.com>", "0100018f-abc-000000"},
+		{"0100018f-abc-000000@email.amazonses.com", "0100018f-abc-000000"},
+		{"<abc@example.com>", ""},
+		{"<@amazonses.com>", ""},
+		{"", ""},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, sentEmailID(test.messageID))
+		})
+	}
+}
+
+func TestIsAuthenticated(t *testing.T) {
+	tests := []struct {
+		spf, dkim string
+		expected  bool
+	}{
+		{StatusPass, "FAIL", true},
+		{"FAIL", StatusPass, true},
+		{"GRAY", "GRAY", false},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ses := events.SimpleEmailService{Receipt: events.SimpleEmailReceipt{
+				SPFVerdict:  events.SimpleEmailVerdict{Status: test.spf},
+				DKIMVerdict: events.SimpleEmailVerdict{Status: test.dkim},
+			}}
+			assert.Equal(t, test.expected, isAuthenticated(ses))
+		})
+	}
+}
+
+func TestHandleComplaint(t *testing.T) {
+	sentEmail := map[string]types.AttributeValue{
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: "sent#2022-03"},
+		"To":            &types.AttributeValueMemberSS{Value: []string{"User <User@isp.example>"}},
+		"Cc":            &types.AttributeValueMemberSS{Value: []string{"cc@isp.example"}},
+	}
+	tests := []struct {
+		report             *arf.Report
+		unauthenticated    bool
+		item               map[string]types.AttributeValue
+		updateErr          error
+		suppressErr        error
+		expectedUpdate     string
+		expectedSentID     string
+		expectedSuppressed []string
+	}{
+		{
+			report: &arf.Report{
+				FeedbackType:      "abuse",
+				OriginalRcptTo:    []string{"user@isp.example"},
+				OriginalMessageID: "<sent-id@us-west-2.amazonses.com>",
+			},
+			item:               sentEmail,
+			expectedUpdate:     "ADD ComplaintIDs :complaintID, Complainants :complainants",
+			expectedSentID:     "sent-id",
+			expectedSuppressed: []string{"user@isp.example"},
+		},
+		{ // the sent email is deleted
+			report: &arf.Report{
+				FeedbackType:      "abuse",
+				OriginalTo:        []string{"user@isp.example"},
+				OriginalMessageID: "<sent-id@us-west-2.amazonses.com>",
+			},
+			expectedSuppressed: []string{},
+		},
+		{ // the sent email is deleted after it's read
+			report: &arf.Report{
+				FeedbackType:      "abuse",
+				OriginalTo:        []string{"user@isp.example"},
+				OriginalMessageID: "<sent-id@us-west-2.amazonses.com>",
+			},
+			item:               sentEmail,
+			updateErr:          &types.ConditionalCheckFailedException{},
+			expectedUpdate:     "ADD ComplaintIDs :complaintID, Complainants :complainants",
+			expectedSuppressed: []string{},
+		},
+		{ // redacted
+			report: &arf.Report{
+				FeedbackType:      "abuse",
+				OriginalMessageID: "<sent-id@us-west-2.amazonses.com>",
+			},
+			item:               sentEmail,
+			expectedUpdate:     "ADD ComplaintIDs :complaintID",
+			expectedSentID:     "sent-id",
+			expectedSuppressed: []string{},
+		},
+		{ // not a recipient of the sent email
+			report: &arf.Report{
+				FeedbackType:      "abuse",
+				OriginalRcptTo:    []string{"someone@example.com", "cc@isp.example"},
+				OriginalMessageID: "<sent-id@us-west-2.amazonses.com>",
+			},
+			item:               sentEmail,
+			expectedUpdate:     "ADD ComplaintIDs :complaintID, Complainants :complainants",
+			expectedSentID:     "sent-id",
+			expectedSuppressed: []string{"cc@isp.example"},
+		},
+		{ // fails SPF and DKIM
+			report: &arf.Report{
+				FeedbackType:      "abuse",
+				OriginalRcptTo:    []string{"user@isp.example"},
+				OriginalMessageID: "<sent-id@us-west-2.amazonses.com>",
+			},
+			unauthenticated:    true,
+			item:               sentEmail,
+			expectedUpdate:     "ADD ComplaintIDs :complaintID, Complainants :complainants",
+			expectedSentID:     "sent-id",
+			expectedSuppressed: []string{},
+		},
+		{ // not sent by SES
+			report: &arf.Report{
+				FeedbackType:      "abuse",
+				OriginalRcptTo:    []string{"user@isp.example"},
+				OriginalMessageID: "<abc@example.com>",
+			},
+			expectedSuppressed: []string{},
+		},
+		{
+			report: &arf.Report{
+				FeedbackType:      "abuse",
+				OriginalRcptTo:    []string{"user@isp.example"},
+				OriginalMessageID: "<sent-id@us-west-2.amazonses.com>",
+			},
+			item:               sentEmail,
+			suppressErr:        errors.New("error"),
+			expectedUpdate:     "ADD ComplaintIDs :complaintID, Complainants :complainants",
+			expectedSentID:     "sent-id",
+			expectedSuppressed: []string{},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			updated := ""
+			client := complaintClient{Table: clients.Fake{
+				MockGetItem: func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					assert.Equal(t, "sent-id", params.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+					return &dynamodb.GetItemOutput{Item: test.item}, nil
+				},
+				MockUpdateItem: func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					updated = *params.UpdateExpression
+					assert.Equal(t, "sent-id", params.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+					assert.Equal(t, []string{"report-id"}, params.ExpressionAttributeValues[":complaintID"].(*types.AttributeValueMemberSS).Value)
+					return &dynamodb.UpdateItemOutput{}, test.updateErr
+				},
+			}, Mailer: clients.Fake{
+				MockPutSuppressedDestination: func(_ context.Context, params *sesv2.PutSuppressedDestinationInput, _ ...func(*sesv2.Options)) (*sesv2.PutSuppressedDestinationOutput, error) {
+					assert.Equal(t, sesv2Types.SuppressionListReasonComplaint, params.Reason)
+					return &sesv2.PutSuppressedDestinationOutput{}, test.suppressErr
+				},
+			}}
+
+			complaint := handleComplaint(context.TODO(), client, "report-id", test.report, !test.unauthenticated)
+			assert.Equal(t, test.expectedUpdate, updated)
+			assert.Equal(t, test.expectedSentID, complaint.SentEmailID)
+			assert.Equal(t, test.expectedSuppressed, complaint.Complainants)
+			assert.Equal(t, test.report.FeedbackType, complaint.FeedbackType)
+		})
+	}
+}
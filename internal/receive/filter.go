@@ -0,0 +1,195 @@
+package receive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/mailer"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/sieve"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+)
+
+// redirectedHeader marks redirected emails with the address that redirected them,
+// so that they are not redirected again, e.g. in a loop between two mailboxes
+const redirectedHeader = "X-Mailbox-Redirected"
+
+// filter runs the Sieve script, if any, on a received email, and applies the result to its item:
+// fileinto adds labels, and emails not kept in the inbox are archived, or trashed if they are discarded.
+// The rules that fired are recorded on the item and counted on the script.
+// It returns the addresses the email is redirected to. If the script can't be loaded, the email is kept.
+func filter(ctx context.Context, client api.FilterEmailAPI, item map[string]types.AttributeValue, ses events.SimpleEmailService, size int64) []string {
+	script, timeUpdated, err := sieve.Load(ctx, client)
+	if err != nil {
+		fmt.Printf("failed to load sieve script, %v\n", err)
+		return nil
+	}
+	if script == nil {
+		return nil
+	}
+
+	headers := make(mailboxTypes.Headers, len(ses.Mail.Headers))
+	for i, header := range ses.Mail.Headers {
+		headers[i] = mailboxTypes.Header{Name: header.Name, Value: header.Value}
+	}
+	result, steps := script.Trace(sieve.NewMessage(headers, size))
+	fmt.Printf("sieve result: keep %t, fileinto %q, redirects %d\n", result.Keep, result.FileInto, len(result.Redirect))
+
+	if fired := firedRules(steps); len(fired) > 0 {
+		lines := make([]string, len(fired))
+		for i, line := range fired {
+			lines[i] = strconv.Itoa(line)
+		}
+		item["FiredRules"] = &types.AttributeValueMemberNS{Value: lines}
+		if err := sieve.RecordHits(ctx, client, timeUpdated, fired); err != nil {
+			fmt.Printf("failed to record sieve rule hits, %v\n", err)
+		}
+	}
+
+	if len(result.FileInto) > 0 {
+		var labels []string
+		if existing, ok := item["Labels"].(*types.AttributeValueMemberSS); ok {
+			labels = existing.Value
+		}
+		labels = uniqueStrings(append(labels, result.FileInto...))
+		if len(labels) > email.MaxLabels {
+			labels = labels[:email.MaxLabels]
+		}
+		item["Labels"] = &types.AttributeValueMemberSS{Value: labels}
+	}
+
+	now := &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+	switch {
+	case result.Discarded():
+		// discarded emails are recoverable from trash
+		item["TrashedTime"] = now
+	case !result.Keep:
+		item["ArchivedTime"] = now
+	}
+	return result.Redirect
+}
+
+// firedRules returns the unique lines of the if, elsif and else branches taken, in ascending order
+func firedRules(steps []sieve.Step) []int {
+	var lines []int
+	seen := make(map[int]bool)
+	for _, step := range steps {
+		switch step.Command {
+		case "if", "elsif", "else":
+			if !seen[step.Line] {
+				seen[step.Line] = true
+				lines = append(lines, step.Line)
+			}
+		}
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// redirect sends a received email to another address, as the recipient that received it.
+// The From header is replaced with the recipient, which is verified in SES, and the original sender
+// is kept as Reply-To, so that replies go to the sender.
+func redirect(ctx context.Context, client mailer.SendEmailAPI, raw []byte, ses events.SimpleEmailService, to string) error {
+	recipient := redirectingRecipient(ses)
+	if recipient == "" {
+		return errors.New("no recipient to redirect as")
+	}
+
+	data, err := redirectedMessage(raw, recipient)
+	if err != nil {
+		return err
+	}
+	_, err = client.SendEmail(ctx, &sesv2.SendEmailInput{
+		Content: &sestypes.EmailContent{
+			Raw: &sestypes.RawMessage{Data: data},
+		},
+		Destination: &sestypes.Destination{
+			ToAddresses: []string{to},
+		},
+		FromEmailAddress: aws.String(recipient),
+	})
+	return err
+}
+
+// redirectingRecipient returns the recipient the email is redirected as, which is a recipient handled by the receipt rule
+func redirectingRecipient(ses events.SimpleEmailService) string {
+	if len(ses.Receipt.Recipients) > 0 {
+		return ses.Receipt.Recipients[0]
+	}
+	if len(ses.Mail.Destination) > 0 {
+		return ses.Mail.Destination[0]
+	}
+	return ""
+}
+
+// errAlreadyRedirected is returned for emails that were redirected before, which are not redirected again
+var errAlreadyRedirected = errors.New("email is already redirected")
+
+// redirectedMessage rewrites the header section of a raw email to be sent by recipient.
+// Headers tied to the original sender and its signatures are removed, and the body is kept as is.
+func redirectedMessage(raw []byte, recipient string) ([]byte, error) {
+	end, sepLen := bytes.Index(raw, []byte("\r\n\r\n")), 4
+	if lfEnd := bytes.Index(raw, []byte("\n\n")); lfEnd != -1 && (end == -1 || lfEnd < end) {
+		end, sepLen = lfEnd, 2
+	}
+	if end == -1 {
+		end, sepLen = len(raw), 0
+	}
+	header, body := raw[:end], raw[end+sepLen:]
+
+	var fields []string // unfolded header fields
+	for _, line := range strings.Split(strings.ReplaceAll(string(header), "\r\n", "\n"), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(fields) > 0 {
+			fields[len(fields)-1] += "\r\n" + line
+		} else if line != "" {
+			fields = append(fields, line)
+		}
+	}
+
+	var from, replyTo string
+	var b bytes.Buffer
+	for _, field := range fields {
+		name, value, _ := strings.Cut(field, ":")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case strings.ToLower(redirectedHeader):
+			return nil, errAlreadyRedirected
+		case "from":
+			from = strings.TrimSpace(strings.ReplaceAll(value, "\r\n", ""))
+			continue
+		case "reply-to":
+			replyTo = strings.TrimSpace(value)
+		case "sender", "return-path", "dkim-signature":
+			continue
+		}
+		b.WriteString(field + "\r\n")
+	}
+
+	name := ""
+	if address, err := mail.ParseAddress(from); err == nil {
+		name = address.Name
+		if name == "" {
+			name = address.Address
+		}
+	}
+	fmt.Fprintf(&b, "From: %s\r\n", (&mail.Address{Name: name, Address: recipient}).String())
+	if replyTo == "" && from != "" {
+		fmt.Fprintf(&b, "Reply-To: %s\r\n", from)
+	}
+	fmt.Fprintf(&b, "%s: %s\r\n\r\n", redirectedHeader, recipient)
+	b.Write(body)
+	return b.Bytes(), nil
+}
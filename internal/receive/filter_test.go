@@ -0,0 +1,107 @@
+package receive
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/harryzcy/mailbox/internal/sieve"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirectedMessage(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+		err      error
+	}{
+		{
+			raw: "Return-Path: <bounce@example.com>\r\n" +
+				"DKIM-Signature: v=1; a=rsa-sha256; d=example.com;\r\n b=abc\r\n" +
+				"From: Alice <alice@example.com>\r\n" +
+				"Sender: list@example.com\r\n" +
+				"To: bob@example.org\r\n" +
+				"Subject: Hello\r\n" +
+				"\r\n" +
+				"Hello\r\n\r\nBye",
+			expected: "To: bob@example.org\r\n" +
+				"Subject: Hello\r\n" +
+				"From: \"Alice\" <bob@example.org>\r\n" +
+				"Reply-To: Alice <alice@example.com>\r\n" +
+				"X-Mailbox-Redirected: bob@example.org\r\n" +
+				"\r\n" +
+				"Hello\r\n\r\nBye",
+		},
+		{
+			raw: "From: alice@example.com\n" +
+				"Reply-To: team@example.com\n" +
+				"Subject: Hello\n" +
+				"\n" +
+				"Hello",
+			expected: "Reply-To: team@example.com\r\n" +
+				"Subject: Hello\r\n" +
+				"From: \"alice@example.com\" <bob@example.org>\r\n" +
+				"X-Mailbox-Redirected: bob@example.org\r\n" +
+				"\r\n" +
+				"Hello",
+		},
+		{
+			raw: "From: Alice <alice@example.com>\r\n" +
+				"x-mailbox-redirected: carol@example.net\r\n" +
+				"\r\n" +
+				"Hello",
+			err: errAlreadyRedirected,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			data, err := redirectedMessage([]byte(test.raw), "bob@example.org")
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.expected, string(data))
+		})
+	}
+}
+
+func TestRedirectingRecipient(t *testing.T) {
+	tests := []struct {
+		ses      events.SimpleEmailService
+		expected string
+	}{
+		{
+			ses: events.SimpleEmailService{
+				Mail:    events.SimpleEmailMessage{Destination: []string{"a@example.com", "b@example.com"}},
+				Receipt: events.SimpleEmailReceipt{Recipients: []string{"b@example.com"}},
+			},
+			expected: "b@example.com",
+		},
+		{
+			ses: events.SimpleEmailService{
+				Mail: events.SimpleEmailMessage{Destination: []string{"a@example.com"}},
+			},
+			expected: "a@example.com",
+		},
+		{
+			ses:      events.SimpleEmailService{},
+			expected: "",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, redirectingRecipient(test.ses))
+		})
+	}
+}
+
+func TestFiredRules(t *testing.T) {
+	steps := []sieve.Step{
+		{Line: 4, Command: "elsif"},
+		{Line: 5, Command: "fileinto", Argument: "Lists"},
+		{Line: 2, Command: "if"},
+		{Line: 2, Command: "if"},
+		{Line: 3, Command: "discard"},
+	}
+	assert.Equal(t, []int{2, 4}, firedRules(steps))
+	assert.Nil(t, firedRules(nil))
+}
@@ -0,0 +1,80 @@
+package receive
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"golang.org/x/net/html/charset"
+
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/util/addr"
+)
+
+// maxHeadersSize is the size of headers above which SES reports them as truncated
+const maxHeadersSize = 10 << 10
+
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: charset.NewReaderLabel,
+}
+
+// ImportedMail returns the SES notification of an email imported from another provider,
+// as if it were received by SES at the given time. The raw email is expected at the default location of messageID.
+// Spam, DKIM, SPF and virus verdicts are not available for imported emails, so they are left empty.
+func ImportedMail(messageID string, raw []byte, timestamp time.Time) (events.SimpleEmailService, error) {
+	headers, err := storage.ReadHeaders(bytes.NewReader(raw))
+	if err != nil {
+		return events.SimpleEmailService{}, err
+	}
+
+	mail := events.SimpleEmailMessage{
+		MessageID: messageID,
+		Timestamp: timestamp,
+	}
+	size := 0
+	for _, header := range headers {
+		size += len(header.Name) + len(header.Value) + len(": \r\n")
+		mail.Headers = append(mail.Headers, events.SimpleEmailHeader{Name: header.Name, Value: header.Value})
+
+		switch strings.ToLower(header.Name) {
+		case "from":
+			from := addr.ParseListLenient(header.Value)
+			mail.CommonHeaders.From = from.Strings()
+			if len(from) > 0 {
+				mail.Source = from[0].Address
+			}
+		case "to":
+			to := addr.ParseListLenient(header.Value)
+			mail.CommonHeaders.To = to.Strings()
+			mail.Destination = append(mail.Destination, to.Addresses()...)
+		case "cc":
+			mail.Destination = append(mail.Destination, addr.ParseListLenient(header.Value).Addresses()...)
+		case "return-path":
+			mail.CommonHeaders.ReturnPath = strings.Trim(header.Value, "<> ")
+		case "message-id":
+			mail.CommonHeaders.MessageID = header.Value
+		case "date":
+			mail.CommonHeaders.Date = header.Value
+		case "subject":
+			mail.CommonHeaders.Subject = decodeHeader(header.Value)
+		}
+	}
+	mail.HeadersTruncated = size > maxHeadersSize
+
+	if mail.CommonHeaders.ReturnPath != "" {
+		mail.Source = mail.CommonHeaders.ReturnPath
+	}
+
+	return events.SimpleEmailService{Mail: mail}, nil
+}
+
+// decodeHeader decodes RFC 2047 encoded-words, as SES does for the subject
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
@@ -0,0 +1,51 @@
+package receive
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportedMail(t *testing.T) {
+	raw := "Return-Path: <bounce@example.com>\r\n" +
+		"From: Alice <alice@example.com>\r\n" +
+		"To: bob@example.com,\r\n carol@example.com\r\n" +
+		"Cc: dave@example.com\r\n" +
+		"Subject: =?UTF-8?B?SGVsbG8g5LiW55WM?=\r\n" +
+		"Date: Wed, 1 May 2024 12:00:00 +0000\r\n" +
+		"Message-ID: <original@example.com>\r\n" +
+		"\r\n" +
+		"Hello"
+	timestamp := time.Date(2024, 5, 1, 12, 0, 1, 0, time.UTC)
+
+	ses, err := ImportedMail("gmail-abc", []byte(raw), timestamp)
+	assert.Nil(t, err)
+	assert.Equal(t, "gmail-abc", ses.Mail.MessageID)
+	assert.Equal(t, timestamp, ses.Mail.Timestamp)
+	assert.Equal(t, "bounce@example.com", ses.Mail.Source)
+	assert.Equal(t, []string{"bob@example.com", "carol@example.com", "dave@example.com"}, ses.Mail.Destination)
+	assert.Equal(t, events.SimpleEmailCommonHeaders{
+		From:       []string{"Alice <alice@example.com>"},
+		To:         []string{"bob@example.com", "carol@example.com"},
+		ReturnPath: "bounce@example.com",
+		MessageID:  "<original@example.com>",
+		Date:       "Wed, 1 May 2024 12:00:00 +0000",
+		Subject:    "Hello 世界",
+	}, ses.Mail.CommonHeaders)
+	assert.Len(t, ses.Mail.Headers, 7)
+	assert.Equal(t, events.SimpleEmailHeader{Name: "To", Value: "bob@example.com, carol@example.com"}, ses.Mail.Headers[2])
+	assert.False(t, ses.Mail.HeadersTruncated)
+
+	// without Return-Path, the first From address is the source
+	ses, err = ImportedMail("gmail-abc", []byte("From: alice@example.com\r\n\r\n"), timestamp)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice@example.com", ses.Mail.Source)
+	assert.Nil(t, ses.Mail.Destination)
+
+	ses, err = ImportedMail("gmail-abc", []byte("X-Large: "+strings.Repeat("x", maxHeadersSize)+"\r\n\r\n"), timestamp)
+	assert.Nil(t, err)
+	assert.True(t, ses.Mail.HeadersTruncated)
+}
@@ -0,0 +1,76 @@
+package receive
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// NoReplyLabel is added to replies received at NO_REPLY_ADDRESS, i.e. to emails sent in no-reply mode
+const NoReplyLabel = "no-reply"
+
+// handleNoReply keeps emails received at NO_REPLY_ADDRESS out of the inbox:
+// bounces are trashed, and other emails, which are replies, are archived and labeled with NoReplyLabel
+func handleNoReply(item map[string]types.AttributeValue, ses events.SimpleEmailService) {
+	if env.NoReplyAddress == "" || !receivedAt(ses, env.NoReplyAddress) {
+		return
+	}
+
+	now := &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+	if isBounce(ses) {
+		fmt.Println("trashing bounce of an email sent in no-reply mode")
+		item["TrashedTime"] = now
+		return
+	}
+
+	item["ArchivedTime"] = now
+
+	var labels []string
+	if existing, ok := item["Labels"].(*types.AttributeValueMemberSS); ok {
+		labels = existing.Value
+	}
+	labels = uniqueStrings(append(labels, NoReplyLabel))
+	if len(labels) > email.MaxLabels {
+		labels = labels[:email.MaxLabels]
+	}
+	item["Labels"] = &types.AttributeValueMemberSS{Value: labels}
+}
+
+// receivedAt returns true if address is a recipient of the email handled by the receipt rule
+func receivedAt(ses events.SimpleEmailService, address string) bool {
+	recipients := ses.Receipt.Recipients
+	if len(recipients) == 0 {
+		recipients = ses.Mail.Destination
+	}
+	for _, recipient := range recipients {
+		if strings.EqualFold(recipient, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBounce returns true if the email is a delivery status notification (RFC 3464), or is sent by a mailer daemon
+func isBounce(ses events.SimpleEmailService) bool {
+	source := strings.ToLower(ses.Mail.Source)
+	if source == "" || source == "<>" || strings.HasPrefix(source, "mailer-daemon@") {
+		return true
+	}
+	for _, header := range ses.Mail.Headers {
+		if !strings.EqualFold(header.Name, "Content-Type") {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(header.Value)
+		if err == nil && mediaType == "multipart/report" && strings.EqualFold(params["report-type"], "delivery-status") {
+			return true
+		}
+	}
+	return false
+}
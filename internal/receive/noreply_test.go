@@ -0,0 +1,66 @@
+package receive
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleNoReply(t *testing.T) {
+	env.NoReplyAddress = "no-reply@example.com"
+	defer func() { env.NoReplyAddress = "" }()
+
+	report := events.SimpleEmailHeader{
+		Name:  "Content-Type",
+		Value: `multipart/report; report-type=delivery-status; boundary="b"`,
+	}
+	tests := []struct {
+		source     string
+		recipients []string
+		headers    []events.SimpleEmailHeader
+		labels     []string
+		archived   bool
+		trashed    bool
+	}{
+		// replies are archived and labeled
+		{"alice@example.org", []string{"No-Reply@example.com"}, nil, []string{"important", "no-reply"}, true, false},
+		// bounces are trashed
+		{"MAILER-DAEMON@amazonses.com", []string{"no-reply@example.com"}, nil, []string{"important"}, false, true},
+		{"postmaster@example.org", []string{"no-reply@example.com"}, []events.SimpleEmailHeader{report}, []string{"important"}, false, true},
+		// other emails are not changed
+		{"alice@example.org", []string{"me@example.com"}, nil, []string{"important"}, false, false},
+		{"MAILER-DAEMON@amazonses.com", []string{"me@example.com"}, []events.SimpleEmailHeader{report}, []string{"important"}, false, false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			item := map[string]types.AttributeValue{
+				"Labels": &types.AttributeValueMemberSS{Value: []string{"important"}},
+			}
+			ses := events.SimpleEmailService{
+				Mail:    events.SimpleEmailMessage{Source: test.source, Headers: test.headers},
+				Receipt: events.SimpleEmailReceipt{Recipients: test.recipients},
+			}
+			handleNoReply(item, ses)
+
+			assert.Equal(t, test.labels, item["Labels"].(*types.AttributeValueMemberSS).Value)
+			_, archived := item["ArchivedTime"]
+			assert.Equal(t, test.archived, archived)
+			_, trashed := item["TrashedTime"]
+			assert.Equal(t, test.trashed, trashed)
+		})
+	}
+}
+
+func TestHandleNoReply_Disabled(t *testing.T) {
+	item := map[string]types.AttributeValue{}
+	handleNoReply(item, events.SimpleEmailService{
+		Mail:    events.SimpleEmailMessage{Source: "MAILER-DAEMON@amazonses.com"},
+		Receipt: events.SimpleEmailReceipt{Recipients: []string{"no-reply@example.com"}},
+	})
+	assert.Empty(t, item)
+}
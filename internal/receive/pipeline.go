@@ -0,0 +1,287 @@
+package receive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/history"
+	"github.com/harryzcy/mailbox/internal/util/metrics"
+)
+
+// Names of the stages of receiving an email, in the order they run
+const (
+	StageParse        = "parse"        // builds the item and parses the raw email
+	StageAuthenticate = "authenticate" // records the SES verdicts
+	StageClassify     = "classify"     // attachment policy, complaints, no-reply bounces, enrichment, sender lists and classification
+	StageRules        = "rules"        // Sieve script and filtering rules
+	StagePersist      = "persist"      // parsed content and blobs
+	StageThread       = "thread"       // stores the email in its thread
+	StageNotify       = "notify"       // search index, SQS, webhooks, push notifications, complaints and redirects
+	StageReply        = "reply"        // automatic replies of the vacation responder
+)
+
+// Metrics of the stages, with the stage as the dimension
+const (
+	MetricStageDuration = "ReceiveStageDuration" // time each stage takes
+	MetricStageFailures = "ReceiveStageFailures" // failed stages, with the policy applied as the Outcome dimension
+)
+
+// Policy is what happens when a stage fails
+type Policy string
+
+const (
+	// PolicyAbort fails receiving, so that it's retried, and the email reaches the dead-letter queue if retries fail
+	PolicyAbort Policy = "abort"
+	// PolicyContinue receives the email as if the stage succeeded
+	PolicyContinue Policy = "continue"
+	// PolicyQuarantine stores the email archived and labeled QuarantineLabel, skipping the remaining stages that can be disabled.
+	// Stages that fail after the email is stored continue instead.
+	PolicyQuarantine Policy = "quarantine"
+)
+
+// QuarantineLabel is the label of emails quarantined by the failure of a stage
+const QuarantineLabel = "quarantined"
+
+// defaultPolicies are the policies of the stages that can be disabled, required stages always abort.
+// Failures of classification should never drop the email, while the receipt sent to SQS is retried.
+var defaultPolicies = map[string]Policy{
+	StageAuthenticate: PolicyContinue,
+	StageClassify:     PolicyQuarantine,
+	StageRules:        PolicyContinue,
+	StageNotify:       PolicyAbort,
+	StageReply:        PolicyContinue,
+}
+
+// stage is a step of receiving an email, which reads and updates the receipt of the email.
+// An error is handled by the failure policy of the stage, except for ErrBlocked which always stops the pipeline.
+type stage interface {
+	Name() string
+	Run(ctx context.Context, r *receipt) error
+}
+
+// stageFunc is a stage that runs a function
+type stageFunc struct {
+	name string
+	run  func(ctx context.Context, r *receipt) error
+}
+
+func (s stageFunc) Name() string {
+	return s.name
+}
+
+func (s stageFunc) Run(ctx context.Context, r *receipt) error {
+	return s.run(ctx, r)
+}
+
+// stages are the stages of receiving an email, in order
+var stages = []stage{
+	stageFunc{StageParse, parse},
+	stageFunc{StageAuthenticate, authenticate},
+	stageFunc{StageClassify, classify},
+	stageFunc{StageRules, rules},
+	stageFunc{StagePersist, persist},
+	stageFunc{StageThread, storeThread},
+	stageFunc{StageNotify, notify},
+	stageFunc{StageReply, reply},
+}
+
+// stageEvents are the events recorded in the history of the email when stages succeed
+var stageEvents = map[string]string{
+	StageParse:    history.EventParsed,
+	StageClassify: history.EventClassified,
+	StageThread:   history.EventStored,
+	StageNotify:   history.EventNotified,
+}
+
+// requiredStages can't be disabled, since the email can't be stored without them
+var requiredStages = map[string]bool{
+	StageParse:   true,
+	StagePersist: true,
+	StageThread:  true,
+}
+
+func knownStage(name string) bool {
+	for _, s := range stages {
+		if s.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pipeline runs stages in order
+type pipeline struct {
+	stages   []stage
+	policies map[string]Policy
+}
+
+// newPipeline returns the pipeline of stages, without the ones in disabled,
+// a comma separated list of stage names, e.g. classify,rules,
+// and with the failure policies of stages in policies, e.g. classify=continue,notify=continue
+func newPipeline(disabled, policies string) pipeline {
+	skip := make(map[string]bool)
+	for _, name := range strings.Split(disabled, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !knownStage(name) || requiredStages[name] {
+			fmt.Printf("stage %s can't be disabled\n", name)
+			continue
+		}
+		skip[name] = true
+	}
+
+	p := pipeline{policies: parsePolicies(policies)}
+	for _, s := range stages {
+		if !skip[s.Name()] {
+			p.stages = append(p.stages, s)
+		}
+	}
+	return p
+}
+
+// parsePolicies returns the default policies overridden by policies, a comma separated list of stage=policy
+func parsePolicies(policies string) map[string]Policy {
+	result := make(map[string]Policy, len(defaultPolicies))
+	for name, policy := range defaultPolicies {
+		result[name] = policy
+	}
+	for _, entry := range strings.Split(policies, ",") {
+		name, policy, _ := strings.Cut(strings.ToLower(strings.TrimSpace(entry)), "=")
+		name, policy = strings.TrimSpace(name), strings.TrimSpace(policy)
+		if name == "" {
+			continue
+		}
+		if !knownStage(name) || requiredStages[name] {
+			fmt.Printf("failure policy of stage %s can't be changed\n", name)
+			continue
+		}
+		switch Policy(policy) {
+		case PolicyAbort, PolicyContinue, PolicyQuarantine:
+			result[name] = Policy(policy)
+		default:
+			fmt.Printf("unknown failure policy %s of stage %s\n", policy, name)
+		}
+	}
+	return result
+}
+
+// policy returns the failure policy of a stage
+func (p pipeline) policy(name string) Policy {
+	if policy, ok := p.policies[name]; ok && !requiredStages[name] {
+		return policy
+	}
+	return PolicyAbort
+}
+
+// run runs the stages on the receipt, recording the time each stage takes.
+// A failed stage stops the pipeline if its policy aborts, otherwise the failure is recorded in the receipt.
+func (p pipeline) run(ctx context.Context, r *receipt) error {
+	quarantined := false
+	for _, s := range p.stages {
+		if quarantined && !requiredStages[s.Name()] {
+			continue
+		}
+
+		start := time.Now()
+		err := s.Run(ctx, r)
+		metrics.Emit(map[string]string{"Stage": s.Name()}, metrics.Duration(MetricStageDuration, time.Since(start)))
+		if err == nil {
+			if event, ok := stageEvents[s.Name()]; ok {
+				r.events = append(r.events, history.NewEvent(event, ""))
+			}
+			continue
+		}
+		if errors.Is(err, ErrBlocked) {
+			// blocking is a decision of the attachment policy, rather than a failure
+			r.events = append(r.events, history.NewEvent(history.EventClassified, err.Error()))
+			return err
+		}
+
+		policy := p.policy(s.Name())
+		if policy == PolicyQuarantine && r.stored {
+			policy = PolicyContinue
+		}
+		metrics.Emit(map[string]string{"Stage": s.Name(), "Outcome": string(policy)}, metrics.Count(MetricStageFailures, 1))
+		r.events = append(r.events, history.NewEvent(history.EventFailed, fmt.Sprintf("stage %s failed, %s: %v", s.Name(), policy, err)))
+		if policy == PolicyAbort {
+			return fmt.Errorf("stage %s failed: %w", s.Name(), err)
+		}
+
+		fmt.Fprintf(os.Stderr, "stage %s failed, applying failure policy %s, %v\n", s.Name(), policy, err)
+		r.recordFailure(email.StageFailure{
+			Stage:   s.Name(),
+			Outcome: string(policy),
+			Time:    time.Now().UTC().Format(time.RFC3339),
+			Error:   err.Error(),
+		})
+		if policy == PolicyQuarantine {
+			quarantine(r.item)
+			quarantined = true
+		}
+	}
+	return nil
+}
+
+// recordFailure records a failed stage in the item, or as unsaved if the item is already stored
+func (r *receipt) recordFailure(failure email.StageFailure) {
+	if r.stored {
+		r.unsavedFailures = append(r.unsavedFailures, failure)
+		return
+	}
+	r.failures = append(r.failures, failure)
+	if av, err := attributevalue.Marshal(r.failures); err == nil {
+		r.item["StageFailures"] = av
+	}
+}
+
+// saveFailures appends the failures of stages that run after the email is stored to its item
+func saveFailures(ctx context.Context, client api.UpdateItemAPI, messageID string, failures []email.StageFailure) error {
+	values := make([]types.AttributeValue, len(failures))
+	for i, failure := range failures {
+		av, err := attributevalue.Marshal(failure)
+		if err != nil {
+			return err
+		}
+		values[i] = av
+	}
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression: aws.String("SET StageFailures = list_append(if_not_exists(StageFailures, :empty), :failures)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":empty":    &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+			":failures": &types.AttributeValueMemberL{Value: values},
+		},
+	})
+	return err
+}
+
+// quarantine archives the item and labels it QuarantineLabel
+func quarantine(item map[string]types.AttributeValue) {
+	item["ArchivedTime"] = &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+
+	var labels []string
+	if existing, ok := item["Labels"].(*types.AttributeValueMemberSS); ok {
+		labels = existing.Value
+	}
+	labels = uniqueStrings(append(labels, QuarantineLabel))
+	if len(labels) > email.MaxLabels {
+		labels = labels[:email.MaxLabels]
+	}
+	item["Labels"] = &types.AttributeValueMemberSS{Value: labels}
+}
@@ -0,0 +1,158 @@
+package receive
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/history"
+	"github.com/stretchr/testify/assert"
+)
+
+func stageNames(p pipeline) []string {
+	names := make([]string, len(p.stages))
+	for i, s := range p.stages {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+func eventNames(events []history.Event) []string {
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = event.Event
+	}
+	return names
+}
+
+func TestNewPipeline(t *testing.T) {
+	tests := []struct {
+		disabled string
+		expected []string
+	}{
+		{
+			disabled: "",
+			expected: []string{"parse", "authenticate", "classify", "rules", "persist", "thread", "notify", "reply"},
+		},
+		{
+			disabled: "Classify, rules",
+			expected: []string{"parse", "authenticate", "persist", "thread", "notify", "reply"},
+		},
+		{
+			// required and unknown stages are kept
+			disabled: "parse,thread,unknown,notify",
+			expected: []string{"parse", "authenticate", "classify", "rules", "persist", "thread", "reply"},
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, stageNames(newPipeline(test.disabled, "")))
+	}
+}
+
+func TestPipeline_Run(t *testing.T) {
+	var ran []string
+	newStage := func(name string, err error) stage {
+		return stageFunc{name, func(_ context.Context, r *receipt) error {
+			ran = append(ran, name)
+			r.redirects = append(r.redirects, name)
+			return err
+		}}
+	}
+
+	r := &receipt{}
+	err := pipeline{stages: []stage{newStage("first", nil), newStage("second", nil)}}.run(context.TODO(), r)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, ran)
+	assert.Equal(t, []string{"first", "second"}, r.redirects) // the receipt is passed through
+
+	ran = nil
+	err = pipeline{stages: []stage{newStage("first", ErrBlocked), newStage("second", nil)}}.run(context.TODO(), &receipt{})
+	assert.True(t, errors.Is(err, ErrBlocked))
+	assert.Equal(t, []string{"first"}, ran)
+}
+
+func TestParsePolicies(t *testing.T) {
+	policies := parsePolicies("")
+	assert.Equal(t, defaultPolicies, policies)
+
+	policies = parsePolicies(" Classify=continue, notify = quarantine, parse=continue, rules=unknown, unknown=abort")
+	assert.Equal(t, PolicyContinue, policies[StageClassify])
+	assert.Equal(t, PolicyQuarantine, policies[StageNotify])
+	assert.Equal(t, PolicyContinue, policies[StageRules]) // unknown policies are ignored
+	assert.NotContains(t, policies, StageParse)           // required stages always abort
+	assert.NotContains(t, policies, "unknown")
+
+	p := pipeline{policies: policies}
+	assert.Equal(t, PolicyAbort, p.policy(StageParse))
+	assert.Equal(t, PolicyAbort, p.policy(StageThread))
+	assert.Equal(t, PolicyContinue, p.policy(StageClassify))
+}
+
+func TestPipeline_FailurePolicy(t *testing.T) {
+	errFailed := errors.New("failed")
+	var ran []string
+	newStage := func(name string, err error) stage {
+		return stageFunc{name, func(_ context.Context, r *receipt) error {
+			ran = append(ran, name)
+			if name == StageThread {
+				r.stored = true
+			}
+			return err
+		}}
+	}
+	stages := func(failing string) []stage {
+		result := []stage{}
+		for _, name := range []string{StageParse, StageClassify, StageRules, StagePersist, StageThread, StageNotify} {
+			var err error
+			if name == failing {
+				err = errFailed
+			}
+			result = append(result, newStage(name, err))
+		}
+		return result
+	}
+
+	// continue records the failure in the item
+	ran = nil
+	r := &receipt{item: map[string]types.AttributeValue{}}
+	err := pipeline{stages: stages(StageClassify), policies: parsePolicies("classify=continue")}.run(context.TODO(), r)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"parse", "classify", "rules", "persist", "thread", "notify"}, ran)
+	if assert.Len(t, r.failures, 1) {
+		assert.Equal(t, StageClassify, r.failures[0].Stage)
+		assert.Equal(t, "continue", r.failures[0].Outcome)
+		assert.Equal(t, "failed", r.failures[0].Error)
+	}
+	assert.Contains(t, r.item, "StageFailures")
+	assert.NotContains(t, r.item, "ArchivedTime")
+	assert.Equal(t, []string{"parsed", "failed", "stored", "notified"}, eventNames(r.events))
+
+	// quarantine stores the email archived and labeled, without the remaining stages that can be disabled
+	ran = nil
+	r = &receipt{item: map[string]types.AttributeValue{}}
+	err = pipeline{stages: stages(StageClassify), policies: parsePolicies("")}.run(context.TODO(), r)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"parse", "classify", "persist", "thread"}, ran)
+	assert.Contains(t, r.item, "ArchivedTime")
+	assert.Equal(t, &types.AttributeValueMemberSS{Value: []string{QuarantineLabel}}, r.item["Labels"])
+
+	// abort fails receiving
+	ran = nil
+	r = &receipt{item: map[string]types.AttributeValue{}}
+	err = pipeline{stages: stages(StageNotify), policies: parsePolicies("")}.run(context.TODO(), r)
+	assert.True(t, errors.Is(err, errFailed))
+	assert.Empty(t, r.failures)
+
+	// quarantine after the email is stored continues, and the failure is saved separately
+	ran = nil
+	r = &receipt{item: map[string]types.AttributeValue{}}
+	err = pipeline{stages: stages(StageNotify), policies: parsePolicies("notify=quarantine")}.run(context.TODO(), r)
+	assert.NoError(t, err)
+	assert.Empty(t, r.failures)
+	if assert.Len(t, r.unsavedFailures, 1) {
+		assert.Equal(t, "continue", r.unsavedFailures[0].Outcome)
+	}
+	assert.NotContains(t, r.item, "ArchivedTime")
+}
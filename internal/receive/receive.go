@@ -0,0 +1,559 @@
+// Package receive stores incoming emails, which are received by SES or imported from other providers
+package receive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"github.com/harryzcy/mailbox/internal/analytics"
+	"github.com/harryzcy/mailbox/internal/attachment"
+	"github.com/harryzcy/mailbox/internal/blob"
+	"github.com/harryzcy/mailbox/internal/datasource/storage"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/history"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/push"
+	"github.com/harryzcy/mailbox/internal/rule"
+	"github.com/harryzcy/mailbox/internal/search"
+	"github.com/harryzcy/mailbox/internal/thread"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+	"github.com/harryzcy/mailbox/internal/util/addr"
+	"github.com/harryzcy/mailbox/internal/util/arf"
+	"github.com/harryzcy/mailbox/internal/util/awsutil"
+	"github.com/harryzcy/mailbox/internal/util/format"
+	"github.com/harryzcy/mailbox/internal/util/received"
+	"github.com/harryzcy/mailbox/internal/util/retryutil"
+)
+
+const StatusPass = "PASS"
+
+// Clients are created on first use, e.g. SES only when an email is redirected or a complaint is handled
+var (
+	dynamodbClient = awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+	s3Client       = awsutil.NewClient(s3.NewFromConfig)
+	sesv2Client    = awsutil.NewClient(sesv2.NewFromConfig)
+	sqsClient      = awsutil.NewClient(sqs.NewFromConfig)
+)
+
+// ErrBlocked is returned when an email is not stored because of the attachment policy
+var ErrBlocked = errors.New("email blocked by the attachment policy")
+
+// Options customizes how an email is received
+type Options struct {
+	// Import is set when the email is imported from another provider instead of received by SES
+	Import *ImportOptions
+}
+
+// ImportOptions keeps the state of an imported email in its original mailbox.
+// Imported emails are stored without calling enrichment, classification, SQS or webhooks.
+type ImportOptions struct {
+	Unread  bool
+	Flagged bool
+	Labels  []string
+}
+
+// Email stores an email received by SES, whose raw content is in S3.
+// It runs the stages of receiving an email in order, except for the ones disabled by RECEIVE_DISABLED_STAGES,
+// and applies the failure policies of RECEIVE_FAILURE_POLICY to the stages that fail.
+func Email(ctx context.Context, ses events.SimpleEmailService, opts Options) error {
+	fmt.Fprintf(os.Stdout, "received an email from %s\n", ses.Mail.Source)
+
+	// emails can be up to 40MB, which takes longer to download and parse
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	cfg, err := awsutil.LoadConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to load SDK config: %w", err)
+	}
+
+	received := history.NewEvent(history.EventReceived, "")
+	if opts.Import != nil {
+		received.Detail = "imported"
+	}
+	r := &receipt{
+		ses:    ses,
+		opts:   opts,
+		cfg:    cfg,
+		item:   make(map[string]types.AttributeValue),
+		events: []history.Event{received},
+	}
+	err = newPipeline(env.ReceiveDisabledStages, env.ReceiveFailurePolicy).run(ctx, r)
+	// the history includes failed attempts, which are retried
+	if err := history.Record(ctx, dynamodbClient.Get(cfg), ses.Mail.MessageID, r.events...); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to record history, %v\n", err)
+	}
+	if err != nil {
+		return err
+	}
+	if len(r.unsavedFailures) > 0 {
+		err = saveFailures(ctx, dynamodbClient.Get(cfg), ses.Mail.MessageID, r.unsavedFailures)
+		if err != nil {
+			// the email is stored, the failures are only logged
+			fmt.Fprintf(os.Stderr, "failed to record failed stages, %v\n", err)
+		}
+	}
+	return nil
+}
+
+// receipt is the state of an email being received, which is passed through the stages
+type receipt struct {
+	ses  events.SimpleEmailService
+	opts Options
+	cfg  aws.Config
+
+	item       map[string]types.AttributeValue // item of the email in DynamoDB
+	addresses  mailboxTypes.Addresses
+	inReplyTo  string
+	references string
+	location   storage.Location        // where the raw email is stored
+	email      *storage.GetEmailResult // parsed content of the raw email
+	report     *arf.Report             // feedback report, if the email is a complaint
+	redirects  []string                // addresses the email is redirected to by Sieve and forwarded to by rules
+	webhooks   []rule.Webhook          // webhooks of the rules that matched the email
+
+	stored          bool                 // whether the item is stored in its thread
+	failures        []email.StageFailure // stages that failed before the item is stored, which are in the item
+	unsavedFailures []email.StageFailure // stages that failed after the item is stored
+	events          []history.Event      // events recorded in the history of the email
+}
+
+// parse builds the item from the SES notification, copies the raw email to the journal, and parses the raw email
+//
+//gocyclo:ignore
+func parse(ctx context.Context, r *receipt) error {
+	ses, item := r.ses, r.item
+	item["DateSent"] = &types.AttributeValueMemberS{Value: format.Date(ses.Mail.CommonHeaders.Date)}
+
+	// YYYY-MM
+	typeYearMonth, err := format.TypeYearMonth("inbox", ses.Mail.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to format typeYearMonth: %w", err)
+	}
+	item["TypeYearMonth"] = &types.AttributeValueMemberS{Value: typeYearMonth}
+
+	item["DateTime"] = &types.AttributeValueMemberS{Value: format.DateTime(ses.Mail.Timestamp, ses.Mail.MessageID)}
+	item["MessageID"] = &types.AttributeValueMemberS{Value: ses.Mail.MessageID}                       // Generated by SES
+	item["OriginalMessageID"] = &types.AttributeValueMemberS{Value: ses.Mail.CommonHeaders.MessageID} // Original Message-ID from the email
+	item["Subject"] = &types.AttributeValueMemberS{Value: ses.Mail.CommonHeaders.Subject}
+	item["Source"] = &types.AttributeValueMemberS{Value: ses.Mail.Source}
+	// string sets can't be empty, which may happen to imported emails, e.g. without To headers
+	for name, values := range map[string][]string{
+		"Destination": ses.Mail.Destination,
+		"From":        ses.Mail.CommonHeaders.From,
+		"To":          ses.Mail.CommonHeaders.To,
+	} {
+		if len(values) > 0 {
+			item[name] = &types.AttributeValueMemberSS{Value: uniqueStrings(values)}
+		}
+	}
+	item["ReturnPath"] = &types.AttributeValueMemberS{Value: ses.Mail.CommonHeaders.ReturnPath}
+	item["Unread"] = &types.AttributeValueMemberBOOL{Value: true}
+	if r.opts.Import != nil {
+		item["Unread"] = &types.AttributeValueMemberBOOL{Value: r.opts.Import.Unread}
+		if r.opts.Import.Flagged {
+			item["Flagged"] = &types.AttributeValueMemberBOOL{Value: true}
+		}
+		if len(r.opts.Import.Labels) > 0 {
+			item["Labels"] = &types.AttributeValueMemberSS{Value: uniqueStrings(r.opts.Import.Labels)}
+		}
+	}
+
+	inReplyTo := ""
+	references := ""
+	var receivedHeaders []string
+	addresses := mailboxTypes.Addresses{
+		From:    mailboxTypes.AddressList{},
+		To:      mailboxTypes.AddressList{},
+		Cc:      mailboxTypes.AddressList{},
+		ReplyTo: mailboxTypes.AddressList{},
+	}
+	for _, header := range ses.Mail.Headers {
+		switch header.Name {
+		case "From":
+			addresses.From = addr.ParseListLenient(header.Value)
+		case "To":
+			addresses.To = addr.ParseListLenient(header.Value)
+		case "Cc":
+			addresses.Cc = addr.ParseListLenient(header.Value)
+			if len(addresses.Cc) > 0 {
+				item["Cc"] = &types.AttributeValueMemberSS{Value: uniqueStrings(addresses.Cc.Strings())}
+			}
+		case "Reply-To":
+			addresses.ReplyTo = addr.ParseListLenient(header.Value)
+			if len(addresses.ReplyTo) > 0 {
+				item["ReplyTo"] = &types.AttributeValueMemberSS{Value: uniqueStrings(addresses.ReplyTo.Strings())}
+			}
+		case "References":
+			item["References"] = &types.AttributeValueMemberS{Value: header.Value}
+			references = header.Value
+		case "In-Reply-To":
+			item["InReplyTo"] = &types.AttributeValueMemberS{Value: header.Value}
+			inReplyTo = header.Value
+		case "Received":
+			receivedHeaders = append(receivedHeaders, header.Value)
+		}
+	}
+	// From and To headers may be absent when headers are truncated
+	if len(addresses.From) == 0 {
+		addresses.From = addr.ParseListLenient(strings.Join(ses.Mail.CommonHeaders.From, ", "))
+	}
+	if len(addresses.To) == 0 {
+		addresses.To = addr.ParseListLenient(strings.Join(ses.Mail.CommonHeaders.To, ", "))
+	}
+	item["Addresses"] = addresses.ToAttributeValue()
+	r.addresses, r.inReplyTo, r.references = addresses, inReplyTo, references
+	if len(receivedHeaders) > 0 {
+		item["DeliveryPath"] = received.Parse(receivedHeaders).ToAttributeValue()
+	}
+
+	// Truncated headers are not stored, they will be read from S3 when requested
+	if !ses.Mail.HeadersTruncated {
+		headers := make(mailboxTypes.Headers, len(ses.Mail.Headers))
+		for i, header := range ses.Mail.Headers {
+			headers[i] = mailboxTypes.Header{Name: header.Name, Value: header.Value}
+		}
+		if av, err := headers.ToAttributeValue(); err == nil {
+			item["Headers"] = av
+		} else {
+			fmt.Fprintf(os.Stderr, "failed to compress headers, %v\n", err)
+		}
+	}
+
+	// The S3 action reports where the raw email is stored, e.g. when it's too large for SNS notifications
+	r.location = storage.ResolveLocation(ses.Mail.MessageID, ses.Receipt.Action.BucketName, ses.Receipt.Action.ObjectKey)
+	if r.location != storage.DefaultLocation(ses.Mail.MessageID) {
+		fmt.Printf("raw email is stored at s3://%s/%s, which differs from S3_BUCKET and S3_PREFIX\n", r.location.Bucket, r.location.Key)
+		storage.SetItemLocation(item, ses.Mail.MessageID, r.location)
+	}
+	// The journal copy is made before the email is stored, so that receiving is retried if it fails
+	if r.opts.Import == nil && storage.JournalEnabled() {
+		err = storage.JournalEmail(ctx, s3Client.Get(r.cfg), r.location, ses.Mail.MessageID)
+		if err != nil {
+			return fmt.Errorf("failed to journal email: %w", err)
+		}
+	}
+
+	r.email, err = storage.S3.GetEmailAt(ctx, s3Client.Get(r.cfg), r.location)
+	if err != nil {
+		return fmt.Errorf("failed to get object: %w", err)
+	}
+	return nil
+}
+
+// authenticate records the spam, DKIM, DMARC, SPF and virus verdicts of SES
+func authenticate(_ context.Context, r *receipt) error {
+	receipt := r.ses.Receipt
+	r.item["Verdict"] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		"Spam":  &types.AttributeValueMemberBOOL{Value: receipt.SpamVerdict.Status == StatusPass},
+		"DKIM":  &types.AttributeValueMemberBOOL{Value: receipt.DKIMVerdict.Status == StatusPass},
+		"DMARC": &types.AttributeValueMemberBOOL{Value: receipt.DKIMVerdict.Status == StatusPass},
+		"SPF":   &types.AttributeValueMemberBOOL{Value: receipt.SPFVerdict.Status == StatusPass},
+		"Virus": &types.AttributeValueMemberBOOL{Value: receipt.VirusVerdict.Status == StatusPass},
+	}}
+	if status := receipt.VirusVerdict.Status; status != "" {
+		// the status itself distinguishes infected emails from inconclusive scans, see email.ScanState
+		r.item["VirusStatus"] = &types.AttributeValueMemberS{Value: status}
+	}
+	return nil
+}
+
+// classify applies the attachment policy, which may block the email, recognizes complaints and bounces of no-reply emails,
+// annotates the email with the enrichment endpoint, trashes it if its sender is blocked,
+// and labels and scores it with the classification service unless its sender is allowed
+func classify(ctx context.Context, r *receipt) error {
+	ses, item := r.ses, r.item
+	policy := attachment.ParsePolicy(env.AttachmentPolicy)
+	var dangerous []string
+	for _, files := range []mailboxTypes.Files{r.email.Attachments, r.email.Inlines, r.email.OtherParts} {
+		dangerous = append(dangerous, attachment.Enforce(policy, files)...)
+	}
+	if len(dangerous) > 0 {
+		fmt.Printf("found dangerous attachments %q, applying attachment policy %s\n", dangerous, policy)
+		if r.opts.Import == nil {
+			sendSecurityWebhook(ctx, ses, policy, dangerous)
+		}
+		if policy == attachment.PolicyBlock {
+			// the raw email is kept in S3 for review
+			return ErrBlocked
+		}
+		r.email.Text, r.email.HTML = attachment.AppendNote(r.email.Text, r.email.HTML, attachment.Note(policy, dangerous))
+	}
+	if r.opts.Import != nil {
+		return nil
+	}
+
+	handleNoReply(item, ses)
+	if isComplaint(ses) {
+		r.report = parseComplaint(ctx, s3Client.Get(r.cfg), r.location)
+	}
+	if r.report != nil {
+		labelComplaint(item)
+	}
+
+	annotations, err := hook.Enrich(ctx, &hook.EnrichmentRequest{
+		MessageID:    ses.Mail.MessageID,
+		TimeReceived: format.RFC3399(ses.Mail.Timestamp),
+		Subject:      ses.Mail.CommonHeaders.Subject,
+		Source:       ses.Mail.Source,
+		From:         r.addresses.From.Addresses(),
+		To:           r.addresses.To.Addresses(),
+		Cc:           r.addresses.Cc.Addresses(),
+	})
+	if err != nil {
+		// the email is stored without annotations
+		fmt.Fprintf(os.Stderr, "failed to enrich email, %v\n", err)
+	} else if len(annotations) > 0 {
+		item["Annotations"] = annotations.ToAttributeValue()
+	}
+
+	if !screenSenders(ctx, dynamodbClient.Get(r.cfg), item, ses, r.addresses.From.Addresses()) {
+		classifyWithService(ctx, r)
+	}
+	return nil
+}
+
+// rules runs the Sieve script and then the filtering rules on the email, see filter and applyRules
+func rules(ctx context.Context, r *receipt) error {
+	if r.opts.Import != nil {
+		return nil
+	}
+	client := dynamodbClient.Get(r.cfg)
+	r.redirects = filter(ctx, client, r.item, r.ses, r.email.Stats.RawSize)
+
+	forwards, webhooks, err := applyRules(ctx, client, r.item, r.ses)
+	if err != nil {
+		return err
+	}
+	r.redirects = uniqueStrings(append(r.redirects, forwards...))
+	r.webhooks = webhooks
+	return nil
+}
+
+// persist adds the parsed content to the item, storing large attachments as blobs if enabled.
+// In metadata-only mode the content is only in the raw email. The expiry of the content is set if BODY_RETENTION_DAYS is set.
+func persist(ctx context.Context, r *receipt) error {
+	item := r.item
+	item["Stats"] = r.email.Stats.ToAttributeValue()
+	if expiresAt, ok := email.BodyExpiry(r.ses.Mail.Timestamp); ok {
+		item[email.BodyExpiresAtAttribute] = expiresAt
+	}
+	if !email.MetadataOnly() {
+		item["Text"] = &types.AttributeValueMemberS{Value: r.email.Text}
+		item["HTML"] = &types.AttributeValueMemberS{Value: r.email.HTML}
+		item["Attachments"] = r.email.Attachments.ToAttributeValue()
+		item["Inlines"] = r.email.Inlines.ToAttributeValue()
+		item["OtherParts"] = r.email.OtherParts.ToAttributeValue()
+		if len(r.email.AttachedEmails) > 0 {
+			item["AttachedEmails"] = r.email.AttachedEmails.ToAttributeValue()
+		}
+	}
+
+	if blob.Enabled() {
+		var files mailboxTypes.Files
+		for _, f := range []mailboxTypes.Files{r.email.Attachments, r.email.Inlines, r.email.OtherParts} {
+			files = append(files, f...)
+		}
+		blobs, err := blob.Store(ctx, blobClient{s3Client.Get(r.cfg), dynamodbClient.Get(r.cfg)}, r.location, files)
+		if err != nil {
+			// the email is stored with its large parts
+			fmt.Fprintf(os.Stderr, "failed to store blobs, %v\n", err)
+		} else if len(blobs) > 0 {
+			item["Blobs"] = &types.AttributeValueMemberSS{Value: blobs}
+		}
+	}
+	return nil
+}
+
+// storeThread stores the item in the thread of the email, see thread.StoreEmail
+func storeThread(ctx context.Context, r *receipt) error {
+	fmt.Printf("subject: %v", r.ses.Mail.CommonHeaders.Subject)
+
+	client := dynamodbClient.Get(r.cfg)
+	thread.StoreEmail(ctx, client, &thread.StoreEmailInput{
+		Item:              r.item,
+		InReplyTo:         r.inReplyTo,
+		References:        r.references,
+		OriginalMessageID: r.ses.Mail.CommonHeaders.MessageID,
+		TimeReceived:      format.RFC3399(r.ses.Mail.Timestamp),
+	})
+	r.stored = true
+
+	// imported emails may be older than the oldest month listed
+	typeYearMonth := r.item["TypeYearMonth"].(*types.AttributeValueMemberS).Value
+	if err := email.RecordMonth(ctx, client, typeYearMonth); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to record the month of the email, %v\n", err)
+	}
+	return nil
+}
+
+// notify indexes the stored email for search and counts it by sender domain,
+// then sends the receipt to SQS, webhooks and push notifications,
+// handles complaints, sends the webhooks of the rules that matched, and redirects the email
+func notify(ctx context.Context, r *receipt) error {
+	ses, item := r.ses, r.item
+	if search.Enabled() {
+		document := search.Document{
+			MessageID:    ses.Mail.MessageID,
+			TimeReceived: format.RFC3399(ses.Mail.Timestamp),
+			Subject:      ses.Mail.CommonHeaders.Subject,
+			From:         ses.Mail.CommonHeaders.From,
+			To:           append(r.addresses.To.Addresses(), r.addresses.Cc.Addresses()...),
+		}
+		if email.BodiesKept() {
+			// the index would otherwise keep the text after the bodies expire
+			document.Text = r.email.Text
+		}
+		err := search.NewClient(r.cfg).Index(ctx, document)
+		if err != nil {
+			// the email is stored, but isn't found by searches of the inbox
+			fmt.Fprintf(os.Stderr, "failed to index email, %v\n", err)
+		}
+	}
+	if r.opts.Import != nil {
+		return nil
+	}
+
+	err := analytics.RecordDomain(ctx, dynamodbClient.Get(r.cfg), analytics.NewDomainEvent(ses))
+	if err != nil {
+		// the email is stored, but isn't counted in the statistics of its sender domain
+		fmt.Fprintf(os.Stderr, "failed to record sender domain, %v\n", err)
+	}
+
+	err = hook.SendSQS(ctx, sqsClient.Get(r.cfg), hook.EmailReceipt{
+		MessageID: ses.Mail.MessageID,
+		Timestamp: ses.Mail.Timestamp.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send email receipt to SQS: %w", err)
+	}
+
+	dynamodbSvc := dynamodbClient.Get(r.cfg)
+	receivedHook := &hook.Hook{
+		Event:  hook.EventEmail,
+		Action: hook.ActionReceived,
+		Email: hook.Email{
+			ID: ses.Mail.MessageID,
+		},
+		Timestamp: ses.Mail.Timestamp.UTC().Format(time.RFC3339),
+	}
+	err = hook.Notify(ctx, dynamodbSvc, receivedHook, push.NewNotifier(dynamodbSvc), push.NewWebNotifier(dynamodbSvc),
+		analytics.NewNotifier(dynamodbSvc, r.cfg))
+	if err != nil {
+		log.Printf("failed to send notifications, %v\n", err)
+	}
+
+	var labels []string
+	if av, ok := item["Labels"].(*types.AttributeValueMemberSS); ok {
+		labels = av.Value
+	}
+	err = hook.NotifyApps(ctx, dynamodbSvc, receivedHook, labels)
+	if err != nil {
+		log.Printf("failed to send webhooks of apps, %v\n", err)
+	}
+
+	if r.report != nil {
+		complaint := handleComplaint(ctx, complaintClient{dynamodbSvc, sesv2Client.Get(r.cfg)}, ses.Mail.MessageID, r.report, isAuthenticated(ses))
+		sendComplaintWebhook(ctx, ses, complaint)
+	}
+
+	if len(r.webhooks) > 0 {
+		sendRuleWebhooks(ctx, ses, r.webhooks)
+	}
+
+	if len(r.redirects) > 0 {
+		redirectEmail(ctx, r.cfg, r.location, ses, r.redirects)
+	}
+	return nil
+}
+
+// blobClient combines the clients required to store blobs
+type blobClient struct {
+	s3Svc       *s3.Client
+	dynamodbSvc *dynamodb.Client
+}
+
+func (c blobClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return c.s3Svc.GetObject(ctx, params, optFns...)
+}
+
+func (c blobClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return c.s3Svc.PutObject(ctx, params, optFns...)
+}
+
+func (c blobClient) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return c.s3Svc.DeleteObject(ctx, params, optFns...)
+}
+
+func (c blobClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return c.dynamodbSvc.UpdateItem(ctx, params, optFns...)
+}
+
+func (c blobClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return c.dynamodbSvc.DeleteItem(ctx, params, optFns...)
+}
+
+// redirectEmail redirects the raw email to the addresses from the Sieve script and the rules, logging failures
+func redirectEmail(ctx context.Context, cfg aws.Config, location storage.Location, ses events.SimpleEmailService, addresses []string) {
+	raw, err := storage.S3.GetEmailRawAt(ctx, s3Client.Get(cfg), location)
+	if err != nil {
+		fmt.Printf("failed to get raw email to redirect, %v\n", err)
+		return
+	}
+	client := sesv2Client.Get(cfg)
+	for _, address := range addresses {
+		if err := redirect(ctx, client, raw, ses, address); err != nil {
+			fmt.Printf("failed to redirect email, %v\n", err)
+			if errors.Is(err, errAlreadyRedirected) {
+				return
+			}
+		}
+	}
+}
+
+// sendSecurityWebhook reports dangerous attachments handled by the attachment policy
+func sendSecurityWebhook(ctx context.Context, ses events.SimpleEmailService, policy attachment.Policy, attachments []string) {
+	err := hook.SendWebhook(ctx, &hook.Hook{
+		Event:  hook.EventSecurity,
+		Action: hook.ActionAttachmentsBlocked,
+		Email: hook.Email{
+			ID: ses.Mail.MessageID,
+		},
+		Security: &hook.Security{
+			Policy:      string(policy),
+			Attachments: attachments,
+		},
+		Timestamp: ses.Mail.Timestamp.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("failed to send security webhook, %v\n", err)
+	}
+}
+
+// uniqueStrings removes duplicates while preserving order, since string sets can't contain duplicates
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
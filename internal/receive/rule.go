@@ -0,0 +1,91 @@
+package receive
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/hook"
+	"github.com/harryzcy/mailbox/internal/rule"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+	"github.com/harryzcy/mailbox/internal/util/ctxutil"
+)
+
+// applyRules evaluates the filtering rules on a received email, and applies the result to its item:
+// labels are added, and the email is marked as read, or trashed.
+// The rules that matched are recorded on the item.
+// It returns the addresses the email is forwarded to, and the webhooks of the rules that matched.
+func applyRules(ctx context.Context, client api.GetItemAPI, item map[string]types.AttributeValue, ses events.SimpleEmailService) ([]string, []rule.Webhook, error) {
+	headers := make(mailboxTypes.Headers, len(ses.Mail.Headers))
+	for i, header := range ses.Mail.Headers {
+		headers[i] = mailboxTypes.Header{Name: header.Name, Value: header.Value}
+	}
+	result, err := rule.Evaluate(ctx, client, headers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to evaluate rules: %w", err)
+	}
+	if len(result.Matched) == 0 {
+		return nil, nil, nil
+	}
+	fmt.Printf("rules matched: %d, labels %q, forwards %d, webhooks %d\n",
+		len(result.Matched), result.Labels, len(result.Forward), len(result.Webhooks))
+	item["MatchedRules"] = &types.AttributeValueMemberSS{Value: result.Matched}
+
+	if len(result.Labels) > 0 {
+		var labels []string
+		if existing, ok := item["Labels"].(*types.AttributeValueMemberSS); ok {
+			labels = existing.Value
+		}
+		labels = uniqueStrings(append(labels, result.Labels...))
+		if len(labels) > email.MaxLabels {
+			labels = labels[:email.MaxLabels]
+		}
+		item["Labels"] = &types.AttributeValueMemberSS{Value: labels}
+	}
+	if result.MarkRead {
+		item["Unread"] = &types.AttributeValueMemberBOOL{Value: false}
+	}
+	if result.Trash {
+		// trashed emails are recoverable from trash
+		if _, ok := item["TrashedTime"]; !ok {
+			item["TrashedTime"] = &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+		}
+	}
+	return result.Forward, result.Webhooks, nil
+}
+
+// sendRuleWebhooks sends a hook of a received email to the webhooks of the rules that matched it, logging failures.
+// The hooks are signed with the secrets of the rules, and all of them are sent within HOOK_TIMEOUT.
+func sendRuleWebhooks(ctx context.Context, ses events.SimpleEmailService, webhooks []rule.Webhook) {
+	ctx, cancel := ctxutil.WithTimeout(ctx, env.HookTimeout, hook.DefaultHookTimeout)
+	defer cancel()
+
+	for _, webhook := range webhooks {
+		err := hook.SendWebhookTo(ctx, hook.WebhookEndpoint{
+			URL:           webhook.URL,
+			Proxy:         env.WebhookProxy,
+			SigningSecret: webhook.Secret,
+		}, &hook.Hook{
+			Event:  hook.EventEmail,
+			Action: hook.ActionRuleMatched,
+			Email: hook.Email{
+				ID: ses.Mail.MessageID,
+			},
+			Rule: &hook.Rule{
+				ID:   webhook.RuleID,
+				Name: webhook.RuleName,
+			},
+			Timestamp: ses.Mail.Timestamp.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			log.Printf("failed to send webhook of rule %s, %v\n", webhook.RuleID, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package receive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/rule"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockRulesAPI map[string]rule.Rule
+
+func (m mockRulesAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	rules := make(map[string]types.AttributeValue, len(m))
+	for id, r := range m {
+		av, err := attributevalue.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		rules[id] = av
+	}
+	return &dynamodb.GetItemOutput{
+		Item: map[string]types.AttributeValue{"Rules": &types.AttributeValueMemberM{Value: rules}},
+	}, nil
+}
+
+func TestApplyRules(t *testing.T) {
+	client := mockRulesAPI{
+		"news": {Secret: "secret", TimeCreated: "2024-05-01T12:00:00Z", Definition: rule.Definition{
+			Name:       "News",
+			Match:      rule.MatchAll,
+			Conditions: []rule.Condition{{Field: rule.FieldFrom, Operator: rule.OperatorEndsWith, Value: "@news.example.com"}},
+			Actions: rule.Actions{
+				Labels:   []string{"news"},
+				MarkRead: true,
+				Trash:    true,
+				Forward:  []string{"alice@example.com"},
+				Webhook:  "https://example.com/hooks",
+			},
+		}},
+	}
+	ses := events.SimpleEmailService{
+		Mail: events.SimpleEmailMessage{
+			Headers: []events.SimpleEmailHeader{{Name: "From", Value: "Weekly <weekly@news.example.com>"}},
+		},
+	}
+	item := map[string]types.AttributeValue{
+		"Labels": &types.AttributeValueMemberSS{Value: []string{"lists"}},
+		"Unread": &types.AttributeValueMemberBOOL{Value: true},
+	}
+
+	forwards, webhooks, err := applyRules(context.TODO(), client, item, ses)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"alice@example.com"}, forwards)
+	assert.Equal(t, []rule.Webhook{{RuleID: "news", RuleName: "News", URL: "https://example.com/hooks", Secret: "secret"}}, webhooks)
+	assert.Equal(t, &types.AttributeValueMemberSS{Value: []string{"news"}}, item["MatchedRules"])
+	assert.Equal(t, &types.AttributeValueMemberSS{Value: []string{"lists", "news"}}, item["Labels"])
+	assert.Equal(t, &types.AttributeValueMemberBOOL{Value: false}, item["Unread"])
+	assert.NotNil(t, item["TrashedTime"])
+
+	// emails that match no rules are left as they are
+	ses.Mail.Headers[0].Value = "someone@example.com"
+	item = map[string]types.AttributeValue{}
+	forwards, webhooks, err = applyRules(context.TODO(), client, item, ses)
+	assert.Nil(t, err)
+	assert.Nil(t, forwards)
+	assert.Nil(t, webhooks)
+	assert.Empty(t, item)
+}
@@ -0,0 +1,97 @@
+package receive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/senders"
+)
+
+// screenSenders checks the From addresses and the envelope sender of the email against the block and allow lists of senders.
+// Emails from blocked senders are trashed, and true is returned for allowed senders, whose emails skip the classification service.
+// Since addresses can be forged, an allowed address is only honoured if it's authenticated, see senderAuthenticated,
+// and then it takes precedence over the block list, except for a blocked envelope sender.
+// If the lists can't be read, the email is received as if they're empty.
+func screenSenders(ctx context.Context, client api.GetItemAPI, item map[string]types.AttributeValue, ses events.SimpleEmailService, from []string) bool {
+	lists, err := senders.Get(ctx, client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get sender lists, %v\n", err)
+		return false
+	}
+	if lists.IsBlocked(ses.Mail.Source) {
+		trashBlocked(item)
+		return false
+	}
+	for _, address := range from {
+		if lists.IsAllowed(address) && senderAuthenticated(ses, address, false) {
+			fmt.Println("sender is allowed, skipping classification")
+			return true
+		}
+	}
+	if lists.IsAllowed(ses.Mail.Source) && senderAuthenticated(ses, ses.Mail.Source, true) {
+		fmt.Println("sender is allowed, skipping classification")
+		return true
+	}
+	if lists.IsBlocked(from...) {
+		trashBlocked(item)
+	}
+	return false
+}
+
+// trashBlocked marks the email of a blocked sender as trashed
+func trashBlocked(item map[string]types.AttributeValue) {
+	fmt.Println("sender is blocked, trashing email")
+	// trashed emails are recoverable from trash
+	if _, ok := item["TrashedTime"]; !ok {
+		item["TrashedTime"] = &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+	}
+}
+
+// senderAuthenticated returns true if an address of the email is authenticated:
+// a From address by DMARC, the envelope sender by SPF, or either by DKIM if all signatures align with its domain,
+// since SES doesn't report which of them passes.
+func senderAuthenticated(ses events.SimpleEmailService, address string, envelope bool) bool {
+	if !envelope && ses.Receipt.DMARCVerdict.Status == StatusPass {
+		return true
+	}
+	if envelope && ses.Receipt.SPFVerdict.Status == StatusPass {
+		return true
+	}
+	if ses.Receipt.DKIMVerdict.Status != StatusPass || ses.Mail.HeadersTruncated {
+		return false
+	}
+	_, domain, ok := strings.Cut(strings.ToLower(strings.TrimSpace(address)), "@")
+	if !ok {
+		return false
+	}
+	signed := false
+	for _, header := range ses.Mail.Headers {
+		if !strings.EqualFold(header.Name, "DKIM-Signature") {
+			continue
+		}
+		signingDomain := dkimDomain(header.Value)
+		if signingDomain == "" || (domain != signingDomain && !strings.HasSuffix(domain, "."+signingDomain)) {
+			return false
+		}
+		signed = true
+	}
+	return signed
+}
+
+// dkimDomain returns the signing domain, the d= tag, of a DKIM-Signature header
+func dkimDomain(signature string) string {
+	for _, tag := range strings.Split(signature, ";") {
+		name, value, ok := strings.Cut(tag, "=")
+		if ok && strings.TrimSpace(name) == "d" {
+			return strings.ToLower(strings.Join(strings.Fields(value), ""))
+		}
+	}
+	return ""
+}
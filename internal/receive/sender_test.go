@@ -0,0 +1,103 @@
+package receive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSendersAPI struct{}
+
+func (mockSendersAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+		"Blocked": &types.AttributeValueMemberSS{Value: []string{"ads.example.com", "spam@example.net"}},
+		"Allowed": &types.AttributeValueMemberSS{Value: []string{"partner@ads.example.com"}},
+	}}, nil
+}
+
+func TestScreenSenders(t *testing.T) {
+	ses := events.SimpleEmailService{}
+	ses.Mail.Source = "bounces@mailer.example.org"
+	ses.Receipt.DMARCVerdict.Status = StatusPass
+
+	// blocked by the From address
+	item := map[string]types.AttributeValue{}
+	allowed := screenSenders(context.TODO(), mockSendersAPI{}, item, ses, []string{"news@ads.example.com"})
+	assert.False(t, allowed)
+	assert.NotNil(t, item["TrashedTime"])
+
+	// blocked by the envelope sender
+	item = map[string]types.AttributeValue{}
+	ses.Mail.Source = "spam@example.net"
+	allowed = screenSenders(context.TODO(), mockSendersAPI{}, item, ses, []string{"alice@example.org"})
+	assert.False(t, allowed)
+	assert.NotNil(t, item["TrashedTime"])
+
+	// the allow list takes precedence over blocked From addresses
+	item = map[string]types.AttributeValue{}
+	ses.Mail.Source = "bounces@mailer.example.org"
+	allowed = screenSenders(context.TODO(), mockSendersAPI{}, item, ses, []string{"partner@ads.example.com"})
+	assert.True(t, allowed)
+	assert.Empty(t, item)
+
+	// but not over a blocked envelope sender
+	ses.Mail.Source = "bounces@ads.example.com"
+	allowed = screenSenders(context.TODO(), mockSendersAPI{}, item, ses, []string{"partner@ads.example.com"})
+	assert.False(t, allowed)
+	assert.NotNil(t, item["TrashedTime"])
+
+	// unless DMARC passes
+	for _, status := range []string{StatusFail, "GRAY", ""} {
+		item = map[string]types.AttributeValue{}
+		ses.Mail.Source = "bounces@mailer.example.org"
+		ses.Receipt.DMARCVerdict.Status = status
+		allowed = screenSenders(context.TODO(), mockSendersAPI{}, item, ses, []string{"partner@ads.example.com"})
+		assert.False(t, allowed, status)
+		assert.NotNil(t, item["TrashedTime"], status)
+	}
+
+	// other senders are received as usual
+	item = map[string]types.AttributeValue{}
+	ses.Mail.Source = "bob@example.org"
+	allowed = screenSenders(context.TODO(), mockSendersAPI{}, item, ses, []string{"bob@example.org"})
+	assert.False(t, allowed)
+	assert.Empty(t, item)
+}
+
+func TestSenderAuthenticated(t *testing.T) {
+	ses := events.SimpleEmailService{}
+	ses.Receipt.DMARCVerdict.Status = StatusPass
+	assert.True(t, senderAuthenticated(ses, "alice@example.com", false))
+	// DMARC authenticates the From address only
+	assert.False(t, senderAuthenticated(ses, "alice@example.com", true))
+
+	ses = events.SimpleEmailService{}
+	ses.Receipt.SPFVerdict.Status = StatusPass
+	assert.True(t, senderAuthenticated(ses, "bounces@example.com", true))
+	assert.False(t, senderAuthenticated(ses, "alice@example.com", false))
+
+	ses = events.SimpleEmailService{}
+	ses.Receipt.DKIMVerdict.Status = StatusPass
+	assert.False(t, senderAuthenticated(ses, "alice@example.com", false), "unsigned")
+	ses.Mail.Headers = []events.SimpleEmailHeader{
+		{Name: "DKIM-Signature", Value: "v=1; a=rsa-sha256; d=Example.com;\r\n s=selector; h=from:to; bh=abc; b=def"},
+	}
+	assert.True(t, senderAuthenticated(ses, "alice@example.com", false))
+	assert.True(t, senderAuthenticated(ses, "bounces@mail.example.com", true))
+	assert.False(t, senderAuthenticated(ses, "alice@notexample.com", false))
+
+	// every signature must align, since the one that passes is unknown
+	ses.Mail.Headers = append(ses.Mail.Headers, events.SimpleEmailHeader{Name: "DKIM-Signature", Value: "v=1; d=esp.example.net; s=s1; b=ghi"})
+	assert.False(t, senderAuthenticated(ses, "alice@example.com", false))
+
+	ses.Mail.Headers = ses.Mail.Headers[:1]
+	ses.Mail.HeadersTruncated = true
+	assert.False(t, senderAuthenticated(ses, "alice@example.com", false))
+	ses.Mail.HeadersTruncated = false
+	ses.Receipt.DKIMVerdict.Status = "GRAY"
+	assert.False(t, senderAuthenticated(ses, "alice@example.com", false))
+}
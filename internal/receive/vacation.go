@@ -0,0 +1,69 @@
+package receive
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+	"github.com/harryzcy/mailbox/internal/vacation"
+)
+
+// StatusFail is the status of SES verdicts of spam and viruses that are found
+const StatusFail = "FAIL"
+
+// reply sends the automatic reply of the vacation responder to the email, see vacation.Reply.
+// Imported emails, spam, bounces, complaints, emails trashed by the rules and emails received at NO_REPLY_ADDRESS aren't replied to.
+func reply(ctx context.Context, r *receipt) error {
+	if r.opts.Import != nil || !repliable(r) {
+		return nil
+	}
+	return sendReply(ctx, vacationClient{dynamodbClient.Get(r.cfg), sesv2Client.Get(r.cfg)}, r)
+}
+
+// sendReply sends the automatic reply to an email that can be replied to
+func sendReply(ctx context.Context, client vacation.ReplyAPI, r *receipt) error {
+	ses := r.ses
+	headers := make(mailboxTypes.Headers, len(ses.Mail.Headers))
+	for i, header := range ses.Mail.Headers {
+		headers[i] = mailboxTypes.Header{Name: header.Name, Value: header.Value}
+	}
+	sent, err := vacation.Reply(ctx, client, vacation.Email{
+		MessageID:  ses.Mail.CommonHeaders.MessageID,
+		References: r.references,
+		Subject:    ses.Mail.CommonHeaders.Subject,
+		Sender:     ses.Mail.Source,
+		Recipient:  redirectingRecipient(ses),
+		Headers:    headers,
+		Time:       ses.Mail.Timestamp,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send automatic reply: %w", err)
+	}
+	if sent {
+		fmt.Println("sent automatic reply")
+	}
+	return nil
+}
+
+// repliable returns false for emails that are never replied to automatically, before the headers are checked
+func repliable(r *receipt) bool {
+	receipt := r.ses.Receipt
+	if receipt.SpamVerdict.Status == StatusFail || receipt.VirusVerdict.Status == StatusFail {
+		return false
+	}
+	if r.report != nil || isBounce(r.ses) {
+		return false
+	}
+	if _, trashed := r.item["TrashedTime"]; trashed {
+		return false
+	}
+	return env.NoReplyAddress == "" || !receivedAt(r.ses, env.NoReplyAddress)
+}
+
+// vacationClient combines the clients required to send automatic replies
+type vacationClient struct {
+	clients.Table
+	clients.Mailer
+}
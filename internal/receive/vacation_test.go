@@ -0,0 +1,72 @@
+package receive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/vacation"
+)
+
+func TestSendReply(t *testing.T) {
+	settings, err := attributevalue.MarshalMap(vacation.Settings{Enabled: true, Text: "Away until Monday", IntervalDays: 7})
+	assert.Nil(t, err)
+
+	recorded := ""
+	var sent *sesv2.SendEmailInput
+	client := vacationClient{
+		Table: clients.Fake{
+			MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return &dynamodb.GetItemOutput{Item: settings}, nil
+			},
+			MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+				recorded = params.Item["MessageID"].(*types.AttributeValueMemberS).Value
+				return &dynamodb.PutItemOutput{}, nil
+			},
+		},
+		Mailer: clients.Fake{
+			MockSendEmail: func(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+				sent = params
+				return &sesv2.SendEmailOutput{}, nil
+			},
+		},
+	}
+	r := &receipt{
+		ses: events.SimpleEmailService{
+			Mail: events.SimpleEmailMessage{
+				Source:        "alice@example.org",
+				Timestamp:     time.Now(),
+				CommonHeaders: events.SimpleEmailCommonHeaders{MessageID: "<id@example.org>", Subject: "Lunch"},
+			},
+			Receipt: events.SimpleEmailReceipt{Recipients: []string{"me@example.com"}},
+		},
+	}
+
+	assert.Nil(t, sendReply(context.TODO(), client, r))
+	assert.Equal(t, "vacation#sender#alice@example.org", recorded)
+	if assert.NotNil(t, sent) {
+		assert.Equal(t, []string{"alice@example.org"}, sent.Destination.ToAddresses)
+	}
+}
+
+func TestSendReply_Failed(t *testing.T) {
+	client := vacationClient{
+		Table: clients.Fake{
+			MockGetItem: func(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				return nil, errors.New("get failed")
+			},
+		},
+		Mailer: clients.Fake{},
+	}
+	err := sendReply(context.TODO(), client, &receipt{})
+	assert.EqualError(t, err, "failed to send automatic reply: get failed")
+}
@@ -0,0 +1,70 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// Compose returns the subject, text and HTML body of the email of a report
+func Compose(report *Report) (subject, text, htmlBody string) {
+	title := report.Month
+	if t, err := time.Parse(monthLayout, report.Month); err == nil {
+		title = t.Format("January 2006")
+	}
+	subject = "Monthly report: " + title
+
+	lines := []string{
+		fmt.Sprintf("Received: %d", report.Received),
+		fmt.Sprintf("Sent: %d", report.Sent),
+		fmt.Sprintf("Spam: %d, %.1f%% of checked emails", report.Spam, report.SpamRate*100),
+		"Storage growth: " + formatBytes(report.StorageBytes),
+	}
+	if previous := report.Previous; previous != nil {
+		lines[0] += " (" + change(int64(report.Received), int64(previous.Received)) + ")"
+		lines[1] += " (" + change(int64(report.Sent), int64(previous.Sent)) + ")"
+		lines[2] += " (" + change(int64(report.Spam), int64(previous.Spam)) + ")"
+		lines[3] += " (" + change(report.StorageBytes, previous.StorageBytes) + ")"
+	}
+	intro := "Mailbox usage in " + title
+	if report.Previous != nil {
+		intro += ", compared with the previous month"
+	}
+	intro += ":"
+
+	var t, h strings.Builder
+	t.WriteString(intro + "\n\n")
+	h.WriteString("<p>" + html.EscapeString(intro) + "</p>\n<ul>\n")
+	for _, line := range lines {
+		t.WriteString(line + "\n")
+		h.WriteString("<li>" + html.EscapeString(line) + "</li>\n")
+	}
+	h.WriteString("</ul>\n")
+
+	if len(report.TopSenders) > 0 {
+		t.WriteString("\nTop senders:\n")
+		h.WriteString("<p>Top senders:</p>\n<ol>\n")
+		for _, sender := range report.TopSenders {
+			line := fmt.Sprintf("%s: %d", sender.Address, sender.Count)
+			t.WriteString("  " + line + "\n")
+			h.WriteString("<li>" + html.EscapeString(line) + "</li>\n")
+		}
+		h.WriteString("</ol>\n")
+	}
+	return subject, t.String(), h.String()
+}
+
+// formatBytes formats a size in bytes with a binary unit, e.g. 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,295 @@
+// Package report generates monthly reports of the usage of the mailbox, such as the number of received and sent emails,
+// the top senders, the spam rate and the storage growth, compared with the previous month.
+// Reports are stored in the email table, so that they can be retrieved after they're generated.
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+const (
+	// TopSenders is the number of senders listed in a report
+	TopSenders = 10
+
+	monthLayout     = "2006-01"
+	maxBatchGetKeys = 100
+)
+
+var getCurrentTime = func() time.Time {
+	return time.Now().UTC()
+}
+
+// GenerateAPI defines set of API required to generate a report
+type GenerateAPI interface {
+	api.QueryAPI
+	api.BatchGetItemAPI // to get the verdicts of received emails, which aren't in the time index
+	api.GetItemAPI      // to get the report of the previous month
+	api.PutItemAPI      // to save the report
+}
+
+// Totals are the counts and sizes of the emails of a month
+type Totals struct {
+	Received     int   `json:"received"`
+	Sent         int   `json:"sent"`
+	Spam         int   `json:"spam"`         // received emails that failed the spam check
+	StorageBytes int64 `json:"storageBytes"` // total raw size of received and sent emails
+}
+
+// SenderCount is a sender and the number of emails received from it
+type SenderCount struct {
+	Address string `json:"address"`
+	Count   int    `json:"count"`
+}
+
+// Report is the report of a month, where months are in TIME_ZONE, as the monthly partitions of the table
+type Report struct {
+	Month string `json:"month" dynamodbav:"-"` // YYYY-MM
+	Totals
+	SpamRate      float64       `json:"spamRate"` // ratio of spam in received emails with a verdict, from 0 to 1
+	TopSenders    []SenderCount `json:"topSenders"`
+	Previous      *Totals       `json:"previous,omitempty"` // totals of the previous month, if it's reported
+	TimeGenerated string        `json:"timeGenerated"`
+}
+
+// monthItem is an email in the time index
+type monthItem struct {
+	MessageID string
+	From      []string
+	Stats     *mailboxTypes.EmailStats
+}
+
+// PreviousMonth returns the month before the current one, which is reported by default
+func PreviousMonth() string {
+	current := getCurrentTime().In(format.BucketLocation())
+	first := time.Date(current.Year(), current.Month(), 1, 0, 0, 0, 0, current.Location())
+	return first.AddDate(0, -1, 0).Format(monthLayout)
+}
+
+// parseMonth returns the first moment of a month in the format of YYYY-MM
+func parseMonth(month string) (time.Time, error) {
+	t, err := time.ParseInLocation(monthLayout, month, format.BucketLocation())
+	if err != nil || t.Format(monthLayout) != month {
+		return time.Time{}, api.ErrInvalidInput
+	}
+	return t, nil
+}
+
+// Generate generates the report of a month, or of the previous month if month is empty, and saves it,
+// replacing the saved report of the month, if any. Months that haven't started are rejected with api.ErrInvalidInput.
+func Generate(ctx context.Context, client GenerateAPI, month string) (*Report, error) {
+	if month == "" {
+		month = PreviousMonth()
+	}
+	start, err := parseMonth(month)
+	if err != nil {
+		return nil, err
+	}
+	if start.After(getCurrentTime()) {
+		return nil, api.ErrInvalidInput
+	}
+
+	received, err := queryMonth(ctx, client, email.EmailTypeInbox+"#"+month)
+	if err != nil {
+		return nil, err
+	}
+	sent, err := queryMonth(ctx, client, email.EmailTypeSent+"#"+month)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Month: month,
+		Totals: Totals{
+			Received:     len(received),
+			Sent:         len(sent),
+			StorageBytes: storageBytes(received) + storageBytes(sent),
+		},
+		TopSenders:    topSenders(received, TopSenders),
+		TimeGenerated: getCurrentTime().Format(time.RFC3339),
+	}
+
+	messageIDs := make([]string, len(received))
+	for i, item := range received {
+		messageIDs[i] = item.MessageID
+	}
+	spam, checked, err := countSpam(ctx, client, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	report.Spam = spam
+	if checked > 0 {
+		report.SpamRate = float64(spam) / float64(checked)
+	}
+
+	previous, err := Get(ctx, client, start.AddDate(0, -1, 0).Format(monthLayout))
+	if err != nil && err != api.ErrNotFound {
+		return nil, err
+	}
+	if previous != nil {
+		report.Previous = &previous.Totals
+	}
+
+	if err := save(ctx, client, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// queryMonth returns the emails in a partition of the time index, e.g. inbox#2024-05
+func queryMonth(ctx context.Context, client api.QueryAPI, typeYearMonth string) ([]monthItem, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(env.TableName),
+		IndexName:              aws.String(env.GsiIndexName),
+		KeyConditionExpression: aws.String("#tym = :tym"),
+		ExpressionAttributeNames: map[string]string{
+			"#tym":  "TypeYearMonth",
+			"#from": "From",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":tym": &types.AttributeValueMemberS{Value: typeYearMonth},
+		},
+		ProjectionExpression: aws.String("MessageID, #from, Stats"),
+	}
+
+	var items []monthItem
+	for {
+		output, err := client.Query(ctx, input)
+		if err != nil {
+			if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return nil, api.ErrTooManyRequests
+			}
+			return nil, err
+		}
+		var page []monthItem
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+		if len(output.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+// countSpam returns the number of emails that failed the spam check, and the number of emails with a verdict
+func countSpam(ctx context.Context, client api.BatchGetItemAPI, messageIDs []string) (spam, checked int, err error) {
+	keys := make([]map[string]types.AttributeValue, len(messageIDs))
+	for i, messageID := range messageIDs {
+		keys[i] = map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		}
+	}
+
+	for len(keys) > 0 {
+		n := min(len(keys), maxBatchGetKeys)
+		output, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				env.TableName: {
+					Keys:                 keys[:n],
+					ProjectionExpression: aws.String("Verdict"),
+				},
+			},
+		})
+		if err != nil {
+			if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+				return 0, 0, api.ErrTooManyRequests
+			}
+			return 0, 0, err
+		}
+		keys = keys[n:]
+		if unprocessed, ok := output.UnprocessedKeys[env.TableName]; ok {
+			keys = append(keys, unprocessed.Keys...)
+		}
+
+		for _, item := range output.Responses[env.TableName] {
+			av, ok := item["Verdict"]
+			if !ok {
+				continue
+			}
+			verdict := email.Verdict{}
+			if err := attributevalue.Unmarshal(av, &verdict); err != nil {
+				return 0, 0, err
+			}
+			checked++
+			// Spam is true if the email passed the spam check
+			if !verdict.Spam {
+				spam++
+			}
+		}
+	}
+	return spam, checked, nil
+}
+
+// storageBytes returns the total raw size of emails, where emails without stats are counted as empty
+func storageBytes(items []monthItem) int64 {
+	var total int64
+	for _, item := range items {
+		if item.Stats != nil {
+			total += item.Stats.RawSize
+		}
+	}
+	return total
+}
+
+// topSenders returns the n senders with the most emails, by the address of their first From address
+func topSenders(items []monthItem, n int) []SenderCount {
+	counts := make(map[string]int)
+	for _, item := range items {
+		if len(item.From) == 0 {
+			continue
+		}
+		counts[senderAddress(item.From[0])]++
+	}
+
+	senders := make([]SenderCount, 0, len(counts))
+	for address, count := range counts {
+		senders = append(senders, SenderCount{Address: address, Count: count})
+	}
+	sort.Slice(senders, func(i, j int) bool {
+		if senders[i].Count != senders[j].Count {
+			return senders[i].Count > senders[j].Count
+		}
+		return senders[i].Address < senders[j].Address
+	})
+	if len(senders) > n {
+		senders = senders[:n]
+	}
+	return senders
+}
+
+// senderAddress returns the lowercase address of a From address, or the trimmed value if it can't be parsed
+func senderAddress(from string) string {
+	if address, err := mail.ParseAddress(from); err == nil {
+		return strings.ToLower(address.Address)
+	}
+	return strings.ToLower(strings.TrimSpace(from))
+}
+
+// change formats the change of a value from the previous month, e.g. +12%
+func change(current, previous int64) string {
+	if previous == 0 {
+		if current == 0 {
+			return "no change"
+		}
+		return "new"
+	}
+	return fmt.Sprintf("%+.0f%%", float64(current-previous)/float64(previous)*100)
+}
@@ -0,0 +1,168 @@
+package report
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+)
+
+func TestPreviousMonth(t *testing.T) {
+	getCurrentTime = func() time.Time { return time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC) }
+	defer func() { getCurrentTime = func() time.Time { return time.Now().UTC() } }()
+
+	assert.Equal(t, "2023-12", PreviousMonth())
+}
+
+func TestTopSenders(t *testing.T) {
+	items := []monthItem{
+		{From: []string{"Alice <alice@example.com>"}},
+		{From: []string{"ALICE@example.com"}},
+		{From: []string{"bob@example.com"}},
+		{From: []string{"carol@example.com", "dave@example.com"}},
+		{From: []string{"carol@example.com"}},
+		{},
+	}
+	assert.Equal(t, []SenderCount{
+		{Address: "alice@example.com", Count: 2},
+		{Address: "carol@example.com", Count: 2},
+	}, topSenders(items, 2))
+}
+
+func TestGenerate(t *testing.T) {
+	getCurrentTime = func() time.Time { return time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC) }
+	defer func() { getCurrentTime = func() time.Time { return time.Now().UTC() } }()
+
+	stats := func(size int64) *types.AttributeValueMemberM {
+		return mailboxTypes.EmailStats{RawSize: size}.ToAttributeValue().(*types.AttributeValueMemberM)
+	}
+	verdict := func(spam bool) *types.AttributeValueMemberM {
+		return &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"Spam": &types.AttributeValueMemberBOOL{Value: spam},
+		}}
+	}
+	partitions := map[string][]map[string]types.AttributeValue{
+		"inbox#2024-05": {
+			{"MessageID": &types.AttributeValueMemberS{Value: "first"}, "From": &types.AttributeValueMemberSS{Value: []string{"alice@example.com"}}, "Stats": stats(1000)},
+			{"MessageID": &types.AttributeValueMemberS{Value: "second"}, "From": &types.AttributeValueMemberSS{Value: []string{"alice@example.com"}}, "Stats": stats(2000)},
+			{"MessageID": &types.AttributeValueMemberS{Value: "third"}, "From": &types.AttributeValueMemberSS{Value: []string{"spammer@example.com"}}},
+		},
+		"sent#2024-05": {
+			{"MessageID": &types.AttributeValueMemberS{Value: "sent"}, "From": &types.AttributeValueMemberSS{Value: []string{"me@example.com"}}, "Stats": stats(500)},
+		},
+	}
+	verdicts := map[string]map[string]types.AttributeValue{
+		"first": {"Verdict": verdict(true)},
+		"third": {"Verdict": verdict(false)},
+	}
+
+	saved := make(map[string]map[string]types.AttributeValue)
+	saved[itemPrefix+"2024-04"] = map[string]types.AttributeValue{
+		"MessageID":    &types.AttributeValueMemberS{Value: itemPrefix + "2024-04"},
+		"Received":     &types.AttributeValueMemberN{Value: "2"},
+		"Sent":         &types.AttributeValueMemberN{Value: "2"},
+		"Spam":         &types.AttributeValueMemberN{Value: "0"},
+		"StorageBytes": &types.AttributeValueMemberN{Value: "1000"},
+	}
+
+	client := clients.Fake{
+		MockQuery: func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			tym := params.ExpressionAttributeValues[":tym"].(*types.AttributeValueMemberS).Value
+			return &dynamodb.QueryOutput{Items: partitions[tym]}, nil
+		},
+		MockBatchGetItem: func(_ context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+			request := params.RequestItems[env.TableName]
+			assert.Equal(t, "Verdict", *request.ProjectionExpression)
+			output := &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{}}
+			for _, key := range request.Keys {
+				messageID := key["MessageID"].(*types.AttributeValueMemberS).Value
+				item, ok := verdicts[messageID]
+				if !ok {
+					item = map[string]types.AttributeValue{}
+				}
+				output.Responses[env.TableName] = append(output.Responses[env.TableName], item)
+			}
+			return output, nil
+		},
+		MockGetItem: func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: saved[params.Key["MessageID"].(*types.AttributeValueMemberS).Value]}, nil
+		},
+		MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			saved[params.Item["MessageID"].(*types.AttributeValueMemberS).Value] = params.Item
+			return &dynamodb.PutItemOutput{}, nil
+		},
+	}
+
+	expected := &Report{
+		Month: "2024-05",
+		Totals: Totals{
+			Received:     3,
+			Sent:         1,
+			Spam:         1,
+			StorageBytes: 3500,
+		},
+		SpamRate: 0.5,
+		TopSenders: []SenderCount{
+			{Address: "alice@example.com", Count: 2},
+			{Address: "spammer@example.com", Count: 1},
+		},
+		Previous:      &Totals{Received: 2, Sent: 2, StorageBytes: 1000},
+		TimeGenerated: "2024-06-01T03:00:00Z",
+	}
+	report, err := Generate(context.TODO(), client, "")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, report)
+
+	report, err = Get(context.TODO(), client, "2024-05")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, report)
+
+	_, err = Get(context.TODO(), client, "2024-03")
+	assert.Equal(t, api.ErrNotFound, err)
+}
+
+func TestGenerate_InvalidMonth(t *testing.T) {
+	getCurrentTime = func() time.Time { return time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC) }
+	defer func() { getCurrentTime = func() time.Time { return time.Now().UTC() } }()
+
+	for _, month := range []string{"2024-13", "2024-5", "202405", "2024-07"} {
+		t.Run(month, func(t *testing.T) {
+			_, err := Generate(context.TODO(), clients.Fake{}, month)
+			assert.Equal(t, api.ErrInvalidInput, err)
+		})
+	}
+}
+
+func TestCompose(t *testing.T) {
+	report := &Report{
+		Month:      "2024-05",
+		Totals:     Totals{Received: 30, Sent: 5, Spam: 3, StorageBytes: 3 << 20},
+		SpamRate:   0.1,
+		TopSenders: []SenderCount{{Address: "<alice>@example.com", Count: 12}},
+		Previous:   &Totals{Received: 20, Sent: 5, Spam: 0, StorageBytes: 2 << 20},
+	}
+	subject, text, htmlBody := Compose(report)
+	assert.Equal(t, "Monthly report: May 2024", subject)
+	assert.Equal(t, "Mailbox usage in May 2024, compared with the previous month:\n\n"+
+		"Received: 30 (+50%)\n"+
+		"Sent: 5 (+0%)\n"+
+		"Spam: 3, 10.0% of checked emails (new)\n"+
+		"Storage growth: 3.0 MiB (+50%)\n"+
+		"\nTop senders:\n"+
+		"  <alice>@example.com: 12\n", text)
+	assert.Contains(t, htmlBody, "<li>&lt;alice&gt;@example.com: 12</li>")
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "2.0 GiB", formatBytes(2<<30))
+}
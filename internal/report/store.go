@@ -0,0 +1,68 @@
+package report
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// itemPrefix is the prefix of the MessageID of the items storing monthly reports in the email table
+const itemPrefix = "report#monthly#"
+
+// Get returns the saved report of a month in the format of YYYY-MM,
+// or api.ErrNotFound if the month isn't reported
+func Get(ctx context.Context, client api.GetItemAPI, month string) (*Report, error) {
+	if _, err := parseMonth(month); err != nil {
+		return nil, err
+	}
+
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: itemPrefix + month},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, api.ErrNotFound
+	}
+
+	report := &Report{}
+	if err = attributevalue.UnmarshalMap(resp.Item, report); err != nil {
+		return nil, err
+	}
+	report.Month = month
+	return report, nil
+}
+
+// save replaces the saved report of a month
+func save(ctx context.Context, client api.PutItemAPI, report *Report) error {
+	item, err := attributevalue.MarshalMap(report)
+	if err != nil {
+		return err
+	}
+	item["MessageID"] = &types.AttributeValueMemberS{Value: itemPrefix + report.Month}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item:      item,
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package rule
+
+import (
+	"context"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/types"
+)
+
+var wordDecoder = new(mime.WordDecoder)
+
+// Result is what the matching rules do to an email, combined in the order of the rules
+type Result struct {
+	Matched  []string // IDs of the matching rules
+	Labels   []string
+	MarkRead bool
+	Trash    bool
+	Forward  []string
+	Webhooks []Webhook
+}
+
+// Webhook is a hook to send by the Webhook action of a matching rule
+type Webhook struct {
+	RuleID   string
+	RuleName string
+	URL      string
+	Secret   string
+}
+
+// Evaluate runs the enabled rules on the header fields of a received email, and returns what they do to it.
+// A rule with Stop skips the rules after it if it matches.
+func Evaluate(ctx context.Context, client api.GetItemAPI, headers types.Headers) (*Result, error) {
+	rules, err := load(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return evaluate(rules, newMessage(headers)), nil
+}
+
+func evaluate(rules []Rule, msg message) *Result {
+	result := &Result{}
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Disabled || !rule.matches(msg) {
+			continue
+		}
+
+		result.Matched = append(result.Matched, rule.ID)
+		for _, label := range rule.Actions.Labels {
+			if !seen["label:"+label] {
+				seen["label:"+label] = true
+				result.Labels = append(result.Labels, label)
+			}
+		}
+		result.MarkRead = result.MarkRead || rule.Actions.MarkRead
+		result.Trash = result.Trash || rule.Actions.Trash
+		for _, address := range rule.Actions.Forward {
+			key := "forward:" + strings.ToLower(address)
+			if !seen[key] && len(result.Forward) < MaxForwards {
+				seen[key] = true
+				result.Forward = append(result.Forward, address)
+			}
+		}
+		if rule.Actions.Webhook != "" {
+			result.Webhooks = append(result.Webhooks, Webhook{
+				RuleID:   rule.ID,
+				RuleName: rule.Name,
+				URL:      rule.Actions.Webhook,
+				Secret:   rule.Secret,
+			})
+		}
+
+		if rule.Stop {
+			break
+		}
+	}
+	return result
+}
+
+// matches returns true if all conditions of the rule match, or any of them for MatchAny
+func (r Rule) matches(msg message) bool {
+	if len(r.Conditions) == 0 {
+		return false
+	}
+	for _, condition := range r.Conditions {
+		matched := condition.matches(msg)
+		if r.Match == MatchAny && matched {
+			return true
+		}
+		if r.Match != MatchAny && !matched {
+			return false
+		}
+	}
+	return r.Match != MatchAny
+}
+
+// matches returns true if any value of the field matches, or none of them if the condition is negated
+func (c Condition) matches(msg message) bool {
+	var re *regexp.Regexp
+	if c.Operator == OperatorRegex {
+		var err error
+		re, err = regexp.Compile("(?i)" + c.Value)
+		if err != nil {
+			return false // only valid patterns are stored
+		}
+	}
+	key := strings.ToLower(c.Value)
+
+	matched := false
+	for _, value := range msg.values(c.Field, c.Header) {
+		if re != nil {
+			matched = re.MatchString(value)
+		} else {
+			matched = compare(c.Operator, strings.ToLower(value), key)
+		}
+		if matched {
+			break
+		}
+	}
+	return matched != c.Negate
+}
+
+func compare(operator, value, key string) bool {
+	switch operator {
+	case OperatorContains:
+		return strings.Contains(value, key)
+	case OperatorEquals:
+		return value == key
+	case OperatorStartsWith:
+		return strings.HasPrefix(value, key)
+	case OperatorEndsWith:
+		return strings.HasSuffix(value, key)
+	}
+	return false
+}
+
+// message is the header section of an email that conditions inspect
+type message struct {
+	headers map[string][]string // lowercase name -> raw values
+}
+
+func newMessage(headers types.Headers) message {
+	msg := message{headers: make(map[string][]string)}
+	for _, header := range headers {
+		name := strings.ToLower(header.Name)
+		msg.headers[name] = append(msg.headers[name], header.Value)
+	}
+	return msg
+}
+
+// values returns the values of a field of the email, with encoded words decoded
+func (m message) values(field, header string) []string {
+	switch field {
+	case FieldFrom:
+		return m.addresses("from")
+	case FieldTo:
+		return append(m.addresses("to"), m.addresses("cc")...)
+	case FieldSubject:
+		return m.header("subject")
+	case FieldHeader:
+		return m.header(header)
+	}
+	return nil
+}
+
+func (m message) header(name string) []string {
+	raw := m.headers[strings.ToLower(name)]
+	values := make([]string, len(raw))
+	for i, value := range raw {
+		values[i] = decode(value)
+	}
+	return values
+}
+
+// addresses returns the addresses and the display names in the header fields with name,
+// or the decoded values if they can't be parsed
+func (m message) addresses(name string) []string {
+	var values []string
+	for _, value := range m.headers[name] {
+		list, err := mail.ParseAddressList(value)
+		if err != nil {
+			values = append(values, decode(value))
+			continue
+		}
+		for _, address := range list {
+			values = append(values, address.Address)
+			if address.Name != "" {
+				values = append(values, address.Name)
+			}
+		}
+	}
+	return values
+}
+
+// decode decodes the encoded words of a header value, or returns it as is if it can't be decoded
+func decode(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
@@ -0,0 +1,72 @@
+package rule
+
+import (
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionMatches(t *testing.T) {
+	msg := newMessage(types.Headers{
+		{Name: "From", Value: "=?UTF-8?Q?Caf=C3=A9_News?= <News@Example.com>"},
+		{Name: "To", Value: "alice@example.org, Bob <bob@example.org>"},
+		{Name: "Cc", Value: "team@example.net"},
+		{Name: "Subject", Value: "=?UTF-8?B?SW52b2ljZSAjNDI=?="},
+		{Name: "List-Id", Value: "<weekly.example.com>"},
+		{Name: "X-Broken", Value: "not an address"},
+	})
+
+	tests := []struct {
+		condition Condition
+		expected  bool
+	}{
+		{Condition{Field: FieldFrom, Operator: OperatorEquals, Value: "news@example.com"}, true},
+		{Condition{Field: FieldFrom, Operator: OperatorContains, Value: "café"}, true},
+		{Condition{Field: FieldFrom, Operator: OperatorEndsWith, Value: "@example.org"}, false},
+		{Condition{Field: FieldFrom, Operator: OperatorEndsWith, Value: "@example.org", Negate: true}, true},
+		{Condition{Field: FieldTo, Operator: OperatorEquals, Value: "bob@example.org"}, true},
+		{Condition{Field: FieldTo, Operator: OperatorStartsWith, Value: "team@"}, true},
+		{Condition{Field: FieldTo, Operator: OperatorEquals, Value: "bob"}, true}, // display name
+		{Condition{Field: FieldSubject, Operator: OperatorStartsWith, Value: "invoice"}, true},
+		{Condition{Field: FieldSubject, Operator: OperatorRegex, Value: `#\d+$`}, true},
+		{Condition{Field: FieldSubject, Operator: OperatorRegex, Value: `^receipt`}, false},
+		{Condition{Field: FieldHeader, Header: "list-id", Operator: OperatorContains, Value: "weekly"}, true},
+		{Condition{Field: FieldHeader, Header: "X-Missing", Operator: OperatorContains, Value: "a"}, false},
+		{Condition{Field: FieldHeader, Header: "X-Missing", Operator: OperatorContains, Value: "a", Negate: true}, true},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.expected, test.condition.matches(msg), i)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	msg := newMessage(types.Headers{
+		{Name: "From", Value: "news@example.com"},
+		{Name: "Subject", Value: "Weekly digest"},
+	})
+	fromNews := Condition{Field: FieldFrom, Operator: OperatorEquals, Value: "news@example.com"}
+	subjectInvoice := Condition{Field: FieldSubject, Operator: OperatorContains, Value: "invoice"}
+
+	rules := []Rule{
+		{ID: "disabled", Definition: Definition{Disabled: true, Match: MatchAll, Conditions: []Condition{fromNews}, Actions: Actions{Trash: true}}},
+		{ID: "all", Definition: Definition{Match: MatchAll, Conditions: []Condition{fromNews, subjectInvoice}, Actions: Actions{Trash: true}}},
+		{ID: "any", Secret: "secret", Definition: Definition{
+			Name: "News", Match: MatchAny, Conditions: []Condition{subjectInvoice, fromNews},
+			Actions: Actions{Labels: []string{"news"}, Forward: []string{"alice@example.com"}, Webhook: "https://example.com/hooks"},
+		}},
+		{ID: "stop", Definition: Definition{Match: MatchAll, Conditions: []Condition{fromNews}, Actions: Actions{Labels: []string{"news", "digest"}, MarkRead: true, Forward: []string{"Alice@example.com"}}, Stop: true}},
+		{ID: "skipped", Definition: Definition{Match: MatchAll, Conditions: []Condition{fromNews}, Actions: Actions{Trash: true}}},
+	}
+
+	result := evaluate(rules, msg)
+	assert.Equal(t, &Result{
+		Matched:  []string{"any", "stop"},
+		Labels:   []string{"news", "digest"},
+		MarkRead: true,
+		Forward:  []string{"alice@example.com"},
+		Webhooks: []Webhook{{RuleID: "any", RuleName: "News", URL: "https://example.com/hooks", Secret: "secret"}},
+	}, result)
+
+	assert.Equal(t, &Result{}, evaluate(nil, msg))
+}
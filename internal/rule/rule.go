@@ -0,0 +1,436 @@
+// Package rule manages filtering rules, which match received emails by their senders, recipients, subjects and headers,
+// and label, mark as read, trash or forward them, or send them to a webhook.
+// Rules are evaluated when emails are received, after the Sieve script and before the emails are stored,
+// and are a structured alternative to the script for clients that edit rules in a form.
+package rule
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/egress"
+)
+
+const (
+	// rulesID is the MessageID of the item storing the rules in the email table
+	rulesID = "rule#definitions"
+
+	// MaxRules is the maximum number of rules
+	MaxRules = 100
+	// MaxConditions is the maximum number of conditions of a rule
+	MaxConditions = 20
+	// MaxForwards is the maximum number of addresses a rule forwards emails to
+	MaxForwards = 5
+
+	maxNameLength       = 100
+	maxValueLength      = 1000
+	maxWebhookURLLength = 2048
+)
+
+// Fields of conditions
+const (
+	FieldFrom    = "from"    // addresses and display names of the From header
+	FieldTo      = "to"      // addresses and display names of the To and Cc headers
+	FieldSubject = "subject" // decoded Subject header
+	FieldHeader  = "header"  // decoded values of the header named by the condition
+)
+
+// Operators of conditions, which compare case-insensitively
+const (
+	OperatorContains   = "contains"
+	OperatorEquals     = "equals"
+	OperatorStartsWith = "startsWith"
+	OperatorEndsWith   = "endsWith"
+	OperatorRegex      = "regex" // RE2 syntax
+)
+
+// Match types of rules
+const (
+	MatchAll = "all" // all conditions match
+	MatchAny = "any" // any condition matches
+)
+
+// now is equal to time.Now, but will be replaced during testing
+var now = time.Now
+
+// Definition is what a rule matches and what it does, which is replaced when the rule is updated
+type Definition struct {
+	Name       string      `json:"name"`
+	Disabled   bool        `json:"disabled"`
+	Match      string      `json:"match"` // MatchAll or MatchAny, MatchAll if empty
+	Conditions []Condition `json:"conditions"`
+	Actions    Actions     `json:"actions"`
+	Stop       bool        `json:"stop"` // whether the rules after this one are skipped if it matches
+}
+
+// Condition compares a field of an email with a value
+type Condition struct {
+	Field    string `json:"field"`
+	Header   string `json:"header,omitempty"` // name of the header, if Field is FieldHeader
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+	Negate   bool   `json:"negate,omitempty"` // whether the condition matches if no value of the field matches
+}
+
+// Actions are applied to the emails a rule matches
+type Actions struct {
+	Labels   []string `json:"labels,omitempty"`
+	MarkRead bool     `json:"markRead,omitempty"`
+	Trash    bool     `json:"trash,omitempty"`
+	Forward  []string `json:"forward,omitempty"` // addresses the emails are redirected to, as with the redirect command of Sieve
+	Webhook  string   `json:"webhook,omitempty"` // HTTPS URL that receives hooks of the emails
+}
+
+// Rule is a filtering rule, and rules are evaluated from the earliest created
+type Rule struct {
+	ID string `json:"id" dynamodbav:"-"`
+	Definition
+	// Secret signs the hooks sent by the Webhook action in the hook.SignatureHeader,
+	// it's only returned when the rule is created
+	Secret      string `json:"secret,omitempty"`
+	TimeCreated string `json:"timeCreated"`
+	TimeUpdated string `json:"timeUpdated"`
+}
+
+// Create adds a rule.
+// api.ErrTooManyRules is returned if there are already MaxRules.
+func Create(ctx context.Context, client api.CreateRuleAPI, input Definition) (*Rule, error) {
+	definition, err := normalize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := load(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= MaxRules {
+		return nil, api.ErrTooManyRules
+	}
+
+	timeCreated := now().UTC().Format(time.RFC3339)
+	rule := &Rule{
+		ID:          randomHex(8),
+		Definition:  definition,
+		Secret:      randomHex(32),
+		TimeCreated: timeCreated,
+		TimeUpdated: timeCreated,
+	}
+	entry, err := attributevalue.MarshalMap(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	// a nested attribute can only be set in an existing map
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: rulesID},
+		},
+		UpdateExpression: aws.String("SET Rules = if_not_exists(Rules, :empty)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":empty": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}},
+		},
+	})
+	if err != nil {
+		return nil, mapDynamoDBError(err)
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: rulesID},
+		},
+		UpdateExpression:    aws.String("SET Rules.#id = :rule"),
+		ConditionExpression: aws.String("size(Rules) < :max"),
+		ExpressionAttributeNames: map[string]string{
+			"#id": rule.ID,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":rule": &types.AttributeValueMemberM{Value: entry},
+			":max":  &types.AttributeValueMemberN{Value: strconv.Itoa(MaxRules)},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRules
+		}
+		return nil, mapDynamoDBError(err)
+	}
+	return rule, nil
+}
+
+// List returns the rules in the order they are evaluated, without their secrets
+func List(ctx context.Context, client api.GetItemAPI) ([]Rule, error) {
+	rules, err := load(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		rules[i].Secret = ""
+	}
+	return rules, nil
+}
+
+// Update replaces the definition of a rule, keeping its secret and its place in the order of the rules.
+// api.ErrRuleNotFound is returned if it doesn't exist.
+func Update(ctx context.Context, client api.UpdateRuleAPI, id string, input Definition) (*Rule, error) {
+	definition, err := normalize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := load(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	var rule *Rule
+	for i := range existing {
+		if existing[i].ID == id {
+			rule = &existing[i]
+			break
+		}
+	}
+	if rule == nil {
+		return nil, api.ErrRuleNotFound
+	}
+	rule.Definition = definition
+	rule.TimeUpdated = now().UTC().Format(time.RFC3339)
+	entry, err := attributevalue.MarshalMap(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: rulesID},
+		},
+		UpdateExpression: aws.String("SET Rules.#id = :rule"),
+		// the rule may be deleted after it's read
+		ConditionExpression: aws.String("attribute_exists(Rules.#id)"),
+		ExpressionAttributeNames: map[string]string{
+			"#id": rule.ID,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":rule": &types.AttributeValueMemberM{Value: entry},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return nil, api.ErrRuleNotFound
+		}
+		return nil, mapDynamoDBError(err)
+	}
+	rule.Secret = ""
+	return rule, nil
+}
+
+// Delete removes a rule.
+// api.ErrRuleNotFound is returned if it doesn't exist.
+func Delete(ctx context.Context, client api.UpdateItemAPI, id string) error {
+	if id == "" {
+		return api.ErrRuleNotFound
+	}
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: rulesID},
+		},
+		UpdateExpression:    aws.String("REMOVE Rules.#id"),
+		ConditionExpression: aws.String("attribute_exists(Rules.#id)"),
+		ExpressionAttributeNames: map[string]string{
+			"#id": id,
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return api.ErrRuleNotFound
+		}
+		return mapDynamoDBError(err)
+	}
+	return nil
+}
+
+// load returns all rules with their secrets, from the earliest created
+func load(ctx context.Context, client api.GetItemAPI) ([]Rule, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: rulesID},
+		},
+	})
+	if err != nil {
+		return nil, mapDynamoDBError(err)
+	}
+
+	attr, ok := resp.Item["Rules"].(*types.AttributeValueMemberM)
+	if !ok {
+		return []Rule{}, nil
+	}
+	rules := make([]Rule, 0, len(attr.Value))
+	for id, av := range attr.Value {
+		var rule Rule
+		if err := attributevalue.Unmarshal(av, &rule); err != nil {
+			continue
+		}
+		rule.ID = id
+		if rule.Conditions == nil {
+			rule.Conditions = []Condition{}
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].TimeCreated != rules[j].TimeCreated {
+			return rules[i].TimeCreated < rules[j].TimeCreated
+		}
+		return rules[i].ID < rules[j].ID
+	})
+	return rules, nil
+}
+
+// normalize trims and validates a definition.
+// api.ErrInvalidInput is returned if it's invalid, or it has no conditions or no actions.
+func normalize(input Definition) (Definition, error) {
+	definition := input
+	definition.Name = strings.TrimSpace(input.Name)
+	if len(definition.Name) > maxNameLength {
+		return Definition{}, api.ErrInvalidInput
+	}
+	switch definition.Match {
+	case "":
+		definition.Match = MatchAll
+	case MatchAll, MatchAny:
+	default:
+		return Definition{}, api.ErrInvalidInput
+	}
+
+	if len(input.Conditions) == 0 || len(input.Conditions) > MaxConditions {
+		return Definition{}, api.ErrInvalidInput
+	}
+	definition.Conditions = make([]Condition, len(input.Conditions))
+	for i, condition := range input.Conditions {
+		condition, err := normalizeCondition(condition)
+		if err != nil {
+			return Definition{}, err
+		}
+		definition.Conditions[i] = condition
+	}
+
+	actions, err := normalizeActions(input.Actions)
+	if err != nil {
+		return Definition{}, err
+	}
+	definition.Actions = actions
+	return definition, nil
+}
+
+func normalizeCondition(condition Condition) (Condition, error) {
+	switch condition.Field {
+	case FieldFrom, FieldTo, FieldSubject:
+		condition.Header = ""
+	case FieldHeader:
+		condition.Header = strings.TrimSpace(condition.Header)
+		if !validHeaderName(condition.Header) {
+			return Condition{}, api.ErrInvalidInput
+		}
+	default:
+		return Condition{}, api.ErrInvalidInput
+	}
+
+	if condition.Value == "" || len(condition.Value) > maxValueLength {
+		return Condition{}, api.ErrInvalidInput
+	}
+	switch condition.Operator {
+	case OperatorContains, OperatorEquals, OperatorStartsWith, OperatorEndsWith:
+	case OperatorRegex:
+		if _, err := regexp.Compile(condition.Value); err != nil {
+			return Condition{}, api.ErrInvalidInput
+		}
+	default:
+		return Condition{}, api.ErrInvalidInput
+	}
+	return condition, nil
+}
+
+func normalizeActions(actions Actions) (Actions, error) {
+	labels, err := email.NormalizeLabels(actions.Labels)
+	if err != nil {
+		return Actions{}, err
+	}
+	actions.Labels = nil
+	if len(labels) > 0 {
+		actions.Labels = labels
+	}
+
+	if len(actions.Forward) > MaxForwards {
+		return Actions{}, api.ErrInvalidInput
+	}
+	var forward []string
+	for _, address := range actions.Forward {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil || parsed.Address != strings.TrimSpace(address) {
+			return Actions{}, api.ErrInvalidInput
+		}
+		forward = append(forward, parsed.Address)
+	}
+	actions.Forward = forward
+
+	actions.Webhook = strings.TrimSpace(actions.Webhook)
+	if actions.Webhook != "" {
+		u, err := url.Parse(actions.Webhook)
+		if err != nil || u.Scheme != "https" || u.Host == "" || len(actions.Webhook) > maxWebhookURLLength {
+			return Actions{}, api.ErrInvalidInput
+		}
+		if err := egress.FromEnv().CheckURL(u); err != nil {
+			return Actions{}, api.ErrInvalidInput
+		}
+	}
+
+	if len(actions.Labels) == 0 && !actions.MarkRead && !actions.Trash && len(actions.Forward) == 0 && actions.Webhook == "" {
+		return Actions{}, api.ErrInvalidInput
+	}
+	return actions, nil
+}
+
+// validHeaderName returns true if name consists of printable ASCII characters except colon
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] <= ' ' || name[i] > '~' || name[i] == ':' {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b) // never returns an error
+	return hex.EncodeToString(b)
+}
+
+func mapDynamoDBError(err error) error {
+	if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+		return api.ErrTooManyRequests
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package rule
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockRulesAPI stores the rules like DynamoDB
+type mockRulesAPI struct {
+	rules map[string]types.AttributeValue
+}
+
+func (m *mockRulesAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.rules == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{
+		Item: map[string]types.AttributeValue{"Rules": &types.AttributeValueMemberM{Value: m.rules}},
+	}, nil
+}
+
+func (m *mockRulesAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if *params.UpdateExpression == "SET Rules = if_not_exists(Rules, :empty)" {
+		if m.rules == nil {
+			m.rules = make(map[string]types.AttributeValue)
+		}
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+
+	id := params.ExpressionAttributeNames["#id"]
+	_, exists := m.rules[id]
+	switch *params.ConditionExpression {
+	case "size(Rules) < :max":
+		limit, _ := strconv.Atoi(params.ExpressionAttributeValues[":max"].(*types.AttributeValueMemberN).Value)
+		if len(m.rules) >= limit {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	case "attribute_exists(Rules.#id)":
+		if !exists {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	}
+	switch *params.UpdateExpression {
+	case "SET Rules.#id = :rule":
+		m.rules[id] = params.ExpressionAttributeValues[":rule"]
+	case "REMOVE Rules.#id":
+		delete(m.rules, id)
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestRules(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	client := &mockRulesAPI{}
+	ctx := context.TODO()
+
+	rules, err := List(ctx, client)
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+
+	news, err := Create(ctx, client, Definition{
+		Name:       " News ",
+		Conditions: []Condition{{Field: FieldFrom, Operator: OperatorEndsWith, Value: "@news.example.com"}},
+		Actions:    Actions{Labels: []string{" news ", "news"}, MarkRead: true},
+	})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, news.ID)
+	assert.NotEmpty(t, news.Secret)
+	assert.Equal(t, "News", news.Name)
+	assert.Equal(t, MatchAll, news.Match)
+	assert.Equal(t, []string{"news"}, news.Actions.Labels)
+	assert.Equal(t, "2024-05-01T12:00:00Z", news.TimeCreated)
+
+	now = func() time.Time { return time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC) }
+	invoices, err := Create(ctx, client, Definition{
+		Match: MatchAny,
+		Conditions: []Condition{
+			{Field: FieldSubject, Operator: OperatorContains, Value: "invoice"},
+			{Field: FieldHeader, Header: "X-Invoice-ID", Operator: OperatorRegex, Value: `^\d+$`},
+		},
+		Actions: Actions{Forward: []string{"accounting@example.com"}, Webhook: "https://example.com/hooks"},
+	})
+	assert.NoError(t, err)
+
+	for _, input := range []Definition{
+		{Actions: Actions{Trash: true}},
+		{Conditions: []Condition{{Field: FieldFrom, Operator: OperatorEquals, Value: "a@example.com"}}},
+		{Conditions: []Condition{{Field: "body", Operator: OperatorContains, Value: "hello"}}, Actions: Actions{Trash: true}},
+		{Conditions: []Condition{{Field: FieldHeader, Operator: OperatorContains, Value: "hello"}}, Actions: Actions{Trash: true}},
+		{Conditions: []Condition{{Field: FieldSubject, Operator: OperatorRegex, Value: "("}}, Actions: Actions{Trash: true}},
+		{Conditions: []Condition{{Field: FieldSubject, Operator: OperatorContains}}, Actions: Actions{Trash: true}},
+		{Match: "some", Conditions: []Condition{{Field: FieldSubject, Operator: OperatorContains, Value: "a"}}, Actions: Actions{Trash: true}},
+		{Conditions: []Condition{{Field: FieldSubject, Operator: OperatorContains, Value: "a"}}, Actions: Actions{Forward: []string{"Bob <bob@example.com>"}}},
+		{Conditions: []Condition{{Field: FieldSubject, Operator: OperatorContains, Value: "a"}}, Actions: Actions{Webhook: "http://example.com"}},
+	} {
+		_, err = Create(ctx, client, input)
+		assert.Equal(t, api.ErrInvalidInput, err)
+	}
+
+	rules, err = List(ctx, client)
+	assert.NoError(t, err)
+	if assert.Len(t, rules, 2) {
+		assert.Equal(t, news.ID, rules[0].ID)
+		assert.Empty(t, rules[0].Secret)
+		assert.Equal(t, invoices.ID, rules[1].ID)
+		assert.Equal(t, invoices.Conditions, rules[1].Conditions)
+		assert.Equal(t, invoices.Actions, rules[1].Actions)
+	}
+
+	now = func() time.Time { return time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC) }
+	updated, err := Update(ctx, client, news.ID, Definition{
+		Name:       "News",
+		Disabled:   true,
+		Conditions: []Condition{{Field: FieldFrom, Operator: OperatorEndsWith, Value: "@example.com"}},
+		Actions:    Actions{Trash: true},
+		Stop:       true,
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, updated.Secret)
+	assert.Equal(t, "2024-05-01T12:00:00Z", updated.TimeCreated)
+	assert.Equal(t, "2024-05-03T12:00:00Z", updated.TimeUpdated)
+
+	// the secret is kept
+	loaded, err := load(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, news.Secret, loaded[0].Secret)
+	assert.True(t, loaded[0].Disabled)
+	assert.Equal(t, Actions{Trash: true}, loaded[0].Actions)
+
+	_, err = Update(ctx, client, "unknown", Definition{
+		Conditions: []Condition{{Field: FieldFrom, Operator: OperatorEquals, Value: "a@example.com"}},
+		Actions:    Actions{Trash: true},
+	})
+	assert.Equal(t, api.ErrRuleNotFound, err)
+
+	assert.NoError(t, Delete(ctx, client, news.ID))
+	assert.Equal(t, api.ErrRuleNotFound, Delete(ctx, client, news.ID))
+
+	rules, err = List(ctx, client)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+}
+
+func TestCreate_TooManyRules(t *testing.T) {
+	client := &mockRulesAPI{rules: make(map[string]types.AttributeValue)}
+	for i := 0; i < MaxRules; i++ {
+		client.rules["rule"+strconv.Itoa(i)] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}}
+	}
+
+	_, err := Create(context.TODO(), client, Definition{
+		Conditions: []Condition{{Field: FieldFrom, Operator: OperatorEquals, Value: "a@example.com"}},
+		Actions:    Actions{Trash: true},
+	})
+	assert.Equal(t, api.ErrTooManyRules, err)
+}
@@ -0,0 +1,224 @@
+// Package search indexes received emails in OpenSearch, so that they can be searched by full text.
+// Emails are searched in DynamoDB by the email package if it's not enabled.
+package search
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/egress"
+)
+
+// MaxResults is the number of results that can be paged through, the default max_result_window of OpenSearch
+const MaxResults = 10000
+
+// ErrSearchFailed is returned when OpenSearch responds with an error
+var ErrSearchFailed = errors.New("search failed")
+
+// Enabled returns whether received emails are indexed in OpenSearch
+func Enabled() bool {
+	return env.SearchURL != ""
+}
+
+// index returns the name of the index of emails
+func index() string {
+	if env.SearchIndex != "" {
+		return env.SearchIndex
+	}
+	if env.Environment != "" {
+		return env.Environment + "-mailbox"
+	}
+	return "mailbox"
+}
+
+// Document is the indexed content of an email
+type Document struct {
+	MessageID    string   `json:"-"`
+	TimeReceived string   `json:"timeReceived"`
+	Subject      string   `json:"subject"`
+	From         []string `json:"from"`
+	To           []string `json:"to"` // including cc
+	Text         string   `json:"text"`
+}
+
+// Query is a search of emails, where all the given terms must match
+type Query struct {
+	Query   string // matched against the subject, sender, recipients and body text
+	Subject string
+	From    string
+	To      string
+	Text    string
+	Offset  int
+	Size    int
+}
+
+// Result is a page of the message IDs of matching emails, latest first
+type Result struct {
+	MessageIDs []string
+	Total      int
+}
+
+// Client indexes and searches emails in OpenSearch, signing requests with the credentials of the function
+type Client struct {
+	client      *http.Client
+	endpoint    string
+	service     string
+	region      string
+	credentials aws.CredentialsProvider
+}
+
+// NewClient returns a client of the OpenSearch domain or serverless collection at SEARCH_URL
+func NewClient(cfg aws.Config) *Client {
+	client := &http.Client{Timeout: 5 * time.Second}
+	egress.FromEnv().Apply(client)
+
+	endpoint := strings.TrimSuffix(env.SearchURL, "/")
+	service := "es"
+	if u, err := url.Parse(endpoint); err == nil && strings.HasSuffix(u.Hostname(), ".aoss.amazonaws.com") {
+		service = "aoss"
+	}
+	return &Client{
+		client:      client,
+		endpoint:    endpoint,
+		service:     service,
+		region:      cfg.Region,
+		credentials: cfg.Credentials,
+	}
+}
+
+// Index adds an email to the index, or replaces it if it's already indexed
+func (c *Client) Index(ctx context.Context, doc Document) error {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	res, err := c.do(ctx, http.MethodPut, "/"+index()+"/_doc/"+url.PathEscape(doc.MessageID), body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return checkResponse(res)
+}
+
+// Search returns the emails matching the query
+func (c *Client) Search(ctx context.Context, query Query) (*Result, error) {
+	body, err := json.Marshal(buildQuery(query))
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(ctx, http.MethodPost, "/"+index()+"/_search", body)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if err = checkResponse(res); err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		MessageIDs: make([]string, len(response.Hits.Hits)),
+		Total:      response.Hits.Total.Value,
+	}
+	for i, hit := range response.Hits.Hits {
+		result.MessageIDs[i] = hit.ID
+	}
+	return result, nil
+}
+
+// buildQuery returns the OpenSearch query DSL of a query
+func buildQuery(query Query) map[string]interface{} {
+	must := []interface{}{}
+	if query.Query != "" {
+		must = append(must, map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":    query.Query,
+				"fields":   []string{"subject^2", "from", "to", "text"},
+				"operator": "and",
+			},
+		})
+	}
+	fields := []struct{ name, value string }{
+		{"subject", query.Subject},
+		{"from", query.From},
+		{"to", query.To},
+		{"text", query.Text},
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		must = append(must, map[string]interface{}{
+			"match": map[string]interface{}{
+				field.name: map[string]interface{}{"query": field.value, "operator": "and"},
+			},
+		})
+	}
+
+	return map[string]interface{}{
+		"from":    query.Offset,
+		"size":    query.Size,
+		"query":   map[string]interface{}{"bool": map[string]interface{}{"must": must}},
+		"sort":    []interface{}{map[string]interface{}{"timeReceived": "desc"}},
+		"_source": false,
+	}
+}
+
+// do sends a request signed with Signature Version 4
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	credentials, err := c.credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(hash[:])
+	if c.service == "aoss" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash) // required by serverless collections
+	}
+	err = v4.NewSigner().SignHTTP(ctx, credentials, req, payloadHash, c.service, c.region, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+// checkResponse returns an error wrapping ErrSearchFailed if OpenSearch responded with an error
+func checkResponse(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	return fmt.Errorf("%w, status %d: %s", ErrSearchFailed, res.StatusCode, data)
+}
@@ -0,0 +1,105 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndex(t *testing.T) {
+	tests := []struct {
+		environment string
+		searchIndex string
+		expected    string
+	}{
+		{expected: "mailbox"},
+		{environment: "staging", expected: "staging-mailbox"},
+		{environment: "staging", searchIndex: "staging-emails", expected: "staging-emails"},
+	}
+	for _, test := range tests {
+		env.Environment, env.SearchIndex = test.environment, test.searchIndex
+		assert.Equal(t, test.expected, index())
+	}
+	env.Environment, env.SearchIndex = "", ""
+}
+
+func TestBuildQuery(t *testing.T) {
+	query := buildQuery(Query{Query: "invoice march", From: "alice", Offset: 20, Size: 10})
+	data, err := json.Marshal(query)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"from": 20,
+		"size": 10,
+		"query": {"bool": {"must": [
+			{"multi_match": {"query": "invoice march", "fields": ["subject^2", "from", "to", "text"], "operator": "and"}},
+			{"match": {"from": {"query": "alice", "operator": "and"}}}
+		]}},
+		"sort": [{"timeReceived": "desc"}],
+		"_source": false
+	}`, string(data))
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-east-1/es/aws4_request")
+		body, _ := io.ReadAll(r.Body)
+
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/mailbox/_doc/message-id":
+			assert.JSONEq(t, `{"timeReceived": "2022-03-15T01:01:01Z", "subject": "Invoice", "from": ["alice@example.com"], "to": null, "text": "text"}`, string(body))
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPost && r.URL.Path == "/mailbox/_search":
+			_, _ = w.Write([]byte(`{"hits": {"total": {"value": 12}, "hits": [{"_id": "1"}, {"_id": "2"}]}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error": "unsupported"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{
+		client:   server.Client(),
+		endpoint: server.URL,
+		service:  "es",
+		region:   "us-east-1",
+		credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	}
+
+	err := client.Index(context.TODO(), Document{
+		MessageID:    "message-id",
+		TimeReceived: "2022-03-15T01:01:01Z",
+		Subject:      "Invoice",
+		From:         []string{"alice@example.com"},
+		Text:         "text",
+	})
+	assert.NoError(t, err)
+
+	result, err := client.Search(context.TODO(), Query{Query: "invoice", Size: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, &Result{MessageIDs: []string{"1", "2"}, Total: 12}, result)
+
+	client.endpoint += "/unknown"
+	_, err = client.Search(context.TODO(), Query{Query: "invoice", Size: 2})
+	assert.True(t, errors.Is(err, ErrSearchFailed))
+}
+
+func TestNewClient(t *testing.T) {
+	env.SearchURL = "https://abc123.us-east-1.aoss.amazonaws.com/"
+	defer func() { env.SearchURL = "" }()
+
+	client := NewClient(aws.Config{Region: "us-east-1"})
+	assert.Equal(t, "https://abc123.us-east-1.aoss.amazonaws.com", client.endpoint)
+	assert.Equal(t, "aoss", client.service)
+}
@@ -0,0 +1,221 @@
+// Package senders manages the block list and the allow list of senders, whose entries are addresses, e.g. alice@example.com,
+// or domains, e.g. example.com, which also match their subdomains.
+// Received emails from blocked senders are trashed, and emails from allowed senders skip the classification service.
+package senders
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+const (
+	// listsID is the MessageID of the item storing the lists in the email table, with a string set of each list
+	listsID = "sender#lists"
+
+	// MaxSenders is the maximum number of senders in each list
+	MaxSenders = 1000
+
+	// maxSenderLength is the maximum length of an address
+	maxSenderLength = 254
+)
+
+// Names of the lists
+const (
+	ListBlocked = "blocked"
+	ListAllowed = "allowed"
+)
+
+// attributes are the attributes of the lists in the item, by their names
+var attributes = map[string]string{
+	ListBlocked: "Blocked",
+	ListAllowed: "Allowed",
+}
+
+// Lists are the blocked and the allowed senders
+type Lists struct {
+	Blocked []string `json:"blocked"`
+	Allowed []string `json:"allowed"`
+}
+
+// Get returns the lists, which are empty if no senders are added, with the senders of each list in order
+func Get(ctx context.Context, client api.GetItemAPI) (*Lists, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key:       key(),
+	})
+	if err != nil {
+		return nil, mapDynamoDBError(err)
+	}
+	return &Lists{
+		Blocked: stringSet(resp.Item, attributes[ListBlocked]),
+		Allowed: stringSet(resp.Item, attributes[ListAllowed]),
+	}, nil
+}
+
+// Add adds a sender to a list, which does nothing if it's already in the list.
+// api.ErrTooManySenders is returned if the list has MaxSenders senders.
+func Add(ctx context.Context, client api.UpdateItemAPI, list, sender string) error {
+	attribute, ok := attributes[list]
+	if !ok {
+		return api.ErrInvalidInput
+	}
+	sender, err := Normalize(sender)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(env.TableName),
+		Key:                 key(),
+		UpdateExpression:    aws.String("ADD #list :senders"),
+		ConditionExpression: aws.String("attribute_not_exists(#list) OR size(#list) < :max OR contains(#list, :sender)"),
+		ExpressionAttributeNames: map[string]string{
+			"#list": attribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":senders": &types.AttributeValueMemberSS{Value: []string{sender}},
+			":sender":  &types.AttributeValueMemberS{Value: sender},
+			":max":     &types.AttributeValueMemberN{Value: strconv.Itoa(MaxSenders)},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return api.ErrTooManySenders
+		}
+		return mapDynamoDBError(err)
+	}
+	return nil
+}
+
+// Remove removes a sender from a list.
+// api.ErrSenderNotFound is returned if it's not in the list.
+func Remove(ctx context.Context, client api.UpdateItemAPI, list, sender string) error {
+	attribute, ok := attributes[list]
+	if !ok {
+		return api.ErrInvalidInput
+	}
+	sender, err := Normalize(sender)
+	if err != nil {
+		return api.ErrSenderNotFound
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(env.TableName),
+		Key:                 key(),
+		UpdateExpression:    aws.String("DELETE #list :senders"),
+		ConditionExpression: aws.String("contains(#list, :sender)"),
+		ExpressionAttributeNames: map[string]string{
+			"#list": attribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":senders": &types.AttributeValueMemberSS{Value: []string{sender}},
+			":sender":  &types.AttributeValueMemberS{Value: sender},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return api.ErrSenderNotFound
+		}
+		return mapDynamoDBError(err)
+	}
+	return nil
+}
+
+// Normalize lowercases an address or a domain, and validates it.
+// A leading @ of a domain is removed, e.g. @example.com is example.com.
+func Normalize(sender string) (string, error) {
+	sender = strings.ToLower(strings.TrimSpace(sender))
+	sender = strings.TrimPrefix(sender, "@")
+	if sender == "" || len(sender) > maxSenderLength || strings.ContainsAny(sender, " \t\r\n<>\"(),;") {
+		return "", api.ErrInvalidInput
+	}
+
+	domain := sender
+	if local, d, ok := strings.Cut(sender, "@"); ok {
+		if local == "" {
+			return "", api.ErrInvalidInput
+		}
+		domain = d
+	}
+	if domain == "" || strings.Contains(domain, "@") {
+		return "", api.ErrInvalidInput
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" {
+			return "", api.ErrInvalidInput
+		}
+	}
+	return sender, nil
+}
+
+// IsBlocked returns true if any of the addresses is blocked
+func (l Lists) IsBlocked(addresses ...string) bool {
+	return matchAny(l.Blocked, addresses)
+}
+
+// IsAllowed returns true if any of the addresses is allowed
+func (l Lists) IsAllowed(addresses ...string) bool {
+	return matchAny(l.Allowed, addresses)
+}
+
+// matchAny returns true if any of the addresses matches a sender in list,
+// which is either the address or the domain of the address or of its parent domains
+func matchAny(list []string, addresses []string) bool {
+	if len(list) == 0 {
+		return false
+	}
+	set := make(map[string]bool, len(list))
+	for _, sender := range list {
+		set[sender] = true
+	}
+	for _, address := range addresses {
+		address = strings.ToLower(strings.TrimSpace(address))
+		_, domain, ok := strings.Cut(address, "@")
+		if !ok {
+			continue
+		}
+		if set[address] {
+			return true
+		}
+		for domain != "" {
+			if set[domain] {
+				return true
+			}
+			_, domain, _ = strings.Cut(domain, ".")
+		}
+	}
+	return false
+}
+
+func key() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"MessageID": &types.AttributeValueMemberS{Value: listsID},
+	}
+}
+
+// stringSet returns the sorted values of a string set attribute, or an empty slice if it doesn't exist
+func stringSet(item map[string]types.AttributeValue, name string) []string {
+	attr, ok := item[name].(*types.AttributeValueMemberSS)
+	if !ok {
+		return []string{}
+	}
+	values := append([]string{}, attr.Value...)
+	sort.Strings(values)
+	return values
+}
+
+func mapDynamoDBError(err error) error {
+	if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+		return api.ErrTooManyRequests
+	}
+	return err
+}
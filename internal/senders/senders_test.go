@@ -0,0 +1,150 @@
+package senders
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockListsAPI stores the lists like DynamoDB, by their attributes
+type mockListsAPI struct {
+	lists map[string]map[string]bool
+}
+
+func (m *mockListsAPI) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	item := make(map[string]types.AttributeValue)
+	for attribute, senders := range m.lists {
+		set := &types.AttributeValueMemberSS{}
+		for sender := range senders {
+			set.Value = append(set.Value, sender)
+		}
+		item[attribute] = set
+	}
+	return &dynamodb.GetItemOutput{Item: item}, nil
+}
+
+func (m *mockListsAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if m.lists == nil {
+		m.lists = make(map[string]map[string]bool)
+	}
+	attribute := params.ExpressionAttributeNames["#list"]
+	sender := params.ExpressionAttributeValues[":sender"].(*types.AttributeValueMemberS).Value
+	list := m.lists[attribute]
+	switch *params.UpdateExpression {
+	case "ADD #list :senders":
+		limit, _ := strconv.Atoi(params.ExpressionAttributeValues[":max"].(*types.AttributeValueMemberN).Value)
+		if len(list) >= limit && !list[sender] {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		if list == nil {
+			list = make(map[string]bool)
+			m.lists[attribute] = list
+		}
+		list[sender] = true
+	case "DELETE #list :senders":
+		if !list[sender] {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+		delete(list, sender)
+		if len(list) == 0 {
+			delete(m.lists, attribute) // empty sets are removed
+		}
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestAddRemove(t *testing.T) {
+	client := &mockListsAPI{}
+	ctx := context.TODO()
+
+	lists, err := Get(ctx, client)
+	assert.Nil(t, err)
+	assert.Equal(t, &Lists{Blocked: []string{}, Allowed: []string{}}, lists)
+
+	assert.Nil(t, Add(ctx, client, ListBlocked, "Spam@Example.com"))
+	assert.Nil(t, Add(ctx, client, ListBlocked, "@ads.example.net"))
+	assert.Nil(t, Add(ctx, client, ListBlocked, "spam@example.com"))
+	assert.Nil(t, Add(ctx, client, ListAllowed, "example.org"))
+	assert.Equal(t, api.ErrInvalidInput, Add(ctx, client, "muted", "example.org"))
+	assert.Equal(t, api.ErrInvalidInput, Add(ctx, client, ListAllowed, "not an address"))
+
+	lists, err = Get(ctx, client)
+	assert.Nil(t, err)
+	assert.Equal(t, &Lists{
+		Blocked: []string{"ads.example.net", "spam@example.com"},
+		Allowed: []string{"example.org"},
+	}, lists)
+
+	assert.Nil(t, Remove(ctx, client, ListBlocked, "SPAM@example.com"))
+	assert.Equal(t, api.ErrSenderNotFound, Remove(ctx, client, ListBlocked, "spam@example.com"))
+	assert.Equal(t, api.ErrSenderNotFound, Remove(ctx, client, ListAllowed, "ads.example.net"))
+
+	lists, err = Get(ctx, client)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ads.example.net"}, lists.Blocked)
+}
+
+func TestAdd_TooManySenders(t *testing.T) {
+	client := &mockListsAPI{lists: map[string]map[string]bool{"Blocked": {}}}
+	for i := 0; i < MaxSenders; i++ {
+		client.lists["Blocked"]["sender"+strconv.Itoa(i)+"@example.com"] = true
+	}
+
+	err := Add(context.TODO(), client, ListBlocked, "another@example.com")
+	assert.Equal(t, api.ErrTooManySenders, err)
+	// senders already in the list are still added
+	assert.Nil(t, Add(context.TODO(), client, ListBlocked, "sender0@example.com"))
+	// the allow list has its own limit
+	assert.Nil(t, Add(context.TODO(), client, ListAllowed, "another@example.com"))
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		sender      string
+		expected    string
+		expectedErr error
+	}{
+		{" Alice@Example.COM ", "alice@example.com", nil},
+		{"example.com", "example.com", nil},
+		{"@example.com", "example.com", nil},
+		{"localhost", "localhost", nil},
+		{"", "", api.ErrInvalidInput},
+		{"@", "", api.ErrInvalidInput},
+		{"alice@", "", api.ErrInvalidInput},
+		{"alice@example..com", "", api.ErrInvalidInput},
+		{"alice@bob@example.com", "", api.ErrInvalidInput},
+		{"Alice <alice@example.com>", "", api.ErrInvalidInput},
+		{".example.com", "", api.ErrInvalidInput},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			sender, err := Normalize(test.sender)
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expected, sender)
+		})
+	}
+}
+
+func TestLists_Match(t *testing.T) {
+	lists := Lists{
+		Blocked: []string{"spam@example.com", "ads.example.net"},
+		Allowed: []string{"example.org"},
+	}
+
+	assert.True(t, lists.IsBlocked("Spam@Example.com"))
+	assert.False(t, lists.IsBlocked("alice@example.com"))
+	assert.True(t, lists.IsBlocked("alice@example.com", "news@ads.example.net"))
+	assert.True(t, lists.IsBlocked("news@eu.ads.example.net"))
+	assert.False(t, lists.IsBlocked("news@badads.example.net"))
+	assert.False(t, lists.IsBlocked("", "ads.example.net"))
+
+	assert.True(t, lists.IsAllowed("bob@example.org"))
+	assert.True(t, lists.IsAllowed("bob@mail.example.org"))
+	assert.False(t, lists.IsAllowed("bob@example.org.evil.com"))
+	assert.False(t, Lists{}.IsAllowed("bob@example.org"))
+}
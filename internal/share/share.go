@@ -0,0 +1,221 @@
+package share
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/idutil"
+)
+
+// Lifetime of share links
+const (
+	DefaultExpiresIn = 7 * 24 * time.Hour
+	MaxExpiresIn     = 30 * 24 * time.Hour
+)
+
+// itemPrefix is the prefix of the MessageID of share items, which are stored in the email table
+const itemPrefix = "share#"
+
+var getCurrentTime = func() time.Time {
+	return time.Now().UTC()
+}
+
+// CreateInput represents the input of create method
+type CreateInput struct {
+	MessageID string `json:"-"`
+	ExpiresIn int64  `json:"expiresIn"` // in seconds, DefaultExpiresIn if zero
+	BaseURL   string `json:"-"`         // URL of the API, which serves the shared view
+}
+
+// CreateResult represents the result of create method
+type CreateResult struct {
+	ShareID     string `json:"shareID"`
+	Token       string `json:"token"`
+	URL         string `json:"url"`
+	ExpiresTime string `json:"expiresTime"`
+}
+
+// Share is a share link of an email
+type Share struct {
+	ShareID          string `json:"shareID" dynamodbav:"-"`
+	MessageID        string `json:"messageID" dynamodbav:"EmailID"`
+	CreatedTime      string `json:"createdTime"`
+	ExpiresTime      string `json:"expiresTime"`
+	RevokedTime      string `json:"revokedTime,omitempty"`
+	AccessCount      int    `json:"accessCount"`
+	LastAccessedTime string `json:"lastAccessedTime,omitempty"`
+}
+
+// signingKey returns the key that signs share links, which is required for sharing
+func signingKey() ([]byte, error) {
+	if env.ShareSigningKey == "" {
+		return nil, api.ErrSharingDisabled
+	}
+	return []byte(env.ShareSigningKey), nil
+}
+
+// Create creates a share link of an email, which gives read-only access to that email until it expires or is revoked
+func Create(ctx context.Context, client api.CreateShareAPI, input CreateInput) (*CreateResult, error) {
+	key, err := signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresIn := time.Duration(input.ExpiresIn) * time.Second
+	if input.ExpiresIn == 0 {
+		expiresIn = DefaultExpiresIn
+	}
+	if expiresIn < 0 || expiresIn > MaxExpiresIn {
+		return nil, api.ErrInvalidInput
+	}
+
+	if strings.HasPrefix(input.MessageID, itemPrefix) {
+		return nil, api.ErrNotFound
+	}
+	emailResult, err := email.Get(ctx, client, input.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	if emailResult.Type == email.EmailTypeDraft {
+		return nil, api.ErrInvalidInput
+	}
+
+	now := getCurrentTime()
+	expires := now.Add(expiresIn).Truncate(time.Second)
+	shareID := idutil.GenerateThreadID()
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item: map[string]types.AttributeValue{
+			"MessageID":   &types.AttributeValueMemberS{Value: itemPrefix + shareID},
+			"EmailID":     &types.AttributeValueMemberS{Value: input.MessageID},
+			"CreatedTime": &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+			"ExpiresTime": &types.AttributeValueMemberS{Value: expires.Format(time.RFC3339)},
+			"AccessCount": &types.AttributeValueMemberN{Value: "0"},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(MessageID)"),
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+
+	fmt.Println("create share method finished successfully")
+	token := signToken(key, shareID, expires)
+	return &CreateResult{
+		ShareID:     shareID,
+		Token:       token,
+		URL:         input.BaseURL + "/share/" + token,
+		ExpiresTime: expires.Format(time.RFC3339),
+	}, nil
+}
+
+// Revoke revokes a share link of an email, after which the link can't be used even before it expires
+func Revoke(ctx context.Context, client api.UpdateItemAPI, messageID, shareID string) error {
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: itemPrefix + shareID},
+		},
+		UpdateExpression:    aws.String("SET RevokedTime = if_not_exists(RevokedTime, :revokedTime)"),
+		ConditionExpression: aws.String("EmailID = :emailID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":revokedTime": &types.AttributeValueMemberS{Value: getCurrentTime().Format(time.RFC3339)},
+			":emailID":     &types.AttributeValueMemberS{Value: messageID},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return api.ErrShareNotFound
+		}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+
+	fmt.Println("revoke share method finished successfully")
+	return nil
+}
+
+// Open returns the email shared by a share link token, and records the access.
+// ErrShareNotFound is returned for invalid tokens, and ErrShareExpired for expired or revoked links.
+func Open(ctx context.Context, client api.GetEmailAPI, token string) (*email.GetResult, error) {
+	key, err := signingKey()
+	if err != nil {
+		return nil, err
+	}
+	shareID, expires, err := verifyToken(key, token)
+	if err != nil {
+		return nil, err
+	}
+	if !getCurrentTime().Before(expires) {
+		return nil, api.ErrShareExpired
+	}
+
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: itemPrefix + shareID},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, api.ErrShareNotFound
+	}
+	share := &Share{ShareID: shareID}
+	if err := attributevalue.UnmarshalMap(resp.Item, share); err != nil {
+		return nil, err
+	}
+	if share.RevokedTime != "" {
+		return nil, api.ErrShareExpired
+	}
+
+	result, err := email.Get(ctx, client, share.MessageID)
+	if err != nil {
+		if err == api.ErrNotFound {
+			return nil, api.ErrShareNotFound // the email is deleted
+		}
+		return nil, err
+	}
+
+	if err := recordAccess(ctx, client, shareID); err != nil {
+		// the email is still returned, access is logged by the caller regardless
+		fmt.Printf("failed to record share access: %v\n", err)
+	}
+
+	fmt.Printf("share %s of email %s accessed, expires at %s\n", shareID, share.MessageID, share.ExpiresTime)
+	return result, nil
+}
+
+// recordAccess counts the access of a share link and records the time
+func recordAccess(ctx context.Context, client api.UpdateItemAPI, shareID string) error {
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: itemPrefix + shareID},
+		},
+		UpdateExpression: aws.String("ADD AccessCount :one SET LastAccessedTime = :accessedTime"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one":          &types.AttributeValueMemberN{Value: "1"},
+			":accessedTime": &types.AttributeValueMemberS{Value: getCurrentTime().Format(time.RFC3339)},
+		},
+	})
+	return err
+}
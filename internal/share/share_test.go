@@ -0,0 +1,246 @@
+package share
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockShareAPI struct {
+	mockGetItem    func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	mockPutItem    func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	mockUpdateItem func(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+
+	mockTransactWriteItems func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+func (m mockShareAPI) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return m.mockGetItem(ctx, params, optFns...)
+}
+
+func (m mockShareAPI) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return m.mockPutItem(ctx, params, optFns...)
+}
+
+func (m mockShareAPI) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return m.mockUpdateItem(ctx, params, optFns...)
+}
+
+func (m mockShareAPI) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return m.mockTransactWriteItems(ctx, params, optFns...)
+}
+
+var shareTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func setupShare(t *testing.T) func() {
+	oldKey := env.ShareSigningKey
+	oldGetCurrentTime := getCurrentTime
+	env.ShareSigningKey = "key"
+	env.TableName = "table-for-share"
+	getCurrentTime = func() time.Time { return shareTime }
+	return func() {
+		env.ShareSigningKey = oldKey
+		getCurrentTime = oldGetCurrentTime
+	}
+}
+
+func emailItem(emailType string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"MessageID":     &types.AttributeValueMemberS{Value: "exampleMessageID"},
+		"TypeYearMonth": &types.AttributeValueMemberS{Value: emailType + "#2024-05"},
+		"DateTime":      &types.AttributeValueMemberS{Value: "01-12:00:00"},
+		"Subject":       &types.AttributeValueMemberS{Value: "subject"},
+	}
+}
+
+func TestCreate(t *testing.T) {
+	defer setupShare(t)()
+
+	tests := []struct {
+		signingKey  string
+		input       CreateInput
+		emailType   string
+		expectedErr error
+	}{
+		{
+			signingKey: "key",
+			input:      CreateInput{MessageID: "exampleMessageID", BaseURL: "https://api.example.com"},
+			emailType:  "inbox",
+		},
+		{
+			signingKey: "key",
+			input:      CreateInput{MessageID: "exampleMessageID", ExpiresIn: 3600, BaseURL: "https://api.example.com"},
+			emailType:  "sent",
+		},
+		{
+			signingKey:  "",
+			input:       CreateInput{MessageID: "exampleMessageID"},
+			expectedErr: api.ErrSharingDisabled,
+		},
+		{
+			signingKey:  "key",
+			input:       CreateInput{MessageID: "exampleMessageID", ExpiresIn: 31 * 24 * 3600},
+			expectedErr: api.ErrInvalidInput,
+		},
+		{
+			signingKey:  "key",
+			input:       CreateInput{MessageID: "exampleMessageID", ExpiresIn: -1},
+			expectedErr: api.ErrInvalidInput,
+		},
+		{
+			signingKey:  "key",
+			input:       CreateInput{MessageID: "exampleMessageID"},
+			emailType:   "draft",
+			expectedErr: api.ErrInvalidInput,
+		},
+		{
+			signingKey:  "key",
+			input:       CreateInput{MessageID: "exampleMessageID"},
+			expectedErr: api.ErrNotFound,
+		},
+		{
+			signingKey:  "key",
+			input:       CreateInput{MessageID: "share#abc"},
+			expectedErr: api.ErrNotFound,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.ShareSigningKey = test.signingKey
+			var putItem map[string]types.AttributeValue
+			client := mockShareAPI{
+				mockGetItem: func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					if test.emailType == "" {
+						return &dynamodb.GetItemOutput{}, nil
+					}
+					return &dynamodb.GetItemOutput{Item: emailItem(test.emailType)}, nil
+				},
+				mockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+					putItem = params.Item
+					assert.Equal(t, "attribute_not_exists(MessageID)", *params.ConditionExpression)
+					return &dynamodb.PutItemOutput{}, nil
+				},
+			}
+
+			result, err := Create(context.TODO(), client, test.input)
+			assert.Equal(t, test.expectedErr, err)
+			if test.expectedErr != nil {
+				assert.Nil(t, putItem)
+				return
+			}
+
+			expiresIn := DefaultExpiresIn
+			if test.input.ExpiresIn != 0 {
+				expiresIn = time.Duration(test.input.ExpiresIn) * time.Second
+			}
+			assert.Equal(t, shareTime.Add(expiresIn).Format(time.RFC3339), result.ExpiresTime)
+			assert.Equal(t, "https://api.example.com/share/"+result.Token, result.URL)
+			assert.Equal(t, &types.AttributeValueMemberS{Value: "share#" + result.ShareID}, putItem["MessageID"])
+			assert.Equal(t, &types.AttributeValueMemberS{Value: "exampleMessageID"}, putItem["EmailID"])
+
+			shareID, expires, err := verifyToken([]byte("key"), result.Token)
+			assert.Nil(t, err)
+			assert.Equal(t, result.ShareID, shareID)
+			assert.Equal(t, shareTime.Add(expiresIn), expires)
+		})
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	defer setupShare(t)()
+
+	tests := []struct {
+		err         error
+		expectedErr error
+	}{
+		{nil, nil},
+		{&types.ConditionalCheckFailedException{}, api.ErrShareNotFound},
+		{&types.ProvisionedThroughputExceededException{}, api.ErrTooManyRequests},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := mockShareAPI{
+				mockUpdateItem: func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					assert.Equal(t, &types.AttributeValueMemberS{Value: "share#abc"}, params.Key["MessageID"])
+					assert.Equal(t, "EmailID = :emailID", *params.ConditionExpression)
+					assert.Equal(t, &types.AttributeValueMemberS{Value: "exampleMessageID"}, params.ExpressionAttributeValues[":emailID"])
+					return &dynamodb.UpdateItemOutput{}, test.err
+				},
+			}
+
+			err := Revoke(context.TODO(), client, "exampleMessageID", "abc")
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	defer setupShare(t)()
+
+	valid := signToken([]byte("key"), "abc", shareTime.Add(time.Hour))
+	shareItem := map[string]types.AttributeValue{
+		"MessageID":   &types.AttributeValueMemberS{Value: "share#abc"},
+		"EmailID":     &types.AttributeValueMemberS{Value: "exampleMessageID"},
+		"ExpiresTime": &types.AttributeValueMemberS{Value: shareTime.Add(time.Hour).Format(time.RFC3339)},
+		"AccessCount": &types.AttributeValueMemberN{Value: "2"},
+	}
+	revokedItem := map[string]types.AttributeValue{
+		"MessageID":   &types.AttributeValueMemberS{Value: "share#abc"},
+		"EmailID":     &types.AttributeValueMemberS{Value: "exampleMessageID"},
+		"RevokedTime": &types.AttributeValueMemberS{Value: shareTime.Format(time.RFC3339)},
+	}
+
+	tests := []struct {
+		token          string
+		shareItem      map[string]types.AttributeValue
+		emailItem      map[string]types.AttributeValue
+		expectedAccess bool
+		expectedErr    error
+	}{
+		{valid, shareItem, emailItem("inbox"), true, nil},
+		{valid, nil, emailItem("inbox"), false, api.ErrShareNotFound},
+		{valid, revokedItem, emailItem("inbox"), false, api.ErrShareExpired},
+		{valid, shareItem, nil, false, api.ErrShareNotFound}, // email deleted
+		{signToken([]byte("key"), "abc", shareTime), shareItem, emailItem("inbox"), false, api.ErrShareExpired},
+		{signToken([]byte("other-key"), "abc", shareTime.Add(time.Hour)), shareItem, emailItem("inbox"), false, api.ErrShareNotFound},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			accessed := false
+			client := mockShareAPI{
+				mockGetItem: func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					key := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+					if strings.HasPrefix(key, "share#") {
+						return &dynamodb.GetItemOutput{Item: test.shareItem}, nil
+					}
+					assert.Equal(t, "exampleMessageID", key)
+					return &dynamodb.GetItemOutput{Item: test.emailItem}, nil
+				},
+				mockUpdateItem: func(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					accessed = true
+					assert.Equal(t, &types.AttributeValueMemberS{Value: "share#abc"}, params.Key["MessageID"])
+					assert.Equal(t, "ADD AccessCount :one SET LastAccessedTime = :accessedTime", *params.UpdateExpression)
+					return &dynamodb.UpdateItemOutput{}, nil
+				},
+			}
+
+			result, err := Open(context.TODO(), client, test.token)
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expectedAccess, accessed)
+			if test.expectedErr == nil {
+				assert.Equal(t, "subject", result.Subject)
+			}
+		})
+	}
+}
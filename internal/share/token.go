@@ -0,0 +1,50 @@
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/api"
+)
+
+// signToken returns a token in the format of shareID.expiry.signature, where expiry is in Unix seconds.
+// The signature lets links be rejected without reading the database, so they can't be enumerated.
+func signToken(key []byte, shareID string, expires time.Time) string {
+	payload := shareID + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + signature(key, payload)
+}
+
+// verifyToken returns the shareID and expiry of a token, if its signature is valid
+func verifyToken(key []byte, token string) (shareID string, expires time.Time, err error) {
+	payload, sig, ok := cutLast(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signature(key, payload))) {
+		return "", time.Time{}, api.ErrShareNotFound
+	}
+
+	shareID, expiry, ok := strings.Cut(payload, ".")
+	if !ok || shareID == "" {
+		return "", time.Time{}, api.ErrShareNotFound
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", time.Time{}, api.ErrShareNotFound
+	}
+	return shareID, time.Unix(unix, 0).UTC(), nil
+}
+
+func signature(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,42 @@
+package share
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyToken(t *testing.T) {
+	key := []byte("key")
+	expires := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	token := signToken(key, "abc123", expires)
+
+	shareID, actualExpires, err := verifyToken(key, token)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc123", shareID)
+	assert.Equal(t, expires, actualExpires)
+
+	tests := []struct {
+		key   []byte
+		token string
+	}{
+		{[]byte("other-key"), token},
+		{key, "abc123.1714564800"},
+		{key, "abc123.1714568400" + token[len("abc123.1714564800"):]}, // extended expiry
+		{key, "abd123" + token[len("abc123"):]},
+		{key, ""},
+		{key, "..."},
+		{key, "." + signature(key, "")},
+		{key, "abc123.x." + signature(key, "abc123.x")},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			_, _, err := verifyToken(test.key, test.token)
+			assert.Equal(t, api.ErrShareNotFound, err)
+		})
+	}
+}
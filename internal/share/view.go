@@ -0,0 +1,102 @@
+package share
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/util/addr"
+	"github.com/harryzcy/mailbox/internal/util/htmlutil"
+)
+
+// ViewHeaders are the headers of the shared view, which is static HTML that loads nothing else.
+// Links in the email are kept as text, so no request is made on behalf of the viewer.
+var ViewHeaders = map[string]string{
+	"Content-Type":            "text/html; charset=utf-8",
+	"Content-Security-Policy": "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'",
+	"Cache-Control":           "no-store",
+	"Referrer-Policy":         "no-referrer",
+	"X-Content-Type-Options":  "nosniff",
+	"X-Robots-Tag":            "noindex, nofollow",
+}
+
+var viewTemplate = template.Must(template.New("view").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Subject}}</title>
+<style>
+body { font-family: sans-serif; max-width: 48em; margin: 2em auto; padding: 0 1em; color: #222; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 0.25em 1em; color: #555; }
+dt { font-weight: bold; }
+dd { margin: 0; }
+pre { white-space: pre-wrap; word-wrap: break-word; font-family: inherit; border-top: 1px solid #ddd; padding-top: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Subject}}</h1>
+<dl>
+<dt>From</dt><dd>{{.From}}</dd>
+<dt>To</dt><dd>{{.To}}</dd>
+{{- if .Cc}}
+<dt>Cc</dt><dd>{{.Cc}}</dd>
+{{- end}}
+<dt>Date</dt><dd>{{.Date}}</dd>
+{{- if .Attachments}}
+<dt>Attachments</dt><dd>{{.Attachments}}</dd>
+{{- end}}
+</dl>
+<pre>{{.Text}}</pre>
+</body>
+</html>
+`))
+
+type view struct {
+	Subject     string
+	From        string
+	To          string
+	Cc          string
+	Date        string
+	Attachments string
+	Text        string
+}
+
+// RenderView renders a read-only view of a shared email, with the text content only.
+// The HTML content is converted to text, so that no scripts, styles, or remote resources of the email are rendered.
+func RenderView(result *email.GetResult) (string, error) {
+	v := view{
+		Subject: result.Subject,
+		From:    strings.Join(addr.DisplayAll(result.From), ", "),
+		To:      strings.Join(addr.DisplayAll(result.To), ", "),
+		Cc:      strings.Join(addr.DisplayAll(result.Cc), ", "),
+		Text:    result.Text,
+	}
+	switch {
+	case result.TimeReceived != "":
+		v.Date = result.TimeReceived
+	case result.TimeSent != "":
+		v.Date = result.TimeSent
+	}
+	if v.Text == "" && result.HTML != "" {
+		text, err := htmlutil.GenerateText(result.HTML)
+		if err != nil {
+			return "", err
+		}
+		v.Text = text
+	}
+	if result.Attachments != nil {
+		var names []string
+		for _, file := range *result.Attachments {
+			names = append(names, file.Filename)
+		}
+		v.Attachments = strings.Join(names, ", ")
+	}
+
+	var b bytes.Buffer
+	if err := viewTemplate.Execute(&b, v); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,40 @@
+package share
+
+import (
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderView(t *testing.T) {
+	body, err := RenderView(&email.GetResult{
+		Subject:      "<script>alert(1)</script>",
+		From:         []string{"Alice <alice@example.com>"},
+		To:           []string{"bob@xn--bcher-kva.example"},
+		TimeReceived: "2024-05-01T12:00:00Z",
+		Text:         "Hello\n<img src=\"https://tracker.example.com\">",
+		Attachments:  &types.Files{{Filename: "report.pdf"}},
+	})
+	assert.Nil(t, err)
+	assert.Contains(t, body, "<title>&lt;script&gt;alert(1)&lt;/script&gt;</title>")
+	assert.Contains(t, body, "<dd>Alice &lt;alice@example.com&gt;</dd>")
+	assert.Contains(t, body, "<dd>bob@bücher.example</dd>")
+	assert.Contains(t, body, "<dd>2024-05-01T12:00:00Z</dd>")
+	assert.Contains(t, body, "<dd>report.pdf</dd>")
+	assert.Contains(t, body, "Hello\n&lt;img src=&#34;https://tracker.example.com&#34;&gt;")
+	assert.NotContains(t, body, "<script>")
+	assert.NotContains(t, body, "Cc")
+
+	// HTML content is converted to text
+	body, err = RenderView(&email.GetResult{
+		Subject:  "Hi",
+		TimeSent: "2024-05-01T12:00:00Z",
+		HTML:     "<p>Hello <b>world</b></p><script>alert(1)</script><img src=\"https://tracker.example.com\">",
+	})
+	assert.Nil(t, err)
+	assert.Contains(t, body, "Hello *world*")
+	assert.NotContains(t, body, "tracker.example.com")
+	assert.NotContains(t, body, "alert(1)")
+}
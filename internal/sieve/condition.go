@@ -0,0 +1,378 @@
+package sieve
+
+import (
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// condition is a compiled test
+type condition interface {
+	eval(msg Message) bool
+}
+
+// Match types
+const (
+	matchIs       = "is"
+	matchContains = "contains"
+	matchMatches  = "matches"
+)
+
+// Comparators
+const (
+	comparatorASCIICasemap = "i;ascii-casemap"
+	comparatorOctet        = "i;octet"
+)
+
+// Address parts
+const (
+	addressAll       = "all"
+	addressLocalpart = "localpart"
+	addressDomain    = "domain"
+)
+
+// matcher compares values with keys
+type matcher struct {
+	matchType  string
+	comparator string
+	keys       []string
+}
+
+// match returns true if value matches any key
+func (m matcher) match(value string) bool {
+	if m.comparator == comparatorASCIICasemap {
+		value = asciiLower(value)
+	}
+	for _, key := range m.keys {
+		if m.comparator == comparatorASCIICasemap {
+			key = asciiLower(key)
+		}
+		switch m.matchType {
+		case matchIs:
+			if value == key {
+				return true
+			}
+		case matchContains:
+			if strings.Contains(value, key) {
+				return true
+			}
+		case matchMatches:
+			if wildcardMatch(key, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type headerCondition struct {
+	names []string
+	matcher
+}
+
+func (c headerCondition) eval(msg Message) bool {
+	for _, name := range c.names {
+		for _, value := range msg.header(name) {
+			if c.match(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type addressCondition struct {
+	names []string
+	part  string
+	matcher
+}
+
+func (c addressCondition) eval(msg Message) bool {
+	for _, name := range c.names {
+		for _, value := range msg.rawHeader(name) {
+			for _, address := range parseAddresses(value) {
+				if c.match(addressPart(address, c.part)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+type existsCondition struct {
+	names []string
+}
+
+func (c existsCondition) eval(msg Message) bool {
+	for _, name := range c.names {
+		if len(msg.header(name)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type sizeCondition struct {
+	over  bool
+	limit int64
+}
+
+func (c sizeCondition) eval(msg Message) bool {
+	if c.over {
+		return msg.size > c.limit
+	}
+	return msg.size < c.limit
+}
+
+type allofCondition []condition
+
+func (c allofCondition) eval(msg Message) bool {
+	for _, cond := range c {
+		if !cond.eval(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+type anyofCondition []condition
+
+func (c anyofCondition) eval(msg Message) bool {
+	for _, cond := range c {
+		if cond.eval(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+type notCondition struct {
+	cond condition
+}
+
+func (c notCondition) eval(msg Message) bool {
+	return !c.cond.eval(msg)
+}
+
+type constCondition bool
+
+func (c constCondition) eval(Message) bool {
+	return bool(c)
+}
+
+// test compiles a test
+//
+//gocyclo:ignore
+func (c *compiler) test(t test) (condition, error) {
+	switch t.name {
+	case "true", "false":
+		if len(t.args) > 0 || len(t.tests) > 0 {
+			return nil, errorf(t.line, "'%s' doesn't take arguments", t.name)
+		}
+		return constCondition(t.name == "true"), nil
+	case "not":
+		if len(t.args) > 0 || len(t.tests) != 1 {
+			return nil, errorf(t.line, "'not' expects a single test")
+		}
+		cond, err := c.test(t.tests[0])
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{cond: cond}, nil
+	case "allof", "anyof":
+		if len(t.args) > 0 || len(t.tests) == 0 {
+			return nil, errorf(t.line, "'%s' expects a test list", t.name)
+		}
+		conds := make([]condition, len(t.tests))
+		for i, nested := range t.tests {
+			cond, err := c.test(nested)
+			if err != nil {
+				return nil, err
+			}
+			conds[i] = cond
+		}
+		if t.name == "allof" {
+			return allofCondition(conds), nil
+		}
+		return anyofCondition(conds), nil
+	}
+
+	if len(t.tests) > 0 {
+		return nil, errorf(t.line, "'%s' doesn't take tests", t.name)
+	}
+
+	switch t.name {
+	case "exists":
+		if len(t.args) != 1 || t.args[0].kind != argumentStrings {
+			return nil, errorf(t.line, "'exists' expects a string list of header names")
+		}
+		return existsCondition{names: t.args[0].strings}, nil
+	case "size":
+		if len(t.args) != 2 || t.args[0].kind != argumentTag || t.args[1].kind != argumentNumber ||
+			(t.args[0].tag != "over" && t.args[0].tag != "under") {
+			return nil, errorf(t.line, "'size' expects :over or :under and a number")
+		}
+		return sizeCondition{over: t.args[0].tag == "over", limit: t.args[1].number}, nil
+	case "header", "address":
+		return c.headerTest(t)
+	default:
+		return nil, errorf(t.line, "unsupported test '%s'", t.name)
+	}
+}
+
+// headerTest compiles a header or address test, whose tags come before the header names and keys
+func (c *compiler) headerTest(t test) (condition, error) {
+	m := matcher{matchType: matchIs, comparator: comparatorASCIICasemap}
+	part := addressAll
+	var matchTypeSet, comparatorSet, partSet bool
+
+	args := t.args
+	for len(args) > 0 && args[0].kind == argumentTag {
+		tag := args[0].tag
+		switch {
+		case tag == matchIs || tag == matchContains || tag == matchMatches:
+			if matchTypeSet {
+				return nil, errorf(t.line, "match type specified more than once")
+			}
+			matchTypeSet = true
+			m.matchType = tag
+		case tag == "comparator":
+			if comparatorSet {
+				return nil, errorf(t.line, "comparator specified more than once")
+			}
+			comparatorSet = true
+			if len(args) < 2 || args[1].kind != argumentStrings || len(args[1].strings) != 1 {
+				return nil, errorf(t.line, ":comparator expects a string")
+			}
+			m.comparator = strings.ToLower(args[1].strings[0])
+			if m.comparator != comparatorASCIICasemap && m.comparator != comparatorOctet {
+				return nil, errorf(t.line, "unsupported comparator %q", args[1].strings[0])
+			}
+			args = args[1:]
+		case t.name == "address" && (tag == addressAll || tag == addressLocalpart || tag == addressDomain):
+			if partSet {
+				return nil, errorf(t.line, "address part specified more than once")
+			}
+			partSet = true
+			part = tag
+		default:
+			return nil, errorf(t.line, "unsupported tag ':%s' for '%s'", tag, t.name)
+		}
+		args = args[1:]
+	}
+
+	if len(args) != 2 || args[0].kind != argumentStrings || args[1].kind != argumentStrings {
+		return nil, errorf(t.line, "'%s' expects a string list of header names and a string list of keys", t.name)
+	}
+	for _, name := range args[0].strings {
+		if !validHeaderName(name) {
+			return nil, errorf(t.line, "invalid header name %q", name)
+		}
+	}
+	m.keys = args[1].strings
+
+	if t.name == "address" {
+		return addressCondition{names: args[0].strings, part: part, matcher: m}, nil
+	}
+	return headerCondition{names: args[0].strings, matcher: m}, nil
+}
+
+// validHeaderName returns true if name consists of printable ASCII characters except colon
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] <= ' ' || name[i] > '~' || name[i] == ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAddresses returns the addresses in a header value, skipping addresses that can't be parsed
+func parseAddresses(value string) []string {
+	if list, err := mail.ParseAddressList(value); err == nil {
+		addresses := make([]string, len(list))
+		for i, address := range list {
+			addresses[i] = address.Address
+		}
+		return addresses
+	}
+
+	var addresses []string
+	for _, part := range strings.Split(value, ",") {
+		if address, err := mail.ParseAddress(part); err == nil {
+			addresses = append(addresses, address.Address)
+		}
+	}
+	return addresses
+}
+
+func addressPart(address, part string) string {
+	i := strings.LastIndexByte(address, '@')
+	switch {
+	case part == addressLocalpart && i != -1:
+		return address[:i]
+	case part == addressDomain && i != -1:
+		return address[i+1:]
+	case part == addressDomain:
+		return ""
+	default:
+		return address
+	}
+}
+
+// asciiLower maps ASCII uppercase letters to lowercase, as the i;ascii-casemap comparator does
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// wildcardMatch returns true if value matches pattern, where * matches any sequence of characters,
+// ? matches a single character, and a backslash escapes the next character
+func wildcardMatch(pattern, value string) bool {
+	p, v := 0, 0
+	starP, starV := -1, 0
+	for v < len(value) {
+		if p < len(pattern) {
+			switch c := pattern[p]; {
+			case c == '*':
+				starP, starV = p, v
+				p++
+				continue
+			case c == '?':
+				_, size := utf8.DecodeRuneInString(value[v:])
+				p++
+				v += size
+				continue
+			case c == '\\' && p+1 < len(pattern):
+				if pattern[p+1] == value[v] {
+					p += 2
+					v++
+					continue
+				}
+			case c == value[v]:
+				p++
+				v++
+				continue
+			}
+		}
+		if starP == -1 {
+			return false
+		}
+		// backtrack, letting the last * match one more character
+		starV++
+		p, v = starP+1, starV
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
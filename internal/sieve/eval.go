@@ -0,0 +1,164 @@
+package sieve
+
+import (
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+
+	"github.com/harryzcy/mailbox/internal/types"
+)
+
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: charset.NewReaderLabel,
+}
+
+// Message is the part of an email that tests inspect
+type Message struct {
+	headers map[string][]string // lowercase name -> raw values
+	size    int64
+}
+
+// NewMessage returns a message with the header fields and the size of an email
+func NewMessage(headers types.Headers, size int64) Message {
+	msg := Message{headers: make(map[string][]string), size: size}
+	for _, header := range headers {
+		name := strings.ToLower(header.Name)
+		msg.headers[name] = append(msg.headers[name], header.Value)
+	}
+	return msg
+}
+
+// rawHeader returns the values of the header fields with name, which is case-insensitive
+func (m Message) rawHeader(name string) []string {
+	return m.headers[strings.ToLower(name)]
+}
+
+// header returns the values of the header fields with name, with encoded words decoded
+func (m Message) header(name string) []string {
+	raw := m.rawHeader(name)
+	values := make([]string, len(raw))
+	for i, value := range raw {
+		decoded, err := wordDecoder.DecodeHeader(value)
+		if err != nil {
+			decoded = value
+		}
+		values[i] = decoded
+	}
+	return values
+}
+
+// Result is the outcome of running a script on an email
+type Result struct {
+	// Keep is true if the email stays in the inbox, either by the keep action,
+	// or by the implicit keep, which is canceled by discard, fileinto and redirect
+	Keep     bool
+	FileInto []string // mailboxes the email is filed into, in the order of the actions
+	Redirect []string // addresses the email is redirected to, up to MaxRedirects
+}
+
+// Discarded returns true if the email is neither kept nor filed into any mailbox
+func (r Result) Discarded() bool {
+	return !r.Keep && len(r.FileInto) == 0
+}
+
+// Step is a branch taken or an action run by a script
+type Step struct {
+	Line     int    `json:"line"`
+	Command  string `json:"command"`            // if, elsif, else, or the action
+	Argument string `json:"argument,omitempty"` // mailbox of fileinto, address of redirect
+}
+
+// Execute runs the script on a message
+func (s *Script) Execute(msg Message) Result {
+	result, _ := s.Trace(msg)
+	return result
+}
+
+// Trace runs the script on a message like Execute,
+// and also returns the branches taken and the actions run, in order
+func (s *Script) Trace(msg Message) (Result, []Step) {
+	e := &execution{implicitKeep: true}
+	e.run(s.commands, msg)
+
+	return Result{
+		Keep:     e.keep || e.implicitKeep,
+		FileInto: e.fileInto,
+		Redirect: e.redirect,
+	}, e.steps
+}
+
+type execution struct {
+	implicitKeep bool
+	keep         bool
+	fileInto     []string
+	redirect     []string
+	steps        []Step
+}
+
+// run executes nodes, and returns false if the script is stopped
+func (e *execution) run(nodes []node, msg Message) bool {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *ifNode:
+			taken := len(n.blocks) - 1 // else block, if any
+			if len(n.blocks) == len(n.conditions) {
+				taken = -1
+			}
+			for i, cond := range n.conditions {
+				if cond.eval(msg) {
+					taken = i
+					break
+				}
+			}
+			if taken == -1 {
+				continue
+			}
+			e.steps = append(e.steps, Step{Line: n.lines[taken], Command: branchName(n, taken)})
+			if !e.run(n.blocks[taken], msg) {
+				return false
+			}
+		case actionNode:
+			e.steps = append(e.steps, Step{Line: n.line, Command: n.name, Argument: n.arg})
+			switch n.name {
+			case "stop":
+				return false
+			case "keep":
+				e.keep = true
+			case "discard":
+				e.implicitKeep = false
+			case "fileinto":
+				e.implicitKeep = false
+				e.fileInto = appendUnique(e.fileInto, n.arg)
+			case "redirect":
+				e.implicitKeep = false
+				if len(e.redirect) < MaxRedirects {
+					e.redirect = appendUnique(e.redirect, n.arg)
+				}
+			}
+		}
+	}
+	return true
+}
+
+// branchName returns the command of the i-th block of an if chain
+func branchName(n *ifNode, i int) string {
+	switch {
+	case i == 0:
+		return "if"
+	case i < len(n.conditions):
+		return "elsif"
+	default:
+		return "else"
+	}
+}
+
+// appendUnique appends value unless it's in values, since duplicate actions are performed once
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,238 @@
+package sieve
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenTag    // e.g. :contains, the text doesn't include the colon
+	tokenString // quoted or multi-line string
+	tokenNumber
+	tokenSymbol // one of [ ] ( ) , ; { }
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	number int64
+	line   int
+}
+
+// Error is a syntax or validation error of a script
+type Error struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+func errorf(line int, format string, args ...any) *Error {
+	return &Error{Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+// lex splits a script into tokens, as defined in RFC 5228 section 8.1
+func lex(src string) ([]token, error) {
+	l := &lexer{src: src, line: 1}
+	var tokens []token
+	for {
+		t, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+		if t.kind == tokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpace(); err != nil {
+		return token{}, err
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, line: l.line}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("[](),;{}", c) != -1:
+		l.pos++
+		return token{kind: tokenSymbol, text: string(c), line: l.line}, nil
+	case c == '"':
+		return l.quoted()
+	case c == ':':
+		l.pos++
+		name := l.identifier()
+		if name == "" {
+			return token{}, errorf(l.line, "expected tag name after ':'")
+		}
+		return token{kind: tokenTag, text: strings.ToLower(name), line: l.line}, nil
+	case isDigit(c):
+		return l.number()
+	case isIdentifierStart(c):
+		line := l.line
+		name := l.identifier()
+		if strings.EqualFold(name, "text") && strings.HasPrefix(l.src[l.pos:], ":") {
+			l.pos++
+			return l.multiline(line)
+		}
+		return token{kind: tokenIdentifier, text: strings.ToLower(name), line: line}, nil
+	default:
+		return token{}, errorf(l.line, "unexpected character %q", c)
+	}
+}
+
+// skipSpace skips white space and comments
+func (l *lexer) skipSpace() error {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case c == '#':
+			end := strings.IndexByte(l.src[l.pos:], '\n')
+			if end == -1 {
+				l.pos = len(l.src)
+			} else {
+				l.pos += end
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end == -1 {
+				return errorf(l.line, "unterminated comment")
+			}
+			comment := l.src[l.pos : l.pos+2+end+2]
+			l.line += strings.Count(comment, "\n")
+			l.pos += len(comment)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *lexer) identifier() string {
+	start := l.pos
+	for l.pos < len(l.src) && (isIdentifierStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+		l.pos++
+	}
+	return l.src[start:l.pos]
+}
+
+// number reads a number with an optional quantifier, K, M or G
+func (l *lexer) number() (token, error) {
+	var n int64
+	for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+		d := int64(l.src[l.pos] - '0')
+		if n > (math.MaxInt64-d)/10 {
+			return token{}, errorf(l.line, "number too large")
+		}
+		n = n*10 + d
+		l.pos++
+	}
+
+	if l.pos < len(l.src) {
+		var multiplier int64
+		switch l.src[l.pos] {
+		case 'K', 'k':
+			multiplier = 1 << 10
+		case 'M', 'm':
+			multiplier = 1 << 20
+		case 'G', 'g':
+			multiplier = 1 << 30
+		}
+		if multiplier != 0 {
+			if n > math.MaxInt64/multiplier {
+				return token{}, errorf(l.line, "number too large")
+			}
+			n *= multiplier
+			l.pos++
+		}
+	}
+	return token{kind: tokenNumber, number: n, line: l.line}, nil
+}
+
+// quoted reads a quoted string, where a backslash escapes the next character
+func (l *lexer) quoted() (token, error) {
+	line := l.line
+	l.pos++ // opening quote
+
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return token{kind: tokenString, text: b.String(), line: line}, nil
+		case '\\':
+			l.pos++
+			if l.pos < len(l.src) {
+				c = l.src[l.pos]
+			}
+		}
+		if c == '\n' {
+			l.line++
+		}
+		b.WriteByte(c)
+		l.pos++
+	}
+	return token{}, errorf(line, "unterminated string")
+}
+
+// multiline reads a multi-line string after "text:", which ends with a line containing only a dot
+func (l *lexer) multiline(line int) (token, error) {
+	// the rest of the first line may contain white space and a hash comment
+	end := strings.IndexByte(l.src[l.pos:], '\n')
+	if end == -1 {
+		return token{}, errorf(line, "unterminated multi-line string")
+	}
+	rest := strings.TrimSpace(l.src[l.pos : l.pos+end])
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return token{}, errorf(line, "unexpected text after 'text:'")
+	}
+	l.pos += end + 1
+	l.line++
+
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		end := strings.IndexByte(l.src[l.pos:], '\n')
+		if end == -1 {
+			break
+		}
+		text := l.src[l.pos : l.pos+end+1]
+		l.pos += end + 1
+		l.line++
+
+		if strings.TrimRight(text, "\r\n") == "." {
+			return token{kind: tokenString, text: b.String(), line: line}, nil
+		}
+		// dot-stuffing
+		b.WriteString(strings.TrimPrefix(text, "."))
+	}
+	return token{}, errorf(line, "unterminated multi-line string")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,257 @@
+package sieve
+
+type argumentKind int
+
+const (
+	argumentTag argumentKind = iota
+	argumentStrings
+	argumentNumber
+)
+
+// argument is a tag, a string or string list, or a number
+type argument struct {
+	kind    argumentKind
+	tag     string
+	strings []string
+	number  int64
+	line    int
+}
+
+// test is a test with its arguments, and the nested tests of allof, anyof and not
+type test struct {
+	name  string
+	args  []argument
+	tests []test
+	line  int
+}
+
+// command is a command with its arguments, tests of control commands, and the block of if, elsif and else
+type command struct {
+	name     string
+	args     []argument
+	tests    []test
+	block    []command
+	hasBlock bool
+	line     int
+}
+
+// maxNesting is the maximum depth of nested blocks and tests
+const maxNesting = 16
+
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+// parse parses a script into commands, as defined in RFC 5228 section 8.2
+func parse(src string) ([]command, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	commands, err := p.commands()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, errorf(t.line, "unexpected %s", describe(t))
+	}
+	return commands, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isSymbol(symbol string) bool {
+	t := p.peek()
+	return t.kind == tokenSymbol && t.text == symbol
+}
+
+func (p *parser) expectSymbol(symbol string) error {
+	if !p.isSymbol(symbol) {
+		t := p.peek()
+		return errorf(t.line, "expected '%s' but found %s", symbol, describe(t))
+	}
+	p.advance()
+	return nil
+}
+
+func (p *parser) nest(line int) error {
+	p.depth++
+	if p.depth > maxNesting {
+		return errorf(line, "nested too deeply")
+	}
+	return nil
+}
+
+// commands parses commands until the end of the script or block
+func (p *parser) commands() ([]command, error) {
+	var commands []command
+	for {
+		t := p.peek()
+		if t.kind == tokenEOF || p.isSymbol("}") {
+			return commands, nil
+		}
+		if t.kind != tokenIdentifier {
+			return nil, errorf(t.line, "expected command but found %s", describe(t))
+		}
+		cmd, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, cmd)
+	}
+}
+
+func (p *parser) command() (command, error) {
+	t := p.advance()
+	cmd := command{name: t.text, line: t.line}
+
+	var err error
+	cmd.args, cmd.tests, err = p.arguments()
+	if err != nil {
+		return command{}, err
+	}
+
+	if p.isSymbol(";") {
+		p.advance()
+		return cmd, nil
+	}
+	if !p.isSymbol("{") {
+		next := p.peek()
+		return command{}, errorf(next.line, "expected ';' or '{' but found %s", describe(next))
+	}
+	p.advance()
+	if err := p.nest(t.line); err != nil {
+		return command{}, err
+	}
+	cmd.hasBlock = true
+	cmd.block, err = p.commands()
+	if err != nil {
+		return command{}, err
+	}
+	p.depth--
+	return cmd, p.expectSymbol("}")
+}
+
+// arguments parses arguments followed by an optional test or test list
+func (p *parser) arguments() ([]argument, []test, error) {
+	var args []argument
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokenTag:
+			p.advance()
+			args = append(args, argument{kind: argumentTag, tag: t.text, line: t.line})
+		case t.kind == tokenNumber:
+			p.advance()
+			args = append(args, argument{kind: argumentNumber, number: t.number, line: t.line})
+		case t.kind == tokenString:
+			p.advance()
+			args = append(args, argument{kind: argumentStrings, strings: []string{t.text}, line: t.line})
+		case p.isSymbol("["):
+			list, err := p.stringList()
+			if err != nil {
+				return nil, nil, err
+			}
+			args = append(args, argument{kind: argumentStrings, strings: list, line: t.line})
+		case t.kind == tokenIdentifier:
+			tst, err := p.test()
+			if err != nil {
+				return nil, nil, err
+			}
+			return args, []test{tst}, nil
+		case p.isSymbol("("):
+			tests, err := p.testList()
+			if err != nil {
+				return nil, nil, err
+			}
+			return args, tests, nil
+		default:
+			return args, nil, nil
+		}
+	}
+}
+
+func (p *parser) stringList() ([]string, error) {
+	p.advance() // [
+	var list []string
+	for {
+		t := p.advance()
+		if t.kind != tokenString {
+			return nil, errorf(t.line, "expected string but found %s", describe(t))
+		}
+		list = append(list, t.text)
+		if p.isSymbol("]") {
+			p.advance()
+			return list, nil
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) test() (test, error) {
+	t := p.advance()
+	if t.kind != tokenIdentifier {
+		return test{}, errorf(t.line, "expected test but found %s", describe(t))
+	}
+	if err := p.nest(t.line); err != nil {
+		return test{}, err
+	}
+	defer func() { p.depth-- }()
+
+	args, tests, err := p.arguments()
+	if err != nil {
+		return test{}, err
+	}
+	return test{name: t.text, args: args, tests: tests, line: t.line}, nil
+}
+
+func (p *parser) testList() ([]test, error) {
+	p.advance() // (
+	var tests []test
+	for {
+		tst, err := p.test()
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, tst)
+		if p.isSymbol(")") {
+			p.advance()
+			return tests, nil
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of script"
+	case tokenIdentifier:
+		return "'" + t.text + "'"
+	case tokenTag:
+		return "':" + t.text + "'"
+	case tokenString:
+		return "string"
+	case tokenNumber:
+		return "number"
+	default:
+		return "'" + t.text + "'"
+	}
+}
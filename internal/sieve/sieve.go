@@ -0,0 +1,228 @@
+// Package sieve implements a subset of the Sieve email filtering language (RFC 5228),
+// so that existing filters can be used on received emails.
+//
+// Supported are the require, if, elsif, else, stop, keep, discard, fileinto and redirect commands,
+// and the header, address, exists, size, allof, anyof, not, true and false tests,
+// with the :is, :contains and :matches match types and the i;ascii-casemap and i;octet comparators.
+package sieve
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// MaxScriptSize is the maximum size of a script in bytes
+const MaxScriptSize = 64 << 10
+
+// MaxRedirects is the maximum number of addresses an email is redirected to
+const MaxRedirects = 5
+
+// maxMailboxLength is the maximum length of a fileinto mailbox, which is stored as a label
+const maxMailboxLength = 100
+
+// Extensions that can be required
+var extensions = map[string]bool{
+	"fileinto":                   true,
+	"comparator-i;octet":         true,
+	"comparator-i;ascii-casemap": true,
+}
+
+// Script is a compiled script
+type Script struct {
+	commands []node
+}
+
+// node is an executable command
+type node interface{}
+
+type ifNode struct {
+	conditions []condition // conditions of if and elsif
+	blocks     [][]node    // blocks of if, elsif and else, which has one more block than conditions
+	lines      []int       // lines of if, elsif and else, one for each block
+}
+
+type actionNode struct {
+	name string // keep, discard, fileinto, redirect or stop
+	arg  string // mailbox of fileinto, address of redirect
+	line int
+}
+
+// Compile parses and validates a script
+func Compile(src string) (*Script, error) {
+	if len(src) > MaxScriptSize {
+		return nil, &Error{Line: 1, Message: "script too large"}
+	}
+	commands, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compiler{required: make(map[string]bool)}
+	nodes, err := c.block(commands, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Script{commands: nodes}, nil
+}
+
+// Rules returns the if, elsif and else branches of the script, in the order they appear
+func (s *Script) Rules() []Step {
+	return rules(s.commands, nil)
+}
+
+func rules(nodes []node, steps []Step) []Step {
+	for _, n := range nodes {
+		if n, ok := n.(*ifNode); ok {
+			for i, block := range n.blocks {
+				steps = append(steps, Step{Line: n.lines[i], Command: branchName(n, i)})
+				steps = rules(block, steps)
+			}
+		}
+	}
+	return steps
+}
+
+type compiler struct {
+	required map[string]bool
+}
+
+// block compiles the commands of the script, or of an if, elsif or else block
+func (c *compiler) block(commands []command, topLevel bool) ([]node, error) {
+	var nodes []node
+	requireAllowed := topLevel
+	for i := 0; i < len(commands); i++ {
+		cmd := commands[i]
+		if cmd.name != "require" {
+			requireAllowed = false
+		}
+		if cmd.hasBlock && cmd.name != "if" && cmd.name != "elsif" && cmd.name != "else" {
+			return nil, errorf(cmd.line, "'%s' can't have a block", cmd.name)
+		}
+
+		switch cmd.name {
+		case "require":
+			if !requireAllowed {
+				return nil, errorf(cmd.line, "'require' must come before other commands")
+			}
+			if err := c.require(cmd); err != nil {
+				return nil, err
+			}
+		case "if":
+			n, next, err := c.ifChain(commands, i)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+			i = next - 1
+		case "elsif", "else":
+			return nil, errorf(cmd.line, "'%s' must follow 'if' or 'elsif'", cmd.name)
+		default:
+			n, err := c.action(cmd)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
+
+func (c *compiler) require(cmd command) error {
+	if len(cmd.args) != 1 || cmd.args[0].kind != argumentStrings || len(cmd.tests) > 0 {
+		return errorf(cmd.line, "'require' expects a string list of extensions")
+	}
+	for _, extension := range cmd.args[0].strings {
+		if !extensions[strings.ToLower(extension)] {
+			return errorf(cmd.line, "unsupported extension %q", extension)
+		}
+		c.required[strings.ToLower(extension)] = true
+	}
+	return nil
+}
+
+// ifChain compiles an if command at commands[i] with the following elsif and else commands,
+// and returns the index of the next command
+func (c *compiler) ifChain(commands []command, i int) (node, int, error) {
+	n := &ifNode{}
+	for ; i < len(commands); i++ {
+		cmd := commands[i]
+		if len(n.conditions) > 0 && cmd.name != "elsif" && cmd.name != "else" {
+			break
+		}
+		if !cmd.hasBlock {
+			return nil, 0, errorf(cmd.line, "'%s' expects a block", cmd.name)
+		}
+
+		if cmd.name == "else" {
+			if len(cmd.args) > 0 || len(cmd.tests) > 0 {
+				return nil, 0, errorf(cmd.line, "'else' doesn't take arguments")
+			}
+		} else {
+			if len(cmd.args) > 0 || len(cmd.tests) != 1 {
+				return nil, 0, errorf(cmd.line, "'%s' expects a single test", cmd.name)
+			}
+			cond, err := c.test(cmd.tests[0])
+			if err != nil {
+				return nil, 0, err
+			}
+			n.conditions = append(n.conditions, cond)
+		}
+
+		block, err := c.block(cmd.block, false)
+		if err != nil {
+			return nil, 0, err
+		}
+		n.blocks = append(n.blocks, block)
+		n.lines = append(n.lines, cmd.line)
+		if cmd.name == "else" {
+			return n, i + 1, nil
+		}
+	}
+	return n, i, nil
+}
+
+func (c *compiler) action(cmd command) (node, error) {
+	if len(cmd.tests) > 0 {
+		return nil, errorf(cmd.line, "'%s' doesn't take tests", cmd.name)
+	}
+
+	switch cmd.name {
+	case "keep", "discard", "stop":
+		if len(cmd.args) > 0 {
+			return nil, errorf(cmd.line, "'%s' doesn't take arguments", cmd.name)
+		}
+		return actionNode{name: cmd.name, line: cmd.line}, nil
+	case "fileinto":
+		if !c.required["fileinto"] {
+			return nil, errorf(cmd.line, "'fileinto' requires the \"fileinto\" extension")
+		}
+		mailbox, err := singleString(cmd)
+		if err != nil {
+			return nil, err
+		}
+		mailbox = strings.TrimSpace(mailbox)
+		if mailbox == "" || len(mailbox) > maxMailboxLength {
+			return nil, errorf(cmd.line, "mailbox must be 1 to %d bytes", maxMailboxLength)
+		}
+		return actionNode{name: cmd.name, arg: mailbox, line: cmd.line}, nil
+	case "redirect":
+		address, err := singleString(cmd)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := mail.ParseAddress(address)
+		if err != nil || parsed.Address != strings.TrimSpace(address) {
+			return nil, errorf(cmd.line, "invalid redirect address %q", address)
+		}
+		return actionNode{name: cmd.name, arg: parsed.Address, line: cmd.line}, nil
+	default:
+		return nil, errorf(cmd.line, "unsupported command '%s'", cmd.name)
+	}
+}
+
+func singleString(cmd command) (string, error) {
+	if len(cmd.args) != 1 || cmd.args[0].kind != argumentStrings || len(cmd.args[0].strings) != 1 {
+		return "", errorf(cmd.line, "'%s' expects a single string", cmd.name)
+	}
+	return cmd.args[0].strings[0], nil
+}
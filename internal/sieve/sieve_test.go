@@ -0,0 +1,231 @@
+package sieve
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMessage = NewMessage(types.Headers{
+	{Name: "From", Value: `"Alice Example" <Alice@Example.com>`},
+	{Name: "To", Value: "bob@example.org, carol@lists.example.net"},
+	{Name: "Subject", Value: "=?UTF-8?Q?Weekly_report_=E2=80=94_March?="},
+	{Name: "List-Id", Value: "<dev.lists.example.net>"},
+	{Name: "X-Spam-Score", Value: "7.5"},
+}, 150<<10)
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		script   string
+		expected Result
+	}{
+		{"", Result{Keep: true}},
+		{"keep;", Result{Keep: true}},
+		{"discard;", Result{}},
+		{"discard; keep;", Result{Keep: true}},
+		{`require "fileinto"; fileinto "Reports";`, Result{FileInto: []string{"Reports"}}},
+		{`require ["fileinto"]; fileinto "Reports"; fileinto "Reports"; keep;`, Result{Keep: true, FileInto: []string{"Reports"}}},
+		{`redirect "dave@example.com"; redirect "Dave@example.com";`, Result{Redirect: []string{"dave@example.com"}}},
+		{`stop; discard;`, Result{Keep: true}},
+		// header tests
+		{`if header :contains "subject" "report" { discard; }`, Result{}},
+		{`if header :contains "Subject" "— March" { discard; }`, Result{}},
+		{`if header :is "subject" "weekly" { discard; }`, Result{Keep: true}},
+		{`if header :matches "subject" "weekly*march" { discard; }`, Result{}},
+		{`if header :matches :comparator "i;octet" "subject" "weekly*" { discard; }`, Result{Keep: true}},
+		{`if header :is "x-missing" "" { discard; }`, Result{Keep: true}},
+		{`if header :contains ["list-id", "x-list"] ["foo", "dev.lists"] { discard; }`, Result{}},
+		// address tests
+		{`if address :is "from" "alice@example.com" { discard; }`, Result{}},
+		{`if address :localpart :is "from" "alice" { discard; }`, Result{}},
+		{`if address :domain :is "to" "lists.example.net" { discard; }`, Result{}},
+		{`if address :domain :is "from" "example.org" { discard; }`, Result{Keep: true}},
+		{`if address :all :comparator "i;octet" :is "from" "alice@example.com" { discard; }`, Result{Keep: true}},
+		// other tests
+		{`if exists ["list-id", "x-spam-score"] { discard; }`, Result{}},
+		{`if exists ["list-id", "x-missing"] { discard; }`, Result{Keep: true}},
+		{`if size :over 100K { discard; }`, Result{}},
+		{`if size :under 100K { discard; }`, Result{Keep: true}},
+		{`if not true { discard; }`, Result{Keep: true}},
+		{`if allof (true, exists "list-id") { discard; }`, Result{}},
+		{`if allof (true, false) { discard; }`, Result{Keep: true}},
+		{`if anyof (false, header :is "x-spam-score" "7.5") { discard; }`, Result{}},
+		// control flow
+		{
+			`require "fileinto";
+			if header :contains "subject" "invoice" {
+				fileinto "Invoices";
+			} elsif exists "list-id" {
+				fileinto "Lists";
+				stop;
+			} else {
+				discard;
+			}
+			fileinto "Never";`,
+			Result{FileInto: []string{"Lists"}},
+		},
+		{
+			`if false { discard; } elsif false { discard; }`,
+			Result{Keep: true},
+		},
+		{
+			`if false { discard; } else { if true { redirect "a@example.com"; keep; } }`,
+			Result{Keep: true, Redirect: []string{"a@example.com"}},
+		},
+		// comments and multi-line strings
+		{
+			"# comment\r\nif header :contains \"subject\" text: # keys\r\nnothing\r\n..report\r\n.\r\n/* block\r\ncomment */ { discard; }",
+			Result{Keep: true},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			script, err := Compile(test.script)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, script.Execute(testMessage))
+		})
+	}
+}
+
+func TestExecute_MaxRedirects(t *testing.T) {
+	src := ""
+	for i := 0; i < MaxRedirects+2; i++ {
+		src += `redirect "user` + strconv.Itoa(i) + `@example.com";`
+	}
+	script, err := Compile(src)
+	assert.Nil(t, err)
+	assert.Len(t, script.Execute(testMessage).Redirect, MaxRedirects)
+}
+
+func TestTrace(t *testing.T) {
+	script, err := Compile(`require "fileinto";
+if header :contains "subject" "invoice" {
+	discard;
+} elsif exists "list-id" {
+	fileinto "Lists";
+	redirect "dave@example.com";
+	stop;
+}
+keep;`)
+	assert.Nil(t, err)
+
+	result, steps := script.Trace(testMessage)
+	assert.Equal(t, Result{FileInto: []string{"Lists"}, Redirect: []string{"dave@example.com"}}, result)
+	assert.Equal(t, []Step{
+		{Line: 4, Command: "elsif"},
+		{Line: 5, Command: "fileinto", Argument: "Lists"},
+		{Line: 6, Command: "redirect", Argument: "dave@example.com"},
+		{Line: 7, Command: "stop"},
+	}, steps)
+
+	script, err = Compile(`if false { discard; } else { keep; }`)
+	assert.Nil(t, err)
+	_, steps = script.Trace(testMessage)
+	assert.Equal(t, []Step{{Line: 1, Command: "else"}, {Line: 1, Command: "keep"}}, steps)
+}
+
+func TestRules(t *testing.T) {
+	script, err := Compile(`if exists "list-id" {
+	if size :over 1M { discard; }
+} elsif exists "x-spam-score" { discard; }
+else { keep; }
+keep;`)
+	assert.Nil(t, err)
+	assert.Equal(t, []Step{
+		{Line: 1, Command: "if"},
+		{Line: 2, Command: "if"},
+		{Line: 3, Command: "elsif"},
+		{Line: 4, Command: "else"},
+	}, script.Rules())
+
+	script, err = Compile("keep;")
+	assert.Nil(t, err)
+	assert.Empty(t, script.Rules())
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		script   string
+		expected string
+	}{
+		{`keep`, "line 1: expected ';' or '{' but found end of script"},
+		{"keep;\n\"string\";", "line 2: expected command but found string"},
+		{`fileinto "Reports";`, `line 1: 'fileinto' requires the "fileinto" extension`},
+		{`require "vacation";`, `line 1: unsupported extension "vacation"`},
+		{"keep;\nrequire \"fileinto\";", "line 2: 'require' must come before other commands"},
+		{`if true { require "fileinto"; }`, "line 1: 'require' must come before other commands"},
+		{`else { keep; }`, "line 1: 'else' must follow 'if' or 'elsif'"},
+		{`if true { keep; } keep; else { keep; }`, "line 1: 'else' must follow 'if' or 'elsif'"},
+		{`if true keep;`, "line 1: 'if' expects a block"},
+		{`if { keep; }`, "line 1: 'if' expects a single test"},
+		{`keep { discard; }`, "line 1: 'keep' can't have a block"},
+		{`vacation "away";`, "line 1: unsupported command 'vacation'"},
+		{`if body :contains "x" { keep; }`, "line 1: unsupported test 'body'"},
+		{`if header :regex "subject" "x" { keep; }`, "line 1: unsupported tag ':regex' for 'header'"},
+		{`if header :is :contains "subject" "x" { keep; }`, "line 1: match type specified more than once"},
+		{`if header :localpart "from" "x" { keep; }`, "line 1: unsupported tag ':localpart' for 'header'"},
+		{`if header :comparator "i;unicode" "subject" "x" { keep; }`, `line 1: unsupported comparator "i;unicode"`},
+		{`if header "subject" { keep; }`, "line 1: 'header' expects a string list of header names and a string list of keys"},
+		{`if header "sub ject" "x" { keep; }`, `line 1: invalid header name "sub ject"`},
+		{`if size 100 { keep; }`, "line 1: 'size' expects :over or :under and a number"},
+		{`if not (true, false) { keep; }`, "line 1: 'not' expects a single test"},
+		{`redirect "not an address";`, `line 1: invalid redirect address "not an address"`},
+		{`redirect ["a@example.com", "b@example.com"];`, "line 1: 'redirect' expects a single string"},
+		{`require "fileinto"; fileinto "";`, "line 1: mailbox must be 1 to 100 bytes"},
+		{`keep "x";`, "line 1: 'keep' doesn't take arguments"},
+		{"if header :is \"subject\" \"x\n{ keep; }", "line 1: unterminated string"},
+		{"/* comment", "line 1: unterminated comment"},
+		{"if header :is \"subject\" text:\nx\n", "line 1: unterminated multi-line string"},
+		{`if header :is "subject" ["a" "b"] { keep; }`, "line 1: expected ',' but found string"},
+		{`keep; }`, "line 1: unexpected '}'"},
+		{`if size :over 99999999999G { keep; }`, "line 1: number too large"},
+		{`keep; @`, "line 1: unexpected character '@'"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			_, err := Compile(test.script)
+			assert.EqualError(t, err, test.expected)
+		})
+	}
+}
+
+func TestCompile_Nesting(t *testing.T) {
+	src := ""
+	for i := 0; i < maxNesting+1; i++ {
+		src += "if true { "
+	}
+	_, err := Compile(src)
+	assert.EqualError(t, err, "line 1: nested too deeply")
+}
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		value    string
+		expected bool
+	}{
+		{"*", "", true},
+		{"a*", "abc", true},
+		{"*c", "abc", true},
+		{"a*c", "abbbc", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"?", "é", true},
+		{"*b*d", "abcd", true},
+		{"*b*d", "abce", false},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+		{`a\?`, "a?", true},
+		{"abc", "abcd", false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, wildcardMatch(test.pattern, test.value))
+		})
+	}
+}
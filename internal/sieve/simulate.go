@@ -0,0 +1,93 @@
+package sieve
+
+import (
+	"context"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/types"
+)
+
+// SimulateInput is the email a script is simulated on, which is either a stored email or a synthetic one
+type SimulateInput struct {
+	MessageID string        `json:"messageID"` // stored email
+	Headers   types.Headers `json:"headers"`   // header fields of a synthetic email, if messageID is empty
+	Size      int64         `json:"size"`      // size of a synthetic email in bytes
+	Script    *string       `json:"script"`    // candidate script, or nil to use the stored script
+}
+
+// SimulateResult is what a script would do to an email
+type SimulateResult struct {
+	Matched   []Step   `json:"matched"` // if, elsif and else branches taken
+	Actions   []Step   `json:"actions"` // actions run, in order
+	Keep      bool     `json:"keep"`
+	FileInto  []string `json:"fileInto"`
+	Redirect  []string `json:"redirect"`
+	Discarded bool     `json:"discarded"`
+}
+
+// Simulate runs a script on an email without applying the result,
+// so that rules can be checked before they change received emails.
+// api.ErrSieveScriptNotFound is returned if there's no stored script, and an *Error if the script is invalid.
+func Simulate(ctx context.Context, client api.GetHeadersAPI, input SimulateInput) (*SimulateResult, error) {
+	if input.MessageID == "" && (len(input.Headers) == 0 || input.Size < 0) {
+		return nil, api.ErrInvalidInput
+	}
+
+	var script *Script
+	var err error
+	if input.Script != nil {
+		script, err = Compile(*input.Script)
+	} else {
+		script, _, err = Load(ctx, client)
+		if err == nil && script == nil {
+			err = api.ErrSieveScriptNotFound
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	headers, size := input.Headers, input.Size
+	if input.MessageID != "" {
+		stored, err := email.GetHeaders(ctx, client, input.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		headers = stored.Headers
+
+		result, err := email.Get(ctx, client, input.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		size = 0
+		if result.Stats != nil {
+			size = result.Stats.RawSize
+		}
+	}
+
+	result, steps := script.Trace(NewMessage(headers, size))
+	simulated := &SimulateResult{
+		Matched:   []Step{},
+		Actions:   []Step{},
+		Keep:      result.Keep,
+		FileInto:  result.FileInto,
+		Redirect:  result.Redirect,
+		Discarded: result.Discarded(),
+	}
+	for _, step := range steps {
+		switch step.Command {
+		case "if", "elsif", "else":
+			simulated.Matched = append(simulated.Matched, step)
+		default:
+			simulated.Actions = append(simulated.Actions, step)
+		}
+	}
+	if simulated.FileInto == nil {
+		simulated.FileInto = []string{}
+	}
+	if simulated.Redirect == nil {
+		simulated.Redirect = []string{}
+	}
+	return simulated, nil
+}
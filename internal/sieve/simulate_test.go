@@ -0,0 +1,61 @@
+package sieve
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/harryzcy/mailbox/internal/api"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func (m *mockStoreAPI) GetObject(_ context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return nil, errors.New("not stored")
+}
+
+func TestSimulate(t *testing.T) {
+	client := &mockStoreAPI{items: make(map[string]map[string]types.AttributeValue)}
+	ctx := context.TODO()
+	headers := mailboxTypes.Headers{
+		{Name: "From", Value: "alice@example.com"},
+		{Name: "Subject", Value: "Invoice 42"},
+	}
+
+	_, err := Simulate(ctx, client, SimulateInput{Headers: headers})
+	assert.Equal(t, api.ErrSieveScriptNotFound, err)
+	_, err = Simulate(ctx, client, SimulateInput{})
+	assert.Equal(t, api.ErrInvalidInput, err)
+
+	invalid := "discard"
+	_, err = Simulate(ctx, client, SimulateInput{Headers: headers, Script: &invalid})
+	var sieveErr *Error
+	assert.True(t, errors.As(err, &sieveErr))
+
+	_, err = Put(ctx, client, `if header :contains "subject" "invoice" { discard; }`)
+	assert.Nil(t, err)
+	result, err := Simulate(ctx, client, SimulateInput{Headers: headers, Size: 100})
+	assert.Nil(t, err)
+	assert.Equal(t, &SimulateResult{
+		Matched:   []Step{{Line: 1, Command: "if"}},
+		Actions:   []Step{{Line: 1, Command: "discard"}},
+		FileInto:  []string{},
+		Redirect:  []string{},
+		Discarded: true,
+	}, result)
+
+	// a candidate script is simulated instead of the stored one
+	candidate := `require "fileinto"; if address :domain :is "from" "example.com" { fileinto "Example"; keep; }`
+	result, err = Simulate(ctx, client, SimulateInput{Headers: headers, Script: &candidate})
+	assert.Nil(t, err)
+	assert.Equal(t, &SimulateResult{
+		Matched:  []Step{{Line: 1, Command: "if"}},
+		Actions:  []Step{{Line: 1, Command: "fileinto", Argument: "Example"}, {Line: 1, Command: "keep"}},
+		Keep:     true,
+		FileInto: []string{"Example"},
+		Redirect: []string{},
+	}, result)
+	assert.Len(t, client.items, 1) // no side effects
+}
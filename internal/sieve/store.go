@@ -0,0 +1,209 @@
+package sieve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// itemID is the MessageID of the item storing the script in the email table
+const itemID = "sieve#script"
+
+var getCurrentTime = func() time.Time {
+	return time.Now().UTC()
+}
+
+// StoredScript is the script applied to received emails
+type StoredScript struct {
+	Script      string      `json:"script"`
+	TimeUpdated string      `json:"timeUpdated"`
+	Rules       []RuleStats `json:"rules"`
+}
+
+// RuleStats is how often a rule, i.e. an if, elsif or else branch, fired since the script is stored
+type RuleStats struct {
+	Line      int    `json:"line"`
+	Command   string `json:"command"`
+	Hits      int64  `json:"hits"`
+	LastFired string `json:"lastFired,omitempty"`
+}
+
+// Get returns the stored script, or api.ErrNotFound if there's none
+func Get(ctx context.Context, client api.GetItemAPI) (*StoredScript, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: itemID},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, api.ErrNotFound
+	}
+
+	stored := &StoredScript{Rules: []RuleStats{}}
+	if v, ok := resp.Item["Script"].(*types.AttributeValueMemberS); ok {
+		stored.Script = v.Value
+	}
+	if v, ok := resp.Item["TimeUpdated"].(*types.AttributeValueMemberS); ok {
+		stored.TimeUpdated = v.Value
+	}
+
+	script, err := Compile(stored.Script)
+	if err != nil {
+		// only valid scripts are stored, but report it instead of failing
+		fmt.Printf("stored sieve script is invalid, %v\n", err)
+		return stored, nil
+	}
+	hits, _ := resp.Item["Hits"].(*types.AttributeValueMemberM)
+	lastFired, _ := resp.Item["LastFired"].(*types.AttributeValueMemberM)
+	for _, rule := range script.Rules() {
+		stats := RuleStats{Line: rule.Line, Command: rule.Command}
+		key := strconv.Itoa(rule.Line)
+		if hits != nil {
+			if v, ok := hits.Value[key].(*types.AttributeValueMemberN); ok {
+				stats.Hits, _ = strconv.ParseInt(v.Value, 10, 64)
+			}
+		}
+		if lastFired != nil {
+			if v, ok := lastFired.Value[key].(*types.AttributeValueMemberS); ok {
+				stats.LastFired = v.Value
+			}
+		}
+		stored.Rules = append(stored.Rules, stats)
+	}
+	return stored, nil
+}
+
+// Load returns the compiled script and the time it's stored, or nil if there's none
+func Load(ctx context.Context, client api.GetItemAPI) (*Script, string, error) {
+	stored, err := Get(ctx, client)
+	if err != nil {
+		if err == api.ErrNotFound {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	script, err := Compile(stored.Script)
+	if err != nil {
+		return nil, "", err
+	}
+	return script, stored.TimeUpdated, nil
+}
+
+// Put validates and stores a script, replacing the previous one and resetting the rule stats,
+// since rules are identified by their lines.
+// An *Error is returned if the script is invalid.
+func Put(ctx context.Context, client api.PutItemAPI, script string) (*StoredScript, error) {
+	compiled, err := Compile(script)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &StoredScript{
+		Script:      script,
+		TimeUpdated: getCurrentTime().Format(time.RFC3339Nano),
+		Rules:       []RuleStats{},
+	}
+	for _, rule := range compiled.Rules() {
+		stored.Rules = append(stored.Rules, RuleStats{Line: rule.Line, Command: rule.Command})
+	}
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item: map[string]types.AttributeValue{
+			"MessageID":   &types.AttributeValueMemberS{Value: itemID},
+			"Script":      &types.AttributeValueMemberS{Value: stored.Script},
+			"TimeUpdated": &types.AttributeValueMemberS{Value: stored.TimeUpdated},
+			"Hits":        &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}},
+			"LastFired":   &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	return stored, nil
+}
+
+// RecordHits counts the rules on lines as fired, unless the script stored at timeUpdated is replaced
+func RecordHits(ctx context.Context, client api.UpdateItemAPI, timeUpdated string, lines []int) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	sort.Ints(lines)
+
+	var updates []string
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{
+		":zero":        &types.AttributeValueMemberN{Value: "0"},
+		":one":         &types.AttributeValueMemberN{Value: "1"},
+		":now":         &types.AttributeValueMemberS{Value: getCurrentTime().Format(time.RFC3339)},
+		":timeUpdated": &types.AttributeValueMemberS{Value: timeUpdated},
+	}
+	for i, line := range lines {
+		if i > 0 && line == lines[i-1] {
+			continue // nested rules on the same line
+		}
+		name := "#line" + strconv.Itoa(line)
+		names[name] = strconv.Itoa(line)
+		updates = append(updates,
+			fmt.Sprintf("Hits.%s = if_not_exists(Hits.%s, :zero) + :one", name, name),
+			fmt.Sprintf("LastFired.%s = :now", name),
+		)
+	}
+
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: itemID},
+		},
+		UpdateExpression:          aws.String("SET " + strings.Join(updates, ", ")),
+		ConditionExpression:       aws.String("TimeUpdated = :timeUpdated"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			return nil // hits of a replaced script
+		}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the stored script, so that received emails are no longer filtered
+func Delete(ctx context.Context, client api.DeleteSieveScriptAPI) error {
+	_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(env.TableName),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: itemID},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
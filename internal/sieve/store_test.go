@@ -0,0 +1,126 @@
+package sieve
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockStoreAPI struct {
+	items     map[string]map[string]types.AttributeValue
+	updates   []*dynamodb.UpdateItemInput
+	updateErr error
+}
+
+func (m *mockStoreAPI) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	messageID := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: m.items[messageID]}, nil
+}
+
+func (m *mockStoreAPI) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	messageID := params.Item["MessageID"].(*types.AttributeValueMemberS).Value
+	m.items[messageID] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockStoreAPI) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	messageID := params.Key["MessageID"].(*types.AttributeValueMemberS).Value
+	delete(m.items, messageID)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (m *mockStoreAPI) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.updates = append(m.updates, params)
+	return &dynamodb.UpdateItemOutput{}, m.updateErr
+}
+
+func TestStore(t *testing.T) {
+	env.TableName = "table-for-sieve"
+	getCurrentTime = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { getCurrentTime = func() time.Time { return time.Now().UTC() } }()
+
+	client := &mockStoreAPI{items: make(map[string]map[string]types.AttributeValue)}
+	ctx := context.TODO()
+
+	_, err := Get(ctx, client)
+	assert.Equal(t, api.ErrNotFound, err)
+	script, timeUpdated, err := Load(ctx, client)
+	assert.Nil(t, err)
+	assert.Nil(t, script)
+	assert.Equal(t, "", timeUpdated)
+
+	_, err = Put(ctx, client, "keep")
+	var sieveErr *Error
+	assert.True(t, errors.As(err, &sieveErr))
+	assert.Empty(t, client.items)
+
+	stored, err := Put(ctx, client, "if true {\n\tdiscard;\n} else { keep; }")
+	assert.Nil(t, err)
+	assert.Equal(t, &StoredScript{
+		Script:      "if true {\n\tdiscard;\n} else { keep; }",
+		TimeUpdated: "2024-05-01T12:00:00Z",
+		Rules:       []RuleStats{{Line: 1, Command: "if"}, {Line: 3, Command: "else"}},
+	}, stored)
+
+	got, err := Get(ctx, client)
+	assert.Nil(t, err)
+	assert.Equal(t, stored, got)
+	script, timeUpdated, err = Load(ctx, client)
+	assert.Nil(t, err)
+	assert.Equal(t, "2024-05-01T12:00:00Z", timeUpdated)
+	assert.True(t, script.Execute(Message{}).Discarded())
+
+	// hits recorded by receive
+	client.items[itemID]["Hits"] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		"1": &types.AttributeValueMemberN{Value: "3"},
+	}}
+	client.items[itemID]["LastFired"] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		"1": &types.AttributeValueMemberS{Value: "2024-05-02T08:00:00Z"},
+	}}
+	got, err = Get(ctx, client)
+	assert.Nil(t, err)
+	assert.Equal(t, []RuleStats{
+		{Line: 1, Command: "if", Hits: 3, LastFired: "2024-05-02T08:00:00Z"},
+		{Line: 3, Command: "else"},
+	}, got.Rules)
+
+	assert.Nil(t, Delete(ctx, client))
+	_, err = Get(ctx, client)
+	assert.Equal(t, api.ErrNotFound, err)
+}
+
+func TestRecordHits(t *testing.T) {
+	env.TableName = "table-for-sieve"
+	getCurrentTime = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { getCurrentTime = func() time.Time { return time.Now().UTC() } }()
+
+	client := &mockStoreAPI{}
+	ctx := context.TODO()
+
+	assert.Nil(t, RecordHits(ctx, client, "2024-05-01T11:00:00Z", nil))
+	assert.Empty(t, client.updates)
+
+	assert.Nil(t, RecordHits(ctx, client, "2024-05-01T11:00:00Z", []int{7, 2, 7}))
+	assert.Len(t, client.updates, 1)
+	params := client.updates[0]
+	assert.Equal(t, "SET Hits.#line2 = if_not_exists(Hits.#line2, :zero) + :one, LastFired.#line2 = :now, "+
+		"Hits.#line7 = if_not_exists(Hits.#line7, :zero) + :one, LastFired.#line7 = :now", *params.UpdateExpression)
+	assert.Equal(t, "TimeUpdated = :timeUpdated", *params.ConditionExpression)
+	assert.Equal(t, map[string]string{"#line2": "2", "#line7": "7"}, params.ExpressionAttributeNames)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "2024-05-01T11:00:00Z"}, params.ExpressionAttributeValues[":timeUpdated"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "2024-05-01T12:00:00Z"}, params.ExpressionAttributeValues[":now"])
+
+	// the script is replaced after the email is filtered
+	client.updateErr = &types.ConditionalCheckFailedException{}
+	assert.Nil(t, RecordHits(ctx, client, "2024-05-01T11:00:00Z", []int{2}))
+
+	client.updateErr = &types.ProvisionedThroughputExceededException{}
+	assert.Equal(t, api.ErrTooManyRequests, RecordHits(ctx, client, "2024-05-01T11:00:00Z", []int{2}))
+}
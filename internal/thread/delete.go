@@ -24,6 +24,15 @@ func Delete(ctx context.Context, client api.DeleteThreadAPI, messageID string) e
 	if thread.TrashedTime != nil {
 		return &api.NotTrashedError{Type: "thread"}
 	}
+	locations := make([]storage.Location, len(thread.EmailIDs))
+	for i, emailID := range thread.EmailIDs {
+		if locations[i], err = email.RawLocation(ctx, client, emailID); err != nil {
+			return err
+		}
+		if err := email.CheckRetention(ctx, client, locations[i]); err != nil {
+			return err
+		}
+	}
 
 	transactWriteItems := make([]types.TransactWriteItem, len(thread.EmailIDs)+1)
 	// delete thread
@@ -65,12 +74,10 @@ func Delete(ctx context.Context, client api.DeleteThreadAPI, messageID string) e
 		return err
 	}
 
-	err = storage.S3.DeleteEmail(ctx, client, messageID)
-	if err != nil {
-		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
-			return api.ErrTooManyRequests
+	for _, location := range locations {
+		if err := storage.S3.DeleteEmail(ctx, client, location); err != nil {
+			return err
 		}
-		return err
 	}
 
 	fmt.Println("delete thread finished successfully")
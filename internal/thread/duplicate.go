@@ -0,0 +1,72 @@
+package thread
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// maxDuplicateLinks is the max number of existing emails updated when linking duplicates,
+// limited by the number of items in a single transaction
+const maxDuplicateLinks = 100
+
+// FindDuplicates returns the MessageIDs of stored emails with the same original Message-ID,
+// e.g. resent emails or copies received through mailing lists.
+func FindDuplicates(ctx context.Context, client api.QueryAPI, originalMessageID, messageID string) ([]string, error) {
+	if originalMessageID == "" {
+		return nil, nil
+	}
+
+	messageIDs, err := email.FindByOriginalMessageID(ctx, client, originalMessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	duplicates := make([]string, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		if id != messageID {
+			duplicates = append(duplicates, id)
+		}
+	}
+	return duplicates, nil
+}
+
+// LinkDuplicates adds messageID to the DuplicateIDs attribute of each duplicate email,
+// so that the link is visible from both sides.
+func LinkDuplicates(ctx context.Context, client api.TransactWriteItemsAPI, messageID string, duplicates []string) error {
+	if len(duplicates) == 0 {
+		return nil
+	}
+	if len(duplicates) > maxDuplicateLinks {
+		fmt.Printf("too many duplicates (%d), only linking %d of them\n", len(duplicates), maxDuplicateLinks)
+		duplicates = duplicates[:maxDuplicateLinks]
+	}
+
+	transactItems := make([]dynamodbTypes.TransactWriteItem, len(duplicates))
+	for i, duplicate := range duplicates {
+		transactItems[i] = dynamodbTypes.TransactWriteItem{
+			Update: &dynamodbTypes.Update{
+				TableName: aws.String(env.TableName),
+				Key: map[string]dynamodbTypes.AttributeValue{
+					"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: duplicate},
+				},
+				UpdateExpression:    aws.String("ADD DuplicateIDs :messageID"),
+				ConditionExpression: aws.String("attribute_exists(MessageID)"),
+				ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+					":messageID": &dynamodbTypes.AttributeValueMemberSS{Value: []string{messageID}},
+				},
+			},
+		}
+	}
+
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	return err
+}
@@ -0,0 +1,136 @@
+package thread
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/mockutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	env.TableName = "table-for-find-duplicates"
+	tests := []struct {
+		client            func(t *testing.T) api.QueryAPI
+		originalMessageID string
+		messageID         string
+		expected          []string
+		expectedErr       error
+	}{
+		{
+			client: func(t *testing.T) api.QueryAPI {
+				return mockutil.MockQueryAPI(func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+					t.Helper()
+					assert.Equal(t, "<abc@example.com>", params.ExpressionAttributeValues[":originalMessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+					return &dynamodb.QueryOutput{
+						Items: []map[string]dynamodbTypes.AttributeValue{
+							{"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "id-1"}},
+							{"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "id-2"}},
+						},
+					}, nil
+				})
+			},
+			originalMessageID: "<abc@example.com>",
+			messageID:         "id-2",
+			expected:          []string{"id-1"},
+		},
+		{
+			client: func(_ *testing.T) api.QueryAPI {
+				return nil
+			},
+			originalMessageID: "",
+			messageID:         "id-1",
+		},
+		{
+			client: func(_ *testing.T) api.QueryAPI {
+				return mockutil.MockQueryAPI(func(_ context.Context, _ *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+					return nil, errors.New("error")
+				})
+			},
+			originalMessageID: "<abc@example.com>",
+			expectedErr:       errors.New("error"),
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			actual, err := FindDuplicates(context.TODO(), test.client(t), test.originalMessageID, test.messageID)
+			assert.Equal(t, test.expected, actual)
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+}
+
+func TestLinkDuplicates(t *testing.T) {
+	env.TableName = "table-for-link-duplicates"
+	called := false
+	client := mockutil.MockTransactWriteItemAPI(func(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+		called = true
+		assert.Len(t, params.TransactItems, 2)
+		for i, id := range []string{"id-1", "id-2"} {
+			update := params.TransactItems[i].Update
+			assert.Equal(t, env.TableName, *update.TableName)
+			assert.Equal(t, id, update.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
+			assert.Equal(t, "ADD DuplicateIDs :messageID", *update.UpdateExpression)
+			assert.Equal(t, []string{"id-3"}, update.ExpressionAttributeValues[":messageID"].(*dynamodbTypes.AttributeValueMemberSS).Value)
+		}
+		return &dynamodb.TransactWriteItemsOutput{}, nil
+	})
+
+	err := LinkDuplicates(context.TODO(), client, "id-3", []string{"id-1", "id-2"})
+	assert.Nil(t, err)
+	assert.True(t, called)
+
+	err = LinkDuplicates(context.TODO(), nil, "id-3", nil)
+	assert.Nil(t, err)
+}
+
+func TestStoreEmail_LinkDuplicates(t *testing.T) {
+	tests := []struct {
+		putErr         error
+		expectedLinked bool
+	}{
+		{putErr: nil, expectedLinked: true},
+		// an email that is already stored isn't linked again
+		{putErr: &dynamodbTypes.ConditionalCheckFailedException{}, expectedLinked: false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			stored, linked := false, false
+			client := clients.Fake{
+				MockQuery: func(_ context.Context, _ *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+					return &dynamodb.QueryOutput{Items: []map[string]dynamodbTypes.AttributeValue{
+						{"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "id-1"}},
+					}}, nil
+				},
+				MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+					assert.Equal(t, []string{"id-1"}, params.Item["DuplicateIDs"].(*dynamodbTypes.AttributeValueMemberSS).Value)
+					assert.False(t, linked, "duplicates are linked before the email is stored")
+					stored = true
+					return &dynamodb.PutItemOutput{}, test.putErr
+				},
+				MockTransactWriteItems: func(_ context.Context, _ *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					linked = true
+					return &dynamodb.TransactWriteItemsOutput{}, nil
+				},
+			}
+
+			StoreEmail(context.TODO(), client, &StoreEmailInput{
+				OriginalMessageID: "<original@example.com>",
+				Item: map[string]dynamodbTypes.AttributeValue{
+					"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "id-2"},
+				},
+			})
+			assert.True(t, stored)
+			assert.Equal(t, test.expectedLinked, linked)
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package thread
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+const (
+	DefaultPageSize = 50
+
+	// maxBatchGetKeys is the maximum number of keys in a BatchGetItem request
+	maxBatchGetKeys = 100
+)
+
+// ListInput represents the input of List
+type ListInput struct {
+	ShowTrash  string        `json:"showTrash"` // 'include', 'exclude' or 'only' (default is 'exclude')
+	PageSize   int           `json:"pageSize"`  // default is 50
+	NextCursor *email.Cursor `json:"nextCursor"`
+}
+
+// ListItem represents a thread in the list
+type ListItem struct {
+	MessageID   string   `json:"messageID"`
+	Subject     string   `json:"subject"`
+	EmailIDs    []string `json:"emailIDs"`
+	DraftID     string   `json:"draftID,omitempty"`
+	TimeUpdated string   `json:"timeUpdated"`
+	TrashedTime *string  `json:"trashedTime,omitempty"`
+
+	Unread      bool `json:"unread"`      // whether any email in the thread is unread
+	UnreadCount int  `json:"unreadCount"` // number of unread emails in the thread
+}
+
+// ListResult represents the result of List
+type ListResult struct {
+	Count      int           `json:"count"`
+	Items      []ListItem    `json:"items"`
+	NextCursor *email.Cursor `json:"nextCursor"`
+	HasMore    bool          `json:"hasMore"`
+}
+
+// List lists threads by the time of their latest activity, most recent first
+func List(ctx context.Context, client api.ListThreadsAPI, input ListInput) (*ListResult, error) {
+	if input.ShowTrash == "" {
+		input.ShowTrash = email.ShowTrashExclude
+	}
+	if input.ShowTrash != email.ShowTrashExclude && input.ShowTrash != email.ShowTrashInclude && input.ShowTrash != email.ShowTrashOnly {
+		return nil, api.ErrInvalidInput
+	}
+	if input.PageSize <= 0 {
+		input.PageSize = DefaultPageSize
+	}
+
+	queryInput := &dynamodb.QueryInput{
+		TableName:              aws.String(env.TableName),
+		IndexName:              aws.String(env.GsiThreadIndexName),
+		KeyConditionExpression: aws.String("ItemType = :v_type"),
+		ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+			":v_type": &dynamodbTypes.AttributeValueMemberS{Value: email.EmailTypeThread},
+		},
+		Limit:            aws.Int32(int32(input.PageSize)),
+		ScanIndexForward: aws.Bool(false), // latest activity first
+	}
+	if input.NextCursor != nil {
+		if input.NextCursor.QueryInfo.Type != "" && input.NextCursor.QueryInfo.Type != email.EmailTypeThread {
+			return nil, api.ErrQueryNotMatch
+		}
+		if len(input.NextCursor.LastEvaluatedKey) > 0 {
+			queryInput.ExclusiveStartKey = input.NextCursor.LastEvaluatedKey
+		}
+	}
+	if input.ShowTrash == email.ShowTrashExclude {
+		queryInput.FilterExpression = aws.String("attribute_not_exists(TrashedTime)")
+	} else if input.ShowTrash == email.ShowTrashOnly {
+		queryInput.FilterExpression = aws.String("attribute_exists(TrashedTime)")
+	}
+
+	resp, err := client.Query(ctx, queryInput)
+	if err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+
+	items := []ListItem{}
+	if err = attributevalue.UnmarshalListOfMaps(resp.Items, &items); err != nil {
+		fmt.Printf("unmarshal failed: %v\n", err)
+		return nil, err
+	}
+
+	if err = setUnread(ctx, client, items); err != nil {
+		if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+
+	result := &ListResult{
+		Count:   len(items),
+		Items:   items,
+		HasMore: len(resp.LastEvaluatedKey) > 0,
+	}
+	if result.HasMore {
+		result.NextCursor = &email.Cursor{
+			QueryInfo:        email.QueryInfo{Type: email.EmailTypeThread, Order: "desc"},
+			LastEvaluatedKey: resp.LastEvaluatedKey,
+		}
+	}
+	return result, nil
+}
+
+// setUnread sets the unread flags of the threads, from the Unread attributes of their emails
+func setUnread(ctx context.Context, client api.BatchGetItemAPI, items []ListItem) error {
+	threadOf := make(map[string]int) // email ID to the index of its thread
+	keys := []map[string]dynamodbTypes.AttributeValue{}
+	for i, item := range items {
+		for _, emailID := range item.EmailIDs {
+			if _, ok := threadOf[emailID]; ok {
+				continue
+			}
+			threadOf[emailID] = i
+			keys = append(keys, map[string]dynamodbTypes.AttributeValue{
+				"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: emailID},
+			})
+		}
+	}
+
+	for len(keys) > 0 {
+		n := min(len(keys), maxBatchGetKeys)
+		resp, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]dynamodbTypes.KeysAndAttributes{
+				env.TableName: {
+					Keys:                 keys[:n],
+					ProjectionExpression: aws.String("MessageID, Unread"),
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		keys = keys[n:]
+		if unprocessed, ok := resp.UnprocessedKeys[env.TableName]; ok {
+			keys = append(keys, unprocessed.Keys...)
+		}
+
+		for _, emailItem := range resp.Responses[env.TableName] {
+			if _, unread := emailItem["Unread"]; !unread {
+				continue
+			}
+			messageID, ok := emailItem["MessageID"].(*dynamodbTypes.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			i := threadOf[messageID.Value]
+			items[i].Unread = true
+			items[i].UnreadCount++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package thread
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/email"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/mockutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func threadItem(id, timeUpdated string, emailIDs ...string) map[string]dynamodbTypes.AttributeValue {
+	ids := make([]dynamodbTypes.AttributeValue, len(emailIDs))
+	for i, emailID := range emailIDs {
+		ids[i] = &dynamodbTypes.AttributeValueMemberS{Value: emailID}
+	}
+	return map[string]dynamodbTypes.AttributeValue{
+		"MessageID":   &dynamodbTypes.AttributeValueMemberS{Value: id},
+		"ItemType":    &dynamodbTypes.AttributeValueMemberS{Value: "thread"},
+		"Subject":     &dynamodbTypes.AttributeValueMemberS{Value: "subject " + id},
+		"EmailIDs":    &dynamodbTypes.AttributeValueMemberL{Value: ids},
+		"TimeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: timeUpdated},
+	}
+}
+
+func TestList(t *testing.T) {
+	env.TableName = "table-for-list-threads"
+	env.GsiThreadIndexName = "ThreadActivityIndex"
+
+	lastEvaluatedKey := map[string]dynamodbTypes.AttributeValue{
+		"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: "thread-2"},
+	}
+	tests := []struct {
+		input          ListInput
+		queryOutput    *dynamodb.QueryOutput
+		unreadIDs      []string
+		expectedFilter *string
+		expected       *ListResult
+		expectedErr    error
+	}{
+		{
+			input: ListInput{},
+			queryOutput: &dynamodb.QueryOutput{
+				Items: []map[string]dynamodbTypes.AttributeValue{
+					threadItem("thread-1", "2023-05-02T00:00:00Z", "email-1", "email-2", "email-3"),
+					threadItem("thread-2", "2023-05-01T00:00:00Z", "email-4"),
+				},
+				LastEvaluatedKey: lastEvaluatedKey,
+			},
+			unreadIDs:      []string{"email-2", "email-3"},
+			expectedFilter: aws.String("attribute_not_exists(TrashedTime)"),
+			expected: &ListResult{
+				Count: 2,
+				Items: []ListItem{
+					{
+						MessageID: "thread-1", Subject: "subject thread-1", TimeUpdated: "2023-05-02T00:00:00Z",
+						EmailIDs: []string{"email-1", "email-2", "email-3"}, Unread: true, UnreadCount: 2,
+					},
+					{
+						MessageID: "thread-2", Subject: "subject thread-2", TimeUpdated: "2023-05-01T00:00:00Z",
+						EmailIDs: []string{"email-4"},
+					},
+				},
+				NextCursor: &email.Cursor{
+					QueryInfo:        email.QueryInfo{Type: "thread", Order: "desc"},
+					LastEvaluatedKey: lastEvaluatedKey,
+				},
+				HasMore: true,
+			},
+		},
+		{
+			input: ListInput{ShowTrash: email.ShowTrashInclude, PageSize: 10},
+			queryOutput: &dynamodb.QueryOutput{
+				Items: []map[string]dynamodbTypes.AttributeValue{},
+			},
+			expected: &ListResult{Items: []ListItem{}},
+		},
+		{
+			input:       ListInput{ShowTrash: "invalid"},
+			expectedErr: api.ErrInvalidInput,
+		},
+		{
+			input: ListInput{NextCursor: &email.Cursor{
+				QueryInfo: email.QueryInfo{Type: "inbox"},
+			}},
+			expectedErr: api.ErrQueryNotMatch,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := mockutil.MockListThreadsAPI{
+				MockQuery: func(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+					assert.Equal(t, env.GsiThreadIndexName, *params.IndexName)
+					assert.Equal(t, "ItemType = :v_type", *params.KeyConditionExpression)
+					assert.False(t, *params.ScanIndexForward)
+					assert.Equal(t, test.expectedFilter, params.FilterExpression)
+					return test.queryOutput, nil
+				},
+				MockBatchGetItem: func(_ context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+					items := []map[string]dynamodbTypes.AttributeValue{}
+					for _, key := range params.RequestItems[env.TableName].Keys {
+						item := map[string]dynamodbTypes.AttributeValue{"MessageID": key["MessageID"]}
+						for _, id := range test.unreadIDs {
+							if key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value == id {
+								item["Unread"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
+							}
+						}
+						items = append(items, item)
+					}
+					return &dynamodb.BatchGetItemOutput{
+						Responses: map[string][]map[string]dynamodbTypes.AttributeValue{env.TableName: items},
+					}, nil
+				},
+			}
+
+			result, err := List(context.TODO(), client, test.input)
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
@@ -13,8 +13,10 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/counter"
 	"github.com/harryzcy/mailbox/internal/email"
 	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/ctxutil"
 	"github.com/harryzcy/mailbox/internal/util/format"
 	"github.com/harryzcy/mailbox/internal/util/idutil"
 )
@@ -139,6 +141,19 @@ type DetermineThreadOutput struct {
 	CreatingTime    string // If ShouldCreate is true, the time the first email is received
 }
 
+// parentMessageID returns the messageID of the email being replied to, which is the first messageID in
+// the In-Reply-To header, or the last one in the References header if In-Reply-To is empty.
+// Headers may be folded, so messageIDs are separated by any whitespace.
+func parentMessageID(inReplyTo, references string) string {
+	if ids := strings.Fields(inReplyTo); len(ids) > 0 {
+		return ids[0]
+	}
+	if ids := strings.Fields(references); len(ids) > 0 {
+		return ids[len(ids)-1]
+	}
+	return ""
+}
+
 // DetermineThread determines which thread an incoming email belongs to.
 // If a thread already exists, the ThreadID is returned and Exists is true.
 // If a thread does not exist and a new thread should be created, the ThreadID is randomly generated and ShouldCreate is true.
@@ -148,14 +163,7 @@ type DetermineThreadOutput struct {
 //gocyclo:ignore
 func DetermineThread(ctx context.Context, client api.QueryAndGetItemAPI, input *DetermineThreadInput) (*DetermineThreadOutput, error) {
 	fmt.Println("Determining thread...")
-	originalMessageID := ""
-	if len(input.InReplyTo) > 0 {
-		originalMessageID = input.InReplyTo
-	} else if len(input.References) > 0 {
-		references := strings.Split(input.References, " ")
-		originalMessageID = references[len(references)-1] // The last messageID in the References header
-	}
-
+	originalMessageID := parentMessageID(input.InReplyTo, input.References)
 	if originalMessageID == "" {
 		return &DetermineThreadOutput{}, nil
 	}
@@ -186,34 +194,22 @@ func DetermineThread(ctx context.Context, client api.QueryAndGetItemAPI, input *
 	if previousEmail == nil {
 		// If the messageID does not corresponded to a sent email, check if it's a received email
 		fmt.Println("checking original messageID")
-		var resp *dynamodb.QueryOutput
-		resp, err = client.Query(ctx, &dynamodb.QueryInput{
-			TableName:              aws.String(env.TableName),
-			IndexName:              aws.String(env.GsiOriginalIndexName),
-			KeyConditionExpression: aws.String("OriginalMessageID = :originalMessageID"),
-			ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
-				":originalMessageID": &dynamodbTypes.AttributeValueMemberS{Value: originalMessageID},
-			},
-		})
+		var messageIDs []string
+		messageIDs, err = email.FindByOriginalMessageID(ctx, client, originalMessageID)
 		if err != nil {
-			if apiErr := new(dynamodbTypes.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
-				return nil, api.ErrTooManyRequests
-			}
 			return nil, err
 		}
-		// TODO: handle the case where len(resp.Items) > 1
-		if len(resp.Items) == 0 {
+		if len(messageIDs) == 0 {
 			return &DetermineThreadOutput{}, nil
 		}
 
-		searchMessageID := resp.Items[0]["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value
-		previousEmail, err = email.Get(ctx, client, searchMessageID)
+		previousEmail, err = selectPreviousEmail(ctx, client, messageIDs)
 		if err != nil {
-			if errors.Is(err, api.ErrNotFound) {
-				return &DetermineThreadOutput{}, nil
-			}
 			return nil, err
 		}
+		if previousEmail == nil {
+			return &DetermineThreadOutput{}, nil
+		}
 	}
 
 	if previousEmail.ThreadID == "" {
@@ -255,6 +251,29 @@ func DetermineThread(ctx context.Context, client api.QueryAndGetItemAPI, input *
 	}, nil
 }
 
+// selectPreviousEmail returns the email being replied to among emails sharing the same original Message-ID.
+// Emails that are already part of a thread are preferred, so that duplicates don't split the conversation.
+// It returns nil if none of the emails exists.
+func selectPreviousEmail(ctx context.Context, client api.GetItemAPI, messageIDs []string) (*email.GetResult, error) {
+	var selected *email.GetResult
+	for _, messageID := range messageIDs {
+		result, err := email.Get(ctx, client, messageID)
+		if err != nil {
+			if errors.Is(err, api.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if result.ThreadID != "" {
+			return result, nil
+		}
+		if selected == nil {
+			selected = result
+		}
+	}
+	return selected, nil
+}
+
 type StoreEmailWithExistingThreadInput struct {
 	ThreadID          string
 	Email             map[string]dynamodbTypes.AttributeValue
@@ -265,44 +284,45 @@ type StoreEmailWithExistingThreadInput struct {
 // StoreEmailWithExistingThread stores the email and updates the thread.
 func StoreEmailWithExistingThread(ctx context.Context, client api.TransactWriteItemsAPI, input *StoreEmailWithExistingThreadInput) error {
 	input.Email["IsThreadLatest"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
-	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-		TransactItems: []dynamodbTypes.TransactWriteItem{
-			{
-				// Store new email
-				Put: &dynamodbTypes.Put{
-					TableName: aws.String(env.TableName),
-					Item:      input.Email,
+	items := []dynamodbTypes.TransactWriteItem{
+		{
+			// Store new email
+			Put: newEmailPut(input.Email),
+		},
+		{
+			// Update the thread
+			Update: &dynamodbTypes.Update{
+				TableName: aws.String(env.TableName),
+				Key: map[string]dynamodbTypes.AttributeValue{
+					"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: input.ThreadID},
 				},
-			},
-			{
-				// Update the thread
-				Update: &dynamodbTypes.Update{
-					TableName: aws.String(env.TableName),
-					Key: map[string]dynamodbTypes.AttributeValue{
-						"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: input.ThreadID},
-					},
-					UpdateExpression: aws.String("SET #emails = list_append(#emails, :emails), #timeUpdated = :timeUpdated"),
-					ExpressionAttributeNames: map[string]string{
-						"#emails":      "EmailIDs",
-						"#timeUpdated": "TimeUpdated",
-					},
-					ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
-						":emails":      &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{input.Email["MessageID"]}},
-						":timeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: input.TimeReceived},
-					},
+				// ItemType is set for threads created before threads are listed by activity
+				UpdateExpression: aws.String("SET #emails = list_append(#emails, :emails), #timeUpdated = :timeUpdated, #itemType = :itemType"),
+				ExpressionAttributeNames: map[string]string{
+					"#emails":      "EmailIDs",
+					"#timeUpdated": "TimeUpdated",
+					"#itemType":    "ItemType",
+				},
+				ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+					":emails":      &dynamodbTypes.AttributeValueMemberL{Value: []dynamodbTypes.AttributeValue{input.Email["MessageID"]}},
+					":timeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: input.TimeReceived},
+					":itemType":    &dynamodbTypes.AttributeValueMemberS{Value: email.EmailTypeThread},
 				},
 			},
-			{
-				// Remove IsThreadLatest from the previous email
-				Update: &dynamodbTypes.Update{
-					TableName: aws.String(env.TableName),
-					Key: map[string]dynamodbTypes.AttributeValue{
-						"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: input.PreviousMessageID},
-					},
-					UpdateExpression: aws.String("REMOVE IsThreadLatest"),
+		},
+		{
+			// Remove IsThreadLatest from the previous email
+			Update: &dynamodbTypes.Update{
+				TableName: aws.String(env.TableName),
+				Key: map[string]dynamodbTypes.AttributeValue{
+					"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: input.PreviousMessageID},
 				},
+				UpdateExpression: aws.String("REMOVE IsThreadLatest"),
 			},
 		},
+	}
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append(items, counterUpdates(input.Email)...),
 	})
 	if err != nil {
 		return err
@@ -342,42 +362,41 @@ func StoreEmailWithNewThread(ctx context.Context, client api.TransactWriteItemsA
 			},
 		},
 		"TimeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: input.TimeReceived},
+		"ItemType":    &dynamodbTypes.AttributeValueMemberS{Value: email.EmailTypeThread}, // indexed by the thread index
 	}
 
 	input.Email["IsThreadLatest"] = &dynamodbTypes.AttributeValueMemberBOOL{Value: true}
-	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-		TransactItems: []dynamodbTypes.TransactWriteItem{
-			{
-				// Set ThreadID to previous email
-				Update: &dynamodbTypes.Update{
-					TableName: aws.String(env.TableName),
-					Key: map[string]dynamodbTypes.AttributeValue{
-						"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: input.CreatingEmailID},
-					},
-					UpdateExpression: aws.String("SET #threadID = :threadID"),
-					ExpressionAttributeNames: map[string]string{
-						"#threadID": "ThreadID",
-					},
-					ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
-						":threadID": &dynamodbTypes.AttributeValueMemberS{Value: input.ThreadID},
-					},
+	items := []dynamodbTypes.TransactWriteItem{
+		{
+			// Set ThreadID to previous email
+			Update: &dynamodbTypes.Update{
+				TableName: aws.String(env.TableName),
+				Key: map[string]dynamodbTypes.AttributeValue{
+					"MessageID": &dynamodbTypes.AttributeValueMemberS{Value: input.CreatingEmailID},
 				},
-			},
-			{
-				// Store the new email
-				Put: &dynamodbTypes.Put{
-					TableName: aws.String(env.TableName),
-					Item:      input.Email,
+				UpdateExpression: aws.String("SET #threadID = :threadID"),
+				ExpressionAttributeNames: map[string]string{
+					"#threadID": "ThreadID",
 				},
-			},
-			{
-				// Create the new thread
-				Put: &dynamodbTypes.Put{
-					TableName: aws.String(env.TableName),
-					Item:      thread,
+				ExpressionAttributeValues: map[string]dynamodbTypes.AttributeValue{
+					":threadID": &dynamodbTypes.AttributeValueMemberS{Value: input.ThreadID},
 				},
 			},
 		},
+		{
+			// Store the new email
+			Put: newEmailPut(input.Email),
+		},
+		{
+			// Create the new thread
+			Put: &dynamodbTypes.Put{
+				TableName: aws.String(env.TableName),
+				Item:      thread,
+			},
+		},
+	}
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append(items, counterUpdates(input.Email)...),
 	})
 	if err != nil {
 		return err
@@ -385,15 +404,69 @@ func StoreEmailWithNewThread(ctx context.Context, client api.TransactWriteItemsA
 	return nil
 }
 
+// newEmailPut returns the Put of a new email item.
+// When counters are maintained, an existing item isn't overwritten, so that the email isn't counted twice.
+func newEmailPut(email map[string]dynamodbTypes.AttributeValue) *dynamodbTypes.Put {
+	put := &dynamodbTypes.Put{
+		TableName: aws.String(env.TableName),
+		Item:      email,
+	}
+	if counter.Enabled() {
+		put.ConditionExpression = aws.String("attribute_not_exists(MessageID)")
+	}
+	return put
+}
+
+// counterUpdates returns the counter updates of storing a new email, if counters are maintained
+func counterUpdates(email map[string]dynamodbTypes.AttributeValue) []dynamodbTypes.TransactWriteItem {
+	if !counter.Enabled() {
+		return nil
+	}
+	state := counter.StateOf(email)
+	if !state.Counted() {
+		return nil
+	}
+	return counter.Updates(counter.Add(state)...)
+}
+
+// alreadyStored returns whether err is caused by the email being stored before, e.g. when the event is retried
+func alreadyStored(err error) bool {
+	if apiErr := new(dynamodbTypes.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+		return true
+	}
+	return counter.ConditionFailed(err)
+}
+
 type StoreEmailInput struct {
-	InReplyTo    string
-	References   string
-	Item         map[string]dynamodbTypes.AttributeValue
-	TimeReceived string // RFC3339
+	InReplyTo         string
+	References        string
+	OriginalMessageID string
+	Item              map[string]dynamodbTypes.AttributeValue
+	TimeReceived      string // RFC3339
 }
 
-// StoreEmail attempts to store the email. If error occurs, it will be logged and the function will return.
+// DefaultStoreTimeout is the timeout of StoreEmail if THREAD_TIMEOUT is not set
+const DefaultStoreTimeout = 10 * time.Second
+
+// StoreEmail attempts to store the email within THREAD_TIMEOUT. If error occurs, it will be logged and the function will return.
 func StoreEmail(ctx context.Context, client api.StoreEmailAPI, input *StoreEmailInput) {
+	ctx, cancel := ctxutil.WithTimeout(ctx, env.ThreadTimeout, DefaultStoreTimeout)
+	defer cancel()
+
+	messageID := ""
+	if id, ok := input.Item["MessageID"].(*dynamodbTypes.AttributeValueMemberS); ok {
+		messageID = id.Value
+	}
+	duplicates, err := FindDuplicates(ctx, client, input.OriginalMessageID, messageID)
+	if err != nil {
+		log.Printf("failed to find duplicates, %v\n", err)
+		// continue
+	}
+	if len(duplicates) > 0 {
+		fmt.Printf("found %d emails with the same original Message-ID\n", len(duplicates))
+		input.Item["DuplicateIDs"] = &dynamodbTypes.AttributeValueMemberSS{Value: duplicates}
+	}
+
 	output, err := DetermineThread(ctx, client, &DetermineThreadInput{
 		InReplyTo:  input.InReplyTo,
 		References: input.References,
@@ -405,16 +478,33 @@ func StoreEmail(ctx context.Context, client api.StoreEmailAPI, input *StoreEmail
 		input.Item["ThreadID"] = &dynamodbTypes.AttributeValueMemberS{Value: output.ThreadID}
 	}
 
+	// duplicates are linked to the email only once it's stored, so that they don't link to an email that doesn't exist
+	if storeInThread(ctx, client, input, output) && len(duplicates) > 0 {
+		if err := LinkDuplicates(ctx, client, messageID, duplicates); err != nil {
+			log.Printf("failed to link duplicates, %v\n", err)
+		}
+	}
+}
+
+// storeInThread stores the email in the thread determined by output, and returns false if it's already stored.
+// It exits if the email can't be stored, so that the event is retried.
+func storeInThread(ctx context.Context, client api.StoreEmailAPI, input *StoreEmailInput, output *DetermineThreadOutput) bool {
+	var err error
 	if output != nil && output.Exists {
 		err = StoreEmailWithExistingThread(ctx, client, &StoreEmailWithExistingThreadInput{
 			ThreadID:          output.ThreadID,
 			Email:             input.Item,
+			TimeReceived:      input.TimeReceived,
 			PreviousMessageID: output.PreviousMessageID,
 		})
+		if alreadyStored(err) {
+			fmt.Println("email is already stored")
+			return false
+		}
 		if err != nil {
 			log.Fatalf("failed to store email with existing thread, %v", err)
 		}
-		return
+		return true
 	}
 
 	if output != nil && output.ShouldCreate {
@@ -426,17 +516,33 @@ func StoreEmail(ctx context.Context, client api.StoreEmailAPI, input *StoreEmail
 			CreatingSubject: output.CreatingSubject,
 			CreatingTime:    output.CreatingTime,
 		})
+		if alreadyStored(err) {
+			fmt.Println("email is already stored")
+			return false
+		}
 		if err != nil {
 			log.Fatalf("failed to store email with new thread, %v", err)
 		}
-		return
+		return true
 	}
 
-	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: &env.TableName,
-		Item:      input.Item,
-	})
+	if updates := counterUpdates(input.Item); len(updates) > 0 {
+		_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: append([]dynamodbTypes.TransactWriteItem{{Put: newEmailPut(input.Item)}}, updates...),
+		})
+	} else {
+		_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           &env.TableName,
+			Item:                input.Item,
+			ConditionExpression: newEmailPut(input.Item).ConditionExpression,
+		})
+	}
+	if alreadyStored(err) {
+		fmt.Println("email is already stored")
+		return false
+	}
 	if err != nil {
 		log.Fatalf("failed to store item in DynamoDB, %v", err)
 	}
+	return true
 }
@@ -3,6 +3,7 @@ package thread
 import (
 	"context"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -288,10 +289,11 @@ func TestStoreEmailWithExistingThread(t *testing.T) {
 							assert.IsType(t, item.Update.Key["MessageID"], &dynamodbTypes.AttributeValueMemberS{})
 
 							if item.Update.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value == "exampleThreadID" {
-								assert.Equal(t, "SET #emails = list_append(#emails, :emails), #timeUpdated = :timeUpdated", *item.Update.UpdateExpression)
+								assert.Equal(t, "SET #emails = list_append(#emails, :emails), #timeUpdated = :timeUpdated, #itemType = :itemType", *item.Update.UpdateExpression)
 								assert.Equal(t, map[string]string{
 									"#emails":      "EmailIDs",
 									"#timeUpdated": "TimeUpdated",
+									"#itemType":    "ItemType",
 								}, item.Update.ExpressionAttributeNames)
 								assert.Equal(t, map[string]dynamodbTypes.AttributeValue{
 									":emails": &dynamodbTypes.AttributeValueMemberL{
@@ -300,6 +302,7 @@ func TestStoreEmailWithExistingThread(t *testing.T) {
 										},
 									},
 									":timeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: "2023-02-18T01:01:01Z"},
+									":itemType":    &dynamodbTypes.AttributeValueMemberS{Value: "thread"},
 								}, item.Update.ExpressionAttributeValues)
 							} else {
 								assert.Equal(t, "examplePreviousMessageID", item.Update.Key["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value)
@@ -370,6 +373,7 @@ func TestStoreEmailWithNewThread(t *testing.T) {
 										},
 									},
 									"TimeUpdated": &dynamodbTypes.AttributeValueMemberS{Value: "2023-02-19T01:01:01Z"},
+									"ItemType":    &dynamodbTypes.AttributeValueMemberS{Value: "thread"},
 									"Subject":     &dynamodbTypes.AttributeValueMemberS{Value: "exampleCreatingSubject"},
 								}, item.Put.Item)
 							case item.Put.Item["MessageID"].(*dynamodbTypes.AttributeValueMemberS).Value == "exampleMessageID":
@@ -429,3 +433,69 @@ func TestStoreEmailWithNewThread(t *testing.T) {
 		})
 	}
 }
+
+func TestParentMessageID(t *testing.T) {
+	tests := []struct {
+		inReplyTo  string
+		references string
+		expected   string
+	}{
+		{"", "", ""},
+		{"<a@example.com>", "", "<a@example.com>"},
+		{"<b@example.com>", "<a@example.com> <b@example.com>", "<b@example.com>"},
+		{"", "<a@example.com> <b@example.com>", "<b@example.com>"},
+		{"", "<a@example.com>\r\n\t<b@example.com>", "<b@example.com>"}, // folded
+		{"", "<a@example.com> <b@example.com> ", "<b@example.com>"},
+		{" <a@example.com>\r\n", "", "<a@example.com>"},
+		{"  ", "<a@example.com>", "<a@example.com>"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			actual := parentMessageID(test.inReplyTo, test.references)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+// FuzzParentMessageID checks that the last messageID is found in References headers of arbitrary shapes,
+// with messageIDs taken from ids and separated by the whitespace chosen by seps
+func FuzzParentMessageID(f *testing.F) {
+	f.Add("a@example.com", []byte{})
+	f.Add("a@example.com b@example.com c@example.com", []byte{0, 1, 2, 3})
+	f.Add("a@example.com b@example.com", []byte{4, 4, 4})
+	f.Add("", []byte{1})
+
+	separators := []string{" ", "\r\n ", "\r\n\t", "\t", "  ", "\n "}
+	f.Fuzz(func(t *testing.T, ids string, seps []byte) {
+		var messageIDs []string
+		for _, id := range strings.Fields(ids) {
+			messageIDs = append(messageIDs, "<"+id+">")
+		}
+		separator := func(i int) string {
+			if i >= len(seps) {
+				return " "
+			}
+			return separators[int(seps[i])%len(separators)]
+		}
+
+		var b strings.Builder
+		b.WriteString(strings.TrimLeft(separator(0), " ")) // leading whitespace, if any
+		for i, id := range messageIDs {
+			if i > 0 {
+				b.WriteString(separator(i))
+			}
+			b.WriteString(id)
+		}
+		b.WriteString(separator(len(messageIDs))) // trailing whitespace
+		references := b.String()
+
+		expected := ""
+		if len(messageIDs) > 0 {
+			expected = messageIDs[len(messageIDs)-1]
+		}
+		assert.Equal(t, expected, parentMessageID("", references))
+		// In-Reply-To takes precedence
+		assert.Equal(t, "<parent@example.com>", parentMessageID("<parent@example.com>", references))
+	})
+}
@@ -0,0 +1,83 @@
+package types
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Address represents a single mailbox, with display name and address stored separately
+type Address struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// String formats the address as `Name <address>`, quoting the name if necessary.
+// Unlike mail.Address, non-ASCII names are kept as is instead of being RFC 2047 encoded.
+func (a Address) String() string {
+	if a.Name == "" {
+		return a.Address
+	}
+	name := a.Name
+	if strings.ContainsAny(name, `()<>[]:;@\,."`) {
+		name = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+	}
+	return name + " <" + a.Address + ">"
+}
+
+func (a Address) ToAttributeValue() types.AttributeValue {
+	return &types.AttributeValueMemberM{
+		Value: map[string]types.AttributeValue{
+			"name":    &types.AttributeValueMemberS{Value: a.Name},
+			"address": &types.AttributeValueMemberS{Value: a.Address},
+		},
+	}
+}
+
+// AddressList is a list of addresses from a single header
+type AddressList []Address
+
+// Strings returns the formatted addresses
+func (l AddressList) Strings() []string {
+	result := make([]string, len(l))
+	for i, a := range l {
+		result[i] = a.String()
+	}
+	return result
+}
+
+// Addresses returns the addresses without display names
+func (l AddressList) Addresses() []string {
+	result := make([]string, len(l))
+	for i, a := range l {
+		result[i] = a.Address
+	}
+	return result
+}
+
+func (l AddressList) ToAttributeValue() types.AttributeValue {
+	value := make([]types.AttributeValue, len(l))
+	for i, a := range l {
+		value[i] = a.ToAttributeValue()
+	}
+	return &types.AttributeValueMemberL{Value: value}
+}
+
+// Addresses holds the parsed address headers of an email
+type Addresses struct {
+	From    AddressList `json:"from"`
+	To      AddressList `json:"to"`
+	Cc      AddressList `json:"cc"`
+	ReplyTo AddressList `json:"replyTo"`
+}
+
+func (a Addresses) ToAttributeValue() types.AttributeValue {
+	return &types.AttributeValueMemberM{
+		Value: map[string]types.AttributeValue{
+			"from":    a.From.ToAttributeValue(),
+			"to":      a.To.ToAttributeValue(),
+			"cc":      a.Cc.ToAttributeValue(),
+			"replyTo": a.ReplyTo.ToAttributeValue(),
+		},
+	}
+}
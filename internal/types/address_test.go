@@ -0,0 +1,37 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddress_String(t *testing.T) {
+	assert.Equal(t, "a@example.com", Address{Address: "a@example.com"}.String())
+	assert.Equal(t, "Alice <a@example.com>", Address{Name: "Alice", Address: "a@example.com"}.String())
+	assert.Equal(t, `"Doe, John" <john@example.com>`, Address{Name: "Doe, John", Address: "john@example.com"}.String())
+	assert.Equal(t, `"A \"B\" C" <a@example.com>`, Address{Name: `A "B" C`, Address: "a@example.com"}.String())
+	assert.Equal(t, "张三 <zhang@example.com>", Address{Name: "张三", Address: "zhang@example.com"}.String())
+}
+
+func TestAddressList_Addresses(t *testing.T) {
+	list := AddressList{{Name: "Alice", Address: "a@example.com"}, {Address: "b@example.com"}}
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, list.Addresses())
+	assert.Equal(t, []string{}, AddressList{}.Addresses())
+}
+
+func TestAddresses_ToAttributeValue(t *testing.T) {
+	addresses := Addresses{
+		From:    AddressList{{Name: "Doe, John", Address: "john@example.com"}},
+		To:      AddressList{{Address: "a@example.com"}, {Name: "B", Address: "b@example.com"}},
+		Cc:      AddressList{},
+		ReplyTo: AddressList{},
+	}
+
+	var actual Addresses
+	err := attributevalue.Unmarshal(addresses.ToAttributeValue(), &actual)
+	assert.Nil(t, err)
+	assert.Equal(t, addresses, actual)
+	assert.Equal(t, []string{"a@example.com", "B <b@example.com>"}, actual.To.Strings())
+}
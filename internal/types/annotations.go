@@ -0,0 +1,16 @@
+package types
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Annotations are key/values attached to an email by external systems, e.g. a CRM record of the sender
+type Annotations map[string]string
+
+func (a Annotations) ToAttributeValue() types.AttributeValue {
+	value := make(map[string]types.AttributeValue, len(a))
+	for k, v := range a {
+		value[k] = &types.AttributeValueMemberS{Value: v}
+	}
+	return &types.AttributeValueMemberM{Value: value}
+}
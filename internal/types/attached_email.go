@@ -0,0 +1,61 @@
+package types
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// AttachedEmail represents an email attached as a message/rfc822 part, e.g. a forwarded message
+type AttachedEmail struct {
+	Index     int      `json:"index"`     // index of the part in the attachments of the containing email
+	MessageID string   `json:"messageID"` // Message-ID header of the attached email
+	Subject   string   `json:"subject"`
+	From      []string `json:"from"`
+	To        []string `json:"to"`
+	Cc        []string `json:"cc"`
+	Date      string   `json:"date"` // RFC3339, empty if the Date header can't be parsed
+	Text      string   `json:"text"`
+
+	// Only available when the attached email is retrieved individually
+	HTML        string `json:"html,omitempty"`
+	Attachments Files  `json:"attachments,omitempty"`
+	Inlines     Files  `json:"inlines,omitempty"`
+}
+
+// ToAttributeValue returns a summary of the attached email, which excludes HTML and files
+// in order to keep the item of the containing email small
+func (e AttachedEmail) ToAttributeValue() types.AttributeValue {
+	return &types.AttributeValueMemberM{
+		Value: map[string]types.AttributeValue{
+			"index":     &types.AttributeValueMemberN{Value: strconv.Itoa(e.Index)},
+			"messageID": &types.AttributeValueMemberS{Value: e.MessageID},
+			"subject":   &types.AttributeValueMemberS{Value: e.Subject},
+			"from":      stringList(e.From),
+			"to":        stringList(e.To),
+			"cc":        stringList(e.Cc),
+			"date":      &types.AttributeValueMemberS{Value: e.Date},
+			"text":      &types.AttributeValueMemberS{Value: e.Text},
+		},
+	}
+}
+
+// AttachedEmails is a list of attached emails
+type AttachedEmails []AttachedEmail
+
+func (es AttachedEmails) ToAttributeValue() types.AttributeValue {
+	value := make([]types.AttributeValue, len(es))
+	for i, e := range es {
+		value[i] = e.ToAttributeValue()
+	}
+	return &types.AttributeValueMemberL{Value: value}
+}
+
+// stringList converts strings to a list, since string sets can't be empty
+func stringList(values []string) types.AttributeValue {
+	list := make([]types.AttributeValue, len(values))
+	for i, v := range values {
+		list[i] = &types.AttributeValueMemberS{Value: v}
+	}
+	return &types.AttributeValueMemberL{Value: list}
+}
@@ -1,7 +1,11 @@
 package types
 
 import (
+	"strconv"
+
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/util/sniff"
 )
 
 type File struct {
@@ -9,6 +13,29 @@ type File struct {
 	ContentType       string            `json:"contentType"`
 	ContentTypeParams map[string]string `json:"contentTypeParams"`
 	Filename          string            `json:"filename"`
+	Size              int64             `json:"size,omitempty"` // decoded size in bytes, estimated for large parts
+
+	// Content type detected from the content, and whether it contradicts the declared type or filename
+	DetectedContentType string `json:"detectedContentType,omitempty"`
+	ContentTypeMismatch bool   `json:"contentTypeMismatch,omitempty"`
+
+	// Set when the attachment policy stripped or quarantined a dangerous attachment
+	Policy string `json:"policy,omitempty"`
+
+	// File listing of zip archives, if the archive could be read
+	Zip *ZipManifest `json:"zip,omitempty"`
+
+	// Location of the encoded body in the raw email,
+	// only set for large parts that are not buffered when the email is parsed
+	Offset int64 `json:"-"`
+	Length int64 `json:"-"`
+}
+
+// SetDetectedContentType records the content type detected from the content,
+// and flags it if it contradicts the declared content type or filename
+func (f *File) SetDetectedContentType(detected string) {
+	f.DetectedContentType = detected
+	f.ContentTypeMismatch = sniff.IsMismatch(f.ContentType, f.Filename, detected)
 }
 
 func (f File) ToAttributeValue() types.AttributeValue {
@@ -19,26 +46,54 @@ func (f File) ToAttributeValue() types.AttributeValue {
 		}
 	}
 
-	return &types.AttributeValueMemberM{
-		Value: map[string]types.AttributeValue{
-			"contentID": &types.AttributeValueMemberS{
-				Value: f.ContentID,
-			},
-			"contentType": &types.AttributeValueMemberS{
-				Value: f.ContentType,
-			},
-			"contentTypeParams": &types.AttributeValueMemberM{
-				Value: params,
-			},
-			"filename": &types.AttributeValueMemberS{
-				Value: f.Filename,
-			},
+	value := map[string]types.AttributeValue{
+		"contentID": &types.AttributeValueMemberS{
+			Value: f.ContentID,
+		},
+		"contentType": &types.AttributeValueMemberS{
+			Value: f.ContentType,
+		},
+		"contentTypeParams": &types.AttributeValueMemberM{
+			Value: params,
+		},
+		"filename": &types.AttributeValueMemberS{
+			Value: f.Filename,
 		},
 	}
+	if f.Size > 0 {
+		value["size"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(f.Size, 10)}
+	}
+	if f.DetectedContentType != "" {
+		value["detectedContentType"] = &types.AttributeValueMemberS{Value: f.DetectedContentType}
+		value["contentTypeMismatch"] = &types.AttributeValueMemberBOOL{Value: f.ContentTypeMismatch}
+	}
+	if f.Policy != "" {
+		value["policy"] = &types.AttributeValueMemberS{Value: f.Policy}
+	}
+	if f.Zip != nil {
+		value["zip"] = f.Zip.ToAttributeValue()
+	}
+	if f.Length > 0 {
+		value["offset"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(f.Offset, 10)}
+		value["length"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(f.Length, 10)}
+	}
+
+	return &types.AttributeValueMemberM{
+		Value: value,
+	}
 }
 
 type Files []File
 
+// TotalSize returns the sum of the sizes of the files
+func (fs Files) TotalSize() int64 {
+	var size int64
+	for _, f := range fs {
+		size += f.Size
+	}
+	return size
+}
+
 func (fs Files) ToAttributeValue() types.AttributeValue {
 	value := make([]types.AttributeValue, len(fs))
 	for i, f := range fs {
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrInvalidHeadersAttribute is returned when the stored headers are not in binary format
+var ErrInvalidHeadersAttribute = errors.New("invalid headers attribute")
+
+// Header represents a single header field of an email
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Headers is the list of header fields, in the order they appear in the email
+type Headers []Header
+
+// ToAttributeValue returns the headers as gzip compressed JSON,
+// since the full header section can be large
+func (hs Headers) ToAttributeValue() (types.AttributeValue, error) {
+	data, err := json.Marshal(hs)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err = writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return &types.AttributeValueMemberB{
+		Value: buf.Bytes(),
+	}, nil
+}
+
+// UnmarshalHeaders decodes headers stored by Headers.ToAttributeValue
+func UnmarshalHeaders(av types.AttributeValue) (Headers, error) {
+	b, ok := av.(*types.AttributeValueMemberB)
+	if !ok {
+		return nil, ErrInvalidHeadersAttribute
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(b.Value))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var hs Headers
+	err = json.Unmarshal(data, &hs)
+	return hs, err
+}
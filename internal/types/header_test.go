@@ -0,0 +1,32 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaders(t *testing.T) {
+	headers := Headers{
+		{Name: "Received", Value: "from a.example.com by b.example.com; Tue, 12 Mar 2024 10:10:10 +0000"},
+		{Name: "From", Value: "Example <example@example.com>"},
+		{Name: "Received", Value: "by a.example.com; Tue, 12 Mar 2024 10:10:09 +0000"},
+	}
+
+	av, err := headers.ToAttributeValue()
+	assert.Nil(t, err)
+	assert.IsType(t, &types.AttributeValueMemberB{}, av)
+
+	actual, err := UnmarshalHeaders(av)
+	assert.Nil(t, err)
+	assert.Equal(t, headers, actual)
+}
+
+func TestUnmarshalHeaders_Invalid(t *testing.T) {
+	_, err := UnmarshalHeaders(&types.AttributeValueMemberS{Value: "headers"})
+	assert.Equal(t, ErrInvalidHeadersAttribute, err)
+
+	_, err = UnmarshalHeaders(&types.AttributeValueMemberB{Value: []byte("not gzip")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Hop represents a single relay that an email passed through,
+// as recorded in a Received header
+type Hop struct {
+	From      string `json:"from"`
+	By        string `json:"by"`
+	IP        string `json:"ip"`
+	With      string `json:"with"`
+	Timestamp string `json:"timestamp"` // RFC3339, empty if the date can't be parsed
+	Delay     int64  `json:"delay"`     // seconds since the previous hop
+}
+
+func (h Hop) ToAttributeValue() types.AttributeValue {
+	return &types.AttributeValueMemberM{
+		Value: map[string]types.AttributeValue{
+			"from":      &types.AttributeValueMemberS{Value: h.From},
+			"by":        &types.AttributeValueMemberS{Value: h.By},
+			"ip":        &types.AttributeValueMemberS{Value: h.IP},
+			"with":      &types.AttributeValueMemberS{Value: h.With},
+			"timestamp": &types.AttributeValueMemberS{Value: h.Timestamp},
+			"delay":     &types.AttributeValueMemberN{Value: strconv.FormatInt(h.Delay, 10)},
+		},
+	}
+}
+
+// Hops is the delivery path of an email, ordered from the origin to the final destination
+type Hops []Hop
+
+func (hs Hops) ToAttributeValue() types.AttributeValue {
+	value := make([]types.AttributeValue, len(hs))
+	for i, h := range hs {
+		value[i] = h.ToAttributeValue()
+	}
+
+	return &types.AttributeValueMemberL{
+		Value: value,
+	}
+}
@@ -0,0 +1,18 @@
+package types
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Scores are named confidences given to an email by a classification service, e.g. {"spam": 0.93}
+type Scores map[string]float64
+
+func (s Scores) ToAttributeValue() types.AttributeValue {
+	value := make(map[string]types.AttributeValue, len(s))
+	for k, v := range s {
+		value[k] = &types.AttributeValueMemberN{Value: strconv.FormatFloat(v, 'f', -1, 64)}
+	}
+	return &types.AttributeValueMemberM{Value: value}
+}
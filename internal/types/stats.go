@@ -0,0 +1,45 @@
+package types
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// EmailStats contains the sizes and part counts of an email, recorded when the email is parsed.
+// Sizes are in bytes. Sizes of files are decoded sizes, which are estimated for large parts.
+type EmailStats struct {
+	RawSize  int64 `json:"rawSize"` // size of the raw email stored in S3
+	TextSize int64 `json:"textSize"`
+	HTMLSize int64 `json:"htmlSize"`
+
+	AttachmentCount int   `json:"attachmentCount"`
+	AttachmentSize  int64 `json:"attachmentSize"` // total size of attachments
+	InlineCount     int   `json:"inlineCount"`
+	InlineSize      int64 `json:"inlineSize"` // total size of inline files
+	OtherPartCount  int   `json:"otherPartCount"`
+
+	PartCount int `json:"partCount"` // number of MIME parts, including multipart containers
+	LeafCount int `json:"leafCount"` // number of MIME parts that are not multipart containers
+}
+
+func (s EmailStats) ToAttributeValue() types.AttributeValue {
+	return &types.AttributeValueMemberM{
+		Value: map[string]types.AttributeValue{
+			"rawSize":         number(s.RawSize),
+			"textSize":        number(s.TextSize),
+			"htmlSize":        number(s.HTMLSize),
+			"attachmentCount": number(int64(s.AttachmentCount)),
+			"attachmentSize":  number(s.AttachmentSize),
+			"inlineCount":     number(int64(s.InlineCount)),
+			"inlineSize":      number(s.InlineSize),
+			"otherPartCount":  number(int64(s.OtherPartCount)),
+			"partCount":       number(int64(s.PartCount)),
+			"leafCount":       number(int64(s.LeafCount)),
+		},
+	}
+}
+
+func number(n int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)}
+}
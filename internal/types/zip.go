@@ -0,0 +1,49 @@
+package types
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ZipManifest is the file listing of a zip attachment, read from the central directory without extracting files
+type ZipManifest struct {
+	Entries      []ZipEntry `json:"entries"`
+	TotalEntries int        `json:"totalEntries"` // number of entries in the archive, which may exceed len(Entries)
+
+	Encrypted        bool `json:"encrypted"`        // if any entry is encrypted
+	NestedExecutable bool `json:"nestedExecutable"` // if any entry is an executable or a script
+}
+
+// ZipEntry is a file or a directory in a zip archive
+type ZipEntry struct {
+	Name           string `json:"name"`
+	Size           uint64 `json:"size"`           // uncompressed size in bytes
+	CompressedSize uint64 `json:"compressedSize"` // compressed size in bytes
+	Encrypted      bool   `json:"encrypted"`
+	Executable     bool   `json:"executable"`
+}
+
+func (m ZipManifest) ToAttributeValue() types.AttributeValue {
+	entries := make([]types.AttributeValue, len(m.Entries))
+	for i, entry := range m.Entries {
+		entries[i] = &types.AttributeValueMemberM{
+			Value: map[string]types.AttributeValue{
+				"name":           &types.AttributeValueMemberS{Value: entry.Name},
+				"size":           &types.AttributeValueMemberN{Value: strconv.FormatUint(entry.Size, 10)},
+				"compressedSize": &types.AttributeValueMemberN{Value: strconv.FormatUint(entry.CompressedSize, 10)},
+				"encrypted":      &types.AttributeValueMemberBOOL{Value: entry.Encrypted},
+				"executable":     &types.AttributeValueMemberBOOL{Value: entry.Executable},
+			},
+		}
+	}
+
+	return &types.AttributeValueMemberM{
+		Value: map[string]types.AttributeValue{
+			"entries":          &types.AttributeValueMemberL{Value: entries},
+			"totalEntries":     &types.AttributeValueMemberN{Value: strconv.Itoa(m.TotalEntries)},
+			"encrypted":        &types.AttributeValueMemberBOOL{Value: m.Encrypted},
+			"nestedExecutable": &types.AttributeValueMemberBOOL{Value: m.NestedExecutable},
+		},
+	}
+}
@@ -0,0 +1,78 @@
+package addr
+
+import (
+	"mime"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+
+	"github.com/harryzcy/mailbox/internal/types"
+)
+
+// parser decodes RFC 2047 encoded words in any charset supported by the html package
+var parser = mail.AddressParser{
+	WordDecoder: &mime.WordDecoder{
+		CharsetReader: charset.NewReaderLabel,
+	},
+}
+
+// ParseList parses an RFC 5322 address-list, such as the value of From, To, Cc or Reply-To headers.
+// Display names containing commas, groups, and encoded words are supported.
+// Groups are flattened into their members.
+func ParseList(s string) (types.AddressList, error) {
+	if strings.TrimSpace(s) == "" {
+		return types.AddressList{}, nil
+	}
+
+	list, err := parser.ParseList(s)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make(types.AddressList, len(list))
+	for i, address := range list {
+		addresses[i] = types.Address{Name: address.Name, Address: address.Address}
+	}
+	return addresses, nil
+}
+
+// ParseListLenient is like ParseList, but falls back to splitting by commas if the value is malformed,
+// so that non-conforming headers are still recorded.
+func ParseListLenient(s string) types.AddressList {
+	addresses, err := ParseList(s)
+	if err == nil {
+		return addresses
+	}
+
+	addresses = types.AddressList{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if address, err := parser.Parse(part); err == nil {
+			addresses = append(addresses, types.Address{Name: address.Name, Address: address.Address})
+		} else {
+			addresses = append(addresses, types.Address{Address: part})
+		}
+	}
+	return addresses
+}
+
+// ParseMailAddresses parses a list of single addresses, e.g. those supplied in API requests,
+// into mail.Address values used to build MIME messages.
+// Internationalized domains are converted to punycode.
+func ParseMailAddresses(addresses []string) ([]mail.Address, error) {
+	var mailAddresses []mail.Address
+	for _, s := range addresses {
+		address, err := parser.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if err = toASCIIMailAddress(address); err != nil {
+			return nil, err
+		}
+		mailAddresses = append(mailAddresses, *address)
+	}
+	return mailAddresses, nil
+}
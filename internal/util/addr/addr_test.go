@@ -0,0 +1,68 @@
+package addr
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/types"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected types.AddressList
+		hasErr   bool
+	}{
+		{"", types.AddressList{}, false},
+		{"example@example.com", types.AddressList{{Address: "example@example.com"}}, false},
+		{
+			`"Doe, John" <john@example.com>, jane@example.com`,
+			types.AddressList{{Name: "Doe, John", Address: "john@example.com"}, {Address: "jane@example.com"}},
+			false,
+		},
+		{
+			`Team: a@example.com, "B" <b@example.com>;, c@example.com`,
+			types.AddressList{{Address: "a@example.com"}, {Name: "B", Address: "b@example.com"}, {Address: "c@example.com"}},
+			false,
+		},
+		{"undisclosed-recipients:;", types.AddressList{}, false},
+		{"=?UTF-8?B?5byg5LiJ?= <zhang@example.com>", types.AddressList{{Name: "张三", Address: "zhang@example.com"}}, false},
+		{"=?ISO-8859-1?Q?Andr=E9?= <andre@example.com>", types.AddressList{{Name: "André", Address: "andre@example.com"}}, false},
+		{"=?GBK?B?1cXI/Q==?= <zhang@example.com>", types.AddressList{{Name: "张三", Address: "zhang@example.com"}}, false},
+		{"not an address", nil, true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			actual, err := ParseList(test.in)
+			assert.Equal(t, test.expected, actual)
+			assert.Equal(t, test.hasErr, err != nil)
+		})
+	}
+}
+
+func TestParseListLenient(t *testing.T) {
+	assert.Equal(t,
+		types.AddressList{{Name: "A", Address: "a@example.com"}, {Address: "invalid"}},
+		ParseListLenient("A <a@example.com>, invalid"),
+	)
+}
+
+func TestParseMailAddresses(t *testing.T) {
+	addresses, err := ParseMailAddresses([]string{"Alice <a@example.com>", "b@example.com"})
+	assert.Nil(t, err)
+	assert.Len(t, addresses, 2)
+	assert.Equal(t, "Alice", addresses[0].Name)
+	assert.Equal(t, "b@example.com", addresses[1].Address)
+
+	_, err = ParseMailAddresses([]string{"invalid"})
+	assert.Error(t, err)
+}
+
+func TestParseMailAddresses_IDN(t *testing.T) {
+	addresses, err := ParseMailAddresses([]string{"用户@例子.广告"})
+	assert.Nil(t, err)
+	assert.Equal(t, "用户@xn--fsqu00a.xn--4rr70v", addresses[0].Address)
+}
@@ -0,0 +1,167 @@
+package addr
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalidAddress is returned when an address can't be parsed or its domain is not a valid (internationalized) domain name
+var ErrInvalidAddress = errors.New("invalid email address")
+
+// Validate checks that s is a single address, optionally with a display name.
+// UTF-8 local parts (RFC 6531) and internationalized domain names are accepted.
+func Validate(s string) error {
+	address, err := parser.Parse(s)
+	if err != nil {
+		return ErrInvalidAddress
+	}
+	if _, err = domainToASCII(address.Address); err != nil {
+		return ErrInvalidAddress
+	}
+	return nil
+}
+
+// ValidateAll checks every address with Validate.
+// Blank entries are ignored, since drafts may be incomplete.
+func ValidateAll(addresses []string) error {
+	for _, s := range addresses {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		if err := Validate(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToASCII converts the domain of an address to punycode, as required by SES for envelope and header addresses.
+// The display name is kept, and is RFC 2047 encoded if it contains non-ASCII characters.
+// The local part is left unchanged, since it has no ASCII-compatible encoding.
+func ToASCII(s string) (string, error) {
+	address, err := parser.Parse(s)
+	if err != nil {
+		return "", ErrInvalidAddress
+	}
+	converted, err := domainToASCII(address.Address)
+	if err != nil {
+		return "", ErrInvalidAddress
+	}
+	if converted == address.Address {
+		return strings.TrimSpace(s), nil // nothing to convert, keep the original form
+	}
+	address.Address = converted
+	if address.Name == "" {
+		return address.Address, nil
+	}
+	return address.String(), nil
+}
+
+// ToASCIIAll converts every address with ToASCII.
+// Blank entries are kept as is and left for SES to reject.
+func ToASCIIAll(addresses []string) ([]string, error) {
+	if addresses == nil {
+		return nil, nil
+	}
+	result := make([]string, len(addresses))
+	for i, s := range addresses {
+		if strings.TrimSpace(s) == "" {
+			result[i] = s
+			continue
+		}
+		converted, err := ToASCII(s)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = converted
+	}
+	return result, nil
+}
+
+// ToUnicode converts a punycode domain of a bare address back to Unicode for display.
+// The address is returned unchanged if it can't be converted.
+func ToUnicode(address string) string {
+	local, domain, ok := splitAddress(address)
+	if !ok {
+		return address
+	}
+	unicodeDomain, err := idna.Display.ToUnicode(domain)
+	if err != nil {
+		return address
+	}
+	return local + "@" + unicodeDomain
+}
+
+// Display converts a punycode domain of an address in header form, e.g. "Name <user@xn--bcher-kva.example>",
+// to Unicode for display. The display name and the rest of the address are kept as is.
+func Display(s string) string {
+	start, end := 0, len(s)
+	if i, j := strings.LastIndex(s, "<"), strings.LastIndex(s, ">"); i >= 0 && j > i {
+		start, end = i+1, j
+	}
+	address := strings.TrimSpace(s[start:end])
+	if !strings.Contains(strings.ToLower(address), "xn--") {
+		return s
+	}
+	return s[:start] + ToUnicode(address) + s[end:]
+}
+
+// DisplayAll converts every address with Display
+func DisplayAll(addresses []string) []string {
+	if addresses == nil {
+		return nil
+	}
+	result := make([]string, len(addresses))
+	for i, s := range addresses {
+		result[i] = Display(s)
+	}
+	return result
+}
+
+// domainToASCII converts the domain of a bare address to punycode.
+// ASCII domains are only validated, so that their original form is kept.
+func domainToASCII(address string) (string, error) {
+	local, domain, ok := splitAddress(address)
+	if !ok {
+		return "", ErrInvalidAddress
+	}
+	asciiDomain, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", err
+	}
+	if isASCII(domain) {
+		return address, nil
+	}
+	return local + "@" + asciiDomain, nil
+}
+
+func splitAddress(address string) (local, domain string, ok bool) {
+	i := strings.LastIndex(address, "@")
+	if i <= 0 || i == len(address)-1 {
+		return "", "", false
+	}
+	return address[:i], address[i+1:], true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// toASCIIMailAddress converts the domain of a parsed address to punycode
+func toASCIIMailAddress(address *mail.Address) error {
+	converted, err := domainToASCII(address.Address)
+	if err != nil {
+		return ErrInvalidAddress
+	}
+	address.Address = converted
+	return nil
+}
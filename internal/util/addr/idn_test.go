@@ -0,0 +1,88 @@
+package addr
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		in    string
+		valid bool
+	}{
+		{"example@example.com", true},
+		{"Name <example@example.com>", true},
+		{"用户@例子.广告", true},
+		{"José <josé@ñandú.example>", true},
+		{"example@xn--fsqu00a.xn--4rr70v", true},
+		{"example", false},
+		{"example@", false},
+		{"example@exa mple.com", false},
+		{"example@-example.com", false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := Validate(test.in)
+			if test.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.Equal(t, ErrInvalidAddress, err)
+			}
+		})
+	}
+}
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+		hasErr   bool
+	}{
+		{"example@example.com", "example@example.com", false},
+		{"First Last <foo@example.com>", "First Last <foo@example.com>", false},
+		{"用户@例子.广告", "用户@xn--fsqu00a.xn--4rr70v", false},
+		{"Name <user@bücher.example>", `"Name" <user@xn--bcher-kva.example>`, false},
+		{"invalid", "", true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			actual, err := ToASCII(test.in)
+			assert.Equal(t, test.expected, actual)
+			assert.Equal(t, test.hasErr, err != nil)
+		})
+	}
+
+	all, err := ToASCIIAll(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, all)
+}
+
+func TestToUnicode(t *testing.T) {
+	assert.Equal(t, "user@bücher.example", ToUnicode("user@xn--bcher-kva.example"))
+	assert.Equal(t, "user@example.com", ToUnicode("user@example.com"))
+	assert.Equal(t, "invalid", ToUnicode("invalid"))
+}
+
+func TestDisplay(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"user@xn--bcher-kva.example", "user@bücher.example"},
+		{"Bücher <user@XN--BCHER-KVA.example>", "Bücher <user@bücher.example>"},
+		{`"Doe, Jane" <jane@xn--bcher-kva.example>`, `"Doe, Jane" <jane@bücher.example>`},
+		{"Jane <jane@example.com>", "Jane <jane@example.com>"},
+		{"user@xn--zz.example", "user@xn--zz.example"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, Display(test.input), test.input)
+	}
+
+	assert.Equal(t, []string{"user@bücher.example", "jane@example.com"}, DisplayAll([]string{"user@xn--bcher-kva.example", "jane@example.com"}))
+	assert.Nil(t, DisplayAll(nil))
+}
@@ -0,0 +1,168 @@
+package apiutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Handler is the handler of an API Lambda function
+type Handler func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (Response, error)
+
+// Access log policies, which decide what is redacted from access logs
+const (
+	AccessLogOff       = "off"       // access logs are not written
+	AccessLogRedacted  = "redacted"  // bodies are omitted and email addresses are masked (default)
+	AccessLogAddresses = "addresses" // request bodies are logged, with email addresses masked
+	AccessLogFull      = "full"      // request bodies, email addresses, and source IPs are logged as they are
+)
+
+// MaxLoggedBodySize is the maximum number of bytes of a request body written to access logs
+const MaxLoggedBodySize = 4096
+
+// AccessLog is a line of access log
+type AccessLog struct {
+	RequestID     string `json:"requestID,omitempty"`
+	Method        string `json:"method"`
+	Path          string `json:"path"`
+	Query         string `json:"query,omitempty"`
+	Status        int    `json:"status"`
+	LatencyMillis int64  `json:"latencyMs"`
+	Caller        string `json:"caller,omitempty"`
+	SourceIP      string `json:"sourceIP,omitempty"`
+	RequestSize   int    `json:"requestSize"`
+	ResponseSize  int    `json:"responseSize"`
+	Body          string `json:"body,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+var addressRegex = regexp.MustCompile(`[A-Za-z0-9.!#$%&'*+/=?^_{|}~-]+@([A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*)`)
+
+// RedactAddresses masks the local part of the email addresses in s, keeping the domain for troubleshooting
+func RedactAddresses(s string) string {
+	return addressRegex.ReplaceAllString(s, "***@$1")
+}
+
+// accessLogPolicy returns the access log policy set by ACCESS_LOG_POLICY
+func accessLogPolicy() string {
+	switch policy := strings.ToLower(env.AccessLogPolicy); policy {
+	case AccessLogOff, AccessLogAddresses, AccessLogFull:
+		return policy
+	default:
+		return AccessLogRedacted
+	}
+}
+
+// WithAccessLog wraps handler to write an access log of each request to stdout, which ends up in CloudWatch.
+// Email content is kept out of the logs according to the access log policy.
+// The values of secretParams path parameters, e.g. tokens, are always masked.
+func WithAccessLog(handler Handler, secretParams ...string) Handler {
+	return func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (Response, error) {
+		policy := accessLogPolicy()
+		if policy == AccessLogOff {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		line := newAccessLog(req, resp, err, policy, secretParams...)
+		line.LatencyMillis = time.Since(start).Milliseconds()
+
+		data, marshalErr := json.Marshal(line)
+		if marshalErr != nil {
+			fmt.Printf("access log marshal failed: %v\n", marshalErr)
+			return resp, err
+		}
+		fmt.Println(string(data))
+		return resp, err
+	}
+}
+
+// newAccessLog returns the access log of a request, redacted according to policy and with secretParams masked
+func newAccessLog(req events.APIGatewayV2HTTPRequest, resp Response, err error, policy string, secretParams ...string) AccessLog {
+	redact := func(s string) string {
+		if policy == AccessLogFull {
+			return s
+		}
+		return RedactAddresses(s)
+	}
+
+	line := AccessLog{
+		RequestID:    req.RequestContext.RequestID,
+		Method:       req.RequestContext.HTTP.Method,
+		Path:         redact(req.RequestContext.HTTP.Path),
+		Query:        encodeQuery(req.QueryStringParameters, redact),
+		Status:       resp.StatusCode,
+		Caller:       Caller(req),
+		RequestSize:  len(req.Body),
+		ResponseSize: len(resp.Body),
+	}
+	if line.Path == "" {
+		line.Path = redact(req.RawPath)
+	}
+	for _, name := range secretParams {
+		if value := req.PathParameters[name]; value != "" {
+			line.Path = strings.ReplaceAll(line.Path, value, "***")
+		}
+	}
+	if err != nil {
+		line.Error = err.Error()
+	}
+
+	if policy == AccessLogFull {
+		line.SourceIP = req.RequestContext.HTTP.SourceIP
+	}
+	if policy == AccessLogAddresses || policy == AccessLogFull {
+		body := req.Body
+		if req.IsBase64Encoded {
+			body = "(base64 encoded)"
+		} else if len(body) > MaxLoggedBodySize {
+			body = body[:MaxLoggedBodySize] + "...(truncated)"
+		}
+		line.Body = redact(body)
+	}
+	return line
+}
+
+// Caller returns the identity that signed the request, which is the IAM user or role
+func Caller(req events.APIGatewayV2HTTPRequest) string {
+	authorizer := req.RequestContext.Authorizer
+	if authorizer == nil || authorizer.IAM == nil {
+		return ""
+	}
+	if authorizer.IAM.UserARN != "" {
+		return authorizer.IAM.UserARN
+	}
+	return authorizer.IAM.CallerID
+}
+
+// encodeQuery encodes query string parameters in a stable order, with values redacted by redact
+func encodeQuery(params map[string]string, redact func(string) string) string {
+	if len(params) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(k))
+		b.WriteByte('=')
+		b.WriteString(url.QueryEscape(redact(params[k])))
+	}
+	return b.String()
+}
@@ -0,0 +1,122 @@
+package apiutil
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactAddresses(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"no address", "no address"},
+		{"alice@example.com", "***@example.com"},
+		{`{"to":["Bob <bob.smith+tag@mail.example.org>"]}`, `{"to":["Bob <***@mail.example.org>"]}`},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, RedactAddresses(test.input))
+		})
+	}
+}
+
+func TestNewAccessLog(t *testing.T) {
+	req := events.APIGatewayV2HTTPRequest{
+		QueryStringParameters: map[string]string{"type": "inbox", "from": "alice@example.com"},
+		Body:                  `{"subject":"hello","to":["bob@example.com"]}`,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RequestID: "exampleRequestID",
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:   "POST",
+				Path:     "/emails",
+				SourceIP: "192.0.2.1",
+			},
+			Authorizer: &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+				IAM: &events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription{
+					UserARN: "arn:aws:iam::123456789012:user/example",
+				},
+			},
+		},
+	}
+	resp := NewSuccessJSONResponse(`{"messageID":"draft-example"}`)
+
+	tests := []struct {
+		policy   string
+		expected AccessLog
+	}{
+		{
+			policy: AccessLogRedacted,
+			expected: AccessLog{
+				Query: "from=%2A%2A%2A%40example.com&type=inbox",
+			},
+		},
+		{
+			policy: AccessLogAddresses,
+			expected: AccessLog{
+				Query: "from=%2A%2A%2A%40example.com&type=inbox",
+				Body:  `{"subject":"hello","to":["***@example.com"]}`,
+			},
+		},
+		{
+			policy: AccessLogFull,
+			expected: AccessLog{
+				Query:    "from=alice%40example.com&type=inbox",
+				Body:     req.Body,
+				SourceIP: "192.0.2.1",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			expected := test.expected
+			expected.RequestID = "exampleRequestID"
+			expected.Method = "POST"
+			expected.Path = "/emails"
+			expected.Status = 200
+			expected.Caller = "arn:aws:iam::123456789012:user/example"
+			expected.RequestSize = len(req.Body)
+			expected.ResponseSize = len(resp.Body)
+
+			assert.Equal(t, expected, newAccessLog(req, resp, nil, test.policy))
+		})
+	}
+}
+
+func TestNewAccessLog_SecretParams(t *testing.T) {
+	req := events.APIGatewayV2HTTPRequest{
+		PathParameters: map[string]string{"token": "abc.123.signature"},
+	}
+	req.RequestContext.HTTP.Path = "/share/abc.123.signature"
+
+	line := newAccessLog(req, Response{StatusCode: 200}, nil, AccessLogFull, "token")
+	assert.Equal(t, "/share/***", line.Path)
+
+	line = newAccessLog(req, Response{StatusCode: 200}, nil, AccessLogFull)
+	assert.Equal(t, "/share/abc.123.signature", line.Path)
+}
+
+func TestWithAccessLog(t *testing.T) {
+	defer func() { env.AccessLogPolicy = "" }()
+
+	expectedErr := errors.New("handler error")
+	handler := WithAccessLog(func(_ context.Context, _ events.APIGatewayV2HTTPRequest) (Response, error) {
+		return NewErrorResponse(500, "internal error"), expectedErr
+	})
+
+	for _, policy := range []string{"", AccessLogOff, "invalid"} {
+		env.AccessLogPolicy = policy
+		resp, err := handler(context.TODO(), events.APIGatewayV2HTTPRequest{})
+		assert.Equal(t, expectedErr, err)
+		assert.Equal(t, 500, resp.StatusCode)
+	}
+}
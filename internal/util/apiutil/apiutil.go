@@ -4,6 +4,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/aws/aws-lambda-go/events"
 )
@@ -21,21 +23,52 @@ type ErrorBody struct {
 func NewBinaryResponse(code int, content []byte, contentType, disposition, filename string) Response {
 	body := base64.StdEncoding.EncodeToString(content)
 
-	contentDisposition := disposition
-	if filename != "" {
-		contentDisposition += fmt.Sprintf("; filename=\"%s\"", filename)
-	}
 	return Response{
 		StatusCode:      code,
 		IsBase64Encoded: true,
 		Body:            body,
 		Headers: map[string]string{
 			"Content-Type":        contentType,
-			"Content-Disposition": contentDisposition,
+			"Content-Disposition": ContentDisposition(disposition, filename),
 		},
 	}
 }
 
+// ContentDisposition returns the Content-Disposition header of a disposition type, i.e. inline or attachment,
+// and a filename (RFC 6266). Filenames that aren't plain ASCII are encoded in filename* (RFC 8187),
+// with filename as the fallback for older clients, where the other characters are replaced by underscores.
+func ContentDisposition(disposition, filename string) string {
+	if filename == "" {
+		return disposition
+	}
+
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r >= 0x7f || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+	header := fmt.Sprintf("%s; filename=\"%s\"", disposition, fallback)
+	if fallback != filename && utf8.ValidString(filename) {
+		header += "; filename*=UTF-8''" + encodeExtValue(filename)
+	}
+	return header
+}
+
+// encodeExtValue percent-encodes a value except for attr-char (RFC 8187)
+func encodeExtValue(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
 // NewSuccessJSONResponse returns a successful response
 func NewSuccessJSONResponse(body string) Response {
 	return Response{
@@ -0,0 +1,28 @@
+package apiutil
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		disposition string
+		filename    string
+		expected    string
+	}{
+		{"inline", "", "inline"},
+		{"attachment", "report.pdf", `attachment; filename="report.pdf"`},
+		{"attachment", "Résumé 2024.pdf", `attachment; filename="R_sum_ 2024.pdf"; filename*=UTF-8''R%C3%A9sum%C3%A9%202024.pdf`},
+		{"attachment", `say "hi".txt`, `attachment; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+		{"inline", "报告.pdf", `inline; filename="__.pdf"; filename*=UTF-8''%E6%8A%A5%E5%91%8A.pdf`},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, ContentDisposition(test.disposition, test.filename))
+		})
+	}
+}
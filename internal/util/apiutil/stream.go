@@ -0,0 +1,133 @@
+package apiutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// StreamingResponse is returned from a function URL whose invoke mode is RESPONSE_STREAM.
+// Its body is streamed after the handler returns, so that it's not limited to the 6MB of buffered responses.
+type StreamingResponse = events.LambdaFunctionURLStreamingResponse
+
+// StreamHandler is the handler of an API Lambda function behind a function URL that streams its response
+type StreamHandler func(ctx context.Context, req events.LambdaFunctionURLRequest) (*StreamingResponse, error)
+
+// NewStreamingResponse returns a response streaming body, which is closed after it's sent.
+// If filename is not empty, it will be used as the filename in the Content-Disposition header.
+func NewStreamingResponse(code int, body io.Reader, contentType, disposition, filename string) *StreamingResponse {
+	return &StreamingResponse{
+		StatusCode: code,
+		Body:       body,
+		Headers: map[string]string{
+			"Content-Type":        contentType,
+			"Content-Disposition": ContentDisposition(disposition, filename),
+		},
+	}
+}
+
+// NewStreamingErrorResponse returns an error response of a function streaming its responses
+func NewStreamingErrorResponse(code int, message string) *StreamingResponse {
+	resp := NewErrorResponse(code, message)
+	return &StreamingResponse{
+		StatusCode: resp.StatusCode,
+		Body:       strings.NewReader(resp.Body),
+		Headers:    resp.Headers,
+	}
+}
+
+// MatchPath returns the parameters of path, e.g. {"messageID": "id"} for /emails/id/raw and /emails/{messageID}/raw,
+// since function URLs don't have routes like API Gateway. It returns false if path doesn't match pattern.
+func MatchPath(pattern, path string) (map[string]string, bool) {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			params[segment[1:len(segment)-1]] = pathSegments[i]
+		} else if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// WithStreamAccessLog is WithAccessLog for functions streaming their responses.
+// The response size is not logged, since the body is streamed after the handler returns.
+func WithStreamAccessLog(handler StreamHandler, secretParams ...string) StreamHandler {
+	return func(ctx context.Context, req events.LambdaFunctionURLRequest) (*StreamingResponse, error) {
+		policy := accessLogPolicy()
+		if policy == AccessLogOff {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		var status Response
+		if resp != nil {
+			status.StatusCode = resp.StatusCode
+		}
+		line := newAccessLog(apiGatewayRequest(req), status, err, policy, secretParams...)
+		line.LatencyMillis = time.Since(start).Milliseconds()
+
+		data, marshalErr := json.Marshal(line)
+		if marshalErr != nil {
+			fmt.Printf("access log marshal failed: %v\n", marshalErr)
+			return resp, err
+		}
+		fmt.Println(string(data))
+		return resp, err
+	}
+}
+
+// StreamCaller returns the Caller of a request of a function URL
+func StreamCaller(req events.LambdaFunctionURLRequest) string {
+	return Caller(apiGatewayRequest(req))
+}
+
+// apiGatewayRequest converts a request of a function URL to the API Gateway request of the same shape,
+// e.g. to get its Caller
+func apiGatewayRequest(req events.LambdaFunctionURLRequest) events.APIGatewayV2HTTPRequest {
+	converted := events.APIGatewayV2HTTPRequest{
+		RawPath:               req.RawPath,
+		RawQueryString:        req.RawQueryString,
+		Headers:               req.Headers,
+		QueryStringParameters: req.QueryStringParameters,
+		Body:                  req.Body,
+		IsBase64Encoded:       req.IsBase64Encoded,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RequestID: req.RequestContext.RequestID,
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    req.RequestContext.HTTP.Method,
+				Path:      req.RequestContext.HTTP.Path,
+				Protocol:  req.RequestContext.HTTP.Protocol,
+				SourceIP:  req.RequestContext.HTTP.SourceIP,
+				UserAgent: req.RequestContext.HTTP.UserAgent,
+			},
+		},
+	}
+	if authorizer := req.RequestContext.Authorizer; authorizer != nil && authorizer.IAM != nil {
+		converted.RequestContext.Authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+			IAM: &events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription{
+				AccessKey: authorizer.IAM.AccessKey,
+				AccountID: authorizer.IAM.AccountID,
+				CallerID:  authorizer.IAM.CallerID,
+				UserARN:   authorizer.IAM.UserARN,
+				UserID:    authorizer.IAM.UserID,
+			},
+		}
+	}
+	return converted
+}
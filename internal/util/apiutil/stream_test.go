@@ -0,0 +1,82 @@
+package apiutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected map[string]string
+		ok       bool
+	}{
+		{"/emails/{messageID}/raw", "/emails/exampleMessageID/raw", map[string]string{"messageID": "exampleMessageID"}, true},
+		{"/emails/{messageID}/raw", "/emails/exampleMessageID/raw/", map[string]string{"messageID": "exampleMessageID"}, true},
+		{"/emails/{messageID}/raw", "/emails/exampleMessageID/html", nil, false},
+		{"/emails/{messageID}/raw", "/emails//raw", nil, false},
+		{"/emails/{messageID}/raw", "/emails/exampleMessageID/raw/extra", nil, false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			params, ok := MatchPath(test.pattern, test.path)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, params)
+		})
+	}
+}
+
+func TestNewStreamingErrorResponse(t *testing.T) {
+	resp := NewStreamingErrorResponse(404, "email not found")
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Headers["Content-Type"])
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, NewErrorResponse(404, "email not found").Body, string(body))
+}
+
+func TestStreamCaller(t *testing.T) {
+	req := events.LambdaFunctionURLRequest{}
+	assert.Equal(t, "", StreamCaller(req))
+
+	req.RequestContext.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{
+		IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{
+			CallerID: "AIDAEXAMPLE",
+			UserARN:  "arn:aws:iam::123456789012:user/ops",
+		},
+	}
+	assert.Equal(t, "arn:aws:iam::123456789012:user/ops", StreamCaller(req))
+}
+
+func TestWithStreamAccessLog(t *testing.T) {
+	defer func() { env.AccessLogPolicy = "" }()
+
+	expectedErr := errors.New("handler error")
+	handler := WithStreamAccessLog(func(_ context.Context, _ events.LambdaFunctionURLRequest) (*StreamingResponse, error) {
+		return NewStreamingResponse(200, strings.NewReader("body"), "message/rfc822", "inline", ""), expectedErr
+	})
+
+	req := events.LambdaFunctionURLRequest{}
+	req.RequestContext.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{
+		IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{
+			UserARN: "arn:aws:iam::123456789012:user/example",
+		},
+	}
+	for _, policy := range []string{"", AccessLogOff, AccessLogFull} {
+		env.AccessLogPolicy = policy
+		resp, err := handler(context.TODO(), req)
+		assert.Equal(t, expectedErr, err)
+		assert.Equal(t, 200, resp.StatusCode)
+	}
+	assert.Equal(t, "arn:aws:iam::123456789012:user/example", Caller(apiGatewayRequest(req)))
+}
@@ -0,0 +1,124 @@
+// Package arf parses feedback reports of ISP feedback loops in the Abuse Reporting Format (RFC 5965)
+package arf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// ErrNotReport is returned when an email isn't a feedback report
+var ErrNotReport = errors.New("email is not a feedback report")
+
+// Report is a feedback report, which describes an email that a recipient complained about
+type Report struct {
+	FeedbackType      string   // e.g. abuse, fraud, virus, other
+	UserAgent         string   // software that generated the report
+	ArrivalDate       string   // when the original email was received, as reported
+	SourceIP          string   // IP address the original email was received from
+	OriginalMailFrom  string   // envelope sender of the original email
+	OriginalRcptTo    []string // envelope recipients of the original email, which may be redacted
+	OriginalMessageID string   // Message-ID header of the original email
+	OriginalTo        []string // To addresses of the original email
+}
+
+// Complainants returns the recipients who complained, i.e. the envelope recipients,
+// or the To addresses of the original email if the report doesn't include them
+func (r Report) Complainants() []string {
+	if len(r.OriginalRcptTo) > 0 {
+		return r.OriginalRcptTo
+	}
+	return r.OriginalTo
+}
+
+// IsReport returns true if contentType is the Content-Type of a feedback report
+func IsReport(contentType string) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "multipart/report" && strings.EqualFold(params["report-type"], "feedback-report")
+}
+
+// Parse parses a raw email as a feedback report, and returns ErrNotReport if it isn't one
+func Parse(raw []byte) (*Report, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	contentType := msg.Header.Get("Content-Type")
+	if !IsReport(contentType) {
+		return nil, ErrNotReport
+	}
+	_, params, _ := mime.ParseMediaType(contentType)
+
+	report := &Report{}
+	found := false
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch mediaType {
+		case "message/feedback-report":
+			err = parseFeedback(part, report)
+			found = true
+		case "message/rfc822", "text/rfc822-headers":
+			err = parseOriginal(part, report)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !found {
+		return nil, ErrNotReport
+	}
+	return report, nil
+}
+
+// parseFeedback parses the machine-readable part of a report, whose fields are in the format of headers
+func parseFeedback(r io.Reader, report *Report) error {
+	header, err := textproto.NewReader(bufio.NewReader(r)).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	report.FeedbackType = strings.ToLower(header.Get("Feedback-Type"))
+	report.UserAgent = header.Get("User-Agent")
+	report.ArrivalDate = header.Get("Arrival-Date")
+	report.SourceIP = header.Get("Source-IP")
+	report.OriginalMailFrom = trimAddress(header.Get("Original-Mail-From"))
+	for _, rcpt := range header.Values("Original-Rcpt-To") {
+		if address := trimAddress(rcpt); address != "" {
+			report.OriginalRcptTo = append(report.OriginalRcptTo, address)
+		}
+	}
+	return nil
+}
+
+// parseOriginal parses the headers of the original email, whose body may be omitted
+func parseOriginal(r io.Reader, report *Report) error {
+	header, err := textproto.NewReader(bufio.NewReader(r)).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	report.OriginalMessageID = strings.TrimSpace(header.Get("Message-Id"))
+	if to, err := mail.ParseAddressList(header.Get("To")); err == nil {
+		for _, address := range to {
+			report.OriginalTo = append(report.OriginalTo, address.Address)
+		}
+	}
+	return nil
+}
+
+// trimAddress removes the angle brackets around an address, e.g. <user@example.com>
+func trimAddress(address string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(address), "<"), ">")
+}
@@ -0,0 +1,94 @@
+package arf
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const report = `From: <abuse@isp.example>
+To: <abuse@example.com>
+Subject: FW: Hello
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=feedback-report;
+  boundary="part1"
+
+--part1
+Content-Type: text/plain; charset="US-ASCII"
+
+This is an email abuse report for an email message received from IP 192.0.2.1.
+
+--part1
+Content-Type: message/feedback-report
+
+Feedback-Type: abuse
+User-Agent: SomeGenerator/1.0
+Version: 1
+Original-Mail-From: <bounce@example.com>
+Original-Rcpt-To: <user@isp.example>
+Arrival-Date: Thu, 8 Mar 2005 14:00:00 EDT
+Source-IP: 192.0.2.1
+
+--part1
+Content-Type: %s
+
+From: <sender@example.com>
+To: User <user@isp.example>, other@isp.example
+Subject: Hello
+Message-ID: <0100018f-abc@us-west-2.amazonses.com>
+
+Hello
+--part1--
+`
+
+func TestParse(t *testing.T) {
+	for i, contentType := range []string{"message/rfc822", "text/rfc822-headers"} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			raw := strings.ReplaceAll(strings.Replace(report, "%s", contentType, 1), "\n", "\r\n")
+			result, err := Parse([]byte(raw))
+			assert.Nil(t, err)
+			assert.Equal(t, &Report{
+				FeedbackType:      "abuse",
+				UserAgent:         "SomeGenerator/1.0",
+				ArrivalDate:       "Thu, 8 Mar 2005 14:00:00 EDT",
+				SourceIP:          "192.0.2.1",
+				OriginalMailFrom:  "bounce@example.com",
+				OriginalRcptTo:    []string{"user@isp.example"},
+				OriginalMessageID: "<0100018f-abc@us-west-2.amazonses.com>",
+				OriginalTo:        []string{"user@isp.example", "other@isp.example"},
+			}, result)
+			assert.Equal(t, []string{"user@isp.example"}, result.Complainants())
+		})
+	}
+}
+
+func TestParse_Redacted(t *testing.T) {
+	raw := strings.Replace(strings.Replace(report, "Original-Rcpt-To: <user@isp.example>\n", "", 1), "%s", "message/rfc822", 1)
+	result, err := Parse([]byte(raw))
+	assert.Nil(t, err)
+	assert.Nil(t, result.OriginalRcptTo)
+	assert.Equal(t, []string{"user@isp.example", "other@isp.example"}, result.Complainants())
+}
+
+func TestParse_NotReport(t *testing.T) {
+	tests := []string{
+		"From: <a@example.com>\nContent-Type: text/plain\n\nHello\n",
+		"From: <a@example.com>\nContent-Type: multipart/report; report-type=delivery-status; boundary=b\n\n--b\nContent-Type: text/plain\n\nHello\n--b--\n",
+		"From: <a@example.com>\nContent-Type: multipart/report; report-type=feedback-report; boundary=b\n\n--b\nContent-Type: text/plain\n\nHello\n--b--\n",
+	}
+	for i, raw := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			_, err := Parse([]byte(raw))
+			assert.Equal(t, ErrNotReport, err)
+		})
+	}
+}
+
+func TestIsReport(t *testing.T) {
+	assert.True(t, IsReport(`multipart/report; report-type="feedback-report"; boundary=x`))
+	assert.True(t, IsReport(`multipart/report; report-type=Feedback-Report; boundary=x`))
+	assert.False(t, IsReport(`multipart/report; report-type=delivery-status; boundary=x`))
+	assert.False(t, IsReport(`text/plain`))
+}
@@ -98,7 +98,7 @@ func DecodeAttributeValueBS(src []byte) (types.AttributeValue, error) {
 	value := bytes.TrimPrefix(src, []byte("{\"BS\":["))
 	value = bytes.TrimSuffix(value, []byte("]}"))
 
-	sources := bytes.Split(value, []byte{','})
+	sources := splitElements(value)
 	results := make([][]byte, len(sources))
 	for i, b := range sources {
 		if len(b) < 1 || b[0] != '"' || b[len(b)-1] != '"' {
@@ -126,7 +126,7 @@ func DecodeAttributeValueL(src []byte) (types.AttributeValue, error) {
 	value := bytes.TrimPrefix(src, []byte("{\"L\":["))
 	value = bytes.TrimSuffix(value, []byte("]}"))
 
-	sources := bytes.Split(value, []byte{','})
+	sources := splitElements(value)
 	results := make([]types.AttributeValue, len(sources))
 
 	var err error
@@ -147,7 +147,7 @@ func DecodeAttributeValueM(src []byte) (types.AttributeValue, error) {
 	value := bytes.TrimPrefix(src, []byte("{\"M\":{"))
 	value = bytes.TrimSuffix(value, []byte("}}"))
 
-	sources := bytes.Split(value, []byte{','})
+	sources := splitElements(value)
 	results := make(map[string]types.AttributeValue, len(sources))
 
 	for _, item := range sources {
@@ -191,7 +191,7 @@ func DecodeAttributeValueNS(src []byte) (types.AttributeValue, error) {
 	value := bytes.TrimPrefix(src, []byte("{\"NS\":["))
 	value = bytes.TrimSuffix(value, []byte("]}"))
 
-	sources := bytes.Split(value, []byte{','})
+	sources := splitElements(value)
 	results := make([]string, len(sources))
 
 	for i, item := range sources {
@@ -235,7 +235,7 @@ func DecodeAttributeValueSS(src []byte) (types.AttributeValue, error) {
 	value := bytes.TrimPrefix(src, []byte("{\"SS\":["))
 	value = bytes.TrimSuffix(value, []byte("]}"))
 
-	sources := bytes.Split(value, []byte{','})
+	sources := splitElements(value)
 	results := make([]string, len(sources))
 
 	for i, item := range sources {
@@ -248,3 +248,27 @@ func DecodeAttributeValueSS(src []byte) (types.AttributeValue, error) {
 
 	return &types.AttributeValueMemberSS{Value: results}, nil
 }
+
+// splitElements splits the comma separated elements of a list, set or map,
+// ignoring commas inside strings and nested values
+func splitElements(src []byte) [][]byte {
+	var elements [][]byte
+	inString := false
+	depth := 0
+	start := 0
+	for i, c := range src {
+		switch {
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			elements = append(elements, src[start:i])
+			start = i + 1
+		}
+	}
+	return append(elements, src[start:])
+}
@@ -65,6 +65,25 @@ func TestDecodeAttributeValue(t *testing.T) {
 			in:       []byte("{\"SS\":[\"foo\",\"bar\"]}"),
 			expected: &types.AttributeValueMemberSS{Value: []string{"foo", "bar"}},
 		},
+		{
+			in:       []byte("{\"SS\":[\"foo,bar\",\"baz\"]}"),
+			expected: &types.AttributeValueMemberSS{Value: []string{"foo,bar", "baz"}},
+		},
+		{
+			in: []byte("{\"M\":{\"foo\":{\"S\":\"bar,baz\"},\"list\":{\"L\":[{\"S\":\"a,b\"},{\"M\":{\"x\":{\"N\":\"1\"},\"y\":{\"N\":\"2\"}}}]}}}"),
+			expected: &types.AttributeValueMemberM{
+				Value: map[string]types.AttributeValue{
+					"foo": &types.AttributeValueMemberS{Value: "bar,baz"},
+					"list": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+						&types.AttributeValueMemberS{Value: "a,b"},
+						&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+							"x": &types.AttributeValueMemberN{Value: "1"},
+							"y": &types.AttributeValueMemberN{Value: "2"},
+						}},
+					}},
+				},
+			},
+		},
 
 		/* errors */
 
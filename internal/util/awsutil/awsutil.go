@@ -0,0 +1,63 @@
+// Package awsutil shares the AWS SDK config and service clients across invocations of a Lambda function.
+// They are created on first use, so that a cold start only pays for the clients its invocation needs.
+package awsutil
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// loadDefaultConfig loads the SDK config, which is replaced during testing
+var loadDefaultConfig = func(ctx context.Context) (aws.Config, error) {
+	return config.LoadDefaultConfig(ctx, config.WithRegion(env.Region))
+}
+
+var (
+	configMu sync.Mutex
+	cfg      *aws.Config
+)
+
+// LoadConfig returns the SDK config in AWS_REGION, which is loaded on the first call and reused by later invocations.
+// Failures are not kept, so the next call loads it again.
+func LoadConfig(ctx context.Context) (aws.Config, error) {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	if cfg == nil {
+		loaded, err := loadDefaultConfig(ctx)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		cfg = &loaded
+	}
+	return *cfg, nil
+}
+
+// Client is a service client that is created on first use and reused by later invocations
+type Client[C any] struct {
+	once      sync.Once
+	newClient func(aws.Config) C
+	client    C
+}
+
+// NewClient returns a lazily created service client, e.g. NewClient(s3.NewFromConfig), which is created with optFns.
+// Declaring clients where they are used keeps service packages out of the functions that don't use them.
+func NewClient[C, O any](newFromConfig func(aws.Config, ...func(*O)) C, optFns ...func(*O)) *Client[C] {
+	return &Client[C]{
+		newClient: func(cfg aws.Config) C {
+			return newFromConfig(cfg, optFns...)
+		},
+	}
+}
+
+// Get returns the client, which is created from cfg on the first call
+func (c *Client[C]) Get(cfg aws.Config) C {
+	c.once.Do(func() {
+		c.client = c.newClient(cfg)
+	})
+	return c.client
+}
@@ -0,0 +1,67 @@
+package awsutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	oldLoad := loadDefaultConfig
+	calls := 0
+	loadErr := errors.New("error")
+	loadDefaultConfig = func(_ context.Context) (aws.Config, error) {
+		calls++
+		if calls == 1 {
+			return aws.Config{}, loadErr
+		}
+		return aws.Config{Region: "us-west-2"}, nil
+	}
+	defer func() {
+		cfg = nil
+		loadDefaultConfig = oldLoad
+	}()
+
+	_, err := LoadConfig(context.TODO())
+	assert.Equal(t, loadErr, err)
+
+	for i := 0; i < 2; i++ {
+		loaded, err := LoadConfig(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, "us-west-2", loaded.Region)
+	}
+	assert.Equal(t, 2, calls)
+}
+
+type mockOptions struct {
+	retries int
+}
+
+type mockClient struct {
+	region  string
+	retries int
+}
+
+func TestClient(t *testing.T) {
+	created := 0
+	newClient := func(cfg aws.Config, optFns ...func(*mockOptions)) *mockClient {
+		created++
+		var o mockOptions
+		for _, fn := range optFns {
+			fn(&o)
+		}
+		return &mockClient{region: cfg.Region, retries: o.retries}
+	}
+	client := NewClient(newClient, func(o *mockOptions) { o.retries = 5 })
+	assert.Equal(t, 0, created)
+
+	first := client.Get(aws.Config{Region: "us-west-2"})
+	second := client.Get(aws.Config{Region: "us-east-1"})
+	assert.Equal(t, 1, created)
+	assert.Same(t, first, second)
+	assert.Equal(t, "us-west-2", second.region)
+	assert.Equal(t, 5, second.retries)
+}
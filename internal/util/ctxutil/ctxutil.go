@@ -0,0 +1,49 @@
+// Package ctxutil limits operations with timeouts configured by environment variables, e.g. HOOK_TIMEOUT,
+// so that a hung dependency fails its operation instead of using up the timeout of the Lambda invocation.
+package ctxutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Timeout parses a configured timeout, which is a positive Go duration, e.g. 10s.
+// def is returned if value is empty or invalid.
+func Timeout(value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		fmt.Printf("invalid timeout %q, using %s\n", value, def)
+		return def
+	}
+	return timeout
+}
+
+// WithTimeout returns a copy of ctx that's done after the configured timeout, see Timeout.
+// The deadline of ctx still applies if it's earlier.
+func WithTimeout(ctx context.Context, value string, def time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, Timeout(value, def))
+}
+
+// CancelOnClose returns body that calls cancel once it's closed,
+// for streams that are read after the function opening them with a timeout returns
+func CancelOnClose(body io.ReadCloser, cancel context.CancelFunc) io.ReadCloser {
+	return &cancelCloser{ReadCloser: body, cancel: cancel}
+}
+
+type cancelCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func (c *cancelCloser) Close() error {
+	err := c.ReadCloser.Close()
+	c.once.Do(c.cancel)
+	return err
+}
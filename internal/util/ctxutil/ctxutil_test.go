@@ -0,0 +1,60 @@
+package ctxutil
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "", expected: 5 * time.Second},
+		{value: "2s", expected: 2 * time.Second},
+		{value: "500ms", expected: 500 * time.Millisecond},
+		{value: "0s", expected: 5 * time.Second},
+		{value: "-1s", expected: 5 * time.Second},
+		{value: "10", expected: 5 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			assert.Equal(t, test.expected, Timeout(test.value, 5*time.Second))
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), "1ms", time.Minute)
+	defer cancel()
+	<-ctx.Done()
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+
+	// the earlier deadline of the parent applies
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Second)
+	defer cancelParent()
+	ctx, cancel = WithTimeout(parent, "1h", time.Minute)
+	defer cancel()
+	parentDeadline, _ := parent.Deadline()
+	deadline, _ := ctx.Deadline()
+	assert.Equal(t, parentDeadline, deadline)
+}
+
+func TestCancelOnClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	body := CancelOnClose(io.NopCloser(strings.NewReader("body")), cancel)
+
+	content, err := io.ReadAll(body)
+	assert.Nil(t, err)
+	assert.Equal(t, "body", string(content))
+	assert.Nil(t, ctx.Err())
+
+	assert.Nil(t, body.Close())
+	assert.Equal(t, context.Canceled, ctx.Err())
+	assert.Nil(t, body.Close())
+}
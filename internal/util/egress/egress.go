@@ -0,0 +1,154 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Errors
+var (
+	ErrSchemeNotAllowed = errors.New("egress denied: only http and https are allowed")
+	ErrHostNotAllowed   = errors.New("egress denied: host is not in the allowlist")
+	ErrPrivateAddress   = errors.New("egress denied: private address")
+)
+
+// Policy decides which hosts server-initiated HTTP requests may reach.
+// It protects against SSRF, where URLs from emails or webhook configurations point to internal services,
+// e.g. the instance metadata endpoint.
+type Policy struct {
+	// AllowedHosts are the allowed host names, where *.example.com matches any subdomain of example.com.
+	// Any host is allowed if it's empty.
+	AllowedHosts []string
+	// AllowPrivate allows loopback, private, link-local and other non-public addresses
+	AllowPrivate bool
+}
+
+// FromEnv returns the policy configured by EGRESS_ALLOWLIST and EGRESS_ALLOW_PRIVATE
+func FromEnv() Policy {
+	var policy Policy
+	for _, host := range strings.Split(env.EgressAllowlist, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			policy.AllowedHosts = append(policy.AllowedHosts, host)
+		}
+	}
+	policy.AllowPrivate = env.EgressAllowPrivate == "true"
+	return policy
+}
+
+// CheckURL returns an error if the scheme or host of u isn't allowed.
+// Addresses are checked when connecting, since host names may resolve to private addresses.
+func (p Policy) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrSchemeNotAllowed
+	}
+	if !p.hostAllowed(u.Hostname()) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, u.Hostname())
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !p.addrAllowed(addr) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, addr)
+	}
+	return nil
+}
+
+func (p Policy) hostAllowed(host string) bool {
+	if len(p.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range p.AllowedHosts {
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// cgnat is the shared address space of carrier-grade NAT, which isn't covered by netip.Addr.IsPrivate
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+func (p Policy) addrAllowed(addr netip.Addr) bool {
+	if p.AllowPrivate {
+		return true
+	}
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !cgnat.Contains(addr)
+}
+
+// control is used as net.Dialer.Control, which checks the resolved address right before connecting,
+// so that DNS rebinding can't bypass the policy
+func (p Policy) control(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !p.addrAllowed(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// Apply enforces the policy on client, which must use an *http.Transport.
+// The proxy of the transport, if any, is configured by the operator and is exempted from address checks.
+// Redirects are checked against the allowlist too.
+func (p Policy) Apply(client *http.Client) {
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	checked := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: p.control}
+	proxy := transport.Proxy
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if proxy != nil && isProxyAddress(proxy, address) {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return checked.DialContext(ctx, network, address)
+	}
+	client.Transport = transport
+
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := p.CheckURL(req.URL); err != nil {
+			return err
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+// isProxyAddress returns true if address is the host:port of the proxy that proxy returns for requests to it
+func isProxyAddress(proxy func(*http.Request) (*url.URL, error), address string) bool {
+	req := &http.Request{URL: &url.URL{Scheme: "https", Host: address}}
+	proxyURL, err := proxy(req)
+	if err != nil || proxyURL == nil {
+		return false
+	}
+	port := proxyURL.Port()
+	if port == "" {
+		port = "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port) == address
+}
@@ -0,0 +1,112 @@
+package egress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromEnv(t *testing.T) {
+	defer func() {
+		env.EgressAllowlist = ""
+		env.EgressAllowPrivate = ""
+	}()
+
+	env.EgressAllowlist = " Hooks.example.com, *.example.org,,"
+	env.EgressAllowPrivate = "true"
+	assert.Equal(t, Policy{
+		AllowedHosts: []string{"hooks.example.com", "*.example.org"},
+		AllowPrivate: true,
+	}, FromEnv())
+
+	env.EgressAllowlist = ""
+	env.EgressAllowPrivate = ""
+	assert.Equal(t, Policy{}, FromEnv())
+}
+
+func TestPolicy_CheckURL(t *testing.T) {
+	allowlist := Policy{AllowedHosts: []string{"hooks.example.com", "*.example.org"}}
+
+	tests := []struct {
+		policy      Policy
+		url         string
+		expectedErr error
+	}{
+		{Policy{}, "https://hooks.example.com/webhook", nil},
+		{Policy{}, "http://93.184.216.34/", nil},
+		{Policy{}, "ftp://hooks.example.com/", ErrSchemeNotAllowed},
+		{Policy{}, "file:///etc/passwd", ErrSchemeNotAllowed},
+		{Policy{}, "http://127.0.0.1:8080/", ErrPrivateAddress},
+		{Policy{}, "http://10.0.0.1/", ErrPrivateAddress},
+		{Policy{}, "http://192.168.1.1/", ErrPrivateAddress},
+		{Policy{}, "http://100.64.0.1/", ErrPrivateAddress},
+		{Policy{}, "http://169.254.169.254/latest/meta-data/", ErrPrivateAddress},
+		{Policy{}, "http://0.0.0.0/", ErrPrivateAddress},
+		{Policy{}, "http://[::1]/", ErrPrivateAddress},
+		{Policy{}, "http://[fd00::1]/", ErrPrivateAddress},
+		{Policy{}, "http://[::ffff:127.0.0.1]/", ErrPrivateAddress},
+		{Policy{AllowPrivate: true}, "http://127.0.0.1:8080/", nil},
+		{allowlist, "https://hooks.example.com/webhook", nil},
+		{allowlist, "https://HOOKS.example.com./webhook", nil},
+		{allowlist, "https://api.example.org/webhook", nil},
+		{allowlist, "https://example.org/webhook", ErrHostNotAllowed},
+		{allowlist, "https://example.com/webhook", ErrHostNotAllowed},
+		{allowlist, "https://hooks.example.com.attacker.com/", ErrHostNotAllowed},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			u, err := url.Parse(test.url)
+			assert.Nil(t, err)
+			err = test.policy.CheckURL(u)
+			if test.expectedErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorIs(t, err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestPolicy_Apply(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/redirect" {
+			http.Redirect(rw, req, "http://metadata.internal/", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+
+	// host names resolving to private addresses are denied when connecting
+	client := &http.Client{}
+	Policy{}.Apply(client)
+	_, err = client.Get("http://localhost:" + serverURL.Port())
+	assert.ErrorIs(t, err, ErrPrivateAddress)
+
+	client = &http.Client{}
+	Policy{AllowPrivate: true}.Apply(client)
+	res, err := client.Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res.Body.Close()
+
+	// redirects are checked against the allowlist
+	client = &http.Client{}
+	Policy{AllowedHosts: []string{"127.0.0.1"}, AllowPrivate: true}.Apply(client)
+	_, err = client.Get(server.URL + "/redirect")
+	assert.ErrorIs(t, err, ErrHostNotAllowed)
+
+	// the proxy is trusted
+	client = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(serverURL)}}
+	Policy{}.Apply(client)
+	res, err = client.Get("http://hooks.example.com/")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res.Body.Close()
+}
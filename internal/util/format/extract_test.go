@@ -2,6 +2,7 @@ package format
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -29,6 +30,10 @@ func TestExtractTypeYearMonth(t *testing.T) {
 		{"sent#999-01", "", "", ErrInvalidEmailYear},
 		{"sent#2021-00", "", "", ErrInvalidEmailMonth},
 		{"sent#2021-13", "", "", ErrInvalidEmailMonth},
+		{"sent#+2021-01", "", "", ErrInvalidEmailYear},
+		{"sent#12021-01", "", "", ErrInvalidEmailYear},
+		{"sent#2021-1", "", "", ErrInvalidEmailMonth},
+		{"sent#2021-+1", "", "", ErrInvalidEmailMonth},
 		{"invalid#2021-01", "", "", ErrInvalidEmailType},
 	}
 
@@ -39,3 +44,25 @@ func TestExtractTypeYearMonth(t *testing.T) {
 		assert.Equal(t, test.err, err)
 	}
 }
+
+// FuzzExtractTypeYearMonth checks that every accepted string is a partition key that TypeYearMonth produces
+func FuzzExtractTypeYearMonth(f *testing.F) {
+	f.Add("inbox#2021-01")
+	f.Add("thread#9999-12")
+	f.Add("sent#+2021-01")
+	f.Add("draft#2021-1")
+	f.Add("inbox#2021-01#")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		emailType, yearMonth, err := ExtractTypeYearMonth(s)
+		if err != nil {
+			return
+		}
+
+		parsed, err := time.Parse("2006-01", yearMonth)
+		assert.Nil(t, err)
+		typeYearMonth, err := TypeYearMonth(emailType, parsed)
+		assert.Nil(t, err)
+		assert.Equal(t, s, typeYearMonth)
+	})
+}
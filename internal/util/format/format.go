@@ -2,9 +2,13 @@ package format
 
 import (
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"net/mail"
 	"strings"
 	"time"
+
+	"github.com/harryzcy/mailbox/internal/env"
 )
 
 // Errors
@@ -16,6 +20,7 @@ var (
 )
 
 // Date formats Date from SMTP headers to RFC3399, as it's used by DynamoDB.
+// The time is converted to the configured time zone, if any, otherwise the original offset is kept.
 //
 // TODO: date from Gmail produce an error
 func Date(date string) string {
@@ -23,6 +28,9 @@ func Date(date string) string {
 	if err != nil {
 		return ""
 	}
+	if env.TimeZone != "" {
+		t = t.In(Location())
+	}
 	return t.Format(time.RFC3339)
 }
 
@@ -37,16 +45,64 @@ func TypeYearMonth(emailType string, t time.Time) (string, error) {
 		return "", ErrInvalidEmailType
 	}
 
-	return emailType + "#" + t.UTC().Format("2006-01"), nil
+	return emailType + "#" + t.In(BucketLocation()).Format("2006-01"), nil
 }
 
-// DateTime converts time.Time to dd-hh:mm:ss
-func DateTime(t time.Time) string {
-	return t.UTC().Format("02-15:04:05")
+// DateTime converts time.Time to a sort key in the format of dd-hh:mm:ss.sss#tiebreaker in UTC,
+// or dd-epoch-hh:mm:ss.sss±hh:mm#tiebreaker if partitions are bucketed in another time zone,
+// where epoch is the Unix time in milliseconds, zero-padded to 15 digits, so that keys of the hour repeated
+// when clocks fall back are still in the order of time.
+// The tiebreaker is derived from id, so that emails with the same time are sorted consistently.
+//
+// Keys stored by previous versions are in the format of dd-hh:mm:ss, or dd-hh:mm:ss.sss±hh:mm#tiebreaker
+// in another time zone, and are still supported by RejoinDate.
+func DateTime(t time.Time, id string) string {
+	loc := BucketLocation()
+	if loc == time.UTC {
+		return t.UTC().Format("02-15:04:05.000") + "#" + tiebreaker(id)
+	}
+	local := t.In(loc)
+	return fmt.Sprintf("%s-%0*d-%s#%s", local.Format("02"), epochDigits, t.UnixMilli(), local.Format("15:04:05.000-07:00"), tiebreaker(id))
 }
 
-// RejoinDate converts year-month and date-time to RFC3399
+// epochDigits is the width of the epoch of DateTime keys, enough for times before year 9999
+const epochDigits = 15
+
+// trimEpoch removes the epoch of a DateTime key without the tiebreaker, if any
+func trimEpoch(dt string) string {
+	const start = len("02-")
+	end := start + epochDigits
+	if len(dt) <= end || dt[end] != '-' {
+		return dt
+	}
+	for i := start; i < end; i++ {
+		if dt[i] < '0' || dt[i] > '9' {
+			return dt
+		}
+	}
+	return dt[:start] + dt[end+1:]
+}
+
+// tiebreaker returns a short hash of id, which has a fixed length to keep keys sortable
+func tiebreaker(id string) string {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// RejoinDate converts year-month and date-time to RFC3399 in the configured time zone,
+// with fractional seconds if present. Date-times without offsets are in UTC.
 func RejoinDate(ym string, dt string) string {
-	dt = strings.Replace(dt, "-", "T", 1)
-	return ym + "-" + dt + "Z"
+	dt, _, _ = strings.Cut(dt, "#")
+	dt = strings.Replace(trimEpoch(dt), "-", "T", 1)
+	date := ym + "-" + dt
+	if len(dt) < len("02T15:04:05") || !strings.ContainsAny(dt[len("02T15:04:05"):], "+-Z") {
+		date += "Z"
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return date
+	}
+	return t.In(Location()).Format(time.RFC3339Nano)
 }
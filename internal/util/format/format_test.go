@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/harryzcy/mailbox/internal/env"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -77,24 +78,37 @@ func TestTypeYearMonth(t *testing.T) {
 func TestDateTime(t *testing.T) {
 	tests := []struct {
 		emailTime time.Time
+		id        string
 		expected  string
 	}{
 		{
-			time.Date(2022, 3, 10, 21, 57, 52, 0, time.UTC),
-			"10-21:57:52",
+			time.Date(2022, 3, 10, 21, 57, 52, 0, time.UTC), "a",
+			"10-21:57:52.000#" + tiebreaker("a"),
 		},
 		{
-			time.Date(2021, 9, 10, 21, 00, 00, 0, time.UTC),
-			"10-21:00:00",
+			time.Date(2021, 9, 10, 21, 00, 00, 123456789, time.UTC), "a",
+			"10-21:00:00.123#" + tiebreaker("a"),
 		},
 	}
 
 	for _, test := range tests {
-		actual := DateTime(test.emailTime)
+		actual := DateTime(test.emailTime, test.id)
 		assert.Equal(t, test.expected, actual)
 	}
 }
 
+func TestDateTime_Order(t *testing.T) {
+	received := time.Date(2022, 3, 10, 21, 57, 52, 0, time.UTC)
+
+	// emails received in the same second are ordered by milliseconds
+	assert.Less(t, DateTime(received, "b"), DateTime(received.Add(time.Millisecond), "a"))
+	// emails received in the same millisecond have different keys
+	assert.NotEqual(t, DateTime(received, "a"), DateTime(received, "b"))
+	// keys are stable
+	assert.Equal(t, DateTime(received, "a"), DateTime(received, "a"))
+	assert.Len(t, tiebreaker("a"), 8)
+}
+
 func TestRejoinDate(t *testing.T) {
 	tests := []struct {
 		ym       string
@@ -103,6 +117,10 @@ func TestRejoinDate(t *testing.T) {
 	}{
 		{"2022-03", "10-21:00:00", "2022-03-10T21:00:00Z"},
 		{"2021-09", "10-21:57:52", "2021-09-10T21:57:52Z"},
+		{"2021-09", "10-21:57:52.000#0a1b2c3d", "2021-09-10T21:57:52Z"},
+		{"2021-09", "10-21:57:52.120#0a1b2c3d", "2021-09-10T21:57:52.12Z"},
+		{"2021-09", "10-21:57:52.120+08:00#0a1b2c3d", "2021-09-10T13:57:52.12Z"},
+		{"2021-09", "10-001631282272120-21:57:52.120+08:00#0a1b2c3d", "2021-09-10T13:57:52.12Z"},
 	}
 
 	for _, test := range tests {
@@ -110,3 +128,166 @@ func TestRejoinDate(t *testing.T) {
 		assert.Equal(t, test.expected, actual)
 	}
 }
+
+func TestTimeZone(t *testing.T) {
+	defer func() {
+		env.TimeZone = ""
+		env.TimeZoneMode = ""
+	}()
+
+	// 2022-02-28T20:30:00Z is 2022-03-01T04:30:00+08:00
+	received := time.Date(2022, 2, 28, 20, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		timeZone      string
+		mode          string
+		typeYearMonth string
+		dateTime      string
+		rejoined      string
+		date          string
+	}{
+		{
+			timeZone:      "",
+			typeYearMonth: "inbox#2022-02",
+			dateTime:      "28-20:30:00.000#" + tiebreaker("a"),
+			rejoined:      "2022-02-28T20:30:00Z",
+			date:          "2012-11-30T06:02:48-07:00",
+		},
+		{
+			timeZone:      "Asia/Shanghai",
+			typeYearMonth: "inbox#2022-03",
+			dateTime:      "01-001646080200000-04:30:00.000+08:00#" + tiebreaker("a"),
+			rejoined:      "2022-03-01T04:30:00+08:00",
+			date:          "2012-11-30T21:02:48+08:00",
+		},
+		{
+			timeZone:      "Asia/Shanghai",
+			mode:          TimeZoneModeDisplay,
+			typeYearMonth: "inbox#2022-02",
+			dateTime:      "28-20:30:00.000#" + tiebreaker("a"),
+			rejoined:      "2022-03-01T04:30:00+08:00",
+			date:          "2012-11-30T21:02:48+08:00",
+		},
+		{
+			timeZone:      "Invalid/Zone",
+			typeYearMonth: "inbox#2022-02",
+			dateTime:      "28-20:30:00.000#" + tiebreaker("a"),
+			rejoined:      "2022-02-28T20:30:00Z",
+			date:          "2012-11-30T13:02:48Z",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			env.TimeZone = test.timeZone
+			env.TimeZoneMode = test.mode
+
+			typeYearMonth, err := TypeYearMonth("inbox", received)
+			assert.Nil(t, err)
+			assert.Equal(t, test.typeYearMonth, typeYearMonth)
+
+			dateTime := DateTime(received, "a")
+			assert.Equal(t, test.dateTime, dateTime)
+			assert.Equal(t, test.rejoined, RejoinDate(typeYearMonth[len("inbox#"):], dateTime))
+
+			assert.Equal(t, test.date, Date("Fri, 30 Nov 2012 06:02:48 -0700"))
+		})
+	}
+}
+
+func TestDateTime_FallBack(t *testing.T) {
+	defer func() { env.TimeZone = "" }()
+	env.TimeZone = "America/New_York"
+
+	// clocks fall back from 02:00 EDT to 01:00 EST on 2022-11-06, so 01:10 EST is after 01:30 EDT
+	edt := time.Date(2022, 11, 6, 5, 30, 0, 0, time.UTC)
+	est := time.Date(2022, 11, 6, 6, 10, 0, 0, time.UTC)
+	assert.Equal(t, "06-001667712600000-01:30:00.000-04:00#"+tiebreaker("a"), DateTime(edt, "a"))
+	assert.Equal(t, "06-001667715000000-01:10:00.000-05:00#"+tiebreaker("a"), DateTime(est, "a"))
+	assert.Less(t, DateTime(edt, "a"), DateTime(est, "a"))
+	assert.Equal(t, "2022-11-06T01:10:00-05:00", RejoinDate("2022-11", DateTime(est, "a")))
+}
+
+func TestRejoinDate_OldFormat(t *testing.T) {
+	defer func() { env.TimeZone = "" }()
+
+	// keys stored before the time zone is configured are in UTC
+	env.TimeZone = "America/New_York"
+	assert.Equal(t, "2022-03-10T16:00:00-05:00", RejoinDate("2022-03", "10-21:00:00"))
+	// and keys stored in the time zone before the epoch was added keep their offset
+	assert.Equal(t, "2022-03-10T16:00:00-05:00", RejoinDate("2022-03", "10-16:00:00.000-05:00#0a1b2c3d"))
+}
+
+// fuzzTimeZones are the time zones that fuzz tests run in, with and without daylight saving time
+var fuzzTimeZones = []string{"", "Asia/Shanghai", "Asia/Kolkata", "America/Phoenix", "America/New_York", "Australia/Lord_Howe"}
+
+// fuzzTime returns the time of millis since the Unix epoch, wrapped to before year 9999 as partition keys have 4 digit years.
+// Earlier times aren't covered, since time zones used local mean time with offsets in seconds before 1900.
+func fuzzTime(millis int64) time.Time {
+	start := time.Unix(0, 0).UTC()
+	end := time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	span := end.Sub(start).Milliseconds()
+	millis %= span
+	if millis < 0 {
+		millis += span
+	}
+	return start.Add(time.Duration(millis) * time.Millisecond)
+}
+
+func FuzzTypeYearMonth(f *testing.F) {
+	f.Add(int64(0), uint8(0), uint8(0))
+	f.Add(int64(1646949472000), uint8(1), uint8(1))
+	f.Add(int64(-1), uint8(2), uint8(3))
+
+	emailTypes := []string{"inbox", "sent", "draft", "thread"}
+	f.Fuzz(func(t *testing.T, millis int64, typeIndex, zoneIndex uint8) {
+		defer func() { env.TimeZone = "" }()
+		env.TimeZone = fuzzTimeZones[int(zoneIndex)%len(fuzzTimeZones)]
+
+		emailTime := fuzzTime(millis)
+		emailType := emailTypes[int(typeIndex)%len(emailTypes)]
+		typeYearMonth, err := TypeYearMonth(emailType, emailTime)
+		assert.Nil(t, err)
+
+		actualType, yearMonth, err := ExtractTypeYearMonth(typeYearMonth)
+		assert.Nil(t, err)
+		assert.Equal(t, emailType, actualType)
+		assert.Equal(t, emailTime.In(BucketLocation()).Format("2006-01"), yearMonth)
+	})
+}
+
+// FuzzDateTime checks that DateTime keys in a partition are in the order of time, and are rejoined to the time
+func FuzzDateTime(f *testing.F) {
+	f.Add(int64(1646949472000), int64(1), "a", "b", uint8(0))
+	f.Add(int64(1646949472000), int64(0), "a", "b", uint8(1))
+	f.Add(int64(1646085600000), int64(3600000), "b", "a", uint8(2))
+
+	f.Fuzz(func(t *testing.T, millis, deltaMillis int64, idA, idB string, zoneIndex uint8) {
+		defer func() { env.TimeZone = "" }()
+		env.TimeZone = fuzzTimeZones[int(zoneIndex)%len(fuzzTimeZones)]
+
+		a := fuzzTime(millis).Add(123456 * time.Nanosecond) // sub-millisecond part is truncated
+		b := a.Add(time.Duration(deltaMillis%(31*24*3600*1000)) * time.Millisecond)
+		partitionA, _ := TypeYearMonth("inbox", a)
+		partitionB, _ := TypeYearMonth("inbox", b)
+		if partitionA != partitionB {
+			return
+		}
+
+		keyA, keyB := DateTime(a, idA), DateTime(b, idB)
+		switch {
+		case a.Truncate(time.Millisecond).Before(b.Truncate(time.Millisecond)):
+			assert.Less(t, keyA, keyB)
+		case b.Truncate(time.Millisecond).Before(a.Truncate(time.Millisecond)):
+			assert.Less(t, keyB, keyA)
+		case idA != idB && tiebreaker(idA) != tiebreaker(idB):
+			assert.NotEqual(t, keyA, keyB)
+		default:
+			assert.Equal(t, keyA, keyB)
+		}
+
+		rejoined, err := time.Parse(time.RFC3339Nano, RejoinDate(partitionA[len("inbox#"):], keyA))
+		assert.Nil(t, err)
+		assert.Equal(t, a.Truncate(time.Millisecond).UTC(), rejoined.UTC())
+	})
+}
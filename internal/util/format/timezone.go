@@ -0,0 +1,46 @@
+package format
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	_ "time/tzdata" // Lambda runtimes may not include the time zone database
+
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+// Values of env.TimeZoneMode
+const (
+	// TimeZoneModeBucket uses the time zone for TypeYearMonth partitions, DateTime keys and displayed times
+	TimeZoneModeBucket = "bucket"
+	// TimeZoneModeDisplay keeps partitions and keys in UTC and only uses the time zone for displayed times,
+	// which is compatible with data stored before the time zone is configured
+	TimeZoneModeDisplay = "display"
+)
+
+var locations sync.Map // time zone name -> *time.Location
+
+// Location returns the configured time zone of the mailbox, or UTC if it's not configured or invalid
+func Location() *time.Location {
+	if env.TimeZone == "" {
+		return time.UTC
+	}
+	if loc, ok := locations.Load(env.TimeZone); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(env.TimeZone)
+	if err != nil {
+		fmt.Printf("invalid time zone %q, falling back to UTC, %v\n", env.TimeZone, err)
+		loc = time.UTC
+	}
+	locations.Store(env.TimeZone, loc)
+	return loc
+}
+
+// BucketLocation returns the time zone used for TypeYearMonth partitions and DateTime keys
+func BucketLocation() *time.Location {
+	if env.TimeZoneMode == TimeZoneModeDisplay {
+		return time.UTC
+	}
+	return Location()
+}
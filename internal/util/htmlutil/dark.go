@@ -0,0 +1,278 @@
+package htmlutil
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Colors of the wrapper of dark mode, used where the email doesn't set its own
+const (
+	darkBackground = "#121212"
+	darkText       = "#e6e6e6"
+	darkLink       = "#8ab4f8"
+)
+
+// darkStyle is added to the head of dark mode HTML.
+// The color-scheme lets clients render scrollbars and form controls dark as well.
+const darkStyle = `:root { color-scheme: dark; }
+body { background-color: ` + darkBackground + ` !important; color: ` + darkText + `; }
+a { color: ` + darkLink + `; }`
+
+// colorDeclarationPattern matches CSS declarations of colors, with the property in the first group and the value in the second
+var colorDeclarationPattern = regexp.MustCompile(`(?i)\b(background-color|background|color|border-color|border)\s*:\s*([^;}]+)`)
+
+// colorPattern matches hex, rgb(a), and the named colors that commonly hard-code light backgrounds or dark text
+var colorPattern = regexp.MustCompile(`(?i)#[0-9a-f]{3,8}\b|rgba?\([^)]*\)|\b(white|whitesmoke|snow|ivory|ghostwhite|floralwhite|linen|seashell|aliceblue|azure|honeydew|mintcream|black)\b`)
+
+var namedColors = map[string]string{
+	"white":       "#ffffff",
+	"whitesmoke":  "#f5f5f5",
+	"snow":        "#fffafa",
+	"ivory":       "#fffff0",
+	"ghostwhite":  "#f8f8ff",
+	"floralwhite": "#fffaf0",
+	"linen":       "#faf0e6",
+	"seashell":    "#fff5ee",
+	"aliceblue":   "#f0f8ff",
+	"azure":       "#f0ffff",
+	"honeydew":    "#f0fff0",
+	"mintcream":   "#f5fffa",
+	"black":       "#000000",
+}
+
+// DarkMode returns the html adjusted for dark backgrounds, for newsletters that hard-code light colors.
+// Light backgrounds are darkened and dark text is lightened, keeping their hues,
+// while mid-tone colors such as brand colors and images are kept.
+// The content is wrapped in a dark container, and the result is sanitized, see Sanitize.
+func DarkMode(content string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	sanitizeNode(doc)
+	darkenNode(doc)
+
+	head := findElement(doc, atom.Head)
+	body := findElement(doc, atom.Body)
+	if head == nil || body == nil {
+		// html.Parse always adds the head and body
+		return render(doc)
+	}
+	head.AppendChild(&html.Node{
+		Type:     html.ElementNode,
+		DataAtom: atom.Meta,
+		Data:     "meta",
+		Attr:     []html.Attribute{{Key: "name", Val: "color-scheme"}, {Key: "content", Val: "dark"}},
+	})
+	style := &html.Node{Type: html.ElementNode, DataAtom: atom.Style, Data: "style"}
+	style.AppendChild(&html.Node{Type: html.TextNode, Data: darkStyle})
+	head.AppendChild(style)
+
+	wrapper := &html.Node{
+		Type:     html.ElementNode,
+		DataAtom: atom.Div,
+		Data:     "div",
+		Attr:     []html.Attribute{{Key: "style", Val: "background-color: " + darkBackground + "; color: " + darkText + ";"}},
+	}
+	for c := body.FirstChild; c != nil; {
+		next := c.NextSibling
+		body.RemoveChild(c)
+		wrapper.AppendChild(c)
+		c = next
+	}
+	body.AppendChild(wrapper)
+	return render(doc)
+}
+
+// darkenNode adjusts the colors of the descendants of n
+func darkenNode(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case html.ElementNode:
+			for i, attr := range c.Attr {
+				switch strings.ToLower(attr.Key) {
+				case "style":
+					c.Attr[i].Val = darkenCSS(attr.Val)
+				case "bgcolor":
+					c.Attr[i].Val = adjustColor(attr.Val, true)
+				case "color", "text":
+					// color of font elements, and text of body elements
+					c.Attr[i].Val = adjustColor(attr.Val, false)
+				}
+			}
+		case html.TextNode:
+			if n.DataAtom == atom.Style {
+				c.Data = darkenCSS(c.Data)
+			}
+		}
+		darkenNode(c)
+	}
+}
+
+// darkenCSS adjusts the colors of the declarations in a style sheet or an inline style
+func darkenCSS(css string) string {
+	return colorDeclarationPattern.ReplaceAllStringFunc(css, func(declaration string) string {
+		match := colorDeclarationPattern.FindStringSubmatch(declaration)
+		property := strings.ToLower(match[1])
+		background := property != "color"
+		value := colorPattern.ReplaceAllStringFunc(match[2], func(color string) string {
+			return adjustColor(color, background)
+		})
+		return declaration[:len(declaration)-len(match[2])] + value
+	})
+}
+
+// adjustColor darkens a light background color, or lightens a dark text color.
+// Colors that are already legible on a dark background, and values that aren't colors, are returned as is.
+func adjustColor(value string, background bool) string {
+	r, g, b, alpha, ok := parseColor(value)
+	if !ok {
+		return value
+	}
+	h, s, l := rgbToHSL(r, g, b)
+	switch {
+	case background && l > 0.6:
+		l = math.Max(1-l, 0.07)
+	case !background && l < 0.4:
+		l = math.Min(1-l, 0.9)
+	default:
+		return value
+	}
+	r, g, b = hslToRGB(h, s, l)
+	if alpha < 1 {
+		return fmt.Sprintf("rgba(%d, %d, %d, %s)", r, g, b, strconv.FormatFloat(alpha, 'f', -1, 64))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+// parseColor parses hex, rgb(a), and the named colors of colorPattern
+func parseColor(value string) (r, g, b int, alpha float64, ok bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if named, found := namedColors[value]; found {
+		value = named
+	}
+	alpha = 1
+
+	if hex, found := strings.CutPrefix(value, "#"); found {
+		switch len(hex) {
+		case 3, 4:
+			var expanded strings.Builder
+			for _, c := range hex {
+				expanded.WriteRune(c)
+				expanded.WriteRune(c)
+			}
+			hex = expanded.String()
+		case 6, 8:
+		default:
+			return 0, 0, 0, 0, false
+		}
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return 0, 0, 0, 0, false
+		}
+		if len(hex) == 8 {
+			alpha = float64(n&0xff) / 255
+			n >>= 8
+		}
+		return int(n >> 16 & 0xff), int(n >> 8 & 0xff), int(n & 0xff), alpha, true
+	}
+
+	args, found := strings.CutPrefix(value, "rgba(")
+	if !found {
+		args, found = strings.CutPrefix(value, "rgb(")
+	}
+	if !found {
+		return 0, 0, 0, 0, false
+	}
+	parts := strings.FieldsFunc(strings.TrimSuffix(args, ")"), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '/'
+	})
+	if len(parts) != 3 && len(parts) != 4 {
+		return 0, 0, 0, 0, false
+	}
+	var channels [3]int
+	for i := range channels {
+		v, err := strconv.Atoi(parts[i])
+		if err != nil || v < 0 || v > 255 {
+			return 0, 0, 0, 0, false
+		}
+		channels[i] = v
+	}
+	if len(parts) == 4 {
+		a, err := strconv.ParseFloat(parts[3], 64)
+		if err != nil || a < 0 || a > 1 {
+			return 0, 0, 0, 0, false
+		}
+		alpha = a
+	}
+	return channels[0], channels[1], channels[2], alpha, true
+}
+
+func rgbToHSL(r, g, b int) (h, s, l float64) {
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	maxC := math.Max(rf, math.Max(gf, bf))
+	minC := math.Min(rf, math.Min(gf, bf))
+	l = (maxC + minC) / 2
+	if maxC == minC {
+		return 0, 0, l
+	}
+	d := maxC - minC
+	if l > 0.5 {
+		s = d / (2 - maxC - minC)
+	} else {
+		s = d / (maxC + minC)
+	}
+	switch maxC {
+	case rf:
+		h = (gf - bf) / d
+		if gf < bf {
+			h += 6
+		}
+	case gf:
+		h = (bf-rf)/d + 2
+	default:
+		h = (rf-gf)/d + 4
+	}
+	return h / 6, s, l
+}
+
+func hslToRGB(h, s, l float64) (r, g, b int) {
+	if s == 0 {
+		v := int(math.Round(l * 255))
+		return v, v, v
+	}
+	var q float64
+	if l < 0.5 {
+		q = l * (1 + s)
+	} else {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+	channel := func(t float64) int {
+		switch {
+		case t < 0:
+			t++
+		case t > 1:
+			t--
+		}
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 1.0/2:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return int(math.Round(v * 255))
+	}
+	return channel(h + 1.0/3), channel(h), channel(h - 1.0/3)
+}
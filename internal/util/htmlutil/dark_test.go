@@ -0,0 +1,77 @@
+package htmlutil
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDarkMode(t *testing.T) {
+	head := `<head><meta name="color-scheme" content="dark"/><style>` + darkStyle + `</style></head>`
+	wrapper := `<div style="background-color: ` + darkBackground + `; color: ` + darkText + `;">`
+	tests := []struct {
+		html     string
+		expected string
+	}{
+		{
+			html:     `<p>Text</p>`,
+			expected: `<html>` + head + `<body>` + wrapper + `<p>Text</p></div></body></html>`,
+		},
+		{
+			html: `<table bgcolor="#ffffff"><tr><td style="background-color: #FFF; color: #333333; padding: 8px">` +
+				`<font color="black">Text</font></td></tr></table>`,
+			expected: `<html>` + head + `<body>` + wrapper + `<table bgcolor="#121212"><tbody><tr>` +
+				`<td style="background-color: #121212; color: #cccccc; padding: 8px"><font color="#e6e6e6">Text</font></td>` +
+				`</tr></tbody></table></div></body></html>`,
+		},
+		{
+			// brand colors are kept
+			html:     `<a style="background: #1a73e8 url(button.png); color: white">Button</a>`,
+			expected: `<html>` + head + `<body>` + wrapper + `<a style="background: #1a73e8 url(button.png); color: white">Button</a></div></body></html>`,
+		},
+		{
+			html: `<head><style>.card { background-color: rgba(255, 255, 255, 0.5); }</style></head><body><div class="card">Text</div></body>`,
+			expected: `<html><head><style>.card { background-color: rgba(18, 18, 18, 0.5); }</style>` +
+				`<meta name="color-scheme" content="dark"/><style>` + darkStyle + `</style></head>` +
+				`<body>` + wrapper + `<div class="card">Text</div></div></body></html>`,
+		},
+		{
+			html:     `<p onclick="alert(1)">Text</p>`,
+			expected: `<html>` + head + `<body>` + wrapper + `<p>Text</p></div></body></html>`,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			result, err := DarkMode(test.html)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestAdjustColor(t *testing.T) {
+	tests := []struct {
+		value      string
+		background bool
+		expected   string
+	}{
+		{"#ffffff", true, "#121212"},
+		{"#fafafa", true, "#121212"},
+		{"#eef", true, "#000024"},
+		{"#000000", true, "#000000"},
+		{"#000000", false, "#e6e6e6"},
+		{"#ffffff", false, "#ffffff"},
+		{"rgb(255, 255, 255)", true, "#121212"},
+		{"#ffffff80", true, "rgba(18, 18, 18, 0.5019607843137255)"},
+		{"inherit", true, "inherit"},
+		{"#12345", true, "#12345"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, adjustColor(test.value, test.background))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package htmlutil
 
 import (
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,3 +28,30 @@ func TestGenerateText(t *testing.T) {
 		})
 	}
 }
+
+// newsletterHTML returns a newsletter-like HTML body with the given number of articles
+func newsletterHTML(articles int) string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html><head><style>td{padding:12px}</style></head><body><table>`)
+	for i := 0; i < articles; i++ {
+		n := strconv.Itoa(i)
+		b.WriteString(`<tr><td><a href="https://news.example.com/articles/` + n + `?utm_source=newsletter">` +
+			`<img src="https://cdn.example.com/img/` + n + `.png" alt="Article ` + n + `"></a></td>` +
+			`<td><h2>Article ` + n + `</h2><p>Lorem ipsum dolor sit amet, consectetur adipiscing elit, ` +
+			`sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.</p></td></tr>`)
+	}
+	b.WriteString(`</table></body></html>`)
+	return b.String()
+}
+
+func BenchmarkGenerateText(b *testing.B) {
+	html := newsletterHTML(400)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(html)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := GenerateText(html); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
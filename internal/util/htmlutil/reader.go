@@ -0,0 +1,185 @@
+package htmlutil
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// boilerplateElements are removed in reader mode, since they hold navigation or page chrome rather than content
+var boilerplateElements = map[atom.Atom]bool{
+	atom.Nav:    true,
+	atom.Header: true,
+	atom.Footer: true,
+	atom.Aside:  true,
+	atom.Style:  true,
+}
+
+// boilerplatePattern matches the class or id of elements holding boilerplate, e.g. unsubscribe footers and social links
+var boilerplatePattern = regexp.MustCompile(`(?i)(^|[\s_-])(preheader|footer|unsubscribe|social|share|sharing|nav|navbar|menu|sidebar|banner|sponsor|advert|ads?|promo|legal|disclaimer|view-?in-?browser)($|[\s_-])`)
+
+// hiddenPattern matches inline styles of elements that aren't displayed, e.g. preheaders shown only in previews
+var hiddenPattern = regexp.MustCompile(`(?i)display\s*:\s*none|visibility\s*:\s*hidden|max-height\s*:\s*0[^.\d]`)
+
+// minContentLength is the length of text a container must have to be picked as the main content
+const minContentLength = 200
+
+// ReaderMode returns the main content of the html, without boilerplate such as headers, footers, navigation,
+// tracking pixels, and hidden preheaders. The result is sanitized, see Sanitize, and has no styles.
+func ReaderMode(content string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	sanitizeNode(doc)
+	stripBoilerplate(doc)
+
+	mainContent := findMainContent(doc)
+	body := findElement(doc, atom.Body)
+	if mainContent != nil && body != nil && mainContent != body {
+		mainContent.Parent.RemoveChild(mainContent)
+		for c := body.FirstChild; c != nil; {
+			next := c.NextSibling
+			body.RemoveChild(c)
+			c = next
+		}
+		switch mainContent.DataAtom {
+		case atom.Tbody, atom.Thead, atom.Tfoot, atom.Tr, atom.Td, atom.Th:
+			// cells of layout tables are invalid outside of their table
+			mainContent.DataAtom, mainContent.Data = atom.Div, "div"
+		}
+		body.AppendChild(mainContent)
+	}
+	return render(doc)
+}
+
+// stripBoilerplate removes boilerplate descendants of n, and the presentational attributes of the rest
+func stripBoilerplate(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && isBoilerplate(c) {
+			n.RemoveChild(c)
+		} else {
+			if c.Type == html.ElementNode {
+				c.Attr = readerAttributes(c.Attr)
+			}
+			stripBoilerplate(c)
+		}
+		c = next
+	}
+}
+
+func isBoilerplate(n *html.Node) bool {
+	if boilerplateElements[n.DataAtom] {
+		return true
+	}
+	if n.DataAtom == atom.Img && isTrackingPixel(n) {
+		return true
+	}
+	for _, attr := range n.Attr {
+		switch strings.ToLower(attr.Key) {
+		case "class", "id":
+			if boilerplatePattern.MatchString(attr.Val) {
+				return true
+			}
+		case "style":
+			if hiddenPattern.MatchString(attr.Val + " ") {
+				return true
+			}
+		case "hidden", "aria-hidden":
+			if !strings.EqualFold(attr.Val, "false") {
+				return true
+			}
+		case "role":
+			if strings.EqualFold(attr.Val, "navigation") || strings.EqualFold(attr.Val, "banner") || strings.EqualFold(attr.Val, "contentinfo") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isTrackingPixel reports whether an image is too small to be seen, which is usually used to track opens
+func isTrackingPixel(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		key := strings.ToLower(attr.Key)
+		if (key == "width" || key == "height") && (attr.Val == "0" || attr.Val == "1") {
+			return true
+		}
+	}
+	return false
+}
+
+// readerAttributes returns the attributes that are kept in reader mode, dropping layout and styles
+func readerAttributes(attrs []html.Attribute) []html.Attribute {
+	kept := attrs[:0]
+	for _, attr := range attrs {
+		switch strings.ToLower(attr.Key) {
+		case "href", "src", "alt", "title", "colspan", "rowspan", "lang", "dir":
+			kept = append(kept, attr)
+		}
+	}
+	return kept
+}
+
+// findMainContent returns the element with the main content of a document.
+// It's the article or main element if there's one, otherwise the innermost container that holds most of the text.
+func findMainContent(doc *html.Node) *html.Node {
+	if n := findElement(doc, atom.Article); n != nil {
+		return n
+	}
+	if n := findElement(doc, atom.Main); n != nil {
+		return n
+	}
+
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return nil
+	}
+	total := textLength(body)
+	if total < minContentLength {
+		return body
+	}
+	// descend while a single child holds most of the text, e.g. the content cell of nested layout tables
+	n := body
+	for {
+		var best *html.Node
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && textLength(c)*10 >= total*8 {
+				best = c
+				break
+			}
+		}
+		if best == nil {
+			return n
+		}
+		n = best
+	}
+}
+
+// findElement returns the first element of type a in n, in depth-first order
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// textLength returns the length of the text in n, ignoring whitespace
+func textLength(n *html.Node) int {
+	if n.Type == html.TextNode {
+		return len(strings.Join(strings.Fields(n.Data), " "))
+	}
+	length := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		length += textLength(c)
+	}
+	return length
+}
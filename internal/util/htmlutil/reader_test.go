@@ -0,0 +1,48 @@
+package htmlutil
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderMode(t *testing.T) {
+	paragraph := strings.Repeat("Lorem ipsum dolor sit amet. ", 10)
+	tests := []struct {
+		html     string
+		expected string
+	}{
+		{
+			html: `<head><style>p{color:red}</style></head><body>` +
+				`<div style="display:none">Preheader</div>` +
+				`<header>Logo</header><p class="intro" style="color: red">Hello</p>` +
+				`<img src="https://t.example.com/open.gif" width="1" height="1">` +
+				`<div class="footer">Unsubscribe</div></body>`,
+			expected: `<html><head></head><body><p>Hello</p></body></html>`,
+		},
+		{
+			html:     `<body><nav>Home</nav><article><h1>Title</h1><p>Text</p></article><aside>Ads</aside></body>`,
+			expected: `<html><head></head><body><article><h1>Title</h1><p>Text</p></article></body></html>`,
+		},
+		{
+			// the content cell of a layout table
+			html: `<body><table><tr><td><a href="https://example.com">Logo</a></td></tr>` +
+				`<tr><td><p>` + paragraph + `</p></td></tr></table></body>`,
+			expected: `<html><head></head><body><p>` + paragraph + `</p></body></html>`,
+		},
+		{
+			html:     `<body><p onclick="alert(1)">Text</p><script>alert(1)</script></body>`,
+			expected: `<html><head></head><body><p>Text</p></body></html>`,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			result, err := ReaderMode(test.html)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package htmlutil
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// droppedElements are removed along with their content, since they run code, load other documents, or submit data
+var droppedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Noscript: true,
+	atom.Iframe:   true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Applet:   true,
+	atom.Base:     true,
+	atom.Link:     true,
+	atom.Meta:     true,
+	atom.Template: true,
+	atom.Form:     true,
+	atom.Input:    true,
+	atom.Button:   true,
+	atom.Select:   true,
+	atom.Textarea: true,
+}
+
+// urlAttributes are attributes whose values are URLs, which must not run code
+var urlAttributes = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"background": true,
+	"poster":     true,
+	"cite":       true,
+	"xlink:href": true,
+}
+
+// Sanitize returns the html without scripts, event handlers, embedded documents, forms, and AMP components.
+// Styles, images, and links are kept, so that the email looks the same when it's rendered.
+func Sanitize(content string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	sanitizeNode(doc)
+	return render(doc)
+}
+
+// sanitizeNode removes unsafe descendants and attributes of n
+func sanitizeNode(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			// conditional comments may contain markup for some clients
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode && (droppedElements[c.DataAtom] || isAMPElement(c)):
+			n.RemoveChild(c)
+		default:
+			if c.Type == html.ElementNode {
+				c.Attr = sanitizeAttributes(c.Attr)
+			}
+			sanitizeNode(c)
+		}
+		c = next
+	}
+}
+
+func sanitizeAttributes(attrs []html.Attribute) []html.Attribute {
+	kept := attrs[:0]
+	for _, attr := range attrs {
+		key := strings.ToLower(attr.Key)
+		switch {
+		case strings.HasPrefix(key, "on"), key == "srcdoc", key == "formaction":
+			continue
+		case key == "amp" || key == "amp4email" || strings.HasPrefix(key, "⚡"):
+			continue
+		case urlAttributes[key] && !isSafeURL(key, attr.Val):
+			continue
+		case key == "style" && !isSafeStyle(attr.Val):
+			continue
+		}
+		kept = append(kept, attr)
+	}
+	return kept
+}
+
+// isAMPElement reports whether n is an AMP component, e.g. amp-img or amp-carousel
+func isAMPElement(n *html.Node) bool {
+	return strings.HasPrefix(strings.ToLower(n.Data), "amp-")
+}
+
+// isSafeURL reports whether a URL can't run code when it's loaded or followed.
+// Data URLs are only allowed for images.
+func isSafeURL(key, value string) bool {
+	// browsers ignore whitespace and control characters in the scheme
+	scheme := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(value))
+	switch {
+	case strings.HasPrefix(scheme, "javascript:"), strings.HasPrefix(scheme, "vbscript:"):
+		return false
+	case strings.HasPrefix(scheme, "data:"):
+		return key == "src" && strings.HasPrefix(scheme, "data:image/") && !strings.HasPrefix(scheme, "data:image/svg")
+	}
+	return true
+}
+
+// isSafeStyle reports whether an inline style doesn't run code, as in legacy CSS expressions
+func isSafeStyle(value string) bool {
+	style := strings.ToLower(value)
+	return !strings.Contains(style, "expression(") && !strings.Contains(style, "javascript:") && !strings.Contains(style, "behavior:")
+}
+
+// render returns the HTML of a document
+func render(doc *html.Node) (string, error) {
+	var b bytes.Buffer
+	if err := html.Render(&b, doc); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,53 @@
+package htmlutil
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		html     string
+		expected string
+	}{
+		{
+			html:     `<p style="color: red">Title</p>`,
+			expected: `<html><head></head><body><p style="color: red">Title</p></body></html>`,
+		},
+		{
+			html:     `<p onclick="alert(1)">Title</p><script>alert(1)</script>`,
+			expected: `<html><head></head><body><p>Title</p></body></html>`,
+		},
+		{
+			html:     `<a href="javascript:alert(1)">link</a><a href=" JaVa&#x09;script:alert(1)">link</a><a href="https://example.com">link</a>`,
+			expected: `<html><head></head><body><a>link</a><a>link</a><a href="https://example.com">link</a></body></html>`,
+		},
+		{
+			html:     `<img src="data:image/png;base64,AAAA"><img src="data:text/html,<script>"><iframe src="https://example.com"></iframe>`,
+			expected: `<html><head></head><body><img src="data:image/png;base64,AAAA"/><img/></body></html>`,
+		},
+		{
+			// AMP components and attributes
+			html:     `<html amp4email><body><amp-img src="a.png"></amp-img><p>Text</p></body></html>`,
+			expected: `<html><head></head><body><p>Text</p></body></html>`,
+		},
+		{
+			html:     `<!--[if mso]><p>Outlook</p><![endif]--><form action="https://example.com"><input name="q"></form><p>Text</p>`,
+			expected: `<html><head></head><body><p>Text</p></body></html>`,
+		},
+		{
+			html:     `<div style="width: expression(alert(1))">Text</div>`,
+			expected: `<html><head></head><body><div>Text</div></body></html>`,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			result, err := Sanitize(test.html)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Package metrics writes CloudWatch metrics in the embedded metric format.
+// They are written to stdout as log lines, from which CloudWatch Logs extracts the metrics,
+// so no API call or permission is needed.
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// Namespace is the CloudWatch namespace of the metrics
+const Namespace = "Mailbox"
+
+// Units of metrics
+const (
+	UnitCount        = "Count"
+	UnitMilliseconds = "Milliseconds"
+)
+
+// Metric is a value of a metric
+type Metric struct {
+	Name  string
+	Unit  string
+	Value float64
+}
+
+// Count returns a count metric
+func Count(name string, value int) Metric {
+	return Metric{Name: name, Unit: UnitCount, Value: float64(value)}
+}
+
+// Duration returns a metric of d in milliseconds
+func Duration(name string, d time.Duration) Metric {
+	return Metric{Name: name, Unit: UnitMilliseconds, Value: float64(d.Microseconds()) / 1000}
+}
+
+var (
+	output io.Writer = os.Stdout
+	now              = time.Now
+)
+
+type metricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type directive struct {
+	Namespace  string             `json:"Namespace"`
+	Dimensions [][]string         `json:"Dimensions"`
+	Metrics    []metricDefinition `json:"Metrics"`
+}
+
+type metadata struct {
+	Timestamp         int64       `json:"Timestamp"`
+	CloudWatchMetrics []directive `json:"CloudWatchMetrics"`
+}
+
+// Emit writes the metrics with the given dimensions, e.g. {"Operation": "PutItem"}
+func Emit(dimensions map[string]string, metrics ...Metric) {
+	if len(metrics) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(dimensions))
+	for k := range dimensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	d := directive{Namespace: Namespace, Dimensions: [][]string{keys}}
+	line := map[string]interface{}{}
+	for k, v := range dimensions {
+		line[k] = v
+	}
+	for _, m := range metrics {
+		d.Metrics = append(d.Metrics, metricDefinition{Name: m.Name, Unit: m.Unit})
+		line[m.Name] = m.Value
+	}
+	line["_aws"] = metadata{
+		Timestamp:         now().UnixMilli(),
+		CloudWatchMetrics: []directive{d},
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		fmt.Printf("metrics marshal failed: %v\n", err)
+		return
+	}
+	fmt.Fprintln(output, string(data))
+}
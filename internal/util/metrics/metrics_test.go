@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmit(t *testing.T) {
+	var b bytes.Buffer
+	oldOutput, oldNow := output, now
+	output = &b
+	now = func() time.Time { return time.UnixMilli(1700000000000) }
+	defer func() {
+		output, now = oldOutput, oldNow
+	}()
+
+	Emit(map[string]string{"Operation": "PutItem"}, Count("Throttles", 1), Duration("Latency", 1500*time.Microsecond))
+	assert.JSONEq(t, `{
+		"_aws": {
+			"Timestamp": 1700000000000,
+			"CloudWatchMetrics": [{
+				"Namespace": "Mailbox",
+				"Dimensions": [["Operation"]],
+				"Metrics": [{"Name": "Throttles", "Unit": "Count"}, {"Name": "Latency", "Unit": "Milliseconds"}]
+			}]
+		},
+		"Operation": "PutItem",
+		"Throttles": 1,
+		"Latency": 1.5
+	}`, b.String())
+
+	b.Reset()
+	Emit(map[string]string{"Operation": "PutItem"})
+	assert.Empty(t, b.String())
+}
@@ -30,3 +30,22 @@ type MockTransactWriteItemAPI func(ctx context.Context, params *dynamodb.Transac
 func (m MockTransactWriteItemAPI) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
 	return m(ctx, params, optFns...)
 }
+
+type MockQueryAPI func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+
+func (m MockQueryAPI) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+type MockListThreadsAPI struct {
+	MockQuery        MockQueryAPI
+	MockBatchGetItem func(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+}
+
+func (m MockListThreadsAPI) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return m.MockQuery(ctx, params, optFns...)
+}
+
+func (m MockListThreadsAPI) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	return m.MockBatchGetItem(ctx, params, optFns...)
+}
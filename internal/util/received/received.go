@@ -0,0 +1,114 @@
+package received
+
+import (
+	"net"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/harryzcy/mailbox/internal/types"
+)
+
+// ipLiteral matches address literals such as [192.0.2.1] or [IPv6:2001:db8::1]
+var ipLiteral = regexp.MustCompile(`\[(?:IPv6:)?([0-9a-fA-F:.]+)\]`)
+
+// Parse parses the values of Received headers into a delivery path.
+// The headers are expected in the order they appear in the email, i.e. the most recent hop first.
+// The returned hops are ordered from the origin to the final destination.
+func Parse(headers []string) types.Hops {
+	hops := make(types.Hops, 0, len(headers))
+	times := make([]time.Time, 0, len(headers))
+	for i := len(headers) - 1; i >= 0; i-- {
+		hop, t := parseHeader(headers[i])
+		hops = append(hops, hop)
+		times = append(times, t)
+	}
+
+	for i := 1; i < len(hops); i++ {
+		if times[i].IsZero() || times[i-1].IsZero() {
+			continue
+		}
+		hops[i].Delay = int64(times[i].Sub(times[i-1]).Seconds())
+	}
+	return hops
+}
+
+// parseHeader parses a single Received header value,
+// e.g. "from a.example.com (a.example.com [192.0.2.1]) by b.example.com with SMTP id abc; Tue, 12 Mar 2024 10:10:10 +0000"
+func parseHeader(value string) (types.Hop, time.Time) {
+	value = strings.Join(strings.Fields(value), " ") // unfold
+
+	var hop types.Hop
+	var t time.Time
+	clauses := value
+	if i := strings.LastIndex(value, ";"); i >= 0 {
+		clauses = value[:i]
+		t = parseDate(value[i+1:])
+		if !t.IsZero() {
+			hop.Timestamp = t.UTC().Format(time.RFC3339)
+		}
+	}
+
+	sections := splitClauses(clauses)
+	hop.From = firstToken(sections["from"])
+	hop.By = firstToken(sections["by"])
+	hop.With = firstToken(sections["with"])
+
+	if match := ipLiteral.FindStringSubmatch(sections["from"]); match != nil {
+		hop.IP = match[1]
+	} else if ip := net.ParseIP(strings.Trim(hop.From, "[]")); ip != nil {
+		hop.IP = ip.String()
+	}
+	return hop, t
+}
+
+// splitClauses splits the clauses of a Received header by their keywords.
+// Keywords inside comments are ignored.
+func splitClauses(s string) map[string]string {
+	sections := make(map[string]string)
+	key := ""
+	depth := 0
+	for _, token := range strings.Fields(s) {
+		if depth == 0 {
+			switch lower := strings.ToLower(token); lower {
+			case "from", "by", "via", "with", "id", "for":
+				key = lower
+				continue
+			}
+		}
+		depth += strings.Count(token, "(") - strings.Count(token, ")")
+		if depth < 0 {
+			depth = 0
+		}
+
+		if key == "" {
+			continue
+		}
+		if sections[key] != "" {
+			sections[key] += " "
+		}
+		sections[key] += token
+	}
+	return sections
+}
+
+// firstToken returns the first token of a clause, excluding comments
+func firstToken(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "(") {
+		return ""
+	}
+	return fields[0]
+}
+
+var comment = regexp.MustCompile(`\([^)]*\)`)
+
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(comment.ReplaceAllString(s, ""))
+	t, err := mail.ParseDate(s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
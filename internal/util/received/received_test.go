@@ -0,0 +1,66 @@
+package received
+
+import (
+	"testing"
+
+	"github.com/harryzcy/mailbox/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		headers  []string
+		expected types.Hops
+	}{
+		{
+			headers:  nil,
+			expected: types.Hops{},
+		},
+		{
+			headers: []string{
+				"from mail-a.example.com (mail-a.example.com [192.0.2.1]) by inbound-smtp.us-west-2.amazonaws.com with SMTP id abc123 for user@example.com; Tue, 12 Mar 2024 10:10:15 +0000 (UTC)",
+				"by mail-a.example.com with SMTP id xyz\r\n        for <user@example.com>; Tue, 12 Mar 2024 03:10:10 -0700 (PDT)",
+			},
+			expected: types.Hops{
+				{
+					By:        "mail-a.example.com",
+					With:      "SMTP",
+					Timestamp: "2024-03-12T10:10:10Z",
+				},
+				{
+					From:      "mail-a.example.com",
+					By:        "inbound-smtp.us-west-2.amazonaws.com",
+					IP:        "192.0.2.1",
+					With:      "SMTP",
+					Timestamp: "2024-03-12T10:10:15Z",
+					Delay:     5,
+				},
+			},
+		},
+		{
+			headers: []string{
+				"from [2001:db8::1] (helo authenticated by relay) by b.example.com with ESMTPSA; invalid date",
+				"from [IPv6:2001:db8::2] by a.example.com; Tue, 12 Mar 2024 10:10:10 +0000",
+			},
+			expected: types.Hops{
+				{
+					From:      "[IPv6:2001:db8::2]",
+					By:        "a.example.com",
+					IP:        "2001:db8::2",
+					Timestamp: "2024-03-12T10:10:10Z",
+				},
+				{
+					From: "[2001:db8::1]",
+					By:   "b.example.com",
+					IP:   "2001:db8::1",
+					With: "ESMTPSA",
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		actual := Parse(test.headers)
+		assert.Equal(t, test.expected, actual)
+	}
+}
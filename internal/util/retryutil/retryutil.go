@@ -0,0 +1,134 @@
+// Package retryutil retries throttled DynamoDB requests with adaptive backoff, within a budget of each operation.
+// The SDK otherwise makes at most 3 attempts, which fails emails being received when the table is briefly throttled.
+package retryutil
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/harryzcy/mailbox/internal/util/metrics"
+)
+
+// Budget limits the retries of an operation
+type Budget struct {
+	MaxAttempts int           // attempts including the first one
+	MaxDuration time.Duration // time since the first attempt after which no retry is made
+}
+
+// DefaultBudget is the budget of operations that are not in Budgets
+var DefaultBudget = Budget{MaxAttempts: 5, MaxDuration: 2 * time.Second}
+
+// Budgets are the budgets of DynamoDB operations.
+// Writes get larger budgets, since they're made by the receive and send paths which can't ask the caller to retry,
+// while reads are mostly made by the API, whose clients retry on 429 Too Many Requests.
+var Budgets = map[string]Budget{
+	"PutItem":            {MaxAttempts: 8, MaxDuration: 5 * time.Second},
+	"UpdateItem":         {MaxAttempts: 8, MaxDuration: 5 * time.Second},
+	"DeleteItem":         {MaxAttempts: 8, MaxDuration: 5 * time.Second},
+	"TransactWriteItems": {MaxAttempts: 8, MaxDuration: 5 * time.Second},
+	"BatchWriteItem":     {MaxAttempts: 8, MaxDuration: 5 * time.Second},
+	"GetItem":            {MaxAttempts: 3, MaxDuration: 500 * time.Millisecond},
+	"Query":              {MaxAttempts: 3, MaxDuration: 500 * time.Millisecond},
+	"BatchGetItem":       {MaxAttempts: 4, MaxDuration: time.Second},
+}
+
+// maxBackoff is the longest delay between two attempts
+const maxBackoff = 2 * time.Second
+
+// Metrics of throttled requests, with the operation as the dimension
+const (
+	MetricThrottles       = "DynamoDBThrottles"       // attempts that are throttled
+	MetricBudgetExhausted = "DynamoDBBudgetExhausted" // requests that failed as their budget is used up
+)
+
+var throttles = retry.IsErrorThrottles(retry.DefaultThrottles)
+
+// retryer is shared by the DynamoDB clients of a process, so that they adapt their request rate together
+var retryer = newRetryer()
+
+// DynamoDB configures a DynamoDB client to retry with the shared retryer, e.g. awsutil.NewClient(dynamodb.NewFromConfig, retryutil.DynamoDB)
+func DynamoDB(o *dynamodb.Options) {
+	o.Retryer = retryer
+	o.APIOptions = append(o.APIOptions, addBudget)
+}
+
+// budgetedRetryer is an adaptive mode retryer, which slows down all requests after throttles,
+// and stops retrying a request once the budget of its operation is used up
+type budgetedRetryer struct {
+	*retry.AdaptiveMode
+}
+
+func newRetryer() budgetedRetryer {
+	maxAttempts := DefaultBudget.MaxAttempts
+	for _, budget := range Budgets {
+		if budget.MaxAttempts > maxAttempts {
+			maxAttempts = budget.MaxAttempts
+		}
+	}
+
+	return budgetedRetryer{
+		AdaptiveMode: retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, func(so *retry.StandardOptions) {
+				// the budgets limit the attempts of each operation, which are checked before this limit
+				so.MaxAttempts = maxAttempts + 1
+				so.MaxBackoff = maxBackoff
+				so.Backoff = retry.NewExponentialJitterBackoff(maxBackoff)
+			})
+		}),
+	}
+}
+
+// GetRetryToken counts a failed attempt against the budget of its request, and returns an error wrapping opErr once it's used up
+func (r budgetedRetryer) GetRetryToken(ctx context.Context, opErr error) (func(error) error, error) {
+	state, ok := ctx.Value(budgetKey{}).(*budgetState)
+	if !ok {
+		return r.AdaptiveMode.GetRetryToken(ctx, opErr)
+	}
+
+	state.attempts++
+	if throttles.IsErrorThrottle(opErr).Bool() {
+		metrics.Emit(map[string]string{"Operation": state.operation}, metrics.Count(MetricThrottles, 1))
+	}
+	if state.attempts >= state.budget.MaxAttempts || time.Since(state.start) >= state.budget.MaxDuration {
+		metrics.Emit(map[string]string{"Operation": state.operation}, metrics.Count(MetricBudgetExhausted, 1))
+		return nil, fmt.Errorf("retry budget of %s exhausted after %d attempts, %w", state.operation, state.attempts, opErr)
+	}
+	return r.AdaptiveMode.GetRetryToken(ctx, opErr)
+}
+
+var _ aws.RetryerV2 = budgetedRetryer{}
+
+type budgetKey struct{}
+
+// budgetState tracks the attempts of a request against its budget
+type budgetState struct {
+	operation string
+	budget    Budget
+	start     time.Time
+	attempts  int
+}
+
+// addBudget adds a middleware that starts tracking the budget of each request
+func addBudget(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("RetryBudget", func(
+		ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+	) (middleware.InitializeOutput, middleware.Metadata, error) {
+		operation := awsmiddleware.GetOperationName(ctx)
+		budget, ok := Budgets[operation]
+		if !ok {
+			budget = DefaultBudget
+		}
+		ctx = context.WithValue(ctx, budgetKey{}, &budgetState{
+			operation: operation,
+			budget:    budget,
+			start:     time.Now(),
+		})
+		return next.HandleInitialize(ctx, in)
+	}), middleware.After)
+}
@@ -0,0 +1,75 @@
+package retryutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+var errThrottled = &smithy.GenericAPIError{Code: "ProvisionedThroughputExceededException", Message: "throttled"}
+
+func TestBudgetedRetryer(t *testing.T) {
+	tests := []struct {
+		state       *budgetState
+		expectedErr bool
+	}{
+		{
+			state: &budgetState{operation: "PutItem", budget: Budget{MaxAttempts: 3, MaxDuration: time.Minute}, start: time.Now()},
+		},
+		{
+			state:       &budgetState{operation: "PutItem", budget: Budget{MaxAttempts: 3, MaxDuration: time.Minute}, start: time.Now(), attempts: 2},
+			expectedErr: true,
+		},
+		{
+			state:       &budgetState{operation: "GetItem", budget: Budget{MaxAttempts: 3, MaxDuration: time.Second}, start: time.Now().Add(-time.Minute)},
+			expectedErr: true,
+		},
+	}
+
+	r := newRetryer()
+	for _, test := range tests {
+		ctx := context.WithValue(context.TODO(), budgetKey{}, test.state)
+		release, err := r.GetRetryToken(ctx, errThrottled)
+		if test.expectedErr {
+			assert.Error(t, err)
+			// the error of the request is kept, e.g. to return too many requests
+			apiErr := new(smithy.GenericAPIError)
+			assert.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, "ProvisionedThroughputExceededException", apiErr.Code)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.NoError(t, release(nil))
+	}
+
+	assert.True(t, r.IsErrorRetryable(errThrottled))
+	assert.Greater(t, r.MaxAttempts(), Budgets["PutItem"].MaxAttempts)
+}
+
+func TestAddBudget(t *testing.T) {
+	stack := middleware.NewStack("test", func() interface{} { return nil })
+	err := stack.Initialize.Add(&awsmiddleware.RegisterServiceMetadata{ServiceID: "DynamoDB", OperationName: "GetItem"}, middleware.Before)
+	assert.NoError(t, err)
+	assert.NoError(t, addBudget(stack))
+
+	var state *budgetState
+	handler := middleware.HandlerFunc(func(ctx context.Context, _ interface{}) (interface{}, middleware.Metadata, error) {
+		state, _ = ctx.Value(budgetKey{}).(*budgetState)
+		return nil, middleware.Metadata{}, nil
+	})
+	_, _, err = middleware.DecorateHandler(handler, stack).Handle(context.TODO(), nil)
+	assert.NoError(t, err)
+	if assert.NotNil(t, state) {
+		assert.Equal(t, "GetItem", state.operation)
+		assert.Equal(t, Budgets["GetItem"], state.budget)
+	}
+}
+
+var _ aws.Retryer = retryer
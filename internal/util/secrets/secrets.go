@@ -0,0 +1,55 @@
+// Package secrets reads Secrets Manager secrets through the AWS Parameters and Secrets Lambda Extension,
+// which caches secrets so that they are not fetched from Secrets Manager on every cold start.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// ExtensionURL is the endpoint of the Lambda extension, which is replaced during testing
+var ExtensionURL = "http://localhost:" + extensionPort() + "/secretsmanager/get"
+
+func extensionPort() string {
+	if port := os.Getenv("PARAMETERS_SECRETS_EXTENSION_HTTP_PORT"); port != "" {
+		return port
+	}
+	return "2773"
+}
+
+// Get returns the string value of a Secrets Manager secret
+func Get(ctx context.Context, secretID string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		ExtensionURL+"?secretId="+url.QueryEscape(secretID), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Aws-Parameters-Secrets-Token", os.Getenv("AWS_SESSION_TOKEN"))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret %s: %w", secretID, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get secret %s: %s", secretID, res.Status)
+	}
+
+	var output struct {
+		SecretString string
+	}
+	if err := json.Unmarshal(body, &output); err != nil {
+		return "", fmt.Errorf("failed to get secret %s: %w", secretID, err)
+	}
+	return output.SecretString, nil
+}
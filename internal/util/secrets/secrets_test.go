@@ -0,0 +1,51 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	t.Setenv("AWS_SESSION_TOKEN", "session-token")
+	extension := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "session-token", req.Header.Get("X-Aws-Parameters-Secrets-Token"))
+		switch req.URL.Query().Get("secretId") {
+		case "example/secret":
+			err := json.NewEncoder(rw).Encode(map[string]string{"SecretString": "value"})
+			assert.Nil(t, err)
+		case "invalid":
+			_, err := rw.Write([]byte("invalid"))
+			assert.Nil(t, err)
+		default:
+			rw.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer extension.Close()
+	oldURL := ExtensionURL
+	ExtensionURL = extension.URL
+	defer func() { ExtensionURL = oldURL }()
+
+	tests := []struct {
+		secretID    string
+		expected    string
+		expectedErr bool
+	}{
+		{"example/secret", "value", false},
+		{"invalid", "", true},
+		{"missing", "", true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			value, err := Get(context.Background(), test.secretID)
+			assert.Equal(t, test.expectedErr, err != nil, err)
+			assert.Equal(t, test.expected, value)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package sniff
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// HeadSize is the number of bytes used to detect the content type
+const HeadSize = 512
+
+const (
+	TypeOctetStream = "application/octet-stream"
+	TypeWindowsExe  = "application/x-msdownload"
+	TypeELF         = "application/x-executable"
+	TypeMachO       = "application/x-mach-binary"
+	TypeShellScript = "text/x-shellscript"
+	TypeOLE         = "application/x-ole-storage"
+)
+
+// signatures are checked before http.DetectContentType, which doesn't recognize executables
+var signatures = []struct {
+	prefix    []byte
+	mediaType string
+}{
+	{[]byte("MZ"), TypeWindowsExe},
+	{[]byte("\x7fELF"), TypeELF},
+	{[]byte("\xfe\xed\xfa\xce"), TypeMachO},
+	{[]byte("\xfe\xed\xfa\xcf"), TypeMachO},
+	{[]byte("\xce\xfa\xed\xfe"), TypeMachO},
+	{[]byte("\xcf\xfa\xed\xfe"), TypeMachO},
+	{[]byte("#!"), TypeShellScript},
+	{[]byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), TypeOLE}, // legacy Office documents, msi
+}
+
+// Detect returns the media type of content, using at most the first HeadSize bytes.
+// Parameters, such as charset, are not included.
+func Detect(content []byte) string {
+	if len(content) > HeadSize {
+		content = content[:HeadSize]
+	}
+	for _, signature := range signatures {
+		if bytes.HasPrefix(content, signature.prefix) {
+			return signature.mediaType
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(content))
+	if err != nil {
+		return TypeOctetStream
+	}
+	return mediaType
+}
+
+// IsExecutable reports whether the media type is an executable or a script
+func IsExecutable(mediaType string) bool {
+	switch mediaType {
+	case TypeWindowsExe, TypeELF, TypeMachO, TypeShellScript,
+		"application/x-msdos-program", "application/x-dosexec", "application/vnd.microsoft.portable-executable":
+		return true
+	}
+	return false
+}
+
+// zipContainers are formats stored as zip archives, which are detected as application/zip
+var zipContainers = []string{
+	"application/vnd.openxmlformats-officedocument.",
+	"application/vnd.ms-word.", "application/vnd.ms-excel.", "application/vnd.ms-powerpoint.",
+	"application/vnd.oasis.opendocument.",
+	"application/epub+zip", "application/java-archive", "application/vnd.android.package-archive",
+	"application/x-zip-compressed",
+}
+
+// oleContainers are formats stored as OLE compound files
+var oleContainers = []string{
+	"application/msword", "application/vnd.ms-excel", "application/vnd.ms-powerpoint",
+	"application/vnd.ms-outlook", "application/x-msi", "application/x-ole-storage",
+}
+
+// IsMismatch reports whether the detected media type contradicts the declared content type or the filename extension.
+// Generic detections, such as plain text or octet stream, never mismatch since they carry no information.
+// An executable detected in a part that's neither declared nor named as one always mismatches.
+func IsMismatch(declared, filename, detected string) bool {
+	if detected == "" || detected == TypeOctetStream || detected == "text/plain" {
+		return false
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if IsExecutable(detected) && executableExtensions[ext] {
+		return false
+	}
+
+	var expected []string
+	for _, contentType := range []string{declared, mime.TypeByExtension(ext)} {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType != TypeOctetStream {
+			expected = append(expected, strings.ToLower(mediaType))
+		}
+	}
+	if len(expected) == 0 {
+		return IsExecutable(detected)
+	}
+	for _, mediaType := range expected {
+		if compatible(mediaType, detected) {
+			return false
+		}
+	}
+	return true
+}
+
+func compatible(expected, detected string) bool {
+	if expected == detected {
+		return true
+	}
+	switch detected {
+	case "application/zip":
+		return hasAnyPrefix(expected, zipContainers)
+	case TypeOLE:
+		return hasAnyPrefix(expected, oleContainers)
+	case "text/html", "text/xml":
+		// markup is often sent as plain text or under a more specific type
+		return strings.HasPrefix(expected, "text/") || strings.HasSuffix(expected, "+xml") || strings.HasSuffix(expected, "/xml")
+	case "image/jpeg":
+		return expected == "image/jpg" || expected == "image/pjpeg"
+	}
+	if IsExecutable(detected) {
+		return IsExecutable(expected)
+	}
+	return false
+}
+
+var executableExtensions = map[string]bool{
+	".exe": true, ".dll": true, ".com": true, ".scr": true, ".msi": true,
+	".bin": true, ".elf": true, ".so": true, ".dylib": true, ".app": true,
+	".sh": true, ".bash": true, ".command": true,
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
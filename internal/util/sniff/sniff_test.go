@@ -0,0 +1,59 @@
+package sniff
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"", "text/plain"},
+		{"MZ\x90\x00\x03\x00\x00\x00", TypeWindowsExe},
+		{"\x7fELF\x02\x01\x01", TypeELF},
+		{"#!/bin/sh\necho hi", TypeShellScript},
+		{"%PDF-1.7\n", "application/pdf"},
+		{"\x89PNG\r\n\x1a\n", "image/png"},
+		{"PK\x03\x04", "application/zip"},
+		{"\x00\x01\x02\x03", TypeOctetStream},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, Detect([]byte(test.content)))
+		})
+	}
+}
+
+func TestIsMismatch(t *testing.T) {
+	tests := []struct {
+		declared string
+		filename string
+		detected string
+		expected bool
+	}{
+		{"application/pdf", "report.pdf", "application/pdf", false},
+		{"application/pdf", "report.pdf", TypeWindowsExe, true},
+		{TypeOctetStream, "report.pdf", TypeWindowsExe, true},
+		{TypeOctetStream, "setup.exe", TypeWindowsExe, false},
+		{TypeOctetStream, "", TypeWindowsExe, true},
+		{TypeOctetStream, "", "application/pdf", false},
+		{"image/jpg", "photo.jpg", "image/jpeg", false},
+		{"image/png", "photo.png", "image/jpeg", true},
+		{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "a.docx", "application/zip", false},
+		{"application/msword", "a.doc", TypeOLE, false},
+		{"text/plain", "notes.txt", "text/plain", false},
+		{"text/plain", "page.html", "text/html", false},
+		{"application/pdf", "report.pdf", TypeOctetStream, false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, test.expected, IsMismatch(test.declared, test.filename, test.detected))
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package vacation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/datasource/mailer"
+	"github.com/harryzcy/mailbox/internal/env"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+)
+
+// maxHeaderLength is the maximum length of the value of a header of an email sent by SES
+const maxHeaderLength = 870
+
+// automaticSenders are the local parts of addresses that send automatic emails, which aren't replied to (RFC 5230)
+var automaticSenders = map[string]bool{
+	"mailer-daemon": true,
+	"postmaster":    true,
+	"listserv":      true,
+	"majordomo":     true,
+	"noreply":       true,
+	"no-reply":      true,
+	"donotreply":    true,
+	"do-not-reply":  true,
+}
+
+// Email is a received email to reply to
+type Email struct {
+	MessageID  string // Message-ID header of the email
+	References string // References header of the email
+	Subject    string
+	Sender     string // envelope sender, which the reply is sent to (RFC 3834)
+	Recipient  string // recipient that received the email, which the reply is sent from
+	Headers    mailboxTypes.Headers
+	Time       time.Time // time the email is received
+}
+
+// ReplyAPI defines set of API required to send an automatic reply to a received email
+type ReplyAPI interface {
+	api.GetItemAPI        // to get the settings
+	api.PutItemAPI        // to record the sender replied to
+	api.DeleteVacationAPI // to forget the sender if the reply can't be sent
+	mailer.SendEmailAPI   // to send the reply
+}
+
+// Reply sends the automatic reply to a received email if replies are enabled on the day it's received, and returns true if it's sent.
+// Each sender is replied to once per interval, and automatic emails aren't replied to, e.g. bounces, automatic replies,
+// or emails of mailing lists, so that replies don't loop between mailboxes (RFC 3834).
+func Reply(ctx context.Context, client ReplyAPI, email Email) (bool, error) {
+	settings, err := Get(ctx, client)
+	if err != nil {
+		if err == api.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	if !settings.active(email.Time) {
+		return false, nil
+	}
+	if reason := skipReason(email); reason != "" {
+		fmt.Printf("not replying automatically, %s\n", reason)
+		return false, nil
+	}
+
+	sender := strings.ToLower(email.Sender)
+	recorded, err := record(ctx, client, *settings, sender, email.Time)
+	if err != nil || !recorded {
+		return false, err
+	}
+	if err = send(ctx, client, *settings, email); err != nil {
+		// the sender is replied to if it sends another email
+		if forgetErr := forget(ctx, client, sender); forgetErr != nil {
+			fmt.Printf("failed to forget the sender of the automatic reply, %v\n", forgetErr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// skipReason returns why an email isn't replied to, or an empty string if it's replied to
+func skipReason(email Email) string {
+	sender := strings.ToLower(strings.TrimSpace(email.Sender))
+	local, _, ok := strings.Cut(sender, "@")
+	switch {
+	case !ok || local == "":
+		return "no envelope sender"
+	case strings.EqualFold(sender, email.Recipient):
+		return "sent by the recipient"
+	case automaticSenders[local], strings.HasPrefix(local, "owner-"), strings.HasSuffix(local, "-request"):
+		return "sent by an automatic sender"
+	}
+
+	for _, header := range email.Headers {
+		value := strings.ToLower(strings.TrimSpace(header.Value))
+		switch strings.ToLower(header.Name) {
+		case "auto-submitted":
+			if keyword(value) != "no" {
+				return "automatic email"
+			}
+		case "precedence":
+			switch keyword(value) {
+			case "bulk", "list", "junk":
+				return "bulk email"
+			}
+		case "list-id", "list-unsubscribe", "list-post":
+			return "email of a mailing list"
+		case "x-auto-response-suppress":
+			for _, option := range strings.Split(value, ",") {
+				switch strings.TrimSpace(option) {
+				case "all", "oof", "autoreply":
+					return "automatic replies are suppressed"
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// keyword returns the first word of a header value, before parameters and comments
+func keyword(value string) string {
+	value, _, _ = strings.Cut(value, ";")
+	value, _, _ = strings.Cut(value, "(")
+	return strings.TrimSpace(value)
+}
+
+// senderKey returns the key of the item recording when a sender is replied to
+func senderKey(sender string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"MessageID": &types.AttributeValueMemberS{Value: senderPrefix + sender},
+	}
+}
+
+// record records that a sender is replied to at t, and returns false if it's already replied to within the interval,
+// with the same settings
+func record(ctx context.Context, client api.PutItemAPI, settings Settings, sender string, t time.Time) (bool, error) {
+	item := senderKey(sender)
+	item["RepliedTime"] = &types.AttributeValueMemberS{Value: t.UTC().Format(time.RFC3339)}
+	item["SettingsUpdated"] = &types.AttributeValueMemberS{Value: settings.TimeUpdated}
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(env.TableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(MessageID) OR RepliedTime <= :since OR SettingsUpdated <> :updated"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":since":   &types.AttributeValueMemberS{Value: t.AddDate(0, 0, -settings.IntervalDays).UTC().Format(time.RFC3339)},
+			":updated": &types.AttributeValueMemberS{Value: settings.TimeUpdated},
+		},
+	})
+	if err != nil {
+		if apiErr := new(types.ConditionalCheckFailedException); errors.As(err, &apiErr) {
+			fmt.Println("not replying automatically, the sender is already replied to")
+			return false, nil
+		}
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return false, api.ErrTooManyRequests
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// forget removes the record of a sender, so that it's replied to again
+func forget(ctx context.Context, client api.DeleteVacationAPI, sender string) error {
+	_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(env.TableName),
+		Key:       senderKey(sender),
+	})
+	return err
+}
+
+// send sends the reply to the sender of the email, as the recipient that received it
+func send(ctx context.Context, client mailer.SendEmailAPI, settings Settings, email Email) error {
+	subject := settings.Subject
+	if subject == "" {
+		subject = strings.TrimSpace("Auto: " + email.Subject)
+	}
+	body := &sestypes.Body{
+		Text: &sestypes.Content{Data: aws.String(settings.Text), Charset: aws.String("UTF-8")},
+	}
+	if settings.HTML != "" {
+		body.Html = &sestypes.Content{Data: aws.String(settings.HTML), Charset: aws.String("UTF-8")}
+	}
+	headers := []sestypes.MessageHeader{
+		{Name: aws.String("Auto-Submitted"), Value: aws.String("auto-replied")},
+	}
+	if email.MessageID != "" && len(email.MessageID) <= maxHeaderLength {
+		headers = append(headers,
+			sestypes.MessageHeader{Name: aws.String("In-Reply-To"), Value: aws.String(email.MessageID)},
+			sestypes.MessageHeader{Name: aws.String("References"), Value: aws.String(references(email))},
+		)
+	}
+
+	_, err := client.SendEmail(ctx, &sesv2.SendEmailInput{
+		Content: &sestypes.EmailContent{
+			Simple: &sestypes.Message{
+				Body:    body,
+				Subject: &sestypes.Content{Data: aws.String(subject), Charset: aws.String("UTF-8")},
+				Headers: headers,
+			},
+		},
+		Destination: &sestypes.Destination{
+			ToAddresses: []string{email.Sender},
+		},
+		FromEmailAddress: aws.String(email.Recipient),
+	})
+	return err
+}
+
+// references returns the References header of the reply, which is the references of the email followed by its Message-ID.
+// The oldest references are dropped if the header is too long.
+func references(email Email) string {
+	ids := append(strings.Fields(email.References), email.MessageID)
+	value := strings.Join(ids, " ")
+	for len(value) > maxHeaderLength && len(ids) > 1 {
+		ids = ids[1:]
+		value = strings.Join(ids, " ")
+	}
+	return value
+}
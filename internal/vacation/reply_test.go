@@ -0,0 +1,172 @@
+package vacation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/clients"
+	mailboxTypes "github.com/harryzcy/mailbox/internal/types"
+)
+
+// mockVacationTable keeps the settings and the senders replied to, and the replies sent
+type mockVacationTable struct {
+	clients.Fake
+	items   map[string]map[string]types.AttributeValue
+	sent    []*sesv2.SendEmailInput
+	sendErr error
+}
+
+func newMockVacationTable(t *testing.T, settings Settings) *mockVacationTable {
+	item, err := attributevalue.MarshalMap(settings)
+	assert.Nil(t, err)
+	return &mockVacationTable{items: map[string]map[string]types.AttributeValue{itemID: item}}
+}
+
+func (m *mockVacationTable) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: m.items[params.Key["MessageID"].(*types.AttributeValueMemberS).Value]}, nil
+}
+
+func (m *mockVacationTable) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	key := params.Item["MessageID"].(*types.AttributeValueMemberS).Value
+	if saved, ok := m.items[key]; ok {
+		since := params.ExpressionAttributeValues[":since"].(*types.AttributeValueMemberS).Value
+		updated := params.ExpressionAttributeValues[":updated"].(*types.AttributeValueMemberS).Value
+		if saved["RepliedTime"].(*types.AttributeValueMemberS).Value > since && saved["SettingsUpdated"].(*types.AttributeValueMemberS).Value == updated {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	}
+	m.items[key] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockVacationTable) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	delete(m.items, params.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (m *mockVacationTable) SendEmail(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	if m.sendErr != nil {
+		return nil, m.sendErr
+	}
+	m.sent = append(m.sent, params)
+	return &sesv2.SendEmailOutput{}, nil
+}
+
+func TestReply(t *testing.T) {
+	client := newMockVacationTable(t, Settings{
+		Enabled:      true,
+		Text:         "I'm away.",
+		IntervalDays: 7,
+		TimeUpdated:  "2024-07-01T00:00:00Z",
+	})
+	email := Email{
+		MessageID:  "<second@example.com>",
+		References: "<first@example.com>",
+		Subject:    "Lunch?",
+		Sender:     "Bob@example.com",
+		Recipient:  "alice@example.org",
+		Headers:    mailboxTypes.Headers{{Name: "From", Value: "Bob <bob@example.com>"}},
+		Time:       time.Date(2024, 7, 2, 12, 0, 0, 0, time.UTC),
+	}
+
+	sent, err := Reply(context.TODO(), client, email)
+	assert.Nil(t, err)
+	assert.True(t, sent)
+	if assert.Len(t, client.sent, 1) {
+		input := client.sent[0]
+		assert.Equal(t, []string{"Bob@example.com"}, input.Destination.ToAddresses)
+		assert.Equal(t, "alice@example.org", *input.FromEmailAddress)
+		assert.Equal(t, "Auto: Lunch?", *input.Content.Simple.Subject.Data)
+		assert.Equal(t, "I'm away.", *input.Content.Simple.Body.Text.Data)
+		assert.Nil(t, input.Content.Simple.Body.Html)
+		headers := make(map[string]string)
+		for _, header := range input.Content.Simple.Headers {
+			headers[*header.Name] = *header.Value
+		}
+		assert.Equal(t, map[string]string{
+			"Auto-Submitted": "auto-replied",
+			"In-Reply-To":    "<second@example.com>",
+			"References":     "<first@example.com> <second@example.com>",
+		}, headers)
+	}
+	assert.Contains(t, client.items, senderPrefix+"bob@example.com")
+
+	// the sender is replied to once per interval
+	email.Time = email.Time.Add(6 * 24 * time.Hour)
+	sent, err = Reply(context.TODO(), client, email)
+	assert.Nil(t, err)
+	assert.False(t, sent)
+	email.Time = email.Time.Add(24 * time.Hour)
+	sent, err = Reply(context.TODO(), client, email)
+	assert.Nil(t, err)
+	assert.True(t, sent)
+	assert.Len(t, client.sent, 2)
+
+	// the sender is forgotten if the reply fails
+	client.sendErr = errors.New("send failed")
+	email.Sender = "carol@example.com"
+	_, err = Reply(context.TODO(), client, email)
+	assert.EqualError(t, err, "send failed")
+	assert.NotContains(t, client.items, senderPrefix+"carol@example.com")
+
+	// automatic emails aren't replied to
+	client.sendErr = nil
+	email.Headers = append(email.Headers, mailboxTypes.Header{Name: "Auto-Submitted", Value: "auto-replied"})
+	sent, err = Reply(context.TODO(), client, email)
+	assert.Nil(t, err)
+	assert.False(t, sent)
+
+	// nothing is sent if replies aren't set
+	sent, err = Reply(context.TODO(), &mockVacationTable{items: map[string]map[string]types.AttributeValue{}}, email)
+	assert.Nil(t, err)
+	assert.False(t, sent)
+}
+
+func TestSkipReason(t *testing.T) {
+	tests := []struct {
+		sender   string
+		headers  mailboxTypes.Headers
+		expected string
+	}{
+		{sender: "bob@example.com"},
+		{sender: "bob@example.com", headers: mailboxTypes.Headers{{Name: "Auto-Submitted", Value: "No"}}},
+		{sender: "bob@example.com", headers: mailboxTypes.Headers{{Name: "Precedence", Value: "first-class"}}},
+		{sender: "", expected: "no envelope sender"},
+		{sender: "<>", expected: "no envelope sender"},
+		{sender: "Alice@example.org", expected: "sent by the recipient"},
+		{sender: "MAILER-DAEMON@example.com", expected: "sent by an automatic sender"},
+		{sender: "owner-news@example.com", expected: "sent by an automatic sender"},
+		{sender: "news-request@example.com", expected: "sent by an automatic sender"},
+		{sender: "noreply@example.com", expected: "sent by an automatic sender"},
+		{sender: "bob@example.com", headers: mailboxTypes.Headers{{Name: "Auto-Submitted", Value: "auto-generated"}}, expected: "automatic email"},
+		{sender: "bob@example.com", headers: mailboxTypes.Headers{{Name: "Precedence", Value: "Bulk"}}, expected: "bulk email"},
+		{sender: "bob@example.com", headers: mailboxTypes.Headers{{Name: "List-Id", Value: "<news.example.com>"}}, expected: "email of a mailing list"},
+		{sender: "bob@example.com", headers: mailboxTypes.Headers{{Name: "X-Auto-Response-Suppress", Value: "DR, OOF"}}, expected: "automatic replies are suppressed"},
+	}
+	for _, test := range tests {
+		email := Email{Sender: test.sender, Recipient: "alice@example.org", Headers: test.headers}
+		assert.Equal(t, test.expected, skipReason(email), test.sender)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	assert.Equal(t, "<a@example.com>", references(Email{MessageID: "<a@example.com>"}))
+
+	// the oldest references are dropped
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, "<reference@example.com>")
+	}
+	value := references(Email{MessageID: "<last@example.com>", References: strings.Join(ids, " ")})
+	assert.LessOrEqual(t, len(value), maxHeaderLength)
+	assert.True(t, strings.HasSuffix(value, " <last@example.com>"))
+}
@@ -0,0 +1,193 @@
+// Package vacation replies automatically to received emails while the mailbox owner is away, e.g. on vacation.
+// The settings of the replies are saved in the email table, and every sender is replied to at most once per interval,
+// which is recorded in an item of the sender in the table.
+package vacation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/env"
+	"github.com/harryzcy/mailbox/internal/util/format"
+)
+
+const (
+	// itemID is the MessageID of the item storing the settings in the email table
+	itemID = "vacation#settings"
+	// senderPrefix is the prefix of the MessageID of the items recording when senders are replied to
+	senderPrefix = "vacation#sender#"
+
+	// DefaultIntervalDays is the number of days before a sender is replied to again, if IntervalDays isn't set
+	DefaultIntervalDays = 7
+	// MaxIntervalDays is the maximum of IntervalDays
+	MaxIntervalDays = 30
+	// MaxSubjectLength is the maximum length of the subject of the replies, in characters
+	MaxSubjectLength = 200
+	// MaxBodyLength is the maximum length of the text and the HTML of the replies, in bytes
+	MaxBodyLength = 20000
+
+	dateLayout = "2006-01-02"
+)
+
+// now is equal to time.Now, but will be replaced during testing
+var now = time.Now
+
+// Settings are the automatic replies sent to received emails
+type Settings struct {
+	Enabled      bool   `json:"enabled"`
+	Subject      string `json:"subject,omitempty"` // "Auto: " followed by the subject of the email if empty
+	Text         string `json:"text"`
+	HTML         string `json:"html,omitempty"`
+	Start        string `json:"start,omitempty"` // YYYY-MM-DD in TIME_ZONE, the first day replies are sent, or empty to start now
+	End          string `json:"end,omitempty"`   // YYYY-MM-DD in TIME_ZONE, the last day replies are sent, or empty until disabled
+	IntervalDays int    `json:"intervalDays"`    // days before the same sender is replied to again
+	TimeUpdated  string `json:"timeUpdated"`
+}
+
+// normalize trims the settings and checks them
+func (s *Settings) normalize() error {
+	s.Subject = strings.TrimSpace(s.Subject)
+	s.Start = strings.TrimSpace(s.Start)
+	s.End = strings.TrimSpace(s.End)
+	if strings.TrimSpace(s.Text) == "" {
+		return api.ErrInvalidInput
+	}
+	if utf8.RuneCountInString(s.Subject) > MaxSubjectLength || strings.ContainsAny(s.Subject, "\r\n") {
+		return api.ErrInvalidInput
+	}
+	if len(s.Text) > MaxBodyLength || len(s.HTML) > MaxBodyLength {
+		return api.ErrInvalidInput
+	}
+
+	if s.IntervalDays == 0 {
+		s.IntervalDays = DefaultIntervalDays
+	}
+	if s.IntervalDays < 0 || s.IntervalDays > MaxIntervalDays {
+		return api.ErrInvalidInput
+	}
+
+	start, end, err := s.dates()
+	if err != nil {
+		fmt.Printf("invalid dates of vacation, %v\n", err)
+		return api.ErrInvalidInput
+	}
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		return api.ErrInvalidInput
+	}
+	return nil
+}
+
+// dates returns the start of the first day and the end of the last day replies are sent, which are zero if not set
+func (s Settings) dates() (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	if s.Start != "" {
+		start, err = time.ParseInLocation(dateLayout, s.Start, format.Location())
+		if err != nil {
+			return start, end, err
+		}
+	}
+	if s.End != "" {
+		end, err = time.ParseInLocation(dateLayout, s.End, format.Location())
+		if err != nil {
+			return start, end, err
+		}
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
+
+// active returns whether replies are sent to emails received at t
+func (s Settings) active(t time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	start, end, err := s.dates()
+	if err != nil {
+		return false // only valid settings are saved
+	}
+	return (start.IsZero() || !t.Before(start)) && (end.IsZero() || t.Before(end))
+}
+
+// settingsKey returns the key of the item of the settings
+func settingsKey() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"MessageID": &types.AttributeValueMemberS{Value: itemID},
+	}
+}
+
+// Get returns the settings, or api.ErrNotFound if they're not set
+func Get(ctx context.Context, client api.GetItemAPI) (*Settings, error) {
+	resp, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(env.TableName),
+		Key:       settingsKey(),
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	if len(resp.Item) == 0 {
+		return nil, api.ErrNotFound
+	}
+
+	settings := &Settings{}
+	if err = attributevalue.UnmarshalMap(resp.Item, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// Put validates and saves the settings, replacing the previous ones.
+// Senders replied to before are replied to again, since the replies may be different.
+func Put(ctx context.Context, client api.PutItemAPI, settings Settings) (*Settings, error) {
+	if err := settings.normalize(); err != nil {
+		return nil, err
+	}
+	settings.TimeUpdated = now().UTC().Format(time.RFC3339Nano)
+
+	item, err := attributevalue.MarshalMap(settings)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range settingsKey() {
+		item[name] = value
+	}
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(env.TableName),
+		Item:      item,
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return nil, api.ErrTooManyRequests
+		}
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// Delete removes the settings, which stops the replies
+func Delete(ctx context.Context, client api.DeleteVacationAPI) error {
+	_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(env.TableName),
+		Key:       settingsKey(),
+	})
+	if err != nil {
+		if apiErr := new(types.ProvisionedThroughputExceededException); errors.As(err, &apiErr) {
+			return api.ErrTooManyRequests
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package vacation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harryzcy/mailbox/internal/api"
+	"github.com/harryzcy/mailbox/internal/clients"
+	"github.com/harryzcy/mailbox/internal/env"
+)
+
+func TestPut(t *testing.T) {
+	env.TableName = "table-for-vacation"
+	now = func() time.Time { return time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	var saved map[string]types.AttributeValue
+	client := clients.Fake{
+		MockPutItem: func(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			saved = params.Item
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		MockGetItem: func(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			assert.Equal(t, itemID, params.Key["MessageID"].(*types.AttributeValueMemberS).Value)
+			return &dynamodb.GetItemOutput{Item: saved}, nil
+		},
+	}
+
+	_, err := Get(context.TODO(), client)
+	assert.Equal(t, api.ErrNotFound, err)
+
+	settings, err := Put(context.TODO(), client, Settings{
+		Enabled: true,
+		Subject: " Out of office ",
+		Text:    "I'm away until July 15.",
+		Start:   "2024-07-01",
+		End:     "2024-07-14",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "Out of office", settings.Subject)
+	assert.Equal(t, DefaultIntervalDays, settings.IntervalDays)
+	assert.Equal(t, "2024-07-01T12:00:00Z", settings.TimeUpdated)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: itemID}, saved["MessageID"])
+
+	got, err := Get(context.TODO(), client)
+	assert.Nil(t, err)
+	assert.Equal(t, settings, got)
+
+	for _, input := range []Settings{
+		{Enabled: true},
+		{Text: "away", Subject: "Out\r\nBcc: someone@example.com"},
+		{Text: "away", IntervalDays: MaxIntervalDays + 1},
+		{Text: "away", IntervalDays: -1},
+		{Text: "away", Start: "20240701"},
+		{Text: "away", Start: "2024-07-14", End: "2024-07-01"},
+	} {
+		_, err = Put(context.TODO(), client, input)
+		assert.Equal(t, api.ErrInvalidInput, err, input)
+	}
+}
+
+func TestSettings_Active(t *testing.T) {
+	env.TimeZone = "America/New_York"
+	defer func() { env.TimeZone = "" }()
+	settings := Settings{Enabled: true, Start: "2024-07-01", End: "2024-07-14"}
+
+	tests := []struct {
+		time     time.Time
+		expected bool
+	}{
+		{time.Date(2024, 7, 1, 3, 59, 0, 0, time.UTC), false}, // June 30 in New York
+		{time.Date(2024, 7, 1, 4, 0, 0, 0, time.UTC), true},
+		{time.Date(2024, 7, 15, 3, 59, 0, 0, time.UTC), true}, // the last day is included
+		{time.Date(2024, 7, 15, 4, 0, 0, 0, time.UTC), false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, settings.active(test.time), test.time)
+	}
+
+	assert.True(t, Settings{Enabled: true}.active(time.Now()))
+	settings.Enabled = false
+	assert.False(t, settings.active(time.Date(2024, 7, 5, 0, 0, 0, 0, time.UTC)))
+}
@@ -0,0 +1,77 @@
+#!/bin/bash
+
+# Invokes a deployed function and reports its latency and cost from the REPORT lines of its logs,
+# e.g. to compare the x86_64 and arm64 builds of the same function.
+#
+# Usage: ./script/benchmark.sh <function-name> [invocations] [payload-file]
+#
+# The first invocation after a deployment is a cold start, whose init duration is reported separately.
+# Costs are estimated from the billed duration and memory size, with the prices per GB-second of
+# PRICE_X86_64 and PRICE_ARM64 (defaults of us-east-1), excluding the price per request.
+
+set -e
+
+FUNCTION=$1
+INVOCATIONS=${2:-20}
+PAYLOAD=$3
+
+PRICE_X86_64=${PRICE_X86_64:-0.0000166667}
+PRICE_ARM64=${PRICE_ARM64:-0.0000133334}
+
+if [ -z "$FUNCTION" ]; then
+  echo "usage: $0 <function-name> [invocations] [payload-file]"
+  exit 1
+fi
+
+architecture=$(aws lambda get-function-configuration --function-name "$FUNCTION" --query 'Architectures[0]' --output text)
+price=$PRICE_X86_64
+if [ "$architecture" == "arm64" ]; then
+  price=$PRICE_ARM64
+fi
+
+payload_args=()
+if [ -n "$PAYLOAD" ]; then
+  payload_args=(--cli-binary-format raw-in-base64-out --payload "fileb://${PAYLOAD}")
+fi
+
+reports=$(mktemp)
+response=$(mktemp)
+trap 'rm -f "$reports" "$response"' EXIT
+
+for ((i = 1; i <= INVOCATIONS; i++)); do
+  aws lambda invoke --function-name "$FUNCTION" --log-type Tail "${payload_args[@]}" \
+    --query 'LogResult' --output text "$response" |
+    base64 --decode |
+    grep '^REPORT' >>"$reports" || true
+done
+
+# REPORT lines have tab separated fields, e.g. "Billed Duration: 3 ms"
+awk -F '\t' -v fn="$FUNCTION" -v arch="$architecture" -v price="$price" '
+  {
+    for (i = 1; i <= NF; i++) {
+      split($i, kv, ": ")
+      split(kv[2], value, " ")
+      metrics[kv[1]] = value[1]
+    }
+    n++
+    duration += metrics["Duration"]
+    billed += metrics["Billed Duration"]
+    memory = metrics["Memory Size"]
+    if (metrics["Max Memory Used"] > used) used = metrics["Max Memory Used"]
+    if ("Init Duration" in metrics) { cold++; init += metrics["Init Duration"] }
+    delete metrics
+  }
+  END {
+    if (n == 0) {
+      print "no REPORT lines found"
+      exit 1
+    }
+    printf "function:          %s (%s, %d MB)\n", fn, arch, memory
+    printf "invocations:       %d, %d cold\n", n, cold
+    printf "avg duration:      %.2f ms\n", duration / n
+    printf "avg billed:        %.2f ms\n", billed / n
+    if (cold > 0) printf "avg init duration: %.2f ms\n", init / cold
+    printf "max memory used:   %d MB\n", used
+    printf "cost per 1M:       $%.4f\n", billed / n / 1000 * memory / 1024 * price * 1000000
+  }
+' "$reports"
@@ -9,23 +9,55 @@ BUILD_COMMIT=$(git rev-parse --short HEAD)
 BUILD_DATE=$(date -u +"%Y-%m-%dT%H:%M:%SZ")
 BUILD_VERSION=$(git describe --tags --always)
 
-ENVIRONMENT="env GOOS=linux GOARCH=amd64 CGO_ENABLED=0"
+# amd64 for x86_64 functions, or arm64 for Graviton, which must match the architecture in serverless.yml
+ARCH=${ARCH:-amd64}
+if [ "$ARCH" != "amd64" ] && [ "$ARCH" != "arm64" ]; then
+  echo "unsupported ARCH ${ARCH}, expected amd64 or arm64"
+  exit 1
+fi
+
+ENVIRONMENT="env GOOS=linux GOARCH=${ARCH} CGO_ENABLED=0"
+# The provided runtimes don't use the RPC mode of aws-lambda-go, whose reflection keeps
+# every method of the linked service clients in the binaries
+BUILD_TAGS="lambda.norpc"
 
 apiFuncs=(
-  "emails/list" "emails/get" "emails/getRaw" "emails/getContent" "emails/read" "emails/trash" "emails/untrash"
-  "emails/delete" "emails/create" "emails/save" "emails/send" "emails/reparse"
-  "threads/get" "threads/trash" "threads/untrash" "threads/delete"
+  "emails/list" "emails/updates" "emails/search" "emails/get" "emails/getRaw" "emails/streamRaw" "emails/streamHTML" "emails/getDeliveryPath" "emails/getHistory" "emails/getHeaders" "emails/getByMessageID" "emails/getContent" "emails/getContentURL" "emails/getAttachedEmail" "emails/read" "emails/star" "emails/labels" "emails/archive" "emails/share" "emails/trash" "emails/untrash"
+  "emails/delete" "emails/batch" "emails/bulkDelete/create" "emails/bulkDelete/get" "emails/bulkDelete/cancel" "emails/bulkLabel/create" "emails/bulkLabel/get" "emails/bulkLabel/cancel" "emails/create" "emails/forward" "emails/upload" "emails/save" "emails/patch" "emails/send" "emails/reparse"
+  "uploads/create"
+  "drafts/list"
+  "outbox/list" "outbox/retry" "outbox/cancel"
+  "threads/list" "threads/get" "threads/trash" "threads/untrash" "threads/delete"
+  "trash/empty"
+  "share/view"
+  "autoconfig/mozilla" "autoconfig/autodiscover"
+  "imports/get"
+  "exports/create" "exports/get"
+  "jobs/get" "jobs/cancel"
+  "reports/get"
+  "counts/get"
+  "analytics/domains"
+  "sieve/get" "sieve/put" "sieve/delete" "sieve/validate"
+  "rules/test" "rules/create" "rules/list" "rules/update" "rules/delete"
+  "vacation/get" "vacation/put" "vacation/delete"
+  "senders/list" "senders/create" "senders/delete"
+  "devices/register" "devices/list" "devices/unregister"
+  "webpush/subscribe" "webpush/list" "webpush/unsubscribe"
+  "webhooks/create" "webhooks/list" "webhooks/delete"
+  "labels/create" "labels/list" "labels/update" "labels/delete"
+  "send"
+  "admin/items/get" "admin/items/patch" "admin/items/repair" "admin/settings/get" "admin/settings/put"
 )
 
 for i in "${!apiFuncs[@]}"; do
   func="${apiFuncs[$i]}"
-  ${ENVIRONMENT} go build -ldflags="-s -w" -o bin/api/"${func}" api/"${func}"/*
+  ${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/api/"${func}" api/"${func}"/*
   cp bin/api/"${func}" bin/bootstrap
   zipFilename="${func//\//_}"
   zip -j bin/"${zipFilename}".zip bin/bootstrap
 done
 
-${ENVIRONMENT} go build -ldflags="-s -w \
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w \
                                   -X 'main.version=${BUILD_VERSION}' \
                                   -X 'main.commit=${BUILD_COMMIT}' \
                                   -X 'main.buildDate=${BUILD_DATE}' \
@@ -34,9 +66,65 @@ ${ENVIRONMENT} go build -ldflags="-s -w \
 cp bin/api/info bin/bootstrap
 zip -j bin/info.zip bin/bootstrap
 
-${ENVIRONMENT} go build -ldflags="-s -w" -o bin/functions/emailReceive functions/emailReceive/*
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/emailReceive functions/emailReceive/*
 cp bin/functions/emailReceive bin/bootstrap
 zip -j bin/emailReceive.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/emailReceiveBatch functions/emailReceiveBatch/*
+cp bin/functions/emailReceiveBatch bin/bootstrap
+zip -j bin/emailReceiveBatch.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/countersRecount functions/countersRecount/*
+cp bin/functions/countersRecount bin/bootstrap
+zip -j bin/countersRecount.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/mailImport functions/mailImport/*
+cp bin/functions/mailImport bin/bootstrap
+zip -j bin/mailImport.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/emailImport functions/emailImport/*
+cp bin/functions/emailImport bin/bootstrap
+zip -j bin/emailImport.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/digest functions/digest/*
+cp bin/functions/digest bin/bootstrap
+zip -j bin/digest.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/reportMonthly functions/reportMonthly/*
+cp bin/functions/reportMonthly bin/bootstrap
+zip -j bin/reportMonthly.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/notificationsFlush functions/notificationsFlush/*
+cp bin/functions/notificationsFlush bin/bootstrap
+zip -j bin/notificationsFlush.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/sendRetry functions/sendRetry/*
+cp bin/functions/sendRetry bin/bootstrap
+zip -j bin/sendRetry.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/trashExpire functions/trashExpire/*
+cp bin/functions/trashExpire bin/bootstrap
+zip -j bin/trashExpire.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/trashPurge functions/trashPurge/*
+cp bin/functions/trashPurge bin/bootstrap
+zip -j bin/trashPurge.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/bodiesExpire functions/bodiesExpire/*
+cp bin/functions/bodiesExpire bin/bootstrap
+zip -j bin/bodiesExpire.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/emailsExport functions/emailsExport/*
+cp bin/functions/emailsExport bin/bootstrap
+zip -j bin/emailsExport.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/jobs functions/jobs/*
+cp bin/functions/jobs bin/bootstrap
+zip -j bin/jobs.zip bin/bootstrap
+
+${ENVIRONMENT} go build -tags "${BUILD_TAGS}" -ldflags="-s -w" -o bin/functions/jobsWorkflow functions/jobsWorkflow/*
+cp bin/functions/jobsWorkflow bin/bootstrap
+zip -j bin/jobsWorkflow.zip bin/bootstrap
 rm bin/bootstrap
 
 if [ $ZIP_ONLY == "true" ]; then
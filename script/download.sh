@@ -1,5 +1,8 @@
 #!/bin/bash
 
+# amd64 or arm64, which must match the architecture in serverless.yml
+ARCH=${ARCH:-amd64}
+
 tag_name=$(
     curl -s https://api.github.com/repos/harryzcy/mailbox/releases/latest |
         grep "tag_name" |
@@ -7,10 +10,10 @@ tag_name=$(
         tr -d "\",[:space:]"
 )
 
-url="https://github.com/harryzcy/mailbox/releases/download/${tag_name}/mailbox-linux-amd64.tar.gz"
+url="https://github.com/harryzcy/mailbox/releases/download/${tag_name}/mailbox-linux-${ARCH}.tar.gz"
 
 echo "Downloading build asset from ${url}"
-curl -L "${url}" -o mailbox-linux-amd64.tar.gz
+curl -L "${url}" -o mailbox-linux-${ARCH}.tar.gz
 
-tar -xzvf mailbox-linux-amd64.tar.gz --strip-components=1
-rm mailbox-linux-amd64.tar.gz
+tar -xzvf mailbox-linux-${ARCH}.tar.gz --strip-components=1
+rm mailbox-linux-${ARCH}.tar.gz